@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,6 +13,7 @@ import (
 	sysruntime "runtime"
 	"shuji/db"
 	"strings"
+	"sync"
 	"time"
 
 	"shuji/data_import"
@@ -29,6 +31,10 @@ type App struct {
 	fs      embed.FS
 	db      *db.Database
 	dbError error
+	dbMutex sync.RWMutex // 保护db、dbError和readOnly，关闭和替换数据库时持有写锁
+
+	diagnosis *StartupDiagnosis // 启动时的数据库检查结果
+	readOnly  bool              // 数据库异常时以只读模式打开
 }
 
 var Config = &AppConfig{}
@@ -77,6 +83,11 @@ func CreateApp(fs embed.FS) *App {
 	ENCRYPTED_ZERO = encryptedZero
 	ENCRYPTED_ONE = encryptedOne
 
+	// SQL解密函数需在打开数据库之前注册
+	if err := db.RegisterCipherFunctions(db.CipherFunc(SM4Decrypt)); err != nil {
+		log.Printf("注册SQL解密函数失败: %v", err)
+	}
+
 	app := NewApp()
 	app.fs = fs
 
@@ -95,12 +106,28 @@ func CreateApp(fs embed.FS) *App {
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	newDb, err := db.NewDatabase(dbDstPath, DB_PASSWORD)
-	if err != nil {
-		log.Printf("创建数据库失败: %v", err)
-		app.dbError = err
-	} else {
+	// 删除上次异常退出遗留的明文工作文件，系统数据库未写回的工作文件保留，打开时继续使用
+	if err := db.RemoveStaleWorkingFiles(dbDstPath); err != nil {
+		log.Printf("清理数据库工作文件失败: %v", err)
+	}
+
+	// 启动检查，数据库异常时不退出，生成诊断包并等待用户选择处理方式
+	diagnosis, newDb := diagnoseDatabase(dbDstPath)
+	app.diagnosis = &diagnosis
+	if newDb != nil {
 		app.db = newDb
+		// 签名密钥移出系统数据库，之后的快照和导出不再包含私钥
+		if err := app.migrateWorkstationKey(); err != nil {
+			log.Printf("迁移签名密钥失败: %v", err)
+		}
+	} else {
+		log.Printf("数据库启动检查未通过: %s", diagnosis.Summary())
+		app.dbError = errors.New(diagnosis.Summary())
+		if bundlePath, err := writeDiagnosticBundle(&diagnosis); err != nil {
+			log.Printf("生成诊断包失败: %v", err)
+		} else {
+			diagnosis.BundlePath = bundlePath
+		}
 	}
 
 	log.Printf("数据库路径: %s", dbDstPath)
@@ -133,6 +160,12 @@ func createCacheDirs(basePath string) {
 			os.MkdirAll(subDir, os.ModePerm)
 		}
 	}
+
+	// 检查并创建原始文件归档目录
+	archiveDir := filepath.Join(basePath, ARCHIVE_FILE_DIR_NAME)
+	if _, err := os.Stat(archiveDir); os.IsNotExist(err) {
+		os.MkdirAll(archiveDir, os.ModePerm)
+	}
 }
 
 // 抽取嵌入式文件
@@ -181,33 +214,46 @@ func extractFile(fs embed.FS, srcPath, dstPath string) {
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 
-	if a.dbError != nil {
-		runtime.WindowHide(ctx)
-		errorMsg := fmt.Sprintf("数据库初始化失败：%v\n\n", a.dbError)
+	if _, _, dbError := a.getDbState(); dbError != nil {
+		errorMsg := fmt.Sprintf("数据库检查未通过：%v\n\n", dbError)
 
 		// 根据错误类型提供更具体的建议
-		if strings.Contains(a.dbError.Error(), "out of memory") {
+		if a.diagnosis != nil && (len(a.diagnosis.IntegrityProblems) > 0 || len(a.diagnosis.MissingTables) > 0) {
+			errorMsg += "可能的原因：\n• 数据库文件损坏\n• 程序上次未正常关闭\n• 数据库文件被其他程序修改\n\n"
+		} else if strings.Contains(dbError.Error(), db.ErrWrongKey.Error()) {
+			errorMsg += "可能的原因：\n• 数据库文件不是本软件生成\n• 数据库文件被修改或损坏\n\n"
+		} else if strings.Contains(dbError.Error(), "out of memory") {
 			errorMsg += "可能的原因：\n• 数据库密码错误\n• 数据库文件损坏\n\n"
-		} else if strings.Contains(a.dbError.Error(), "file is not a database") {
+		} else if strings.Contains(dbError.Error(), "file is not a database") {
 			errorMsg += "可能的原因：\n• 数据库文件损坏或不是有效的SQLite文件\n• 文件被其他程序占用\n\n"
 		} else {
 			errorMsg += "可能的原因：\n• 数据库文件不存在\n• 文件权限问题\n• 磁盘空间不足\n\n"
 		}
 
-		errorMsg += "请检查数据库文件或联系技术支持。\n\n程序将退出。"
+		errorMsg += "请在数据库恢复页面选择恢复最近的快照、从原数据库抢救数据，或以只读模式查看数据。"
+		if a.diagnosis != nil && a.diagnosis.BundlePath != "" {
+			errorMsg += "\n\n诊断信息已保存到：" + a.diagnosis.BundlePath + "，如需技术支持请提供该文件。"
+		}
 
 		runtime.MessageDialog(ctx, runtime.MessageDialogOptions{
-			Type:    runtime.ErrorDialog,
+			Type:    runtime.WarningDialog,
 			Title:   "数据库错误",
 			Message: errorMsg,
 		})
-		runtime.Quit(ctx)
-		os.Exit(0)
 	}
+
+	// 启动每日快照任务，数据库恢复后自动开始创建
+	a.startSnapshotScheduler(ctx)
+}
+
+// 关闭程序时关闭数据库，将数据加密写回数据库文件
+func (a *App) shutdown(ctx context.Context) {
+	a.replaceSystemDb(nil, false, fmt.Errorf("程序已退出"))
 }
 
 // 退出程序
 func (a *App) ExitApp() {
+	a.shutdown(a.ctx)
 	runtime.Quit(a.ctx)
 	os.Exit(0)
 }
@@ -216,8 +262,9 @@ func (a *App) GetCtx() context.Context {
 	return a.ctx
 }
 
+// GetDBPassword 获取交换文件密码，用于打开其他单位报送的数据库文件，系统数据库使用本机密钥
 func (a *App) GetDBPassword() string {
-	return DB_PASSWORD
+	return EXCHANGE_DB_PASSWORD
 }
 
 // 获取运行环境变量
@@ -495,6 +542,11 @@ func (a *App) GetCachePath(tableType string) string {
 	return GetPath(filepath.Join(CACHE_FILE_DIR_NAME, tableType))
 }
 
+// GetArchivePath 获取原始文件归档路径
+func (a *App) GetArchivePath() string {
+	return GetPath(ARCHIVE_FILE_DIR_NAME)
+}
+
 // CacheFileExists 检查缓存文件是否存在
 func (a *App) CacheFileExists(tableType string, fileName string) db.QueryResult {
 	// 使用包装函数来处理异常
@@ -543,11 +595,36 @@ func (a *App) copyFileToCacheWithRecover(tableType string, filePath string) db.Q
 	return db.QueryResult{Ok: true, Message: "文件复制成功", Data: cachePath}
 }
 
-// GetDB 获取数据库实例
+// GetDB 获取数据库实例，数据库关闭或替换期间等待，之后获取到的是替换后的数据库
 func (a *App) GetDB() *db.Database {
+	a.dbMutex.RLock()
+	defer a.dbMutex.RUnlock()
 	return a.db
 }
 
+// getDbState 获取系统数据库及其状态
+func (a *App) getDbState() (*db.Database, bool, error) {
+	a.dbMutex.RLock()
+	defer a.dbMutex.RUnlock()
+	return a.db, a.readOnly, a.dbError
+}
+
+// replaceSystemDb 关闭当前的系统数据库并替换为database，关闭期间持有写锁，
+// 快照任务和前端调用不会再取得正在关闭的数据库。database为nil时dbErr为数据库不可用的原因
+func (a *App) replaceSystemDb(database *db.Database, readOnly bool, dbErr error) {
+	a.dbMutex.Lock()
+	defer a.dbMutex.Unlock()
+
+	if a.db != nil && a.db != database {
+		if err := a.db.Close(); err != nil {
+			log.Printf("关闭数据库失败: %v", err)
+		}
+	}
+	a.db = database
+	a.readOnly = readOnly
+	a.dbError = dbErr
+}
+
 // func (a *App) GetConstants() Constants {
 // 	return constants
 // }
@@ -636,26 +713,157 @@ func (a *App) ModelDataCoverAttachment2(fileNames []string) db.QueryResult {
 	return dataImportService.ModelDataCoverAttachment2(fileNames)
 }
 
+// PreviewModelDataCover 覆盖前预览待覆盖文件与库中数据的字段差异
+func (a *App) PreviewModelDataCover(tableType string, filePaths []string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.PreviewModelDataCover(tableType, filePaths)
+}
+
+// ModelDataCoverRecords 按确认结果覆盖数据，excludedKeys中的记录不覆盖
+func (a *App) ModelDataCoverRecords(tableType string, filePaths []string, excludedKeys []string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.ModelDataCoverRecords(tableType, filePaths, excludedKeys)
+}
+
+// ==================== 批次内重复数据 API ====================
+
+// GetBatchDuplicates 获取待校验文件之间的重复数据
+func (a *App) GetBatchDuplicates(tableType string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.GetBatchDuplicates(tableType)
+}
+
+// ResolveBatchDuplicates 保存重复数据的保留文件选择，winners为记录标识到保留文件路径的映射
+func (a *App) ResolveBatchDuplicates(tableType string, winners map[string]string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.ResolveBatchDuplicates(tableType, winners)
+}
+
+// ==================== 模型校验警告确认 API ====================
+
+// AcknowledgeValidationWarnings 确认仅有警告的文件，记录确认人，重新校验时导入
+func (a *App) AcknowledgeValidationWarnings(tableType string, fileNames []string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.AcknowledgeValidationWarnings(tableType, fileNames)
+}
+
+// ==================== 单条数据修改 API ====================
+
+// UpdateTable1MainRecord 修改附表1单位基本信息，reason为必填的修改原因
+func (a *App) UpdateTable1MainRecord(objID string, changes map[string]string, reason string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.UpdateTable1MainRecord(objID, changes, reason)
+}
+
+// UpdateTable1UsageRecord 修改附表1煤炭消费主要用途情况
+func (a *App) UpdateTable1UsageRecord(objID string, changes map[string]string, reason string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.UpdateTable1UsageRecord(objID, changes, reason)
+}
+
+// UpdateTable1EquipRecord 修改附表1重点耗煤装置情况
+func (a *App) UpdateTable1EquipRecord(objID string, changes map[string]string, reason string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.UpdateTable1EquipRecord(objID, changes, reason)
+}
+
+// UpdateTable2Record 修改附表2重点耗煤装置
+func (a *App) UpdateTable2Record(objID string, changes map[string]string, reason string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.UpdateTable2Record(objID, changes, reason)
+}
+
+// UpdateTable3Record 修改附表3固定资产投资项目
+func (a *App) UpdateTable3Record(objID string, changes map[string]string, reason string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.UpdateTable3Record(objID, changes, reason)
+}
+
+// UpdateAttachment2Record 修改附件2煤炭消费状况
+func (a *App) UpdateAttachment2Record(objID string, changes map[string]string, reason string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.UpdateAttachment2Record(objID, changes, reason)
+}
+
+// QueryDataChangeLog 查询单条数据的修改记录
+func (a *App) QueryDataChangeLog(objID string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.QueryDataChangeLog(objID)
+}
+
+// ==================== 填报模板 API ====================
+
+// GenerateTemplates 根据企业清单、装置清单生成个性化填报模板
+func (a *App) GenerateTemplates(tableType, templatePath, outputDir, statDate string, creditCodes []string, batch bool) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.GenerateTemplates(tableType, templatePath, outputDir, statDate, creditCodes, batch)
+}
+
+// ==================== 原始文件归档 API ====================
+
+// ExportOriginalFile 根据文件哈希导出归档的原始文件
+func (a *App) ExportOriginalFile(fileHash string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.ExportOriginalFile(fileHash)
+}
+
+// ExportOriginalFileByRecord 根据数据记录导出其来源的原始文件
+func (a *App) ExportOriginalFileByRecord(tableType, objID string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.ExportOriginalFileByRecord(tableType, objID)
+}
+
+// ==================== 报送状态 API ====================
+
+// QuerySubmissionStatus 查询本单位各年份的报送状态及变更记录
+func (a *App) QuerySubmissionStatus() db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.QuerySubmissionStatus()
+}
+
+// ReopenSubmissionYear 重新开放已报送的年份
+func (a *App) ReopenSubmissionYear(statDate string, reason string) db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.ReopenSubmissionYear(statDate, reason)
+}
+
+// QueryReceiptRejections 查询上级回执中未接收的数据及原因
+func (a *App) QueryReceiptRejections() db.QueryResult {
+	dataImportService := data_import.NewDataImportService(a)
+	return dataImportService.QueryReceiptRejections()
+}
+
 // ==================== 导入记录服务 API ====================
 
 // InsertImportRecord 插入导入记录
 func (a *App) InsertImportRecord(fileName, fileType, importState, describe string) {
-	if a.dbError != nil {
+	if a.GetDB() == nil {
 		log.Printf("数据库连接失败，无法插入日志")
 		return
 	}
 
-	service := NewDataImportRecordService(a.db, a)
+	service := NewDataImportRecordService(a)
 	service.InsertImportRecord(fileName, fileType, importState, describe)
 }
 
+// InsertImportRecordWithHash 插入带源文件哈希的导入记录
+func (a *App) InsertImportRecordWithHash(fileName, fileType, importState, describe, fileHash string) {
+	if a.GetDB() == nil {
+		log.Printf("数据库连接失败，无法插入日志")
+		return
+	}
+
+	service := NewDataImportRecordService(a)
+	service.InsertImportRecordWithHash(fileName, fileType, importState, describe, fileHash)
+}
+
 // GetImportRecordsByFileType 根据文件类型查询导入记录
 func (a *App) GetImportRecordsByFileType(fileType string) db.QueryResult {
-	if a.dbError != nil {
+	if a.GetDB() == nil {
 		return db.QueryResult{Ok: false, Message: "数据库连接失败"}
 	}
 
-	service := NewDataImportRecordService(a.db, a)
+	service := NewDataImportRecordService(a)
 	return service.GetImportRecordsByFileType(fileType)
 }
 
@@ -673,10 +881,12 @@ func (a *App) QueryDataDetailTable1(obj_id string) db.QueryResult {
 	return dataImportService.QueryDataDetailTable1(obj_id)
 }
 
-// 查询附表1详细数据，指定数据库文件路径
+// QueryDataDetailTable1ByDBFile 查询附表1详细数据，指定数据库文件或报送数据包路径，报送数据包校验通过后才读取
 func (a *App) QueryDataDetailTable1ByDBFile(obj_ids []string, dbFilePath string) db.QueryResult {
 	dataImportService := data_import.NewDataImportService(a)
-	return dataImportService.QueryDataDetailTable1ByDBFile(obj_ids, dbFilePath)
+	return a.queryMergeSource(dbFilePath, func(dbPath string) db.QueryResult {
+		return dataImportService.QueryDataDetailTable1ByDBFile(obj_ids, dbPath)
+	})
 }
 
 // ConfirmDataTable1 确认附表1数据
@@ -697,10 +907,12 @@ func (a *App) QueryDataDetailTable2(obj_id string) db.QueryResult {
 	return dataImportService.QueryDataDetailTable2(obj_id)
 }
 
-// QueryDataDetailTable2ByDBFile 查询附表2详细数据，指定数据库文件路径
+// QueryDataDetailTable2ByDBFile 查询附表2详细数据，指定数据库文件或报送数据包路径，报送数据包校验通过后才读取
 func (a *App) QueryDataDetailTable2ByDBFile(obj_ids []string, dbFilePath string) db.QueryResult {
 	dataImportService := data_import.NewDataImportService(a)
-	return dataImportService.QueryDataDetailTable2ByDBFile(obj_ids, dbFilePath)
+	return a.queryMergeSource(dbFilePath, func(dbPath string) db.QueryResult {
+		return dataImportService.QueryDataDetailTable2ByDBFile(obj_ids, dbPath)
+	})
 }
 
 // ConfirmDataTable2 确认附表2数据
@@ -721,10 +933,12 @@ func (a *App) QueryDataDetailTable3(obj_id string) db.QueryResult {
 	return dataImportService.QueryDataDetailTable3(obj_id)
 }
 
-// QueryDataDetailTable3ByDBFile 查询附表3详细数据，指定数据库文件路径
+// QueryDataDetailTable3ByDBFile 查询附表3详细数据，指定数据库文件或报送数据包路径，报送数据包校验通过后才读取
 func (a *App) QueryDataDetailTable3ByDBFile(obj_ids []string, dbFilePath string) db.QueryResult {
 	dataImportService := data_import.NewDataImportService(a)
-	return dataImportService.QueryDataDetailTable3ByDBFile(obj_ids, dbFilePath)
+	return a.queryMergeSource(dbFilePath, func(dbPath string) db.QueryResult {
+		return dataImportService.QueryDataDetailTable3ByDBFile(obj_ids, dbPath)
+	})
 }
 
 // ConfirmDataTable3 确认附表3数据
@@ -745,10 +959,12 @@ func (a *App) QueryDataDetailAttachment2(obj_id string) db.QueryResult {
 	return dataImportService.QueryDataDetailAttachment2(obj_id)
 }
 
-// QueryDataDetailAttachment2ByDBFile 查询附件2详细数据，指定数据库文件路径
+// QueryDataDetailAttachment2ByDBFile 查询附件2详细数据，指定数据库文件或报送数据包路径，报送数据包校验通过后才读取
 func (a *App) QueryDataDetailAttachment2ByDBFile(obj_ids []string, dbFilePath string) db.QueryResult {
 	dataImportService := data_import.NewDataImportService(a)
-	return dataImportService.QueryDataDetailAttachment2ByDBFile(obj_ids, dbFilePath)
+	return a.queryMergeSource(dbFilePath, func(dbPath string) db.QueryResult {
+		return dataImportService.QueryDataDetailAttachment2ByDBFile(obj_ids, dbPath)
+	})
 }
 
 // ConfirmDataAttachment2 确认附件2数据
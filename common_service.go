@@ -44,7 +44,7 @@ func (a *App) setUserPasswordWithRecover(password string) db.QueryResult {
 	}
 
 	// 开始事务
-	tx, err := a.db.Begin()
+	tx, err := a.GetDB().Begin()
 	if err != nil {
 		result.Message = "开始事务失败: " + err.Error()
 		return result
@@ -104,7 +104,7 @@ func (a *App) getPasswordInfoWithRecover() db.QueryResult {
 		}
 	}()
 
-	result, err := a.db.Query("SELECT obj_id, user_pws FROM pws_info LIMIT 1")
+	result, err := a.GetDB().Query("SELECT obj_id, user_pws FROM pws_info LIMIT 1")
 	if err != nil {
 		return db.QueryResult{Ok: false, Message: "查询密码信息失败: " + err.Error()}
 	}
@@ -139,7 +139,7 @@ func (a *App) loginWithRecover(password string) db.QueryResult {
 	}
 
 	// 从数据库查询第一条数据
-	result, err := a.db.QueryRow("SELECT obj_id, user_pws, admin_pws FROM pws_info LIMIT 1")
+	result, err := a.GetDB().QueryRow("SELECT obj_id, user_pws, admin_pws FROM pws_info LIMIT 1")
 	if err != nil {
 		return db.QueryResult{Ok: false, Message: "查询密码信息失败: " + err.Error()}
 	}
@@ -209,7 +209,7 @@ func (a *App) saveAreaConfigWithRecover(config AreaConfig) db.QueryResult {
 
 	// 生成UUID作为obj_id
 	objID := uuid.New().String()
-	_, err := a.db.Exec(
+	_, err := a.GetDB().Exec(
 		`INSERT INTO area_config (obj_id, province_name, city_name, country_name) VALUES (?, ?, ?, ?)`,
 		objID, config.ProvinceName, config.CityName, config.CountryName,
 	)
@@ -262,7 +262,7 @@ func (a *App) getAreaConfigWithRecover() db.QueryResult {
 		return db.QueryResult{Ok: true, Data: areaConfigData, Message: "获取成功"}
 	}
 
-	result, err := a.db.QueryRow("SELECT obj_id, province_name, city_name, country_name FROM area_config LIMIT 1")
+	result, err := a.GetDB().QueryRow("SELECT obj_id, province_name, city_name, country_name FROM area_config LIMIT 1")
 	if err != nil {
 		return db.QueryResult{Ok: false, Message: "获取区域信息失败: " + err.Error()}
 	}
@@ -296,7 +296,7 @@ func (a *App) getEnhancedAreaConfigWithRecover() db.QueryResult {
 	}
 
 	// 从数据库获取基础区域配置
-	result, err := a.db.QueryRow("SELECT obj_id, province_name, city_name, country_name FROM area_config LIMIT 1")
+	result, err := a.GetDB().QueryRow("SELECT obj_id, province_name, city_name, country_name FROM area_config LIMIT 1")
 	if err != nil {
 		return db.QueryResult{Ok: false, Message: "获取区域信息失败: " + err.Error()}
 	}
@@ -17,11 +17,30 @@ const (
 	// 缓存文件目录名称
 	CACHE_FILE_DIR_NAME = CACHE_DIR_NAME + "/files"
 
+	// 原始文件归档目录名称（按内容哈希存放）
+	ARCHIVE_FILE_DIR_NAME = CACHE_DIR_NAME + "/archive"
+
+	// 数据库快照目录名称
+	SNAPSHOT_DIR_NAME = DATA_DIR_NAME + "/snapshots"
+
+	// 启动诊断信息目录名称
+	DIAGNOSTIC_DIR_NAME = DATA_DIR_NAME + "/diagnostics"
+
+	// 本机密钥目录名称
+	KEY_DIR_NAME = DATA_DIR_NAME + "/keys"
+
+	// 本机签名密钥文件名
+	WORKSTATION_KEY_FILE_NAME = "workstation_key.json"
+
+	// 系统数据库密钥文件名
+	SYSTEM_DB_KEY_FILE_NAME = "system_db.key"
+
 	// 数据库文件名
 	DB_FILE_NAME = "coal_consumption_data.db"
 
-	// 数据库密码
-	DB_PASSWORD = "shuji"
+	// 交换文件密码，导出的数据库、报送数据包和增量数据文件在各单位之间交换，使用相同的密码加密，来源由SM2签名确认。
+	// 系统数据库使用本机密钥加密，见getSystemDbPassword
+	EXCHANGE_DB_PASSWORD = "shuji"
 
 	// 前端文件目录名称
 	FRONTEND_FILE_DIR_NAME = "frontend/dist/"
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"shuji/db"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // 数据导出服务
@@ -33,21 +35,21 @@ func (a *App) QueryExportData() db.QueryResult {
 	result := db.QueryResult{}
 
 	// 检查数据库连接
-	if a.db == nil {
+	if a.GetDB() == nil {
 		result.Ok = false
 		result.Message = "数据库未初始化"
 		return result
 	}
 
 	// 1. 查询企业清单记录数
-	table1CountResult, err := a.db.Count("enterprise_list", "")
+	enterpriseCount, err := db.NewRepository[db.EnterpriseList](a.GetDB(), a).Count("")
 	if err != nil {
 		result.Ok = false
 		result.Message = "查询企业清单记录数失败: " + err.Error()
 		return result
 	}
 
-	table1Count := int(table1CountResult.Data.(map[string]interface{})["count"].(int64))
+	table1Count := int(enterpriseCount)
 
 	// 2. 查询表1记录数，用stat_date,is_confirm分组
 	table1Query := fmt.Sprintf(`
@@ -59,7 +61,7 @@ func (a *App) QueryExportData() db.QueryResult {
 		GROUP BY stat_date
 		ORDER BY stat_date
 	`, ENCRYPTED_ONE)
-	table1Result, err := a.db.Query(table1Query)
+	table1Result, err := a.GetDB().Query(table1Query)
 	if err != nil {
 		result.Ok = false
 		result.Message = "查询表1数据失败: " + err.Error()
@@ -77,12 +79,8 @@ func (a *App) QueryExportData() db.QueryResult {
 					statDate = date
 				}
 
-				totalCount := 0
-				if count, ok := row["total_count"].(int64); ok {
-					totalCount = int(count)
-				}
-
-				isConfirmYes := int(row["is_confirm_yes"].(int64))
+				totalCount := int(db.IntValue(row["total_count"]))
+				isConfirmYes := int(db.IntValue(row["is_confirm_yes"]))
 
 				item := &ExportDataItem{
 					StatDate:     statDate,
@@ -111,14 +109,15 @@ func (a *App) QueryExportData() db.QueryResult {
 	}
 
 	// 5. 查询设备清单记录数
-	equipCountResult, err := a.db.QueryRow("SELECT COUNT(distinct credit_code) as count FROM key_equipment_list ")
+	equipCountResult, err := a.GetDB().QueryRow("SELECT COUNT(distinct credit_code) as count FROM key_equipment_list ")
 	if err != nil {
 		result.Ok = false
 		result.Message = "查询设备清单记录数失败: " + err.Error()
 		return result
 	}
 
-	equipCount := int(equipCountResult.Data.(map[string]interface{})["count"].(int64))
+	equipCountRow, _ := equipCountResult.Data.(map[string]interface{})
+	equipCount := int(db.IntValue(equipCountRow["count"]))
 
 	// 6. 查询表2记录数，用stat_date,is_confirm分组
 	table2Query := fmt.Sprintf(`
@@ -134,7 +133,7 @@ func (a *App) QueryExportData() db.QueryResult {
 				GROUP BY stat_date, credit_code
 		) t  group by stat_date
 	`, ENCRYPTED_ONE)
-	table2Result, err := a.db.Query(table2Query)
+	table2Result, err := a.GetDB().Query(table2Query)
 	if err != nil {
 		result.Ok = false
 		result.Message = "查询表2数据失败: " + err.Error()
@@ -152,12 +151,8 @@ func (a *App) QueryExportData() db.QueryResult {
 					statDate = date
 				}
 
-				totalCount := 0
-				if count, ok := row["total_count"].(int64); ok {
-					totalCount = int(count)
-				}
-
-				isConfirmYes := int(row["is_confirm_yes"].(int64))
+				totalCount := int(db.IntValue(row["total_count"]))
+				isConfirmYes := int(db.IntValue(row["is_confirm_yes"]))
 
 				item := &ExportDataItem{
 					StatDate:     statDate,
@@ -247,16 +242,19 @@ func (a *App) copySystemDbWithRecover(fileName string) (*db.Database, string, er
 		}
 	}()
 
-	dbDstPath := GetPath(filepath.Join(DATA_DIR_NAME, DB_FILE_NAME))
 	dbTempPath := GetPath(filepath.Join(DATA_DIR_NAME, fileName+time.Now().Format("20060102150405")))
 
-	copyResult := a.Copyfile(dbDstPath, dbTempPath)
-	if !copyResult.Ok {
-		return nil, "", fmt.Errorf(copyResult.Data)
+	// 系统数据库打开期间磁盘上的加密文件不是最新数据，从当前连接复制
+	if a.GetDB() == nil {
+		return nil, "", fmt.Errorf("数据库未初始化")
+	}
+	// 导出的数据库交给其他单位使用，使用交换文件密码加密
+	if err := a.GetDB().ExportTo(dbTempPath, EXCHANGE_DB_PASSWORD); err != nil {
+		return nil, "", err
 	}
 
 	// 1.创建数据库连接
-	newDb, err := db.NewDatabase(dbTempPath, DB_PASSWORD)
+	newDb, err := db.NewDatabase(dbTempPath, EXCHANGE_DB_PASSWORD)
 	if err != nil {
 		return nil, "", err
 	}
@@ -267,6 +265,20 @@ func (a *App) copySystemDbWithRecover(fileName string) (*db.Database, string, er
 		newDb.Close()
 		return nil, "", err
 	}
+
+	// 3.导出的数据库不能包含本机签名密钥
+	_, err = newDb.Exec("DELETE FROM workstation_key")
+	if err != nil {
+		newDb.Close()
+		return nil, "", err
+	}
+
+	// 4.重建数据库文件，清除已删除数据所在的空闲页，避免被删除的数据残留在导出文件中
+	_, err = newDb.Exec("VACUUM")
+	if err != nil {
+		newDb.Close()
+		return nil, "", err
+	}
 	return newDb, dbTempPath, nil
 }
 
@@ -294,6 +306,23 @@ func (a *App) exportDBDataWithRecover(filePath string) db.QueryResult {
 		return result
 	}
 
+	// 记录导出时间和区域，合并时作为数据来源信息
+	var years []string
+	toSeq, err := getCurrentChangeSeq(newDb)
+	if err == nil {
+		years, err = a.checkSubmissionYears(newDb)
+	}
+	if err == nil {
+		err = a.insertExportInfo(newDb, EXPORT_MODE_FULL, 0, toSeq)
+	}
+	if err != nil {
+		newDb.Close()
+		a.Removefile(dbTempPath)
+		result.Ok = false
+		result.Message = err.Error()
+		return result
+	}
+
 	newDb.Close()
 
 	moveResult := a.Movefile(dbTempPath, filePath)
@@ -304,11 +333,41 @@ func (a *App) exportDBDataWithRecover(filePath string) db.QueryResult {
 		return result
 	}
 
+	if err := a.recordSubmissionWatermark(EXPORT_MODE_FULL, 0, toSeq, filePath); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	if err := a.markYearsSubmitted(years, filePath); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
 	result.Ok = true
 	result.Message = "数据导出成功"
 	return result
 }
 
+// insertExportInfo 在导出的数据库中记录导出时间、区域和导出的变更序号范围
+func (a *App) insertExportInfo(exportDb *db.Database, exportMode string, fromSeq int64, toSeq int64) error {
+	var provinceName, cityName, countryName string
+	areaResult, err := exportDb.QueryRow("SELECT province_name, city_name, country_name FROM area_config LIMIT 1")
+	if err == nil && areaResult.Data != nil {
+		area := areaResult.Data.(map[string]interface{})
+		provinceName = getStringValue(area["province_name"])
+		cityName = getStringValue(area["city_name"])
+		countryName = getStringValue(area["country_name"])
+	}
+
+	_, err = exportDb.Exec(`INSERT INTO data_export_info (
+		obj_id, export_time, province_name, city_name, country_name, create_user, export_mode, from_seq, to_seq
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, uuid.New().String(), time.Now().UnixMilli(), provinceName, cityName, countryName,
+		a.GetCurrentOSUser(), exportMode, fromSeq, toSeq)
+	if err != nil {
+		return fmt.Errorf("记录导出信息失败: %v", err)
+	}
+	return nil
+}
+
 // 获取当前用户区域数据
 // 返回：targetLocation, dataLevel, areaName, error
 func (a *App) getCurrentUserLocationData() (interface{}, int, string, error) {
@@ -461,7 +520,7 @@ func (a *App) processTable3Data(countyCount int, dataLevel int) ([]ExportDataIte
 		GROUP BY examination_authority
 	`, ENCRYPTED_ONE)
 
-	result, err := a.db.Query(query)
+	result, err := a.GetDB().Query(query)
 	if err != nil {
 		return nil, err
 	}
@@ -484,12 +543,8 @@ func (a *App) processTable3Data(countyCount int, dataLevel int) ([]ExportDataIte
 	if result.Ok && result.Data != nil {
 		if data, ok := result.Data.([]map[string]interface{}); ok {
 			for _, row := range data {
-				totalCount := 0
-				if count, ok := row["total_count"].(int64); ok {
-					totalCount = int(count)
-				}
-
-				isConfirmYes := int(row["is_confirm_yes"].(int64))
+				totalCount := int(db.IntValue(row["total_count"]))
+				isConfirmYes := int(db.IntValue(row["is_confirm_yes"]))
 				if isConfirmYes == totalCount && totalCount > 0 {
 					item.IsConfirmYes++
 				}
@@ -523,7 +578,7 @@ func (a *App) processAttachment2Data(countyCount int, dataLevel int) ([]ExportDa
 			) t  GROUP BY stat_date
 	`, ENCRYPTED_ONE)
 
-	result, err := a.db.Query(query)
+	result, err := a.GetDB().Query(query)
 	if err != nil {
 		return nil, err
 	}
@@ -543,12 +598,8 @@ func (a *App) processAttachment2Data(countyCount int, dataLevel int) ([]ExportDa
 					statDate = date
 				}
 
-				totalCount := 0
-				if count, ok := row["total_count"].(int64); ok {
-					totalCount = int(count)
-				}
-
-				isConfirmYes := int(row["is_confirm_yes"].(int64))
+				totalCount := int(db.IntValue(row["total_count"]))
+				isConfirmYes := int(db.IntValue(row["is_confirm_yes"]))
 
 				item := &ExportDataItem{
 					StatDate:     statDate,
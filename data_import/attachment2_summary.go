@@ -0,0 +1,71 @@
+package data_import
+
+import (
+	"fmt"
+	"shuji/db"
+	"strings"
+)
+
+// attachment2SumField 附件2参与上下级汇总校验的数值字段
+type attachment2SumField struct {
+	Field  string // 字段名
+	Label  string // 字段名称
+	RuleID string // 汇总校验规则编号
+}
+
+// attachment2SumFields 附件2参与上下级汇总校验的数值字段，按Excel列顺序
+var attachment2SumFields = []attachment2SumField{
+	{"total_coal", "煤合计", "A2-032"},
+	{"raw_coal", "原煤", "A2-033"},
+	{"washed_coal", "洗精煤", "A2-034"},
+	{"other_coal", "其他", "A2-035"},
+	{"power_generation", "火力发电", "A2-036"},
+	{"heating", "供热", "A2-037"},
+	{"coal_washing", "煤炭洗选", "A2-038"},
+	{"coking", "炼焦", "A2-039"},
+	{"oil_refining", "炼油及煤制油", "A2-040"},
+	{"gas_production", "制气", "A2-041"},
+	{"industry", "工业", "A2-042"},
+	{"raw_materials", "工业（#用作原料、材料）", "A2-043"},
+	{"other_uses", "其他用途", "A2-044"},
+	{"coke", "焦炭", "A2-045"},
+}
+
+// attachment2Totals 附件2各数值字段的合计，key为字段名
+type attachment2Totals map[string]float64
+
+// add 累加一行明文数据
+func (t attachment2Totals) add(s *DataImportService, record map[string]interface{}) {
+	for _, field := range attachment2SumFields {
+		t[field.Field] = s.addFloat64(t[field.Field], s.parseFloat(s.getStringValue(record[field.Field])))
+	}
+}
+
+// queryAttachment2Totals 在SQL中解密并汇总库中附件2数值字段。
+// excluded中年份和地区相同的数据将被本次导入覆盖，不计入合计
+func (s *DataImportService) queryAttachment2Totals(where string, excluded []map[string]interface{}, args ...interface{}) (attachment2Totals, error) {
+	columns := make([]string, 0, len(attachment2SumFields))
+	for _, field := range attachment2SumFields {
+		columns = append(columns, db.DecryptedSum(field.Field, field.Field))
+	}
+
+	conditions := []string{where}
+	for _, record := range excluded {
+		conditions = append(conditions, "NOT (stat_date = ? AND COALESCE(province_name, '') = ? AND COALESCE(city_name, '') = ? AND COALESCE(country_name, '') = ?)")
+		args = append(args, s.getStringValue(record["stat_date"]), s.getStringValue(record["province_name"]),
+			s.getStringValue(record["city_name"]), s.getStringValue(record["country_name"]))
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(columns, ", "), TableCoalConsumptionReport, strings.Join(conditions, " AND "))
+	result, err := s.app.GetDB().QueryRow(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	row, _ := result.Data.(map[string]interface{})
+	totals := make(attachment2Totals, len(attachment2SumFields))
+	for _, field := range attachment2SumFields {
+		totals[field.Field] = db.FloatValue(row[field.Field])
+	}
+	return totals, nil
+}
@@ -0,0 +1,333 @@
+package data_import
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"shuji/db"
+	"slices"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// BatchDuplicateResolutionFileName 批次内重复数据处理结果文件，保存在缓存目录中
+const BatchDuplicateResolutionFileName = "批次重复处理.json"
+
+// BatchDuplicateEntry 重复数据所在的文件及行
+type BatchDuplicateEntry struct {
+	FilePath string            `json:"file_path"` // 缓存文件路径
+	FileName string            `json:"file_name"` // 文件名
+	RowNo    string            `json:"row_no"`    // 序号
+	Children []CoverRecordDiff `json:"children"`  // 子表与第一个文件的差异
+}
+
+// BatchDuplicateField 重复数据中取值不同的字段
+type BatchDuplicateField struct {
+	Field  string   `json:"field"`  // 字段名
+	Label  string   `json:"label"`  // 字段显示名称
+	Values []string `json:"values"` // 按Entries顺序排列的各文件取值
+}
+
+// BatchDuplicateGroup 同一记录标识在多个文件中出现的重复组
+type BatchDuplicateGroup struct {
+	Key     string                `json:"key"`     // 记录标识
+	Section string                `json:"section"` // 所属表格
+	Entries []BatchDuplicateEntry `json:"entries"` // 各文件中的记录
+	Fields  []BatchDuplicateField `json:"fields"`  // 取值不同的字段
+}
+
+// batchChildRows 批次记录的子表数据
+type batchChildRows struct {
+	section coverDiffSection
+	rows    []map[string]interface{}
+}
+
+// batchRecord 批次内单个文件中的一条记录
+type batchRecord struct {
+	filePath string
+	record   map[string]interface{}
+	children []batchChildRows
+}
+
+// parseBatchRecords 解析缓存文件中参与重复检测的记录，附表1、附表2每个文件为一条记录
+func (s *DataImportService) parseBatchRecords(tableType, filePath string) ([]batchRecord, coverDiffSection, error) {
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		return nil, coverDiffSection{}, err
+	}
+	defer f.Close()
+
+	switch tableType {
+	case TableType1:
+		mainData, usageData, equipData, err := s.parseTable1Excel(f, true)
+		if err != nil || len(mainData) == 0 {
+			return nil, table1MainDiffSection, err
+		}
+		return []batchRecord{{
+			filePath: filePath,
+			record:   mainData[0],
+			children: []batchChildRows{{table1UsageDiffSection, usageData}, {table1EquipDiffSection, equipData}},
+		}}, table1MainDiffSection, nil
+	case TableType2:
+		_, mainData, err := s.parseTable2Excel(f, true)
+		if err != nil {
+			return nil, table2UnitDiffSection, err
+		}
+		return []batchRecord{{
+			filePath: filePath,
+			record:   mainData[0],
+			children: []batchChildRows{{table2EquipDiffSection, mainData}},
+		}}, table2UnitDiffSection, nil
+	case TableType3:
+		mainData, err := s.parseTable3Excel(f, true)
+		if err != nil {
+			return nil, table3DiffSection, err
+		}
+		records := []batchRecord{}
+		for _, record := range mainData {
+			records = append(records, batchRecord{filePath: filePath, record: record})
+		}
+		return records, table3DiffSection, nil
+	case TableTypeAttachment2:
+		mainData, err := s.parseAttachment2Excel(f, true)
+		if err != nil {
+			return nil, attachment2DiffSection, err
+		}
+		records := []batchRecord{}
+		for _, record := range mainData {
+			records = append(records, batchRecord{filePath: filePath, record: record})
+		}
+		return records, attachment2DiffSection, nil
+	}
+
+	return nil, coverDiffSection{}, fmt.Errorf("不支持的表格类型")
+}
+
+// detectBatchDuplicates 检测缓存目录中多个文件之间的重复记录，已处理的记录不再提示
+func (s *DataImportService) detectBatchDuplicates(tableType string, exclusions map[string][]string) []BatchDuplicateGroup {
+	cacheDir := s.app.GetCachePath(tableType)
+	files, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return nil
+	}
+
+	var section coverDiffSection
+	var keys []string
+	recordMap := make(map[string][]batchRecord)
+	for _, file := range files {
+		if file.IsDir() || !(strings.HasSuffix(file.Name(), ".xlsx") || strings.HasSuffix(file.Name(), ".xls")) {
+			continue
+		}
+
+		// 读取或解析失败的文件由模型校验统一报告
+		records, fileSection, err := s.parseBatchRecords(tableType, filepath.Join(cacheDir, file.Name()))
+		if err != nil {
+			continue
+		}
+		section = fileSection
+
+		for _, record := range records {
+			key := getCoverRecordKey(tableType, record.record)
+			if strings.Trim(key, coverKeySeparator) == "" || slices.Contains(exclusions[file.Name()], key) {
+				continue
+			}
+			if _, exists := recordMap[key]; !exists {
+				keys = append(keys, key)
+			}
+			recordMap[key] = append(recordMap[key], record)
+		}
+	}
+
+	groups := []BatchDuplicateGroup{}
+	for _, key := range keys {
+		records := recordMap[key]
+
+		// 只统计跨文件的重复，同一文件内的重复由数据校验处理
+		fileSet := make(map[string]bool)
+		for _, record := range records {
+			fileSet[record.filePath] = true
+		}
+		if len(fileSet) < 2 {
+			continue
+		}
+
+		groups = append(groups, s.buildBatchDuplicateGroup(key, section, records))
+	}
+	return groups
+}
+
+// buildBatchDuplicateGroup 生成重复组，逐字段列出各文件取值，子表以第一个文件为基准比较
+func (s *DataImportService) buildBatchDuplicateGroup(key string, section coverDiffSection, records []batchRecord) BatchDuplicateGroup {
+	group := BatchDuplicateGroup{
+		Key:     key,
+		Section: section.Name,
+		Entries: []BatchDuplicateEntry{},
+		Fields:  []BatchDuplicateField{},
+	}
+
+	base := records[0]
+	for _, record := range records {
+		entry := BatchDuplicateEntry{
+			FilePath: record.filePath,
+			FileName: filepath.Base(record.filePath),
+			RowNo:    getCoverValue(record.record, "row_no"),
+			Children: []CoverRecordDiff{},
+		}
+		for i, child := range record.children {
+			entry.Children = append(entry.Children, s.diffCoverRows(child.section, base.children[i].rows, child.rows)...)
+		}
+		group.Entries = append(group.Entries, entry)
+	}
+
+	for _, field := range section.Fields {
+		values := []string{}
+		isDifferent := false
+		for _, record := range records {
+			value := getCoverValue(record.record, field.Field)
+			if !isCoverValueEqual(getCoverValue(base.record, field.Field), value) {
+				isDifferent = true
+			}
+			values = append(values, value)
+		}
+		if isDifferent {
+			group.Fields = append(group.Fields, BatchDuplicateField{Field: field.Field, Label: field.Label, Values: values})
+		}
+	}
+
+	return group
+}
+
+// loadBatchDuplicateResolution 读取批次内重复数据的处理结果，返回文件名到排除记录标识的映射
+func (s *DataImportService) loadBatchDuplicateResolution(tableType string) map[string][]string {
+	exclusions := make(map[string][]string)
+	data, err := os.ReadFile(filepath.Join(s.app.GetCachePath(tableType), BatchDuplicateResolutionFileName))
+	if err != nil {
+		return exclusions
+	}
+	if err := json.Unmarshal(data, &exclusions); err != nil {
+		log.Printf("读取批次重复处理结果失败: %v", err)
+	}
+	return exclusions
+}
+
+// saveBatchDuplicateResolution 保存批次内重复数据的处理结果
+func (s *DataImportService) saveBatchDuplicateResolution(tableType string, exclusions map[string][]string) error {
+	data, err := json.MarshalIndent(exclusions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.app.GetCachePath(tableType), BatchDuplicateResolutionFileName), data, 0644)
+}
+
+// clearBatchDuplicateResolution 模型校验完成后清除处理结果
+func (s *DataImportService) clearBatchDuplicateResolution(tableType string) {
+	os.Remove(filepath.Join(s.app.GetCachePath(tableType), BatchDuplicateResolutionFileName))
+}
+
+// checkBatchDuplicates 模型校验入库前检测批次内重复数据，存在未处理的重复时返回需要用户选择的结果
+func (s *DataImportService) checkBatchDuplicates(tableType string, exclusions map[string][]string) (db.QueryResult, bool) {
+	groups := s.detectBatchDuplicates(tableType, exclusions)
+	if len(groups) == 0 {
+		return db.QueryResult{}, false
+	}
+
+	var messages []string
+	for _, group := range groups {
+		var fileNames []string
+		for _, entry := range group.Entries {
+			fileNames = append(fileNames, entry.FileName)
+		}
+		messages = append(messages, fmt.Sprintf("%s 同时出现在文件 %s 中", strings.ReplaceAll(group.Key, coverKeySeparator, "、"), strings.Join(fileNames, "、")))
+	}
+
+	return db.QueryResult{
+		Ok:      false,
+		Message: fmt.Sprintf("检测到%d组批次内重复数据，请选择保留的文件后重新校验：\n\n%s", len(groups), strings.Join(messages, ";\n\n")),
+		Data: map[string]interface{}{
+			"batch_duplicates": groups, // 批次内重复数据
+		},
+	}, true
+}
+
+// GetBatchDuplicates 获取缓存目录中待处理的批次内重复数据
+func (s *DataImportService) GetBatchDuplicates(tableType string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return s.getBatchDuplicatesWithRecover(tableType)
+}
+
+// getBatchDuplicatesWithRecover 带异常处理的获取批次内重复数据函数
+func (s *DataImportService) getBatchDuplicatesWithRecover(tableType string) (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("GetBatchDuplicates 发生异常: %v", r)
+			result = db.QueryResult{
+				Ok:      false,
+				Message: fmt.Sprintf("函数执行异常: %v", r),
+			}
+		}
+	}()
+
+	return db.QueryResult{
+		Ok:      true,
+		Message: "查询成功",
+		Data:    s.detectBatchDuplicates(tableType, s.loadBatchDuplicateResolution(tableType)),
+	}
+}
+
+// ResolveBatchDuplicates 保存用户选择的保留文件，winners为记录标识到保留文件路径的映射，其余文件中的该记录不导入
+func (s *DataImportService) ResolveBatchDuplicates(tableType string, winners map[string]string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return s.resolveBatchDuplicatesWithRecover(tableType, winners)
+}
+
+// resolveBatchDuplicatesWithRecover 带异常处理的保存批次内重复数据处理结果函数
+func (s *DataImportService) resolveBatchDuplicatesWithRecover(tableType string, winners map[string]string) (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ResolveBatchDuplicates 发生异常: %v", r)
+			result = db.QueryResult{
+				Ok:      false,
+				Message: fmt.Sprintf("函数执行异常: %v", r),
+			}
+		}
+	}()
+
+	exclusions := s.loadBatchDuplicateResolution(tableType)
+	groups := s.detectBatchDuplicates(tableType, exclusions)
+
+	resolved := 0
+	for _, group := range groups {
+		winner, exists := winners[group.Key]
+		if !exists {
+			continue
+		}
+
+		isMember := slices.ContainsFunc(group.Entries, func(entry BatchDuplicateEntry) bool {
+			return entry.FilePath == winner
+		})
+		if !isMember {
+			return db.QueryResult{Ok: false, Message: fmt.Sprintf("保留文件 %s 不包含记录 %s", filepath.Base(winner), group.Key)}
+		}
+
+		for _, entry := range group.Entries {
+			if entry.FilePath != winner && !slices.Contains(exclusions[entry.FileName], group.Key) {
+				exclusions[entry.FileName] = append(exclusions[entry.FileName], group.Key)
+			}
+		}
+		resolved++
+	}
+
+	if err := s.saveBatchDuplicateResolution(tableType, exclusions); err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("保存处理结果失败: %v", err)}
+	}
+
+	return db.QueryResult{
+		Ok:      true,
+		Message: fmt.Sprintf("已处理%d组重复数据，剩余%d组待处理", resolved, len(groups)-resolved),
+	}
+}
@@ -27,6 +27,7 @@ const (
 var (
 	EncryptedZero = "" // 加密后的"0"
 	EncryptedOne  = "" // 加密后的"1"
+	EncryptedTwo  = "" // 加密后的"2"
 )
 
 // initEncryptedConstants 初始化加密常量（包级别初始化）
@@ -40,6 +41,11 @@ func initEncryptedConstants(app App) {
 		encryptedOne, _ := app.SM4Encrypt("1")
 		EncryptedOne = encryptedOne
 	}
+
+	if EncryptedTwo == "" {
+		encryptedTwo, _ := app.SM4Encrypt("2")
+		EncryptedTwo = encryptedTwo
+	}
 }
 
 // getDecryptedStatus 获取解密后的状态值
@@ -58,11 +64,79 @@ func (s *DataImportService) getDecryptedStatus(encryptedValue interface{}) strin
 	return ""
 }
 
+// 校验结果级别
+const (
+	SeverityError   = "error"   // 错误，阻止导入
+	SeverityWarning = "warning" // 警告，确认后允许导入
+	SeverityInfo    = "info"    // 提示，不影响导入
+)
+
 // ValidationError 验证错误结构
 type ValidationError struct {
 	RowNumber int      `json:"row_number"` // 错误行号
 	Message   string   `json:"message"`    // 错误信息
 	Cells     []string `json:"cells"`      // 涉及到的单元格位置，如["A1", "B1", "C1"]
+	Severity  string   `json:"severity"`   // 级别：error/warning/info，为空时按error处理
+	RuleID    string   `json:"rule_id"`    // 校验规则编号，如"T1-001"
+}
+
+// IsBlocking 是否为阻止导入的错误
+func (e ValidationError) IsBlocking() bool {
+	return e.Severity == "" || e.Severity == SeverityError
+}
+
+// hasBlockingErrors 校验结果中是否包含阻止导入的错误
+func hasBlockingErrors(errors []ValidationError) bool {
+	for _, err := range errors {
+		if err.IsBlocking() {
+			return true
+		}
+	}
+	return false
+}
+
+// getSeverityLabel 获取级别的中文名称
+func getSeverityLabel(severity string) string {
+	switch severity {
+	case SeverityWarning:
+		return "警告"
+	case SeverityInfo:
+		return "提示"
+	default:
+		return "错误"
+	}
+}
+
+// getSeverityRank 获取级别的严重程度，数值越大越严重
+func getSeverityRank(severity string) int {
+	switch severity {
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// getSeverityColor 获取级别对应的高亮颜色：错误为黄色，警告为橙色，提示为浅蓝色
+func getSeverityColor(severity string) string {
+	switch severity {
+	case SeverityWarning:
+		return "FFC000"
+	case SeverityInfo:
+		return "BDD7EE"
+	default:
+		return "FFFF00"
+	}
+}
+
+// formatValidationMessage 格式化单条校验信息，非错误级别添加级别前缀
+func formatValidationMessage(err ValidationError) string {
+	if err.IsBlocking() {
+		return err.Message
+	}
+	return fmt.Sprintf("【%s】%s", getSeverityLabel(err.Severity), err.Message)
 }
 
 const (
@@ -72,6 +146,9 @@ const (
 	TableTypeAttachment2 = "attachment2"
 )
 
+// SnapshotReasonCover 覆盖数据前创建快照的原因
+const SnapshotReasonCover = "cover"
+
 // App 应用接口，用于访问数据库和其他功能
 type App interface {
 	GetDB() *db.Database
@@ -79,6 +156,7 @@ type App interface {
 	GetAreaStr() string
 	GetEnhancedAreaConfig() db.QueryResult
 	InsertImportRecord(fileName, fileType, importState, describe string)
+	InsertImportRecordWithHash(fileName, fileType, importState, describe, fileHash string)
 	IsEnterpriseListExist() (bool, error)
 	GetEnterpriseInfoByCreditCode(creditCode string) db.QueryResult
 	CacheFileExists(tableType string, fileName string) db.QueryResult
@@ -88,9 +166,11 @@ type App interface {
 	SM4Encrypt(plaintext string) (string, error)
 	SM4Decrypt(ciphertext string) (string, error)
 	GetCachePath(tableType string) string
+	GetArchivePath() string
 	GetCurrentOSUser() string
 	GetCtx() context.Context
 	GetDBPassword() string
+	CreateSnapshot(reason string) db.QueryResult
 }
 
 // DataImportService 数据导入服务
@@ -238,20 +318,21 @@ func (s *DataImportService) validateEnterpriseAndCreditCode(data map[string]inte
 			}
 
 			if provinceName != "" && cityName != "" && countryName != "" {
-				enterpriseInfo := result.Data.(map[string]interface{})
-				dbUnitName := enterpriseInfo["unit_name"].(string)
-				dbProvinceName := enterpriseInfo["province_name"].(string)
-				dbCityName := enterpriseInfo["city_name"].(string)
-				dbCountryName := enterpriseInfo["country_name"].(string)
+				row, _ := result.Data.(map[string]interface{})
+				enterpriseInfo, err := db.DecodeModel[db.EnterpriseList](row, nil)
+				if err != nil {
+					errors = append(errors, fmt.Sprintf("第%d行：清单数据格式错误: %v", unitRowNum, err))
+					return errors
+				}
 
 				// 如果查询到企业名了，比较企业名称是否相同
-				if dbUnitName != unitName {
+				if enterpriseInfo.UnitName != unitName {
 					errors = append(errors, fmt.Sprintf("第%d行：统一信用代码%s和导入的企业名称不对应", unitRowNum, creditCode))
 					return errors
 				}
 
 				// 如果查询到企业名了，比较省市县是否相同
-				errors = s.checkRegionMatch(provinceName, cityName, countryName, dbProvinceName, dbCityName, dbCountryName, regionRowNum)
+				errors = s.checkRegionMatch(provinceName, cityName, countryName, enterpriseInfo.ProvinceName, enterpriseInfo.CityName, enterpriseInfo.CountryName, regionRowNum)
 			}
 
 		} else if provinceName != "" && cityName != "" && countryName != "" {
@@ -291,20 +372,21 @@ func (s *DataImportService) validateEquipmentAndCreditCode(data map[string]inter
 			}
 
 			if provinceName != "" && cityName != "" && countryName != "" {
-				equipmentInfo := result.Data.(map[string]interface{})
-				dbUnitName := equipmentInfo["unit_name"].(string)
-				dbProvinceName := equipmentInfo["province_name"].(string)
-				dbCityName := equipmentInfo["city_name"].(string)
-				dbCountryName := equipmentInfo["country_name"].(string)
+				row, _ := result.Data.(map[string]interface{})
+				equipmentInfo, err := db.DecodeModel[db.KeyEquipmentList](row, nil)
+				if err != nil {
+					errors = append(errors, fmt.Sprintf("第%d行：清单数据格式错误: %v", unitRowNum, err))
+					return errors
+				}
 
 				// 如果查询到企业名了，比较企业名称是否相同
-				if dbUnitName != unitName {
+				if equipmentInfo.UnitName != unitName {
 					errors = append(errors, fmt.Sprintf("第%d行：统一信用代码%s和导入的企业名称不对应", unitRowNum, creditCode))
 					return errors
 				}
 
 				// 如果查询到企业名了，比较省市县是否相同
-				errors = s.checkRegionMatch(provinceName, cityName, countryName, dbProvinceName, dbCityName, dbCountryName, regionRowNum)
+				errors = s.checkRegionMatch(provinceName, cityName, countryName, equipmentInfo.ProvinceName, equipmentInfo.CityName, equipmentInfo.CountryName, regionRowNum)
 			}
 
 		} else if provinceName != "" && cityName != "" && countryName != "" {
@@ -404,7 +486,6 @@ var (
 		"province_name":                  "单位所在省/市/区",
 		"city_name":                      "单位所在地市",
 		"country_name":                   "单位所在区县",
-		"tel":                            "联系电话",
 		"annual_energy_equivalent_value": "年综合能耗当量值（万吨标准煤，含原料用能）",
 		"annual_energy_equivalent_cost":  "年综合能耗等价值（万吨标准煤，含原料用能）",
 	}
@@ -443,6 +524,9 @@ func (s *DataImportService) generateUUID() string {
 	return uuid.New().String()
 }
 
+// 导入数据时每批写入的行数
+const importBatchSize = 200
+
 // parseFloat 解析浮点数
 func (s *DataImportService) parseFloat(value string) float64 {
 	if value == "" {
@@ -529,6 +613,18 @@ func (s *DataImportService) multiplyFloat64(a, b float64) float64 {
 	return float64(result) / 1000000 // 除以1000000是因为两个数都乘以了1000
 }
 
+// isYearOverYearJump 本年数值与上年相比变化是否超过50%，上年数值不大于0时不判断
+func (s *DataImportService) isYearOverYearJump(current, lastYear float64) bool {
+	if !s.isIntegerGreaterThan(lastYear, 0) {
+		return false
+	}
+	change := s.subtractFloat64(current, lastYear)
+	if change < 0 {
+		change = -change
+	}
+	return s.isIntegerGreaterThan(change, s.multiplyFloat64(lastYear, 0.5))
+}
+
 // divideFloat64 精度安全的浮点数除法
 func (s *DataImportService) divideFloat64(a, b float64) float64 {
 	if b == 0 {
@@ -572,8 +668,13 @@ func (s *DataImportService) GetCellValueByRows(rows [][]string, rowIndex int, ce
 
 // getExcelRowNumber 获取记录中的Excel行号
 func (s *DataImportService) getExcelRowNumber(data map[string]interface{}) int {
+	return s.getExcelRowNumberByKey(data, "_excel_row")
+}
+
+// getExcelRowNumberByKey 获取记录中指定行号字段的Excel行号，附表1主表的数值字段行号为_excel_row2
+func (s *DataImportService) getExcelRowNumberByKey(data map[string]interface{}, rowKey string) int {
 	// 尝试获取记录的行号
-	if rowNum, ok := data["_excel_row"].(int); ok {
+	if rowNum, ok := data[rowKey].(int); ok {
 		return rowNum
 	}
 
@@ -595,8 +696,8 @@ func (s *DataImportService) getTableName(tableType string) string {
 	return ""
 }
 
-// createValidationErrorZip 创建验证错误文件的ZIP包
-func (s *DataImportService) createValidationErrorZip(failedFiles []string, tableType, tableName string) error {
+// createValidationErrorZip 创建验证错误文件的ZIP包，同时写入结构化的JSON、CSV校验结果
+func (s *DataImportService) createValidationErrorZip(failedFiles []string, tableType, tableName string, entries []ValidationReportEntry) error {
 	if len(failedFiles) == 0 {
 		return nil
 	}
@@ -638,26 +739,43 @@ func (s *DataImportService) createValidationErrorZip(failedFiles []string, table
 			continue
 		}
 	}
-	return nil
-}
 
-// encryptNumericFields 通用数值字段加密函数
-func (s *DataImportService) encryptNumericFields(record map[string]interface{}, numericFields []string) map[string]interface{} {
-	encrypted := make(map[string]interface{})
+	// 添加总索引文件，列出每个文件的错误、警告、提示数量
+	var summaries []validationFileSummary
+	for _, filePath := range failedFiles {
+		summaries = append(summaries, readValidationFileSummary(filePath, filepath.Base(filePath)))
+	}
+	indexFile, err := s.createValidationIndexWorkbook(summaries)
+	if err != nil {
+		return fmt.Errorf("创建校验报告索引失败: %v", err)
+	}
+	defer indexFile.Close()
 
-	for _, field := range numericFields {
-		if value, ok := record[field].(string); ok && value != "" {
-			if encryptedValue, err := s.app.SM4Encrypt(value); err == nil {
-				encrypted[field] = encryptedValue
-			} else {
-				encrypted[field] = ""
-			}
-		} else {
-			encrypted[field] = ""
-		}
+	indexEntry, err := zipWriter.Create(ValidationIndexFileName)
+	if err != nil {
+		return fmt.Errorf("创建校验报告索引失败: %v", err)
+	}
+	if _, err := indexFile.WriteTo(indexEntry); err != nil {
+		return fmt.Errorf("写入校验报告索引失败: %v", err)
 	}
 
-	return encrypted
+	// 添加结构化校验结果，便于外部工具统计和比对
+	report := s.newValidationReport(tableType, entries)
+	jsonEntry, err := zipWriter.Create(ValidationReportJSONFileName)
+	if err != nil {
+		return fmt.Errorf("创建JSON校验结果失败: %v", err)
+	}
+	if err := writeValidationReportJSON(jsonEntry, report); err != nil {
+		return fmt.Errorf("写入JSON校验结果失败: %v", err)
+	}
+	csvEntry, err := zipWriter.Create(ValidationReportCSVFileName)
+	if err != nil {
+		return fmt.Errorf("创建CSV校验结果失败: %v", err)
+	}
+	if err := writeValidationReportCSV(csvEntry, report.Entries); err != nil {
+		return fmt.Errorf("写入CSV校验结果失败: %v", err)
+	}
+	return nil
 }
 
 // formatErrorMessages 格式化错误信息，每条错误使用序号标识并换行
@@ -710,6 +828,8 @@ func (s *DataImportService) getTable1FieldMapping() map[string]ExcelFieldMapping
 		"output_quantity": {TableType: "table1", FieldName: "output_quantity", Column: "I", RowOffset: 0},
 
 		// 设备表字段映射
+		"equip_type":              {TableType: "table1", FieldName: "equip_type", Column: "B", RowOffset: 0},
+		"equip_no":                {TableType: "table1", FieldName: "equip_no", Column: "C", RowOffset: 0},
 		"total_runtime":           {TableType: "table1", FieldName: "total_runtime", Column: "D", RowOffset: 0},
 		"design_life":             {TableType: "table1", FieldName: "design_life", Column: "E", RowOffset: 0},
 		"energy_efficiency":       {TableType: "table1", FieldName: "energy_efficiency", Column: "F", RowOffset: 0},
@@ -721,6 +841,8 @@ func (s *DataImportService) getTable1FieldMapping() map[string]ExcelFieldMapping
 // getTable2FieldMapping 获取附表2字段映射
 func (s *DataImportService) getTable2FieldMapping() map[string]ExcelFieldMapping {
 	return map[string]ExcelFieldMapping{
+		"coal_type":               {TableType: "table2", FieldName: "coal_type", Column: "B", RowOffset: 0},
+		"coal_no":                 {TableType: "table2", FieldName: "coal_no", Column: "C", RowOffset: 0},
 		"usage_time":              {TableType: "table2", FieldName: "usage_time", Column: "D", RowOffset: 0},
 		"design_life":             {TableType: "table2", FieldName: "design_life", Column: "E", RowOffset: 0},
 		"capacity":                {TableType: "table2", FieldName: "capacity", Column: "H", RowOffset: 0},
@@ -794,11 +916,11 @@ func (s *DataImportService) getCellPosition(tableType, fieldName string, rowNumb
 	return ""
 }
 
-// highlightCellsInExcel 在Excel中高亮指定的单元格
-func (s *DataImportService) highlightCellsInExcel(f *excelize.File, sheetName string, cells []string) error {
-	// 创建黄色背景样式
+// highlightCellsInExcel 在Excel中按级别颜色高亮指定的单元格
+func (s *DataImportService) highlightCellsInExcel(f *excelize.File, sheetName string, cells []string, severity string) error {
+	// 创建对应级别颜色的背景样式
 	style, err := f.NewStyle(&excelize.Style{
-		Fill: excelize.Fill{Type: "pattern", Color: []string{"FFFF00"}, Pattern: 1},
+		Fill: excelize.Fill{Type: "pattern", Color: []string{getSeverityColor(severity)}, Pattern: 1},
 		Alignment: &excelize.Alignment{
 			Vertical: "center",
 		},
@@ -823,6 +945,30 @@ func (s *DataImportService) highlightCellsInExcel(f *excelize.File, sheetName st
 	return nil
 }
 
+// highlightValidationCells 按级别高亮校验结果涉及的单元格，同一单元格以最严重的级别颜色为准
+func (s *DataImportService) highlightValidationCells(f *excelize.File, sheetName string, errors []ValidationError) error {
+	cellsBySeverity := make(map[string][]string)
+	for _, err := range errors {
+		severity := err.Severity
+		if severity == "" {
+			severity = SeverityError
+		}
+		cellsBySeverity[severity] = append(cellsBySeverity[severity], err.Cells...)
+	}
+
+	// 先低后高依次高亮，后设置的样式覆盖先设置的
+	for _, severity := range []string{SeverityInfo, SeverityWarning, SeverityError} {
+		if len(cellsBySeverity[severity]) == 0 {
+			continue
+		}
+		if err := s.highlightCellsInExcel(f, sheetName, cellsBySeverity[severity], severity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // UnprotecFile 解除Excel文件的保护并保存
 func (s *DataImportService) UnprotecFile(filePath string) error {
 	// 打开Excel文件
@@ -838,10 +984,12 @@ func (s *DataImportService) UnprotecFile(filePath string) error {
 		// 首先尝试使用空密码解除工作表保护
 		err := f.UnprotectSheet(sheetName)
 		if err != nil {
-			// 如果空密码失败，尝试使用"shuji"密码
-			_ = f.UnprotectSheet(sheetName, "shuji")
+			// 如果空密码失败，尝试使用模板保护密码
+			_ = f.UnprotectSheet(sheetName, TemplateProtectPassword)
 		}
 	}
+	// 个性化模板还保护了工作簿结构，解除后才能添加校验结果汇总表
+	_ = f.UnprotectWorkbook(TemplateProtectPassword)
 
 	// 保存修改后的文件
 	if err := f.Save(); err != nil {
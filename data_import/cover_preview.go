@@ -0,0 +1,581 @@
+package data_import
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"shuji/db"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// 覆盖预览差异状态
+const (
+	CoverDiffAdded     = "added"     // 新增
+	CoverDiffRemoved   = "removed"   // 删除
+	CoverDiffChanged   = "changed"   // 修改
+	CoverDiffUnchanged = "unchanged" // 未变化
+)
+
+// coverKeySeparator 覆盖记录标识的分隔符
+const coverKeySeparator = "|"
+
+// CoverFieldDiff 字段差异
+type CoverFieldDiff struct {
+	Field    string `json:"field"`     // 字段名
+	Label    string `json:"label"`     // 字段显示名称
+	Status   string `json:"status"`    // 差异状态
+	OldValue string `json:"old_value"` // 库中现有值（已解密）
+	NewValue string `json:"new_value"` // 文件中的新值
+}
+
+// CoverRecordDiff 记录差异
+type CoverRecordDiff struct {
+	Key      string            `json:"key"`      // 记录标识，确认覆盖时用于排除记录
+	Section  string            `json:"section"`  // 所属表格
+	Status   string            `json:"status"`   // 差异状态
+	RowNo    string            `json:"row_no"`   // 序号
+	Fields   []CoverFieldDiff  `json:"fields"`   // 有差异的字段
+	Children []CoverRecordDiff `json:"children"` // 子表记录差异
+}
+
+// CoverFilePreview 单个文件的覆盖预览
+type CoverFilePreview struct {
+	FilePath  string            `json:"file_path"` // 缓存文件路径
+	FileName  string            `json:"file_name"` // 文件名
+	Records   []CoverRecordDiff `json:"records"`   // 记录差异
+	Added     int               `json:"added"`     // 新增记录数（含子表）
+	Removed   int               `json:"removed"`   // 删除记录数（含子表）
+	Changed   int               `json:"changed"`   // 修改记录数（含子表）
+	Unchanged int               `json:"unchanged"` // 未变化记录数（含子表）
+	Message   string            `json:"message"`   // 读取或解析失败时的原因
+}
+
+// coverDiffField 参与比对的字段
+type coverDiffField struct {
+	Field string
+	Label string
+}
+
+// coverDiffSection 参与比对的表格定义
+type coverDiffSection struct {
+	Name            string           // 表格显示名称
+	KeyFields       []string         // 行匹配字段，全部为空时按序号匹配
+	Fields          []coverDiffField // 比对字段
+	EncryptedFields []string         // 库中加密存储的字段
+}
+
+var (
+	// 附表1主表比对定义
+	table1MainDiffSection = coverDiffSection{
+		Name:      "单位基本信息",
+		KeyFields: []string{"credit_code", "stat_date"},
+		Fields: []coverDiffField{
+			{"unit_name", "单位名称"}, {"tel", "联系电话"},
+			{"trade_a", "行业门类"}, {"trade_b", "行业大类"}, {"trade_c", "行业中类"},
+			{"province_name", "单位所在省/市/区"}, {"city_name", "单位所在地市"}, {"country_name", "单位所在区县"},
+			{"annual_energy_equivalent_value", "年综合能耗当量值"}, {"annual_energy_equivalent_cost", "年综合能耗等价值"},
+			{"annual_raw_material_energy", "年原料用能消费量"}, {"annual_total_coal_consumption", "耗煤总量（实物量）"},
+			{"annual_total_coal_products", "耗煤总量（标准量）"}, {"annual_raw_coal", "原料用煤"},
+			{"annual_raw_coal_consumption", "原煤消费"}, {"annual_clean_coal_consumption", "洗精煤消费"},
+			{"annual_other_coal_consumption", "其他煤炭消费"}, {"annual_coke_consumption", "焦炭消费"},
+		},
+		EncryptedFields: []string{
+			"annual_energy_equivalent_value", "annual_energy_equivalent_cost", "annual_raw_material_energy",
+			"annual_total_coal_consumption", "annual_total_coal_products", "annual_raw_coal",
+			"annual_raw_coal_consumption", "annual_clean_coal_consumption", "annual_other_coal_consumption",
+			"annual_coke_consumption",
+		},
+	}
+
+	// 附表1煤炭消费主要用途比对定义
+	table1UsageDiffSection = coverDiffSection{
+		Name:      "煤炭消费主要用途情况",
+		KeyFields: []string{"main_usage", "specific_usage", "input_variety"},
+		Fields: []coverDiffField{
+			{"main_usage", "主要用途"}, {"specific_usage", "具体用途"}, {"input_variety", "投入品种"},
+			{"input_unit", "投入计量单位"}, {"input_quantity", "投入量"}, {"output_energy_types", "产出品种品类"},
+			{"measurement_unit", "产出计量单位"}, {"output_quantity", "产出量"}, {"remarks", "备注"},
+		},
+		EncryptedFields: []string{"input_quantity", "output_quantity"},
+	}
+
+	// 附表1重点耗煤装置比对定义
+	table1EquipDiffSection = coverDiffSection{
+		Name:      "重点耗煤装置情况",
+		KeyFields: []string{"equip_type", "equip_no"},
+		Fields: []coverDiffField{
+			{"equip_type", "类型"}, {"equip_no", "编号"}, {"total_runtime", "累计使用时间"},
+			{"design_life", "设计年限"}, {"energy_efficiency", "能效水平"}, {"capacity_unit", "容量单位"},
+			{"capacity", "容量"}, {"coal_type", "耗煤品种"}, {"annual_coal_consumption", "年耗煤量"},
+		},
+		EncryptedFields: []string{"total_runtime", "design_life", "energy_efficiency", "capacity", "annual_coal_consumption"},
+	}
+
+	// 附表2单位信息比对定义
+	table2UnitDiffSection = coverDiffSection{
+		Name:      "单位基本信息",
+		KeyFields: []string{"credit_code", "stat_date"},
+		Fields: []coverDiffField{
+			{"unit_name", "单位名称"}, {"trade_a", "行业门类"}, {"trade_b", "行业大类"}, {"trade_c", "行业中类"},
+			{"province_name", "单位所在省"}, {"city_name", "单位所在市"}, {"country_name", "单位所在县"},
+		},
+	}
+
+	// 附表2重点耗煤装置比对定义
+	table2EquipDiffSection = coverDiffSection{
+		Name:      "重点耗煤装置",
+		KeyFields: []string{"coal_type", "coal_no"},
+		Fields: []coverDiffField{
+			{"coal_type", "类型"}, {"coal_no", "编号"}, {"usage_time", "累计使用时间"},
+			{"design_life", "设计年限"}, {"enecrgy_efficienct_bmk", "能效水平"}, {"capacity_unit", "容量单位"},
+			{"capacity", "容量"}, {"use_info", "用途"}, {"status", "状态"}, {"annual_coal_consumption", "年耗煤量"},
+		},
+		EncryptedFields: []string{"annual_coal_consumption", "design_life", "capacity"},
+	}
+
+	// 附表3比对定义
+	table3DiffSection = coverDiffSection{
+		Name:      "固定资产投资项目",
+		KeyFields: []string{"project_code", "document_number"},
+		Fields: []coverDiffField{
+			{"stat_date", "数据年份"}, {"project_name", "项目名称"}, {"construction_unit", "建设单位"},
+			{"main_construction_content", "主要建设内容"}, {"province_name", "项目所在省"}, {"city_name", "项目所在市"},
+			{"country_name", "项目所在县"}, {"trade_a", "所属行业大类"}, {"trade_c", "所属行业小类"},
+			{"examination_approval_time", "节能审查批复时间"}, {"scheduled_time", "拟投产时间"}, {"actual_time", "实际投产时间"},
+			{"examination_authority", "节能审查机关"}, {"equivalent_value", "当量值"}, {"equivalent_cost", "等价值"},
+			{"pq_total_coal_consumption", "煤品消费总量（实物量）"}, {"pq_coal_consumption", "煤炭消费量（实物量）"},
+			{"pq_coke_consumption", "焦炭消费量（实物量）"}, {"pq_blue_coke_consumption", "兰炭消费量（实物量）"},
+			{"sce_total_coal_consumption", "煤品消费总量（折标量）"}, {"sce_coal_consumption", "煤炭消费量（折标量）"},
+			{"sce_coke_consumption", "焦炭消费量（折标量）"}, {"sce_blue_coke_consumption", "兰炭消费量（折标量）"},
+			{"is_substitution", "是否煤炭消费替代"}, {"substitution_source", "煤炭消费替代来源"},
+			{"substitution_quantity", "煤炭消费替代量"}, {"pq_annual_coal_quantity", "年原料用煤量（实物量）"},
+			{"sce_annual_coal_quantity", "年原料用煤量（折标量）"},
+		},
+		EncryptedFields: []string{
+			"equivalent_value", "equivalent_cost", "pq_total_coal_consumption", "pq_coal_consumption",
+			"pq_coke_consumption", "pq_blue_coke_consumption", "sce_total_coal_consumption", "sce_coal_consumption",
+			"sce_coke_consumption", "sce_blue_coke_consumption", "substitution_quantity",
+			"pq_annual_coal_quantity", "sce_annual_coal_quantity",
+		},
+	}
+
+	// 附件2比对定义
+	attachment2DiffSection = coverDiffSection{
+		Name:      "煤炭消费状况",
+		KeyFields: []string{"stat_date", "province_name", "city_name", "country_name"},
+		Fields: []coverDiffField{
+			{"total_coal", "煤炭消费总量"}, {"raw_coal", "原煤"}, {"washed_coal", "洗精煤"}, {"other_coal", "其他煤炭"},
+			{"power_generation", "火力发电"}, {"heating", "供热"}, {"coal_washing", "煤炭洗选"}, {"coking", "炼焦"},
+			{"oil_refining", "炼油及煤制油"}, {"gas_production", "制气"}, {"industry", "工业"},
+			{"raw_materials", "用作原材料"}, {"other_uses", "其他用途"}, {"coke", "焦炭"},
+		},
+		EncryptedFields: []string{
+			"total_coal", "raw_coal", "washed_coal", "other_coal", "power_generation", "heating", "coal_washing",
+			"coking", "oil_refining", "gas_production", "industry", "raw_materials", "other_uses", "coke",
+		},
+	}
+)
+
+// getCoverRecordKey 获取覆盖记录标识，附表1、附表2以单位+年份为一条记录
+func getCoverRecordKey(tableType string, record map[string]interface{}) string {
+	var keyFields []string
+	switch tableType {
+	case TableType1, TableType2:
+		keyFields = []string{"credit_code", "stat_date"}
+	case TableType3:
+		keyFields = table3DiffSection.KeyFields
+	case TableTypeAttachment2:
+		keyFields = attachment2DiffSection.KeyFields
+	}
+	return getCoverRowKey(record, keyFields)
+}
+
+// getCoverRowKey 根据字段拼接行标识
+func getCoverRowKey(record map[string]interface{}, keyFields []string) string {
+	values := make([]string, 0, len(keyFields))
+	for _, field := range keyFields {
+		values = append(values, strings.TrimSpace(getCoverValue(record, field)))
+	}
+	return strings.Join(values, coverKeySeparator)
+}
+
+// getCoverValue 获取字段的字符串值
+func getCoverValue(record map[string]interface{}, field string) string {
+	if record == nil || record[field] == nil {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprintf("%v", record[field]))
+}
+
+// isCoverValueEqual 比较新旧值，数值按数值比较，避免格式差异产生误报
+func isCoverValueEqual(oldValue, newValue string) bool {
+	if oldValue == newValue {
+		return true
+	}
+	oldNumber, oldErr := strconv.ParseFloat(oldValue, 64)
+	newNumber, newErr := strconv.ParseFloat(newValue, 64)
+	return oldErr == nil && newErr == nil && oldNumber == newNumber
+}
+
+// filterCoverRecords 排除用户未确认覆盖的记录
+func filterCoverRecords(tableType string, records []map[string]interface{}, excludedKeys []string) []map[string]interface{} {
+	if len(excludedKeys) == 0 {
+		return records
+	}
+
+	filtered := []map[string]interface{}{}
+	for _, record := range records {
+		if !slices.Contains(excludedKeys, getCoverRecordKey(tableType, record)) {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+// decryptCoverRecord 解密库中记录的加密字段
+func (s *DataImportService) decryptCoverRecord(record map[string]interface{}, section coverDiffSection) map[string]interface{} {
+	if record == nil {
+		return nil
+	}
+
+	decrypted := make(map[string]interface{}, len(record))
+	for key, value := range record {
+		decrypted[key] = value
+	}
+	for _, field := range section.EncryptedFields {
+		decrypted[field] = s.decryptValue(record[field])
+	}
+	return decrypted
+}
+
+// diffCoverRecord 比较单条记录，oldRecord为空表示新增，newRecord为空表示删除
+func (s *DataImportService) diffCoverRecord(key string, section coverDiffSection, oldRecord, newRecord map[string]interface{}) CoverRecordDiff {
+	diff := CoverRecordDiff{
+		Key:      key,
+		Section:  section.Name,
+		Fields:   []CoverFieldDiff{},
+		Children: []CoverRecordDiff{},
+	}
+
+	switch {
+	case oldRecord == nil:
+		diff.Status = CoverDiffAdded
+		diff.RowNo = getCoverValue(newRecord, "row_no")
+	case newRecord == nil:
+		diff.Status = CoverDiffRemoved
+		diff.RowNo = getCoverValue(oldRecord, "row_no")
+	default:
+		diff.Status = CoverDiffUnchanged
+		diff.RowNo = getCoverValue(newRecord, "row_no")
+	}
+
+	for _, field := range section.Fields {
+		oldValue := getCoverValue(oldRecord, field.Field)
+		newValue := getCoverValue(newRecord, field.Field)
+		if isCoverValueEqual(oldValue, newValue) {
+			continue
+		}
+
+		fieldStatus := CoverDiffChanged
+		if oldValue == "" {
+			fieldStatus = CoverDiffAdded
+		} else if newValue == "" {
+			fieldStatus = CoverDiffRemoved
+		}
+		diff.Fields = append(diff.Fields, CoverFieldDiff{
+			Field:    field.Field,
+			Label:    field.Label,
+			Status:   fieldStatus,
+			OldValue: oldValue,
+			NewValue: newValue,
+		})
+	}
+
+	if diff.Status == CoverDiffUnchanged && len(diff.Fields) > 0 {
+		diff.Status = CoverDiffChanged
+	}
+	return diff
+}
+
+// decryptCoverRows 解密库中多条记录的加密字段
+func (s *DataImportService) decryptCoverRows(records []map[string]interface{}, section coverDiffSection) []map[string]interface{} {
+	decrypted := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		decrypted = append(decrypted, s.decryptCoverRecord(record, section))
+	}
+	return decrypted
+}
+
+// diffCoverRows 比较子表记录（均为明文），按行匹配字段配对，无法配对的记录视为新增或删除
+func (s *DataImportService) diffCoverRows(section coverDiffSection, oldRows, newRows []map[string]interface{}) []CoverRecordDiff {
+	diffs := []CoverRecordDiff{}
+
+	rowKey := func(record map[string]interface{}) string {
+		key := getCoverRowKey(record, section.KeyFields)
+		if strings.Trim(key, coverKeySeparator) == "" {
+			return "row_no:" + getCoverValue(record, "row_no")
+		}
+		return key
+	}
+
+	oldIndex := make(map[string][]map[string]interface{})
+	for _, oldRow := range oldRows {
+		key := rowKey(oldRow)
+		oldIndex[key] = append(oldIndex[key], oldRow)
+	}
+
+	for _, newRow := range newRows {
+		key := rowKey(newRow)
+		var oldRow map[string]interface{}
+		if matches := oldIndex[key]; len(matches) > 0 {
+			oldRow = matches[0]
+			oldIndex[key] = matches[1:]
+		}
+		diffs = append(diffs, s.diffCoverRecord(key, section, oldRow, newRow))
+	}
+
+	// 剩余未配对的库中记录在覆盖后将被删除
+	for _, oldRow := range oldRows {
+		key := rowKey(oldRow)
+		if matches := oldIndex[key]; len(matches) > 0 {
+			diffs = append(diffs, s.diffCoverRecord(key, section, matches[0], nil))
+			oldIndex[key] = matches[1:]
+		}
+	}
+
+	return diffs
+}
+
+// queryCoverRows 查询库中现有记录
+func (s *DataImportService) queryCoverRows(query string, args ...interface{}) []map[string]interface{} {
+	result, err := s.app.GetDB().Query(query, args...)
+	if err != nil || result.Data == nil {
+		return nil
+	}
+	return result.Data.([]map[string]interface{})
+}
+
+// previewTable1Cover 生成附表1文件的覆盖差异
+func (s *DataImportService) previewTable1Cover(f *excelize.File) ([]CoverRecordDiff, error) {
+	mainData, usageData, equipData, err := s.parseTable1Excel(f, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(mainData) == 0 {
+		return nil, fmt.Errorf("主表数据为空")
+	}
+
+	newMain := mainData[0]
+	key := getCoverRecordKey(TableType1, newMain)
+
+	var oldMain map[string]interface{}
+	var oldUsage, oldEquip []map[string]interface{}
+	rows := s.queryCoverRows("SELECT * FROM enterprise_coal_consumption_main WHERE credit_code = ? AND stat_date = ? LIMIT 1",
+		getCoverValue(newMain, "credit_code"), getCoverValue(newMain, "stat_date"))
+	if len(rows) > 0 {
+		oldMain = s.decryptCoverRecord(rows[0], table1MainDiffSection)
+		objID := getCoverValue(rows[0], "obj_id")
+		oldUsage = s.decryptCoverRows(s.queryCoverRows("SELECT * FROM enterprise_coal_consumption_usage WHERE fk_id = ? ORDER BY CAST(row_no AS INTEGER)", objID), table1UsageDiffSection)
+		oldEquip = s.decryptCoverRows(s.queryCoverRows("SELECT * FROM enterprise_coal_consumption_equip WHERE fk_id = ? ORDER BY CAST(row_no AS INTEGER)", objID), table1EquipDiffSection)
+	}
+
+	diff := s.diffCoverRecord(key, table1MainDiffSection, oldMain, newMain)
+	diff.Children = append(diff.Children, s.diffCoverRows(table1UsageDiffSection, oldUsage, usageData)...)
+	diff.Children = append(diff.Children, s.diffCoverRows(table1EquipDiffSection, oldEquip, equipData)...)
+	return []CoverRecordDiff{markCoverRecordChanged(diff)}, nil
+}
+
+// previewTable2Cover 生成附表2文件的覆盖差异
+func (s *DataImportService) previewTable2Cover(f *excelize.File) ([]CoverRecordDiff, error) {
+	_, mainData, err := s.parseTable2Excel(f, true)
+	if err != nil {
+		return nil, err
+	}
+
+	newUnit := mainData[0]
+	key := getCoverRecordKey(TableType2, newUnit)
+	oldRows := s.queryCoverRows("SELECT * FROM critical_coal_equipment_consumption WHERE credit_code = ? AND stat_date = ? ORDER BY CAST(row_no AS INTEGER)",
+		getCoverValue(newUnit, "credit_code"), getCoverValue(newUnit, "stat_date"))
+
+	var oldUnit map[string]interface{}
+	if len(oldRows) > 0 {
+		oldUnit = oldRows[0]
+	}
+
+	diff := s.diffCoverRecord(key, table2UnitDiffSection, oldUnit, newUnit)
+	diff.Children = s.diffCoverRows(table2EquipDiffSection, s.decryptCoverRows(oldRows, table2EquipDiffSection), mainData)
+	return []CoverRecordDiff{markCoverRecordChanged(diff)}, nil
+}
+
+// previewTable3Cover 生成附表3文件的覆盖差异
+func (s *DataImportService) previewTable3Cover(f *excelize.File) ([]CoverRecordDiff, error) {
+	mainData, err := s.parseTable3Excel(f, true)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []CoverRecordDiff{}
+	for _, record := range mainData {
+		var oldRecord map[string]interface{}
+		rows := s.queryCoverRows("SELECT * FROM fixed_assets_investment_project WHERE project_code = ? AND document_number = ? LIMIT 1",
+			getCoverValue(record, "project_code"), getCoverValue(record, "document_number"))
+		if len(rows) > 0 {
+			oldRecord = s.decryptCoverRecord(rows[0], table3DiffSection)
+		}
+		diffs = append(diffs, s.diffCoverRecord(getCoverRecordKey(TableType3, record), table3DiffSection, oldRecord, record))
+	}
+	return diffs, nil
+}
+
+// previewAttachment2Cover 生成附件2文件的覆盖差异
+func (s *DataImportService) previewAttachment2Cover(f *excelize.File) ([]CoverRecordDiff, error) {
+	mainData, err := s.parseAttachment2Excel(f, true)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []CoverRecordDiff{}
+	for _, record := range mainData {
+		var oldRecord map[string]interface{}
+		rows := s.queryCoverRows("SELECT * FROM coal_consumption_report WHERE stat_date = ? AND province_name = ? AND city_name = ? AND country_name = ? LIMIT 1",
+			getCoverValue(record, "stat_date"), getCoverValue(record, "province_name"),
+			getCoverValue(record, "city_name"), getCoverValue(record, "country_name"))
+		if len(rows) > 0 {
+			oldRecord = s.decryptCoverRecord(rows[0], attachment2DiffSection)
+		}
+		diffs = append(diffs, s.diffCoverRecord(getCoverRecordKey(TableTypeAttachment2, record), attachment2DiffSection, oldRecord, record))
+	}
+	return diffs, nil
+}
+
+// markCoverRecordChanged 子表存在差异时将主记录标记为修改
+func markCoverRecordChanged(diff CoverRecordDiff) CoverRecordDiff {
+	if diff.Status != CoverDiffUnchanged {
+		return diff
+	}
+	for _, child := range diff.Children {
+		if child.Status != CoverDiffUnchanged {
+			diff.Status = CoverDiffChanged
+			break
+		}
+	}
+	return diff
+}
+
+// countCoverDiffs 统计文件中各状态的记录数
+func countCoverDiffs(preview *CoverFilePreview, diffs []CoverRecordDiff) {
+	for _, diff := range diffs {
+		switch diff.Status {
+		case CoverDiffAdded:
+			preview.Added++
+		case CoverDiffRemoved:
+			preview.Removed++
+		case CoverDiffChanged:
+			preview.Changed++
+		default:
+			preview.Unchanged++
+		}
+		countCoverDiffs(preview, diff.Children)
+	}
+}
+
+// PreviewModelDataCover 覆盖前预览待覆盖文件与库中数据的字段差异，不修改任何数据
+func (s *DataImportService) PreviewModelDataCover(tableType string, filePaths []string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return s.previewModelDataCoverWithRecover(tableType, filePaths)
+}
+
+// previewModelDataCoverWithRecover 带异常处理的覆盖预览函数
+func (s *DataImportService) previewModelDataCoverWithRecover(tableType string, filePaths []string) (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("PreviewModelDataCover 发生异常: %v", r)
+			result = db.QueryResult{
+				Ok:      false,
+				Message: fmt.Sprintf("函数执行异常: %v", r),
+			}
+		}
+	}()
+
+	var previewFunc func(f *excelize.File) ([]CoverRecordDiff, error)
+	switch tableType {
+	case TableType1:
+		previewFunc = s.previewTable1Cover
+	case TableType2:
+		previewFunc = s.previewTable2Cover
+	case TableType3:
+		previewFunc = s.previewTable3Cover
+	case TableTypeAttachment2:
+		previewFunc = s.previewAttachment2Cover
+	default:
+		return db.QueryResult{Ok: false, Message: "不支持的表格类型"}
+	}
+
+	cacheDir := s.app.GetCachePath(tableType)
+	previews := []CoverFilePreview{}
+	for _, filePath := range filePaths {
+		preview := CoverFilePreview{
+			FilePath: filePath,
+			FileName: filepath.Base(filePath),
+			Records:  []CoverRecordDiff{},
+		}
+
+		// 只允许预览缓存目录中的文件
+		if filepath.Dir(filepath.Clean(filePath)) != filepath.Clean(cacheDir) {
+			preview.Message = "文件不在缓存目录中"
+			previews = append(previews, preview)
+			continue
+		}
+		if _, err := os.Stat(filePath); err != nil {
+			preview.Message = fmt.Sprintf("文件不存在: %v", err)
+			previews = append(previews, preview)
+			continue
+		}
+
+		f, err := excelize.OpenFile(filePath)
+		if err != nil {
+			preview.Message = fmt.Sprintf("文件读取失败: %v", err)
+			previews = append(previews, preview)
+			continue
+		}
+
+		diffs, err := previewFunc(f)
+		f.Close()
+		if err != nil {
+			preview.Message = fmt.Sprintf("文件解析失败: %v", err)
+			previews = append(previews, preview)
+			continue
+		}
+
+		preview.Records = diffs
+		countCoverDiffs(&preview, diffs)
+		previews = append(previews, preview)
+	}
+
+	return db.QueryResult{
+		Ok:      true,
+		Message: "覆盖预览生成成功",
+		Data:    previews,
+	}
+}
+
+// ModelDataCoverRecords 按确认结果覆盖数据，excludedKeys中的记录保持库中原值
+func (s *DataImportService) ModelDataCoverRecords(tableType string, filePaths []string, excludedKeys []string) db.QueryResult {
+	switch tableType {
+	case TableType1:
+		return s.modelDataCoverTable1WithRecover(filePaths, excludedKeys)
+	case TableType2:
+		return s.modelDataCoverTable2WithRecover(filePaths, excludedKeys)
+	case TableType3:
+		return s.modelDataCoverTable3WithRecover(filePaths, excludedKeys)
+	case TableTypeAttachment2:
+		return s.modelDataCoverAttachment2WithRecover(filePaths, excludedKeys)
+	}
+	return db.QueryResult{Ok: false, Message: "不支持的表格类型"}
+}
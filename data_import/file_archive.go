@@ -0,0 +1,287 @@
+package data_import
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"shuji/db"
+	"strings"
+
+	"github.com/tjfoc/gmsm/sm3"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// GetFileHash 计算文件内容的SM3哈希
+func GetFileHash(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sm3.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// getDataTableByTableType 获取文件类型对应的数据主表
+func getDataTableByTableType(tableType string) string {
+	switch tableType {
+	case TableType1:
+		return TableEnterpriseCoalConsumptionMain
+	case TableType2:
+		return TableCriticalCoalEquipmentConsumption
+	case TableType3:
+		return TableFixedAssetsInvestmentProject
+	case TableTypeAttachment2:
+		return TableCoalConsumptionReport
+	}
+	return ""
+}
+
+// getArchiveFilePath 获取原始文件在归档目录中的路径，按哈希前两位分目录存放
+func (s *DataImportService) getArchiveFilePath(fileHash, ext string) string {
+	return filepath.Join(s.app.GetArchivePath(), fileHash[:2], fileHash+strings.ToLower(ext))
+}
+
+// findArchiveFile 根据哈希查找归档的原始文件
+func (s *DataImportService) findArchiveFile(fileHash string) (string, error) {
+	if len(fileHash) < 2 {
+		return "", fmt.Errorf("文件哈希无效")
+	}
+
+	matches, err := filepath.Glob(filepath.Join(s.app.GetArchivePath(), fileHash[:2], fileHash+".*"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("原始文件不存在")
+	}
+	return matches[0], nil
+}
+
+// archiveOriginalFile 将原始文件按内容哈希归档，相同内容只保存一份
+func (s *DataImportService) archiveOriginalFile(filePath, fileHash string) error {
+	archivePath := s.getArchiveFilePath(fileHash, filepath.Ext(filePath))
+	if _, err := os.Stat(archivePath); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0755); err != nil {
+		return err
+	}
+
+	srcFile, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	// 先写临时文件再重命名，避免中断后留下不完整的归档文件
+	tempPath := archivePath + ".tmp"
+	dstFile, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	dstFile.Close()
+
+	return os.Rename(tempPath, archivePath)
+}
+
+// findDuplicateUploads 查找与当前文件内容相同的已导入数据或待校验文件
+func (s *DataImportService) findDuplicateUploads(tableType, fileName, fileHash string) []string {
+	duplicates := []string{}
+
+	// 相同内容的数据已保存到数据库
+	if tableName := getDataTableByTableType(tableType); tableName != "" {
+		query := fmt.Sprintf("SELECT COUNT(1) as count FROM %s WHERE file_hash = ?", tableName)
+		result, err := s.app.GetDB().QueryRow(query, fileHash)
+		if err == nil && result.Data != nil {
+			if count, ok := result.Data.(map[string]interface{})["count"].(int64); ok && count > 0 {
+				duplicates = append(duplicates, fmt.Sprintf("文件内容与已导入的数据完全相同（%d条数据），无需重复导入", count))
+				return duplicates
+			}
+		}
+	}
+
+	// 相同内容的文件已导入缓存，等待模型校验
+	query := `SELECT DISTINCT file_name FROM data_import_record
+		WHERE file_type = ? AND file_hash = ? AND import_state = ? AND file_name <> ?`
+	result, err := s.app.GetDB().Query(query, tableType, fileHash, ImportStateSuccess, fileName)
+	if err != nil || result.Data == nil {
+		return duplicates
+	}
+
+	for _, record := range result.Data.([]map[string]interface{}) {
+		cachedFileName := s.getStringValue(record["file_name"])
+		if cacheResult := s.app.CacheFileExists(tableType, cachedFileName); cacheResult.Ok {
+			duplicates = append(duplicates, fmt.Sprintf("文件内容与待校验文件 %s 完全相同，无需重复导入", cachedFileName))
+		}
+	}
+
+	return duplicates
+}
+
+// checkUploadFileHash 计算上传文件哈希并归档原始文件，相同内容的重复上传直接返回提示信息
+func (s *DataImportService) checkUploadFileHash(filePath, tableType string) (string, []string) {
+	fileName := filepath.Base(filePath)
+
+	fileHash, err := GetFileHash(filePath)
+	if err != nil {
+		errorMessage := fmt.Sprintf("计算文件哈希失败: %v", err)
+		s.app.InsertImportRecord(fileName, tableType, ImportStateFailed, errorMessage)
+		s.saveImportValidationReport(tableType, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
+		return "", []string{errorMessage}
+	}
+
+	if err := s.archiveOriginalFile(filePath, fileHash); err != nil {
+		errorMessage := fmt.Sprintf("归档原始文件失败: %v", err)
+		s.app.InsertImportRecordWithHash(fileName, tableType, ImportStateFailed, errorMessage, fileHash)
+		s.saveImportValidationReport(tableType, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
+		return fileHash, []string{errorMessage}
+	}
+
+	duplicates := s.findDuplicateUploads(tableType, fileName, fileHash)
+	if len(duplicates) > 0 {
+		s.app.InsertImportRecordWithHash(fileName, tableType, ImportStateFailed, fmt.Sprintf("重复文件: %s", strings.Join(duplicates, "; ")), fileHash)
+		s.saveImportValidationReport(tableType, fileName, newImportValidationReportEntries(fileName, duplicates))
+	}
+	return fileHash, duplicates
+}
+
+// getCacheFileHash 获取缓存文件对应原始文件的哈希（缓存文件已解除保护，内容与原始文件不同）
+func (s *DataImportService) getCacheFileHash(tableType, fileName string) string {
+	query := `SELECT file_hash FROM data_import_record
+		WHERE file_type = ? AND file_name = ? AND import_state = ? AND file_hash IS NOT NULL AND file_hash <> ''
+		ORDER BY import_time DESC LIMIT 1`
+	result, err := s.app.GetDB().QueryRow(query, tableType, fileName, ImportStateSuccess)
+	if err != nil || result.Data == nil {
+		return ""
+	}
+	return s.getStringValue(result.Data.(map[string]interface{})["file_hash"])
+}
+
+// setRecordsFileHash 为待保存的数据行记录源文件哈希
+func (s *DataImportService) setRecordsFileHash(records []map[string]interface{}, fileHash string) {
+	if fileHash == "" {
+		return
+	}
+	for _, record := range records {
+		record["file_hash"] = fileHash
+	}
+}
+
+// ExportOriginalFile 根据文件哈希导出归档的原始文件
+func (s *DataImportService) ExportOriginalFile(fileHash string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return s.exportOriginalFileWithRecover(fileHash)
+}
+
+// exportOriginalFileWithRecover 带异常处理的导出原始文件函数
+func (s *DataImportService) exportOriginalFileWithRecover(fileHash string) (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ExportOriginalFile 发生异常: %v", r)
+			result = db.QueryResult{
+				Ok:      false,
+				Message: fmt.Sprintf("函数执行异常: %v", r),
+			}
+		}
+	}()
+
+	archivePath, err := s.findArchiveFile(fileHash)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("导出原始文件失败: %v", err)}
+	}
+
+	// 默认使用最近一次导入时的文件名
+	defaultFileName := filepath.Base(archivePath)
+	query := "SELECT file_name FROM data_import_record WHERE file_hash = ? ORDER BY import_time DESC LIMIT 1"
+	if recordResult, err := s.app.GetDB().QueryRow(query, fileHash); err == nil && recordResult.Data != nil {
+		if name := s.getStringValue(recordResult.Data.(map[string]interface{})["file_name"]); name != "" {
+			defaultFileName = name
+		}
+	}
+
+	selectPath, err := runtime.SaveFileDialog(s.app.GetCtx(), runtime.SaveDialogOptions{
+		Title:           "导出原始文件",
+		DefaultFilename: defaultFileName,
+		Filters: []runtime.FileFilter{
+			{
+				Pattern: "*" + filepath.Ext(archivePath),
+			},
+		},
+	})
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("导出原始文件失败: %v", err)}
+	}
+	if selectPath == "" {
+		return db.QueryResult{Ok: false, Message: "导出原始文件失败: 未选择文件"}
+	}
+
+	// 导出前核对归档文件哈希，防止归档文件被篡改
+	archiveHash, err := GetFileHash(archivePath)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("导出原始文件失败: %v", err)}
+	}
+	if archiveHash != fileHash {
+		return db.QueryResult{Ok: false, Message: "导出原始文件失败: 归档文件内容与哈希不一致"}
+	}
+
+	srcFile, err := os.Open(archivePath)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("导出原始文件失败: %v", err)}
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(selectPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("导出原始文件失败: %v", err)}
+	}
+	defer dstFile.Close()
+
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("导出原始文件失败: %v", err)}
+	}
+
+	return db.QueryResult{
+		Ok:      true,
+		Message: "导出原始文件成功",
+		Data:    selectPath,
+	}
+}
+
+// ExportOriginalFileByRecord 根据数据记录导出其来源的原始文件
+func (s *DataImportService) ExportOriginalFileByRecord(tableType, objID string) db.QueryResult {
+	tableName := getDataTableByTableType(tableType)
+	if tableName == "" {
+		return db.QueryResult{Ok: false, Message: "不支持的表格类型"}
+	}
+
+	query := fmt.Sprintf("SELECT file_hash FROM %s WHERE obj_id = ?", tableName)
+	result, err := s.app.GetDB().QueryRow(query, objID)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("查询数据失败: %v", err)}
+	}
+	if result.Data == nil {
+		return db.QueryResult{Ok: false, Message: "数据不存在"}
+	}
+
+	fileHash := s.getStringValue(result.Data.(map[string]interface{})["file_hash"])
+	if fileHash == "" {
+		return db.QueryResult{Ok: false, Message: "该数据没有关联的原始文件"}
+	}
+
+	return s.ExportOriginalFile(fileHash)
+}
@@ -0,0 +1,158 @@
+package data_import
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// formulaCell 公式单元格信息
+type formulaCell struct {
+	Cell       string // 单元格位置，如"E8"
+	Formula    string // 公式内容
+	Cached     string // 文件中保存的缓存值
+	Calculated string // 重新计算得到的值
+	CalcError  error  // 重新计算失败时的错误
+}
+
+// scanFormulaCells 扫描工作表中的所有公式单元格，并使用excelize计算引擎重新计算。
+// 只扫描GetRows读取到的单元格（公式单元格即使缓存值为空也会保留），不使用工作表维度，
+// 整列设置格式后维度可能被写成A1:XFD1048576，按维度逐个单元格读取公式会导致导入卡死
+func (s *DataImportService) scanFormulaCells(f *excelize.File, sheetName string, rows [][]string) map[string]formulaCell {
+	cells := make(map[string]formulaCell)
+
+	for r, row := range rows {
+		for c := range row {
+			cellName, err := excelize.CoordinatesToCellName(c+1, r+1)
+			if err != nil {
+				continue
+			}
+			formula, err := f.GetCellFormula(sheetName, cellName)
+			if err != nil || formula == "" {
+				continue
+			}
+
+			info := formulaCell{Cell: cellName, Formula: formula, Cached: s.cleanCellValue(row[c])}
+			calculated, err := f.CalcCellValue(sheetName, cellName)
+			if err != nil {
+				info.CalcError = err
+			} else {
+				info.Calculated = s.cleanCellValue(calculated)
+			}
+			cells[cellName] = info
+		}
+	}
+
+	return cells
+}
+
+// formulaSheet 工作表的行数据和公式单元格，公式计算较慢，同一文件的工作表只扫描计算一次
+type formulaSheet struct {
+	Name  string                 // 工作表名称
+	Rows  [][]string             // 行数据，公式缓存值为空时已使用重新计算的结果填充
+	Cells map[string]formulaCell // 公式单元格，key: 单元格位置
+}
+
+// readFormulaSheet 读取文件第一个数据工作表的所有行并扫描公式单元格，解析数据和公式校验共用扫描结果
+func (s *DataImportService) readFormulaSheet(f *excelize.File) (*formulaSheet, error) {
+	sheets := getDataSheetList(f)
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("Excel文件没有工作表")
+	}
+
+	rows, err := f.GetRows(sheets[0])
+	if err != nil {
+		return nil, fmt.Errorf("读取工作表失败: %v", err)
+	}
+	formulaCells := s.scanFormulaCells(f, sheets[0], rows)
+
+	return &formulaSheet{
+		Name:  sheets[0],
+		Rows:  s.getRowsWithFormula(rows, formulaCells),
+		Cells: formulaCells,
+	}, nil
+}
+
+// getRowsWithFormula 公式单元格缓存值为空时（如WPS生成的文件）使用重新计算的结果填充行数据，
+// 这样GetCellValueByRow等按行读取的函数拿到的就是公式的实际结果
+func (s *DataImportService) getRowsWithFormula(rows [][]string, formulaCells map[string]formulaCell) [][]string {
+	for _, info := range formulaCells {
+		if info.Cached != "" || info.CalcError != nil || info.Calculated == "" {
+			continue
+		}
+
+		col, row, err := excelize.CellNameToCoordinates(info.Cell)
+		if err != nil {
+			continue
+		}
+		for len(rows) < row {
+			rows = append(rows, []string{})
+		}
+		for len(rows[row-1]) < col {
+			rows[row-1] = append(rows[row-1], "")
+		}
+		rows[row-1][col-1] = info.Calculated
+	}
+
+	return rows
+}
+
+// isFormulaValueEqual 比较缓存值和重新计算值是否一致，数值按3位小数精度比较
+func (s *DataImportService) isFormulaValueEqual(cached, calculated string) bool {
+	cachedFloat, err1 := strconv.ParseFloat(cached, 64)
+	calculatedFloat, err2 := strconv.ParseFloat(calculated, 64)
+	if err1 == nil && err2 == nil {
+		return s.isIntegerEqual(cachedFloat, calculatedFloat)
+	}
+	return cached == calculated
+}
+
+// validateFormulaCells 校验数据行中的公式单元格，文件中保存的值与重新计算的结果不一致时说明公式结果过期，
+// 按警告提示，由用户确认后导入。
+// 模板中没有约定小计单元格的位置，无法判断常量是否覆盖了小计公式，不做该项校验
+// formulaCells为readFormulaSheet扫描的公式单元格，rowKey为记录中保存Excel行号的字段，如"_excel_row"、"_excel_row2"
+func (s *DataImportService) validateFormulaCells(formulaCells map[string]formulaCell, tableType string, records []map[string]interface{}, rowKey string) []ValidationError {
+	errors := []ValidationError{}
+	if len(records) == 0 || len(formulaCells) == 0 {
+		return errors
+	}
+
+	// 只检查记录中实际存在的数值字段，按列排序保证错误信息顺序稳定
+	fieldMapping := s.getFieldMapping(tableType)
+	var fields []string
+	for fieldName := range fieldMapping {
+		if _, exists := records[0][fieldName]; exists {
+			fields = append(fields, fieldName)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fieldMapping[fields[i]].Column < fieldMapping[fields[j]].Column
+	})
+
+	for _, fieldName := range fields {
+		for _, record := range records {
+			rowNum, ok := record[rowKey].(int)
+			if !ok {
+				continue
+			}
+			cell := s.getCellPosition(tableType, fieldName, rowNum)
+			info, isFormula := formulaCells[cell]
+			if !isFormula {
+				continue
+			}
+			if info.Cached != "" && info.CalcError == nil && !s.isFormulaValueEqual(info.Cached, info.Calculated) {
+				errors = append(errors, ValidationError{
+					RowNumber: rowNum,
+					Message:   fmt.Sprintf("单元格%s公式计算结果为%s，与文件中保存的值%s不一致，请重新计算后保存", cell, info.Calculated, info.Cached),
+					Cells:     []string{cell},
+					Severity:  SeverityWarning,
+					RuleID:    "FX-001",
+				})
+			}
+		}
+	}
+
+	return errors
+}
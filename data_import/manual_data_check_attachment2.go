@@ -90,7 +90,7 @@ func (s *DataImportService) QueryDataDetailAttachment2ByDBFile(obj_ids []string,
 		}
 	}
 
-	database, err := db.NewDatabase(dbFilePath, s.app.GetDBPassword())
+	database, err := db.NewReadOnlyDatabase(dbFilePath, s.app.GetDBPassword())
 	if err != nil {
 		return db.QueryResult{
 			Ok:      false,
@@ -105,6 +105,7 @@ func (s *DataImportService) QueryDataDetailAttachment2ByDBFile(obj_ids []string,
 		result := s.queryDataDetailAttachment2Forinner(obj_id, database)
 		if result.Ok && result.Data != nil {
 			if data, ok := result.Data.(map[string]interface{}); ok {
+				attachMergeSource(database, data)
 				allData = append(allData, data)
 			}
 		}
@@ -201,6 +202,15 @@ func (s *DataImportService) ConfirmDataAttachment2(obj_id []string) db.QueryResu
 	placeholders := strings.Repeat("?,", len(obj_id))
 	placeholders = placeholders[:len(placeholders)-1] // 移除最后一个逗号
 
+	// 已报送的年份不允许确认
+	years := s.queryStatDatesByObjIDs(TableCoalConsumptionReport, obj_id)
+	if err := s.CheckYearsWritable(years); err != nil {
+		return db.QueryResult{
+			Ok:      false,
+			Message: err.Error(),
+		}
+	}
+
 	// 更新附件2确认状态
 	query := fmt.Sprintf(`
 		UPDATE coal_consumption_report 
@@ -219,6 +229,8 @@ func (s *DataImportService) ConfirmDataAttachment2(obj_id []string) db.QueryResu
 		}
 	}
 
+	s.advanceSubmissionStatus(years, SubmissionEventConfirm)
+
 	return db.QueryResult{
 		Ok:      true,
 		Message: fmt.Sprintf("成功确认 %d 条附件2数据", len(obj_id)),
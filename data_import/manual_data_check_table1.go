@@ -70,7 +70,7 @@ func (s *DataImportService) QueryDataDetailTable1ByDBFile(obj_ids []string, dbFi
 		}
 	}
 
-	database, err := db.NewDatabase(dbFilePath, s.app.GetDBPassword())
+	database, err := db.NewReadOnlyDatabase(dbFilePath, s.app.GetDBPassword())
 	if err != nil {
 		return db.QueryResult{
 			Ok:      false,
@@ -85,6 +85,9 @@ func (s *DataImportService) QueryDataDetailTable1ByDBFile(obj_ids []string, dbFi
 		result := s.queryDataDetailTable1Forinner(obj_id, database)
 		if result.Ok && result.Data != nil {
 			if data, ok := result.Data.(map[string]interface{}); ok {
+				if mainData, ok := data["main"].(map[string]interface{}); ok {
+					attachMergeSource(database, mainData)
+				}
 				allData = append(allData, data)
 			}
 		}
@@ -283,6 +286,15 @@ func (s *DataImportService) ConfirmDataTable1(obj_id []string) db.QueryResult {
 	placeholders := strings.Repeat("?,", len(obj_id))
 	placeholders = placeholders[:len(placeholders)-1] // 移除最后一个逗号
 
+	// 已报送的年份不允许确认
+	years := s.queryStatDatesByObjIDs(TableEnterpriseCoalConsumptionMain, obj_id)
+	if err := s.CheckYearsWritable(years); err != nil {
+		return db.QueryResult{
+			Ok:      false,
+			Message: err.Error(),
+		}
+	}
+
 	// 更新主表确认状态
 	mainQuery := fmt.Sprintf(`
 		UPDATE enterprise_coal_consumption_main 
@@ -337,6 +349,8 @@ func (s *DataImportService) ConfirmDataTable1(obj_id []string) db.QueryResult {
 		}
 	}
 
+	s.advanceSubmissionStatus(years, SubmissionEventConfirm)
+
 	return db.QueryResult{
 		Ok:      true,
 		Message: fmt.Sprintf("成功确认 %d 条附表1数据", len(obj_id)),
@@ -106,6 +106,15 @@ func (s *DataImportService) ConfirmDataTable2(obj_id []string) db.QueryResult {
 	placeholders := strings.Repeat("?,", len(obj_id))
 	placeholders = placeholders[:len(placeholders)-1] // 移除最后一个逗号
 
+	// 已报送的年份不允许确认
+	years := s.queryStatDatesByObjIDs(TableCriticalCoalEquipmentConsumption, obj_id)
+	if err := s.CheckYearsWritable(years); err != nil {
+		return db.QueryResult{
+			Ok:      false,
+			Message: err.Error(),
+		}
+	}
+
 	// 更新附表2确认状态
 	query := fmt.Sprintf(`
 		UPDATE critical_coal_equipment_consumption 
@@ -124,6 +133,8 @@ func (s *DataImportService) ConfirmDataTable2(obj_id []string) db.QueryResult {
 		}
 	}
 
+	s.advanceSubmissionStatus(years, SubmissionEventConfirm)
+
 	return db.QueryResult{
 		Ok:      true,
 		Message: fmt.Sprintf("成功确认 %d 条附表2数据", len(obj_id)),
@@ -140,7 +151,7 @@ func (s *DataImportService) QueryDataDetailTable2ByDBFile(obj_ids []string, dbFi
 		}
 	}
 
-	database, err := db.NewDatabase(dbFilePath, s.app.GetDBPassword())
+	database, err := db.NewReadOnlyDatabase(dbFilePath, s.app.GetDBPassword())
 	if err != nil {
 		return db.QueryResult{
 			Ok:      false,
@@ -157,6 +168,7 @@ func (s *DataImportService) QueryDataDetailTable2ByDBFile(obj_ids []string, dbFi
 			dataList, ok := data.Data.([]map[string]interface{})
 			if ok && len(dataList) > 0 {
 				// 只取最新的一条数据
+				attachMergeSource(database, dataList[len(dataList)-1])
 				allData = append(allData, dataList[len(dataList)-1])
 			}
 		}
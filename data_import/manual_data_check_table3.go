@@ -102,7 +102,7 @@ func (s *DataImportService) QueryDataDetailTable3ByDBFile(obj_ids []string, dbFi
 		}
 	}
 
-	database, err := db.NewDatabase(dbFilePath, s.app.GetDBPassword())
+	database, err := db.NewReadOnlyDatabase(dbFilePath, s.app.GetDBPassword())
 	if err != nil {
 		return db.QueryResult{
 			Ok:      false,
@@ -119,6 +119,7 @@ func (s *DataImportService) QueryDataDetailTable3ByDBFile(obj_ids []string, dbFi
 		result := s.queryDataDetailTable3Forinner(obj_id, database)
 		if result.Ok && result.Data != nil {
 			if data, ok := result.Data.(map[string]interface{}); ok {
+				attachMergeSource(database, data)
 				allData = append(allData, data)
 			}
 		}
@@ -229,6 +230,15 @@ func (s *DataImportService) ConfirmDataTable3(obj_id []string) db.QueryResult {
 	placeholders := strings.Repeat("?,", len(obj_id))
 	placeholders = placeholders[:len(placeholders)-1] // 移除最后一个逗号
 
+	// 已报送的年份不允许确认
+	years := s.queryStatDatesByObjIDs(TableFixedAssetsInvestmentProject, obj_id)
+	if err := s.CheckYearsWritable(years); err != nil {
+		return db.QueryResult{
+			Ok:      false,
+			Message: err.Error(),
+		}
+	}
+
 	// 更新附表3确认状态
 	query := fmt.Sprintf(`
 		UPDATE fixed_assets_investment_project 
@@ -247,6 +257,8 @@ func (s *DataImportService) ConfirmDataTable3(obj_id []string) db.QueryResult {
 		}
 	}
 
+	s.advanceSubmissionStatus(years, SubmissionEventConfirm)
+
 	return db.QueryResult{
 		Ok:      true,
 		Message: fmt.Sprintf("成功确认 %d 条附表3数据", len(obj_id)),
@@ -0,0 +1,98 @@
+package data_import
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MergeFieldDiff 合并冲突中各来源取值不同的字段
+type MergeFieldDiff struct {
+	Section string   `json:"section"` // 所属表格
+	RowKey  string   `json:"rowKey"`  // 行标识
+	Field   string   `json:"field"`   // 字段名
+	Label   string   `json:"label"`   // 字段显示名称
+	Values  []string `json:"values"`  // 按来源顺序排列的取值（已解密）
+}
+
+// getMergeDiffSection 获取数据表对应的比对定义
+func getMergeDiffSection(tableName string) (coverDiffSection, bool) {
+	switch tableName {
+	case TableEnterpriseCoalConsumptionMain:
+		return table1MainDiffSection, true
+	case TableEnterpriseCoalConsumptionUsage:
+		return table1UsageDiffSection, true
+	case TableEnterpriseCoalConsumptionEquip:
+		return table1EquipDiffSection, true
+	case TableCriticalCoalEquipmentConsumption:
+		// 附表2每行均包含单位信息，单位信息与装置信息一起比较
+		section := table2EquipDiffSection
+		section.Fields = append(append([]coverDiffField{}, table2UnitDiffSection.Fields...), table2EquipDiffSection.Fields...)
+		return section, true
+	case TableFixedAssetsInvestmentProject:
+		return table3DiffSection, true
+	case TableCoalConsumptionReport:
+		return attachment2DiffSection, true
+	}
+	return coverDiffSection{}, false
+}
+
+// DiffMergeCandidates 比较合并冲突中各来源的记录，candidates按来源顺序排列，每个来源为表名到记录的映射，
+// 返回取值不同的字段，为空表示各来源内容相同
+func (s *DataImportService) DiffMergeCandidates(tableNames []string, candidates []map[string][]map[string]interface{}) []MergeFieldDiff {
+	diffs := []MergeFieldDiff{}
+
+	for _, tableName := range tableNames {
+		section, exists := getMergeDiffSection(tableName)
+		if !exists {
+			continue
+		}
+
+		// 按行标识索引各来源的记录，同一来源内标识重复时追加序号区分
+		var rowKeys []string
+		rowIndex := make([]map[string]map[string]interface{}, len(candidates))
+		for i, candidate := range candidates {
+			rowIndex[i] = make(map[string]map[string]interface{})
+			keyCount := make(map[string]int)
+			for _, record := range s.decryptCoverRows(candidate[tableName], section) {
+				key := getCoverRowKey(record, section.KeyFields)
+				if strings.Trim(key, coverKeySeparator) == "" {
+					key = "row_no:" + getCoverValue(record, "row_no")
+				}
+				keyCount[key]++
+				if keyCount[key] > 1 {
+					key = fmt.Sprintf("%s#%d", key, keyCount[key])
+				}
+				if !slices.Contains(rowKeys, key) {
+					rowKeys = append(rowKeys, key)
+				}
+				rowIndex[i][key] = record
+			}
+		}
+
+		for _, key := range rowKeys {
+			for _, field := range section.Fields {
+				values := make([]string, 0, len(candidates))
+				isDifferent := false
+				for i := range candidates {
+					value := getCoverValue(rowIndex[i][key], field.Field)
+					if len(values) > 0 && !isCoverValueEqual(values[0], value) {
+						isDifferent = true
+					}
+					values = append(values, value)
+				}
+				if isDifferent {
+					diffs = append(diffs, MergeFieldDiff{
+						Section: section.Name,
+						RowKey:  key,
+						Field:   field.Field,
+						Label:   field.Label,
+						Values:  values,
+					})
+				}
+			}
+		}
+	}
+
+	return diffs
+}
@@ -0,0 +1,31 @@
+package data_import
+
+import (
+	"shuji/db"
+)
+
+// TableDataMergeSource 合并数据来源表
+const TableDataMergeSource = "data_merge_source"
+
+// queryMergeSource 查询合并数据库中数据的来源信息，非合并数据库或没有来源记录时返回nil
+func queryMergeSource(database *db.Database, objID interface{}) map[string]interface{} {
+	query := `SELECT source_file, source_hash, source_province, source_city, source_country,
+		export_time, merge_time, original_obj_id
+		FROM ` + TableDataMergeSource + ` WHERE record_id = ? ORDER BY merge_time DESC LIMIT 1`
+
+	// 早期版本的数据库没有来源表，查询失败时不影响数据查询
+	result, err := database.QueryRow(query, objID)
+	if err != nil || !result.Ok || result.Data == nil {
+		return nil
+	}
+	source, ok := result.Data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return source
+}
+
+// attachMergeSource 在查询结果中附加数据来源信息
+func attachMergeSource(database *db.Database, data map[string]interface{}) {
+	data["provenance"] = queryMergeSource(database, data["obj_id"])
+}
@@ -1,12 +1,14 @@
 package data_import
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"shuji/db"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,6 +36,25 @@ type EnhancedAreaConfig struct {
 
 // ModelDataCoverAttachment2 覆盖附件2数据
 func (s *DataImportService) ModelDataCoverAttachment2(filePaths []string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return s.modelDataCoverAttachment2WithRecover(filePaths, nil)
+}
+
+// modelDataCoverAttachment2WithRecover 带异常处理的覆盖附件2数据函数，excludedKeys中的记录不覆盖
+func (s *DataImportService) modelDataCoverAttachment2WithRecover(filePaths []string, excludedKeys []string) (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ModelDataCoverAttachment2 发生异常: %v", r)
+			// 设置错误结果
+			result = db.QueryResult{
+				Ok:      false,
+				Message: fmt.Sprintf("函数执行异常: %v", r),
+				Data:    nil,
+			}
+		}
+	}()
+
 	cacheDir := s.app.GetCachePath(TableTypeAttachment2)
 	files, err := os.ReadDir(cacheDir)
 	if err != nil {
@@ -43,6 +64,11 @@ func (s *DataImportService) ModelDataCoverAttachment2(filePaths []string) db.Que
 		}
 	}
 
+	// 覆盖数据前为系统数据库创建快照
+	if snapshotResult := s.app.CreateSnapshot(SnapshotReasonCover); !snapshotResult.Ok {
+		return snapshotResult
+	}
+
 	areaConfig := s.GetAreaConfig()
 
 	var validationErrors []ValidationError
@@ -75,6 +101,13 @@ func (s *DataImportService) ModelDataCoverAttachment2(filePaths []string) db.Que
 				continue
 			}
 
+			// 排除未确认覆盖的记录
+			mainData = filterCoverRecords(TableTypeAttachment2, mainData, excludedKeys)
+			if len(mainData) == 0 {
+				continue
+			}
+
+			s.setRecordsFileHash(mainData, s.getCacheFileHash(TableTypeAttachment2, file.Name()))
 			err = s.coverAttachment2Data(mainData, file.Name(), areaConfig)
 			if err != nil {
 				validationErrors = append(validationErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 覆盖数据失败: %v", file.Name(), err)})
@@ -131,7 +164,11 @@ func (s *DataImportService) modelDataCheckAttachment2WithRecover() db.QueryResul
 		return result
 	}
 
-	s.initAttachment2CacheManager()
+	// 入库前检测批次内多个文件之间的重复数据，存在未处理的重复时由用户选择保留的文件
+	batchExclusions := s.loadBatchDuplicateResolution(TableTypeAttachment2)
+	if duplicateResult, exists := s.checkBatchDuplicates(TableTypeAttachment2, batchExclusions); exists {
+		return duplicateResult
+	}
 
 	areaConfig := s.GetAreaConfig()
 
@@ -141,8 +178,16 @@ func (s *DataImportService) modelDataCheckAttachment2WithRecover() db.QueryResul
 	var importedFiles = []string{}             // 导入的文件
 	var coverFiles = []string{}                // 覆盖的文件
 	var failedFiles = []string{}               // 失败的文件
+	var warningFiles = []string{}              // 存在警告已确认导入的文件
 	var hasExcelFile = false                   // 是否有Excel文件
 
+	// 仅有警告的文件需用户确认后导入，未确认的文件保留在缓存目录中
+	warningAcks := s.loadWarningAcknowledgements(TableTypeAttachment2)
+	pendingWarnings := make(map[string]WarningAcknowledgement) // key: 文件名, value: 等待确认的警告
+
+	// 结构化校验结果，写入校验报告中的JSON、CSV文件
+	var reportEntries = []ValidationReportEntry{}
+
 	// 2. 循环调用对应的解析Excel函数
 	for _, file := range files {
 		// 检查是否xlsx或者xls文件
@@ -154,23 +199,42 @@ func (s *DataImportService) modelDataCheckAttachment2WithRecover() db.QueryResul
 			f, err := excelize.OpenFile(filePath)
 			if err != nil {
 				systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 读取失败: %v", file.Name(), err)})
+				reportEntries = append(reportEntries, newFileValidationReportEntry(file.Name(), fmt.Sprintf("文件读取失败: %v", err)))
 				failedFiles = append(failedFiles, filePath)
 				continue
 			}
 
-			mainData, err := s.parseAttachment2Excel(f, true)
+			// 公式单元格只扫描计算一次，解析数据和公式校验共用
+			sheet, err := s.readFormulaSheet(f)
 			f.Close()
+			var mainData []map[string]interface{}
+			if err == nil {
+				mainData, err = s.parseAttachment2FormulaSheet(sheet, true)
+			}
+			mainData = filterCoverRecords(TableTypeAttachment2, mainData, batchExclusions[file.Name()])
+			var formulaErrors []ValidationError
+			if err == nil {
+				formulaErrors = s.validateFormulaCells(sheet.Cells, TableTypeAttachment2, mainData, "_excel_row")
+			}
 
 			if err != nil {
 				systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 解析失败: %v", file.Name(), err)})
+				reportEntries = append(reportEntries, newFileValidationReportEntry(file.Name(), fmt.Sprintf("文件解析失败: %v", err)))
 				failedFiles = append(failedFiles, filePath)
 				continue
 			}
 
+			// 批次内重复数据中未保留的记录不导入
+			if len(batchExclusions[file.Name()]) > 0 && len(mainData) == 0 {
+				os.Remove(filePath)
+				continue
+			}
+
 			// 4. 调用校验函数,对每一行数据验证
 			errors, hasDBError := s.validateAttachment2DataForModel(mainData, areaConfig)
+			errors = append(errors, formulaErrors...)
 
-			if len(errors) > 0 {
+			if hasBlockingErrors(errors) {
 				lastRowNumber := 0
 				if hasDBError && areaConfig.CountryName == "" {
 					lastRowNumber = s.getExcelRowNumber(mainData[len(mainData) - 1]) + 2
@@ -187,6 +251,7 @@ func (s *DataImportService) modelDataCheckAttachment2WithRecover() db.QueryResul
 					systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 添加错误信息失败: %s", file.Name(), msg)})
 					continue
 				}
+				reportEntries = append(reportEntries, s.buildValidationReportEntries(filePath, TableTypeAttachment2, errors, validationRecordSet{mainData, "_excel_row"})...)
 				failedFiles = append(failedFiles, filePath)
 				// 将验证错误转换为字符串用于显示
 				var errorMessages []string
@@ -197,6 +262,13 @@ func (s *DataImportService) modelDataCheckAttachment2WithRecover() db.QueryResul
 				continue
 			}
 
+			// 仅有警告的文件未经用户确认时不导入，保留文件等待确认
+			acknowledgement, acknowledged := checkWarningAcknowledged(warningAcks, file.Name(), errors)
+			if len(errors) > 0 && !acknowledged {
+				pendingWarnings[file.Name()] = WarningAcknowledgement{FileName: file.Name(), Warnings: getWarningMessages(errors)}
+				continue
+			}
+
 			// 5. 校验通过后,检查文件是否已导入
 			if s.isAttachment2FileImported(mainData) {
 				coverFiles = append(coverFiles, filePath)
@@ -204,21 +276,39 @@ func (s *DataImportService) modelDataCheckAttachment2WithRecover() db.QueryResul
 			}
 
 			// 6. 如果没有导入过,把数据保存到相应的数据库表中
+			s.setRecordsFileHash(mainData, s.getCacheFileHash(TableTypeAttachment2, file.Name()))
 			err = s.saveAttachment2DataForModel(mainData, areaConfig)
 
 			if err != nil {
 				systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 保存数据失败: %v", file.Name(), err)})
 			} else {
+				importedFiles = append(importedFiles, file.Name())
+				// 仅有警告的文件记录确认信息，标注警告后放入校验报告
+				if len(errors) > 0 {
+					s.recordWarningAcknowledgement(file.Name(), TableTypeAttachment2, acknowledgement)
+					if s.addValidationErrorsToExcelAttachment2(filePath, errors, 0) == nil {
+						reportEntries = append(reportEntries, s.buildValidationReportEntries(filePath, TableTypeAttachment2, errors, validationRecordSet{mainData, "_excel_row"})...)
+						warningFiles = append(warningFiles, filePath)
+						continue
+					}
+				}
 				// 删除该Excel文件
 				err = os.Remove(filePath)
 				if err != nil {
 					systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 删除失败: %v", file.Name(), err)})
 				}
-				importedFiles = append(importedFiles, file.Name())
 			}
 		}
 	}
 
+	// 批次内重复数据的处理结果只对本次校验有效
+	s.clearBatchDuplicateResolution(TableTypeAttachment2)
+
+	// 已导入文件的确认记录不再需要，只保留等待确认的文件
+	if err := s.saveWarningAcknowledgements(TableTypeAttachment2, pendingWarnings); err != nil {
+		systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("保存警告确认记录失败: %v", err)})
+	}
+
 	if !hasExcelFile {
 		result = db.QueryResult{
 			Ok:      false,
@@ -228,10 +318,11 @@ func (s *DataImportService) modelDataCheckAttachment2WithRecover() db.QueryResul
 	}
 
 	// 7. 把所有的模型验证失败的文件打个zip包
-	if len(failedFiles) > 0 {
-		err = s.createValidationErrorZip(failedFiles, TableTypeAttachment2, TableAttachment2)
-		// 删除失败文件
-		for _, filePath := range failedFiles {
+	reportFiles := append(append([]string{}, failedFiles...), warningFiles...)
+	if len(reportFiles) > 0 {
+		err = s.createValidationErrorZip(reportFiles, TableTypeAttachment2, TableAttachment2, reportEntries)
+		// 删除报告中的文件
+		for _, filePath := range reportFiles {
 			os.Remove(filePath)
 		}
 
@@ -246,6 +337,12 @@ func (s *DataImportService) modelDataCheckAttachment2WithRecover() db.QueryResul
 
 	// 8. 返回结果
 	message := fmt.Sprintf("处理完成。成功导入: %d 个文件，失败: %d 个文件", len(importedFiles), len(failedFiles))
+	if len(warningFiles) > 0 {
+		message += fmt.Sprintf("，其中 %d 个文件存在警告已确认导入", len(warningFiles))
+	}
+	if len(pendingWarnings) > 0 {
+		message += fmt.Sprintf("，%d 个文件存在警告，确认后导入", len(pendingWarnings))
+	}
 	if len(systemErrors) > 0 {
 		// 将验证错误转换为字符串用于显示
 		var errorMessages []string
@@ -261,9 +358,10 @@ func (s *DataImportService) modelDataCheckAttachment2WithRecover() db.QueryResul
 		Ok:      true,
 		Message: message,
 		Data: map[string]interface{}{
-			"cover_files":     coverFiles,                // 覆盖的文件
-			"hasExportReport": len(validationErrors) > 0, // 是否有导出报告
-			"hasFailedFiles":  len(failedFiles) > 0,      // 是否有失败的文件
+			"cover_files":     coverFiles,                                         // 覆盖的文件
+			"hasExportReport": len(validationErrors) > 0 || len(warningFiles) > 0, // 是否有导出报告
+			"hasFailedFiles":  len(failedFiles) > 0,                               // 是否有失败的文件
+			"warning_files":   getPendingWarningFiles(pendingWarnings),            // 存在警告等待确认的文件
 		},
 	}
 	return result
@@ -273,10 +371,15 @@ func (s *DataImportService) modelDataCheckAttachment2WithRecover() db.QueryResul
 func (s *DataImportService) validateAttachment2DataForModel(mainData []map[string]interface{}, areaConfig *EnhancedAreaConfig)( []ValidationError, bool) {
 	errors := []ValidationError{}
 
+	records, err := decodeRecords[db.CoalConsumptionReport](mainData)
+	if err != nil {
+		return []ValidationError{{RowNumber: 0, Message: fmt.Sprintf("数据格式错误: %v", err)}}, false
+	}
+
 	// 逐行校验数值字段、数据一致性和整体规则（行内字段间逻辑关系）
-	for _, data := range mainData {
+	for i, data := range records {
 		// 获取记录的实际Excel行号
-		excelRowNum := s.getExcelRowNumber(data)
+		excelRowNum := s.getExcelRowNumber(mainData[i])
 
 		// 数值字段校验
 		valueErrors := s.validateAttachment2NumericFields(data, excelRowNum)
@@ -285,6 +388,10 @@ func (s *DataImportService) validateAttachment2DataForModel(mainData []map[strin
 		// 数据一致性校验
 		consistencyErrors := s.validateAttachment2DataConsistency(data, excelRowNum)
 		errors = append(errors, consistencyErrors...)
+
+		// 软性规则校验（警告，确认后允许导入）
+		softErrors := s.validateAttachment2SoftRules(data, excelRowNum)
+		errors = append(errors, softErrors...)
 	}
 
 	// 数据库验证
@@ -295,166 +402,166 @@ func (s *DataImportService) validateAttachment2DataForModel(mainData []map[strin
 }
 
 // validateAttachment2NumericFields 校验附件2数值字段
-func (s *DataImportService) validateAttachment2NumericFields(data map[string]interface{}, rowNum int) []ValidationError {
+func (s *DataImportService) validateAttachment2NumericFields(data db.CoalConsumptionReport, rowNum int) []ValidationError {
 	errors := []ValidationError{}
 
 	// 1. 分品种煤炭消费摸底部分校验
-	totalCoal := s.parseFloat(s.getStringValue(data["total_coal"]))
-	rawCoal := s.parseFloat(s.getStringValue(data["raw_coal"]))
-	washedCoal := s.parseFloat(s.getStringValue(data["washed_coal"]))
-	otherCoal := s.parseFloat(s.getStringValue(data["other_coal"]))
+	totalCoal := s.parseFloat(data.TotalCoal)
+	rawCoal := s.parseFloat(data.RawCoal)
+	washedCoal := s.parseFloat(data.WashedCoal)
+	otherCoal := s.parseFloat(data.OtherCoal)
 
 	// ①≧0
 	if s.isIntegerLessThan(totalCoal, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "total_coal", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤合计不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤合计不能为负数", Cells: cells, RuleID: "A2-001"})
 	}
 	if s.isIntegerLessThan(rawCoal, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "raw_coal", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "原煤不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "原煤不能为负数", Cells: cells, RuleID: "A2-002"})
 	}
 	if s.isIntegerLessThan(washedCoal, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "washed_coal", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "洗精煤不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "洗精煤不能为负数", Cells: cells, RuleID: "A2-003"})
 	}
 	if s.isIntegerLessThan(otherCoal, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "other_coal", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "其他不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "其他不能为负数", Cells: cells, RuleID: "A2-004"})
 	}
 
 	// ②≦200000
 	if s.isIntegerGreaterThan(totalCoal, 200000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "total_coal", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤合计不能大于200000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤合计不能大于200000", Cells: cells, RuleID: "A2-005"})
 	}
 	if s.isIntegerGreaterThan(rawCoal, 200000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "raw_coal", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "原煤不能大于200000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "原煤不能大于200000", Cells: cells, RuleID: "A2-006"})
 	}
 	if s.isIntegerGreaterThan(washedCoal, 200000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "washed_coal", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "洗精煤不能大于200000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "洗精煤不能大于200000", Cells: cells, RuleID: "A2-007"})
 	}
 	if s.isIntegerGreaterThan(otherCoal, 200000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "other_coal", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "其他不能大于200000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "其他不能大于200000", Cells: cells, RuleID: "A2-008"})
 	}
 
 	// 2. 分用途煤炭消费摸底部分校验
-	powerGeneration := s.parseFloat(s.getStringValue(data["power_generation"]))
-	heating := s.parseFloat(s.getStringValue(data["heating"]))
-	coalWashing := s.parseFloat(s.getStringValue(data["coal_washing"]))
-	coking := s.parseFloat(s.getStringValue(data["coking"]))
-	oilRefining := s.parseFloat(s.getStringValue(data["oil_refining"]))
-	gasProduction := s.parseFloat(s.getStringValue(data["gas_production"]))
-	industry := s.parseFloat(s.getStringValue(data["industry"]))
-	rawMaterials := s.parseFloat(s.getStringValue(data["raw_materials"]))
-	otherUses := s.parseFloat(s.getStringValue(data["other_uses"]))
+	powerGeneration := s.parseFloat(data.PowerGeneration)
+	heating := s.parseFloat(data.Heating)
+	coalWashing := s.parseFloat(data.CoalWashing)
+	coking := s.parseFloat(data.Coking)
+	oilRefining := s.parseFloat(data.OilRefining)
+	gasProduction := s.parseFloat(data.GasProduction)
+	industry := s.parseFloat(data.Industry)
+	rawMaterials := s.parseFloat(data.RawMaterials)
+	otherUses := s.parseFloat(data.OtherUses)
 
 	// ①≧0
 	if s.isIntegerLessThan(powerGeneration, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "power_generation", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "火力发电不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "火力发电不能为负数", Cells: cells, RuleID: "A2-009"})
 	}
 	if s.isIntegerLessThan(heating, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "heating", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "供热不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "供热不能为负数", Cells: cells, RuleID: "A2-010"})
 	}
 	if s.isIntegerLessThan(coalWashing, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "coal_washing", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭洗选不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭洗选不能为负数", Cells: cells, RuleID: "A2-011"})
 	}
 	if s.isIntegerLessThan(coking, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "coking", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "炼焦不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "炼焦不能为负数", Cells: cells, RuleID: "A2-012"})
 	}
 	if s.isIntegerLessThan(oilRefining, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "oil_refining", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "炼油及煤制油不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "炼油及煤制油不能为负数", Cells: cells, RuleID: "A2-013"})
 	}
 	if s.isIntegerLessThan(gasProduction, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "gas_production", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "制气不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "制气不能为负数", Cells: cells, RuleID: "A2-014"})
 	}
 	if s.isIntegerLessThan(industry, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "industry", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "工业不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "工业不能为负数", Cells: cells, RuleID: "A2-015"})
 	}
 	if s.isIntegerLessThan(rawMaterials, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "raw_materials", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "工业（#用作原料、材料）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "工业（#用作原料、材料）不能为负数", Cells: cells, RuleID: "A2-016"})
 	}
 	if s.isIntegerLessThan(otherUses, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "other_uses", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "其他用途不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "其他用途不能为负数", Cells: cells, RuleID: "A2-017"})
 	}
 
 	// ②≦100000
 	if s.isIntegerGreaterThan(powerGeneration, 100000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "power_generation", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "火力发电不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "火力发电不能大于100000", Cells: cells, RuleID: "A2-018"})
 	}
 	if s.isIntegerGreaterThan(heating, 100000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "heating", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "供热不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "供热不能大于100000", Cells: cells, RuleID: "A2-019"})
 	}
 	if s.isIntegerGreaterThan(coalWashing, 100000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "coal_washing", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭洗选不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭洗选不能大于100000", Cells: cells, RuleID: "A2-020"})
 	}
 	if s.isIntegerGreaterThan(coking, 100000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "coking", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "炼焦不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "炼焦不能大于100000", Cells: cells, RuleID: "A2-021"})
 	}
 	if s.isIntegerGreaterThan(oilRefining, 100000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "oil_refining", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "炼油及煤制油不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "炼油及煤制油不能大于100000", Cells: cells, RuleID: "A2-022"})
 	}
 	if s.isIntegerGreaterThan(gasProduction, 100000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "gas_production", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "制气不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "制气不能大于100000", Cells: cells, RuleID: "A2-023"})
 	}
 	if s.isIntegerGreaterThan(industry, 100000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "industry", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "工业不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "工业不能大于100000", Cells: cells, RuleID: "A2-024"})
 	}
 	if s.isIntegerGreaterThan(rawMaterials, 100000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "raw_materials", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "工业（#用作原料、材料）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "工业（#用作原料、材料）不能大于100000", Cells: cells, RuleID: "A2-025"})
 	}
 	if s.isIntegerGreaterThan(otherUses, 100000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "other_uses", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "其他用途不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "其他用途不能大于100000", Cells: cells, RuleID: "A2-026"})
 	}
 
 	// 3. 焦炭消费摸底部分校验
-	coke := s.parseFloat(s.getStringValue(data["coke"]))
+	coke := s.parseFloat(data.Coke)
 
 	// ①≧0
 	if s.isIntegerLessThan(coke, 0) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "coke", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭不能为负数", Cells: cells, RuleID: "A2-027"})
 	}
 
 	// ②≦100000
 	if s.isIntegerGreaterThan(coke, 100000) {
 		cells := []string{s.getCellPosition(TableTypeAttachment2, "coke", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭不能大于100000", Cells: cells, RuleID: "A2-028"})
 	}
 
 	return errors
 }
 
 // validateAttachment2DataConsistency 校验附件2数据一致性（优化版本，使用定点数运算）
-func (s *DataImportService) validateAttachment2DataConsistency(data map[string]interface{}, rowNum int) []ValidationError {
+func (s *DataImportService) validateAttachment2DataConsistency(data db.CoalConsumptionReport, rowNum int) []ValidationError {
 	errors := []ValidationError{}
 
 	// 1. 分品种煤炭消费摸底部分
 	// ③煤合计=原煤+洗精煤+其他
-	totalCoal := s.parseFloat(s.getStringValue(data["total_coal"]))
-	rawCoal := s.parseFloat(s.getStringValue(data["raw_coal"]))
-	washedCoal := s.parseFloat(s.getStringValue(data["washed_coal"]))
-	otherCoal := s.parseFloat(s.getStringValue(data["other_coal"]))
+	totalCoal := s.parseFloat(data.TotalCoal)
+	rawCoal := s.parseFloat(data.RawCoal)
+	washedCoal := s.parseFloat(data.WashedCoal)
+	otherCoal := s.parseFloat(data.OtherCoal)
 
 	// 使用精度安全的浮点运算
 	expectedTotal := s.sumFloat64(rawCoal, washedCoal, otherCoal)
@@ -467,32 +574,32 @@ func (s *DataImportService) validateAttachment2DataConsistency(data map[string]i
 			s.getCellPosition(TableTypeAttachment2, "other_coal", rowNum),
 		}
 
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤合计应等于原煤+洗精煤+其他", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤合计应等于原煤+洗精煤+其他", Cells: cells, RuleID: "A2-029"})
 	}
 
 	// 2. 分用途煤炭消费摸底部分
 	// ③工业≧工业（#用作原料、材料）
-	industry := s.parseFloat(s.getStringValue(data["industry"]))
-	rawMaterials := s.parseFloat(s.getStringValue(data["raw_materials"]))
+	industry := s.parseFloat(data.Industry)
+	rawMaterials := s.parseFloat(data.RawMaterials)
 
 	if s.isIntegerLessThan(industry, rawMaterials) {
 		cells := []string{
 			s.getCellPosition(TableTypeAttachment2, "industry", rowNum),
 			s.getCellPosition(TableTypeAttachment2, "raw_materials", rowNum),
 		}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "工业应大于等于工业（#用作原料、材料）", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "工业应大于等于工业（#用作原料、材料）", Cells: cells, RuleID: "A2-030"})
 	}
 
 	// 3. 文件内整体校验
 	// ①分品种煤炭消费摸底与分用途煤炭消费摸底
 	// 煤合计≧能源加工转换+终端消费
-	powerGeneration := s.parseFloat(s.getStringValue(data["power_generation"]))
-	heating := s.parseFloat(s.getStringValue(data["heating"]))
-	coalWashing := s.parseFloat(s.getStringValue(data["coal_washing"]))
-	coking := s.parseFloat(s.getStringValue(data["coking"]))
-	oilRefining := s.parseFloat(s.getStringValue(data["oil_refining"]))
-	gasProduction := s.parseFloat(s.getStringValue(data["gas_production"]))
-	otherUses := s.parseFloat(s.getStringValue(data["other_uses"]))
+	powerGeneration := s.parseFloat(data.PowerGeneration)
+	heating := s.parseFloat(data.Heating)
+	coalWashing := s.parseFloat(data.CoalWashing)
+	coking := s.parseFloat(data.Coking)
+	oilRefining := s.parseFloat(data.OilRefining)
+	gasProduction := s.parseFloat(data.GasProduction)
+	otherUses := s.parseFloat(data.OtherUses)
 
 	// 能源加工转换 = 火力发电 + 供热 + 煤炭洗选 + 炼焦 + 炼油及煤制油 + 制气
 	energyConversion := s.sumFloat64(powerGeneration, heating, coalWashing, coking, oilRefining, gasProduction)
@@ -516,25 +623,41 @@ func (s *DataImportService) validateAttachment2DataConsistency(data map[string]i
 			s.getCellPosition(TableTypeAttachment2, "other_uses", rowNum),
 			s.getCellPosition(TableTypeAttachment2, "raw_materials", rowNum),
 		}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤合计应大于等于能源加工转换+终端消费-工业（#用作原料、材料）", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤合计应大于等于能源加工转换+终端消费-工业（#用作原料、材料）", Cells: cells, RuleID: "A2-031"})
 	}
 
 	return errors
 }
 
-// attachment2CacheManager 附件2缓存管理器实例
-var attachment2CacheManager *Attachment2CacheManager
+// validateAttachment2SoftRules 校验附件2软性规则，结果为警告级别，确认后允许导入
+func (s *DataImportService) validateAttachment2SoftRules(data db.CoalConsumptionReport, rowNum int) []ValidationError {
+	errors := []ValidationError{}
 
-// initAttachment2CacheManager 初始化附件2缓存管理器
-func (s *DataImportService) initAttachment2CacheManager() {
-	if attachment2CacheManager == nil {
-		attachment2CacheManager = NewAttachment2CacheManager(s)
-		// 预加载数据库缓存（只在第一次调用时从数据库加载，后续直接使用缓存）
-		attachment2CacheManager.PreloadOptimizedCache()
+	// 同一地区煤合计与上年相比变化超过50%
+	statYear, err := strconv.Atoi(data.StatDate)
+	if err != nil {
+		return errors
 	}
+	lastYear, exists, err := newRepository[db.CoalConsumptionReport](s).FindOne("province_name = ? AND city_name = ? AND country_name = ? AND stat_date = ?",
+		data.ProvinceName, data.CityName, data.CountryName, strconv.Itoa(statYear-1))
+	if err == nil && exists {
+		lastYearTotal := s.parseFloat(lastYear.TotalCoal)
+		if s.isYearOverYearJump(s.parseFloat(data.TotalCoal), lastYearTotal) {
+			cells := []string{s.getCellPosition(TableTypeAttachment2, "total_coal", rowNum)}
+			errors = append(errors, ValidationError{
+				RowNumber: rowNum,
+				Message:   fmt.Sprintf("煤合计与上年（%s）相比变化超过50%%，请核实", strconv.FormatFloat(lastYearTotal, 'f', -1, 64)),
+				Cells:     cells,
+				Severity:  SeverityWarning,
+				RuleID:    "A2-046",
+			})
+		}
+	}
+
+	return errors
 }
 
-// validateAttachment2DatabaseRules 校验附件2数据库验证规则（优化版本）
+// validateAttachment2DatabaseRules 校验附件2数据库验证规则，库中已有数据在SQL中解密汇总，本次导入覆盖的地区以新数据计入
 func (s *DataImportService) validateAttachment2DatabaseRules(mainData []map[string]interface{}, areaConfig *EnhancedAreaConfig) []ValidationError {
 	errors := []ValidationError{}
 
@@ -548,543 +671,63 @@ func (s *DataImportService) validateAttachment2DatabaseRules(mainData []map[stri
 		return errors
 	}
 
-	// 初始化下辖区县累加数据
-	subordinateData := &YearlyAggregatedData{
-		StatDate:     statDate,
-		TotalCoal:    0.0,
-		RawCoal:      0.0,
-		WashedCoal:   0.0,
-		OtherCoal:    0.0,
-		PowerGen:     0.0,
-		Heating:      0.0,
-		CoalWashing:  0.0,
-		Coking:       0.0,
-		OilRefining:  0.0,
-		GasProd:      0.0,
-		Industry:     0.0,
-		RawMaterials: 0.0,
-		OtherUses:    0.0,
-		Coke:         0.0,
-	}
-
-	// 1. 从年份累计缓存获取数据（数据库中已存在的下辖县区数据）
-	yearlyData, exists := attachment2CacheManager.GetYearlyAggregatedData(statDate)
-	if exists {
-		// 累加年份累计数据
-		subordinateData.TotalCoal = yearlyData.TotalCoal
-		subordinateData.RawCoal = yearlyData.RawCoal
-		subordinateData.WashedCoal = yearlyData.WashedCoal
-		subordinateData.OtherCoal = yearlyData.OtherCoal
-		subordinateData.PowerGen = yearlyData.PowerGen
-		subordinateData.Heating = yearlyData.Heating
-		subordinateData.CoalWashing = yearlyData.CoalWashing
-		subordinateData.Coking = yearlyData.Coking
-		subordinateData.OilRefining = yearlyData.OilRefining
-		subordinateData.GasProd = yearlyData.GasProd
-		subordinateData.Industry = yearlyData.Industry
-		subordinateData.RawMaterials = yearlyData.RawMaterials
-		subordinateData.OtherUses = yearlyData.OtherUses
-		subordinateData.Coke = yearlyData.Coke
-	}
-
-	// 计算当前本市数据总和（countryName为空的数据）
-	currentTotalCoal := 0.0
-	currentRawCoal := 0.0
-	currentWashedCoal := 0.0
-	currentOtherCoal := 0.0
-	currentPowerGeneration := 0.0
-	currentHeating := 0.0
-	currentCoalWashing := 0.0
-	currentCoking := 0.0
-	currentOilRefining := 0.0
-	currentGasProduction := 0.0
-	currentIndustry := 0.0
-	currentRawMaterials := 0.0
-	currentOtherUses := 0.0
-	currentCoke := 0.0
-
-	cityData, exists := attachment2CacheManager.GetCityData(areaConfig.ProvinceName, areaConfig.CityName, statDate)
-	if exists {
-		currentTotalCoal = cityData.TotalCoal
-		currentRawCoal = cityData.RawCoal
-		currentWashedCoal = cityData.WashedCoal
-		currentOtherCoal = cityData.OtherCoal
-		currentPowerGeneration = cityData.PowerGen
-		currentHeating = cityData.Heating
-		currentCoalWashing = cityData.CoalWashing
-		currentCoking = cityData.Coking
-		currentOilRefining = cityData.OilRefining
-		currentGasProduction = cityData.GasProd
-		currentIndustry = cityData.Industry
-		currentRawMaterials = cityData.RawMaterials
-		currentOtherUses = cityData.OtherUses
-		currentCoke = cityData.Coke
+	// 1. 库中已有的下辖区县数据合计（countryName不为空的数据）
+	subordinateTotals, err := s.queryAttachment2Totals("stat_date = ? AND COALESCE(country_name, '') != ''", mainData, statDate)
+	if err != nil {
+		return append(errors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("查询下级单位汇总数据失败: %v", err)})
+	}
+
+	// 2. 库中已有的本市数据合计（countryName为空的数据）
+	currentTotals, err := s.queryAttachment2Totals("stat_date = ? AND province_name = ? AND city_name = ? AND COALESCE(country_name, '') = ''",
+		mainData, statDate, areaConfig.ProvinceName, areaConfig.CityName)
+	if err != nil {
+		return append(errors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("查询本级单位汇总数据失败: %v", err)})
 	}
 
+	// 3. 累加本次导入的数据
 	var rowNumber = 8
 	for _, record := range mainData {
-		recordCountryName := s.getStringValue(record["country_name"])
-		recordProvinceName := s.getStringValue(record["province_name"])
-		recordCityName := s.getStringValue(record["city_name"])
-
-		totalCoal := s.parseFloat(s.getStringValue(record["total_coal"]))
-		rawCoal := s.parseFloat(s.getStringValue(record["raw_coal"]))
-		washedCoal := s.parseFloat(s.getStringValue(record["washed_coal"]))
-		otherCoal := s.parseFloat(s.getStringValue(record["other_coal"]))
-		powerGeneration := s.parseFloat(s.getStringValue(record["power_generation"]))
-		heating := s.parseFloat(s.getStringValue(record["heating"]))
-		coalWashing := s.parseFloat(s.getStringValue(record["coal_washing"]))
-		coking := s.parseFloat(s.getStringValue(record["coking"]))
-		oilRefining := s.parseFloat(s.getStringValue(record["oil_refining"]))
-		gasProduction := s.parseFloat(s.getStringValue(record["gas_production"]))
-		industry := s.parseFloat(s.getStringValue(record["industry"]))
-		rawMaterials := s.parseFloat(s.getStringValue(record["raw_materials"]))
-		otherUses := s.parseFloat(s.getStringValue(record["other_uses"]))
-		coke := s.parseFloat(s.getStringValue(record["coke"]))
-
-		// 检查是否已存在相同区县的数据，如果存在则先减去旧数据
-		if existingData, exists := attachment2CacheManager.GetImportedData(statDate, recordProvinceName, recordCityName, recordCountryName); exists {
-			// 从当前累加数据中减去已存在的旧数据
-			if recordCountryName == "" {
-				// 本市数据
-				currentTotalCoal = s.subtractFloat64(currentTotalCoal, existingData.TotalCoal)
-				currentRawCoal = s.subtractFloat64(currentRawCoal, existingData.RawCoal)
-				currentWashedCoal = s.subtractFloat64(currentWashedCoal, existingData.WashedCoal)
-				currentOtherCoal = s.subtractFloat64(currentOtherCoal, existingData.OtherCoal)
-				currentPowerGeneration = s.subtractFloat64(currentPowerGeneration, existingData.PowerGen)
-				currentHeating = s.subtractFloat64(currentHeating, existingData.Heating)
-				currentCoalWashing = s.subtractFloat64(currentCoalWashing, existingData.CoalWashing)
-				currentCoking = s.subtractFloat64(currentCoking, existingData.Coking)
-				currentOilRefining = s.subtractFloat64(currentOilRefining, existingData.OilRefining)
-				currentGasProduction = s.subtractFloat64(currentGasProduction, existingData.GasProd)
-				currentIndustry = s.subtractFloat64(currentIndustry, existingData.Industry)
-				currentRawMaterials = s.subtractFloat64(currentRawMaterials, existingData.RawMaterials)
-				currentOtherUses = s.subtractFloat64(currentOtherUses, existingData.OtherUses)
-				currentCoke = s.subtractFloat64(currentCoke, existingData.Coke)
-			} else {
-				// 下辖区县数据
-				subordinateData.TotalCoal = s.subtractFloat64(subordinateData.TotalCoal, existingData.TotalCoal)
-				subordinateData.RawCoal = s.subtractFloat64(subordinateData.RawCoal, existingData.RawCoal)
-				subordinateData.WashedCoal = s.subtractFloat64(subordinateData.WashedCoal, existingData.WashedCoal)
-				subordinateData.OtherCoal = s.subtractFloat64(subordinateData.OtherCoal, existingData.OtherCoal)
-				subordinateData.PowerGen = s.subtractFloat64(subordinateData.PowerGen, existingData.PowerGen)
-				subordinateData.Heating = s.subtractFloat64(subordinateData.Heating, existingData.Heating)
-				subordinateData.CoalWashing = s.subtractFloat64(subordinateData.CoalWashing, existingData.CoalWashing)
-				subordinateData.Coking = s.subtractFloat64(subordinateData.Coking, existingData.Coking)
-				subordinateData.OilRefining = s.subtractFloat64(subordinateData.OilRefining, existingData.OilRefining)
-				subordinateData.GasProd = s.subtractFloat64(subordinateData.GasProd, existingData.GasProd)
-				subordinateData.Industry = s.subtractFloat64(subordinateData.Industry, existingData.Industry)
-				subordinateData.RawMaterials = s.subtractFloat64(subordinateData.RawMaterials, existingData.RawMaterials)
-				subordinateData.OtherUses = s.subtractFloat64(subordinateData.OtherUses, existingData.OtherUses)
-				subordinateData.Coke = s.subtractFloat64(subordinateData.Coke, existingData.Coke)
-			}
-		}
-
-		// 累加新数据
-		if recordCountryName == "" {
+		if s.getStringValue(record["country_name"]) == "" {
 			rowNumber = s.getExcelRowNumber(record)
-			currentTotalCoal = s.addFloat64(currentTotalCoal, totalCoal)
-			currentRawCoal = s.addFloat64(currentRawCoal, rawCoal)
-			currentWashedCoal = s.addFloat64(currentWashedCoal, washedCoal)
-			currentOtherCoal = s.addFloat64(currentOtherCoal, otherCoal)
-			currentPowerGeneration = s.addFloat64(currentPowerGeneration, powerGeneration)
-			currentHeating = s.addFloat64(currentHeating, heating)
-			currentCoalWashing = s.addFloat64(currentCoalWashing, coalWashing)
-			currentCoking = s.addFloat64(currentCoking, coking)
-			currentOilRefining = s.addFloat64(currentOilRefining, oilRefining)
-			currentGasProduction = s.addFloat64(currentGasProduction, gasProduction)
-			currentIndustry = s.addFloat64(currentIndustry, industry)
-			currentRawMaterials = s.addFloat64(currentRawMaterials, rawMaterials)
-			currentOtherUses = s.addFloat64(currentOtherUses, otherUses)
-			currentCoke = s.addFloat64(currentCoke, coke)
+			currentTotals.add(s, record)
 		} else {
-			subordinateData.TotalCoal = s.addFloat64(subordinateData.TotalCoal, totalCoal)
-			subordinateData.RawCoal = s.addFloat64(subordinateData.RawCoal, rawCoal)
-			subordinateData.WashedCoal = s.addFloat64(subordinateData.WashedCoal, washedCoal)
-			subordinateData.OtherCoal = s.addFloat64(subordinateData.OtherCoal, otherCoal)
-			subordinateData.PowerGen = s.addFloat64(subordinateData.PowerGen, powerGeneration)
-			subordinateData.Heating = s.addFloat64(subordinateData.Heating, heating)
-			subordinateData.CoalWashing = s.addFloat64(subordinateData.CoalWashing, coalWashing)
-			subordinateData.Coking = s.addFloat64(subordinateData.Coking, coking)
-			subordinateData.OilRefining = s.addFloat64(subordinateData.OilRefining, oilRefining)
-			subordinateData.GasProd = s.addFloat64(subordinateData.GasProd, gasProduction)
-			subordinateData.Industry = s.addFloat64(subordinateData.Industry, industry)
-			subordinateData.RawMaterials = s.addFloat64(subordinateData.RawMaterials, rawMaterials)
-			subordinateData.OtherUses = s.addFloat64(subordinateData.OtherUses, otherUses)
-			subordinateData.Coke = s.addFloat64(subordinateData.Coke, coke)
+			subordinateTotals.add(s, record)
 		}
 	}
 
-	if currentTotalCoal == 0 && currentRawCoal == 0{
+	if currentTotals["total_coal"] == 0 && currentTotals["raw_coal"] == 0 {
 		return errors
 	}
-	
 
 	// 校验规则：同年份本单位所导入数值*120%应≥下级单位相加之和
 	threshold := 1.2
-
-
-	// 校验各个字段（使用下辖区县累加数据）
-	// 计算 currentTotalCoal * threshold
-	currentTotalCoalThreshold := s.multiplyFloat64(currentTotalCoal, threshold)
-	if s.isIntegerLessThan(currentTotalCoalThreshold, subordinateData.TotalCoal) {
-		cells := s.generateAllRelatedCells("total_coal", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "煤合计数值*120%应大于等于下级单位相加之和"})
-	}
-
-	currentRawCoalThreshold := s.multiplyFloat64(currentRawCoal, threshold)
-	if s.isIntegerLessThan(currentRawCoalThreshold, subordinateData.RawCoal) {
-		cells := s.generateAllRelatedCells("raw_coal", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "原煤数值*120%应大于等于下级单位相加之和"})
-	}
-
-	currentWashedCoalThreshold := s.multiplyFloat64(currentWashedCoal, threshold)
-	if s.isIntegerLessThan(currentWashedCoalThreshold, subordinateData.WashedCoal) {
-		cells := s.generateAllRelatedCells("washed_coal", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "洗精煤数值*120%应大于等于下级单位相加之和"})
-	}
-
-	currentOtherCoalThreshold := s.multiplyFloat64(currentOtherCoal, threshold)
-	if s.isIntegerLessThan(currentOtherCoalThreshold, subordinateData.OtherCoal) {
-		cells := s.generateAllRelatedCells("other_coal", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "其他数值*120%应大于等于下级单位相加之和"})
-	}
-
-	currentPowerGenerationThreshold := s.multiplyFloat64(currentPowerGeneration, threshold)
-	if s.isIntegerLessThan(currentPowerGenerationThreshold, subordinateData.PowerGen) {
-		cells := s.generateAllRelatedCells("power_generation", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "火力发电数值*120%应大于等于下级单位相加之和"})
-	}
-
-	currentHeatingThreshold := s.multiplyFloat64(currentHeating, threshold)
-	if s.isIntegerLessThan(currentHeatingThreshold, subordinateData.Heating) {
-		cells := s.generateAllRelatedCells("heating", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "供热数值*120%应大于等于下级单位相加之和"})
-	}
-
-	currentCoalWashingThreshold := s.multiplyFloat64(currentCoalWashing, threshold)
-	if s.isIntegerLessThan(currentCoalWashingThreshold, subordinateData.CoalWashing) {
-		cells := s.generateAllRelatedCells("coal_washing", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "煤炭洗选数值*120%应大于等于下级单位相加之和"})
-	}
-
-	currentCokingThreshold := s.multiplyFloat64(currentCoking, threshold)
-	if s.isIntegerLessThan(currentCokingThreshold, subordinateData.Coking) {
-		cells := s.generateAllRelatedCells("coking", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "炼焦数值*120%应大于等于下级单位相加之和"})
-	}
-
-	currentOilRefiningThreshold := s.multiplyFloat64(currentOilRefining, threshold)
-	if s.isIntegerLessThan(currentOilRefiningThreshold, subordinateData.OilRefining) {
-		cells := s.generateAllRelatedCells("oil_refining", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "炼油及煤制油数值*120%应大于等于下级单位相加之和"})
-	}
-
-	currentGasProductionThreshold := s.multiplyFloat64(currentGasProduction, threshold)
-	if s.isIntegerLessThan(currentGasProductionThreshold, subordinateData.GasProd) {
-		cells := s.generateAllRelatedCells("gas_production", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "制气数值*120%应大于等于下级单位相加之和"})
-	}
-
-	currentIndustryThreshold := s.multiplyFloat64(currentIndustry, threshold)
-	if s.isIntegerLessThan(currentIndustryThreshold, subordinateData.Industry) {
-		cells := s.generateAllRelatedCells("industry", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "工业数值*120%应大于等于下级单位相加之和"})
-	}
-
-	currentRawMaterialsThreshold := s.multiplyFloat64(currentRawMaterials, threshold)
-	if s.isIntegerLessThan(currentRawMaterialsThreshold, subordinateData.RawMaterials) {
-		cells := s.generateAllRelatedCells("raw_materials", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "工业（#用作原料、材料）数值*120%应大于等于下级单位相加之和"})
-	}
-
-	currentOtherUsesThreshold := s.multiplyFloat64(currentOtherUses, threshold)
-	if s.isIntegerLessThan(currentOtherUsesThreshold, subordinateData.OtherUses) {
-		cells := s.generateAllRelatedCells("other_uses", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "其他用途数值*120%应大于等于下级单位相加之和"})
-	}
-
-	currentCokeThreshold := s.multiplyFloat64(currentCoke, threshold)
-	if s.isIntegerLessThan(currentCokeThreshold, subordinateData.Coke) {
-		cells := s.generateAllRelatedCells("coke", mainData)
-		errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: "焦炭数值*120%应大于等于下级单位相加之和"})
+	for _, field := range attachment2SumFields {
+		if s.isIntegerLessThan(s.multiplyFloat64(currentTotals[field.Field], threshold), subordinateTotals[field.Field]) {
+			cells := s.generateAllRelatedCells(field.Field, mainData)
+			errors = append(errors, ValidationError{RowNumber: rowNumber, Cells: cells, Message: field.Label + "数值*120%应大于等于下级单位相加之和", RuleID: field.RuleID})
+		}
 	}
 
 	return errors
 }
 
-// coverAttachment2Data 覆盖附件2数据
+// coverAttachment2Data 覆盖附件2数据，年份和地区相同的数据按自然键原地更新
 func (s *DataImportService) coverAttachment2Data(mainData []map[string]interface{}, fileName string, areaConfig *EnhancedAreaConfig) error {
 	if len(mainData) == 0 {
 		return fmt.Errorf("数据为空")
 	}
 
-	// 逐行检查，根据年份+省+市+县检查是否已导入
-	for _, record := range mainData {
-		statDate := s.getStringValue(record["stat_date"])
-		provinceName := s.getStringValue(record["province_name"])
-		cityName := s.getStringValue(record["city_name"])
-		countryName := s.getStringValue(record["country_name"])
-
-		// 先尝试更新，通过受影响行数判断是否存在
-		affectedRows, err := s.updateAttachment2DataByRegionAndYear(statDate, provinceName, cityName, countryName, record)
-		if err != nil {
-			return fmt.Errorf("更新数据失败: %v", err)
-		}
-
-		// 如果受影响行数为0，说明数据不存在，执行插入
-		if affectedRows == 0 {
-			err = s.insertAttachment2Data(record)
-			if err != nil {
-				return fmt.Errorf("插入数据失败: %v", err)
-			}
-			// 插入新数据后，更新缓存
-			s.updateCacheWithNewData(statDate, provinceName, cityName, countryName, record)
-		}
-
-		// 注意：这里不再调用 UpdateOptimizedCacheAfterUpload，因为已经在上面分别处理了
-	}
-
-	return nil
-}
-
-// updateAttachment2DataByRegionAndYear 根据地区和时间更新附件2数据
-func (s *DataImportService) updateAttachment2DataByRegionAndYear(statDate, provinceName, cityName, countryName string, record map[string]interface{}) (int64, error) {
-	// 对数值字段进行SM4加密
-	encryptedValues := s.encryptAttachment2NumericFields(record)
-
-	query := `UPDATE coal_consumption_report SET
-		stat_date = ?, province_name = ?, city_name = ?, country_name = ?, unit_level = ?,
-		total_coal = ?, raw_coal = ?, washed_coal = ?, other_coal = ?,
-		power_generation = ?, heating = ?, coal_washing = ?, coking = ?,
-		oil_refining = ?, gas_production = ?, industry = ?, raw_materials = ?,
-		other_uses = ?, coke = ?, is_confirm = ?
-		WHERE stat_date = ? AND province_name = ? AND city_name = ? AND country_name = ?`
-
-	// 计算unit_level
-	unitLevel := s.calculateUnitLevel(provinceName, cityName, countryName)
-
-	result, err := s.app.GetDB().Exec(query,
-		statDate, provinceName, cityName, countryName, unitLevel,
-		encryptedValues["total_coal"], encryptedValues["raw_coal"], encryptedValues["washed_coal"],
-		encryptedValues["other_coal"], encryptedValues["power_generation"], encryptedValues["heating"],
-		encryptedValues["coal_washing"], encryptedValues["coking"], encryptedValues["oil_refining"],
-		encryptedValues["gas_production"], encryptedValues["industry"], encryptedValues["raw_materials"],
-		encryptedValues["other_uses"], encryptedValues["coke"], EncryptedZero, statDate, provinceName, cityName, countryName)
-
-	if err != nil {
-		return 0, err
-	}
-
-	// 从QueryResult中获取受影响的行数
-	var affectedRows int64 = 0
-	if result.Ok && result.Data != nil {
-		if dataMap, ok := result.Data.(map[string]interface{}); ok {
-			if rowsAffected, exists := dataMap["rowsAffected"]; exists {
-				if affected, ok := rowsAffected.(int64); ok {
-					affectedRows = affected
-				}
-			}
-		}
-	}
-
-	// 如果更新成功，更新缓存（从缓存中获取旧数据）
-	if affectedRows > 0 {
-		s.updateAttachment2DatabaseCacheForUpdate(statDate, provinceName, cityName, countryName, nil, record)
-	}
-
-	return affectedRows, nil
-}
-
-
-// updateAttachment2DatabaseCacheForUpdate 更新附件2数据库缓存（用于UPDATE操作）
-func (s *DataImportService) updateAttachment2DatabaseCacheForUpdate(statDate, provinceName, cityName, countryName string, oldRecord, newRecord map[string]interface{}) {
-	// 从缓存中获取旧数据，而不是从数据库读取
-	oldData, exists := attachment2CacheManager.GetImportedData(statDate, provinceName, cityName, countryName)
-	if !exists {
-		// 如果缓存中没有旧数据，说明这是新数据，直接更新缓存
-		s.updateCacheWithNewData(statDate, provinceName, cityName, countryName, newRecord)
-		return
-	}
-
-	// 解析新数据
-	newTotalCoal := s.parseFloat(s.getStringValue(newRecord["total_coal"]))
-	newRawCoal := s.parseFloat(s.getStringValue(newRecord["raw_coal"]))
-	newWashedCoal := s.parseFloat(s.getStringValue(newRecord["washed_coal"]))
-	newOtherCoal := s.parseFloat(s.getStringValue(newRecord["other_coal"]))
-	newPowerGeneration := s.parseFloat(s.getStringValue(newRecord["power_generation"]))
-	newHeating := s.parseFloat(s.getStringValue(newRecord["heating"]))
-	newCoalWashing := s.parseFloat(s.getStringValue(newRecord["coal_washing"]))
-	newCoking := s.parseFloat(s.getStringValue(newRecord["coking"]))
-	newOilRefining := s.parseFloat(s.getStringValue(newRecord["oil_refining"]))
-	newGasProduction := s.parseFloat(s.getStringValue(newRecord["gas_production"]))
-	newIndustry := s.parseFloat(s.getStringValue(newRecord["industry"]))
-	newRawMaterials := s.parseFloat(s.getStringValue(newRecord["raw_materials"]))
-	newOtherUses := s.parseFloat(s.getStringValue(newRecord["other_uses"]))
-	newCoke := s.parseFloat(s.getStringValue(newRecord["coke"]))
-
-	// 计算差值（新数据 - 旧数据）
-	diffTotalCoal := s.subtractFloat64(newTotalCoal, oldData.TotalCoal)
-	diffRawCoal := s.subtractFloat64(newRawCoal, oldData.RawCoal)
-	diffWashedCoal := s.subtractFloat64(newWashedCoal, oldData.WashedCoal)
-	diffOtherCoal := s.subtractFloat64(newOtherCoal, oldData.OtherCoal)
-	diffPowerGeneration := s.subtractFloat64(newPowerGeneration, oldData.PowerGen)
-	diffHeating := s.subtractFloat64(newHeating, oldData.Heating)
-	diffCoalWashing := s.subtractFloat64(newCoalWashing, oldData.CoalWashing)
-	diffCoking := s.subtractFloat64(newCoking, oldData.Coking)
-	diffOilRefining := s.subtractFloat64(newOilRefining, oldData.OilRefining)
-	diffGasProduction := s.subtractFloat64(newGasProduction, oldData.GasProd)
-	diffIndustry := s.subtractFloat64(newIndustry, oldData.Industry)
-	diffRawMaterials := s.subtractFloat64(newRawMaterials, oldData.RawMaterials)
-	diffOtherUses := s.subtractFloat64(newOtherUses, oldData.OtherUses)
-	diffCoke := s.subtractFloat64(newCoke, oldData.Coke)
-
-	// 更新年份累计缓存（如果是下辖县区数据）
-	if countryName != "" {
-		yearlyData, exists := attachment2CacheManager.GetYearlyAggregatedData(statDate)
-		if exists {
-			// 减去旧数据，加上新数据（即加上差值）
-			yearlyData.TotalCoal = s.addFloat64(yearlyData.TotalCoal, diffTotalCoal)
-			yearlyData.RawCoal = s.addFloat64(yearlyData.RawCoal, diffRawCoal)
-			yearlyData.WashedCoal = s.addFloat64(yearlyData.WashedCoal, diffWashedCoal)
-			yearlyData.OtherCoal = s.addFloat64(yearlyData.OtherCoal, diffOtherCoal)
-			yearlyData.PowerGen = s.addFloat64(yearlyData.PowerGen, diffPowerGeneration)
-			yearlyData.Heating = s.addFloat64(yearlyData.Heating, diffHeating)
-			yearlyData.CoalWashing = s.addFloat64(yearlyData.CoalWashing, diffCoalWashing)
-			yearlyData.Coking = s.addFloat64(yearlyData.Coking, diffCoking)
-			yearlyData.OilRefining = s.addFloat64(yearlyData.OilRefining, diffOilRefining)
-			yearlyData.GasProd = s.addFloat64(yearlyData.GasProd, diffGasProduction)
-			yearlyData.Industry = s.addFloat64(yearlyData.Industry, diffIndustry)
-			yearlyData.RawMaterials = s.addFloat64(yearlyData.RawMaterials, diffRawMaterials)
-			yearlyData.OtherUses = s.addFloat64(yearlyData.OtherUses, diffOtherUses)
-			yearlyData.Coke = s.addFloat64(yearlyData.Coke, diffCoke)
-		}
-	}
-
-	// 更新市数据缓存（如果是本市数据）
-	if countryName == "" {
-		cityData, exists := attachment2CacheManager.GetCityData(provinceName, cityName, statDate)
-		if exists {
-			// 减去旧数据，加上新数据（即加上差值）
-			cityData.TotalCoal = s.addFloat64(cityData.TotalCoal, diffTotalCoal)
-			cityData.RawCoal = s.addFloat64(cityData.RawCoal, diffRawCoal)
-			cityData.WashedCoal = s.addFloat64(cityData.WashedCoal, diffWashedCoal)
-			cityData.OtherCoal = s.addFloat64(cityData.OtherCoal, diffOtherCoal)
-			cityData.PowerGen = s.addFloat64(cityData.PowerGen, diffPowerGeneration)
-			cityData.Heating = s.addFloat64(cityData.Heating, diffHeating)
-			cityData.CoalWashing = s.addFloat64(cityData.CoalWashing, diffCoalWashing)
-			cityData.Coking = s.addFloat64(cityData.Coking, diffCoking)
-			cityData.OilRefining = s.addFloat64(cityData.OilRefining, diffOilRefining)
-			cityData.GasProd = s.addFloat64(cityData.GasProd, diffGasProduction)
-			cityData.Industry = s.addFloat64(cityData.Industry, diffIndustry)
-			cityData.RawMaterials = s.addFloat64(cityData.RawMaterials, diffRawMaterials)
-			cityData.OtherUses = s.addFloat64(cityData.OtherUses, diffOtherUses)
-			cityData.Coke = s.addFloat64(cityData.Coke, diffCoke)
-		}
-	}
-
-	// 更新已导入数据缓存
-	newIndicatorData := &YearlyAggregatedData{
-		StatDate:     statDate,
-		TotalCoal:    newTotalCoal,
-		RawCoal:      newRawCoal,
-		WashedCoal:   newWashedCoal,
-		OtherCoal:    newOtherCoal,
-		PowerGen:     newPowerGeneration,
-		Heating:      newHeating,
-		CoalWashing:  newCoalWashing,
-		Coking:       newCoking,
-		OilRefining:  newOilRefining,
-		GasProd:      newGasProduction,
-		Industry:     newIndustry,
-		RawMaterials: newRawMaterials,
-		OtherUses:    newOtherUses,
-		Coke:         newCoke,
-	}
-	attachment2CacheManager.SetImportedData(statDate, provinceName, cityName, countryName, newIndicatorData)
-}
-
-// updateCacheWithNewData 更新缓存中的新数据（用于INSERT操作）
-func (s *DataImportService) updateCacheWithNewData(statDate, provinceName, cityName, countryName string, record map[string]interface{}) {
-	// 解析新数据
-	newTotalCoal := s.parseFloat(s.getStringValue(record["total_coal"]))
-	newRawCoal := s.parseFloat(s.getStringValue(record["raw_coal"]))
-	newWashedCoal := s.parseFloat(s.getStringValue(record["washed_coal"]))
-	newOtherCoal := s.parseFloat(s.getStringValue(record["other_coal"]))
-	newPowerGeneration := s.parseFloat(s.getStringValue(record["power_generation"]))
-	newHeating := s.parseFloat(s.getStringValue(record["heating"]))
-	newCoalWashing := s.parseFloat(s.getStringValue(record["coal_washing"]))
-	newCoking := s.parseFloat(s.getStringValue(record["coking"]))
-	newOilRefining := s.parseFloat(s.getStringValue(record["oil_refining"]))
-	newGasProduction := s.parseFloat(s.getStringValue(record["gas_production"]))
-	newIndustry := s.parseFloat(s.getStringValue(record["industry"]))
-	newRawMaterials := s.parseFloat(s.getStringValue(record["raw_materials"]))
-	newOtherUses := s.parseFloat(s.getStringValue(record["other_uses"]))
-	newCoke := s.parseFloat(s.getStringValue(record["coke"]))
-
-	// 更新年份累计缓存（如果是下辖县区数据）
-	if countryName != "" {
-		yearlyData, exists := attachment2CacheManager.GetYearlyAggregatedData(statDate)
-		if exists {
-			// 累加新数据
-			yearlyData.TotalCoal = s.addFloat64(yearlyData.TotalCoal, newTotalCoal)
-			yearlyData.RawCoal = s.addFloat64(yearlyData.RawCoal, newRawCoal)
-			yearlyData.WashedCoal = s.addFloat64(yearlyData.WashedCoal, newWashedCoal)
-			yearlyData.OtherCoal = s.addFloat64(yearlyData.OtherCoal, newOtherCoal)
-			yearlyData.PowerGen = s.addFloat64(yearlyData.PowerGen, newPowerGeneration)
-			yearlyData.Heating = s.addFloat64(yearlyData.Heating, newHeating)
-			yearlyData.CoalWashing = s.addFloat64(yearlyData.CoalWashing, newCoalWashing)
-			yearlyData.Coking = s.addFloat64(yearlyData.Coking, newCoking)
-			yearlyData.OilRefining = s.addFloat64(yearlyData.OilRefining, newOilRefining)
-			yearlyData.GasProd = s.addFloat64(yearlyData.GasProd, newGasProduction)
-			yearlyData.Industry = s.addFloat64(yearlyData.Industry, newIndustry)
-			yearlyData.RawMaterials = s.addFloat64(yearlyData.RawMaterials, newRawMaterials)
-			yearlyData.OtherUses = s.addFloat64(yearlyData.OtherUses, newOtherUses)
-			yearlyData.Coke = s.addFloat64(yearlyData.Coke, newCoke)
-		}
+	// 已报送的年份不允许写入数据
+	if err := s.checkRecordsWritable(mainData); err != nil {
+		return err
 	}
 
-	// 更新市数据缓存（如果是本市数据）
-	if countryName == "" {
-		cityData, exists := attachment2CacheManager.GetCityData(provinceName, cityName, statDate)
-		if exists {
-			// 累加新数据
-			cityData.TotalCoal = s.addFloat64(cityData.TotalCoal, newTotalCoal)
-			cityData.RawCoal = s.addFloat64(cityData.RawCoal, newRawCoal)
-			cityData.WashedCoal = s.addFloat64(cityData.WashedCoal, newWashedCoal)
-			cityData.OtherCoal = s.addFloat64(cityData.OtherCoal, newOtherCoal)
-			cityData.PowerGen = s.addFloat64(cityData.PowerGen, newPowerGeneration)
-			cityData.Heating = s.addFloat64(cityData.Heating, newHeating)
-			cityData.CoalWashing = s.addFloat64(cityData.CoalWashing, newCoalWashing)
-			cityData.Coking = s.addFloat64(cityData.Coking, newCoking)
-			cityData.OilRefining = s.addFloat64(cityData.OilRefining, newOilRefining)
-			cityData.GasProd = s.addFloat64(cityData.GasProd, newGasProduction)
-			cityData.Industry = s.addFloat64(cityData.Industry, newIndustry)
-			cityData.RawMaterials = s.addFloat64(cityData.RawMaterials, newRawMaterials)
-			cityData.OtherUses = s.addFloat64(cityData.OtherUses, newOtherUses)
-			cityData.Coke = s.addFloat64(cityData.Coke, newCoke)
-		}
+	if err := s.upsertAttachment2Data(mainData); err != nil {
+		return err
 	}
 
-	// 存储新数据到已导入缓存
-	newIndicatorData := &YearlyAggregatedData{
-		StatDate:     statDate,
-		TotalCoal:    newTotalCoal,
-		RawCoal:      newRawCoal,
-		WashedCoal:   newWashedCoal,
-		OtherCoal:    newOtherCoal,
-		PowerGen:     newPowerGeneration,
-		Heating:      newHeating,
-		CoalWashing:  newCoalWashing,
-		Coking:       newCoking,
-		OilRefining:  newOilRefining,
-		GasProd:      newGasProduction,
-		Industry:     newIndustry,
-		RawMaterials: newRawMaterials,
-		OtherUses:    newOtherUses,
-		Coke:         newCoke,
-	}
-	attachment2CacheManager.SetImportedData(statDate, provinceName, cityName, countryName, newIndicatorData)
+	s.advanceSubmissionStatus(s.collectStatDates(mainData), SubmissionEventImport)
+	return nil
 }
 
 // calculateUnitLevel 计算单位等级
@@ -1106,14 +749,16 @@ func (s *DataImportService) calculateUnitLevel(provinceName, cityName, countryNa
 // isAttachment2FileImported 检查附件2文件是否已导入
 func (s *DataImportService) isAttachment2FileImported(mainData []map[string]interface{}) bool {
 	// 按Excel数据逐行检查，根据年份+省+市+县检查是否已导入
+	repo := newRepository[db.CoalConsumptionReport](s)
 	for _, record := range mainData {
 		statDate := s.getStringValue(record["stat_date"])
 		provinceName := s.getStringValue(record["province_name"])
 		cityName := s.getStringValue(record["city_name"])
 		countryName := s.getStringValue(record["country_name"])
 
-		// 使用新的优化缓存结构检查数据是否存在
-		if attachment2CacheManager.IsDataExistsInOptimizedCache(statDate, provinceName, cityName, countryName) {
+		count, err := repo.Count("stat_date = ? AND COALESCE(province_name, '') = ? AND COALESCE(city_name, '') = ? AND COALESCE(country_name, '') = ?",
+			statDate, provinceName, cityName, countryName)
+		if err == nil && count > 0 {
 			return true // 检查到立即停止表示已导入
 		}
 	}
@@ -1121,56 +766,44 @@ func (s *DataImportService) isAttachment2FileImported(mainData []map[string]inte
 }
 
 
-// saveAttachment2DataForModel 模型校验专用保存附件2数据到数据库（只使用INSERT）
+// saveAttachment2DataForModel 模型校验专用保存附件2数据到数据库，年份和地区相同的数据已存在时覆盖
 func (s *DataImportService) saveAttachment2DataForModel(mainData []map[string]interface{}, areaConfig *EnhancedAreaConfig) error {
-	for _, record := range mainData {
-
-		// 直接执行插入操作，不检查数据是否已存在
-		err := s.insertAttachment2Data(record)
-
-		if err != nil {
-			return err
-		}
-
+	// 已报送的年份不允许写入数据
+	if err := s.checkRecordsWritable(mainData); err != nil {
+		return err
 	}
 
-	// 获取区域配置并更新优化缓存
-	statDate := s.getStringValue(mainData[0]["stat_date"])
-	s.UpdateOptimizedCacheAfterUpload(areaConfig, statDate, mainData)
+	if err := s.upsertAttachment2Data(mainData); err != nil {
+		return err
+	}
 
+	s.advanceSubmissionStatus(s.collectStatDates(mainData), SubmissionEventImport)
 	return nil
 }
 
-// insertAttachment2Data 插入附件2数据
-func (s *DataImportService) insertAttachment2Data(record map[string]interface{}) error {
-
-	record["obj_id"] = s.generateUUID()
-	record["create_time"] = time.Now().UnixMilli()
-
-	// 对数值字段进行SM4加密
-	encryptedValues := s.encryptAttachment2NumericFields(record)
-
-	// 计算unit_level
-	unitLevel := s.calculateUnitLevel(s.getStringValue(record["province_name"]), s.getStringValue(record["city_name"]), s.getStringValue(record["country_name"]))
-
-	query := `INSERT INTO coal_consumption_report (
-		obj_id, stat_date, province_name, city_name, country_name, unit_level, total_coal, raw_coal,
-		washed_coal, other_coal, power_generation, heating, coal_washing, coking,
-		oil_refining, gas_production, industry, raw_materials, other_uses, coke, create_time, create_user, is_check
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+// upsertAttachment2Data 在同一事务中按年份和地区插入或更新附件2数据，已存在的数据沿用原记录的obj_id和创建时间
+func (s *DataImportService) upsertAttachment2Data(mainData []map[string]interface{}) error {
+	records, err := decodeRecords[db.CoalConsumptionReport](mainData)
+	if err != nil {
+		return fmt.Errorf("数据格式错误: %v", err)
+	}
+	createTime := time.Now().UnixMilli()
+	createUser := s.app.GetAreaStr()
+	for i := range records {
+		records[i].ObjID = s.generateUUID()
+		records[i].UnitLevel = s.calculateUnitLevel(records[i].ProvinceName, records[i].CityName, records[i].CountryName)
+		records[i].CreateTime = createTime
+		records[i].CreateUser = createUser
+		records[i].IsConfirm = "0"
+		records[i].IsCheck = "1"
+	}
 
-	_, err := s.app.GetDB().Exec(query,
-		record["obj_id"], record["stat_date"], record["province_name"], record["city_name"],
-		record["country_name"], unitLevel, encryptedValues["total_coal"], encryptedValues["raw_coal"], encryptedValues["washed_coal"],
-		encryptedValues["other_coal"], encryptedValues["power_generation"], encryptedValues["heating"], encryptedValues["coal_washing"],
-		encryptedValues["coking"], encryptedValues["oil_refining"], encryptedValues["gas_production"], encryptedValues["industry"],
-		encryptedValues["raw_materials"], encryptedValues["other_uses"], encryptedValues["coke"], record["create_time"], s.app.GetAreaStr(), EncryptedOne)
+	err = s.app.GetDB().WithTx(func(tx *sql.Tx) error {
+		return upsertRecordsTx(tx, newRepository[db.CoalConsumptionReport](s), records, "obj_id", "create_time")
+	})
 	if err != nil {
 		return fmt.Errorf("保存数据失败: %v", err)
 	}
-
-	// 注意：新的优化缓存结构会在预加载时自动处理，无需手动更新
-
 	return nil
 }
 
@@ -1184,25 +817,25 @@ func (s *DataImportService) addValidationErrorsToExcelAttachment2(filePath strin
 
 	// 创建错误信息映射
 	errorMap := make(map[int]string)
-	// 收集所有需要高亮的单元格
-	var allCells []string
+	// 记录每行最严重的级别，用于设置错误信息列的颜色
+	severityMap := make(map[int]string)
 
 	for _, err := range errors {
+		message := formatValidationMessage(err)
 		// 如果该行已有错误信息，则追加
 		if existing, exists := errorMap[err.RowNumber]; exists {
-			errorMap[err.RowNumber] = existing + "; " + err.Message
+			errorMap[err.RowNumber] = existing + "; " + message
 		} else {
-			errorMap[err.RowNumber] = err.Message
+			errorMap[err.RowNumber] = message
 		}
 
-		// 收集涉及到的单元格
-		if err.Cells != nil {
-			allCells = append(allCells, err.Cells...)
+		if current, exists := severityMap[err.RowNumber]; !exists || getSeverityRank(err.Severity) > getSeverityRank(current) {
+			severityMap[err.RowNumber] = err.Severity
 		}
 	}
 
 	// 获取所有工作表
-	sheets := f.GetSheetList()
+	sheets := getDataSheetList(f)
 	if len(sheets) == 0 {
 		return fmt.Errorf("Excel文件没有工作表")
 	}
@@ -1210,12 +843,10 @@ func (s *DataImportService) addValidationErrorsToExcelAttachment2(filePath strin
 	// 处理第一个工作表
 	sheetName := sheets[0]
 
-	// 高亮涉及到的单元格
-	if len(allCells) > 0 {
-		err = s.highlightCellsInExcel(f, sheetName, allCells)
-		if err != nil {
-			fmt.Printf("高亮单元格失败: %v\n", err)
-		}
+	// 按级别高亮涉及到的单元格
+	err = s.highlightValidationCells(f, sheetName, errors)
+	if err != nil {
+		fmt.Printf("高亮单元格失败: %v\n", err)
 	}
 
 
@@ -1244,8 +875,17 @@ func (s *DataImportService) addValidationErrorsToExcelAttachment2(filePath strin
 		// 格式化错误信息：每条错误使用序号标识并换行
 		formattedErrorMsg := formatErrorMessages(errorMsg)
 		f.SetCellValue(sheetName, errorCellName, formattedErrorMsg)
-		
-		f.SetCellStyle(sheetName, errorCellName, errorCellName, style)
+
+		rowStyle, err := f.NewStyle(&excelize.Style{
+			Fill: excelize.Fill{Type: "pattern", Color: []string{getSeverityColor(severityMap[excelRow])}, Pattern: 1},
+			Alignment: &excelize.Alignment{
+				Vertical: "center",
+			},
+		})
+		if err != nil {
+			fmt.Println(err)
+		}
+		f.SetCellStyle(sheetName, errorCellName, errorCellName, rowStyle)
 		// 设置错误信息列的宽度为50
 		colName, _ := excelize.ColumnNumberToName(errorCol)
 		f.SetColWidth(sheetName, colName, colName, 50)
@@ -1266,145 +906,13 @@ func (s *DataImportService) addValidationErrorsToExcelAttachment2(filePath strin
 		f.SetCellStyle(sheetName, cellName, cellName, style)
 	}
 		
-	// 保存文件
-	return f.Save()
-}
-
-// encryptAttachment2NumericFields 加密附件2数值字段
-func (s *DataImportService) encryptAttachment2NumericFields(record map[string]interface{}) map[string]interface{} {
-	numericFields := []string{
-		"total_coal",
-		"raw_coal",
-		"washed_coal",
-		"other_coal",
-		"power_generation",
-		"heating",
-		"coal_washing",
-		"coking",
-		"oil_refining",
-		"gas_production",
-		"industry",
-		"raw_materials",
-		"other_uses",
-		"coke",
-	}
-	return s.encryptNumericFields(record, numericFields)
-}
-
-// UpdateOptimizedCacheAfterUpload 上传成功后更新优化缓存
-func (s *DataImportService) UpdateOptimizedCacheAfterUpload(areaConfig *EnhancedAreaConfig, statDate string, mainData []map[string]interface{}) error {
-
-	// 1. 更新年份累计数据（下辖县区数据累加）
-	yearlyData := &YearlyAggregatedData{
-		StatDate:     statDate,
-		TotalCoal:    0.0,
-		RawCoal:      0.0,
-		WashedCoal:   0.0,
-		OtherCoal:    0.0,
-		PowerGen:     0.0,
-		Heating:      0.0,
-		CoalWashing:  0.0,
-		Coking:       0.0,
-		OilRefining:  0.0,
-		GasProd:      0.0,
-		Industry:     0.0,
-		RawMaterials: 0.0,
-		OtherUses:    0.0,
-		Coke:         0.0,
-	}
-
-	// 2. 更新当前市数据缓存（本市数据）
-	cityData := &CityData{
-		ProvinceName: areaConfig.ProvinceName,
-		CityName:     areaConfig.CityName,
-		StatDate:     statDate,
-		TotalCoal:    0.0,
-		RawCoal:      0.0,
-		WashedCoal:   0.0,
-		OtherCoal:    0.0,
-		PowerGen:     0.0,
-		Heating:      0.0,
-		CoalWashing:  0.0,
-		Coking:       0.0,
-		OilRefining:  0.0,
-		GasProd:      0.0,
-		Industry:     0.0,
-		RawMaterials: 0.0,
-		OtherUses:    0.0,
-		Coke:         0.0,
-	}
-
-	// 处理上传的数据
-	for _, record := range mainData {
-		recordStatDate := s.getStringValue(record["stat_date"])
-		recordProvinceName := s.getStringValue(record["province_name"])
-		recordCityName := s.getStringValue(record["city_name"])
-		recordCountryName := s.getStringValue(record["country_name"])
-
-		// 存储指标数据到已导入缓存
-		indicatorData := &YearlyAggregatedData{
-			StatDate:     recordStatDate,
-			TotalCoal:    s.parseFloat(s.getStringValue(record["total_coal"])),
-			RawCoal:      s.parseFloat(s.getStringValue(record["raw_coal"])),
-			WashedCoal:   s.parseFloat(s.getStringValue(record["washed_coal"])),
-			OtherCoal:    s.parseFloat(s.getStringValue(record["other_coal"])),
-			PowerGen:     s.parseFloat(s.getStringValue(record["power_generation"])),
-			Heating:      s.parseFloat(s.getStringValue(record["heating"])),
-			CoalWashing:  s.parseFloat(s.getStringValue(record["coal_washing"])),
-			Coking:       s.parseFloat(s.getStringValue(record["coking"])),
-			OilRefining:  s.parseFloat(s.getStringValue(record["oil_refining"])),
-			GasProd:      s.parseFloat(s.getStringValue(record["gas_production"])),
-			Industry:     s.parseFloat(s.getStringValue(record["industry"])),
-			RawMaterials: s.parseFloat(s.getStringValue(record["raw_materials"])),
-			OtherUses:    s.parseFloat(s.getStringValue(record["other_uses"])),
-			Coke:         s.parseFloat(s.getStringValue(record["coke"])),
-		}
-		attachment2CacheManager.SetImportedData(recordStatDate, recordProvinceName, recordCityName, recordCountryName, indicatorData)
-
-		// 判断是否为下辖县区数据（countryName不为空）
-		if recordCountryName != "" {
-			yearlyData.TotalCoal = s.addFloat64(yearlyData.TotalCoal, s.parseFloat(s.getStringValue(record["total_coal"])))
-			yearlyData.RawCoal = s.addFloat64(yearlyData.RawCoal, s.parseFloat(s.getStringValue(record["raw_coal"])))
-			yearlyData.WashedCoal = s.addFloat64(yearlyData.WashedCoal, s.parseFloat(s.getStringValue(record["washed_coal"])))
-			yearlyData.OtherCoal = s.addFloat64(yearlyData.OtherCoal, s.parseFloat(s.getStringValue(record["other_coal"])))
-			yearlyData.PowerGen = s.addFloat64(yearlyData.PowerGen, s.parseFloat(s.getStringValue(record["power_generation"])))
-			yearlyData.Heating = s.addFloat64(yearlyData.Heating, s.parseFloat(s.getStringValue(record["heating"])))
-			yearlyData.CoalWashing = s.addFloat64(yearlyData.CoalWashing, s.parseFloat(s.getStringValue(record["coal_washing"])))
-			yearlyData.Coking = s.addFloat64(yearlyData.Coking, s.parseFloat(s.getStringValue(record["coking"])))
-			yearlyData.OilRefining = s.addFloat64(yearlyData.OilRefining, s.parseFloat(s.getStringValue(record["oil_refining"])))
-			yearlyData.GasProd = s.addFloat64(yearlyData.GasProd, s.parseFloat(s.getStringValue(record["gas_production"])))
-			yearlyData.Industry = s.addFloat64(yearlyData.Industry, s.parseFloat(s.getStringValue(record["industry"])))
-			yearlyData.RawMaterials = s.addFloat64(yearlyData.RawMaterials, s.parseFloat(s.getStringValue(record["raw_materials"])))
-			yearlyData.OtherUses = s.addFloat64(yearlyData.OtherUses, s.parseFloat(s.getStringValue(record["other_uses"])))
-			yearlyData.Coke = s.addFloat64(yearlyData.Coke, s.parseFloat(s.getStringValue(record["coke"])))
-		}
-
-		// 判断是否为当前市的数据（countryName为空）
-		if recordCountryName == ""  {
-			cityData.TotalCoal = s.addFloat64(cityData.TotalCoal, s.parseFloat(s.getStringValue(record["total_coal"])))
-			cityData.RawCoal = s.addFloat64(cityData.RawCoal, s.parseFloat(s.getStringValue(record["raw_coal"])))
-			cityData.WashedCoal = s.addFloat64(cityData.WashedCoal, s.parseFloat(s.getStringValue(record["washed_coal"])))
-			cityData.OtherCoal = s.addFloat64(cityData.OtherCoal, s.parseFloat(s.getStringValue(record["other_coal"])))
-			cityData.PowerGen = s.addFloat64(cityData.PowerGen, s.parseFloat(s.getStringValue(record["power_generation"])))
-			cityData.Heating = s.addFloat64(cityData.Heating, s.parseFloat(s.getStringValue(record["heating"])))
-			cityData.CoalWashing = s.addFloat64(cityData.CoalWashing, s.parseFloat(s.getStringValue(record["coal_washing"])))
-			cityData.Coking = s.addFloat64(cityData.Coking, s.parseFloat(s.getStringValue(record["coking"])))
-			cityData.OilRefining = s.addFloat64(cityData.OilRefining, s.parseFloat(s.getStringValue(record["oil_refining"])))
-			cityData.GasProd = s.addFloat64(cityData.GasProd, s.parseFloat(s.getStringValue(record["gas_production"])))
-			cityData.Industry = s.addFloat64(cityData.Industry, s.parseFloat(s.getStringValue(record["industry"])))
-			cityData.RawMaterials = s.addFloat64(cityData.RawMaterials, s.parseFloat(s.getStringValue(record["raw_materials"])))
-			cityData.OtherUses = s.addFloat64(cityData.OtherUses, s.parseFloat(s.getStringValue(record["other_uses"])))
-			cityData.Coke = s.addFloat64(cityData.Coke, s.parseFloat(s.getStringValue(record["coke"])))
-		}
+	// 添加单元格批注和校验结果汇总表
+	if err := s.addValidationReport(f, sheetName, errors); err != nil {
+		fmt.Printf("添加校验结果汇总失败: %v\n", err)
 	}
 
-	// 更新年份累计缓存
-	attachment2CacheManager.UpdateYearlyAggregatedData(statDate, yearlyData)
-
-	// 设置当前市数据缓存
-	attachment2CacheManager.SetCityData(areaConfig.ProvinceName, areaConfig.CityName, statDate, cityData)
-
-	return nil
+	// 保存文件
+	return f.Save()
 }
 
 // generateAllRelatedCells 生成所有相关单元格位置（包括本市数据和下辖区县数据）
@@ -1,12 +1,14 @@
 package data_import
 
 import (
+	"database/sql"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"shuji/db"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -112,11 +114,11 @@ func (s *DataImportService) modelDataCheckReportDownloadWithRecover(tableType st
 // ModelDataCoverTable1 覆盖附表1数据
 func (s *DataImportService) ModelDataCoverTable1(filePaths []string) db.QueryResult {
 	// 使用包装函数来处理异常
-	return s.modelDataCoverTable1WithRecover(filePaths)
+	return s.modelDataCoverTable1WithRecover(filePaths, nil)
 }
 
-// modelDataCoverTable1WithRecover 带异常处理的覆盖附表1数据函数
-func (s *DataImportService) modelDataCoverTable1WithRecover(filePaths []string) db.QueryResult {
+// modelDataCoverTable1WithRecover 带异常处理的覆盖附表1数据函数，excludedKeys中的记录不覆盖
+func (s *DataImportService) modelDataCoverTable1WithRecover(filePaths []string, excludedKeys []string) db.QueryResult {
 	var result db.QueryResult
 
 	// 添加异常处理，防止函数崩溃
@@ -141,6 +143,11 @@ func (s *DataImportService) modelDataCoverTable1WithRecover(filePaths []string)
 		}
 	}
 
+	// 覆盖数据前为系统数据库创建快照
+	if snapshotResult := s.app.CreateSnapshot(SnapshotReasonCover); !snapshotResult.Ok {
+		return snapshotResult
+	}
+
 	var validationErrors []ValidationError
 	var failedFiles []string
 
@@ -171,6 +178,13 @@ func (s *DataImportService) modelDataCoverTable1WithRecover(filePaths []string)
 				continue
 			}
 
+			// 排除未确认覆盖的记录
+			mainData = filterCoverRecords(TableType1, mainData, excludedKeys)
+			if len(mainData) == 0 {
+				continue
+			}
+
+			s.setRecordsFileHash(mainData, s.getCacheFileHash(TableType1, file.Name()))
 			err = s.coverTable1Data(mainData, usageData, equipData, file.Name())
 			if err != nil {
 				validationErrors = append(validationErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 覆盖数据失败: %v", file.Name(), err)})
@@ -224,13 +238,27 @@ func (s *DataImportService) modelDataCheckTable1WithRecover() db.QueryResult {
 		}
 	}
 
+	// 入库前检测批次内多个文件之间的重复数据，存在未处理的重复时由用户选择保留的文件
+	batchExclusions := s.loadBatchDuplicateResolution(TableType1)
+	if duplicateResult, exists := s.checkBatchDuplicates(TableType1, batchExclusions); exists {
+		return duplicateResult
+	}
+
 	var validationErrors []ValidationError = []ValidationError{} // 验证错误信息
 	var systemErrors []ValidationError = []ValidationError{}     // 系统错误信息
 	var importedFiles []string = []string{}                      // 导入的文件
 	var coverFiles []string = []string{}                         // 覆盖的文件
 	var failedFiles []string = []string{}                        // 失败的文件
+	var warningFiles []string = []string{}                       // 存在警告已确认导入的文件
 	var hasExcelFile bool = false                                // 是否有Excel文件
 
+	// 仅有警告的文件需用户确认后导入，未确认的文件保留在缓存目录中
+	warningAcks := s.loadWarningAcknowledgements(TableType1)
+	pendingWarnings := make(map[string]WarningAcknowledgement) // key: 文件名, value: 等待确认的警告
+
+	// 结构化校验结果，写入校验报告中的JSON、CSV文件
+	var reportEntries = []ValidationReportEntry{}
+
 	// 2. 循环调用对应的解析Excel函数
 	for _, file := range files {
 		// 检查是否xlsx或者xls文件
@@ -242,22 +270,43 @@ func (s *DataImportService) modelDataCheckTable1WithRecover() db.QueryResult {
 			f, err := excelize.OpenFile(filePath)
 			if err != nil {
 				systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 读取失败: %v", file.Name(), err)})
+				reportEntries = append(reportEntries, newFileValidationReportEntry(file.Name(), fmt.Sprintf("文件读取失败: %v", err)))
 				failedFiles = append(failedFiles, filePath)
 				continue
 			}
 
-			mainData, usageData, equipData, err := s.parseTable1Excel(f, true)
+			// 公式单元格只扫描计算一次，解析数据和公式校验共用
+			sheet, err := s.readFormulaSheet(f)
 			f.Close()
+			var mainData, usageData, equipData []map[string]interface{}
+			if err == nil {
+				mainData, usageData, equipData, err = s.parseTable1FormulaSheet(sheet, true)
+			}
+			mainData = filterCoverRecords(TableType1, mainData, batchExclusions[file.Name()])
+			var formulaErrors []ValidationError
+			if err == nil {
+				formulaErrors = append(formulaErrors, s.validateFormulaCells(sheet.Cells, TableType1, mainData, "_excel_row2")...)
+				formulaErrors = append(formulaErrors, s.validateFormulaCells(sheet.Cells, TableType1, usageData, "_excel_row")...)
+				formulaErrors = append(formulaErrors, s.validateFormulaCells(sheet.Cells, TableType1, equipData, "_excel_row")...)
+			}
 
 			if err != nil {
 				systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 解析失败: %v", file.Name(), err)})
+				reportEntries = append(reportEntries, newFileValidationReportEntry(file.Name(), fmt.Sprintf("文件解析失败: %v", err)))
 				failedFiles = append(failedFiles, filePath)
 				continue
 			}
 
+			// 批次内重复数据中未保留的记录不导入
+			if len(batchExclusions[file.Name()]) > 0 && len(mainData) == 0 {
+				os.Remove(filePath)
+				continue
+			}
+
 			// 4. 调用校验函数,对每一行数据验证
 			errors := s.validateTable1DataWithEnterpriseCheckForModel(mainData, usageData, equipData)
-			if len(errors) > 0 {
+			errors = append(errors, formulaErrors...)
+			if hasBlockingErrors(errors) {
 				// 校验失败，在Excel文件中错误行最后添加错误信息
 				err = s.addValidationErrorsToExcelTable1(filePath, errors)
 
@@ -271,6 +320,7 @@ func (s *DataImportService) modelDataCheckTable1WithRecover() db.QueryResult {
 					failedFiles = append(failedFiles, filePath)
 					continue
 				}
+				reportEntries = append(reportEntries, s.buildValidationReportEntries(filePath, TableType1, errors, validationRecordSet{mainData, "_excel_row2"}, validationRecordSet{usageData, "_excel_row"}, validationRecordSet{equipData, "_excel_row"})...)
 				failedFiles = append(failedFiles, filePath)
 				// 将验证错误转换为字符串用于显示
 				var errorMessages []string
@@ -281,25 +331,50 @@ func (s *DataImportService) modelDataCheckTable1WithRecover() db.QueryResult {
 				continue
 			}
 
+			// 仅有警告的文件未经用户确认时不导入，保留文件等待确认
+			acknowledgement, acknowledged := checkWarningAcknowledged(warningAcks, file.Name(), errors)
+			if len(errors) > 0 && !acknowledged {
+				pendingWarnings[file.Name()] = WarningAcknowledgement{FileName: file.Name(), Warnings: getWarningMessages(errors)}
+				continue
+			}
+
 			// 5. 校验通过后,检查文件是否已导入
 			if s.isTable1FileImported(mainData) {
 				coverFiles = append(coverFiles, filePath)
 				continue
 			}
 
-			// 6. 如果没有导入过,把数据保存到相应的数据库表中
+			// 6. 如果没有导入过,把数据保存到相应的数据库表中，并记录源文件哈希
+			s.setRecordsFileHash(mainData, s.getCacheFileHash(TableType1, file.Name()))
 			err = s.saveTable1Data(mainData, usageData, equipData)
 			if err != nil {
 				systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 保存数据失败: %v", file.Name(), err)})
 				failedFiles = append(failedFiles, filePath)
 			} else {
+				importedFiles = append(importedFiles, file.Name())
+				// 仅有警告的文件记录确认信息，标注警告后放入校验报告
+				if len(errors) > 0 {
+					s.recordWarningAcknowledgement(file.Name(), TableType1, acknowledgement)
+					if s.addValidationErrorsToExcelTable1(filePath, errors) == nil {
+						reportEntries = append(reportEntries, s.buildValidationReportEntries(filePath, TableType1, errors, validationRecordSet{mainData, "_excel_row2"}, validationRecordSet{usageData, "_excel_row"}, validationRecordSet{equipData, "_excel_row"})...)
+						warningFiles = append(warningFiles, filePath)
+						continue
+					}
+				}
 				// 删除该Excel文件
 				os.Remove(filePath)
-				importedFiles = append(importedFiles, file.Name())
 			}
 		}
 	}
 
+	// 批次内重复数据的处理结果只对本次校验有效
+	s.clearBatchDuplicateResolution(TableType1)
+
+	// 已导入文件的确认记录不再需要，只保留等待确认的文件
+	if err := s.saveWarningAcknowledgements(TableType1, pendingWarnings); err != nil {
+		systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("保存警告确认记录失败: %v", err)})
+	}
+
 	if !hasExcelFile {
 		result = db.QueryResult{
 			Ok:      false,
@@ -309,20 +384,27 @@ func (s *DataImportService) modelDataCheckTable1WithRecover() db.QueryResult {
 	}
 
 	// 7. 把所有的模型验证失败的文件打个zip包
-	if len(failedFiles) > 0 {
-		err = s.createValidationErrorZip(failedFiles, TableType1, TableName1)
+	reportFiles := append(append([]string{}, failedFiles...), warningFiles...)
+	if len(reportFiles) > 0 {
+		err = s.createValidationErrorZip(reportFiles, TableType1, TableName1, reportEntries)
 		if err != nil {
 			systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("创建错误报告失败: %v", err)})
 		}
 
-		// 删除失败文件
-		for _, filePath := range failedFiles {
+		// 删除报告中的文件
+		for _, filePath := range reportFiles {
 			os.Remove(filePath)
 		}
 	}
 
 	// 8. 返回结果
 	message := fmt.Sprintf("处理完成。成功导入: %d 个文件，失败: %d 个文件", len(importedFiles), len(failedFiles))
+	if len(warningFiles) > 0 {
+		message += fmt.Sprintf("，其中 %d 个文件存在警告已确认导入", len(warningFiles))
+	}
+	if len(pendingWarnings) > 0 {
+		message += fmt.Sprintf("，%d 个文件存在警告，确认后导入", len(pendingWarnings))
+	}
 
 	if len(systemErrors) > 0 {
 		// 将验证错误转换为字符串用于显示
@@ -339,74 +421,20 @@ func (s *DataImportService) modelDataCheckTable1WithRecover() db.QueryResult {
 		Ok:      true,
 		Message: message,
 		Data: map[string]interface{}{
-			"cover_files":     coverFiles,                // 覆盖的文件
-			"hasExportReport": len(validationErrors) > 0, // 是否有导出报告
-			"hasFailedFiles":  len(failedFiles) > 0,      // 是否有失败的文件
+			"cover_files":     coverFiles,                                         // 覆盖的文件
+			"hasExportReport": len(validationErrors) > 0 || len(warningFiles) > 0, // 是否有导出报告
+			"hasFailedFiles":  len(failedFiles) > 0,                               // 是否有失败的文件
+			"warning_files":   getPendingWarningFiles(pendingWarnings),            // 存在警告等待确认的文件
 		},
 	}
 	return result
 }
 
-// coverTable1Data 覆盖附表1数据
+// coverTable1Data 覆盖附表1数据，同一单位同一年份的数据按自然键原地更新
 func (s *DataImportService) coverTable1Data(mainData, usageData, equipData []map[string]interface{}, fileName string) error {
-	if len(mainData) == 0 {
-		return fmt.Errorf("主表数据为空")
-	}
-
-	// 获取统一信用代码和年份
-	creditCode := s.getStringValue(mainData[0]["credit_code"])
-	statDate := s.getStringValue(mainData[0]["stat_date"])
-
-	// 根据年份+统一信用代码删除表数据
-	err := s.deleteTable1DataByCreditCodeAndYear(creditCode, statDate)
-	if err != nil {
-		return fmt.Errorf("删除旧数据失败: %v", err)
-	}
-
-	// 插入新数据
 	return s.saveTable1Data(mainData, usageData, equipData)
 }
 
-// deleteTable1DataByCreditCodeAndYear 根据统一信用代码和年份删除附表1数据
-func (s *DataImportService) deleteTable1DataByCreditCodeAndYear(creditCode, statDate string) error {
-	// 先查出一条主表记录，获取obj_id，扩展表的fk_id就是obj_id
-	var objID string
-	query := "SELECT obj_id FROM enterprise_coal_consumption_main WHERE credit_code = ? AND stat_date = ? LIMIT 1"
-	result, err := s.app.GetDB().QueryRow(query, creditCode, statDate)
-	if err != nil || result.Data == nil {
-		return err
-	}
-
-	objID = result.Data.(map[string]interface{})["obj_id"].(string)
-
-	// 如果查不到obj_id，说明主表没有数据，直接返回
-	if objID == "" {
-		return nil
-	}
-
-	// 删除扩展表数据
-	query = "DELETE FROM enterprise_coal_consumption_usage WHERE fk_id = ?"
-	_, err = s.app.GetDB().Exec(query, objID)
-	if err != nil {
-		return err
-	}
-
-	query = "DELETE FROM enterprise_coal_consumption_equip WHERE fk_id = ?"
-	_, err = s.app.GetDB().Exec(query, objID)
-	if err != nil {
-		return err
-	}
-
-	// 最后根据obj_id删除主表数据
-	query = "DELETE FROM enterprise_coal_consumption_main WHERE obj_id = ?"
-	_, err = s.app.GetDB().Exec(query, objID)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // isTable1FileImported 检查附表1文件是否已导入
 func (s *DataImportService) isTable1FileImported(mainData []map[string]interface{}) bool {
 	if len(mainData) == 0 {
@@ -416,102 +444,96 @@ func (s *DataImportService) isTable1FileImported(mainData []map[string]interface
 	creditCode := s.getStringValue(mainData[0]["credit_code"])
 	statDate := s.getStringValue(mainData[0]["stat_date"])
 
-	query := "SELECT COUNT(1) as count FROM enterprise_coal_consumption_main WHERE credit_code = ? AND stat_date = ?"
-	result, err := s.app.GetDB().QueryRow(query, creditCode, statDate)
-	if err != nil || result.Data == nil {
-		return false
-	}
-
-	return result.Data.(map[string]interface{})["count"].(int64) > 0
+	count, err := newRepository[db.EnterpriseCoalConsumptionMain](s).Count("credit_code = ? AND stat_date = ?", creditCode, statDate)
+	return err == nil && count > 0
 }
 
-// saveTable1Data 保存附表1数据到数据库
+// saveTable1Data 保存附表1数据到数据库，同一单位同一年份的数据已存在时覆盖
 func (s *DataImportService) saveTable1Data(mainData, usageData, equipData []map[string]interface{}) error {
 	if len(mainData) == 0 {
 		return fmt.Errorf("主表数据为空")
 	}
 
-	objID := s.generateUUID()
-	createTime := time.Now().UnixMilli()
-	// 保存主表数据
-	mainRecord := mainData[0]
-	mainRecord["obj_id"] = objID
-	mainRecord["create_time"] = createTime
-
-	// 对数值字段进行SM4加密
-	encryptedValues := s.encryptTable1MainNumericFields(mainRecord)
-
-	query := `INSERT INTO enterprise_coal_consumption_main (
-		obj_id, unit_name, stat_date, tel, credit_code, create_time, trade_a, trade_b, trade_c,
-		province_name, city_name, country_name, annual_energy_equivalent_value, annual_energy_equivalent_cost,
-		annual_raw_material_energy, annual_total_coal_consumption, annual_total_coal_products,
-		annual_raw_coal, annual_raw_coal_consumption, annual_clean_coal_consumption,
-		annual_other_coal_consumption, annual_coke_consumption, create_user, is_check
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	_, err := s.app.GetDB().Exec(query,
-		mainRecord["obj_id"], mainRecord["unit_name"], mainRecord["stat_date"], mainRecord["tel"],
-		mainRecord["credit_code"], mainRecord["create_time"], mainRecord["trade_a"], mainRecord["trade_b"],
-		mainRecord["trade_c"], mainRecord["province_name"], mainRecord["city_name"], mainRecord["country_name"],
-		encryptedValues["annual_energy_equivalent_value"], encryptedValues["annual_energy_equivalent_cost"],
-		encryptedValues["annual_raw_material_energy"], encryptedValues["annual_total_coal_consumption"],
-		encryptedValues["annual_total_coal_products"], encryptedValues["annual_raw_coal"], encryptedValues["annual_raw_coal_consumption"],
-		encryptedValues["annual_clean_coal_consumption"], encryptedValues["annual_other_coal_consumption"],
-		encryptedValues["annual_coke_consumption"], s.app.GetAreaStr(), EncryptedOne)
-	if err != nil {
-		return fmt.Errorf("保存主表数据失败: %v", err)
+	// 已报送的年份不允许写入数据
+	if err := s.checkRecordsWritable(mainData); err != nil {
+		return err
 	}
 
-	// 保存用途数据
-	for _, usage := range usageData {
-		usage["obj_id"] = s.generateUUID()
-		usage["fk_id"] = objID
-		usage["stat_date"] = mainRecord["stat_date"]
-		usage["create_time"] = createTime
-
-		// 对数值字段进行SM4加密
-		encryptedUsageValues := s.encryptTable1UsageNumericFields(usage)
-
-		query := `INSERT INTO enterprise_coal_consumption_usage (
-			obj_id, fk_id, stat_date, create_time, main_usage, specific_usage, input_variety,
-			input_unit, input_quantity, output_energy_types, output_quantity, measurement_unit, remarks, row_no, is_check
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	mainRecords, err := decodeRecords[db.EnterpriseCoalConsumptionMain](mainData[:1])
+	if err != nil {
+		return fmt.Errorf("主表数据格式错误: %v", err)
+	}
+	usageRecords, err := decodeRecords[db.EnterpriseCoalConsumptionUsage](usageData)
+	if err != nil {
+		return fmt.Errorf("用途数据格式错误: %v", err)
+	}
+	equipRecords, err := decodeRecords[db.EnterpriseCoalConsumptionEquip](equipData)
+	if err != nil {
+		return fmt.Errorf("设备数据格式错误: %v", err)
+	}
 
-		_, err := s.app.GetDB().Exec(query,
-			usage["obj_id"], usage["fk_id"], usage["stat_date"], usage["create_time"],
-			usage["main_usage"], usage["specific_usage"], usage["input_variety"], usage["input_unit"],
-			encryptedUsageValues["input_quantity"], usage["output_energy_types"], encryptedUsageValues["output_quantity"],
-			usage["measurement_unit"], usage["remarks"], usage["row_no"], EncryptedOne)
+	createTime := time.Now().UnixMilli()
+	mainRecord := &mainRecords[0]
+	mainRecord.ObjID = s.generateUUID()
+	mainRecord.CreateTime = createTime
+	mainRecord.CreateUser = s.app.GetAreaStr()
+	mainRecord.IsConfirm = "0"
+	mainRecord.IsCheck = "1"
+	for i := range usageRecords {
+		usageRecords[i].ObjID = s.generateUUID()
+		usageRecords[i].StatDate = mainRecord.StatDate
+		usageRecords[i].CreateTime = createTime
+		usageRecords[i].IsConfirm = "0"
+		usageRecords[i].IsCheck = "1"
+	}
+	for i := range equipRecords {
+		equipRecords[i].ObjID = s.generateUUID()
+		equipRecords[i].StatDate = mainRecord.StatDate
+		equipRecords[i].CreateTime = createTime
+		equipRecords[i].IsConfirm = "0"
+		equipRecords[i].IsCheck = "1"
+	}
+
+	// 主表、用途和设备数据在同一事务中写入，任一部分失败时全部回滚。
+	// 单位和年份已存在时主表原地更新并沿用原记录的obj_id，扩展表数据整体替换
+	objID := mainRecord.ObjID
+	err = s.app.GetDB().WithTx(func(tx *sql.Tx) error {
+		if err := upsertRecordsTx(tx, newRepository[db.EnterpriseCoalConsumptionMain](s), mainRecords, "obj_id", "create_time"); err != nil {
+			return fmt.Errorf("保存主表数据失败: %v", err)
+		}
+		err := tx.QueryRow("SELECT obj_id FROM enterprise_coal_consumption_main WHERE credit_code = ? AND stat_date = ?",
+			mainRecord.CreditCode, mainRecord.StatDate).Scan(&objID)
 		if err != nil {
-			return fmt.Errorf("保存用途数据失败: %v", err)
+			return fmt.Errorf("查询主表数据失败: %v", err)
 		}
-	}
-
-	// 保存设备数据
-	for _, equip := range equipData {
-		equip["obj_id"] = s.generateUUID()
-		equip["fk_id"] = objID
-		equip["stat_date"] = mainRecord["stat_date"]
-		equip["create_time"] = createTime
-
-		// 对数值字段进行SM4加密
-		encryptedEquipValues := s.encryptTable1EquipNumericFields(equip)
 
-		query := `INSERT INTO enterprise_coal_consumption_equip (
-			obj_id, fk_id, stat_date, create_time, equip_type, equip_no, total_runtime,
-			design_life, energy_efficiency, capacity_unit, capacity, coal_type, annual_coal_consumption, row_no, is_check
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		if _, err := tx.Exec("DELETE FROM enterprise_coal_consumption_usage WHERE fk_id = ?", objID); err != nil {
+			return fmt.Errorf("删除旧用途数据失败: %v", err)
+		}
+		if _, err := tx.Exec("DELETE FROM enterprise_coal_consumption_equip WHERE fk_id = ?", objID); err != nil {
+			return fmt.Errorf("删除旧设备数据失败: %v", err)
+		}
+		for i := range usageRecords {
+			usageRecords[i].FkID = objID
+		}
+		for i := range equipRecords {
+			equipRecords[i].FkID = objID
+		}
 
-		_, err := s.app.GetDB().Exec(query,
-			equip["obj_id"], equip["fk_id"], equip["stat_date"], equip["create_time"],
-			equip["equip_type"], equip["equip_no"], encryptedEquipValues["total_runtime"], encryptedEquipValues["design_life"],
-			encryptedEquipValues["energy_efficiency"], equip["capacity_unit"], encryptedEquipValues["capacity"], equip["coal_type"],
-			encryptedEquipValues["annual_coal_consumption"], equip["row_no"], EncryptedOne)
-		if err != nil {
+		if err := newRepository[db.EnterpriseCoalConsumptionUsage](s).InsertTx(tx, usageRecords, importBatchSize); err != nil {
+			return fmt.Errorf("保存用途数据失败: %v", err)
+		}
+		if err := upsertRecordsTx(tx, newRepository[db.EnterpriseCoalConsumptionEquip](s), equipRecords); err != nil {
 			return fmt.Errorf("保存设备数据失败: %v", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	mainData[0]["obj_id"] = objID
 
+	s.advanceSubmissionStatus(s.collectStatDates(mainData), SubmissionEventImport)
 	return nil
 }
 
@@ -525,25 +547,25 @@ func (s *DataImportService) addValidationErrorsToExcelTable1(filePath string, er
 
 	// 创建错误信息映射
 	errorMap := make(map[int]string)
-	// 收集所有需要高亮的单元格
-	var allCells []string
+	// 记录每行最严重的级别，用于设置错误信息列的颜色
+	severityMap := make(map[int]string)
 
 	for _, err := range errors {
+		message := formatValidationMessage(err)
 		// 如果该行已有错误信息，则追加
 		if existing, exists := errorMap[err.RowNumber]; exists {
-			errorMap[err.RowNumber] = existing + "; " + err.Message
+			errorMap[err.RowNumber] = existing + "; " + message
 		} else {
-			errorMap[err.RowNumber] = err.Message
+			errorMap[err.RowNumber] = message
 		}
 
-		// 收集涉及到的单元格
-		if err.Cells != nil {
-			allCells = append(allCells, err.Cells...)
+		if current, exists := severityMap[err.RowNumber]; !exists || getSeverityRank(err.Severity) > getSeverityRank(current) {
+			severityMap[err.RowNumber] = err.Severity
 		}
 	}
 
 	// 获取所有工作表
-	sheets := f.GetSheetList()
+	sheets := getDataSheetList(f)
 	if len(sheets) == 0 {
 		return fmt.Errorf("Excel文件没有工作表")
 	}
@@ -551,12 +573,10 @@ func (s *DataImportService) addValidationErrorsToExcelTable1(filePath string, er
 	// 处理第一个工作表
 	sheetName := sheets[0]
 
-	// 高亮涉及到的单元格
-	if len(allCells) > 0 {
-		err = s.highlightCellsInExcel(f, sheetName, allCells)
-		if err != nil {
-			fmt.Printf("高亮单元格失败: %v\n", err)
-		}
+	// 按级别高亮涉及到的单元格
+	err = s.highlightValidationCells(f, sheetName, errors)
+	if err != nil {
+		fmt.Printf("高亮单元格失败: %v\n", err)
 	}
 
 	maxCol := 10
@@ -574,7 +594,7 @@ func (s *DataImportService) addValidationErrorsToExcelTable1(filePath string, er
 		formattedErrorMsg := formatErrorMessages(errorMsg)
 		f.SetCellValue(sheetName, errorCellName, formattedErrorMsg)
 		style, err := f.NewStyle(&excelize.Style{
-			Fill: excelize.Fill{Type: "pattern", Color: []string{"FFFF00"}, Pattern: 1},
+			Fill: excelize.Fill{Type: "pattern", Color: []string{getSeverityColor(severityMap[rowNum])}, Pattern: 1},
 			Alignment: &excelize.Alignment{
 				Vertical: "center",
 			},
@@ -589,6 +609,11 @@ func (s *DataImportService) addValidationErrorsToExcelTable1(filePath string, er
 		f.SetColWidth(sheetName, colName, colName, 50)
 	}
 
+	// 添加单元格批注和校验结果汇总表
+	if err := s.addValidationReport(f, sheetName, errors); err != nil {
+		fmt.Printf("添加校验结果汇总失败: %v\n", err)
+	}
+
 	// 保存文件
 	return f.Save()
 }
@@ -597,20 +622,38 @@ func (s *DataImportService) addValidationErrorsToExcelTable1(filePath string, er
 func (s *DataImportService) validateTable1DataWithEnterpriseCheckForModel(mainData, usageData, equipData []map[string]interface{}) []ValidationError {
 	errors := []ValidationError{}
 
+	mainRecords, err := decodeRecords[db.EnterpriseCoalConsumptionMain](mainData)
+	if err != nil {
+		return []ValidationError{{RowNumber: 0, Message: fmt.Sprintf("主表数据格式错误: %v", err)}}
+	}
+	usageRecords, err := decodeRecords[db.EnterpriseCoalConsumptionUsage](usageData)
+	if err != nil {
+		return []ValidationError{{RowNumber: 0, Message: fmt.Sprintf("用途数据格式错误: %v", err)}}
+	}
+	equipRecords, err := decodeRecords[db.EnterpriseCoalConsumptionEquip](equipData)
+	if err != nil {
+		return []ValidationError{{RowNumber: 0, Message: fmt.Sprintf("设备数据格式错误: %v", err)}}
+	}
+
 	// 校验主表数据
-	for _, data := range mainData {
+	for i, data := range mainRecords {
 		// 获取记录的实际Excel行号,使用第二部分的excel行号
-		excelRowNum := data["_excel_row2"].(int)
+		excelRowNum := s.getExcelRowNumberByKey(mainData[i], "_excel_row2")
+		unitRowNum, _ := mainData[i]["_excel_row"].(int)
 
 		// 校验基本信息表格的数值字段
 		valueErrors := s.validateTable1MainNumericFields(data, excelRowNum)
 		errors = append(errors, valueErrors...)
+
+		// 软性规则校验（警告，不阻止导入）
+		softErrors := s.validateTable1MainSoftRules(data, excelRowNum, unitRowNum)
+		errors = append(errors, softErrors...)
 	}
 
 	// 校验用途数据
-	for _, data := range usageData {
+	for i, data := range usageRecords {
 		// 获取记录的实际Excel行号
-		excelRowNum := s.getExcelRowNumber(data)
+		excelRowNum := s.getExcelRowNumber(usageData[i])
 
 		// 校验用途表格的数值字段
 		valueErrors := s.validateTable1UsageNumericFields(data, excelRowNum)
@@ -618,53 +661,70 @@ func (s *DataImportService) validateTable1DataWithEnterpriseCheckForModel(mainDa
 	}
 
 	// 校验设备数据
-	for _, data := range equipData {
+	for i, data := range equipRecords {
 		// 获取记录的实际Excel行号
-		excelRowNum := s.getExcelRowNumber(data)
+		excelRowNum := s.getExcelRowNumber(equipData[i])
 
 		// 校验设备表格的数值字段
 		valueErrors := s.validateTable1EquipNumericFields(data, excelRowNum)
 		errors = append(errors, valueErrors...)
 	}
 
+	// 设备类型和编号不能重复，否则按自然键保存时会相互覆盖
+	seen := map[string]int{}
+	for i, data := range equipRecords {
+		equipNo := strings.TrimSpace(data.EquipNo)
+		if equipNo == "" {
+			continue
+		}
+		excelRowNum := s.getExcelRowNumber(equipData[i])
+		key := strings.TrimSpace(data.EquipType) + "|" + equipNo
+		if firstRow, exists := seen[key]; exists {
+			cells := []string{s.getCellPosition(TableType1, "equip_type", excelRowNum), s.getCellPosition(TableType1, "equip_no", excelRowNum)}
+			errors = append(errors, ValidationError{RowNumber: excelRowNum, Message: fmt.Sprintf("设备类型和编号与第%d行重复", firstRow), Cells: cells, RuleID: "T1-041"})
+			continue
+		}
+		seen[key] = excelRowNum
+	}
+
 	return errors
 }
 
 // validateTable1MainNumericFields 校验附表1主表数值字段
-func (s *DataImportService) validateTable1MainNumericFields(data map[string]interface{}, rowNum int) []ValidationError {
+func (s *DataImportService) validateTable1MainNumericFields(data db.EnterpriseCoalConsumptionMain, rowNum int) []ValidationError {
 	errors := []ValidationError{}
 
 	// 1. 年综合能耗当量值、年综合能耗等价值、年原料用能消费量校验
-	annualEnergyEquivalentValue := s.parseFloat(s.getStringValue(data["annual_energy_equivalent_value"]))
-	annualEnergyEquivalentCost := s.parseFloat(s.getStringValue(data["annual_energy_equivalent_cost"]))
-	annualRawMaterialEnergy := s.parseFloat(s.getStringValue(data["annual_raw_material_energy"]))
+	annualEnergyEquivalentValue := s.parseFloat(data.AnnualEnergyEquivalentValue)
+	annualEnergyEquivalentCost := s.parseFloat(data.AnnualEnergyEquivalentCost)
+	annualRawMaterialEnergy := s.parseFloat(data.AnnualRawMaterialEnergy)
 
 	// ①≧0
 	if s.isIntegerLessThan(annualEnergyEquivalentValue, 0) {
 		cells := []string{s.getCellPosition(TableType1, "annual_energy_equivalent_value", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年综合能耗当量值不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年综合能耗当量值不能为负数", Cells: cells, RuleID: "T1-001"})
 	}
 	if s.isIntegerLessThan(annualEnergyEquivalentCost, 0) {
 		cells := []string{s.getCellPosition(TableType1, "annual_energy_equivalent_cost", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年综合能耗等价值不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年综合能耗等价值不能为负数", Cells: cells, RuleID: "T1-002"})
 	}
 	if s.isIntegerLessThan(annualRawMaterialEnergy, 0) {
 		cells := []string{s.getCellPosition(TableType1, "annual_raw_material_energy", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用能消费量不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用能消费量不能为负数", Cells: cells, RuleID: "T1-003"})
 	}
 
 	// ②≦100000
 	if s.isIntegerGreaterThan(annualEnergyEquivalentValue, 100000) {
 		cells := []string{s.getCellPosition(TableType1, "annual_energy_equivalent_value", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年综合能耗当量值不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年综合能耗当量值不能大于100000", Cells: cells, RuleID: "T1-004"})
 	}
 	if s.isIntegerGreaterThan(annualEnergyEquivalentCost, 100000) {
 		cells := []string{s.getCellPosition(TableType1, "annual_energy_equivalent_cost", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年综合能耗等价值不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年综合能耗等价值不能大于100000", Cells: cells, RuleID: "T1-005"})
 	}
 	if s.isIntegerGreaterThan(annualRawMaterialEnergy, 100000) {
 		cells := []string{s.getCellPosition(TableType1, "annual_raw_material_energy", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用能消费量不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用能消费量不能大于100000", Cells: cells, RuleID: "T1-006"})
 	}
 
 	// ③年原料用能消费量≦年综合能耗当量值
@@ -673,7 +733,7 @@ func (s *DataImportService) validateTable1MainNumericFields(data map[string]inte
 			s.getCellPosition(TableType1, "annual_raw_material_energy", rowNum),
 			s.getCellPosition(TableType1, "annual_energy_equivalent_value", rowNum),
 		}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用能消费量不能大于年综合能耗当量值", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用能消费量不能大于年综合能耗当量值", Cells: cells, RuleID: "T1-007"})
 	}
 
 	// ④年原料用能消费量≦年综合能耗等价值
@@ -682,76 +742,76 @@ func (s *DataImportService) validateTable1MainNumericFields(data map[string]inte
 			s.getCellPosition(TableType1, "annual_raw_material_energy", rowNum),
 			s.getCellPosition(TableType1, "annual_energy_equivalent_cost", rowNum),
 		}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用能消费量不能大于年综合能耗等价值", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用能消费量不能大于年综合能耗等价值", Cells: cells, RuleID: "T1-008"})
 	}
 
 	// 2. 煤炭消费相关字段校验
-	annualTotalCoalConsumption := s.parseFloat(s.getStringValue(data["annual_total_coal_consumption"]))
-	annualTotalCoalProducts := s.parseFloat(s.getStringValue(data["annual_total_coal_products"]))
-	annualRawCoal := s.parseFloat(s.getStringValue(data["annual_raw_coal"]))
-	annualRawCoalConsumption := s.parseFloat(s.getStringValue(data["annual_raw_coal_consumption"]))
-	annualCleanCoalConsumption := s.parseFloat(s.getStringValue(data["annual_clean_coal_consumption"]))
-	annualOtherCoalConsumption := s.parseFloat(s.getStringValue(data["annual_other_coal_consumption"]))
-	annualCokeConsumption := s.parseFloat(s.getStringValue(data["annual_coke_consumption"]))
+	annualTotalCoalConsumption := s.parseFloat(data.AnnualTotalCoalConsumption)
+	annualTotalCoalProducts := s.parseFloat(data.AnnualTotalCoalProducts)
+	annualRawCoal := s.parseFloat(data.AnnualRawCoal)
+	annualRawCoalConsumption := s.parseFloat(data.AnnualRawCoalConsumption)
+	annualCleanCoalConsumption := s.parseFloat(data.AnnualCleanCoalConsumption)
+	annualOtherCoalConsumption := s.parseFloat(data.AnnualOtherCoalConsumption)
+	annualCokeConsumption := s.parseFloat(data.AnnualCokeConsumption)
 
 	// ①≧0
 	if s.isIntegerLessThan(annualTotalCoalConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType1, "annual_total_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "耗煤总量（实物量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "耗煤总量（实物量）不能为负数", Cells: cells, RuleID: "T1-009"})
 	}
 	if s.isIntegerLessThan(annualTotalCoalProducts, 0) {
 		cells := []string{s.getCellPosition(TableType1, "annual_total_coal_products", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "耗煤总量（标准量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "耗煤总量（标准量）不能为负数", Cells: cells, RuleID: "T1-010"})
 	}
 	if s.isIntegerLessThan(annualRawCoal, 0) {
 		cells := []string{s.getCellPosition(TableType1, "annual_raw_coal", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "原料用煤（实物量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "原料用煤（实物量）不能为负数", Cells: cells, RuleID: "T1-011"})
 	}
 	if s.isIntegerLessThan(annualRawCoalConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType1, "annual_raw_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "原煤消费（实物量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "原煤消费（实物量）不能为负数", Cells: cells, RuleID: "T1-012"})
 	}
 	if s.isIntegerLessThan(annualCleanCoalConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType1, "annual_clean_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "洗精煤消费（实物量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "洗精煤消费（实物量）不能为负数", Cells: cells, RuleID: "T1-013"})
 	}
 	if s.isIntegerLessThan(annualOtherCoalConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType1, "annual_other_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "其他煤炭消费（实物量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "其他煤炭消费（实物量）不能为负数", Cells: cells, RuleID: "T1-014"})
 	}
 	if s.isIntegerLessThan(annualCokeConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType1, "annual_coke_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭消费（实物量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭消费（实物量）不能为负数", Cells: cells, RuleID: "T1-015"})
 	}
 
 	// ②≦100000
 	if s.isIntegerGreaterThan(annualTotalCoalConsumption, 100000) {
 		cells := []string{s.getCellPosition(TableType1, "annual_total_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "耗煤总量（实物量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "耗煤总量（实物量）不能大于100000", Cells: cells, RuleID: "T1-016"})
 	}
 	if s.isIntegerGreaterThan(annualTotalCoalProducts, 100000) {
 		cells := []string{s.getCellPosition(TableType1, "annual_total_coal_products", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "耗煤总量（标准量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "耗煤总量（标准量）不能大于100000", Cells: cells, RuleID: "T1-017"})
 	}
 	if s.isIntegerGreaterThan(annualRawCoal, 100000) {
 		cells := []string{s.getCellPosition(TableType1, "annual_raw_coal", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "原料用煤（实物量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "原料用煤（实物量）不能大于100000", Cells: cells, RuleID: "T1-018"})
 	}
 	if s.isIntegerGreaterThan(annualRawCoalConsumption, 100000) {
 		cells := []string{s.getCellPosition(TableType1, "annual_raw_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "原煤消费（实物量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "原煤消费（实物量）不能大于100000", Cells: cells, RuleID: "T1-019"})
 	}
 	if s.isIntegerGreaterThan(annualCleanCoalConsumption, 100000) {
 		cells := []string{s.getCellPosition(TableType1, "annual_clean_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "洗精煤消费（实物量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "洗精煤消费（实物量）不能大于100000", Cells: cells, RuleID: "T1-020"})
 	}
 	if s.isIntegerGreaterThan(annualOtherCoalConsumption, 100000) {
 		cells := []string{s.getCellPosition(TableType1, "annual_other_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "其他煤炭消费（实物量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "其他煤炭消费（实物量）不能大于100000", Cells: cells, RuleID: "T1-021"})
 	}
 	if s.isIntegerGreaterThan(annualCokeConsumption, 100000) {
 		cells := []string{s.getCellPosition(TableType1, "annual_coke_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭消费（实物量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭消费（实物量）不能大于100000", Cells: cells, RuleID: "T1-022"})
 	}
 
 	// ③耗煤总量（实物量）≧耗煤总量（标准量）
@@ -765,6 +825,7 @@ func (s *DataImportService) validateTable1MainNumericFields(data map[string]inte
 			RowNumber: rowNum,
 			Message:   "耗煤总量（实物量）不能小于耗煤总量（标准量）",
 			Cells:     cells,
+			RuleID:    "T1-023",
 		})
 	}
 
@@ -779,6 +840,7 @@ func (s *DataImportService) validateTable1MainNumericFields(data map[string]inte
 			RowNumber: rowNum,
 			Message:   "耗煤总量（实物量）不能小于原料用煤（实物量）",
 			Cells:     cells,
+			RuleID:    "T1-024",
 		})
 	}
 
@@ -798,137 +860,164 @@ func (s *DataImportService) validateTable1MainNumericFields(data map[string]inte
 			RowNumber: rowNum,
 			Message:   "耗煤总量（实物量）应等于原煤消费+洗精煤消费+其他煤炭消费",
 			Cells:     cells,
+			RuleID:    "T1-025",
 		})
 	}
 
 	return errors
 }
 
+// validateTable1MainSoftRules 校验附表1主表软性规则，结果为警告级别，确认后允许导入。
+// unitRowNum为单位基本信息表格所在行号，为0时不校验联系电话
+func (s *DataImportService) validateTable1MainSoftRules(data db.EnterpriseCoalConsumptionMain, rowNum, unitRowNum int) []ValidationError {
+	errors := []ValidationError{}
+
+	// 1. 联系电话未填写（联系电话在单位基本信息表格的J列）
+	if data.Tel == "" {
+		if unitRowNum > 0 {
+			errors = append(errors, ValidationError{
+				RowNumber: unitRowNum,
+				Message:   "联系电话未填写",
+				Cells:     []string{fmt.Sprintf("J%d", unitRowNum)},
+				Severity:  SeverityWarning,
+				RuleID:    "T1-038",
+			})
+		}
+	}
+
+	annualTotalCoalConsumption := s.parseFloat(data.AnnualTotalCoalConsumption)
+	annualTotalCoalProducts := s.parseFloat(data.AnnualTotalCoalProducts)
+
+	// 2. 耗煤总量（标准量）/耗煤总量（实物量）低于0.4，折标系数异常
+	if s.isIntegerGreaterThan(annualTotalCoalConsumption, 0) && s.isIntegerLessThan(annualTotalCoalProducts, s.multiplyFloat64(annualTotalCoalConsumption, 0.4)) {
+		cells := []string{
+			s.getCellPosition(TableType1, "annual_total_coal_consumption", rowNum),
+			s.getCellPosition(TableType1, "annual_total_coal_products", rowNum),
+		}
+		errors = append(errors, ValidationError{
+			RowNumber: rowNum,
+			Message:   "耗煤总量（标准量）与耗煤总量（实物量）之比低于0.4，请核实折标系数",
+			Cells:     cells,
+			Severity:  SeverityWarning,
+			RuleID:    "T1-039",
+		})
+	}
+
+	// 3. 耗煤总量（实物量）与上年相比变化超过50%
+	creditCode := data.CreditCode
+	statYear, err := strconv.Atoi(data.StatDate)
+	if creditCode != "" && err == nil {
+		lastYear, exists, err := newRepository[db.EnterpriseCoalConsumptionMain](s).FindOne("credit_code = ? AND stat_date = ?", creditCode, strconv.Itoa(statYear-1))
+		if err == nil && exists {
+			lastYearTotal := s.parseFloat(lastYear.AnnualTotalCoalConsumption)
+			if s.isYearOverYearJump(annualTotalCoalConsumption, lastYearTotal) {
+				cells := []string{s.getCellPosition(TableType1, "annual_total_coal_consumption", rowNum)}
+				errors = append(errors, ValidationError{
+					RowNumber: rowNum,
+					Message:   fmt.Sprintf("耗煤总量（实物量）与上年（%s万吨）相比变化超过50%%，请核实", strconv.FormatFloat(lastYearTotal, 'f', -1, 64)),
+					Cells:     cells,
+					Severity:  SeverityWarning,
+					RuleID:    "T1-040",
+				})
+			}
+		}
+	}
+
+	return errors
+}
+
 // validateTable1UsageNumericFields 校验附表1用途表数值字段
-func (s *DataImportService) validateTable1UsageNumericFields(data map[string]interface{}, rowNum int) []ValidationError {
+func (s *DataImportService) validateTable1UsageNumericFields(data db.EnterpriseCoalConsumptionUsage, rowNum int) []ValidationError {
 	errors := []ValidationError{}
 
 	// 获取投入量和产出量
-	inputQuantity := s.parseFloat(s.getStringValue(data["input_quantity"]))
-	outputQuantity := s.parseFloat(s.getStringValue(data["output_quantity"]))
+	inputQuantity := s.parseFloat(data.InputQuantity)
+	outputQuantity := s.parseFloat(data.OutputQuantity)
 
 	// ①投入量≧0
 	if s.isIntegerLessThan(inputQuantity, 0) {
 		cells := []string{s.getCellPosition(TableType1, "input_quantity", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "投入量不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "投入量不能为负数", Cells: cells, RuleID: "T1-026"})
 	}
 
 	// ②投入量≦100000
 	if s.isIntegerGreaterThan(inputQuantity, 100000) {
 		cells := []string{s.getCellPosition(TableType1, "input_quantity", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "投入量不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "投入量不能大于100000", Cells: cells, RuleID: "T1-027"})
 	}
 
 	// 产出量≧0
 	if s.isIntegerLessThan(outputQuantity, 0) {
 		cells := []string{s.getCellPosition(TableType1, "output_quantity", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "产出量不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "产出量不能为负数", Cells: cells, RuleID: "T1-028"})
 	}
 
 	return errors
 }
 
 // validateTable1EquipNumericFields 校验附表1设备表数值字段
-func (s *DataImportService) validateTable1EquipNumericFields(data map[string]interface{}, rowNum int) []ValidationError {
+func (s *DataImportService) validateTable1EquipNumericFields(data db.EnterpriseCoalConsumptionEquip, rowNum int) []ValidationError {
 	errors := []ValidationError{}
 
 	// 获取设备相关数值
-	totalRuntime := s.parseFloat(s.getStringValue(data["total_runtime"]))
-	designLife := s.parseFloat(s.getStringValue(data["design_life"]))
-	energyEfficiency := s.parseFloat(s.getStringValue(data["energy_efficiency"]))
-	capacity := s.parseFloat(s.getStringValue(data["capacity"]))
-	annualCoalConsumption := s.parseFloat(s.getStringValue(data["annual_coal_consumption"]))
+	totalRuntime := s.parseFloat(data.TotalRuntime)
+	designLife := s.parseFloat(data.DesignLife)
+	energyEfficiency := s.parseFloat(data.EnergyEfficiency)
+	capacity := s.parseFloat(data.Capacity)
+	annualCoalConsumption := s.parseFloat(data.AnnualCoalConsumption)
 
 	// 1. 累计使用时间、设计年限校验
 	// 应为0-50（含0和50）间的整数
 	if s.isIntegerLessThan(totalRuntime, 0) || s.isIntegerGreaterThan(totalRuntime, 50) {
 		cells := []string{s.getCellPosition(TableType1, "total_runtime", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "累计使用时间应在0-50之间", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "累计使用时间应在0-50之间", Cells: cells, RuleID: "T1-029"})
 	}
 	// 检查是否为整数
 	if !s.isIntegerInteger(totalRuntime) {
 		cells := []string{s.getCellPosition(TableType1, "total_runtime", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "累计使用时间应为整数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "累计使用时间应为整数", Cells: cells, RuleID: "T1-030"})
 	}
 
 	if s.isIntegerLessThan(designLife, 0) || s.isIntegerGreaterThan(designLife, 50) {
 		cells := []string{s.getCellPosition(TableType1, "design_life", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "设计年限应在0-50之间", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "设计年限应在0-50之间", Cells: cells, RuleID: "T1-031"})
 	}
 	// 检查是否为整数
 	if !s.isIntegerInteger(designLife) {
 		cells := []string{s.getCellPosition(TableType1, "design_life", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "设计年限应为整数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "设计年限应为整数", Cells: cells, RuleID: "T1-032"})
 	}
 
 	// 2. 容量校验
 	// 应为正整数
 	if s.isIntegerLessThan(capacity, 0) {
 		cells := []string{s.getCellPosition(TableType1, "capacity", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "容量不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "容量不能为负数", Cells: cells, RuleID: "T1-033"})
 	}
 	// 检查是否为整数
 	if !s.isIntegerInteger(capacity) {
 		cells := []string{s.getCellPosition(TableType1, "capacity", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "容量应为整数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "容量应为整数", Cells: cells, RuleID: "T1-034"})
 	}
 
 	// 3. 年耗煤量校验
 	// ①≧0
 	if s.isIntegerLessThan(annualCoalConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType1, "annual_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年耗煤量不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年耗煤量不能为负数", Cells: cells, RuleID: "T1-035"})
 	}
 
 	// ②≦1000000000
 	if s.isIntegerGreaterThan(annualCoalConsumption, 1000000000) {
 		cells := []string{s.getCellPosition(TableType1, "annual_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年耗煤量不能大于1000000000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年耗煤量不能大于1000000000", Cells: cells, RuleID: "T1-036"})
 	}
 
 	// 能效水平校验（保持原有的非负校验）
 	if s.isIntegerLessThan(energyEfficiency, 0) {
 		cells := []string{s.getCellPosition(TableType1, "energy_efficiency", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "能效水平不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "能效水平不能为负数", Cells: cells, RuleID: "T1-037"})
 	}
 
 	return errors
 }
-
-// encryptTable1MainNumericFields 加密附表1主表数值字段
-func (s *DataImportService) encryptTable1MainNumericFields(record map[string]interface{}) map[string]interface{} {
-	numericFields := []string{
-		"annual_energy_equivalent_value",
-		"annual_energy_equivalent_cost",
-		"annual_raw_material_energy",
-		"annual_total_coal_consumption",
-		"annual_total_coal_products",
-		"annual_raw_coal",
-		"annual_raw_coal_consumption",
-		"annual_clean_coal_consumption",
-		"annual_other_coal_consumption",
-		"annual_coke_consumption",
-	}
-	return s.encryptNumericFields(record, numericFields)
-}
-
-// encryptTable1UsageNumericFields 加密附表1用途表数值字段
-func (s *DataImportService) encryptTable1UsageNumericFields(record map[string]interface{}) map[string]interface{} {
-	numericFields := []string{
-		"input_quantity", "output_quantity",
-	}
-	return s.encryptNumericFields(record, numericFields)
-}
-
-// encryptTable1EquipNumericFields 加密附表1设备表数值字段
-func (s *DataImportService) encryptTable1EquipNumericFields(record map[string]interface{}) map[string]interface{} {
-	numericFields := []string{
-		"total_runtime", "design_life", "energy_efficiency", "capacity", "annual_coal_consumption",
-	}
-	return s.encryptNumericFields(record, numericFields)
-}
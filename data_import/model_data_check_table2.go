@@ -1,12 +1,14 @@
 package data_import
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"shuji/db"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,11 +18,11 @@ import (
 // ModelDataCoverTable2 覆盖附表2数据
 func (s *DataImportService) ModelDataCoverTable2(filePaths []string) db.QueryResult {
 	// 使用包装函数来处理异常
-	return s.modelDataCoverTable2WithRecover(filePaths)
+	return s.modelDataCoverTable2WithRecover(filePaths, nil)
 }
 
-// modelDataCoverTable2WithRecover 带异常处理的覆盖附表2数据函数
-func (s *DataImportService) modelDataCoverTable2WithRecover(filePaths []string) db.QueryResult {
+// modelDataCoverTable2WithRecover 带异常处理的覆盖附表2数据函数，excludedKeys中的记录不覆盖
+func (s *DataImportService) modelDataCoverTable2WithRecover(filePaths []string, excludedKeys []string) db.QueryResult {
 	var result db.QueryResult
 
 	// 添加异常处理，防止函数崩溃
@@ -45,6 +47,11 @@ func (s *DataImportService) modelDataCoverTable2WithRecover(filePaths []string)
 		}
 	}
 
+	// 覆盖数据前为系统数据库创建快照
+	if snapshotResult := s.app.CreateSnapshot(SnapshotReasonCover); !snapshotResult.Ok {
+		return snapshotResult
+	}
+
 	var validationErrors []ValidationError
 	var failedFiles []string
 
@@ -75,6 +82,13 @@ func (s *DataImportService) modelDataCoverTable2WithRecover(filePaths []string)
 				continue
 			}
 
+			// 排除未确认覆盖的记录
+			mainData = filterCoverRecords(TableType2, mainData, excludedKeys)
+			if len(mainData) == 0 {
+				continue
+			}
+
+			s.setRecordsFileHash(mainData, s.getCacheFileHash(TableType2, file.Name()))
 			err = s.coverTable2Data(mainData, file.Name())
 			if err != nil {
 				validationErrors = append(validationErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 覆盖数据失败: %v", file.Name(), err)})
@@ -129,13 +143,27 @@ func (s *DataImportService) modelDataCheckTable2WithRecover() db.QueryResult {
 		return result
 	}
 
+	// 入库前检测批次内多个文件之间的重复数据，存在未处理的重复时由用户选择保留的文件
+	batchExclusions := s.loadBatchDuplicateResolution(TableType2)
+	if duplicateResult, exists := s.checkBatchDuplicates(TableType2, batchExclusions); exists {
+		return duplicateResult
+	}
+
 	var validationErrors []ValidationError = []ValidationError{} // 验证错误信息
 	var systemErrors []ValidationError = []ValidationError{}     // 系统错误信息
 	var importedFiles []string = []string{}                      // 导入的文件
 	var coverFiles []string = []string{}                         // 覆盖的文件
 	var failedFiles []string = []string{}                        // 失败的文件
+	var warningFiles []string = []string{}                       // 存在警告已确认导入的文件
 	var hasExcelFile bool = false                                // 是否有Excel文件
 
+	// 仅有警告的文件需用户确认后导入，未确认的文件保留在缓存目录中
+	warningAcks := s.loadWarningAcknowledgements(TableType2)
+	pendingWarnings := make(map[string]WarningAcknowledgement) // key: 文件名, value: 等待确认的警告
+
+	// 结构化校验结果，写入校验报告中的JSON、CSV文件
+	var reportEntries = []ValidationReportEntry{}
+
 	// 2. 循环调用对应的解析Excel函数
 	for _, file := range files {
 		// 检查是否xlsx或者xls文件
@@ -147,22 +175,41 @@ func (s *DataImportService) modelDataCheckTable2WithRecover() db.QueryResult {
 			f, err := excelize.OpenFile(filePath)
 			if err != nil {
 				systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 读取失败: %v", file.Name(), err)})
+				reportEntries = append(reportEntries, newFileValidationReportEntry(file.Name(), fmt.Sprintf("文件读取失败: %v", err)))
 				failedFiles = append(failedFiles, filePath)
 				continue
 			}
 
-			_, mainData, err := s.parseTable2Excel(f, true)
+			// 公式单元格只扫描计算一次，解析数据和公式校验共用
+			sheet, err := s.readFormulaSheet(f)
 			f.Close()
+			var mainData []map[string]interface{}
+			if err == nil {
+				_, mainData, err = s.parseTable2FormulaSheet(sheet, true)
+			}
+			mainData = filterCoverRecords(TableType2, mainData, batchExclusions[file.Name()])
+			var formulaErrors []ValidationError
+			if err == nil {
+				formulaErrors = s.validateFormulaCells(sheet.Cells, TableType2, mainData, "_excel_row")
+			}
 
 			if err != nil {
 				systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 解析失败: %v", file.Name(), err)})
+				reportEntries = append(reportEntries, newFileValidationReportEntry(file.Name(), fmt.Sprintf("文件解析失败: %v", err)))
 				failedFiles = append(failedFiles, filePath)
 				continue
 			}
 
+			// 批次内重复数据中未保留的记录不导入
+			if len(batchExclusions[file.Name()]) > 0 && len(mainData) == 0 {
+				os.Remove(filePath)
+				continue
+			}
+
 			// 4. 调用校验函数,对每一行数据验证
 			errors := s.validateTable2DataForModel(mainData)
-			if len(errors) > 0 {
+			errors = append(errors, formulaErrors...)
+			if hasBlockingErrors(errors) {
 				// 校验失败，在Excel文件中错误行最后添加错误信息
 				err = s.addValidationErrorsToExcelTable2(filePath, errors)
 
@@ -175,6 +222,7 @@ func (s *DataImportService) modelDataCheckTable2WithRecover() db.QueryResult {
 					systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 添加错误信息失败: %s", file.Name(), msg)})
 					continue
 				}
+				reportEntries = append(reportEntries, s.buildValidationReportEntries(filePath, TableType2, errors, validationRecordSet{mainData, "_excel_row"})...)
 				failedFiles = append(failedFiles, filePath)
 				// 将验证错误转换为字符串用于显示
 				var errorMessages []string
@@ -185,6 +233,13 @@ func (s *DataImportService) modelDataCheckTable2WithRecover() db.QueryResult {
 				continue
 			}
 
+			// 仅有警告的文件未经用户确认时不导入，保留文件等待确认
+			acknowledgement, acknowledged := checkWarningAcknowledged(warningAcks, file.Name(), errors)
+			if len(errors) > 0 && !acknowledged {
+				pendingWarnings[file.Name()] = WarningAcknowledgement{FileName: file.Name(), Warnings: getWarningMessages(errors)}
+				continue
+			}
+
 			// 5. 校验通过后,检查文件是否已导入
 			if s.isTable2FileImported(mainData) {
 				coverFiles = append(coverFiles, filePath)
@@ -192,18 +247,36 @@ func (s *DataImportService) modelDataCheckTable2WithRecover() db.QueryResult {
 			}
 
 			// 6. 如果没有导入过,把数据保存到相应的数据库表中
+			s.setRecordsFileHash(mainData, s.getCacheFileHash(TableType2, file.Name()))
 			err = s.saveTable2Data(mainData)
 			if err != nil {
 				systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 保存数据失败: %v", file.Name(), err)})
 				failedFiles = append(failedFiles, filePath)
 			} else {
+				importedFiles = append(importedFiles, file.Name())
+				// 仅有警告的文件记录确认信息，标注警告后放入校验报告
+				if len(errors) > 0 {
+					s.recordWarningAcknowledgement(file.Name(), TableType2, acknowledgement)
+					if s.addValidationErrorsToExcelTable2(filePath, errors) == nil {
+						reportEntries = append(reportEntries, s.buildValidationReportEntries(filePath, TableType2, errors, validationRecordSet{mainData, "_excel_row"})...)
+						warningFiles = append(warningFiles, filePath)
+						continue
+					}
+				}
 				// 删除该Excel文件
 				os.Remove(filePath)
-				importedFiles = append(importedFiles, file.Name())
 			}
 		}
 	}
 
+	// 批次内重复数据的处理结果只对本次校验有效
+	s.clearBatchDuplicateResolution(TableType2)
+
+	// 已导入文件的确认记录不再需要，只保留等待确认的文件
+	if err := s.saveWarningAcknowledgements(TableType2, pendingWarnings); err != nil {
+		systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("保存警告确认记录失败: %v", err)})
+	}
+
 	if !hasExcelFile {
 		result = db.QueryResult{
 			Ok:      false,
@@ -213,20 +286,27 @@ func (s *DataImportService) modelDataCheckTable2WithRecover() db.QueryResult {
 	}
 
 	// 7. 把所有的模型验证失败的文件打个zip包
-	if len(failedFiles) > 0 {
-		err = s.createValidationErrorZip(failedFiles, TableType2, TableName2)
+	reportFiles := append(append([]string{}, failedFiles...), warningFiles...)
+	if len(reportFiles) > 0 {
+		err = s.createValidationErrorZip(reportFiles, TableType2, TableName2, reportEntries)
 		if err != nil {
 			systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("创建错误报告失败: %v", err)})
 		}
 
-		// 删除失败文件
-		for _, filePath := range failedFiles {
+		// 删除报告中的文件
+		for _, filePath := range reportFiles {
 			os.Remove(filePath)
 		}
 	}
 
 	// 8. 返回结果
 	message := fmt.Sprintf("处理完成。成功导入: %d 个文件，失败: %d 个文件", len(importedFiles), len(failedFiles))
+	if len(warningFiles) > 0 {
+		message += fmt.Sprintf("，其中 %d 个文件存在警告已确认导入", len(warningFiles))
+	}
+	if len(pendingWarnings) > 0 {
+		message += fmt.Sprintf("，%d 个文件存在警告，确认后导入", len(pendingWarnings))
+	}
 	if len(systemErrors) > 0 {
 		// 将验证错误转换为字符串用于显示
 		var errorMessages []string
@@ -242,9 +322,10 @@ func (s *DataImportService) modelDataCheckTable2WithRecover() db.QueryResult {
 		Ok:      true,
 		Message: message,
 		Data: map[string]interface{}{
-			"cover_files":     coverFiles,                // 覆盖的文件
-			"hasExportReport": len(validationErrors) > 0, // 是否有导出报告
-			"hasFailedFiles":  len(failedFiles) > 0,      // 是否有失败的文件
+			"cover_files":     coverFiles,                                         // 覆盖的文件
+			"hasExportReport": len(validationErrors) > 0 || len(warningFiles) > 0, // 是否有导出报告
+			"hasFailedFiles":  len(failedFiles) > 0,                               // 是否有失败的文件
+			"warning_files":   getPendingWarningFiles(pendingWarnings),            // 存在警告等待确认的文件
 		},
 	}
 	return result
@@ -254,27 +335,58 @@ func (s *DataImportService) modelDataCheckTable2WithRecover() db.QueryResult {
 func (s *DataImportService) validateTable2DataForModel(mainData []map[string]interface{}) []ValidationError {
 	errors := []ValidationError{}
 
+	records, err := decodeRecords[db.CriticalCoalEquipmentConsumption](mainData)
+	if err != nil {
+		return []ValidationError{{RowNumber: 0, Message: fmt.Sprintf("数据格式错误: %v", err)}}
+	}
+
 	// 逐行校验数值字段
-	for _, data := range mainData {
+	for i, data := range records {
 		// 获取记录的实际Excel行号
-		excelRowNum := s.getExcelRowNumber(data)
+		excelRowNum := s.getExcelRowNumber(mainData[i])
 
 		// 数值字段校验
 		valueErrors := s.validateTable2NumericFieldsForModel(data, excelRowNum)
 		errors = append(errors, valueErrors...)
+
+		// 软性规则校验（警告，确认后允许导入）
+		softErrors := s.validateTable2SoftRules(data, excelRowNum)
+		errors = append(errors, softErrors...)
+	}
+
+	// 同一单位同一年份的设备类型和编号不能重复，否则按自然键保存时会相互覆盖
+	seen := map[string]int{}
+	for i, data := range records {
+		coalNo := strings.TrimSpace(data.CoalNo)
+		if coalNo == "" {
+			continue
+		}
+		excelRowNum := s.getExcelRowNumber(mainData[i])
+		key := strings.Join([]string{data.CreditCode, data.StatDate, strings.TrimSpace(data.CoalType), coalNo}, "|")
+		if firstRow, exists := seen[key]; exists {
+			cells := []string{s.getCellPosition(TableType2, "coal_type", excelRowNum), s.getCellPosition(TableType2, "coal_no", excelRowNum)}
+			errors = append(errors, ValidationError{
+				RowNumber: excelRowNum,
+				Message:   fmt.Sprintf("设备类型和编号与第%d行重复", firstRow),
+				Cells:     cells,
+				RuleID:    "T2-009",
+			})
+			continue
+		}
+		seen[key] = excelRowNum
 	}
 
 	return errors
 }
 
 // validateTable2NumericFieldsForModel 校验附表2数值字段（模型校验专用）
-func (s *DataImportService) validateTable2NumericFieldsForModel(data map[string]interface{}, rowNum int) []ValidationError {
+func (s *DataImportService) validateTable2NumericFieldsForModel(data db.CriticalCoalEquipmentConsumption, rowNum int) []ValidationError {
 	errors := []ValidationError{}
 
 	// 1. 累计使用时间、设计年限校验
 	// 应为0-50（含0和50）间的整数
-	totalRuntime := s.parseFloat(s.getStringValue(data["usage_time"]))
-	designLife := s.parseFloat(s.getStringValue(data["design_life"]))
+	totalRuntime := s.parseFloat(data.UsageTime)
+	designLife := s.parseFloat(data.DesignLife)
 
 	if s.isIntegerLessThan(totalRuntime, 0) || s.isIntegerGreaterThan(totalRuntime, 50) {
 		cells := []string{s.getCellPosition(TableType2, "usage_time", rowNum)}
@@ -282,6 +394,7 @@ func (s *DataImportService) validateTable2NumericFieldsForModel(data map[string]
 			RowNumber: rowNum,
 			Message:   "累计使用时间应在0-50之间",
 			Cells:     cells,
+			RuleID:    "T2-001",
 		})
 	}
 	if !s.isIntegerInteger(totalRuntime) {
@@ -290,6 +403,7 @@ func (s *DataImportService) validateTable2NumericFieldsForModel(data map[string]
 			RowNumber: rowNum,
 			Message:   "累计使用时间应为整数",
 			Cells:     cells,
+			RuleID:    "T2-002",
 		})
 	}
 
@@ -299,6 +413,7 @@ func (s *DataImportService) validateTable2NumericFieldsForModel(data map[string]
 			RowNumber: rowNum,
 			Message:   "设计年限应在0-50之间",
 			Cells:     cells,
+			RuleID:    "T2-003",
 		})
 	}
 	if !s.isIntegerInteger(designLife) {
@@ -307,18 +422,20 @@ func (s *DataImportService) validateTable2NumericFieldsForModel(data map[string]
 			RowNumber: rowNum,
 			Message:   "设计年限应为整数",
 			Cells:     cells,
+			RuleID:    "T2-004",
 		})
 	}
 
 	// 2. 容量校验
 	// 应为正整数
-	capacity := s.parseFloat(s.getStringValue(data["capacity"]))
+	capacity := s.parseFloat(data.Capacity)
 	if s.isIntegerLessThan(capacity, 0) {
 		cells := []string{s.getCellPosition(TableType2, "capacity", rowNum)}
 		errors = append(errors, ValidationError{
 			RowNumber: rowNum,
 			Message:   "容量不能为负数",
 			Cells:     cells,
+			RuleID:    "T2-005",
 		})
 	}
 	if !s.isIntegerInteger(capacity) {
@@ -327,18 +444,20 @@ func (s *DataImportService) validateTable2NumericFieldsForModel(data map[string]
 			RowNumber: rowNum,
 			Message:   "容量应为整数",
 			Cells:     cells,
+			RuleID:    "T2-006",
 		})
 	}
 
 	// 3. 年耗煤量校验
 	// ≧0且≦1000000000
-	annualCoalConsumption := s.parseFloat(s.getStringValue(data["annual_coal_consumption"]))
+	annualCoalConsumption := s.parseFloat(data.AnnualCoalConsumption)
 	if s.isIntegerLessThan(annualCoalConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType2, "annual_coal_consumption", rowNum)}
 		errors = append(errors, ValidationError{
 			RowNumber: rowNum,
 			Message:   "年耗煤量不能为负数",
 			Cells:     cells,
+			RuleID:    "T2-007",
 		})
 	}
 	if s.isIntegerGreaterThan(annualCoalConsumption, 1000000000) {
@@ -347,37 +466,61 @@ func (s *DataImportService) validateTable2NumericFieldsForModel(data map[string]
 			RowNumber: rowNum,
 			Message:   "年耗煤量不能大于1000000000",
 			Cells:     cells,
+			RuleID:    "T2-008",
 		})
 	}
 
 	return errors
 }
 
-// coverTable2Data 覆盖附表2数据
-func (s *DataImportService) coverTable2Data(mainData []map[string]interface{}, fileName string) error {
-	if len(mainData) == 0 {
-		return fmt.Errorf("数据为空")
-	}
+// validateTable2SoftRules 校验附表2软性规则，结果为警告级别，确认后允许导入
+func (s *DataImportService) validateTable2SoftRules(data db.CriticalCoalEquipmentConsumption, rowNum int) []ValidationError {
+	errors := []ValidationError{}
 
-	// 获取统一信用代码和年份
-	creditCode := s.getStringValue(mainData[0]["credit_code"])
-	statDate := s.getStringValue(mainData[0]["stat_date"])
+	// 1. 累计使用时间超过设计年限
+	usageTime := s.parseFloat(data.UsageTime)
+	designLife := s.parseFloat(data.DesignLife)
+	if s.isIntegerGreaterThan(designLife, 0) && s.isIntegerGreaterThan(usageTime, designLife) {
+		cells := []string{
+			s.getCellPosition(TableType2, "usage_time", rowNum),
+			s.getCellPosition(TableType2, "design_life", rowNum),
+		}
+		errors = append(errors, ValidationError{
+			RowNumber: rowNum,
+			Message:   "累计使用时间超过设计年限，请核实",
+			Cells:     cells,
+			Severity:  SeverityWarning,
+			RuleID:    "T2-010",
+		})
+	}
 
-	// 根据年份+统一信用代码删除表数据
-	err := s.deleteTable2DataByCreditCodeAndYear(creditCode, statDate)
-	if err != nil {
-		return fmt.Errorf("删除旧数据失败: %v", err)
+	// 2. 同一设备年耗煤量与上年相比变化超过50%
+	coalNo := strings.TrimSpace(data.CoalNo)
+	statYear, err := strconv.Atoi(data.StatDate)
+	if data.CreditCode != "" && coalNo != "" && err == nil {
+		lastYear, exists, err := newRepository[db.CriticalCoalEquipmentConsumption](s).FindOne("credit_code = ? AND coal_type = ? AND coal_no = ? AND stat_date = ?",
+			data.CreditCode, strings.TrimSpace(data.CoalType), coalNo, strconv.Itoa(statYear-1))
+		if err == nil && exists {
+			lastYearConsumption := s.parseFloat(lastYear.AnnualCoalConsumption)
+			if s.isYearOverYearJump(s.parseFloat(data.AnnualCoalConsumption), lastYearConsumption) {
+				cells := []string{s.getCellPosition(TableType2, "annual_coal_consumption", rowNum)}
+				errors = append(errors, ValidationError{
+					RowNumber: rowNum,
+					Message:   fmt.Sprintf("年耗煤量与上年（%s）相比变化超过50%%，请核实", strconv.FormatFloat(lastYearConsumption, 'f', -1, 64)),
+					Cells:     cells,
+					Severity:  SeverityWarning,
+					RuleID:    "T2-011",
+				})
+			}
+		}
 	}
 
-	// 插入新数据
-	return s.saveTable2Data(mainData)
+	return errors
 }
 
-// deleteTable2DataByCreditCodeAndYear 根据统一信用代码和年份删除附表2数据
-func (s *DataImportService) deleteTable2DataByCreditCodeAndYear(creditCode, statDate string) error {
-	query := "DELETE FROM critical_coal_equipment_consumption WHERE credit_code = ? AND stat_date = ?"
-	_, err := s.app.GetDB().Exec(query, creditCode, statDate)
-	return err
+// coverTable2Data 覆盖附表2数据，同一单位同一年份的装置清单整体替换
+func (s *DataImportService) coverTable2Data(mainData []map[string]interface{}, fileName string) error {
+	return s.saveTable2Data(mainData)
 }
 
 // isTable2FileImported 检查附表2文件是否已导入
@@ -389,42 +532,58 @@ func (s *DataImportService) isTable2FileImported(mainData []map[string]interface
 	creditCode := s.getStringValue(mainData[0]["credit_code"])
 	statDate := s.getStringValue(mainData[0]["stat_date"])
 
-	query := "SELECT COUNT(1) as count FROM critical_coal_equipment_consumption WHERE credit_code = ? AND stat_date = ?"
-	result, err := s.app.GetDB().QueryRow(query, creditCode, statDate)
-	if err != nil || result.Data == nil {
-		return false
-	}
+	count, err := newRepository[db.CriticalCoalEquipmentConsumption](s).Count("credit_code = ? AND stat_date = ?", creditCode, statDate)
+	return err == nil && count > 0
+}
 
-	return result.Data.(map[string]interface{})["count"].(int64) > 0
+// collectTable2UnitKeys 收集附表2数据中的统一信用代码和年份组合
+func (s *DataImportService) collectTable2UnitKeys(mainData []map[string]interface{}) [][2]string {
+	var unitKeys [][2]string
+	for _, record := range mainData {
+		unitKey := [2]string{s.getStringValue(record["credit_code"]), s.getStringValue(record["stat_date"])}
+		if !slices.Contains(unitKeys, unitKey) {
+			unitKeys = append(unitKeys, unitKey)
+		}
+	}
+	return unitKeys
 }
 
-// saveTable2Data 保存附表2数据到数据库
+// saveTable2Data 保存附表2数据到数据库，同一单位同一年份的数据已存在时覆盖
 func (s *DataImportService) saveTable2Data(mainData []map[string]interface{}) error {
-	for _, record := range mainData {
-		record["obj_id"] = s.generateUUID()
-		record["create_time"] = time.Now().UnixMilli()
-
-		// 对数值字段进行SM4加密
-		encryptedValues := s.encryptTable2NumericFields(record)
-
-		query := `INSERT INTO critical_coal_equipment_consumption (
-			obj_id, stat_date, create_time, unit_name, credit_code, trade_a, trade_b, trade_c,
-			province_name, city_name, country_name, coal_type, coal_no, usage_time, design_life,
-			enecrgy_efficienct_bmk, capacity_unit, capacity, use_info, status, annual_coal_consumption, create_user, row_no, is_check
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-		_, err := s.app.GetDB().Exec(query,
-			record["obj_id"], record["stat_date"], record["create_time"], record["unit_name"],
-			record["credit_code"], record["trade_a"], record["trade_b"], record["trade_c"],
-			record["province_name"], record["city_name"], record["country_name"], record["coal_type"],
-			record["coal_no"], record["usage_time"], encryptedValues["design_life"], record["enecrgy_efficienct_bmk"],
-			record["capacity_unit"], encryptedValues["capacity"], record["use_info"], record["status"],
-			encryptedValues["annual_coal_consumption"], s.app.GetAreaStr(), record["row_no"], EncryptedOne)
-		if err != nil {
-			return fmt.Errorf("保存数据失败: %v", err)
+	// 已报送的年份不允许写入数据
+	if err := s.checkRecordsWritable(mainData); err != nil {
+		return err
+	}
+
+	records, err := decodeRecords[db.CriticalCoalEquipmentConsumption](mainData)
+	if err != nil {
+		return fmt.Errorf("数据格式错误: %v", err)
+	}
+	createTime := time.Now().UnixMilli()
+	createUser := s.app.GetAreaStr()
+	for i := range records {
+		records[i].ObjID = s.generateUUID()
+		records[i].CreateTime = createTime
+		records[i].CreateUser = createUser
+		records[i].IsConfirm = "0"
+		records[i].IsCheck = "1"
+	}
+
+	// 同一文件的数据在同一事务中写入，任一行失败时全部回滚。
+	// 文件中单位和年份的原有装置先删除，同一文件中类型和编号相同的装置按自然键合并
+	err = s.app.GetDB().WithTx(func(tx *sql.Tx) error {
+		for _, unitKey := range s.collectTable2UnitKeys(mainData) {
+			if _, err := tx.Exec("DELETE FROM critical_coal_equipment_consumption WHERE credit_code = ? AND stat_date = ?", unitKey[0], unitKey[1]); err != nil {
+				return fmt.Errorf("删除旧数据失败: %v", err)
+			}
 		}
+		return upsertRecordsTx(tx, newRepository[db.CriticalCoalEquipmentConsumption](s), records)
+	})
+	if err != nil {
+		return fmt.Errorf("保存数据失败: %v", err)
 	}
 
+	s.advanceSubmissionStatus(s.collectStatDates(mainData), SubmissionEventImport)
 	return nil
 }
 
@@ -438,25 +597,25 @@ func (s *DataImportService) addValidationErrorsToExcelTable2(filePath string, er
 
 	// 创建错误信息映射
 	errorMap := make(map[int]string)
-	// 收集所有需要高亮的单元格
-	var allCells []string
+	// 记录每行最严重的级别，用于设置错误信息列的颜色
+	severityMap := make(map[int]string)
 
 	for _, err := range errors {
+		message := formatValidationMessage(err)
 		// 如果该行已有错误信息，则追加
 		if existing, exists := errorMap[err.RowNumber]; exists {
-			errorMap[err.RowNumber] = existing + "; " + err.Message
+			errorMap[err.RowNumber] = existing + "; " + message
 		} else {
-			errorMap[err.RowNumber] = err.Message
+			errorMap[err.RowNumber] = message
 		}
 
-		// 收集涉及到的单元格
-		if err.Cells != nil {
-			allCells = append(allCells, err.Cells...)
+		if current, exists := severityMap[err.RowNumber]; !exists || getSeverityRank(err.Severity) > getSeverityRank(current) {
+			severityMap[err.RowNumber] = err.Severity
 		}
 	}
 
 	// 获取所有工作表
-	sheets := f.GetSheetList()
+	sheets := getDataSheetList(f)
 	if len(sheets) == 0 {
 		return fmt.Errorf("Excel文件没有工作表")
 	}
@@ -464,12 +623,10 @@ func (s *DataImportService) addValidationErrorsToExcelTable2(filePath string, er
 	// 处理第一个工作表
 	sheetName := sheets[0]
 
-	// 高亮涉及到的单元格
-	if len(allCells) > 0 {
-		err = s.highlightCellsInExcel(f, sheetName, allCells)
-		if err != nil {
-			fmt.Printf("高亮单元格失败: %v\n", err)
-		}
+	// 按级别高亮涉及到的单元格
+	err = s.highlightValidationCells(f, sheetName, errors)
+	if err != nil {
+		fmt.Printf("高亮单元格失败: %v\n", err)
 	}
 
 	maxCol := 11
@@ -489,7 +646,7 @@ func (s *DataImportService) addValidationErrorsToExcelTable2(filePath string, er
 		f.SetCellValue(sheetName, errorCellName, formattedErrorMsg)
 
 		style, err := f.NewStyle(&excelize.Style{
-			Fill: excelize.Fill{Type: "pattern", Color: []string{"FFFF00"}, Pattern: 1},
+			Fill: excelize.Fill{Type: "pattern", Color: []string{getSeverityColor(severityMap[excelRow])}, Pattern: 1},
 			Alignment: &excelize.Alignment{
 				Vertical: "center",
 			},
@@ -505,12 +662,11 @@ func (s *DataImportService) addValidationErrorsToExcelTable2(filePath string, er
 		f.SetColWidth(sheetName, colName, colName, 50)
 	}
 
+	// 添加单元格批注和校验结果汇总表
+	if err := s.addValidationReport(f, sheetName, errors); err != nil {
+		fmt.Printf("添加校验结果汇总失败: %v\n", err)
+	}
+
 	// 保存文件
 	return f.Save()
 }
-
-// encryptTable2NumericFields 加密附表2数值字段
-func (s *DataImportService) encryptTable2NumericFields(record map[string]interface{}) map[string]interface{} {
-	numericFields := []string{"annual_coal_consumption", "design_life", "capacity"}
-	return s.encryptNumericFields(record, numericFields)
-}
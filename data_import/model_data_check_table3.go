@@ -1,6 +1,7 @@
 package data_import
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"os"
@@ -16,11 +17,11 @@ import (
 // ModelDataCoverTable3 覆盖附表3数据
 func (s *DataImportService) ModelDataCoverTable3(filePaths []string) db.QueryResult {
 	// 使用包装函数来处理异常
-	return s.modelDataCoverTable3WithRecover(filePaths)
+	return s.modelDataCoverTable3WithRecover(filePaths, nil)
 }
 
-// modelDataCoverTable3WithRecover 带异常处理的覆盖附表3数据函数
-func (s *DataImportService) modelDataCoverTable3WithRecover(filePaths []string) db.QueryResult {
+// modelDataCoverTable3WithRecover 带异常处理的覆盖附表3数据函数，excludedKeys中的记录不覆盖
+func (s *DataImportService) modelDataCoverTable3WithRecover(filePaths []string, excludedKeys []string) db.QueryResult {
 	var result db.QueryResult
 
 	// 添加异常处理，防止函数崩溃
@@ -46,6 +47,11 @@ func (s *DataImportService) modelDataCoverTable3WithRecover(filePaths []string)
 		return result
 	}
 
+	// 覆盖数据前为系统数据库创建快照
+	if snapshotResult := s.app.CreateSnapshot(SnapshotReasonCover); !snapshotResult.Ok {
+		return snapshotResult
+	}
+
 	var validationErrors []ValidationError
 	var failedFiles []string
 
@@ -76,6 +82,13 @@ func (s *DataImportService) modelDataCoverTable3WithRecover(filePaths []string)
 				continue
 			}
 
+			// 排除未确认覆盖的记录
+			mainData = filterCoverRecords(TableType3, mainData, excludedKeys)
+			if len(mainData) == 0 {
+				continue
+			}
+
+			s.setRecordsFileHash(mainData, s.getCacheFileHash(TableType3, file.Name()))
 			err = s.coverTable3Data(mainData, file.Name())
 			if err != nil {
 				validationErrors = append(validationErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 覆盖数据失败: %v", file.Name(), err)})
@@ -130,13 +143,27 @@ func (s *DataImportService) modelDataCheckTable3WithRecover() db.QueryResult {
 		return result
 	}
 
+	// 入库前检测批次内多个文件之间的重复数据，存在未处理的重复时由用户选择保留的文件
+	batchExclusions := s.loadBatchDuplicateResolution(TableType3)
+	if duplicateResult, exists := s.checkBatchDuplicates(TableType3, batchExclusions); exists {
+		return duplicateResult
+	}
+
 	var validationErrors []ValidationError = []ValidationError{} // 验证错误信息
 	var systemErrors []ValidationError = []ValidationError{}     // 系统错误信息
 	var importedFiles []string = []string{}                      // 导入的文件
 	var coverFiles []string = []string{}                         // 覆盖的文件
 	var failedFiles []string = []string{}                        // 失败的文件
+	var warningFiles []string = []string{}                       // 存在警告已确认导入的文件
 	var hasExcelFile bool = false                                // 是否有Excel文件
 
+	// 仅有警告的文件需用户确认后导入，未确认的文件保留在缓存目录中
+	warningAcks := s.loadWarningAcknowledgements(TableType3)
+	pendingWarnings := make(map[string]WarningAcknowledgement) // key: 文件名, value: 等待确认的警告
+
+	// 结构化校验结果，写入校验报告中的JSON、CSV文件
+	var reportEntries = []ValidationReportEntry{}
+
 	// 2. 循环调用对应的解析Excel函数
 	for _, file := range files {
 		// 检查是否xlsx或者xls文件
@@ -148,27 +175,47 @@ func (s *DataImportService) modelDataCheckTable3WithRecover() db.QueryResult {
 			f, err := excelize.OpenFile(filePath)
 			if err != nil {
 				systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 读取失败: %v", file.Name(), err)})
+				reportEntries = append(reportEntries, newFileValidationReportEntry(file.Name(), fmt.Sprintf("文件读取失败: %v", err)))
 				failedFiles = append(failedFiles, filePath)
 				continue
 			}
 
-			mainData, err := s.parseTable3Excel(f, true)
+			// 公式单元格只扫描计算一次，解析数据和公式校验共用
+			sheet, err := s.readFormulaSheet(f)
 			f.Close()
+			var mainData []map[string]interface{}
+			if err == nil {
+				mainData, err = s.parseTable3FormulaSheet(sheet, true)
+			}
+			mainData = filterCoverRecords(TableType3, mainData, batchExclusions[file.Name()])
+			var formulaErrors []ValidationError
+			if err == nil {
+				formulaErrors = s.validateFormulaCells(sheet.Cells, TableType3, mainData, "_excel_row")
+			}
 
 			if err != nil {
 				systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 解析失败: %v", file.Name(), err)})
+				reportEntries = append(reportEntries, newFileValidationReportEntry(file.Name(), fmt.Sprintf("文件解析失败: %v", err)))
 				failedFiles = append(failedFiles, filePath)
 				continue
 			}
 
+			// 批次内重复数据中未保留的记录不导入
+			if len(batchExclusions[file.Name()]) > 0 && len(mainData) == 0 {
+				os.Remove(filePath)
+				continue
+			}
+
 			// 4. 调用校验函数,对每一行数据验证
 			errors := s.validateTable3DataForModel(mainData)
-			if len(errors) > 0 {
+			errors = append(errors, formulaErrors...)
+			if hasBlockingErrors(errors) {
 				// 校验失败，在Excel文件中错误行最后添加错误信息
 				err = s.addValidationErrorsToExcelTable3(filePath, errors, mainData)
 				if err != nil {
 					systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 添加错误信息失败: %v", file.Name(), err)})
 				}
+				reportEntries = append(reportEntries, s.buildValidationReportEntries(filePath, TableType3, errors, validationRecordSet{mainData, "_excel_row"})...)
 				failedFiles = append(failedFiles, filePath)
 				// 将验证错误转换为字符串用于显示
 				var errorMessages []string
@@ -179,6 +226,13 @@ func (s *DataImportService) modelDataCheckTable3WithRecover() db.QueryResult {
 				continue
 			}
 
+			// 仅有警告的文件未经用户确认时不导入，保留文件等待确认
+			acknowledgement, acknowledged := checkWarningAcknowledged(warningAcks, file.Name(), errors)
+			if len(errors) > 0 && !acknowledged {
+				pendingWarnings[file.Name()] = WarningAcknowledgement{FileName: file.Name(), Warnings: getWarningMessages(errors)}
+				continue
+			}
+
 			// 5. 校验通过后,检查文件是否已导入
 			if s.isTable3FileImported(mainData) {
 				coverFiles = append(coverFiles, filePath)
@@ -186,18 +240,36 @@ func (s *DataImportService) modelDataCheckTable3WithRecover() db.QueryResult {
 			}
 
 			// 6. 如果没有导入过,把数据保存到相应的数据库表中
+			s.setRecordsFileHash(mainData, s.getCacheFileHash(TableType3, file.Name()))
 			err = s.saveTable3DataForModel(mainData)
 			if err != nil {
 				systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("文件 %s 保存数据失败: %v", file.Name(), err)})
 				failedFiles = append(failedFiles, filePath)
 			} else {
+				importedFiles = append(importedFiles, file.Name())
+				// 仅有警告的文件记录确认信息，标注警告后放入校验报告
+				if len(errors) > 0 {
+					s.recordWarningAcknowledgement(file.Name(), TableType3, acknowledgement)
+					if s.addValidationErrorsToExcelTable3(filePath, errors, mainData) == nil {
+						reportEntries = append(reportEntries, s.buildValidationReportEntries(filePath, TableType3, errors, validationRecordSet{mainData, "_excel_row"})...)
+						warningFiles = append(warningFiles, filePath)
+						continue
+					}
+				}
 				// 删除该Excel文件
 				os.Remove(filePath)
-				importedFiles = append(importedFiles, file.Name())
 			}
 		}
 	}
 
+	// 批次内重复数据的处理结果只对本次校验有效
+	s.clearBatchDuplicateResolution(TableType3)
+
+	// 已导入文件的确认记录不再需要，只保留等待确认的文件
+	if err := s.saveWarningAcknowledgements(TableType3, pendingWarnings); err != nil {
+		systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("保存警告确认记录失败: %v", err)})
+	}
+
 	if !hasExcelFile {
 		result = db.QueryResult{
 			Ok:      false,
@@ -207,20 +279,27 @@ func (s *DataImportService) modelDataCheckTable3WithRecover() db.QueryResult {
 	}
 
 	// 7. 把所有的模型验证失败的文件打个zip包
-	if len(failedFiles) > 0 {
-		err = s.createValidationErrorZip(failedFiles, TableType3, TableName3)
+	reportFiles := append(append([]string{}, failedFiles...), warningFiles...)
+	if len(reportFiles) > 0 {
+		err = s.createValidationErrorZip(reportFiles, TableType3, TableName3, reportEntries)
 		if err != nil {
 			systemErrors = append(systemErrors, ValidationError{RowNumber: 0, Message: fmt.Sprintf("创建错误报告失败: %v", err)})
 		}
 
-		// 删除失败文件
-		for _, filePath := range failedFiles {
+		// 删除报告中的文件
+		for _, filePath := range reportFiles {
 			os.Remove(filePath)
 		}
 	}
 
 	// 8. 返回结果
 	message := fmt.Sprintf("处理完成。成功导入: %d 个文件，失败: %d 个文件", len(importedFiles), len(failedFiles))
+	if len(warningFiles) > 0 {
+		message += fmt.Sprintf("，其中 %d 个文件存在警告已确认导入", len(warningFiles))
+	}
+	if len(pendingWarnings) > 0 {
+		message += fmt.Sprintf("，%d 个文件存在警告，确认后导入", len(pendingWarnings))
+	}
 	if len(systemErrors) > 0 {
 		// 将验证错误转换为字符串用于显示
 		var errorMessages []string
@@ -236,9 +315,10 @@ func (s *DataImportService) modelDataCheckTable3WithRecover() db.QueryResult {
 		Ok:      true,
 		Message: message,
 		Data: map[string]interface{}{
-			"cover_files":     coverFiles,                // 覆盖的文件
-			"hasExportReport": len(validationErrors) > 0, // 是否有导出报告
-			"hasFailedFiles":  len(failedFiles) > 0,      // 是否有失败的文件
+			"cover_files":     coverFiles,                                         // 覆盖的文件
+			"hasExportReport": len(validationErrors) > 0 || len(warningFiles) > 0, // 是否有导出报告
+			"hasFailedFiles":  len(failedFiles) > 0,                               // 是否有失败的文件
+			"warning_files":   getPendingWarningFiles(pendingWarnings),            // 存在警告等待确认的文件
 		},
 	}
 	return result
@@ -248,10 +328,15 @@ func (s *DataImportService) modelDataCheckTable3WithRecover() db.QueryResult {
 func (s *DataImportService) validateTable3DataForModel(mainData []map[string]interface{}) []ValidationError {
 	errors := []ValidationError{}
 
+	records, err := decodeRecords[db.FixedAssetsInvestmentProject](mainData)
+	if err != nil {
+		return []ValidationError{{RowNumber: 0, Message: fmt.Sprintf("数据格式错误: %v", err)}}
+	}
+
 	// 逐行校验数值字段、新增校验规则和整体规则（行内字段间逻辑关系）
-	for _, data := range mainData {
+	for i, data := range records {
 		// 获取记录的实际Excel行号
-		excelRowNum := s.getExcelRowNumber(data)
+		excelRowNum := s.getExcelRowNumber(mainData[i])
 
 		// 数值字段校验
 		valueErrors := s.validateTable3NumericFields(data, excelRowNum)
@@ -260,25 +345,30 @@ func (s *DataImportService) validateTable3DataForModel(mainData []map[string]int
 		// 整体规则校验（行内字段间逻辑关系）
 		overallErrors := s.validateTable3OverallRulesForRow(data, excelRowNum)
 		errors = append(errors, overallErrors...)
+
+		// 软性规则校验（警告，确认后允许导入）
+		softErrors := s.validateTable3SoftRules(data, excelRowNum)
+		errors = append(errors, softErrors...)
 	}
 
 	return errors
 }
 
 // validateTable3NumericFields 校验附表3数值字段
-func (s *DataImportService) validateTable3NumericFields(data map[string]interface{}, rowNum int) []ValidationError {
+func (s *DataImportService) validateTable3NumericFields(data db.FixedAssetsInvestmentProject, rowNum int) []ValidationError {
 	errors := []ValidationError{}
 
 	// 1. 年综合能源消费量部分校验
 	// 当量值、等价值校验规则：①≧0；②≦100000
-	equivalentValue := s.parseFloat(s.getStringValue(data["equivalent_value"]))
-	equivalentCost := s.parseFloat(s.getStringValue(data["equivalent_cost"]))
+	equivalentValue := s.parseFloat(data.EquivalentValue)
+	equivalentCost := s.parseFloat(data.EquivalentCost)
 
 	if s.isIntegerLessThan(equivalentValue, 0) {
 		errors = append(errors, ValidationError{
 			RowNumber: rowNum,
 			Message:   "年综合能源消费量当量值不能为负数",
 			Cells:     []string{s.getCellPosition(TableType3, "equivalent_value", rowNum)},
+			RuleID:    "T3-001",
 		})
 	}
 	if s.isIntegerGreaterThan(equivalentValue, 100000) {
@@ -286,6 +376,7 @@ func (s *DataImportService) validateTable3NumericFields(data map[string]interfac
 			RowNumber: rowNum,
 			Message:   "年综合能源消费量当量值不能大于100000",
 			Cells:     []string{s.getCellPosition(TableType3, "equivalent_value", rowNum)},
+			RuleID:    "T3-002",
 		})
 	}
 
@@ -294,6 +385,7 @@ func (s *DataImportService) validateTable3NumericFields(data map[string]interfac
 			RowNumber: rowNum,
 			Message:   "年综合能源消费量等价值不能为负数",
 			Cells:     []string{s.getCellPosition(TableType3, "equivalent_cost", rowNum)},
+			RuleID:    "T3-003",
 		})
 	}
 	if s.isIntegerGreaterThan(equivalentCost, 100000) {
@@ -301,90 +393,91 @@ func (s *DataImportService) validateTable3NumericFields(data map[string]interfac
 			RowNumber: rowNum,
 			Message:   "年综合能源消费量等价值不能大于100000",
 			Cells:     []string{s.getCellPosition(TableType3, "equivalent_cost", rowNum)},
+			RuleID:    "T3-004",
 		})
 	}
 
 	// 2. 年煤品消费量部分校验
 	// 煤品消费总量（实物量）、煤炭消费量（实物量）、焦炭消费量（实物量）、兰炭消费量（实物量）
 	// 煤品消费总量（折标量）、煤炭消费量（折标量）、焦炭消费量（折标量）、兰炭消费量（折标量）
-	pqTotalCoalConsumption := s.parseFloat(s.getStringValue(data["pq_total_coal_consumption"]))
-	pqCoalConsumption := s.parseFloat(s.getStringValue(data["pq_coal_consumption"]))
-	pqCokeConsumption := s.parseFloat(s.getStringValue(data["pq_coke_consumption"]))
-	pqBlueCokeConsumption := s.parseFloat(s.getStringValue(data["pq_blue_coke_consumption"]))
+	pqTotalCoalConsumption := s.parseFloat(data.PqTotalCoalConsumption)
+	pqCoalConsumption := s.parseFloat(data.PqCoalConsumption)
+	pqCokeConsumption := s.parseFloat(data.PqCokeConsumption)
+	pqBlueCokeConsumption := s.parseFloat(data.PqBlueCokeConsumption)
 
-	sceTotalCoalConsumption := s.parseFloat(s.getStringValue(data["sce_total_coal_consumption"]))
-	sceCoalConsumption := s.parseFloat(s.getStringValue(data["sce_coal_consumption"]))
-	sceCokeConsumption := s.parseFloat(s.getStringValue(data["sce_coke_consumption"]))
-	sceBlueCokeConsumption := s.parseFloat(s.getStringValue(data["sce_blue_coke_consumption"]))
+	sceTotalCoalConsumption := s.parseFloat(data.SceTotalCoalConsumption)
+	sceCoalConsumption := s.parseFloat(data.SceCoalConsumption)
+	sceCokeConsumption := s.parseFloat(data.SceCokeConsumption)
+	sceBlueCokeConsumption := s.parseFloat(data.SceBlueCokeConsumption)
 
 	// ①≧0
 	if s.isIntegerLessThan(pqTotalCoalConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType3, "pq_total_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤品消费总量（实物量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤品消费总量（实物量）不能为负数", Cells: cells, RuleID: "T3-005"})
 	}
 	if s.isIntegerLessThan(pqCoalConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType3, "pq_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭消费量（实物量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭消费量（实物量）不能为负数", Cells: cells, RuleID: "T3-006"})
 	}
 	if s.isIntegerLessThan(pqCokeConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType3, "pq_coke_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭消费量（实物量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭消费量（实物量）不能为负数", Cells: cells, RuleID: "T3-007"})
 	}
 	if s.isIntegerLessThan(pqBlueCokeConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType3, "pq_blue_coke_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "兰炭消费量（实物量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "兰炭消费量（实物量）不能为负数", Cells: cells, RuleID: "T3-008"})
 	}
 
 	if s.isIntegerLessThan(sceTotalCoalConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType3, "sce_total_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤品消费总量（折标量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤品消费总量（折标量）不能为负数", Cells: cells, RuleID: "T3-009"})
 	}
 	if s.isIntegerLessThan(sceCoalConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType3, "sce_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭消费量（折标量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭消费量（折标量）不能为负数", Cells: cells, RuleID: "T3-010"})
 	}
 	if s.isIntegerLessThan(sceCokeConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType3, "sce_coke_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭消费量（折标量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭消费量（折标量）不能为负数", Cells: cells, RuleID: "T3-011"})
 	}
 	if s.isIntegerLessThan(sceBlueCokeConsumption, 0) {
 		cells := []string{s.getCellPosition(TableType3, "sce_blue_coke_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "兰炭消费量（折标量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "兰炭消费量（折标量）不能为负数", Cells: cells, RuleID: "T3-012"})
 	}
 
 	// ②≦100000
 	if s.isIntegerGreaterThan(pqTotalCoalConsumption, 100000) {
 		cells := []string{s.getCellPosition(TableType3, "pq_total_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤品消费总量（实物量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤品消费总量（实物量）不能大于100000", Cells: cells, RuleID: "T3-013"})
 	}
 	if s.isIntegerGreaterThan(pqCoalConsumption, 100000) {
 		cells := []string{s.getCellPosition(TableType3, "pq_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭消费量（实物量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭消费量（实物量）不能大于100000", Cells: cells, RuleID: "T3-014"})
 	}
 	if s.isIntegerGreaterThan(pqCokeConsumption, 100000) {
 		cells := []string{s.getCellPosition(TableType3, "pq_coke_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭消费量（实物量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭消费量（实物量）不能大于100000", Cells: cells, RuleID: "T3-015"})
 	}
 	if s.isIntegerGreaterThan(pqBlueCokeConsumption, 100000) {
 		cells := []string{s.getCellPosition(TableType3, "pq_blue_coke_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "兰炭消费量（实物量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "兰炭消费量（实物量）不能大于100000", Cells: cells, RuleID: "T3-016"})
 	}
 
 	if s.isIntegerGreaterThan(sceTotalCoalConsumption, 100000) {
 		cells := []string{s.getCellPosition(TableType3, "sce_total_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤品消费总量（折标量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤品消费总量（折标量）不能大于100000", Cells: cells, RuleID: "T3-017"})
 	}
 	if s.isIntegerGreaterThan(sceCoalConsumption, 100000) {
 		cells := []string{s.getCellPosition(TableType3, "sce_coal_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭消费量（折标量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭消费量（折标量）不能大于100000", Cells: cells, RuleID: "T3-018"})
 	}
 	if s.isIntegerGreaterThan(sceCokeConsumption, 100000) {
 		cells := []string{s.getCellPosition(TableType3, "sce_coke_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭消费量（折标量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "焦炭消费量（折标量）不能大于100000", Cells: cells, RuleID: "T3-019"})
 	}
 	if s.isIntegerGreaterThan(sceBlueCokeConsumption, 100000) {
 		cells := []string{s.getCellPosition(TableType3, "sce_blue_coke_consumption", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "兰炭消费量（折标量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "兰炭消费量（折标量）不能大于100000", Cells: cells, RuleID: "T3-020"})
 	}
 
 	// ③煤炭消费量（实物量）≧煤炭消费量（折标量）
@@ -397,6 +490,7 @@ func (s *DataImportService) validateTable3NumericFields(data map[string]interfac
 			RowNumber: rowNum,
 			Message:   "煤炭消费量（实物量）应大于等于煤炭消费量（折标量）",
 			Cells:     cells,
+			RuleID:    "T3-021",
 		})
 	}
 
@@ -410,6 +504,7 @@ func (s *DataImportService) validateTable3NumericFields(data map[string]interfac
 			RowNumber: rowNum,
 			Message:   "焦炭消费量（实物量）应大于等于焦炭消费量（折标量）",
 			Cells:     cells,
+			RuleID:    "T3-022",
 		})
 	}
 
@@ -423,6 +518,7 @@ func (s *DataImportService) validateTable3NumericFields(data map[string]interfac
 			RowNumber: rowNum,
 			Message:   "兰炭消费量（实物量）应大于等于兰炭消费量（折标量）",
 			Cells:     cells,
+			RuleID:    "T3-023",
 		})
 	}
 
@@ -439,6 +535,7 @@ func (s *DataImportService) validateTable3NumericFields(data map[string]interfac
 			RowNumber: rowNum,
 			Message:   "煤品消费总量（实物量）应等于煤炭消费量+焦炭消费量+兰炭消费量",
 			Cells:     cells,
+			RuleID:    "T3-024",
 		})
 	}
 
@@ -456,43 +553,44 @@ func (s *DataImportService) validateTable3NumericFields(data map[string]interfac
 			RowNumber: rowNum,
 			Message:   "煤品消费总量（折标量）应等于煤炭消费量+焦炭消费量+兰炭消费量",
 			Cells:     cells,
+			RuleID:    "T3-025",
 		})
 	}
 
 	// 3. 煤炭消费替代情况部分校验
 	// 煤炭消费替代量（实物量）规则：①≧0；②≦100000
-	substitutionQuantity := s.parseFloat(s.getStringValue(data["substitution_quantity"]))
+	substitutionQuantity := s.parseFloat(data.SubstitutionQuantity)
 
 	if s.isIntegerLessThan(substitutionQuantity, 0) {
 		cells := []string{s.getCellPosition(TableType3, "substitution_quantity", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭消费替代量（实物量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭消费替代量（实物量）不能为负数", Cells: cells, RuleID: "T3-026"})
 	}
 	if s.isIntegerGreaterThan(substitutionQuantity, 100000) {
 		cells := []string{s.getCellPosition(TableType3, "substitution_quantity", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭消费替代量（实物量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤炭消费替代量（实物量）不能大于100000", Cells: cells, RuleID: "T3-027"})
 	}
 
 	// 4. 原料用煤部分校验
 	// 年原料用煤量（实物量）、年原料用煤量（折标量）规则：①≧0；②≦100000；③年原料用煤量（实物量）≧年原料用煤量（折标量）
-	pqAnnualCoalQuantity := s.parseFloat(s.getStringValue(data["pq_annual_coal_quantity"]))
-	sceAnnualCoalQuantity := s.parseFloat(s.getStringValue(data["sce_annual_coal_quantity"]))
+	pqAnnualCoalQuantity := s.parseFloat(data.PqAnnualCoalQuantity)
+	sceAnnualCoalQuantity := s.parseFloat(data.SceAnnualCoalQuantity)
 
 	if s.isIntegerLessThan(pqAnnualCoalQuantity, 0) {
 		cells := []string{s.getCellPosition(TableType3, "pq_annual_coal_quantity", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用煤量（实物量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用煤量（实物量）不能为负数", Cells: cells, RuleID: "T3-028"})
 	}
 	if s.isIntegerGreaterThan(pqAnnualCoalQuantity, 100000) {
 		cells := []string{s.getCellPosition(TableType3, "pq_annual_coal_quantity", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用煤量（实物量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用煤量（实物量）不能大于100000", Cells: cells, RuleID: "T3-029"})
 	}
 
 	if s.isIntegerLessThan(sceAnnualCoalQuantity, 0) {
 		cells := []string{s.getCellPosition(TableType3, "sce_annual_coal_quantity", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用煤量（折标量）不能为负数", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用煤量（折标量）不能为负数", Cells: cells, RuleID: "T3-030"})
 	}
 	if s.isIntegerGreaterThan(sceAnnualCoalQuantity, 100000) {
 		cells := []string{s.getCellPosition(TableType3, "sce_annual_coal_quantity", rowNum)}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用煤量（折标量）不能大于100000", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用煤量（折标量）不能大于100000", Cells: cells, RuleID: "T3-031"})
 	}
 
 	if s.isIntegerLessThan(pqAnnualCoalQuantity, sceAnnualCoalQuantity) {
@@ -500,21 +598,21 @@ func (s *DataImportService) validateTable3NumericFields(data map[string]interfac
 			s.getCellPosition(TableType3, "pq_annual_coal_quantity", rowNum),
 			s.getCellPosition(TableType3, "sce_annual_coal_quantity", rowNum),
 		}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用煤量（实物量）应大于等于年原料用煤量（折标量）", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "年原料用煤量（实物量）应大于等于年原料用煤量（折标量）", Cells: cells, RuleID: "T3-032"})
 	}
 
 	return errors
 }
 
 // validateTable3OverallRulesForRow 校验附表3单行整体规则（行内字段间逻辑关系）
-func (s *DataImportService) validateTable3OverallRulesForRow(data map[string]interface{}, rowNum int) []ValidationError {
+func (s *DataImportService) validateTable3OverallRulesForRow(data db.FixedAssetsInvestmentProject, rowNum int) []ValidationError {
 	errors := []ValidationError{}
 
 	// 获取当前行的数值
-	sceTotalCoalConsumption := s.parseFloat(s.getStringValue(data["sce_total_coal_consumption"]))
-	pqTotalCoalConsumption := s.parseFloat(s.getStringValue(data["pq_total_coal_consumption"]))
-	pqAnnualCoalQuantity := s.parseFloat(s.getStringValue(data["pq_annual_coal_quantity"]))
-	sceAnnualCoalQuantity := s.parseFloat(s.getStringValue(data["sce_annual_coal_quantity"]))
+	sceTotalCoalConsumption := s.parseFloat(data.SceTotalCoalConsumption)
+	pqTotalCoalConsumption := s.parseFloat(data.PqTotalCoalConsumption)
+	pqAnnualCoalQuantity := s.parseFloat(data.PqAnnualCoalQuantity)
+	sceAnnualCoalQuantity := s.parseFloat(data.SceAnnualCoalQuantity)
 
 	// ②年煤品消费量与原料用煤情况的逻辑关系
 	// 煤品消费总量（实物量）≧年原料用煤量（实物量）
@@ -523,7 +621,7 @@ func (s *DataImportService) validateTable3OverallRulesForRow(data map[string]int
 			s.getCellPosition(TableType3, "pq_total_coal_consumption", rowNum),
 			s.getCellPosition(TableType3, "pq_annual_coal_quantity", rowNum),
 		}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤品消费总量（实物量）应大于等于年原料用煤量（实物量）", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤品消费总量（实物量）应大于等于年原料用煤量（实物量）", Cells: cells, RuleID: "T3-033"})
 	}
 
 	// 煤品消费总量（折标量）≧年原料用煤量（折标量）
@@ -532,105 +630,54 @@ func (s *DataImportService) validateTable3OverallRulesForRow(data map[string]int
 			s.getCellPosition(TableType3, "sce_total_coal_consumption", rowNum),
 			s.getCellPosition(TableType3, "sce_annual_coal_quantity", rowNum),
 		}
-		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤品消费总量（折标量）应大于等于年原料用煤量（折标量）", Cells: cells})
+		errors = append(errors, ValidationError{RowNumber: rowNum, Message: "煤品消费总量（折标量）应大于等于年原料用煤量（折标量）", Cells: cells, RuleID: "T3-034"})
 	}
 
 	return errors
 }
 
-// coverTable3Data 覆盖附表3数据
-func (s *DataImportService) coverTable3Data(mainData []map[string]interface{}, fileName string) error {
-	if len(mainData) == 0 {
-		return fmt.Errorf("数据为空")
-	}
-
-	// 逐行检查，根据项目代码+审查意见文号检查是否已导入
-	for _, record := range mainData {
-		projectCode := s.getStringValue(record["project_code"])
-		documentNumber := s.getStringValue(record["document_number"])
-
-		// 先尝试更新，通过受影响行数判断是否存在
-		affectedRows, err := s.updateTable3DataByProjectCodeAndDocumentNumber(projectCode, documentNumber, record)
-		if err != nil {
-			return fmt.Errorf("更新数据失败: %v", err)
-		}
+// validateTable3SoftRules 校验附表3软性规则，结果为警告级别，确认后允许导入
+func (s *DataImportService) validateTable3SoftRules(data db.FixedAssetsInvestmentProject, rowNum int) []ValidationError {
+	errors := []ValidationError{}
 
-		// 如果受影响行数为0，说明数据不存在，执行插入
-		if affectedRows == 0 {
-			err = s.insertTable3Data(record)
-			if err != nil {
-				return fmt.Errorf("插入数据失败: %v", err)
-			}
+	// 煤品消费总量（折标量）/煤品消费总量（实物量）低于0.4，折标系数异常
+	pqTotalCoalConsumption := s.parseFloat(data.PqTotalCoalConsumption)
+	sceTotalCoalConsumption := s.parseFloat(data.SceTotalCoalConsumption)
+	if s.isIntegerGreaterThan(pqTotalCoalConsumption, 0) && s.isIntegerLessThan(sceTotalCoalConsumption, s.multiplyFloat64(pqTotalCoalConsumption, 0.4)) {
+		cells := []string{
+			s.getCellPosition(TableType3, "pq_total_coal_consumption", rowNum),
+			s.getCellPosition(TableType3, "sce_total_coal_consumption", rowNum),
 		}
+		errors = append(errors, ValidationError{
+			RowNumber: rowNum,
+			Message:   "煤品消费总量（折标量）与煤品消费总量（实物量）之比低于0.4，请核实折标系数",
+			Cells:     cells,
+			Severity:  SeverityWarning,
+			RuleID:    "T3-035",
+		})
 	}
 
-	return nil
+	return errors
 }
 
-// updateTable3DataByProjectCodeAndDocumentNumber 根据项目代码和审查意见文号更新附表3数据
-func (s *DataImportService) updateTable3DataByProjectCodeAndDocumentNumber(projectCode, documentNumber string, record map[string]interface{}) (int64, error) {
-	// 对数值字段进行SM4加密
-	encryptedValues := s.encryptTable3NumericFields(record)
-
-	query := `UPDATE fixed_assets_investment_project SET 
-		stat_date = ?, project_name = ?, project_code = ?, construction_unit = ?, main_construction_content = ?,
-		province_name = ?, city_name = ?, country_name = ?, trade_a = ?, trade_c = ?, 
-		examination_approval_time = ?, scheduled_time = ?, actual_time = ?,
-		examination_authority = ?, document_number = ?, equivalent_value = ?,
-		equivalent_cost = ?, pq_total_coal_consumption = ?, pq_coal_consumption = ?, 
-		pq_coke_consumption = ?, pq_blue_coke_consumption = ?, sce_total_coal_consumption = ?,
-		sce_coal_consumption = ?, sce_coke_consumption = ?, sce_blue_coke_consumption = ?,
-		is_substitution = ?, substitution_source = ?, substitution_quantity = ?, 
-		pq_annual_coal_quantity = ?, sce_annual_coal_quantity = ?, is_confirm = ?
-		WHERE project_code = ? AND document_number = ?`
-
-	result, err := s.app.GetDB().Exec(query,
-		record["stat_date"], record["project_name"], record["project_code"], record["construction_unit"], record["main_construction_content"],
-		record["province_name"], record["city_name"], record["country_name"],
-		record["trade_a"], record["trade_c"], record["examination_approval_time"],
-		record["scheduled_time"], record["actual_time"], record["examination_authority"],
-		record["document_number"], encryptedValues["equivalent_value"], encryptedValues["equivalent_cost"],
-		encryptedValues["pq_total_coal_consumption"], encryptedValues["pq_coal_consumption"],
-		encryptedValues["pq_coke_consumption"], encryptedValues["pq_blue_coke_consumption"],
-		encryptedValues["sce_total_coal_consumption"], encryptedValues["sce_coal_consumption"],
-		encryptedValues["sce_coke_consumption"], encryptedValues["sce_blue_coke_consumption"],
-		record["is_substitution"], record["substitution_source"], encryptedValues["substitution_quantity"],
-		encryptedValues["pq_annual_coal_quantity"], encryptedValues["sce_annual_coal_quantity"],
-		EncryptedZero,
-		projectCode, documentNumber)
-
-	if err != nil {
-		return 0, err
-	}
-
-	// 从QueryResult中获取受影响的行数
-	if result.Ok && result.Data != nil {
-		if dataMap, ok := result.Data.(map[string]interface{}); ok {
-			if rowsAffected, exists := dataMap["rowsAffected"]; exists {
-				if affectedRows, ok := rowsAffected.(int64); ok {
-					return affectedRows, nil
-				}
-			}
-		}
+// coverTable3Data 覆盖附表3数据，项目代码和审查意见文号相同的数据按自然键原地更新
+func (s *DataImportService) coverTable3Data(mainData []map[string]interface{}, fileName string) error {
+	if len(mainData) == 0 {
+		return fmt.Errorf("数据为空")
 	}
-
-	return 0, nil
+	return s.saveTable3DataForModel(mainData)
 }
 
 // isTable3FileImported 检查附表3文件是否已导入
 func (s *DataImportService) isTable3FileImported(mainData []map[string]interface{}) bool {
 	// 按Excel数据逐行检查，根据项目代码+审查意见文号检查是否已导入
+	repo := newRepository[db.FixedAssetsInvestmentProject](s)
 	for _, record := range mainData {
 		projectCode := s.getStringValue(record["project_code"])
 		documentNumber := s.getStringValue(record["document_number"])
 
-		query := "SELECT COUNT(1) as count FROM fixed_assets_investment_project WHERE project_code = ? AND document_number = ?"
-		result, err := s.app.GetDB().QueryRow(query, projectCode, documentNumber)
-		if err != nil || result.Data == nil {
-			continue
-		}
-
-		if result.Data.(map[string]interface{})["count"].(int64) > 0 {
+		count, err := repo.Count("project_code = ? AND document_number = ?", projectCode, documentNumber)
+		if err == nil && count > 0 {
 			return true // 检查到立即停止表示已导入
 		}
 	}
@@ -638,53 +685,36 @@ func (s *DataImportService) isTable3FileImported(mainData []map[string]interface
 	return false
 }
 
-// saveTable3DataForModel 模型校验专用保存附表3数据到数据库（只使用INSERT）
+// saveTable3DataForModel 模型校验专用保存附表3数据到数据库，项目代码和审查意见文号相同的数据已存在时覆盖
 func (s *DataImportService) saveTable3DataForModel(mainData []map[string]interface{}) error {
-	for _, record := range mainData {
-		// 直接执行插入操作，不检查数据是否已存在
-		err := s.insertTable3Data(record)
-		if err != nil {
-			return err
-		}
+	// 已报送的年份不允许写入数据
+	if err := s.checkRecordsWritable(mainData); err != nil {
+		return err
 	}
 
-	return nil
-}
-
-// insertTable3Data 插入附表3数据
-func (s *DataImportService) insertTable3Data(record map[string]interface{}) error {
-	record["obj_id"] = s.generateUUID()
-	record["create_time"] = time.Now().UnixMilli()
-
-	// 对数值字段进行SM4加密
-	encryptedValues := s.encryptTable3NumericFields(record)
-
-	query := `INSERT INTO fixed_assets_investment_project (
-		obj_id, stat_date, project_name, project_code, construction_unit, main_construction_content,
-		province_name, city_name, country_name, trade_a, trade_c, examination_approval_time,
-		scheduled_time, actual_time, examination_authority, document_number, equivalent_value,
-		equivalent_cost, pq_total_coal_consumption, pq_coal_consumption, pq_coke_consumption, pq_blue_coke_consumption,
-		sce_total_coal_consumption, sce_coal_consumption, sce_coke_consumption, sce_blue_coke_consumption,
-		is_substitution, substitution_source, substitution_quantity, pq_annual_coal_quantity, sce_annual_coal_quantity,
-		create_time, create_user, is_check
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	_, err := s.app.GetDB().Exec(query,
-		record["obj_id"], record["stat_date"], record["project_name"], record["project_code"],
-		record["construction_unit"], record["main_construction_content"], record["province_name"],
-		record["city_name"], record["country_name"], record["trade_a"], record["trade_c"],
-		record["examination_approval_time"], record["scheduled_time"], record["actual_time"],
-		record["examination_authority"], record["document_number"], encryptedValues["equivalent_value"],
-		encryptedValues["equivalent_cost"], encryptedValues["pq_total_coal_consumption"], encryptedValues["pq_coal_consumption"],
-		encryptedValues["pq_coke_consumption"], encryptedValues["pq_blue_coke_consumption"], encryptedValues["sce_total_coal_consumption"],
-		encryptedValues["sce_coal_consumption"], encryptedValues["sce_coke_consumption"], encryptedValues["sce_blue_coke_consumption"],
-		record["is_substitution"], record["substitution_source"], encryptedValues["substitution_quantity"],
-		encryptedValues["pq_annual_coal_quantity"], encryptedValues["sce_annual_coal_quantity"],
-		record["create_time"], s.app.GetAreaStr(), EncryptedOne)
+	records, err := decodeRecords[db.FixedAssetsInvestmentProject](mainData)
+	if err != nil {
+		return fmt.Errorf("数据格式错误: %v", err)
+	}
+	createTime := time.Now().UnixMilli()
+	createUser := s.app.GetAreaStr()
+	for i := range records {
+		records[i].ObjID = s.generateUUID()
+		records[i].CreateTime = createTime
+		records[i].CreateUser = createUser
+		records[i].IsConfirm = "0"
+		records[i].IsCheck = "1"
+	}
+
+	// 同一文件的数据在同一事务中写入，已存在的项目沿用原记录的obj_id和创建时间
+	err = s.app.GetDB().WithTx(func(tx *sql.Tx) error {
+		return upsertRecordsTx(tx, newRepository[db.FixedAssetsInvestmentProject](s), records, "obj_id", "create_time")
+	})
 	if err != nil {
 		return fmt.Errorf("保存数据失败: %v", err)
 	}
 
+	s.advanceSubmissionStatus(s.collectStatDates(mainData), SubmissionEventImport)
 	return nil
 }
 
@@ -698,25 +728,25 @@ func (s *DataImportService) addValidationErrorsToExcelTable3(filePath string, er
 
 	// 创建错误信息映射
 	errorMap := make(map[int]string)
-	// 收集所有需要高亮的单元格
-	var allCells []string
+	// 记录每行最严重的级别，用于设置错误信息列的颜色
+	severityMap := make(map[int]string)
 
 	for _, err := range errors {
+		message := formatValidationMessage(err)
 		// 如果该行已有错误信息，则追加
 		if existing, exists := errorMap[err.RowNumber]; exists {
-			errorMap[err.RowNumber] = existing + "; " + err.Message
+			errorMap[err.RowNumber] = existing + "; " + message
 		} else {
-			errorMap[err.RowNumber] = err.Message
+			errorMap[err.RowNumber] = message
 		}
 
-		// 收集涉及到的单元格
-		if err.Cells != nil {
-			allCells = append(allCells, err.Cells...)
+		if current, exists := severityMap[err.RowNumber]; !exists || getSeverityRank(err.Severity) > getSeverityRank(current) {
+			severityMap[err.RowNumber] = err.Severity
 		}
 	}
 
 	// 获取所有工作表
-	sheets := f.GetSheetList()
+	sheets := getDataSheetList(f)
 	if len(sheets) == 0 {
 		return fmt.Errorf("Excel文件没有工作表")
 	}
@@ -724,12 +754,10 @@ func (s *DataImportService) addValidationErrorsToExcelTable3(filePath string, er
 	// 处理第一个工作表
 	sheetName := sheets[0]
 
-	// 高亮涉及到的单元格
-	if len(allCells) > 0 {
-		err = s.highlightCellsInExcel(f, sheetName, allCells)
-		if err != nil {
-			fmt.Printf("高亮单元格失败: %v\n", err)
-		}
+	// 按级别高亮涉及到的单元格
+	err = s.highlightValidationCells(f, sheetName, errors)
+	if err != nil {
+		fmt.Printf("高亮单元格失败: %v\n", err)
 	}
 
 	// 获取最大列数
@@ -757,7 +785,7 @@ func (s *DataImportService) addValidationErrorsToExcelTable3(filePath string, er
 		f.SetCellValue(sheetName, errorCellName, formattedErrorMsg)
 
 		style, err := f.NewStyle(&excelize.Style{
-			Fill: excelize.Fill{Type: "pattern", Color: []string{"FFFF00"}, Pattern: 1},
+			Fill: excelize.Fill{Type: "pattern", Color: []string{getSeverityColor(severityMap[rowNum])}, Pattern: 1},
 			Alignment: &excelize.Alignment{
 				Vertical: "center",
 			},
@@ -773,26 +801,11 @@ func (s *DataImportService) addValidationErrorsToExcelTable3(filePath string, er
 		f.SetColWidth(sheetName, colName, colName, 50)
 	}
 
+	// 添加单元格批注和校验结果汇总表
+	if err := s.addValidationReport(f, sheetName, errors); err != nil {
+		fmt.Printf("添加校验结果汇总失败: %v\n", err)
+	}
+
 	// 保存文件
 	return f.Save()
 }
-
-// encryptTable3NumericFields 加密附表3数值字段
-func (s *DataImportService) encryptTable3NumericFields(record map[string]interface{}) map[string]interface{} {
-	numericFields := []string{
-		"equivalent_value",
-		"equivalent_cost",
-		"pq_total_coal_consumption",
-		"pq_coal_consumption",
-		"pq_coke_consumption",
-		"pq_blue_coke_consumption",
-		"sce_total_coal_consumption",
-		"sce_coal_consumption",
-		"sce_coke_consumption",
-		"sce_blue_coke_consumption",
-		"substitution_quantity",
-		"pq_annual_coal_quantity",
-		"sce_annual_coal_quantity",
-	}
-	return s.encryptNumericFields(record, numericFields)
-}
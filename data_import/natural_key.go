@@ -0,0 +1,65 @@
+package data_import
+
+import (
+	"database/sql"
+	"fmt"
+	"shuji/db"
+	"strings"
+)
+
+// NaturalKey 数据表的自然键，数据库中建有对应的唯一索引，导入、覆盖和合并时按自然键插入或更新
+type NaturalKey struct {
+	IndexName string   // 唯一索引名称
+	TableName string   // 表名
+	Columns   []string // 自然键字段
+	Where     string   // 部分唯一索引的条件，编号为空的装置不参与唯一约束
+}
+
+// NaturalKeys 各数据表的自然键
+var NaturalKeys = []NaturalKey{
+	{"uk_enterprise_coal_consumption_main", "enterprise_coal_consumption_main", []string{"credit_code", "stat_date"}, ""},
+	{"uk_enterprise_coal_consumption_equip", "enterprise_coal_consumption_equip", []string{"fk_id", "equip_type", "equip_no"}, "equip_no IS NOT NULL AND equip_no <> ''"},
+	{"uk_critical_coal_equipment_consumption", "critical_coal_equipment_consumption", []string{"credit_code", "stat_date", "coal_type", "coal_no"}, "coal_no IS NOT NULL AND coal_no <> ''"},
+	{"uk_fixed_assets_investment_project", "fixed_assets_investment_project", []string{"project_code", "document_number"}, ""},
+	{"uk_coal_consumption_report", "coal_consumption_report", []string{"province_name", "city_name", "country_name", "stat_date"}, ""},
+}
+
+// GetNaturalKey 获取数据表的自然键
+func GetNaturalKey(tableName string) (NaturalKey, bool) {
+	for _, key := range NaturalKeys {
+		if key.TableName == tableName {
+			return key, true
+		}
+	}
+	return NaturalKey{}, false
+}
+
+// CreateIndexSQL 创建自然键唯一索引的语句
+func (k NaturalKey) CreateIndexSQL() string {
+	query := fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS "%s" ON "%s" (%s)`, k.IndexName, k.TableName, strings.Join(k.Columns, ", "))
+	if k.Where != "" {
+		query += " WHERE " + k.Where
+	}
+	return query
+}
+
+// Target 自然键对应的冲突判断字段
+func (k NaturalKey) Target() db.ConflictTarget {
+	return db.ConflictTarget{Columns: k.Columns, Where: k.Where}
+}
+
+// UpsertOptions 按自然键插入或更新，keepColumns为自然键冲突时保留原值的字段
+func (k NaturalKey) UpsertOptions(keepColumns ...string) db.UpsertOptions {
+	return db.UpsertOptions{Targets: []db.ConflictTarget{k.Target()}, KeepColumns: keepColumns}
+}
+
+// CheckIndexTx 检查自然键唯一索引是否已创建。升级时发现自然键重复的数据会暂缓创建索引，
+// 用户处理重复数据之前不能按自然键写入该表
+func (k NaturalKey) CheckIndexTx(tx *sql.Tx) error {
+	var name string
+	err := tx.QueryRow("SELECT name FROM sqlite_master WHERE type = 'index' AND name = ?", k.IndexName).Scan(&name)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("表 %s 存在自然键重复的数据，请先处理重复数据后再写入", k.TableName)
+	}
+	return err
+}
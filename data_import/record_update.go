@@ -0,0 +1,386 @@
+package data_import
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"shuji/db"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TableDataChangeLog 数据修改记录表
+const TableDataChangeLog = "data_change_log"
+
+// recordUpdateTarget 单条数据修改的目标表定义
+type recordUpdateTarget struct {
+	TableName   string                                                // 数据表名
+	TableType   string                                                // 文件类型
+	Section     coverDiffSection                                      // 可修改字段及加密字段
+	Validate    func(record map[string]interface{}) []ValidationError // 模型校验规则
+	ParentTable string                                                // 子表修改时需要同步重置确认状态的主表
+}
+
+// getRecordUpdateTargets 获取支持单条修改的数据表定义，行号传0，校验结果不对应Excel单元格
+func (s *DataImportService) getRecordUpdateTargets() []recordUpdateTarget {
+	return []recordUpdateTarget{
+		{
+			TableName: TableEnterpriseCoalConsumptionMain,
+			TableType: TableType1,
+			Section:   table1MainDiffSection,
+			Validate: func(record map[string]interface{}) []ValidationError {
+				errors := validateRecord(record, func(data db.EnterpriseCoalConsumptionMain) []ValidationError {
+					errors := s.validateTable1MainNumericFields(data, 0)
+					return append(errors, s.validateTable1MainSoftRules(data, 0, 0)...)
+				})
+				// 单位名称和所在区域可修改，需与导入时一样校验企业清单、统一信用代码和区域
+				return append(errors, toRecordValidationErrors(s.validateEnterpriseAndCreditCode(record, 0, 0))...)
+			},
+		},
+		{
+			TableName: TableEnterpriseCoalConsumptionUsage,
+			TableType: TableType1,
+			Section:   table1UsageDiffSection,
+			Validate: func(record map[string]interface{}) []ValidationError {
+				return validateRecord(record, func(data db.EnterpriseCoalConsumptionUsage) []ValidationError {
+					return s.validateTable1UsageNumericFields(data, 0)
+				})
+			},
+			ParentTable: TableEnterpriseCoalConsumptionMain,
+		},
+		{
+			TableName: TableEnterpriseCoalConsumptionEquip,
+			TableType: TableType1,
+			Section:   table1EquipDiffSection,
+			Validate: func(record map[string]interface{}) []ValidationError {
+				return validateRecord(record, func(data db.EnterpriseCoalConsumptionEquip) []ValidationError {
+					return s.validateTable1EquipNumericFields(data, 0)
+				})
+			},
+			ParentTable: TableEnterpriseCoalConsumptionMain,
+		},
+		{
+			TableName: TableCriticalCoalEquipmentConsumption,
+			TableType: TableType2,
+			Section:   table2EquipDiffSection,
+			Validate: func(record map[string]interface{}) []ValidationError {
+				return validateRecord(record, func(data db.CriticalCoalEquipmentConsumption) []ValidationError {
+					errors := s.validateTable2NumericFieldsForModel(data, 0)
+					return append(errors, s.validateTable2SoftRules(data, 0)...)
+				})
+			},
+		},
+		{
+			TableName: TableFixedAssetsInvestmentProject,
+			TableType: TableType3,
+			Section:   table3DiffSection,
+			Validate: func(record map[string]interface{}) []ValidationError {
+				errors := validateRecord(record, func(data db.FixedAssetsInvestmentProject) []ValidationError {
+					errors := s.validateTable3NumericFields(data, 0)
+					errors = append(errors, s.validateTable3OverallRulesForRow(data, 0)...)
+					return append(errors, s.validateTable3SoftRules(data, 0)...)
+				})
+				// 项目所在区域可修改，需与导入时一样校验是否属于本单位区域
+				return append(errors, toRecordValidationErrors(s.validateRegionOnly(record, 0))...)
+			},
+		},
+		{
+			TableName: TableCoalConsumptionReport,
+			TableType: TableTypeAttachment2,
+			Section:   attachment2DiffSection,
+			Validate: func(record map[string]interface{}) []ValidationError {
+				// 上下级汇总规则依赖整批数据，单条修改只校验行内规则
+				return validateRecord(record, func(data db.CoalConsumptionReport) []ValidationError {
+					errors := s.validateAttachment2NumericFields(data, 0)
+					errors = append(errors, s.validateAttachment2DataConsistency(data, 0)...)
+					return append(errors, s.validateAttachment2SoftRules(data, 0)...)
+				})
+			},
+		},
+	}
+}
+
+// toRecordValidationErrors 将导入校验返回的错误信息转换为单条修改的校验错误，去掉无意义的行号前缀
+func toRecordValidationErrors(messages []string) []ValidationError {
+	errors := make([]ValidationError, 0, len(messages))
+	for _, message := range messages {
+		errors = append(errors, ValidationError{RowNumber: 0, Message: strings.TrimPrefix(message, "第0行：")})
+	}
+	return errors
+}
+
+// getRecordUpdateTarget 根据表名获取单条修改的目标表定义
+func (s *DataImportService) getRecordUpdateTarget(tableName string) (recordUpdateTarget, bool) {
+	for _, target := range s.getRecordUpdateTargets() {
+		if target.TableName == tableName {
+			return target, true
+		}
+	}
+	return recordUpdateTarget{}, false
+}
+
+// UpdateTable1MainRecord 修改附表1单位基本信息
+func (s *DataImportService) UpdateTable1MainRecord(objID string, changes map[string]string, reason string) db.QueryResult {
+	return s.updateRecordWithRecover(TableEnterpriseCoalConsumptionMain, objID, changes, reason)
+}
+
+// UpdateTable1UsageRecord 修改附表1煤炭消费主要用途情况
+func (s *DataImportService) UpdateTable1UsageRecord(objID string, changes map[string]string, reason string) db.QueryResult {
+	return s.updateRecordWithRecover(TableEnterpriseCoalConsumptionUsage, objID, changes, reason)
+}
+
+// UpdateTable1EquipRecord 修改附表1重点耗煤装置情况
+func (s *DataImportService) UpdateTable1EquipRecord(objID string, changes map[string]string, reason string) db.QueryResult {
+	return s.updateRecordWithRecover(TableEnterpriseCoalConsumptionEquip, objID, changes, reason)
+}
+
+// UpdateTable2Record 修改附表2重点耗煤装置
+func (s *DataImportService) UpdateTable2Record(objID string, changes map[string]string, reason string) db.QueryResult {
+	return s.updateRecordWithRecover(TableCriticalCoalEquipmentConsumption, objID, changes, reason)
+}
+
+// UpdateTable3Record 修改附表3固定资产投资项目
+func (s *DataImportService) UpdateTable3Record(objID string, changes map[string]string, reason string) db.QueryResult {
+	return s.updateRecordWithRecover(TableFixedAssetsInvestmentProject, objID, changes, reason)
+}
+
+// UpdateAttachment2Record 修改附件2煤炭消费状况
+func (s *DataImportService) UpdateAttachment2Record(objID string, changes map[string]string, reason string) db.QueryResult {
+	return s.updateRecordWithRecover(TableCoalConsumptionReport, objID, changes, reason)
+}
+
+// updateRecordWithRecover 带异常处理的单条数据修改函数
+func (s *DataImportService) updateRecordWithRecover(tableName, objID string, changes map[string]string, reason string) (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("UpdateRecord 发生异常: %v", r)
+			result = db.QueryResult{
+				Ok:      false,
+				Message: fmt.Sprintf("函数执行异常: %v", r),
+			}
+		}
+	}()
+
+	target, exists := s.getRecordUpdateTarget(tableName)
+	if !exists {
+		return db.QueryResult{Ok: false, Message: "不支持修改该数据表"}
+	}
+
+	// 1. 检查修改原因和修改字段
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return db.QueryResult{Ok: false, Message: "修改原因不能为空"}
+	}
+	if len(changes) == 0 {
+		return db.QueryResult{Ok: false, Message: "请填写需要修改的字段"}
+	}
+
+	fieldLabels := make(map[string]string)
+	for _, field := range target.Section.Fields {
+		fieldLabels[field.Field] = field.Label
+	}
+	for field, value := range changes {
+		label, editable := fieldLabels[field]
+		if !editable {
+			return db.QueryResult{Ok: false, Message: fmt.Sprintf("字段 %s 不允许修改", field)}
+		}
+		value = strings.TrimSpace(value)
+		if slices.Contains(target.Section.EncryptedFields, field) && value != "" {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return db.QueryResult{Ok: false, Message: fmt.Sprintf("%s必须为数值", label)}
+			}
+		}
+	}
+
+	// 2. 查询现有数据并解密
+	query := fmt.Sprintf("SELECT * FROM %s WHERE obj_id = ?", target.TableName)
+	queryResult, err := s.app.GetDB().QueryRow(query, objID)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("查询数据失败: %v", err)}
+	}
+	if queryResult.Data == nil {
+		return db.QueryResult{Ok: false, Message: "数据不存在"}
+	}
+	oldRecord := s.decryptCoverRecord(queryResult.Data.(map[string]interface{}), target.Section)
+	statDate := s.getStringValue(oldRecord["stat_date"])
+	if err := s.CheckYearsWritable([]string{statDate}); err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+
+	// 3. 合并修改，只保留值发生变化的字段
+	newRecord := maps.Clone(oldRecord)
+	var changedFields []string
+	for _, field := range target.Section.Fields {
+		value, exists := changes[field.Field]
+		if !exists {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if isCoverValueEqual(getCoverValue(oldRecord, field.Field), value) {
+			continue
+		}
+		newRecord[field.Field] = value
+		changedFields = append(changedFields, field.Field)
+	}
+	if len(changedFields) == 0 {
+		return db.QueryResult{Ok: false, Message: "数据未发生变化"}
+	}
+
+	// 4. 对修改后的记录重新执行模型校验规则，存在错误时不保存
+	validationErrors := target.Validate(newRecord)
+	if hasBlockingErrors(validationErrors) {
+		var messages []string
+		for _, validationError := range validationErrors {
+			messages = append(messages, formatValidationMessage(validationError))
+		}
+		return db.QueryResult{
+			Ok:      false,
+			Message: fmt.Sprintf("修改后的数据未通过校验：\n\n%s", strings.Join(messages, ";\n\n")),
+			Data: map[string]interface{}{
+				"errors": validationErrors,
+			},
+		}
+	}
+
+	// 5. 保存修改并记录修改原因
+	if err := s.saveRecordUpdate(target, objID, oldRecord, newRecord, changedFields, reason); err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("保存修改失败: %v", err)}
+	}
+
+	// 修改后数据需重新确认，报送状态回到已校验
+	s.advanceSubmissionStatus([]string{statDate}, SubmissionEventEdit)
+
+	return db.QueryResult{
+		Ok:      true,
+		Message: fmt.Sprintf("修改成功，共修改%d个字段", len(changedFields)),
+		Data: map[string]interface{}{
+			"changed_fields": changedFields,    // 修改的字段
+			"warnings":       validationErrors, // 警告级别的校验结果
+		},
+	}
+}
+
+// saveRecordUpdate 在同一事务中更新数据、重置确认状态并写入修改记录
+func (s *DataImportService) saveRecordUpdate(target recordUpdateTarget, objID string, oldRecord, newRecord map[string]interface{}, changedFields []string, reason string) error {
+	// 数值字段重新加密
+	storedValue := func(field string, record map[string]interface{}) (interface{}, error) {
+		value := getCoverValue(record, field)
+		if value == "" || !slices.Contains(target.Section.EncryptedFields, field) {
+			return value, nil
+		}
+		return s.app.SM4Encrypt(value)
+	}
+
+	// 修改后的数据需要重新确认，已重新执行模型校验规则
+	setClauses := []string{}
+	args := []interface{}{}
+	for _, field := range changedFields {
+		value, err := storedValue(field, newRecord)
+		if err != nil {
+			return fmt.Errorf("加密字段失败: %v", err)
+		}
+		setClauses = append(setClauses, field+" = ?")
+		args = append(args, value)
+	}
+	setClauses = append(setClauses, "is_confirm = ?", "is_check = ?")
+	args = append(args, EncryptedZero, EncryptedOne, objID)
+
+	tx, err := s.app.GetDB().Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+
+	updateQuery := fmt.Sprintf("UPDATE %s SET %s WHERE obj_id = ?", target.TableName, strings.Join(setClauses, ", "))
+	if _, err := tx.Exec(updateQuery, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 子表修改后主表同样需要重新确认
+	if target.ParentTable != "" {
+		parentQuery := fmt.Sprintf("UPDATE %s SET is_confirm = ? WHERE obj_id = ?", target.ParentTable)
+		if _, err := tx.Exec(parentQuery, EncryptedZero, newRecord["fk_id"]); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	logQuery := fmt.Sprintf(`INSERT INTO %s (
+		obj_id, table_name, record_id, field_name, old_value, new_value, reason, change_time, change_user
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, TableDataChangeLog)
+	changeTime := time.Now().UnixMilli()
+	for _, field := range changedFields {
+		oldValue, err := storedValue(field, oldRecord)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("加密字段失败: %v", err)
+		}
+		newValue, err := storedValue(field, newRecord)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("加密字段失败: %v", err)
+		}
+		if _, err := tx.Exec(logQuery, s.generateUUID(), target.TableName, objID, field, oldValue, newValue,
+			reason, changeTime, s.app.GetCurrentOSUser()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// QueryDataChangeLog 查询单条数据的修改记录
+func (s *DataImportService) QueryDataChangeLog(objID string) db.QueryResult {
+	query := fmt.Sprintf(`SELECT obj_id, table_name, record_id, field_name, old_value, new_value, reason, change_time, change_user
+		FROM %s WHERE record_id = ? ORDER BY change_time DESC`, TableDataChangeLog)
+	result, err := s.app.GetDB().Query(query, objID)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("查询修改记录失败: %v", err)}
+	}
+
+	logs := []map[string]interface{}{}
+	if result.Data != nil {
+		for _, record := range result.Data.([]map[string]interface{}) {
+			tableName := s.getStringValue(record["table_name"])
+			fieldName := s.getStringValue(record["field_name"])
+			fieldLabel := fieldName
+			oldValue := s.getStringValue(record["old_value"])
+			newValue := s.getStringValue(record["new_value"])
+
+			if target, exists := s.getRecordUpdateTarget(tableName); exists {
+				for _, field := range target.Section.Fields {
+					if field.Field == fieldName {
+						fieldLabel = field.Label
+					}
+				}
+				if slices.Contains(target.Section.EncryptedFields, fieldName) {
+					oldValue = s.decryptValue(record["old_value"])
+					newValue = s.decryptValue(record["new_value"])
+				}
+			}
+
+			logs = append(logs, map[string]interface{}{
+				"obj_id":      record["obj_id"],
+				"table_name":  tableName,
+				"record_id":   record["record_id"],
+				"field_name":  fieldName,
+				"field_label": fieldLabel,
+				"old_value":   oldValue,
+				"new_value":   newValue,
+				"reason":      record["reason"],
+				"change_time": record["change_time"],
+				"change_user": record["change_user"],
+			})
+		}
+	}
+
+	return db.QueryResult{
+		Ok:      true,
+		Message: "查询成功",
+		Data:    logs,
+	}
+}
@@ -0,0 +1,46 @@
+package data_import
+
+import (
+	"database/sql"
+	"fmt"
+	"shuji/db"
+)
+
+// newRepository 创建数据表的类型化访问，加密字段使用应用的SM4加解密
+func newRepository[T db.Model](s *DataImportService) *db.Repository[T] {
+	return db.NewRepository[T](s.app.GetDB(), s.app)
+}
+
+// decodeRecords 将解析出的Excel行数据转换为数据表模型，解析结果为明文，不做解密
+func decodeRecords[T db.Model](rows []map[string]interface{}) ([]T, error) {
+	records := make([]T, 0, len(rows))
+	for _, row := range rows {
+		record, err := db.DecodeModel[T](row, nil)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// upsertRecordsTx 在调用方的事务中按自然键批量插入或更新记录，keepColumns为自然键冲突时保留原值的字段
+func upsertRecordsTx[T db.Model](tx *sql.Tx, repo *db.Repository[T], records []T, keepColumns ...string) error {
+	key, exists := GetNaturalKey(repo.TableName())
+	if !exists {
+		return fmt.Errorf("表 %s 未定义自然键", repo.TableName())
+	}
+	if err := key.CheckIndexTx(tx); err != nil {
+		return err
+	}
+	return repo.UpsertTx(tx, records, key.UpsertOptions(keepColumns...), importBatchSize)
+}
+
+// validateRecord 将单条明文记录转换为数据表模型后执行校验，转换失败时返回格式错误
+func validateRecord[T db.Model](record map[string]interface{}, validate func(data T) []ValidationError) []ValidationError {
+	data, err := db.DecodeModel[T](record, nil)
+	if err != nil {
+		return []ValidationError{{RowNumber: 0, Message: fmt.Sprintf("数据格式错误: %v", err)}}
+	}
+	return validate(data)
+}
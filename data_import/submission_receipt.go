@@ -0,0 +1,130 @@
+package data_import
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"shuji/db"
+)
+
+// TableSubmissionReceiptRecord 上级回执中各条数据的处理结果表
+const TableSubmissionReceiptRecord = "submission_receipt_record"
+
+// SubmissionReceiptRecord 回执中单条数据的处理结果，ObjID为报送单位数据的obj_id
+type SubmissionReceiptRecord struct {
+	TableType string `json:"tableType"` // 表类型
+	ObjID     string `json:"objId"`     // 数据obj_id
+	StatDate  string `json:"statDate"`  // 数据年份
+	Key       string `json:"key"`       // 数据唯一键，与合并冲突键一致
+	Name      string `json:"name"`      // 单位名称或项目名称
+	Accepted  bool   `json:"accepted"`  // 是否接收
+	Reason    string `json:"reason"`    // 未接收原因
+}
+
+// ApplyReceiptRecords 按回执更新数据检查状态和年份报送状态，接收的数据is_check为1，未接收的为2
+// 存在未接收数据的年份退回，其余年份接收，未接收原因保存到回执记录表
+func (s *DataImportService) ApplyReceiptRecords(records []SubmissionReceiptRecord, remark string, receiptTime int64, issuer string) error {
+	// 1. 按年份汇总处理结果，先检查全部年份，避免回执只应用了一部分
+	var acceptedYears, returnedYears []string
+	for _, record := range records {
+		if record.StatDate == "" || slices.Contains(returnedYears, record.StatDate) {
+			continue
+		}
+		if !record.Accepted {
+			acceptedYears = slices.DeleteFunc(acceptedYears, func(year string) bool { return year == record.StatDate })
+			returnedYears = append(returnedYears, record.StatDate)
+		} else if !slices.Contains(acceptedYears, record.StatDate) {
+			acceptedYears = append(acceptedYears, record.StatDate)
+		}
+	}
+	if err := s.checkReceiptYears(acceptedYears, SubmissionEventAccept); err != nil {
+		return err
+	}
+	if err := s.checkReceiptYears(returnedYears, SubmissionEventReturn); err != nil {
+		return err
+	}
+
+	// 2. 更新数据的检查状态并保存处理结果，同一条数据只保留最近一次回执的结果
+	// 变更跟踪触发器不监听is_check，回执更新检查状态不会增加变更序号，数据不会因此重新报送
+	tx, err := s.app.GetDB().Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixMilli()
+	for _, record := range records {
+		tableName := getDataTableByTableType(record.TableType)
+		if tableName == "" {
+			return fmt.Errorf("回执中存在不支持的表类型: %s", record.TableType)
+		}
+
+		isCheck, isAccepted := EncryptedTwo, 0
+		if record.Accepted {
+			isCheck, isAccepted = EncryptedOne, 1
+		}
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET is_check = ? WHERE obj_id = ?", tableName), isCheck, record.ObjID); err != nil {
+			return fmt.Errorf("更新数据检查状态失败: %v", err)
+		}
+		// 附表1的用途表和设备表随主表更新
+		if record.TableType == TableType1 {
+			for _, childTable := range []string{TableEnterpriseCoalConsumptionUsage, TableEnterpriseCoalConsumptionEquip} {
+				if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET is_check = ? WHERE fk_id = ?", childTable), isCheck, record.ObjID); err != nil {
+					return fmt.Errorf("更新数据检查状态失败: %v", err)
+				}
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM "+TableSubmissionReceiptRecord+" WHERE table_name = ? AND record_id = ?", tableName, record.ObjID); err != nil {
+			return fmt.Errorf("清理回执记录失败: %v", err)
+		}
+		_, err := tx.Exec(`INSERT INTO `+TableSubmissionReceiptRecord+` (
+			obj_id, table_name, record_id, stat_date, record_key, record_name, is_accepted, reason, issuer, receipt_time, create_time
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			s.generateUUID(), tableName, record.ObjID, record.StatDate, record.Key, record.Name, isAccepted, record.Reason, issuer, receiptTime, now)
+		if err != nil {
+			return fmt.Errorf("保存回执记录失败: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+
+	// 3. 更新年份报送状态
+	if err := s.ApplySubmissionReceipt(acceptedYears, true, remark); err != nil {
+		return err
+	}
+	return s.ApplySubmissionReceipt(returnedYears, false, remark)
+}
+
+// QueryReceiptRejections 查询上级回执中未接收的数据及原因
+func (s *DataImportService) QueryReceiptRejections() db.QueryResult {
+	// 使用包装函数来处理异常
+	return s.queryReceiptRejectionsWithRecover()
+}
+
+// queryReceiptRejectionsWithRecover 带异常处理的查询回执未接收数据函数
+func (s *DataImportService) queryReceiptRejectionsWithRecover() (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("QueryReceiptRejections 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("函数执行异常: %v", r)}
+		}
+	}()
+
+	result, err := s.app.GetDB().Query(`SELECT table_name, record_id, stat_date, record_key, record_name, reason, issuer, receipt_time
+		FROM ` + TableSubmissionReceiptRecord + ` WHERE is_accepted = 0 ORDER BY stat_date DESC, table_name, record_key`)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("查询回执记录失败: %v", err)}
+	}
+	if result.Data == nil {
+		result.Data = []map[string]interface{}{}
+	}
+	result.Ok = true
+	result.Message = "查询成功"
+	return result
+}
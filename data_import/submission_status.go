@@ -0,0 +1,403 @@
+package data_import
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"shuji/db"
+)
+
+// 报送状态表
+const (
+	TableSubmissionStatus    = "submission_status"
+	TableSubmissionStatusLog = "submission_status_log"
+)
+
+// 报送状态，按区域和年份记录
+const (
+	SubmissionStatusDraft     = "draft"     // 草稿，尚未导入数据
+	SubmissionStatusValidated = "validated" // 已校验，数据已通过模型校验导入或修改
+	SubmissionStatusConfirmed = "confirmed" // 已确认，该年份数据全部确认
+	SubmissionStatusSubmitted = "submitted" // 已报送，数据已导出上报，年份锁定
+	SubmissionStatusAccepted  = "accepted"  // 已接收，上级已接收，年份锁定
+	SubmissionStatusReturned  = "returned"  // 已退回，上级退回，允许修改后重新报送
+)
+
+// 报送状态变更事件
+const (
+	SubmissionEventImport  = "import"  // 导入或覆盖数据
+	SubmissionEventEdit    = "edit"    // 修改单条数据
+	SubmissionEventConfirm = "confirm" // 确认数据
+	SubmissionEventExport  = "export"  // 导出报送
+	SubmissionEventAccept  = "accept"  // 导入上级回执：接收
+	SubmissionEventReturn  = "return"  // 导入上级回执：退回
+	SubmissionEventReopen  = "reopen"  // 重新开放已报送年份
+)
+
+// submissionEvent 报送状态变更规则，To为空时按数据确认情况确定目标状态
+type submissionEvent struct {
+	From []string
+	To   string
+}
+
+// submissionEvents 各事件允许的起始状态和目标状态
+var submissionEvents = map[string]submissionEvent{
+	SubmissionEventImport: {
+		From: []string{SubmissionStatusDraft, SubmissionStatusValidated, SubmissionStatusConfirmed, SubmissionStatusReturned},
+		To:   SubmissionStatusValidated,
+	},
+	SubmissionEventEdit: {
+		From: []string{SubmissionStatusDraft, SubmissionStatusValidated, SubmissionStatusConfirmed, SubmissionStatusReturned},
+		To:   SubmissionStatusValidated,
+	},
+	SubmissionEventConfirm: {
+		From: []string{SubmissionStatusValidated, SubmissionStatusConfirmed, SubmissionStatusReturned},
+		To:   SubmissionStatusConfirmed,
+	},
+	SubmissionEventExport: {
+		From: []string{SubmissionStatusConfirmed, SubmissionStatusSubmitted},
+		To:   SubmissionStatusSubmitted,
+	},
+	SubmissionEventAccept: {
+		From: []string{SubmissionStatusSubmitted, SubmissionStatusAccepted},
+		To:   SubmissionStatusAccepted,
+	},
+	SubmissionEventReturn: {
+		From: []string{SubmissionStatusSubmitted, SubmissionStatusAccepted},
+		To:   SubmissionStatusReturned,
+	},
+	SubmissionEventReopen: {
+		From: []string{SubmissionStatusSubmitted, SubmissionStatusAccepted},
+	},
+}
+
+// submissionStatusNames 报送状态显示名称
+var submissionStatusNames = map[string]string{
+	SubmissionStatusDraft:     "草稿",
+	SubmissionStatusValidated: "已校验",
+	SubmissionStatusConfirmed: "已确认",
+	SubmissionStatusSubmitted: "已报送",
+	SubmissionStatusAccepted:  "已接收",
+	SubmissionStatusReturned:  "已退回",
+}
+
+// isSubmissionLocked 已报送和已接收的年份不允许写入数据
+func isSubmissionLocked(status string) bool {
+	return status == SubmissionStatusSubmitted || status == SubmissionStatusAccepted
+}
+
+// submissionDataTables 参与报送状态统计的数据主表
+var submissionDataTables = []string{
+	TableEnterpriseCoalConsumptionMain,
+	TableCriticalCoalEquipmentConsumption,
+	TableFixedAssetsInvestmentProject,
+	TableCoalConsumptionReport,
+}
+
+// getSubmissionRegion 获取当前区域，报送状态按区域和年份记录
+func (s *DataImportService) getSubmissionRegion() (string, string, string) {
+	areaConfig := s.GetAreaConfig()
+	if areaConfig == nil {
+		return "", "", ""
+	}
+	return areaConfig.ProvinceName, areaConfig.CityName, areaConfig.CountryName
+}
+
+// deriveSubmissionStatus 根据数据确认情况推算没有状态记录的年份的状态
+func (s *DataImportService) deriveSubmissionStatus(statDate string) string {
+	total, unconfirmed := int64(0), int64(0)
+	for _, tableName := range submissionDataTables {
+		query := fmt.Sprintf(`SELECT COUNT(1) AS total,
+			SUM(CASE WHEN is_confirm IS NULL OR is_confirm != ? THEN 1 ELSE 0 END) AS unconfirmed
+			FROM %s WHERE stat_date = ?`, tableName)
+		result, err := s.app.GetDB().QueryRow(query, EncryptedOne, statDate)
+		if err != nil || result.Data == nil {
+			continue
+		}
+		row := result.Data.(map[string]interface{})
+		count, _ := row["total"].(int64)
+		notConfirmed, _ := row["unconfirmed"].(int64)
+		total += count
+		unconfirmed += notConfirmed
+	}
+
+	switch {
+	case total == 0:
+		return SubmissionStatusDraft
+	case unconfirmed == 0:
+		return SubmissionStatusConfirmed
+	default:
+		return SubmissionStatusValidated
+	}
+}
+
+// getSubmissionStatus 获取当前区域指定年份的报送状态
+func (s *DataImportService) getSubmissionStatus(statDate string) string {
+	province, city, country := s.getSubmissionRegion()
+	query := `SELECT status FROM ` + TableSubmissionStatus + `
+		WHERE province_name = ? AND city_name = ? AND country_name = ? AND stat_date = ?`
+	result, err := s.app.GetDB().QueryRow(query, province, city, country, statDate)
+	if err == nil && result.Data != nil {
+		return s.getStringValue(result.Data.(map[string]interface{})["status"])
+	}
+	return s.deriveSubmissionStatus(statDate)
+}
+
+// transitionSubmissionStatus 按事件变更年份的报送状态并记录变更日志，起始状态不允许该事件时返回错误
+func (s *DataImportService) transitionSubmissionStatus(statDate string, event string, remark string) error {
+	rule, exists := submissionEvents[event]
+	if !exists {
+		return fmt.Errorf("不支持的报送状态变更: %s", event)
+	}
+
+	fromStatus := s.getSubmissionStatus(statDate)
+	if !slices.Contains(rule.From, fromStatus) {
+		return fmt.Errorf("%s年数据当前状态为%s，不能执行该操作", statDate, submissionStatusNames[fromStatus])
+	}
+
+	toStatus := rule.To
+	if toStatus == "" {
+		toStatus = s.deriveSubmissionStatus(statDate)
+	}
+
+	province, city, country := s.getSubmissionRegion()
+	now := time.Now().UnixMilli()
+	user := s.app.GetCurrentOSUser()
+
+	tx, err := s.app.GetDB().Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO `+TableSubmissionStatus+` (
+		obj_id, province_name, city_name, country_name, stat_date, status, update_time, update_user, remark
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (province_name, city_name, country_name, stat_date)
+	DO UPDATE SET status = excluded.status, update_time = excluded.update_time,
+		update_user = excluded.update_user, remark = excluded.remark`,
+		s.generateUUID(), province, city, country, statDate, toStatus, now, user, remark)
+	if err != nil {
+		return fmt.Errorf("保存报送状态失败: %v", err)
+	}
+
+	// 状态未变化时不重复记录日志
+	if fromStatus != toStatus || remark != "" {
+		_, err = tx.Exec(`INSERT INTO `+TableSubmissionStatusLog+` (
+			obj_id, province_name, city_name, country_name, stat_date, event, from_status, to_status, remark, create_time, create_user
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			s.generateUUID(), province, city, country, statDate, event, fromStatus, toStatus, remark, now, user)
+		if err != nil {
+			return fmt.Errorf("记录报送状态变更失败: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// collectStatDates 收集记录中的年份
+func (s *DataImportService) collectStatDates(records []map[string]interface{}) []string {
+	var years []string
+	for _, record := range records {
+		year := s.getStringValue(record["stat_date"])
+		if year != "" && !slices.Contains(years, year) {
+			years = append(years, year)
+		}
+	}
+	slices.Sort(years)
+	return years
+}
+
+// queryStatDatesByObjIDs 查询指定记录的年份
+func (s *DataImportService) queryStatDatesByObjIDs(tableName string, objIDs []string) []string {
+	if len(objIDs) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(objIDs)), ",")
+	query := fmt.Sprintf("SELECT DISTINCT stat_date FROM %s WHERE obj_id IN (%s)", tableName, placeholders)
+	result, err := s.app.GetDB().Query(query, s.convertToInterfaceSlice(objIDs)...)
+	if err != nil || result.Data == nil {
+		return nil
+	}
+	return s.collectStatDates(result.Data.([]map[string]interface{}))
+}
+
+// CheckYearsWritable 检查年份是否允许写入数据，已报送或已接收的年份需重新开放后才能修改
+func (s *DataImportService) CheckYearsWritable(years []string) error {
+	for _, year := range years {
+		status := s.getSubmissionStatus(year)
+		if isSubmissionLocked(status) {
+			return fmt.Errorf("%s年数据%s，不能修改，如需修改请先重新开放该年份", year, submissionStatusNames[status])
+		}
+	}
+	return nil
+}
+
+// checkRecordsWritable 检查待写入记录的年份是否允许写入
+func (s *DataImportService) checkRecordsWritable(records []map[string]interface{}) error {
+	return s.CheckYearsWritable(s.collectStatDates(records))
+}
+
+// advanceSubmissionStatus 数据写入后按事件推进年份的报送状态，推进失败不影响数据写入
+func (s *DataImportService) advanceSubmissionStatus(years []string, event string) {
+	for _, year := range years {
+		// 确认事件只有该年份数据全部确认后才推进
+		if event == SubmissionEventConfirm && s.deriveSubmissionStatus(year) != SubmissionStatusConfirmed {
+			continue
+		}
+		if !slices.Contains(submissionEvents[event].From, s.getSubmissionStatus(year)) {
+			continue
+		}
+		if err := s.transitionSubmissionStatus(year, event, ""); err != nil {
+			log.Printf("更新%s年报送状态失败: %v", year, err)
+		}
+	}
+}
+
+// CheckYearsSubmittable 检查年份是否可以导出报送，只有已确认的年份可以报送，已报送和已接收的年份允许重新导出
+func (s *DataImportService) CheckYearsSubmittable(years []string) error {
+	for _, year := range years {
+		status := s.getSubmissionStatus(year)
+		if status != SubmissionStatusConfirmed && !isSubmissionLocked(status) {
+			return fmt.Errorf("%s年数据当前状态为%s，请确认全部数据后再导出报送", year, submissionStatusNames[status])
+		}
+	}
+	return nil
+}
+
+// SubmitYears 导出报送后锁定年份，已接收的年份保持不变
+func (s *DataImportService) SubmitYears(years []string, fileName string) error {
+	for _, year := range years {
+		if s.getSubmissionStatus(year) == SubmissionStatusAccepted {
+			continue
+		}
+		if err := s.transitionSubmissionStatus(year, SubmissionEventExport, fileName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkReceiptYears 检查年份当前状态是否允许导入回执
+func (s *DataImportService) checkReceiptYears(years []string, event string) error {
+	for _, year := range years {
+		if status := s.getSubmissionStatus(year); !slices.Contains(submissionEvents[event].From, status) {
+			return fmt.Errorf("%s年数据当前状态为%s，不能导入该回执", year, submissionStatusNames[status])
+		}
+	}
+	return nil
+}
+
+// ApplySubmissionReceipt 按上级回执更新年份的报送状态，accepted为接收，否则为退回
+func (s *DataImportService) ApplySubmissionReceipt(years []string, accepted bool, remark string) error {
+	event := SubmissionEventReturn
+	if accepted {
+		event = SubmissionEventAccept
+	}
+	// 先检查全部年份，避免回执只应用了一部分
+	if err := s.checkReceiptYears(years, event); err != nil {
+		return err
+	}
+	for _, year := range years {
+		if err := s.transitionSubmissionStatus(year, event, remark); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReopenSubmissionYear 重新开放已报送的年份，开放后可以修改数据并重新报送
+func (s *DataImportService) ReopenSubmissionYear(statDate string, reason string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return s.reopenSubmissionYearWithRecover(statDate, reason)
+}
+
+// reopenSubmissionYearWithRecover 带异常处理的重新开放年份函数
+func (s *DataImportService) reopenSubmissionYearWithRecover(statDate string, reason string) (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ReopenSubmissionYear 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("函数执行异常: %v", r)}
+		}
+	}()
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return db.QueryResult{Ok: false, Message: "重新开放原因不能为空"}
+	}
+	if err := s.transitionSubmissionStatus(statDate, SubmissionEventReopen, reason); err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+	return db.QueryResult{Ok: true, Message: fmt.Sprintf("%s年数据已重新开放", statDate)}
+}
+
+// QuerySubmissionStatus 查询当前区域各年份的报送状态和变更记录
+func (s *DataImportService) QuerySubmissionStatus() db.QueryResult {
+	// 使用包装函数来处理异常
+	return s.querySubmissionStatusWithRecover()
+}
+
+// querySubmissionStatusWithRecover 带异常处理的查询报送状态函数
+func (s *DataImportService) querySubmissionStatusWithRecover() (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("QuerySubmissionStatus 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("函数执行异常: %v", r)}
+		}
+	}()
+
+	province, city, country := s.getSubmissionRegion()
+
+	// 有数据的年份和有状态记录的年份
+	var unions []string
+	for _, tableName := range submissionDataTables {
+		unions = append(unions, fmt.Sprintf("SELECT stat_date FROM %s", tableName))
+	}
+	unions = append(unions, "SELECT stat_date FROM "+TableSubmissionStatus+" WHERE province_name = ? AND city_name = ? AND country_name = ?")
+	yearsResult, err := s.app.GetDB().Query(strings.Join(unions, " UNION ")+" ORDER BY stat_date DESC", province, city, country)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("查询年份失败: %v", err)}
+	}
+
+	list := []map[string]interface{}{}
+	if yearsResult.Data != nil {
+		for _, row := range yearsResult.Data.([]map[string]interface{}) {
+			year := s.getStringValue(row["stat_date"])
+			if year == "" {
+				continue
+			}
+			status := s.getSubmissionStatus(year)
+			list = append(list, map[string]interface{}{
+				"stat_date":   year,
+				"status":      status,
+				"status_name": submissionStatusNames[status],
+				"locked":      isSubmissionLocked(status),
+			})
+		}
+	}
+
+	logResult, err := s.app.GetDB().Query(`SELECT stat_date, event, from_status, to_status, remark, create_time, create_user
+		FROM `+TableSubmissionStatusLog+` WHERE province_name = ? AND city_name = ? AND country_name = ?
+		ORDER BY create_time DESC`, province, city, country)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("查询报送状态变更记录失败: %v", err)}
+	}
+	logs := []map[string]interface{}{}
+	if logResult.Data != nil {
+		logs = logResult.Data.([]map[string]interface{})
+	}
+
+	return db.QueryResult{
+		Ok:      true,
+		Message: "查询成功",
+		Data: map[string]interface{}{
+			"list": list, // 各年份报送状态
+			"logs": logs, // 状态变更记录
+		},
+	}
+}
@@ -0,0 +1,862 @@
+package data_import
+
+import (
+	"archive/zip"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"shuji/db"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tjfoc/gmsm/sm3"
+	"github.com/xuri/excelize/v2"
+)
+
+// 个性化填报模板相关常量
+const (
+	TemplateVersion         = "1.1"   // 个性化模板版本，模板信息格式变化时升级
+	TemplateMetaSheetName   = "模板信息"  // 隐藏的模板元数据工作表名称
+	TemplateProtectPassword = "shuji" // 模板工作表保护密码，与UnprotecFile解除保护使用的密码一致
+)
+
+// 模板元数据项名称，按顺序写入模板信息工作表
+const (
+	TemplateMetaTableType   = "模板类型"
+	TemplateMetaTableName   = "模板名称"
+	TemplateMetaVersion     = "模板版本"
+	TemplateMetaRegion      = "签发区域"
+	TemplateMetaStatDate    = "数据年份"
+	TemplateMetaCreditCode  = "统一社会信用代码"
+	TemplateMetaUnitName    = "单位名称"
+	TemplateMetaProvince    = "省级名称"
+	TemplateMetaCity        = "市级名称"
+	TemplateMetaCountry     = "县级名称"
+	TemplateMetaCreateTime  = "生成时间"
+	TemplateMetaLockedCells = "锁定单元格"
+	TemplateMetaLockedHash  = "锁定单元格摘要"
+	TemplateMetaChecksum    = "校验码"
+	TemplateMetaSignature   = "签名"
+)
+
+// 模板完整性校验规则编号
+const (
+	TemplateRuleSignature   = "TPL-001" // 模板信息签名不正确，模板信息被篡改
+	TemplateRuleVersion     = "TPL-002" // 模板版本与当前版本不一致
+	TemplateRuleLockedCells = "TPL-003" // 锁定单元格内容被修改
+	TemplateRuleTableType   = "TPL-004" // 模板类型与导入的表格类型不一致
+	TemplateRuleRegion      = "TPL-005" // 模板签发区域与当前区域不一致
+)
+
+// 模板下拉选项
+var (
+	templateCoalTypeOptions       = []string{"原煤", "洗精煤", "其他煤炭", "焦炭"}
+	templateEquipCoalTypeOptions  = []string{"原煤", "洗精煤", "其他煤炭", "焦炭", "其他"}
+	templateInputUnitOptions      = []string{"万吨", "其他"}
+	templateEfficiencyOptions     = []string{"优于先进水平", "先进水平至节能水平之间", "节能水平至准入水平之间", "无能效标准"}
+	templateCapacityUnitOptions   = []string{"蒸吨/小时", "立方米/小时", "吨/小时", "千伏安", "立方米", "兆瓦", "其他"}
+	templateTable1EquipOptions    = []string{"锅炉", "窑炉", "气化炉", "炼铁高炉", "焦化炉", "矿热炉", "其他"}
+	templateTable2EquipOptions    = []string{"锅炉", "窑炉", "其他"}
+	templateTable2UsageOptions    = []string{"农林牧渔", "工业", "服务业", "居民生活", "其他"}
+	templateTable2EquipStatusList = []string{"运行", "停用"}
+)
+
+// templateEquipment 装置清单中的设备信息
+type templateEquipment struct {
+	EquipType        string
+	EquipModelNumber string
+	EquipNo          string
+}
+
+// templateEnterprise 生成个性化模板的单位信息
+type templateEnterprise struct {
+	ProvinceName string
+	CityName     string
+	CountryName  string
+	UnitName     string
+	CreditCode   string
+	Equipments   []templateEquipment
+}
+
+// templateDropdown 模板中的下拉选项区域，EndRow为0时使用设备行的结束行
+type templateDropdown struct {
+	Column   string
+	StartRow int
+	EndRow   int
+	Options  []string
+}
+
+// templateLayout 模板中单位信息、设备信息及可填写区域的位置
+type templateLayout struct {
+	Title          string            // 模板标题，用于生成文件名
+	HeaderChecks   map[string]string // 用于确认模板类型的表头单元格
+	StatDateCell   string
+	UnitNameCell   string
+	CreditCodeCell string
+	ProvinceCell   string
+	CityCell       string
+	CountryCell    string
+	InputRanges    []string // 允许企业填写的区域（不含设备行）
+	EquipStartRow  int      // 设备行开始行
+	EquipEndRow    int      // 模板中预留的设备行结束行
+	EquipLastCol   string   // 设备行最后一列
+	Dropdowns      []templateDropdown
+}
+
+// getTemplateLayout 获取附表1、附表2模板布局
+func getTemplateLayout(tableType string) (templateLayout, bool) {
+	switch tableType {
+	case TableType1:
+		return templateLayout{
+			Title:          "附表1",
+			HeaderChecks:   map[string]string{"B5": "单位名称", "C5": "统一社会信用代码"},
+			StatDateCell:   "A7",
+			UnitNameCell:   "B7",
+			CreditCodeCell: "C7",
+			ProvinceCell:   "G7",
+			CityCell:       "H7",
+			CountryCell:    "I7",
+			InputRanges:    []string{"D7:F7", "J7", "A11:J11", "A15:J24"},
+			EquipStartRow:  28,
+			EquipEndRow:    60,
+			EquipLastCol:   "J",
+			Dropdowns: []templateDropdown{
+				{Column: "D", StartRow: 15, EndRow: 24, Options: templateCoalTypeOptions},
+				{Column: "E", StartRow: 15, EndRow: 24, Options: templateInputUnitOptions},
+				{Column: "B", StartRow: 28, Options: templateTable1EquipOptions},
+				{Column: "F", StartRow: 28, Options: templateEfficiencyOptions},
+				{Column: "G", StartRow: 28, Options: templateCapacityUnitOptions},
+				{Column: "I", StartRow: 28, Options: templateEquipCoalTypeOptions},
+			},
+		}, true
+	case TableType2:
+		return templateLayout{
+			Title:          "附表2",
+			HeaderChecks:   map[string]string{"A3": "单位名称", "F3": "统一社会信用代码"},
+			StatDateCell:   "K4",
+			UnitNameCell:   "B3",
+			CreditCodeCell: "G3",
+			ProvinceCell:   "B4",
+			CityCell:       "C4",
+			CountryCell:    "D4",
+			InputRanges:    []string{"G4:I4"},
+			EquipStartRow:  7,
+			EquipEndRow:    16,
+			EquipLastCol:   "K",
+			Dropdowns: []templateDropdown{
+				{Column: "B", StartRow: 7, Options: templateTable2EquipOptions},
+				{Column: "F", StartRow: 7, Options: templateEfficiencyOptions},
+				{Column: "G", StartRow: 7, Options: templateCapacityUnitOptions},
+				{Column: "I", StartRow: 7, Options: templateTable2UsageOptions},
+				{Column: "J", StartRow: 7, Options: templateTable2EquipStatusList},
+			},
+		}, true
+	}
+	return templateLayout{}, false
+}
+
+// GenerateTemplates 根据企业清单、装置清单生成个性化填报模板
+// tableType为table1时按企业清单生成附表1，为table2时按装置清单生成附表2；
+// creditCodes为空时生成清单中的全部单位；batch为true时按区县每个区县输出一个ZIP包
+func (s *DataImportService) GenerateTemplates(tableType, templatePath, outputDir, statDate string, creditCodes []string, batch bool) db.QueryResult {
+	// 使用包装函数来处理异常
+	return s.generateTemplatesWithRecover(tableType, templatePath, outputDir, statDate, creditCodes, batch)
+}
+
+// generateTemplatesWithRecover 带异常处理的生成个性化填报模板函数
+func (s *DataImportService) generateTemplatesWithRecover(tableType, templatePath, outputDir, statDate string, creditCodes []string, batch bool) db.QueryResult {
+	var result db.QueryResult
+
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("GenerateTemplates 发生异常: %v", r)
+			result = db.QueryResult{
+				Ok:      false,
+				Message: fmt.Sprintf("函数执行异常: %v", r),
+				Data:    nil,
+			}
+		}
+	}()
+
+	layout, ok := getTemplateLayout(tableType)
+	if !ok {
+		return db.QueryResult{Ok: false, Message: "仅支持生成附表1、附表2的个性化模板"}
+	}
+
+	// 1. 检查空白模板是否与表格类型匹配
+	if err := s.checkTemplateFile(templatePath, layout); err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("创建输出目录失败: %v", err)}
+	}
+
+	// 2. 读取需要生成模板的单位
+	enterprises, err := s.loadTemplateEnterprises(tableType, creditCodes)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+	if len(enterprises) == 0 {
+		return db.QueryResult{Ok: false, Message: "清单中没有需要生成模板的单位，请先导入企业清单或装置清单"}
+	}
+
+	// 3. 逐个单位生成模板，批量模式按区县分组写入ZIP包
+	var outputFiles []string
+	var errorMessages []string
+	generated := 0
+
+	if batch {
+		var countyOrder []string
+		countyMap := make(map[string][]templateEnterprise)
+		for _, enterprise := range enterprises {
+			county := enterprise.CountryName
+			if county == "" {
+				county = enterprise.CityName
+			}
+			if _, exists := countyMap[county]; !exists {
+				countyOrder = append(countyOrder, county)
+			}
+			countyMap[county] = append(countyMap[county], enterprise)
+		}
+
+		for _, county := range countyOrder {
+			zipPath := filepath.Join(outputDir, sanitizeTemplateFileName(fmt.Sprintf("%s_%s填报模板.zip", county, layout.Title)))
+			count, errs := s.writeTemplateZip(zipPath, templatePath, tableType, statDate, layout, countyMap[county])
+			generated += count
+			errorMessages = append(errorMessages, errs...)
+			if count > 0 {
+				outputFiles = append(outputFiles, zipPath)
+			}
+		}
+	} else {
+		for _, enterprise := range enterprises {
+			f, err := s.buildTemplate(templatePath, tableType, statDate, layout, enterprise)
+			if err != nil {
+				errorMessages = append(errorMessages, fmt.Sprintf("%s: %v", enterprise.UnitName, err))
+				continue
+			}
+			filePath := filepath.Join(outputDir, getTemplateFileName(layout, enterprise))
+			err = f.SaveAs(filePath)
+			f.Close()
+			if err != nil {
+				errorMessages = append(errorMessages, fmt.Sprintf("%s: 保存模板失败: %v", enterprise.UnitName, err))
+				continue
+			}
+			generated++
+			outputFiles = append(outputFiles, filePath)
+		}
+	}
+
+	message := fmt.Sprintf("共%d家单位，成功生成%d份个性化模板", len(enterprises), generated)
+	if len(errorMessages) > 0 {
+		message += "。错误信息如下：\n\n" + strings.Join(errorMessages, ";\n\n")
+	}
+
+	result = db.QueryResult{
+		Ok:      generated > 0,
+		Message: message,
+		Data: map[string]interface{}{
+			"count": generated,   // 生成的模板数量
+			"files": outputFiles, // 生成的文件（批量模式为ZIP包）
+		},
+	}
+	return result
+}
+
+// checkTemplateFile 检查空白模板文件是否与表格类型匹配
+func (s *DataImportService) checkTemplateFile(templatePath string, layout templateLayout) error {
+	f, err := excelize.OpenFile(templatePath)
+	if err != nil {
+		return fmt.Errorf("读取模板文件失败: %v", err)
+	}
+	defer f.Close()
+
+	sheets := getDataSheetList(f)
+	if len(sheets) == 0 {
+		return fmt.Errorf("模板文件没有工作表")
+	}
+	for cell, expected := range layout.HeaderChecks {
+		value, _ := f.GetCellValue(sheets[0], cell)
+		if strings.TrimSpace(value) != expected {
+			return fmt.Errorf("模板文件与%s模板不匹配，请选择空白的%s模板", layout.Title, layout.Title)
+		}
+	}
+	return nil
+}
+
+// loadTemplateEnterprises 读取需要生成模板的单位：附表1取企业清单，附表2取装置清单中的单位，
+// 两者都带上装置清单中该单位的设备
+func (s *DataImportService) loadTemplateEnterprises(tableType string, creditCodes []string) ([]templateEnterprise, error) {
+	selected := make(map[string]bool)
+	for _, creditCode := range creditCodes {
+		if creditCode = strings.TrimSpace(creditCode); creditCode != "" {
+			selected[creditCode] = true
+		}
+	}
+
+	equipResult, err := s.app.GetDB().Query(`
+		SELECT province_name, city_name, country_name, unit_name, credit_code, equip_type, equip_model_number, equip_no
+		FROM key_equipment_list
+		ORDER BY country_name, credit_code, equip_no
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("查询装置清单失败: %v", err)
+	}
+	equipRows, _ := equipResult.Data.([]map[string]interface{})
+
+	var enterprises []templateEnterprise
+	indexMap := make(map[string]int)
+
+	if tableType == TableType1 {
+		enterpriseResult, err := s.app.GetDB().Query(`
+			SELECT province_name, city_name, country_name, unit_name, credit_code
+			FROM enterprise_list
+			ORDER BY country_name, unit_name
+		`)
+		if err != nil {
+			return nil, fmt.Errorf("查询企业清单失败: %v", err)
+		}
+		enterpriseRows, _ := enterpriseResult.Data.([]map[string]interface{})
+		for _, row := range enterpriseRows {
+			enterprise := s.newTemplateEnterprise(row)
+			if len(selected) > 0 && !selected[enterprise.CreditCode] {
+				continue
+			}
+			if _, exists := indexMap[enterprise.CreditCode]; exists {
+				continue
+			}
+			indexMap[enterprise.CreditCode] = len(enterprises)
+			enterprises = append(enterprises, enterprise)
+		}
+	}
+
+	for _, row := range equipRows {
+		creditCode := strings.TrimSpace(s.getStringValue(row["credit_code"]))
+		if len(selected) > 0 && !selected[creditCode] {
+			continue
+		}
+		index, exists := indexMap[creditCode]
+		if !exists {
+			// 附表1只为企业清单中的企业填写设备
+			if tableType == TableType1 {
+				continue
+			}
+			index = len(enterprises)
+			indexMap[creditCode] = index
+			enterprises = append(enterprises, s.newTemplateEnterprise(row))
+		}
+		enterprises[index].Equipments = append(enterprises[index].Equipments, templateEquipment{
+			EquipType:        strings.TrimSpace(s.getStringValue(row["equip_type"])),
+			EquipModelNumber: strings.TrimSpace(s.getStringValue(row["equip_model_number"])),
+			EquipNo:          strings.TrimSpace(s.getStringValue(row["equip_no"])),
+		})
+	}
+
+	sortTemplateEnterprises(enterprises)
+	return enterprises, nil
+}
+
+// newTemplateEnterprise 根据清单记录创建单位信息
+func (s *DataImportService) newTemplateEnterprise(row map[string]interface{}) templateEnterprise {
+	return templateEnterprise{
+		ProvinceName: strings.TrimSpace(s.getStringValue(row["province_name"])),
+		CityName:     strings.TrimSpace(s.getStringValue(row["city_name"])),
+		CountryName:  strings.TrimSpace(s.getStringValue(row["country_name"])),
+		UnitName:     strings.TrimSpace(s.getStringValue(row["unit_name"])),
+		CreditCode:   strings.TrimSpace(s.getStringValue(row["credit_code"])),
+	}
+}
+
+// writeTemplateZip 将一个区县的全部单位模板写入ZIP包，返回成功生成的数量和错误信息
+func (s *DataImportService) writeTemplateZip(zipPath, templatePath, tableType, statDate string, layout templateLayout, enterprises []templateEnterprise) (int, []string) {
+	var errorMessages []string
+
+	zipFile, err := os.OpenFile(zipPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, []string{fmt.Sprintf("创建ZIP文件失败: %v", err)}
+	}
+	defer zipFile.Close()
+
+	zipWriter := zip.NewWriter(zipFile)
+	defer zipWriter.Close()
+
+	count := 0
+	for _, enterprise := range enterprises {
+		f, err := s.buildTemplate(templatePath, tableType, statDate, layout, enterprise)
+		if err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("%s: %v", enterprise.UnitName, err))
+			continue
+		}
+
+		zipEntry, err := zipWriter.Create(getTemplateFileName(layout, enterprise))
+		if err == nil {
+			_, err = f.WriteTo(zipEntry)
+		}
+		f.Close()
+		if err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("%s: 写入ZIP失败: %v", enterprise.UnitName, err))
+			continue
+		}
+		count++
+	}
+	return count, errorMessages
+}
+
+// buildTemplate 基于空白模板生成单个单位的个性化模板：预填并锁定单位信息、设备信息，
+// 添加下拉选项和隐藏的模板信息工作表，最后保护工作表
+func (s *DataImportService) buildTemplate(templatePath, tableType, statDate string, layout templateLayout, enterprise templateEnterprise) (*excelize.File, error) {
+	f, err := excelize.OpenFile(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("读取模板文件失败: %v", err)
+	}
+
+	sheets := getDataSheetList(f)
+	if len(sheets) == 0 {
+		f.Close()
+		return nil, fmt.Errorf("模板文件没有工作表")
+	}
+	sheetName := sheets[0]
+	f.UnprotectSheet(sheetName, TemplateProtectPassword)
+
+	// 设备数量超过模板预留行数时复制最后一行扩展设备区域
+	equipEndRow := layout.EquipEndRow
+	for equipEndRow-layout.EquipStartRow+1 < len(enterprise.Equipments) {
+		if err := f.DuplicateRow(sheetName, equipEndRow); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("扩展设备行失败: %v", err)
+		}
+		equipEndRow++
+	}
+
+	styleCache := make(map[string]int)
+
+	// 可填写区域解除锁定
+	inputRanges := append([]string{}, layout.InputRanges...)
+	inputRanges = append(inputRanges, fmt.Sprintf("A%d:%s%d", layout.EquipStartRow, layout.EquipLastCol, equipEndRow))
+	if statDate == "" {
+		inputRanges = append(inputRanges, layout.StatDateCell)
+	}
+	for _, cellRange := range inputRanges {
+		if err := setTemplateRangeLocked(f, sheetName, cellRange, false, styleCache); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	// 预填并锁定单位信息
+	identityCells := [][2]string{
+		{layout.UnitNameCell, enterprise.UnitName},
+		{layout.CreditCodeCell, enterprise.CreditCode},
+		{layout.ProvinceCell, enterprise.ProvinceName},
+		{layout.CityCell, enterprise.CityName},
+		{layout.CountryCell, enterprise.CountryName},
+	}
+	if statDate != "" {
+		identityCells = append(identityCells, [2]string{layout.StatDateCell, statDate})
+	}
+	var lockedCells []string
+	for _, identity := range identityCells {
+		f.SetCellStr(sheetName, identity[0], identity[1])
+		if err := setTemplateRangeLocked(f, sheetName, identity[0], true, styleCache); err != nil {
+			f.Close()
+			return nil, err
+		}
+		lockedCells = append(lockedCells, identity[0])
+	}
+
+	// 预填装置清单中的设备，序号、类型、编号锁定
+	for i, equipment := range enterprise.Equipments {
+		row := layout.EquipStartRow + i
+		f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), i+1)
+		f.SetCellStr(sheetName, fmt.Sprintf("B%d", row), equipment.EquipType)
+		f.SetCellStr(sheetName, fmt.Sprintf("C%d", row), equipment.EquipNo)
+		if err := setTemplateRangeLocked(f, sheetName, fmt.Sprintf("A%d:C%d", row, row), true, styleCache); err != nil {
+			f.Close()
+			return nil, err
+		}
+		lockedCells = append(lockedCells, fmt.Sprintf("A%d", row), fmt.Sprintf("B%d", row), fmt.Sprintf("C%d", row))
+	}
+
+	// 模板中缺少的下拉选项补充添加
+	if err := addTemplateDropdowns(f, sheetName, layout, equipEndRow); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// 添加隐藏的模板信息工作表
+	if err := s.writeTemplateMetadata(f, sheetName, tableType, statDate, enterprise, lockedCells); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// 保护工作表和工作簿结构，防止修改单位信息和显示模板信息
+	err = f.ProtectSheet(sheetName, &excelize.SheetProtectionOptions{
+		AlgorithmName:       "SHA-512",
+		Password:            TemplateProtectPassword,
+		SelectLockedCells:   true,
+		SelectUnlockedCells: true,
+		FormatColumns:       true,
+		FormatRows:          true,
+	})
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("保护工作表失败: %v", err)
+	}
+	err = f.ProtectWorkbook(&excelize.WorkbookProtectionOptions{
+		AlgorithmName: "SHA-512",
+		Password:      TemplateProtectPassword,
+		LockStructure: true,
+	})
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("保护工作簿失败: %v", err)
+	}
+
+	f.SetActiveSheet(0)
+	return f, nil
+}
+
+// setTemplateRangeLocked 设置区域内单元格的锁定状态，保留单元格原有样式
+func setTemplateRangeLocked(f *excelize.File, sheetName, cellRange string, locked bool, styleCache map[string]int) error {
+	refs := strings.Split(cellRange, ":")
+	startCol, startRow, err := excelize.CellNameToCoordinates(refs[0])
+	if err != nil {
+		return err
+	}
+	endCol, endRow := startCol, startRow
+	if len(refs) > 1 {
+		if endCol, endRow, err = excelize.CellNameToCoordinates(refs[1]); err != nil {
+			return err
+		}
+	}
+
+	for row := startRow; row <= endRow; row++ {
+		for col := startCol; col <= endCol; col++ {
+			cell, _ := excelize.CoordinatesToCellName(col, row)
+			styleID, err := f.GetCellStyle(sheetName, cell)
+			if err != nil {
+				return err
+			}
+
+			cacheKey := fmt.Sprintf("%d_%t", styleID, locked)
+			newStyleID, exists := styleCache[cacheKey]
+			if !exists {
+				style, err := f.GetStyle(styleID)
+				if err != nil {
+					return err
+				}
+				style.Protection = &excelize.Protection{Locked: locked}
+				if newStyleID, err = f.NewStyle(style); err != nil {
+					return err
+				}
+				styleCache[cacheKey] = newStyleID
+			}
+			if err := f.SetCellStyle(sheetName, cell, cell, newStyleID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addTemplateDropdowns 为模板中尚未设置数据验证的区域添加下拉选项
+func addTemplateDropdowns(f *excelize.File, sheetName string, layout templateLayout, equipEndRow int) error {
+	validations, err := f.GetDataValidations(sheetName)
+	if err != nil {
+		return err
+	}
+
+	for _, dropdown := range layout.Dropdowns {
+		endRow := dropdown.EndRow
+		if endRow == 0 {
+			endRow = equipEndRow
+		}
+
+		// 模板预留区域和扩展出的设备行分别检查
+		ranges := [][2]int{{dropdown.StartRow, endRow}}
+		if dropdown.EndRow == 0 && equipEndRow > layout.EquipEndRow {
+			ranges = [][2]int{{dropdown.StartRow, layout.EquipEndRow}, {layout.EquipEndRow + 1, equipEndRow}}
+		}
+
+		for _, rowRange := range ranges {
+			startCell := fmt.Sprintf("%s%d", dropdown.Column, rowRange[0])
+			if hasDataValidation(validations, startCell) {
+				continue
+			}
+			dv := excelize.NewDataValidation(true)
+			dv.Sqref = fmt.Sprintf("%s:%s%d", startCell, dropdown.Column, rowRange[1])
+			if err := dv.SetDropList(dropdown.Options); err != nil {
+				return err
+			}
+			if err := f.AddDataValidation(sheetName, dv); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasDataValidation 判断单元格是否已设置数据验证
+func hasDataValidation(validations []*excelize.DataValidation, cell string) bool {
+	col, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		return false
+	}
+	for _, validation := range validations {
+		for _, ref := range strings.Fields(validation.Sqref) {
+			refs := strings.Split(ref, ":")
+			startCol, startRow, err := excelize.CellNameToCoordinates(refs[0])
+			if err != nil {
+				continue
+			}
+			endCol, endRow := startCol, startRow
+			if len(refs) > 1 {
+				if endCol, endRow, err = excelize.CellNameToCoordinates(refs[1]); err != nil {
+					continue
+				}
+			}
+			if col >= startCol && col <= endCol && row >= startRow && row <= endRow {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeTemplateMetadata 写入隐藏的模板信息工作表：锁定单元格摘要为锁定单元格内容的SM3摘要，
+// 校验码为各项内容的SM3摘要，签名为校验码的SM4加密结果
+func (s *DataImportService) writeTemplateMetadata(f *excelize.File, sheetName, tableType, statDate string, enterprise templateEnterprise, lockedCells []string) error {
+	if index, _ := f.GetSheetIndex(TemplateMetaSheetName); index >= 0 {
+		if err := f.DeleteSheet(TemplateMetaSheetName); err != nil {
+			return err
+		}
+	}
+	if _, err := f.NewSheet(TemplateMetaSheetName); err != nil {
+		return fmt.Errorf("创建模板信息工作表失败: %v", err)
+	}
+
+	items := [][2]string{
+		{TemplateMetaTableType, tableType},
+		{TemplateMetaTableName, s.getTableName(tableType)},
+		{TemplateMetaVersion, TemplateVersion},
+		{TemplateMetaRegion, s.app.GetAreaStr()},
+		{TemplateMetaStatDate, statDate},
+		{TemplateMetaCreditCode, enterprise.CreditCode},
+		{TemplateMetaUnitName, enterprise.UnitName},
+		{TemplateMetaProvince, enterprise.ProvinceName},
+		{TemplateMetaCity, enterprise.CityName},
+		{TemplateMetaCountry, enterprise.CountryName},
+		{TemplateMetaCreateTime, time.Now().Format("2006-01-02 15:04:05")},
+		{TemplateMetaLockedCells, strings.Join(lockedCells, ",")},
+		{TemplateMetaLockedHash, getTemplateLockedCellsHash(f, sheetName, lockedCells)},
+	}
+	checksum := getTemplateChecksum(items)
+	signature, err := s.app.SM4Encrypt(checksum)
+	if err != nil {
+		return fmt.Errorf("模板信息签名失败: %v", err)
+	}
+	items = append(items, [2]string{TemplateMetaChecksum, checksum}, [2]string{TemplateMetaSignature, signature})
+
+	for i, item := range items {
+		f.SetCellStr(TemplateMetaSheetName, fmt.Sprintf("A%d", i+1), item[0])
+		f.SetCellStr(TemplateMetaSheetName, fmt.Sprintf("B%d", i+1), item[1])
+	}
+	f.SetColWidth(TemplateMetaSheetName, "A", "A", 20)
+	f.SetColWidth(TemplateMetaSheetName, "B", "B", 70)
+
+	return f.SetSheetVisible(TemplateMetaSheetName, false, true)
+}
+
+// getTemplateChecksum 计算模板信息的SM3校验码
+func getTemplateChecksum(items [][2]string) string {
+	var parts []string
+	for _, item := range items {
+		parts = append(parts, item[0]+"="+item[1])
+	}
+	return hex.EncodeToString(sm3.Sm3Sum([]byte(strings.Join(parts, "|"))))
+}
+
+// getTemplateLockedCellsHash 计算锁定单元格内容的SM3摘要
+func getTemplateLockedCellsHash(f *excelize.File, sheetName string, lockedCells []string) string {
+	var parts []string
+	for _, cell := range lockedCells {
+		value, _ := f.GetCellValue(sheetName, cell)
+		parts = append(parts, cell+"="+strings.TrimSpace(value))
+	}
+	return hex.EncodeToString(sm3.Sm3Sum([]byte(strings.Join(parts, "|"))))
+}
+
+// readTemplateMetadata 读取模板信息工作表，不是个性化模板时返回false
+func readTemplateMetadata(f *excelize.File) ([][2]string, bool) {
+	if index, _ := f.GetSheetIndex(TemplateMetaSheetName); index < 0 {
+		return nil, false
+	}
+	rows, err := f.GetRows(TemplateMetaSheetName)
+	if err != nil {
+		return nil, false
+	}
+
+	var items [][2]string
+	for _, row := range rows {
+		if len(row) == 0 || row[0] == "" {
+			continue
+		}
+		value := ""
+		if len(row) > 1 {
+			value = row[1]
+		}
+		items = append(items, [2]string{row[0], value})
+	}
+	return items, len(items) > 0
+}
+
+// getTemplateMetaValue 获取模板信息中指定项的值
+func getTemplateMetaValue(items [][2]string, key string) string {
+	for _, item := range items {
+		if item[0] == key {
+			return item[1]
+		}
+	}
+	return ""
+}
+
+// verifyTemplateIntegrity 校验个性化模板的完整性：模板信息签名、模板版本、模板类型、签发区域和锁定单元格内容，
+// 不是系统生成的个性化模板时不校验
+func (s *DataImportService) verifyTemplateIntegrity(f *excelize.File, tableType string) []ValidationError {
+	errors := []ValidationError{}
+
+	items, ok := readTemplateMetadata(f)
+	if !ok {
+		return errors
+	}
+
+	// 1. 校验签名，签名不正确时其他内容均不可信
+	var signedItems [][2]string
+	for _, item := range items {
+		if item[0] != TemplateMetaChecksum && item[0] != TemplateMetaSignature {
+			signedItems = append(signedItems, item)
+		}
+	}
+	checksum := getTemplateChecksum(signedItems)
+	signature, err := s.app.SM4Encrypt(checksum)
+	if err != nil || checksum != getTemplateMetaValue(items, TemplateMetaChecksum) || signature != getTemplateMetaValue(items, TemplateMetaSignature) {
+		errors = append(errors, ValidationError{
+			Message: "【模板校验】模板信息签名不正确，模板信息已被篡改，请使用下发的原始模板填报",
+			RuleID:  TemplateRuleSignature,
+		})
+		return errors
+	}
+
+	// 2. 校验模板版本和模板类型
+	if version := getTemplateMetaValue(items, TemplateMetaVersion); version != TemplateVersion {
+		errors = append(errors, ValidationError{
+			Message: fmt.Sprintf("【模板校验】模板版本%s与当前版本%s不一致，请重新下载模板填报", version, TemplateVersion),
+			RuleID:  TemplateRuleVersion,
+		})
+		return errors
+	}
+	if metaTableType := getTemplateMetaValue(items, TemplateMetaTableType); metaTableType != tableType {
+		errors = append(errors, ValidationError{
+			Message: fmt.Sprintf("【模板校验】该文件为%s模板，不能作为%s导入", getTemplateMetaValue(items, TemplateMetaTableName), s.getTableName(tableType)),
+			RuleID:  TemplateRuleTableType,
+		})
+		return errors
+	}
+
+	// 3. 签发区域与当前区域需为同一区域或上下级关系
+	region := getTemplateMetaValue(items, TemplateMetaRegion)
+	currentRegion := s.app.GetAreaStr()
+	if region != "" && currentRegion != "" && !strings.HasPrefix(region, currentRegion) && !strings.HasPrefix(currentRegion, region) {
+		errors = append(errors, ValidationError{
+			Message: fmt.Sprintf("【模板校验】模板签发区域%s与当前区域%s不一致", region, currentRegion),
+			RuleID:  TemplateRuleRegion,
+		})
+	}
+
+	// 4. 校验锁定单元格内容
+	sheets := getDataSheetList(f)
+	if len(sheets) == 0 {
+		return errors
+	}
+	var lockedCells []string
+	if value := getTemplateMetaValue(items, TemplateMetaLockedCells); value != "" {
+		lockedCells = strings.Split(value, ",")
+	}
+	if getTemplateLockedCellsHash(f, sheets[0], lockedCells) != getTemplateMetaValue(items, TemplateMetaLockedHash) {
+		// 定位被修改的单元格：与模板信息中记录的单位信息逐项比对
+		expected := map[string]string{}
+		layout, _ := getTemplateLayout(tableType)
+		expected[layout.UnitNameCell] = getTemplateMetaValue(items, TemplateMetaUnitName)
+		expected[layout.CreditCodeCell] = getTemplateMetaValue(items, TemplateMetaCreditCode)
+		expected[layout.ProvinceCell] = getTemplateMetaValue(items, TemplateMetaProvince)
+		expected[layout.CityCell] = getTemplateMetaValue(items, TemplateMetaCity)
+		expected[layout.CountryCell] = getTemplateMetaValue(items, TemplateMetaCountry)
+		if statDate := getTemplateMetaValue(items, TemplateMetaStatDate); statDate != "" {
+			expected[layout.StatDateCell] = statDate
+		}
+
+		var changedCells []string
+		for _, cell := range lockedCells {
+			if expectedValue, exists := expected[cell]; exists {
+				value, _ := f.GetCellValue(sheets[0], cell)
+				if strings.TrimSpace(value) != expectedValue {
+					changedCells = append(changedCells, cell)
+				}
+			}
+		}
+
+		message := "【模板校验】模板中锁定的单位信息或设备信息被修改，请使用下发的原始模板填报"
+		if len(changedCells) > 0 {
+			message = fmt.Sprintf("【模板校验】模板中锁定的单位信息或设备信息被修改（其中单元格%s与模板信息不符），请使用下发的原始模板填报", strings.Join(changedCells, ","))
+		}
+		errors = append(errors, ValidationError{
+			Message: message,
+			Cells:   changedCells,
+			RuleID:  TemplateRuleLockedCells,
+		})
+	}
+
+	return errors
+}
+
+// checkImportTemplateIntegrity 导入时校验个性化模板完整性，校验失败时登记导入记录和导入校验结果，返回错误信息
+func (s *DataImportService) checkImportTemplateIntegrity(f *excelize.File, filePath, tableType, fileHash string) []string {
+	templateErrors := s.verifyTemplateIntegrity(f, tableType)
+	if len(templateErrors) == 0 {
+		return nil
+	}
+
+	fileName := filepath.Base(filePath)
+	var messages []string
+	for _, err := range templateErrors {
+		messages = append(messages, err.Message)
+	}
+	s.app.InsertImportRecordWithHash(fileName, tableType, "导入失败", fmt.Sprintf("模板校验失败: %s", strings.Join(messages, "; ")), fileHash)
+	s.saveImportValidationReport(tableType, fileName, s.buildValidationReportEntries(filePath, tableType, templateErrors))
+	return messages
+}
+
+// getTemplateFileName 生成个性化模板文件名
+func getTemplateFileName(layout templateLayout, enterprise templateEnterprise) string {
+	return sanitizeTemplateFileName(fmt.Sprintf("%s_%s_%s.xlsx", layout.Title, enterprise.UnitName, enterprise.CreditCode))
+}
+
+// sanitizeTemplateFileName 替换文件名中不允许使用的字符
+func sanitizeTemplateFileName(name string) string {
+	replacer := strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_")
+	return replacer.Replace(name)
+}
+
+// sortTemplateEnterprises 按区县、单位名称排序
+func sortTemplateEnterprises(enterprises []templateEnterprise) {
+	sort.SliceStable(enterprises, func(i, j int) bool {
+		if enterprises[i].CountryName != enterprises[j].CountryName {
+			return enterprises[i].CountryName < enterprises[j].CountryName
+		}
+		return enterprises[i].UnitName < enterprises[j].UnitName
+	})
+}
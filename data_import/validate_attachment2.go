@@ -12,14 +12,17 @@ import (
 
 // parseAttachment2Excel 解析附件2Excel文件
 func (s *DataImportService) parseAttachment2Excel(f *excelize.File, skipValidate bool) ([]map[string]interface{}, error) {
-	// 获取所有工作表
-	sheets := f.GetSheetList()
-	if len(sheets) == 0 {
-		return nil, fmt.Errorf("Excel文件没有工作表")
+	sheet, err := s.readFormulaSheet(f)
+	if err != nil {
+		return nil, err
 	}
+	return s.parseAttachment2FormulaSheet(sheet, skipValidate)
+}
 
+// parseAttachment2FormulaSheet 解析附件2工作表数据
+func (s *DataImportService) parseAttachment2FormulaSheet(sheet *formulaSheet, skipValidate bool) ([]map[string]interface{}, error) {
 	// 解析主表数据
-	mainData, err := s.parseAttachment2MainSheet(f, sheets[0], skipValidate)
+	mainData, err := s.parseAttachment2MainSheet(sheet.Rows, skipValidate)
 	if err != nil {
 		return nil, fmt.Errorf("解析%s数据失败: %v", TableTypeAttachment2, err)
 	}
@@ -28,15 +31,9 @@ func (s *DataImportService) parseAttachment2Excel(f *excelize.File, skipValidate
 }
 
 // parseAttachment2MainSheet 解析附件2主表数据
-func (s *DataImportService) parseAttachment2MainSheet(f *excelize.File, sheetName string, skipValidate bool) ([]map[string]interface{}, error) {
+func (s *DataImportService) parseAttachment2MainSheet(rows [][]string, skipValidate bool) ([]map[string]interface{}, error) {
 	var mainData []map[string]interface{}
 
-	// 读取表格数据
-	rows, err := f.GetRows(sheetName)
-	if err != nil {
-		return nil, err
-	}
-
 	// 查找表格的开始位置（第4行是表头）
 	startDataRow := 7
 	if startDataRow >= len(rows) {
@@ -206,6 +203,7 @@ func (s *DataImportService) ValidateAttachment2File(filePath string, isCover boo
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		errorMessage := fmt.Sprintf("文件不存在: %v", err)
 		s.app.InsertImportRecord(fileName, TableTypeAttachment2, "导入失败", errorMessage)
+		s.saveImportValidationReport(TableTypeAttachment2, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
 		return db.QueryResult{
 			Ok:      false,
 			Message: errorMessage,
@@ -213,11 +211,22 @@ func (s *DataImportService) ValidateAttachment2File(filePath string, isCover boo
 		}
 	}
 
+	// 计算文件内容哈希并归档原始文件，相同内容的文件重复上传时直接提示
+	fileHash, duplicateErrors := s.checkUploadFileHash(filePath, TableTypeAttachment2)
+	if len(duplicateErrors) > 0 {
+		return db.QueryResult{
+			Ok:      false,
+			Data:    duplicateErrors,
+			Message: fmt.Sprintf("重复文件: %s", strings.Join(duplicateErrors, "; ")),
+		}
+	}
+
 	// 文件是否可读取
 	f, err := excelize.OpenFile(filePath)
 	if err != nil {
 		errorMessage := fmt.Sprintf("读取Excel文件失败: %v", err)
-		s.app.InsertImportRecord(fileName, TableTypeAttachment2, "导入失败", errorMessage)
+		s.app.InsertImportRecordWithHash(fileName, TableTypeAttachment2, "导入失败", errorMessage, fileHash)
+		s.saveImportValidationReport(TableTypeAttachment2, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
 		return db.QueryResult{
 			Ok:      false,
 			Message: errorMessage,
@@ -230,7 +239,8 @@ func (s *DataImportService) ValidateAttachment2File(filePath string, isCover boo
 	mainData, err := s.parseAttachment2Excel(f, false)
 	if err != nil {
 		errorMessage := err.Error()
-		s.app.InsertImportRecord(fileName, TableTypeAttachment2, "导入失败", errorMessage)
+		s.app.InsertImportRecordWithHash(fileName, TableTypeAttachment2, "导入失败", errorMessage, fileHash)
+		s.saveImportValidationReport(TableTypeAttachment2, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
 		return db.QueryResult{
 			Ok:      false,
 			Message: errorMessage,
@@ -238,12 +248,22 @@ func (s *DataImportService) ValidateAttachment2File(filePath string, isCover boo
 		}
 	}
 
+	// 个性化模板完整性校验
+	if templateErrors := s.checkImportTemplateIntegrity(f, filePath, TableTypeAttachment2, fileHash); len(templateErrors) > 0 {
+		return db.QueryResult{
+			Ok:      false,
+			Data:    templateErrors,
+			Message: fmt.Sprintf("模板校验失败: %s", strings.Join(templateErrors, "; ")),
+		}
+	}
+
 	areaConfig := s.GetAreaConfig()
 	// 按行读取文件数据并校验
 	validationErrors := s.validateAttachment2Data(mainData, areaConfig)
 	if len(validationErrors) > 0 {
 		errorMessage := fmt.Sprintf("数据校验失败: %s", strings.Join(validationErrors, "; "))
-		s.app.InsertImportRecord(fileName, TableTypeAttachment2, "导入失败", errorMessage)
+		s.app.InsertImportRecordWithHash(fileName, TableTypeAttachment2, "导入失败", errorMessage, fileHash)
+		s.saveImportValidationReport(TableTypeAttachment2, fileName, newImportValidationReportEntries(fileName, validationErrors))
 		return db.QueryResult{
 			Ok:      false,
 			Message: errorMessage,
@@ -269,7 +289,7 @@ func (s *DataImportService) ValidateAttachment2File(filePath string, isCover boo
 		copyResult := s.app.CopyFileToCache(TableTypeAttachment2, filePath)
 		if !copyResult.Ok {
 			errorMessage := fmt.Sprintf("文件复制到缓存失败: %s", copyResult.Message)
-			s.app.InsertImportRecord(fileName, TableTypeAttachment2, "导入失败", errorMessage)
+			s.app.InsertImportRecordWithHash(fileName, TableTypeAttachment2, "导入失败", errorMessage, fileHash)
 			return db.QueryResult{
 				Ok:      false,
 				Message: errorMessage,
@@ -279,7 +299,8 @@ func (s *DataImportService) ValidateAttachment2File(filePath string, isCover boo
 			s.UnprotecFile(copyResult.Data.(string))
 		}
 
-		s.app.InsertImportRecord(fileName, TableTypeAttachment2, "导入成功", "校验通过")
+		s.app.InsertImportRecordWithHash(fileName, TableTypeAttachment2, "导入成功", "校验通过", fileHash)
+		s.saveImportValidationReport(TableTypeAttachment2, fileName, nil)
 	}
 
 	return db.QueryResult{
@@ -13,27 +13,29 @@ import (
 
 // parseTable1Excel 解析附表1Excel文件
 func (s *DataImportService) parseTable1Excel(f *excelize.File, skipValidate bool) ([]map[string]interface{}, []map[string]interface{}, []map[string]interface{}, error) {
-	// 获取所有工作表
-	sheets := f.GetSheetList()
-
-	if len(sheets) == 0 {
-		return nil, nil, nil, fmt.Errorf("Excel文件没有工作表")
+	sheet, err := s.readFormulaSheet(f)
+	if err != nil {
+		return nil, nil, nil, err
 	}
+	return s.parseTable1FormulaSheet(sheet, skipValidate)
+}
 
+// parseTable1FormulaSheet 解析附表1工作表数据，主表、用途、设备三部分共用同一次读取的行数据
+func (s *DataImportService) parseTable1FormulaSheet(sheet *formulaSheet, skipValidate bool) ([]map[string]interface{}, []map[string]interface{}, []map[string]interface{}, error) {
 	// 解析主表数据（企业基本信息）
-	mainData, err := s.parseTable1MainSheet(f, sheets[0], skipValidate)
+	mainData, err := s.parseTable1MainSheet(sheet.Rows, skipValidate)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("与数据模板不匹配")
 	}
 
 	// 解析用途数据（煤炭消费主要用途情况）
-	usageData, err := s.parseTable1UsageSheet(f, sheets[0], skipValidate)
+	usageData, err := s.parseTable1UsageSheet(sheet.Rows, skipValidate)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("与数据模板不匹配")
 	}
 
 	// 解析设备数据（重点耗煤装置情况）
-	equipData, err := s.parseTable1EquipSheet(f, sheets[0], skipValidate)
+	equipData, err := s.parseTable1EquipSheet(sheet.Rows, skipValidate)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("与数据模板不匹配")
 	}
@@ -42,15 +44,9 @@ func (s *DataImportService) parseTable1Excel(f *excelize.File, skipValidate bool
 }
 
 // parseTable1MainSheet 解析附表1主表数据
-func (s *DataImportService) parseTable1MainSheet(f *excelize.File, sheetName string, skipValidate bool) ([]map[string]interface{}, error) {
+func (s *DataImportService) parseTable1MainSheet(rows [][]string, skipValidate bool) ([]map[string]interface{}, error) {
 	var mainData []map[string]interface{}
 
-	// 读取企业基本信息表格
-	rows, err := f.GetRows(sheetName)
-	if err != nil {
-		return nil, err
-	}
-
 	// 查找企业基本信息表格的开始位置（第5行是表头）
 	startRow := 4 // 从第5行开始
 	if startRow >= len(rows) {
@@ -164,14 +160,9 @@ func (s *DataImportService) parseTable1MainSheet(f *excelize.File, sheetName str
 }
 
 // parseTable1UsageSheet 解析附表1用途数据
-func (s *DataImportService) parseTable1UsageSheet(f *excelize.File, sheetName string, skipValidate bool) ([]map[string]interface{}, error) {
+func (s *DataImportService) parseTable1UsageSheet(rows [][]string, skipValidate bool) ([]map[string]interface{}, error) {
 	var usageData []map[string]interface{}
 
-	rows, err := f.GetRows(sheetName)
-	if err != nil {
-		return nil, err
-	}
-
 	// 查找煤炭消费主要用途情况表格的开始位置
 	startRow := -1
 	for i, row := range rows {
@@ -251,14 +242,9 @@ func (s *DataImportService) parseTable1UsageSheet(f *excelize.File, sheetName st
 }
 
 // parseTable1EquipSheet 解析附表1设备数据
-func (s *DataImportService) parseTable1EquipSheet(f *excelize.File, sheetName string, skipValidate bool) ([]map[string]interface{}, error) {
+func (s *DataImportService) parseTable1EquipSheet(rows [][]string, skipValidate bool) ([]map[string]interface{}, error) {
 	var equipData []map[string]interface{}
 
-	rows, err := f.GetRows(sheetName)
-	if err != nil {
-		return nil, err
-	}
-
 	// 查找重点耗煤装置情况表格的开始位置
 	startRow := -1
 	for i, row := range rows {
@@ -412,6 +398,7 @@ func (s *DataImportService) ValidateTable1File(filePath string, isCover bool) db
 		errorMessage := fmt.Sprintf("文件不存在: %v", err)
 		fmt.Println(errorMessage)
 		s.app.InsertImportRecord(fileName, TableType1, "导入失败", errorMessage)
+		s.saveImportValidationReport(TableType1, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
 		return db.QueryResult{
 			Ok:      false,
 			Data:    []string{errorMessage},
@@ -419,12 +406,23 @@ func (s *DataImportService) ValidateTable1File(filePath string, isCover bool) db
 		}
 	}
 
+	// 计算文件内容哈希并归档原始文件，相同内容的文件重复上传时直接提示
+	fileHash, duplicateErrors := s.checkUploadFileHash(filePath, TableType1)
+	if len(duplicateErrors) > 0 {
+		return db.QueryResult{
+			Ok:      false,
+			Data:    duplicateErrors,
+			Message: fmt.Sprintf("重复文件: %s", strings.Join(duplicateErrors, "; ")),
+		}
+	}
+
 	// 第二步: 文件是否可读取
 	f, err := excelize.OpenFile(filePath)
 	if err != nil {
 		errorMessage := fmt.Sprintf("读取文件失败: %v", err)
 		fmt.Println(errorMessage)
-		s.app.InsertImportRecord(fileName, TableType1, "导入失败", errorMessage)
+		s.app.InsertImportRecordWithHash(fileName, TableType1, "导入失败", errorMessage, fileHash)
+		s.saveImportValidationReport(TableType1, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
 		return db.QueryResult{
 			Ok:      false,
 			Data:    []string{errorMessage},
@@ -437,7 +435,8 @@ func (s *DataImportService) ValidateTable1File(filePath string, isCover bool) db
 	mainData, usageData, equipData, err := s.parseTable1Excel(f, false)
 	if err != nil {
 		errorMessage := err.Error()
-		s.app.InsertImportRecord(fileName, TableType1, "导入失败", errorMessage)
+		s.app.InsertImportRecordWithHash(fileName, TableType1, "导入失败", errorMessage, fileHash)
+		s.saveImportValidationReport(TableType1, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
 		return db.QueryResult{
 			Ok:      false,
 			Data:    []string{errorMessage},
@@ -445,12 +444,22 @@ func (s *DataImportService) ValidateTable1File(filePath string, isCover bool) db
 		}
 	}
 
+	// 个性化模板完整性校验
+	if templateErrors := s.checkImportTemplateIntegrity(f, filePath, TableType1, fileHash); len(templateErrors) > 0 {
+		return db.QueryResult{
+			Ok:      false,
+			Data:    templateErrors,
+			Message: fmt.Sprintf("模板校验失败: %s", strings.Join(templateErrors, "; ")),
+		}
+	}
+
 	// 第五步: 按行读取文件数据并校验
 	validationErrors := s.validateTable1DataWithEnterpriseCheck(mainData, usageData, equipData)
 	if len(validationErrors) > 0 {
 		errorMessage := fmt.Sprintf("数据校验失败: %s", strings.Join(validationErrors, "; "))
 		fmt.Println(errorMessage)
-		s.app.InsertImportRecord(fileName, TableType1, "导入失败", errorMessage)
+		s.app.InsertImportRecordWithHash(fileName, TableType1, "导入失败", errorMessage, fileHash)
+		s.saveImportValidationReport(TableType1, fileName, newImportValidationReportEntries(fileName, validationErrors))
 		return db.QueryResult{
 			Ok:      false,
 			Data:    validationErrors,
@@ -478,7 +487,7 @@ func (s *DataImportService) ValidateTable1File(filePath string, isCover bool) db
 		if !copyResult.Ok {
 			errorMessage := fmt.Sprintf("文件复制到缓存失败: %s", copyResult.Message)
 			fmt.Println(errorMessage)
-			s.app.InsertImportRecord(fileName, TableType1, "导入失败", errorMessage)
+			s.app.InsertImportRecordWithHash(fileName, TableType1, "导入失败", errorMessage, fileHash)
 			return db.QueryResult{
 				Ok:      false,
 				Data:    []string{errorMessage},
@@ -488,7 +497,8 @@ func (s *DataImportService) ValidateTable1File(filePath string, isCover bool) db
 			s.UnprotecFile(copyResult.Data.(string))
 		}
 
-		s.app.InsertImportRecord(fileName, TableType1, "导入成功", "校验通过")
+		s.app.InsertImportRecordWithHash(fileName, TableType1, "导入成功", "校验通过", fileHash)
+		s.saveImportValidationReport(TableType1, fileName, nil)
 	}
 
 	return db.QueryResult{
@@ -521,7 +531,6 @@ func (s *DataImportService) validateTable1DataWithEnterpriseCheck(mainData, usag
 		"province_name",
 		"city_name",
 		"country_name",
-		"tel",
 	}
 
 	unitInfoRequiredFields := map[string]string{
@@ -534,7 +543,6 @@ func (s *DataImportService) validateTable1DataWithEnterpriseCheck(mainData, usag
 		"province_name": "单位所在省/市/区",
 		"city_name":     "单位所在地市",
 		"country_name":  "单位所在区县",
-		"tel":           "联系电话",
 	}
 
 	// 这里可能还需要优化一下，在表里，行业门类、大类、中类是在一起的，联系电话在最后。提示语也按照这个顺序吧，要不显得比较粗糙
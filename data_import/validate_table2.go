@@ -12,14 +12,17 @@ import (
 
 // parseTable2Excel 解析附表2Excel文件
 func (s *DataImportService) parseTable2Excel(f *excelize.File, skipValidate bool) (map[string]interface{}, []map[string]interface{}, error) {
-	// 获取所有工作表
-	sheets := f.GetSheetList()
-	if len(sheets) == 0 {
-		return nil, nil, fmt.Errorf("Excel文件没有工作表")
+	sheet, err := s.readFormulaSheet(f)
+	if err != nil {
+		return nil, nil, err
 	}
+	return s.parseTable2FormulaSheet(sheet, skipValidate)
+}
 
+// parseTable2FormulaSheet 解析附表2工作表数据
+func (s *DataImportService) parseTable2FormulaSheet(sheet *formulaSheet, skipValidate bool) (map[string]interface{}, []map[string]interface{}, error) {
 	// 解析主表数据
-	unitInfo, mainData, err := s.parseTable2MainSheet(f, sheets[0], skipValidate)
+	unitInfo, mainData, err := s.parseTable2MainSheet(sheet.Rows, skipValidate)
 	if err != nil {
 		return nil, nil, fmt.Errorf("与数据模板不匹配")
 	}
@@ -32,15 +35,9 @@ func (s *DataImportService) parseTable2Excel(f *excelize.File, skipValidate bool
 }
 
 // parseTable2MainSheet 解析附表2主表数据
-func (s *DataImportService) parseTable2MainSheet(f *excelize.File, sheetName string, skipValidate bool) (map[string]interface{}, []map[string]interface{}, error) {
+func (s *DataImportService) parseTable2MainSheet(rows [][]string, skipValidate bool) (map[string]interface{}, []map[string]interface{}, error) {
 	var mainData []map[string]interface{}
 
-	// 读取表格数据
-	rows, err := f.GetRows(sheetName)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	// 解析单位基本信息（第3-4行）
 	unitInfo, err := s.parseTable2UnitInfo(rows)
 	if err != nil {
@@ -181,6 +178,7 @@ func (s *DataImportService) ValidateTable2File(filePath string, isCover bool) db
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		errorMessage := "文件不存在"
 		s.app.InsertImportRecord(fileName, TableType2, "导入失败", errorMessage)
+		s.saveImportValidationReport(TableType2, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
 		return db.QueryResult{
 			Ok:      false,
 			Data:    []string{errorMessage},
@@ -188,11 +186,22 @@ func (s *DataImportService) ValidateTable2File(filePath string, isCover bool) db
 		}
 	}
 
+	// 计算文件内容哈希并归档原始文件，相同内容的文件重复上传时直接提示
+	fileHash, duplicateErrors := s.checkUploadFileHash(filePath, TableType2)
+	if len(duplicateErrors) > 0 {
+		return db.QueryResult{
+			Ok:      false,
+			Data:    duplicateErrors,
+			Message: fmt.Sprintf("重复文件: %s", strings.Join(duplicateErrors, "; ")),
+		}
+	}
+
 	// 文件是否可读取
 	f, err := excelize.OpenFile(filePath)
 	if err != nil {
 		errorMessage := fmt.Sprintf("读取Excel文件失败: %v", err)
-		s.app.InsertImportRecord(fileName, TableType2, "导入失败", errorMessage)
+		s.app.InsertImportRecordWithHash(fileName, TableType2, "导入失败", errorMessage, fileHash)
+		s.saveImportValidationReport(TableType2, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
 		return db.QueryResult{
 			Ok:      false,
 			Data:    []string{errorMessage},
@@ -205,7 +214,8 @@ func (s *DataImportService) ValidateTable2File(filePath string, isCover bool) db
 	unitInfo, mainData, err := s.parseTable2Excel(f, false)
 	if err != nil {
 		errorMessage := err.Error()
-		s.app.InsertImportRecord(fileName, TableType2, "导入失败", errorMessage)
+		s.app.InsertImportRecordWithHash(fileName, TableType2, "导入失败", errorMessage, fileHash)
+		s.saveImportValidationReport(TableType2, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
 		return db.QueryResult{
 			Ok:      false,
 			Data:    []string{errorMessage},
@@ -213,11 +223,21 @@ func (s *DataImportService) ValidateTable2File(filePath string, isCover bool) db
 		}
 	}
 
+	// 个性化模板完整性校验
+	if templateErrors := s.checkImportTemplateIntegrity(f, filePath, TableType2, fileHash); len(templateErrors) > 0 {
+		return db.QueryResult{
+			Ok:      false,
+			Data:    templateErrors,
+			Message: fmt.Sprintf("模板校验失败: %s", strings.Join(templateErrors, "; ")),
+		}
+	}
+
 	// 按行读取文件数据并校验
 	validationErrors := s.validateTable2DataWithEnterpriseCheck(unitInfo, mainData)
 	if len(validationErrors) > 0 {
 		errorMessage := fmt.Sprintf("数据校验失败: %s", strings.Join(validationErrors, "; "))
-		s.app.InsertImportRecord(fileName, TableType2, "导入失败", errorMessage)
+		s.app.InsertImportRecordWithHash(fileName, TableType2, "导入失败", errorMessage, fileHash)
+		s.saveImportValidationReport(TableType2, fileName, newImportValidationReportEntries(fileName, validationErrors))
 		return db.QueryResult{
 			Ok:      false,
 			Data:    validationErrors,
@@ -243,7 +263,7 @@ func (s *DataImportService) ValidateTable2File(filePath string, isCover bool) db
 	copyResult := s.app.CopyFileToCache(TableType2, filePath)
 	if !copyResult.Ok {
 		copyMessage := fmt.Sprintf("文件复制到缓存失败: %s", copyResult.Message)
-		s.app.InsertImportRecord(fileName, TableType2, "导入失败", copyMessage)
+		s.app.InsertImportRecordWithHash(fileName, TableType2, "导入失败", copyMessage, fileHash)
 		return db.QueryResult{
 			Ok:      false,
 			Data:    []string{copyMessage},
@@ -253,7 +273,8 @@ func (s *DataImportService) ValidateTable2File(filePath string, isCover bool) db
 		s.UnprotecFile(copyResult.Data.(string))
 	}
 
-	s.app.InsertImportRecord(fileName, TableType2, "导入成功", "校验通过")
+	s.app.InsertImportRecordWithHash(fileName, TableType2, "导入成功", "校验通过", fileHash)
+	s.saveImportValidationReport(TableType2, fileName, nil)
 
 	return db.QueryResult{
 		Ok:      true,
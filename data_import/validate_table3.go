@@ -12,14 +12,17 @@ import (
 
 // parseTable3Excel 解析附表3Excel文件
 func (s *DataImportService) parseTable3Excel(f *excelize.File, skipValidate bool) ([]map[string]interface{}, error) {
-	// 获取所有工作表
-	sheets := f.GetSheetList()
-	if len(sheets) == 0 {
-		return nil, fmt.Errorf("Excel文件没有工作表")
+	sheet, err := s.readFormulaSheet(f)
+	if err != nil {
+		return nil, err
 	}
+	return s.parseTable3FormulaSheet(sheet, skipValidate)
+}
 
+// parseTable3FormulaSheet 解析附表3工作表数据
+func (s *DataImportService) parseTable3FormulaSheet(sheet *formulaSheet, skipValidate bool) ([]map[string]interface{}, error) {
 	// 解析主表数据
-	mainData, err := s.parseTable3MainSheet(f, sheets[0], skipValidate)
+	mainData, err := s.parseTable3MainSheet(sheet.Rows, skipValidate)
 	if err != nil {
 		return nil, fmt.Errorf("解析主表数据失败: %v", err)
 	}
@@ -28,15 +31,9 @@ func (s *DataImportService) parseTable3Excel(f *excelize.File, skipValidate bool
 }
 
 // parseTable3MainSheet 解析附表3主表数据
-func (s *DataImportService) parseTable3MainSheet(f *excelize.File, sheetName string, skipValidate bool) ([]map[string]interface{}, error) {
+func (s *DataImportService) parseTable3MainSheet(rows [][]string, skipValidate bool) ([]map[string]interface{}, error) {
 	var mainData []map[string]interface{}
 
-	// 读取表格数据
-	rows, err := f.GetRows(sheetName)
-	if err != nil {
-		return nil, err
-	}
-
 	// 查找表格的开始位置
 	startRow := 2
 	if startRow >= len(rows) {
@@ -169,6 +166,7 @@ func (s *DataImportService) ValidateTable3File(filePath string, isCover bool) db
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		errorMessage := fmt.Sprintf("文件不存在: %v", err)
 		s.app.InsertImportRecord(fileName, TableType3, "导入失败", errorMessage)
+		s.saveImportValidationReport(TableType3, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
 		return db.QueryResult{
 			Ok:      false,
 			Data:    []string{errorMessage},
@@ -176,11 +174,22 @@ func (s *DataImportService) ValidateTable3File(filePath string, isCover bool) db
 		}
 	}
 
+	// 计算文件内容哈希并归档原始文件，相同内容的文件重复上传时直接提示
+	fileHash, duplicateErrors := s.checkUploadFileHash(filePath, TableType3)
+	if len(duplicateErrors) > 0 {
+		return db.QueryResult{
+			Ok:      false,
+			Data:    duplicateErrors,
+			Message: fmt.Sprintf("重复文件: %s", strings.Join(duplicateErrors, "; ")),
+		}
+	}
+
 	// 文件是否可读取
 	f, err := excelize.OpenFile(filePath)
 	if err != nil {
 		errorMessage := fmt.Sprintf("读取Excel文件失败: %v", err)
-		s.app.InsertImportRecord(fileName, TableType3, "导入失败", errorMessage)
+		s.app.InsertImportRecordWithHash(fileName, TableType3, "导入失败", errorMessage, fileHash)
+		s.saveImportValidationReport(TableType3, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
 		return db.QueryResult{
 			Ok:      false,
 			Data:    []string{errorMessage},
@@ -193,7 +202,8 @@ func (s *DataImportService) ValidateTable3File(filePath string, isCover bool) db
 	mainData, err := s.parseTable3Excel(f, false)
 	if err != nil {
 		errorMessage := err.Error()
-		s.app.InsertImportRecord(fileName, TableType3, "导入失败", errorMessage)
+		s.app.InsertImportRecordWithHash(fileName, TableType3, "导入失败", errorMessage, fileHash)
+		s.saveImportValidationReport(TableType3, fileName, newImportValidationReportEntries(fileName, []string{errorMessage}))
 		return db.QueryResult{
 			Ok:      false,
 			Data:    []string{errorMessage},
@@ -201,11 +211,21 @@ func (s *DataImportService) ValidateTable3File(filePath string, isCover bool) db
 		}
 	}
 
+	// 个性化模板完整性校验
+	if templateErrors := s.checkImportTemplateIntegrity(f, filePath, TableType3, fileHash); len(templateErrors) > 0 {
+		return db.QueryResult{
+			Ok:      false,
+			Data:    templateErrors,
+			Message: fmt.Sprintf("模板校验失败: %s", strings.Join(templateErrors, "; ")),
+		}
+	}
+
 	// 按行读取文件数据并校验
 	validationErrors := s.validateTable3Data(mainData)
 	if len(validationErrors) > 0 {
 		errorMessage := fmt.Sprintf("数据校验失败: %s", strings.Join(validationErrors, "; "))
-		s.app.InsertImportRecord(fileName, TableType3, "导入失败", errorMessage)
+		s.app.InsertImportRecordWithHash(fileName, TableType3, "导入失败", errorMessage, fileHash)
+		s.saveImportValidationReport(TableType3, fileName, newImportValidationReportEntries(fileName, validationErrors))
 		return db.QueryResult{
 			Ok:      false,
 			Data:    validationErrors,
@@ -232,7 +252,7 @@ func (s *DataImportService) ValidateTable3File(filePath string, isCover bool) db
 		copyResult := s.app.CopyFileToCache(TableType3, filePath)
 		if !copyResult.Ok {
 			errorMessage := fmt.Sprintf("文件复制到缓存失败: %s", copyResult.Message)
-			s.app.InsertImportRecord(fileName, TableType3, "导入失败", errorMessage)
+			s.app.InsertImportRecordWithHash(fileName, TableType3, "导入失败", errorMessage, fileHash)
 			return db.QueryResult{
 				Ok:      false,
 				Data:    []string{errorMessage},
@@ -241,7 +261,8 @@ func (s *DataImportService) ValidateTable3File(filePath string, isCover bool) db
 		} else {
 			s.UnprotecFile(copyResult.Data.(string))
 		}
-		s.app.InsertImportRecord(fileName, TableType3, "导入成功", "校验通过")
+		s.app.InsertImportRecordWithHash(fileName, TableType3, "导入成功", "校验通过", fileHash)
+		s.saveImportValidationReport(TableType3, fileName, nil)
 	}
 
 	return db.QueryResult{
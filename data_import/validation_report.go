@@ -0,0 +1,541 @@
+package data_import
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// 校验报告相关常量
+const (
+	ValidationSummarySheetName = "校验结果汇总"      // 校验报告中的汇总工作表名称
+	ValidationIndexFileName    = "校验报告索引.xlsx" // ZIP包中的总索引文件名称
+	validationCommentAuthor    = "数据校验"
+
+	ValidationReportJSONFileName       = "校验结果.json"   // ZIP包中的结构化校验结果（JSON）
+	ValidationReportCSVFileName        = "校验结果.csv"    // ZIP包中的结构化校验结果（CSV）
+	ImportValidationReportJSONFileName = "导入校验结果.json" // 缓存目录中的导入校验结果（JSON）
+	ImportValidationReportCSVFileName  = "导入校验结果.csv"  // 缓存目录中的导入校验结果（CSV）
+	validationReportValueSeparator     = "|"           // CSV中多个单元格、字段、值之间的分隔符
+)
+
+// getDataSheetList 获取数据工作表列表，排除校验报告添加的汇总工作表，
+// 保证带校验报告的文件修改后重新导入时仍能读取到原始数据表
+func getDataSheetList(f *excelize.File) []string {
+	var sheets []string
+	for _, sheetName := range f.GetSheetList() {
+		if sheetName != ValidationSummarySheetName {
+			sheets = append(sheets, sheetName)
+		}
+	}
+	return sheets
+}
+
+// sortValidationErrors 按行号、级别排序校验结果，返回新的切片
+func sortValidationErrors(errors []ValidationError) []ValidationError {
+	sorted := append([]ValidationError{}, errors...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].RowNumber != sorted[j].RowNumber {
+			return sorted[i].RowNumber < sorted[j].RowNumber
+		}
+		return getSeverityRank(sorted[i].Severity) > getSeverityRank(sorted[j].Severity)
+	})
+	return sorted
+}
+
+// addValidationReport 在校验文件中添加单元格批注和"校验结果汇总"工作表
+func (s *DataImportService) addValidationReport(f *excelize.File, sheetName string, errors []ValidationError) error {
+	if err := s.addValidationComments(f, sheetName, errors); err != nil {
+		return err
+	}
+	return s.addValidationSummarySheet(f, sheetName, errors)
+}
+
+// addValidationComments 在涉及到的单元格上添加批注，同一单元格的多条信息合并显示
+func (s *DataImportService) addValidationComments(f *excelize.File, sheetName string, errors []ValidationError) error {
+	commentMap := make(map[string][]string)
+	var cellOrder []string
+	for _, err := range sortValidationErrors(errors) {
+		text := fmt.Sprintf("[%s]%s", err.RuleID, formatValidationMessage(err))
+		if err.RuleID == "" {
+			text = formatValidationMessage(err)
+		}
+		for _, cell := range err.Cells {
+			if cell == "" {
+				continue
+			}
+			if _, exists := commentMap[cell]; !exists {
+				cellOrder = append(cellOrder, cell)
+			}
+			commentMap[cell] = append(commentMap[cell], text)
+		}
+	}
+	if len(cellOrder) == 0 {
+		return nil
+	}
+
+	// 已有批注的单元格保留原批注内容
+	existingComments := make(map[string]string)
+	if comments, err := f.GetComments(sheetName); err == nil {
+		for _, comment := range comments {
+			existingComments[comment.Cell] = comment.Text
+		}
+	}
+
+	for _, cell := range cellOrder {
+		text := strings.Join(commentMap[cell], "\n")
+		if existing, exists := existingComments[cell]; exists {
+			f.DeleteComment(sheetName, cell)
+			text = existing + "\n" + text
+		}
+		err := f.AddComment(sheetName, excelize.Comment{
+			Author: validationCommentAuthor,
+			Cell:   cell,
+			Text:   text,
+			Width:  240,
+			Height: 100,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addValidationSummarySheet 在文件最前面添加"校验结果汇总"工作表，每条校验信息可跳转到对应单元格
+func (s *DataImportService) addValidationSummarySheet(f *excelize.File, sheetName string, errors []ValidationError) error {
+	// 重复校验时先删除旧的汇总表
+	if index, _ := f.GetSheetIndex(ValidationSummarySheetName); index >= 0 {
+		if err := f.DeleteSheet(ValidationSummarySheetName); err != nil {
+			return err
+		}
+	}
+
+	if _, err := f.NewSheet(ValidationSummarySheetName); err != nil {
+		return err
+	}
+	sheets := f.GetSheetList()
+	if len(sheets) > 0 && sheets[0] != ValidationSummarySheetName {
+		if err := f.MoveSheet(ValidationSummarySheetName, sheets[0]); err != nil {
+			return err
+		}
+	}
+
+	headers := []string{"序号", "规则编号", "级别", "行号", "单元格", "校验信息"}
+	for i, header := range headers {
+		cellName, _ := excelize.CoordinatesToCellName(i+1, 1)
+		f.SetCellValue(ValidationSummarySheetName, cellName, header)
+	}
+	headerStyle, err := f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true},
+		Fill:      excelize.Fill{Type: "pattern", Color: []string{"D9D9D9"}, Pattern: 1},
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+	})
+	if err == nil {
+		f.SetCellStyle(ValidationSummarySheetName, "A1", "F1", headerStyle)
+	}
+	linkStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Color: "0563C1", Underline: "single"},
+	})
+
+	severityStyles := make(map[string]int)
+	for _, severity := range []string{SeverityError, SeverityWarning, SeverityInfo} {
+		style, err := f.NewStyle(&excelize.Style{
+			Fill:      excelize.Fill{Type: "pattern", Color: []string{getSeverityColor(severity)}, Pattern: 1},
+			Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+		})
+		if err == nil {
+			severityStyles[severity] = style
+		}
+	}
+
+	for i, validationErr := range sortValidationErrors(errors) {
+		row := i + 2
+		severity := validationErr.Severity
+		if severity == "" {
+			severity = SeverityError
+		}
+
+		f.SetCellValue(ValidationSummarySheetName, fmt.Sprintf("A%d", row), i+1)
+		f.SetCellValue(ValidationSummarySheetName, fmt.Sprintf("B%d", row), validationErr.RuleID)
+		f.SetCellValue(ValidationSummarySheetName, fmt.Sprintf("C%d", row), getSeverityLabel(severity))
+		if style, exists := severityStyles[severity]; exists {
+			f.SetCellStyle(ValidationSummarySheetName, fmt.Sprintf("C%d", row), fmt.Sprintf("C%d", row), style)
+		}
+		if validationErr.RowNumber > 0 {
+			f.SetCellValue(ValidationSummarySheetName, fmt.Sprintf("D%d", row), validationErr.RowNumber)
+		}
+		f.SetCellValue(ValidationSummarySheetName, fmt.Sprintf("F%d", row), validationErr.Message)
+
+		// 单元格列添加跳转到数据表对应位置的超链接
+		var cells []string
+		for _, cell := range validationErr.Cells {
+			if cell != "" {
+				cells = append(cells, cell)
+			}
+		}
+		target := ""
+		if len(cells) > 0 {
+			target = cells[0]
+		} else if validationErr.RowNumber > 0 {
+			target = fmt.Sprintf("A%d", validationErr.RowNumber)
+		}
+		if target != "" {
+			linkCell := fmt.Sprintf("E%d", row)
+			display := strings.Join(cells, ",")
+			if display == "" {
+				display = target
+			}
+			f.SetCellValue(ValidationSummarySheetName, linkCell, display)
+			f.SetCellHyperLink(ValidationSummarySheetName, linkCell, fmt.Sprintf("'%s'!%s", sheetName, target), "Location")
+			f.SetCellStyle(ValidationSummarySheetName, linkCell, linkCell, linkStyle)
+		}
+	}
+
+	f.SetColWidth(ValidationSummarySheetName, "A", "A", 8)
+	f.SetColWidth(ValidationSummarySheetName, "B", "D", 12)
+	f.SetColWidth(ValidationSummarySheetName, "E", "E", 20)
+	f.SetColWidth(ValidationSummarySheetName, "F", "F", 80)
+
+	// 打开文件时默认显示汇总表
+	if index, err := f.GetSheetIndex(ValidationSummarySheetName); err == nil && index >= 0 {
+		f.SetActiveSheet(index)
+	}
+	return nil
+}
+
+// validationFileSummary 校验报告中单个文件的统计信息
+type validationFileSummary struct {
+	FileName     string
+	ErrorCount   int
+	WarningCount int
+	InfoCount    int
+}
+
+// readValidationFileSummary 从校验文件的汇总工作表中统计各级别数量
+func readValidationFileSummary(filePath string, fileName string) validationFileSummary {
+	summary := validationFileSummary{FileName: fileName}
+
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		return summary
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows(ValidationSummarySheetName)
+	if err != nil {
+		return summary
+	}
+	for i, row := range rows {
+		if i == 0 || len(row) < 3 {
+			continue
+		}
+		switch row[2] {
+		case getSeverityLabel(SeverityWarning):
+			summary.WarningCount++
+		case getSeverityLabel(SeverityInfo):
+			summary.InfoCount++
+		default:
+			summary.ErrorCount++
+		}
+	}
+	return summary
+}
+
+// createValidationIndexWorkbook 创建校验报告总索引工作簿，列出每个文件的错误、警告、提示数量
+func (s *DataImportService) createValidationIndexWorkbook(summaries []validationFileSummary) (*excelize.File, error) {
+	f := excelize.NewFile()
+	sheetName := "校验报告索引"
+	if err := f.SetSheetName("Sheet1", sheetName); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	headers := []string{"序号", "文件名", "错误数", "警告数", "提示数", "校验结果"}
+	for i, header := range headers {
+		cellName, _ := excelize.CoordinatesToCellName(i+1, 1)
+		f.SetCellValue(sheetName, cellName, header)
+	}
+	headerStyle, err := f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true},
+		Fill:      excelize.Fill{Type: "pattern", Color: []string{"D9D9D9"}, Pattern: 1},
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center"},
+	})
+	if err == nil {
+		f.SetCellStyle(sheetName, "A1", "F1", headerStyle)
+	}
+
+	totalErrors, totalWarnings, totalInfos := 0, 0, 0
+	for i, summary := range summaries {
+		row := i + 2
+		result := "未通过"
+		if summary.ErrorCount == 0 && summary.WarningCount+summary.InfoCount > 0 {
+			result = "已导入（存在警告）"
+		} else if summary.ErrorCount+summary.WarningCount+summary.InfoCount == 0 {
+			result = "处理失败"
+		}
+
+		f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), i+1)
+		f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), summary.FileName)
+		f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), summary.ErrorCount)
+		f.SetCellValue(sheetName, fmt.Sprintf("D%d", row), summary.WarningCount)
+		f.SetCellValue(sheetName, fmt.Sprintf("E%d", row), summary.InfoCount)
+		f.SetCellValue(sheetName, fmt.Sprintf("F%d", row), result)
+
+		totalErrors += summary.ErrorCount
+		totalWarnings += summary.WarningCount
+		totalInfos += summary.InfoCount
+	}
+
+	totalRow := len(summaries) + 2
+	f.SetCellValue(sheetName, fmt.Sprintf("B%d", totalRow), "合计")
+	f.SetCellValue(sheetName, fmt.Sprintf("C%d", totalRow), totalErrors)
+	f.SetCellValue(sheetName, fmt.Sprintf("D%d", totalRow), totalWarnings)
+	f.SetCellValue(sheetName, fmt.Sprintf("E%d", totalRow), totalInfos)
+
+	f.SetColWidth(sheetName, "A", "A", 8)
+	f.SetColWidth(sheetName, "B", "B", 60)
+	f.SetColWidth(sheetName, "C", "E", 10)
+	f.SetColWidth(sheetName, "F", "F", 20)
+
+	return f, nil
+}
+
+// ValidationReportEntry 结构化校验结果中的一条记录，Fields、Values与Cells按位置一一对应，
+// 无法对应到字段的单元格字段名为空
+type ValidationReportEntry struct {
+	File     string   `json:"file"`     // 文件名
+	Sheet    string   `json:"sheet"`    // 工作表名称
+	Row      int      `json:"row"`      // Excel行号，文件级错误为0
+	Cells    []string `json:"cells"`    // 涉及到的单元格位置
+	Fields   []string `json:"fields"`   // 单元格对应的字段名
+	RuleID   string   `json:"rule_id"`  // 校验规则编号
+	Severity string   `json:"severity"` // 级别：error/warning/info
+	Message  string   `json:"message"`  // 校验信息
+	Values   []string `json:"values"`   // 单元格中填写的值
+}
+
+// ValidationReport 结构化校验结果，供省级等外部工具统计数据质量、比对多轮校验结果
+type ValidationReport struct {
+	TableType  string                  `json:"table_type"`
+	TableName  string                  `json:"table_name"`
+	CreateTime string                  `json:"create_time"`
+	Entries    []ValidationReportEntry `json:"entries"`
+}
+
+// validationRecordSet 解析得到的数据记录及其保存Excel行号的字段，用于定位单元格对应的字段
+type validationRecordSet struct {
+	Records []map[string]interface{}
+	RowKey  string
+}
+
+// buildValidationReportEntries 将文件的校验结果转换为结构化记录，单元格的值从文件中读取
+func (s *DataImportService) buildValidationReportEntries(filePath, tableType string, errors []ValidationError, recordSets ...validationRecordSet) []ValidationReportEntry {
+	fileName := filepath.Base(filePath)
+
+	// 按行号和列名建立字段索引，同一列在不同数据区域可能对应不同字段
+	fieldMapping := s.getFieldMapping(tableType)
+	rowFields := make(map[int]map[string]string)
+	for _, recordSet := range recordSets {
+		for _, record := range recordSet.Records {
+			rowNum, ok := record[recordSet.RowKey].(int)
+			if !ok {
+				continue
+			}
+			for fieldName, mapping := range fieldMapping {
+				if _, exists := record[fieldName]; !exists {
+					continue
+				}
+				if rowFields[rowNum] == nil {
+					rowFields[rowNum] = make(map[string]string)
+				}
+				rowFields[rowNum][mapping.Column] = fieldName
+			}
+		}
+	}
+
+	var f *excelize.File
+	sheetName := ""
+	if file, err := excelize.OpenFile(filePath); err == nil {
+		defer file.Close()
+		if sheets := getDataSheetList(file); len(sheets) > 0 {
+			f = file
+			sheetName = sheets[0]
+		}
+	}
+
+	entries := []ValidationReportEntry{}
+	for _, validationErr := range sortValidationErrors(errors) {
+		entry := ValidationReportEntry{
+			File:     fileName,
+			Sheet:    sheetName,
+			Row:      validationErr.RowNumber,
+			Cells:    []string{},
+			Fields:   []string{},
+			RuleID:   validationErr.RuleID,
+			Severity: validationErr.Severity,
+			Message:  validationErr.Message,
+			Values:   []string{},
+		}
+		if entry.Severity == "" {
+			entry.Severity = SeverityError
+		}
+
+		for _, cell := range validationErr.Cells {
+			if cell == "" {
+				continue
+			}
+			fieldName, value := "", ""
+			if col, row, err := excelize.SplitCellName(cell); err == nil {
+				fieldName = rowFields[row][col]
+			}
+			if f != nil {
+				value, _ = f.GetCellValue(sheetName, cell)
+			}
+			entry.Cells = append(entry.Cells, cell)
+			entry.Fields = append(entry.Fields, fieldName)
+			entry.Values = append(entry.Values, value)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// newFileValidationReportEntry 创建文件级（读取、解析失败等）的结构化校验记录
+func newFileValidationReportEntry(fileName, message string) ValidationReportEntry {
+	return ValidationReportEntry{
+		File:     fileName,
+		Cells:    []string{},
+		Fields:   []string{},
+		Severity: SeverityError,
+		Message:  message,
+		Values:   []string{},
+	}
+}
+
+// importMessageRowPattern 导入校验信息中的行号，如"第7行：单位名称不能为空"
+var importMessageRowPattern = regexp.MustCompile(`^第(\d+)行`)
+
+// newImportValidationReportEntries 将导入校验返回的文本信息转换为结构化记录
+func newImportValidationReportEntries(fileName string, messages []string) []ValidationReportEntry {
+	entries := []ValidationReportEntry{}
+	for _, message := range messages {
+		entry := newFileValidationReportEntry(fileName, message)
+		if match := importMessageRowPattern.FindStringSubmatch(message); match != nil {
+			entry.Row, _ = strconv.Atoi(match[1])
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// newValidationReport 创建结构化校验结果
+func (s *DataImportService) newValidationReport(tableType string, entries []ValidationReportEntry) ValidationReport {
+	if entries == nil {
+		entries = []ValidationReportEntry{}
+	}
+	return ValidationReport{
+		TableType:  tableType,
+		TableName:  s.getTableName(tableType),
+		CreateTime: time.Now().Format("2006-01-02 15:04:05"),
+		Entries:    entries,
+	}
+}
+
+// writeValidationReportJSON 以JSON格式写出结构化校验结果
+func writeValidationReportJSON(w io.Writer, report ValidationReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// writeValidationReportCSV 以CSV格式写出结构化校验结果，添加UTF-8 BOM保证Excel打开不乱码
+func writeValidationReportCSV(w io.Writer, entries []ValidationReportEntry) error {
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	headers := []string{"file", "sheet", "row", "cells", "fields", "rule_id", "severity", "message", "values"}
+	if err := writer.Write(headers); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		record := []string{
+			entry.File,
+			entry.Sheet,
+			strconv.Itoa(entry.Row),
+			strings.Join(entry.Cells, validationReportValueSeparator),
+			strings.Join(entry.Fields, validationReportValueSeparator),
+			entry.RuleID,
+			entry.Severity,
+			entry.Message,
+			strings.Join(entry.Values, validationReportValueSeparator),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeValidationReportFiles 将结构化校验结果写入指定目录下的JSON和CSV文件
+func writeValidationReportFiles(dir, jsonFileName, csvFileName string, report ValidationReport) error {
+	jsonFile, err := os.Create(filepath.Join(dir, jsonFileName))
+	if err != nil {
+		return err
+	}
+	defer jsonFile.Close()
+	if err := writeValidationReportJSON(jsonFile, report); err != nil {
+		return err
+	}
+
+	csvFile, err := os.Create(filepath.Join(dir, csvFileName))
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+	return writeValidationReportCSV(csvFile, report.Entries)
+}
+
+// saveImportValidationReport 更新缓存目录中的导入校验结果，同名文件的旧记录会被本次结果替换，
+// 校验通过时传入空记录即可清除该文件的记录
+func (s *DataImportService) saveImportValidationReport(tableType, fileName string, entries []ValidationReportEntry) {
+	cacheDir := s.app.GetCachePath(tableType)
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		fmt.Printf("保存导入校验结果失败: %v\n", err)
+		return
+	}
+
+	var existing ValidationReport
+	if content, err := os.ReadFile(filepath.Join(cacheDir, ImportValidationReportJSONFileName)); err == nil {
+		if err := json.Unmarshal(content, &existing); err != nil {
+			fmt.Printf("读取导入校验结果失败: %v\n", err)
+		}
+	}
+
+	merged := []ValidationReportEntry{}
+	for _, entry := range existing.Entries {
+		if entry.File != fileName {
+			merged = append(merged, entry)
+		}
+	}
+	merged = append(merged, entries...)
+
+	report := s.newValidationReport(tableType, merged)
+	if err := writeValidationReportFiles(cacheDir, ImportValidationReportJSONFileName, ImportValidationReportCSVFileName, report); err != nil {
+		fmt.Printf("保存导入校验结果失败: %v\n", err)
+	}
+}
@@ -0,0 +1,137 @@
+package data_import
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"shuji/db"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WarningAcknowledgementFileName 警告确认记录文件，保存在缓存目录中
+const WarningAcknowledgementFileName = "警告确认.json"
+
+// WarningAcknowledgement 仅有警告/提示的文件的确认记录，确认人为空时表示等待用户确认
+type WarningAcknowledgement struct {
+	FileName string   `json:"file_name"` // 文件名
+	Warnings []string `json:"warnings"`  // 需要确认的警告信息
+	User     string   `json:"user"`      // 确认人
+	Time     int64    `json:"time"`      // 确认时间
+}
+
+// loadWarningAcknowledgements 读取警告确认记录，返回文件名到确认记录的映射
+func (s *DataImportService) loadWarningAcknowledgements(tableType string) map[string]WarningAcknowledgement {
+	acknowledgements := make(map[string]WarningAcknowledgement)
+	data, err := os.ReadFile(filepath.Join(s.app.GetCachePath(tableType), WarningAcknowledgementFileName))
+	if err != nil {
+		return acknowledgements
+	}
+	if err := json.Unmarshal(data, &acknowledgements); err != nil {
+		log.Printf("读取警告确认记录失败: %v", err)
+	}
+	return acknowledgements
+}
+
+// saveWarningAcknowledgements 保存警告确认记录，没有待确认的文件时删除记录文件
+func (s *DataImportService) saveWarningAcknowledgements(tableType string, acknowledgements map[string]WarningAcknowledgement) error {
+	filePath := filepath.Join(s.app.GetCachePath(tableType), WarningAcknowledgementFileName)
+	if len(acknowledgements) == 0 {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(acknowledgements, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
+
+// getWarningMessages 获取警告/提示信息，用于判断确认的警告与本次校验结果是否一致
+func getWarningMessages(errors []ValidationError) []string {
+	messages := make([]string, 0, len(errors))
+	for _, err := range errors {
+		messages = append(messages, formatValidationMessage(err))
+	}
+	return messages
+}
+
+// checkWarningAcknowledged 检查文件的警告是否已由用户确认，确认后文件内容变化导致警告不同时需要重新确认
+func checkWarningAcknowledged(acknowledgements map[string]WarningAcknowledgement, fileName string, errors []ValidationError) (WarningAcknowledgement, bool) {
+	acknowledgement, exists := acknowledgements[fileName]
+	if !exists || acknowledgement.User == "" {
+		return acknowledgement, false
+	}
+	return acknowledgement, slices.Equal(acknowledgement.Warnings, getWarningMessages(errors))
+}
+
+// recordWarningAcknowledgement 仅有警告/提示的文件导入后，在导入记录中登记确认人和已确认的警告信息
+func (s *DataImportService) recordWarningAcknowledgement(fileName, tableType string, acknowledgement WarningAcknowledgement) {
+	describe := fmt.Sprintf("模型校验存在%d条警告，已由%s于%s确认导入：%s", len(acknowledgement.Warnings), acknowledgement.User,
+		time.UnixMilli(acknowledgement.Time).Format("2006-01-02 15:04:05"), strings.Join(acknowledgement.Warnings, "; "))
+	s.app.InsertImportRecord(fileName, tableType, ImportStateSuccess, describe)
+}
+
+// getPendingWarningFiles 获取等待确认的文件，按文件名排序
+func getPendingWarningFiles(pending map[string]WarningAcknowledgement) []WarningAcknowledgement {
+	files := make([]WarningAcknowledgement, 0, len(pending))
+	for _, acknowledgement := range pending {
+		files = append(files, acknowledgement)
+	}
+	slices.SortFunc(files, func(a, b WarningAcknowledgement) int {
+		return strings.Compare(a.FileName, b.FileName)
+	})
+	return files
+}
+
+// AcknowledgeValidationWarnings 确认文件的模型校验警告，记录确认人，重新校验时导入已确认的文件
+func (s *DataImportService) AcknowledgeValidationWarnings(tableType string, fileNames []string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return s.acknowledgeValidationWarningsWithRecover(tableType, fileNames)
+}
+
+// acknowledgeValidationWarningsWithRecover 带异常处理的确认模型校验警告函数
+func (s *DataImportService) acknowledgeValidationWarningsWithRecover(tableType string, fileNames []string) (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("AcknowledgeValidationWarnings 发生异常: %v", r)
+			result = db.QueryResult{
+				Ok:      false,
+				Message: fmt.Sprintf("函数执行异常: %v", r),
+			}
+		}
+	}()
+
+	if len(fileNames) == 0 {
+		return db.QueryResult{Ok: false, Message: "请选择需要确认的文件"}
+	}
+
+	acknowledgements := s.loadWarningAcknowledgements(tableType)
+	user := s.app.GetCurrentOSUser()
+	acknowledgeTime := time.Now().UnixMilli()
+	for _, fileName := range fileNames {
+		acknowledgement, exists := acknowledgements[fileName]
+		if !exists {
+			return db.QueryResult{Ok: false, Message: fmt.Sprintf("文件 %s 没有待确认的警告，请重新校验", fileName)}
+		}
+		acknowledgement.User = user
+		acknowledgement.Time = acknowledgeTime
+		acknowledgements[fileName] = acknowledgement
+	}
+
+	if err := s.saveWarningAcknowledgements(tableType, acknowledgements); err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("保存确认记录失败: %v", err)}
+	}
+
+	log.Printf("%s 确认了%d个文件的模型校验警告: %s", user, len(fileNames), strings.Join(fileNames, "、"))
+	return db.QueryResult{
+		Ok:      true,
+		Message: fmt.Sprintf("已确认%d个文件的警告，重新校验后导入", len(fileNames)),
+	}
+}
@@ -9,21 +9,9 @@ import (
 	"github.com/google/uuid"
 )
 
-// DataImportRecord 导入记录
-type DataImportRecord struct {
-	ObjID       string `json:"obj_id" db:"obj_id"`             // 主键
-	FileName    string `json:"file_name" db:"file_name"`       // 导入文件名
-	FileType    string `json:"file_type" db:"file_type"`       // 文件类型
-	ImportTime  int64  `json:"import_time" db:"import_time"`   // 导入时间
-	ImportState string `json:"import_state" db:"import_state"` // 导入状态，导入成功，导入失败
-	Describe    string `json:"describe" db:"describe"`         // 说明
-	CreateUser  string `json:"create_user" db:"create_user"`   // 导入用户
-}
-
-// DataImportRecordService 导入记录服务
+// DataImportRecordService 导入记录服务，写入时再获取数据库，恢复快照或抢救数据替换数据库后写入新的数据库
 type DataImportRecordService struct {
-	db       *db.Database
-	logQueue chan *DataImportRecord
+	logQueue chan *db.DataImportRecord
 	app      *App
 }
 
@@ -33,11 +21,10 @@ var (
 )
 
 // NewDataImportRecordService 创建导入记录服务实例（单例模式）
-func NewDataImportRecordService(db *db.Database, app *App) *DataImportRecordService {
+func NewDataImportRecordService(app *App) *DataImportRecordService {
 	once.Do(func() {
 		instance = &DataImportRecordService{
-			db:       db,
-			logQueue: make(chan *DataImportRecord, 10000), // 队列大小10000
+			logQueue: make(chan *db.DataImportRecord, 10000), // 队列大小10000
 			app:      app,
 		}
 
@@ -56,25 +43,8 @@ func (s *DataImportRecordService) asyncLogWorker() {
 }
 
 // insertRecordToDB 实际插入记录到数据库
-func (s *DataImportRecordService) insertRecordToDB(record *DataImportRecord) {
-	query := `
-		INSERT INTO data_import_record (
-			obj_id, file_name, file_type, import_time, 
-			import_state, describe, create_user
-		) VALUES (?, ?, ?, ?, ?, ?, ?)
-	`
-
-	_, err := s.db.Exec(
-		query,
-		record.ObjID,
-		record.FileName,
-		record.FileType,
-		record.ImportTime,
-		record.ImportState,
-		record.Describe,
-		record.CreateUser,
-	)
-
+func (s *DataImportRecordService) insertRecordToDB(record *db.DataImportRecord) {
+	err := db.NewRepository[db.DataImportRecord](s.app.GetDB(), nil).Insert(*record)
 	if err != nil {
 		log.Printf("异步插入导入记录失败: %v", err)
 	}
@@ -82,7 +52,12 @@ func (s *DataImportRecordService) insertRecordToDB(record *DataImportRecord) {
 
 // InsertImportRecord 异步插入导入记录
 func (s *DataImportRecordService) InsertImportRecord(fileName, fileType, importState, describe string) {
-	record := &DataImportRecord{
+	s.InsertImportRecordWithHash(fileName, fileType, importState, describe, "")
+}
+
+// InsertImportRecordWithHash 异步插入带源文件哈希的导入记录
+func (s *DataImportRecordService) InsertImportRecordWithHash(fileName, fileType, importState, describe, fileHash string) {
+	record := &db.DataImportRecord{
 		ObjID:       uuid.New().String(),
 		FileName:    fileName,
 		FileType:    fileType,
@@ -90,6 +65,7 @@ func (s *DataImportRecordService) InsertImportRecord(fileName, fileType, importS
 		ImportState: importState,
 		Describe:    describe,
 		CreateUser:  s.app.GetAreaStr(),
+		FileHash:    fileHash,
 	}
 
 	// 异步发送到日志队列
@@ -118,7 +94,7 @@ func (s *DataImportRecordService) getImportRecordsByFileTypeWithRecover(fileType
 	}()
 
 	query := "SELECT * FROM data_import_record WHERE file_type = ? ORDER BY import_time DESC"
-	result, err := s.db.Query(query, fileType)
+	result, err := s.app.GetDB().Query(query, fileType)
 	if err != nil {
 		return db.QueryResult{
 			Ok:      false,
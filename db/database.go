@@ -2,9 +2,10 @@ package db
 
 import (
 	"database/sql"
-	"encoding/hex"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -12,37 +13,20 @@ import (
 )
 
 // Database SQLite数据库管理器
+// 所有写操作经由唯一的写连接串行执行，查询使用独立的只读连接池。
+// 数据库异常时系统数据库为nil，在nil上调用的方法返回"数据库未初始化"错误，不会崩溃。
+// SQLite同一时刻只允许一个写事务，多个写连接只会互相等待并返回database is locked，
+// 由单一写连接排队后写入顺序确定，读连接在WAL模式下读取已提交的数据，不受写事务阻塞
 type Database struct {
-	db *sql.DB
+	writer   *sql.DB      // 写连接，最多一个连接，同一文件可写打开的数据库共用
+	reader   *sql.DB      // 只读连接池
+	file     *workingFile // 解密后的工作文件
+	password string
+	readOnly bool // 只读打开，写连接同样禁止写入且不与其他数据库共用
 }
 
-// retryOnBusy 在数据库锁定错误时重试操作
-func (d *Database) retryOnBusy(operation func() error) error {
-	maxRetries := 20
-	retryDelay := time.Millisecond * 100
-
-	for i := 0; i < maxRetries; i++ {
-		err := operation()
-		if err == nil {
-			return nil
-		}
-
-		// 检查是否是锁定错误
-		if strings.Contains(err.Error(), "database is locked") || strings.Contains(err.Error(), "SQLITE_BUSY") {
-			if i < maxRetries-1 {
-				log.Printf("数据库锁定，重试第%d次: %v", i+1, err)
-				time.Sleep(retryDelay)
-				retryDelay *= 2 // 指数退避
-				continue
-			}
-		}
-
-		// 如果不是锁定错误，或者已经重试完所有次数，直接返回错误
-		return err
-	}
-
-	return fmt.Errorf("重试次数已用完")
-}
+// 只读连接池的最大连接数
+const maxReaderConns = 8
 
 // QueryResult 查询结果
 type QueryResult struct {
@@ -51,105 +35,109 @@ type QueryResult struct {
 	Message string      `json:"message"`
 }
 
-// NewDatabase 创建新的数据库连接
+// NewDatabase 创建新的数据库连接，数据库文件加密保存，密钥错误时返回ErrWrongKey，不会以未加密方式打开
 func NewDatabase(dbPath string, password string) (*Database, error) {
-	// 对于加密的数据库，使用 modernc.org/sqlite 的连接方式
-
-	password = hex.EncodeToString([]byte(password))
-
-	// 尝试不同的连接配置
-	type driverConfig struct {
-		driver string
-		format string
-	}
-
-	configs := []driverConfig{
-		// 使用 modernc.org/sqlite 驱动（注册为 sqlite）
-		{"sqlite", dbPath + "?_pragma=key('" + password + "')&_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000&_temp_store=MEMORY"},
-		{"sqlite", dbPath + "?_pragma=key=\"" + password + "\"&_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000&_temp_store=MEMORY"},
-		{"sqlite", dbPath + "?_pragma=key=" + password + "&_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000&_temp_store=MEMORY"},
-		{"sqlite", dbPath + "?_pragma=hexkey=" + password + "&_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000&_temp_store=MEMORY"},
-		// 尝试不同的加密算法
-		{"sqlite", dbPath + "?_pragma=key('" + password + "')&_pragma=cipher=aes256cbc&_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000&_temp_store=MEMORY"},
-		{"sqlite", dbPath + "?_pragma=key('" + password + "')&_pragma=cipher=chacha20&_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000&_temp_store=MEMORY"},
-		{"sqlite", dbPath + "?_pragma=key('" + password + "')&_pragma=cipher=aes256ctr&_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000&_temp_store=MEMORY"},
-		{"sqlite", dbPath + "?_pragma_key=" + password + "&_pragma_cipher_page_size=4096&_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000&_temp_store=MEMORY"},
-		{"sqlite", dbPath + "?_pragma_key=" + password + "&_pragma_cipher_page_size=4096&_pragma_cipher=aes256ctr&_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000&_temp_store=MEMORY"},
-		{"sqlite", dbPath + "?_pragma_key=" + password + "&_pragma_cipher_page_size=4096&_pragma_cipher=aes256cbc&_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000&_temp_store=MEMORY"},
-		{"sqlite", dbPath + "?_pragma_key=" + password + "&_pragma_cipher_page_size=4096&_pragma_cipher=chacha20&_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000&_temp_store=MEMORY"},
-		{"sqlite", dbPath + "?mode=rw&_journal_mode=WAL&_busy_timeout=30000&key=" + password + "&_synchronous=NORMAL&_cache_size=10000&_temp_store=MEMORY"},
-	}
-
-	var lastErr error
-	for i, config := range configs {
-		fmt.Printf("尝试连接配置 %d: %s - %s\n", i+1, config.driver, config.format)
-		db, err := sql.Open(config.driver, config.format)
-		if err != nil {
-			fmt.Printf("配置 %d 打开失败: %v\n", i+1, err)
-			lastErr = err
-			continue
-		}
+	return openDatabase(dbPath, password, false)
+}
 
-		// 测试连接
-		if err := db.Ping(); err != nil {
-			fmt.Printf("配置 %d 连接测试失败: %v\n", i+1, err)
-			db.Close()
-			lastErr = err
-			continue
-		}
+// NewReadOnlyDatabase 以只读方式打开数据库，所有连接均禁止写入，关闭时不写回，用于数据库异常时查看数据
+func NewReadOnlyDatabase(dbPath string, password string) (*Database, error) {
+	return openDatabase(dbPath, password, true)
+}
+
+// openDatabase 校验并解密数据库文件到工作目录后打开连接
+func openDatabase(dbPath string, password string, readOnly bool) (*Database, error) {
+	file, err := acquireWorkingFile(dbPath, password, !readOnly)
+	if err != nil {
+		return nil, err
+	}
 
-		fmt.Printf("配置 %d 连接成功\n", i+1)
-		// 连接成功，设置连接池参数
-		db.SetMaxOpenConns(150)
-		db.SetMaxIdleConns(5)
-		db.SetConnMaxLifetime(time.Hour)
+	// 先打开写连接，由写连接设置WAL模式。同一文件多次可写打开时共用写连接，避免多个写连接互相等待；
+	// 只读数据库的写连接同样禁止写入，单独打开
+	database := &Database{file: file, password: password, readOnly: readOnly}
+	if readOnly {
+		database.writer, err = openConnection(file.workPath, true, 1)
+	} else {
+		database.writer, err = acquireWriter(file)
+	}
+	if err != nil {
+		releaseWorkingFile(file)
+		return nil, err
+	}
+	database.reader, err = openConnection(file.workPath, true, maxReaderConns)
+	if err != nil {
+		database.closeWriter()
+		releaseWorkingFile(file)
+		return nil, err
+	}
+	return database, nil
+}
 
-		return &Database{db: db}, nil
+// closeWriter 关闭只读数据库的写连接，可写数据库释放共用的写连接
+func (d *Database) closeWriter() error {
+	if !d.readOnly {
+		return releaseWriter(d.file)
 	}
+	d.writer.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	return d.writer.Close()
+}
 
-	// 如果所有格式都失败，尝试不加密的方式
-	db, err := sql.Open("sqlite", dbPath+"?_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000&_temp_store=MEMORY")
+// openConnection 打开连接池并测试连接，queryOnly为true时连接禁止写入。
+// 写事务使用BEGIN IMMEDIATE，开始时即取得写锁，避免事务中途由读升级为写时失败
+func openConnection(workPath string, queryOnly bool, maxConns int) (*sql.DB, error) {
+	dsn := workPath + "?_pragma=busy_timeout(30000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=cache_size(10000)&_pragma=temp_store(MEMORY)&_txlock=immediate"
+	if queryOnly {
+		dsn += "&_pragma=query_only(1)"
+	}
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("打开数据库失败: %v", err)
 	}
 
 	// 设置连接池参数
-	db.SetMaxOpenConns(150)
-	db.SetMaxIdleConns(5)
+	db.SetMaxOpenConns(maxConns)
+	db.SetMaxIdleConns(maxConns)
 	db.SetConnMaxLifetime(time.Hour)
 
 	// 测试连接
 	if err := db.Ping(); err != nil {
 		db.Close()
-		// 返回最后一个错误信息
-		return nil, fmt.Errorf("数据库连接测试失败: %v", lastErr)
+		return nil, fmt.Errorf("数据库连接测试失败: %v", err)
 	}
-
-	return &Database{db: db}, nil
+	return db, nil
 }
 
-// Close 关闭数据库连接
+// Close 关闭数据库连接，同一文件的最后一个连接关闭时加密写回数据库文件
 func (d *Database) Close() error {
-	if d.db != nil {
-		return d.db.Close()
+	// 已关闭的数据库file为空，不再重复释放共用的写连接
+	if d == nil || d.writer == nil || d.file == nil {
+		return nil
 	}
-	return nil
+	d.reader.Close()
+
+	err := d.closeWriter()
+	if releaseErr := releaseWorkingFile(d.file); err == nil {
+		err = releaseErr
+	}
+	d.file = nil
+	return err
+}
+
+// Flush 将当前数据加密写回数据库文件，用于长时间打开的数据库定期落盘
+func (d *Database) Flush() error {
+	if d == nil || d.writer == nil || d.file == nil || !d.file.writable || d.file.plain {
+		return nil
+	}
+	return d.file.flush(d.writer)
 }
 
-// Exec 执行SQL语句
+// Exec 在写连接上执行SQL语句，有事务进行中时排队等待事务结束
 func (d *Database) Exec(query string, args ...interface{}) (QueryResult, error) {
-	if d.db == nil {
+	if d == nil || d.writer == nil {
 		return QueryResult{Ok: false, Message: "数据库未初始化"}, fmt.Errorf("数据库未初始化")
 	}
 
-	var result sql.Result
-	var err error
-
-	err = d.retryOnBusy(func() error {
-		result, err = d.db.Exec(query, args...)
-		return err
-	})
-
+	result, err := d.writer.Exec(query, args...)
 	if err != nil {
 		log.Printf("SQL执行失败: %v", err)
 		return QueryResult{Ok: false, Message: err.Error()}, err
@@ -168,20 +156,13 @@ func (d *Database) Exec(query string, args ...interface{}) (QueryResult, error)
 	}, nil
 }
 
-// Query 执行查询语句
+// Query 在只读连接池上执行查询语句，只能读取已提交的数据
 func (d *Database) Query(query string, args ...interface{}) (QueryResult, error) {
-	if d.db == nil {
+	if d == nil || d.reader == nil {
 		return QueryResult{Ok: false, Message: "数据库未初始化"}, fmt.Errorf("数据库未初始化")
 	}
 
-	var rows *sql.Rows
-	var err error
-
-	err = d.retryOnBusy(func() error {
-		rows, err = d.db.Query(query, args...)
-		return err
-	})
-
+	rows, err := d.reader.Query(query, args...)
 	if err != nil {
 		return QueryResult{Ok: false, Message: err.Error()}, err
 	}
@@ -232,6 +213,57 @@ func (d *Database) Query(query string, args ...interface{}) (QueryResult, error)
 	}, nil
 }
 
+// QueryEach 逐行执行查询并回调处理，不将结果集全部加载到内存，回调返回错误时停止遍历
+func (d *Database) QueryEach(query string, fn func(row map[string]interface{}) error, args ...interface{}) error {
+	if d == nil || d.reader == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+
+	rows, err := d.reader.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return err
+		}
+
+		row := make(map[string]interface{})
+		for i, col := range columns {
+			val := values[i]
+			if val != nil {
+				switch v := val.(type) {
+				case []byte:
+					row[col] = string(v)
+				default:
+					row[col] = v
+				}
+			} else {
+				row[col] = nil
+			}
+		}
+
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 // Insert 插入数据
 func (d *Database) Insert(tableName string, data map[string]interface{}) (QueryResult, error) {
 	if len(data) == 0 {
@@ -311,34 +343,47 @@ func (d *Database) GetTables() (QueryResult, error) {
 	return d.Query(query)
 }
 
-// Begin 开始事务
+// Begin 在写连接上开始事务。事务提交或回滚前写连接被占用，
+// 事务中的写入必须通过tx执行，再通过Exec、Insert等方法写入会一直等待事务结束
 func (d *Database) Begin() (*sql.Tx, error) {
-	if d.db == nil {
+	if d == nil || d.writer == nil {
 		return nil, fmt.Errorf("数据库未初始化")
 	}
+	return d.writer.Begin()
+}
 
-	var tx *sql.Tx
-	var err error
+// WithTx 在写事务中执行fn，fn返回错误或发生异常时回滚，否则提交。
+// fn中的写入必须通过tx执行，通过d读取的是事务开始前已提交的数据
+func (d *Database) WithTx(fn func(tx *sql.Tx) error) (err error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
 
-	err = d.retryOnBusy(func() error {
-		tx, err = d.db.Begin()
+	if err := fn(tx); err != nil {
+		tx.Rollback()
 		return err
-	})
-
-	return tx, err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+	return nil
 }
 
 // QueryRow 查询单行数据
 func (d *Database) QueryRow(query string, args ...interface{}) (QueryResult, error) {
-	// 先执行查询获取列信息
-	var rows *sql.Rows
-	var err error
-
-	err = d.retryOnBusy(func() error {
-		rows, err = d.db.Query(query, args...)
-		return err
-	})
+	if d == nil || d.reader == nil {
+		return QueryResult{Ok: false, Message: "数据库未初始化"}, fmt.Errorf("数据库未初始化")
+	}
 
+	// 先执行查询获取列信息
+	rows, err := d.reader.Query(query, args...)
 	if err != nil {
 		return QueryResult{Ok: false, Message: err.Error()}, err
 	}
@@ -407,3 +452,91 @@ func (d *Database) SelectOne(tableName string, columns []string, where string, a
 
 	return d.QueryRow(query, args...)
 }
+
+// ColumnExists 检查表中是否存在指定字段
+func (d *Database) ColumnExists(tableName string, columnName string) (bool, error) {
+	result, err := d.Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
+	if err != nil {
+		return false, err
+	}
+
+	rows, _ := result.Data.([]map[string]interface{})
+	for _, row := range rows {
+		if name, ok := row["name"].(string); ok && strings.EqualFold(name, columnName) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AddColumnIfNotExists 字段不存在时为表添加字段
+func (d *Database) AddColumnIfNotExists(tableName string, columnName string, definition string) error {
+	exists, err := d.ColumnExists(tableName, columnName)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = d.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", tableName, columnName, definition))
+	return err
+}
+
+// BackupTo 使用VACUUM INTO将数据库完整复制并加密保存到dstPath，复制内容包含WAL中已提交的数据，dstPath不能已存在
+func (d *Database) BackupTo(dstPath string) error {
+	if d == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+	return d.ExportTo(dstPath, d.password)
+}
+
+// ExportTo 与BackupTo相同，复制的文件使用password加密，用于导出给其他单位的数据库
+func (d *Database) ExportTo(dstPath string, password string) error {
+	if d == nil || d.writer == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+	if _, err := os.Stat(dstPath); err == nil {
+		return fmt.Errorf("目标文件已存在: %s", dstPath)
+	}
+
+	workDir, err := getWorkDir()
+	if err != nil {
+		return err
+	}
+	tempPath := filepath.Join(workDir, fmt.Sprintf("backup_%d.db", time.Now().UnixNano()))
+	defer os.Remove(tempPath)
+	if err := createWorkFile(tempPath); err != nil {
+		return err
+	}
+
+	// query_only连接不允许VACUUM INTO，备份在写连接上执行，期间其他写操作排队等待
+	if _, err := d.writer.Exec("VACUUM INTO ?", tempPath); err != nil {
+		return err
+	}
+	_, err = EncryptFile(tempPath, dstPath, password)
+	return err
+}
+
+// IntegrityCheck 检查数据库完整性，quick为true时使用quick_check，返回发现的问题，数据库完好时返回空
+func (d *Database) IntegrityCheck(quick bool) ([]string, error) {
+	pragma := "PRAGMA integrity_check"
+	if quick {
+		pragma = "PRAGMA quick_check"
+	}
+	result, err := d.Query(pragma)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	rows, _ := result.Data.([]map[string]interface{})
+	for _, row := range rows {
+		for _, value := range row {
+			if message := fmt.Sprintf("%v", value); message != "ok" {
+				problems = append(problems, message)
+			}
+		}
+	}
+	return problems, nil
+}
@@ -1,7 +1,9 @@
 package db
 
 import (
+	"database/sql"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 )
@@ -32,8 +34,19 @@ type BatchData struct {
 	ID   interface{}            `json:"id"`   // 用于更新的ID
 }
 
-// BatchInsert 高性能批量插入
+// BatchInsert 高性能批量插入，在单独的写事务中执行
 func (d *Database) BatchInsert(tableName string, dataList []map[string]interface{}, batchSize int) (BatchInsertResult, error) {
+	var result BatchInsertResult
+	err := d.WithTx(func(tx *sql.Tx) error {
+		var err error
+		result, err = BatchInsertTx(tx, tableName, dataList, batchSize)
+		return err
+	})
+	return result, err
+}
+
+// BatchInsertTx 在调用方传入的事务中执行BatchInsert，由调用方提交或回滚，用于将多次批量写入放在同一事务中
+func BatchInsertTx(tx *sql.Tx, tableName string, dataList []map[string]interface{}, batchSize int) (BatchInsertResult, error) {
 	startTime := time.Now()
 	result := BatchInsertResult{
 		TotalRows: int64(len(dataList)),
@@ -44,13 +57,6 @@ func (d *Database) BatchInsert(tableName string, dataList []map[string]interface
 		return result, nil
 	}
 
-	// 开始事务
-	tx, err := d.Begin()
-	if err != nil {
-		return result, fmt.Errorf("开始事务失败: %v", err)
-	}
-	defer tx.Rollback()
-
 	// 获取列名
 	var columns []string
 	for col := range dataList[0] {
@@ -102,17 +108,23 @@ func (d *Database) BatchInsert(tableName string, dataList []map[string]interface
 		}
 	}
 
-	// 提交事务
-	if err := tx.Commit(); err != nil {
-		return result, fmt.Errorf("提交事务失败: %v", err)
-	}
-
 	result.Duration = time.Since(startTime).Milliseconds()
 	return result, nil
 }
 
-// BatchInsertWithMultiValue 使用多值插入语法的高性能批量插入
+// BatchInsertWithMultiValue 使用多值插入语法的高性能批量插入，在单独的写事务中执行
 func (d *Database) BatchInsertWithMultiValue(tableName string, dataList []map[string]interface{}, batchSize int) (BatchInsertResult, error) {
+	var result BatchInsertResult
+	err := d.WithTx(func(tx *sql.Tx) error {
+		var err error
+		result, err = BatchInsertWithMultiValueTx(tx, tableName, dataList, batchSize)
+		return err
+	})
+	return result, err
+}
+
+// BatchInsertWithMultiValueTx 在调用方传入的事务中执行BatchInsertWithMultiValue，由调用方提交或回滚
+func BatchInsertWithMultiValueTx(tx *sql.Tx, tableName string, dataList []map[string]interface{}, batchSize int) (BatchInsertResult, error) {
 	startTime := time.Now()
 	result := BatchInsertResult{
 		TotalRows: int64(len(dataList)),
@@ -123,13 +135,6 @@ func (d *Database) BatchInsertWithMultiValue(tableName string, dataList []map[st
 		return result, nil
 	}
 
-	// 开始事务
-	tx, err := d.Begin()
-	if err != nil {
-		return result, fmt.Errorf("开始事务失败: %v", err)
-	}
-	defer tx.Rollback()
-
 	// 获取列名
 	var columns []string
 	for col := range dataList[0] {
@@ -178,17 +183,23 @@ func (d *Database) BatchInsertWithMultiValue(tableName string, dataList []map[st
 		}
 	}
 
-	// 提交事务
-	if err := tx.Commit(); err != nil {
-		return result, fmt.Errorf("提交事务失败: %v", err)
-	}
-
 	result.Duration = time.Since(startTime).Milliseconds()
 	return result, nil
 }
 
-// BatchUpdate 高性能批量更新
+// BatchUpdate 高性能批量更新，在单独的写事务中执行
 func (d *Database) BatchUpdate(tableName string, dataList []BatchData, idColumn string, batchSize int) (BatchUpdateResult, error) {
+	var result BatchUpdateResult
+	err := d.WithTx(func(tx *sql.Tx) error {
+		var err error
+		result, err = BatchUpdateTx(tx, tableName, dataList, idColumn, batchSize)
+		return err
+	})
+	return result, err
+}
+
+// BatchUpdateTx 在调用方传入的事务中执行BatchUpdate，由调用方提交或回滚
+func BatchUpdateTx(tx *sql.Tx, tableName string, dataList []BatchData, idColumn string, batchSize int) (BatchUpdateResult, error) {
 	startTime := time.Now()
 	result := BatchUpdateResult{
 		TotalRows: int64(len(dataList)),
@@ -199,13 +210,6 @@ func (d *Database) BatchUpdate(tableName string, dataList []BatchData, idColumn
 		return result, nil
 	}
 
-	// 开始事务
-	tx, err := d.Begin()
-	if err != nil {
-		return result, fmt.Errorf("开始事务失败: %v", err)
-	}
-	defer tx.Rollback()
-
 	// 获取更新列名（排除ID列）
 	var updateColumns []string
 	for col := range dataList[0].Data {
@@ -260,17 +264,23 @@ func (d *Database) BatchUpdate(tableName string, dataList []BatchData, idColumn
 		}
 	}
 
-	// 提交事务
-	if err := tx.Commit(); err != nil {
-		return result, fmt.Errorf("提交事务失败: %v", err)
-	}
-
 	result.Duration = time.Since(startTime).Milliseconds()
 	return result, nil
 }
 
-// BatchDelete 高性能批量删除
+// BatchDelete 高性能批量删除，在单独的写事务中执行
 func (d *Database) BatchDelete(tableName string, ids []interface{}, idColumn string, batchSize int) (BatchUpdateResult, error) {
+	var result BatchUpdateResult
+	err := d.WithTx(func(tx *sql.Tx) error {
+		var err error
+		result, err = BatchDeleteTx(tx, tableName, ids, idColumn, batchSize)
+		return err
+	})
+	return result, err
+}
+
+// BatchDeleteTx 在调用方传入的事务中执行BatchDelete，由调用方提交或回滚
+func BatchDeleteTx(tx *sql.Tx, tableName string, ids []interface{}, idColumn string, batchSize int) (BatchUpdateResult, error) {
 	startTime := time.Now()
 	result := BatchUpdateResult{
 		TotalRows: int64(len(ids)),
@@ -281,13 +291,6 @@ func (d *Database) BatchDelete(tableName string, ids []interface{}, idColumn str
 		return result, nil
 	}
 
-	// 开始事务
-	tx, err := d.Begin()
-	if err != nil {
-		return result, fmt.Errorf("开始事务失败: %v", err)
-	}
-	defer tx.Rollback()
-
 	// 分批处理
 	for i := 0; i < len(ids); i += batchSize {
 		end := i + batchSize
@@ -320,17 +323,62 @@ func (d *Database) BatchDelete(tableName string, ids []interface{}, idColumn str
 		}
 	}
 
-	// 提交事务
-	if err := tx.Commit(); err != nil {
-		return result, fmt.Errorf("提交事务失败: %v", err)
-	}
-
 	result.Duration = time.Since(startTime).Milliseconds()
 	return result, nil
 }
 
-// BatchUpsert 批量插入或更新（使用REPLACE INTO）
-func (d *Database) BatchUpsert(tableName string, dataList []map[string]interface{}, batchSize int) (BatchInsertResult, error) {
+// ConflictTarget 插入冲突的判断字段，需与主键或唯一索引的字段一致
+type ConflictTarget struct {
+	Columns []string // 冲突判断字段
+	Where   string   // 唯一索引为部分索引时的索引条件
+}
+
+// UpsertOptions 批量插入或更新时的冲突处理方式
+type UpsertOptions struct {
+	Targets     []ConflictTarget // 冲突判断字段，按顺序匹配
+	KeepColumns []string         // 冲突时保留原值的字段，如主键、创建时间
+}
+
+// buildUpsertClause 生成ON CONFLICT DO UPDATE子句，冲突时更新冲突判断字段和保留字段以外的字段
+func buildUpsertClause(columns []string, options UpsertOptions) string {
+	var clauses []string
+	for _, target := range options.Targets {
+		var setClauses []string
+		for _, col := range columns {
+			if slices.Contains(target.Columns, col) || slices.Contains(options.KeepColumns, col) {
+				continue
+			}
+			setClauses = append(setClauses, fmt.Sprintf("%s = excluded.%s", col, col))
+		}
+
+		clause := fmt.Sprintf("ON CONFLICT (%s)", strings.Join(target.Columns, ", "))
+		if target.Where != "" {
+			clause += " WHERE " + target.Where
+		}
+		if len(setClauses) == 0 {
+			clause += " DO NOTHING"
+		} else {
+			clause += " DO UPDATE SET " + strings.Join(setClauses, ", ")
+		}
+		clauses = append(clauses, clause)
+	}
+	return strings.Join(clauses, " ")
+}
+
+// BatchUpsert 批量插入或更新（使用INSERT ... ON CONFLICT DO UPDATE），在单独的写事务中执行
+func (d *Database) BatchUpsert(tableName string, dataList []map[string]interface{}, options UpsertOptions, batchSize int) (BatchInsertResult, error) {
+	var result BatchInsertResult
+	err := d.WithTx(func(tx *sql.Tx) error {
+		var err error
+		result, err = BatchUpsertTx(tx, tableName, dataList, options, batchSize)
+		return err
+	})
+	return result, err
+}
+
+// BatchUpsertTx 在调用方传入的事务中执行BatchUpsert，由调用方提交或回滚。
+// 与REPLACE INTO不同，冲突时原记录原地更新，不会先删除再插入
+func BatchUpsertTx(tx *sql.Tx, tableName string, dataList []map[string]interface{}, options UpsertOptions, batchSize int) (BatchInsertResult, error) {
 	startTime := time.Now()
 	result := BatchInsertResult{
 		TotalRows: int64(len(dataList)),
@@ -340,19 +388,16 @@ func (d *Database) BatchUpsert(tableName string, dataList []map[string]interface
 	if len(dataList) == 0 {
 		return result, nil
 	}
-
-	// 开始事务
-	tx, err := d.Begin()
-	if err != nil {
-		return result, fmt.Errorf("开始事务失败: %v", err)
+	if len(options.Targets) == 0 {
+		return result, fmt.Errorf("未指定冲突判断字段")
 	}
-	defer tx.Rollback()
 
 	// 获取列名
 	var columns []string
 	for col := range dataList[0] {
 		columns = append(columns, col)
 	}
+	upsertClause := buildUpsertClause(columns, options)
 
 	// 分批处理
 	for i := 0; i < len(dataList); i += batchSize {
@@ -363,7 +408,7 @@ func (d *Database) BatchUpsert(tableName string, dataList []map[string]interface
 
 		batch := dataList[i:end]
 
-		// 构建REPLACE INTO语句
+		// 构建INSERT ... ON CONFLICT语句
 		var valueStrings []string
 		var allValues []interface{}
 
@@ -379,10 +424,11 @@ func (d *Database) BatchUpsert(tableName string, dataList []map[string]interface
 			}
 		}
 
-		query := fmt.Sprintf("REPLACE INTO %s (%s) VALUES %s",
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s %s",
 			tableName,
 			strings.Join(columns, ", "),
-			strings.Join(valueStrings, ", "))
+			strings.Join(valueStrings, ", "),
+			upsertClause)
 
 		res, err := tx.Exec(query, allValues...)
 		if err != nil {
@@ -396,17 +442,23 @@ func (d *Database) BatchUpsert(tableName string, dataList []map[string]interface
 		}
 	}
 
-	// 提交事务
-	if err := tx.Commit(); err != nil {
-		return result, fmt.Errorf("提交事务失败: %v", err)
-	}
-
 	result.Duration = time.Since(startTime).Milliseconds()
 	return result, nil
 }
 
-// BatchInsertWithIgnore 批量插入（忽略重复）
+// BatchInsertWithIgnore 批量插入（忽略重复），在单独的写事务中执行
 func (d *Database) BatchInsertWithIgnore(tableName string, dataList []map[string]interface{}, batchSize int) (BatchInsertResult, error) {
+	var result BatchInsertResult
+	err := d.WithTx(func(tx *sql.Tx) error {
+		var err error
+		result, err = BatchInsertWithIgnoreTx(tx, tableName, dataList, batchSize)
+		return err
+	})
+	return result, err
+}
+
+// BatchInsertWithIgnoreTx 在调用方传入的事务中执行BatchInsertWithIgnore，由调用方提交或回滚
+func BatchInsertWithIgnoreTx(tx *sql.Tx, tableName string, dataList []map[string]interface{}, batchSize int) (BatchInsertResult, error) {
 	startTime := time.Now()
 	result := BatchInsertResult{
 		TotalRows: int64(len(dataList)),
@@ -417,13 +469,6 @@ func (d *Database) BatchInsertWithIgnore(tableName string, dataList []map[string
 		return result, nil
 	}
 
-	// 开始事务
-	tx, err := d.Begin()
-	if err != nil {
-		return result, fmt.Errorf("开始事务失败: %v", err)
-	}
-	defer tx.Rollback()
-
 	// 获取列名
 	var columns []string
 	for col := range dataList[0] {
@@ -472,11 +517,6 @@ func (d *Database) BatchInsertWithIgnore(tableName string, dataList []map[string
 		}
 	}
 
-	// 提交事务
-	if err := tx.Commit(); err != nil {
-		return result, fmt.Errorf("提交事务失败: %v", err)
-	}
-
 	result.Duration = time.Since(startTime).Milliseconds()
 	return result, nil
 }
@@ -0,0 +1,679 @@
+package db
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tjfoc/gmsm/sm3"
+	"github.com/tjfoc/gmsm/sm4"
+)
+
+// 数据库文件加密存储
+// 磁盘上只保存加密后的数据库文件，打开时校验并解密到当前用户的工作目录，关闭或Flush时加密写回。
+// 加密文件格式：魔数(8) | 盐(16) | IV(16) | SM4-CTR密文 | HMAC-SM3(32)，HMAC覆盖魔数到密文的全部内容
+const (
+	encryptedFileMagic  = "SJDBENC1"
+	encryptedSaltSize   = 16
+	encryptedHeaderSize = len(encryptedFileMagic) + encryptedSaltSize + sm4.BlockSize
+	encryptedTagSize    = 32
+
+	masterKeySalt       = "shuji-database-file"
+	masterKeyIterations = 100000
+
+	sqliteFileHeader = "SQLite format 3\x00"
+	workDirName      = "shuji"
+	workTagExt       = ".src" // 记录工作文件对应的加密文件版本
+	cryptoChunkSize  = 1 << 20
+)
+
+// ErrWrongKey 密钥错误或加密文件被篡改、损坏
+var ErrWrongKey = errors.New("数据库密钥错误或文件已损坏")
+
+// 数据库文件类型
+const (
+	fileKindMissing   = iota // 文件不存在或为空
+	fileKindEncrypted        // 加密的数据库文件
+	fileKindPlain            // 未加密的SQLite文件，早期版本遗留
+	fileKindUnknown          // 无法识别的文件
+)
+
+// masterKeys 按密码缓存主密钥，避免每次打开文件都重复计算
+var masterKeys sync.Map
+
+// workingFile 加密数据库在工作目录中的明文副本，同一文件的多个连接共用一个副本和一个写连接
+type workingFile struct {
+	path       string     // 加密文件路径
+	workPath   string     // 工作文件路径
+	password   string     // 数据库密码
+	refs       int        // 打开的连接数
+	writable   bool       // 是否有可写连接，只读打开时关闭后不写回
+	plain      bool       // 只读打开的未加密文件，关闭后不写回
+	digest     string     // 解密后工作文件的摘要，关闭时内容未变则不写回，为空时总是写回
+	writer     *sql.DB    // 可写打开共用的写连接，保证同一文件只有一个写连接
+	writerRefs int        // 使用写连接的数据库数
+	mutex      sync.Mutex // 写回加密文件时加锁
+}
+
+var (
+	workingFiles      = make(map[string]*workingFile)
+	workingFilesMutex sync.Mutex
+)
+
+// pbkdf2SM3 使用HMAC-SM3的PBKDF2密钥派生
+func pbkdf2SM3(password []byte, salt []byte, iterations int, keyLen int) []byte {
+	prf := hmac.New(sm3.New, password)
+	var derived []byte
+	for block := uint32(1); len(derived) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		derived = append(derived, t...)
+	}
+	return derived[:keyLen]
+}
+
+// getMasterKey 获取密码对应的主密钥
+func getMasterKey(password string) []byte {
+	if key, ok := masterKeys.Load(password); ok {
+		return key.([]byte)
+	}
+	key := pbkdf2SM3([]byte(password), []byte(masterKeySalt), masterKeyIterations, 32)
+	masterKeys.Store(password, key)
+	return key
+}
+
+// deriveFileKeys 按文件的盐派生加密密钥和校验密钥，每次写入文件使用新的盐
+func deriveFileKeys(password string, salt []byte) (encKey []byte, macKey []byte) {
+	derive := func(label string) []byte {
+		mac := hmac.New(sm3.New, getMasterKey(password))
+		mac.Write([]byte(label))
+		mac.Write(salt)
+		return mac.Sum(nil)
+	}
+	return derive("encrypt")[:sm4.BlockSize], derive("mac")
+}
+
+// newFileCipher 创建加密文件的CTR流和HMAC
+func newFileCipher(password string, header []byte) (cipher.Stream, hash.Hash, error) {
+	salt := header[len(encryptedFileMagic) : len(encryptedFileMagic)+encryptedSaltSize]
+	iv := header[len(encryptedFileMagic)+encryptedSaltSize : encryptedHeaderSize]
+	encKey, macKey := deriveFileKeys(password, salt)
+	block, err := sm4.NewCipher(encKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	mac := hmac.New(sm3.New, macKey)
+	mac.Write(header)
+	return cipher.NewCTR(block, iv), mac, nil
+}
+
+// detectFileKind 根据文件头判断数据库文件类型
+func detectFileKind(path string) (int, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return fileKindMissing, nil
+	}
+	if err != nil {
+		return fileKindUnknown, err
+	}
+	defer file.Close()
+
+	header := make([]byte, len(sqliteFileHeader))
+	n, err := io.ReadFull(file, header)
+	switch {
+	case n == 0:
+		return fileKindMissing, nil
+	case bytes.HasPrefix(header[:n], []byte(encryptedFileMagic)) && n >= len(encryptedFileMagic):
+		return fileKindEncrypted, nil
+	case err == nil && string(header) == sqliteFileHeader:
+		return fileKindPlain, nil
+	}
+	return fileKindUnknown, nil
+}
+
+// IsEncryptedFile 判断文件是否为加密的数据库文件
+func IsEncryptedFile(path string) bool {
+	kind, _ := detectFileKind(path)
+	return kind == fileKindEncrypted
+}
+
+// EncryptFile 将明文数据库文件加密写入dstPath，先写临时文件再替换，返回文件校验值
+func EncryptFile(srcPath string, dstPath string, password string) ([]byte, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	header := make([]byte, encryptedHeaderSize)
+	copy(header, encryptedFileMagic)
+	if _, err := rand.Read(header[len(encryptedFileMagic):]); err != nil {
+		return nil, err
+	}
+	stream, mac, err := newFileCipher(password, header)
+	if err != nil {
+		return nil, err
+	}
+
+	tempPath := dstPath + ".enc"
+	dst, err := os.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := func() ([]byte, error) {
+		defer dst.Close()
+		if _, err := dst.Write(header); err != nil {
+			return nil, err
+		}
+		buffer := make([]byte, cryptoChunkSize)
+		for {
+			n, readErr := src.Read(buffer)
+			if n > 0 {
+				stream.XORKeyStream(buffer[:n], buffer[:n])
+				mac.Write(buffer[:n])
+				if _, err := dst.Write(buffer[:n]); err != nil {
+					return nil, err
+				}
+			}
+			if readErr == io.EOF {
+				break
+			}
+			if readErr != nil {
+				return nil, readErr
+			}
+		}
+		tag := mac.Sum(nil)
+		if _, err := dst.Write(tag); err != nil {
+			return nil, err
+		}
+		return tag, dst.Sync()
+	}()
+	if err == nil {
+		err = os.Rename(tempPath, dstPath)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+	return tag, nil
+}
+
+// readEncryptedFile 校验加密文件并逐块回调解密后的内容，校验不通过时不回调，返回文件校验值
+func readEncryptedFile(path string, password string, fn func(plain []byte) error) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	bodySize := stat.Size() - int64(encryptedHeaderSize) - encryptedTagSize
+	if bodySize < 0 {
+		return nil, ErrWrongKey
+	}
+
+	header := make([]byte, encryptedHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil || string(header[:len(encryptedFileMagic)]) != encryptedFileMagic {
+		return nil, ErrWrongKey
+	}
+
+	// 第一遍校验HMAC，第二遍解密，密钥错误时不产生任何明文
+	var tag []byte
+	for pass := 0; pass < 2; pass++ {
+		stream, mac, err := newFileCipher(password, header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Seek(int64(encryptedHeaderSize), io.SeekStart); err != nil {
+			return nil, err
+		}
+		buffer := make([]byte, cryptoChunkSize)
+		for remaining := bodySize; remaining > 0; {
+			chunk := buffer[:min(int64(len(buffer)), remaining)]
+			if _, err := io.ReadFull(file, chunk); err != nil {
+				return nil, err
+			}
+			remaining -= int64(len(chunk))
+			if pass == 0 {
+				mac.Write(chunk)
+				continue
+			}
+			stream.XORKeyStream(chunk, chunk)
+			if err := fn(chunk); err != nil {
+				return nil, err
+			}
+		}
+		if pass == 0 {
+			tag = make([]byte, encryptedTagSize)
+			if _, err := io.ReadFull(file, tag); err != nil {
+				return nil, err
+			}
+			if !hmac.Equal(tag, mac.Sum(nil)) {
+				return nil, ErrWrongKey
+			}
+			if fn == nil {
+				break
+			}
+		}
+	}
+	return tag, nil
+}
+
+// DecryptFile 校验并解密数据库文件到dstPath，密钥错误或文件被篡改时返回ErrWrongKey
+func DecryptFile(srcPath string, dstPath string, password string) ([]byte, error) {
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := readEncryptedFile(srcPath, password, func(plain []byte) error {
+		_, err := dst.Write(plain)
+		return err
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dstPath)
+		return nil, err
+	}
+	return tag, nil
+}
+
+// getWorkDir 获取当前用户的数据库工作目录，只有当前用户可以访问
+func getWorkDir() (string, error) {
+	baseDir, err := os.UserCacheDir()
+	if err != nil {
+		baseDir = os.TempDir()
+	}
+	dir := filepath.Join(baseDir, workDirName, "db")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("创建数据库工作目录失败: %v", err)
+	}
+	// 早期版本创建的目录可能允许其他用户访问
+	if err := os.Chmod(dir, 0700); err != nil {
+		return "", fmt.Errorf("设置数据库工作目录权限失败: %v", err)
+	}
+	return dir, nil
+}
+
+// createWorkFile 创建只有当前用户可以读写的空文件，SQLite在已存在的文件上建库或VACUUM INTO时沿用文件权限，WAL等文件也使用相同的权限
+func createWorkFile(path string) error {
+	os.Remove(path)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// getWorkPath 获取加密文件对应的工作文件路径
+func getWorkPath(absPath string) (string, error) {
+	dir, err := getWorkDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, hex.EncodeToString(sm3.Sm3Sum([]byte(absPath)))[:32]+".db"), nil
+}
+
+// removeWorkFiles 删除工作文件及其WAL文件
+func removeWorkFiles(workPath string) {
+	for _, suffix := range []string{"", "-wal", "-shm", "-journal", workTagExt} {
+		os.Remove(workPath + suffix)
+	}
+}
+
+// RemoveStaleWorkingFiles 删除工作目录中上次异常退出遗留的明文工作文件和临时文件，程序启动时在打开数据库之前调用，
+// keepPaths对应的工作文件保留，打开时继续使用其中未写回的数据
+func RemoveStaleWorkingFiles(keepPaths ...string) error {
+	dir, err := getWorkDir()
+	if err != nil {
+		return err
+	}
+	keepNames := make(map[string]bool)
+	for _, path := range keepPaths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		if workPath, err := getWorkPath(absPath); err == nil {
+			keepNames[filepath.Base(workPath)] = true
+		}
+	}
+
+	workingFilesMutex.Lock()
+	for _, file := range workingFiles {
+		keepNames[filepath.Base(file.workPath)] = true
+	}
+	workingFilesMutex.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		// 保留工作文件本身及其WAL文件和版本记录，写回时的临时副本删除
+		baseName, _, _ := strings.Cut(name, "-")
+		baseName = strings.TrimSuffix(baseName, workTagExt)
+		if keepNames[baseName] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			log.Printf("删除遗留的数据库工作文件失败: %v", err)
+			continue
+		}
+		log.Printf("已删除遗留的数据库工作文件: %s", name)
+	}
+	return nil
+}
+
+// HasPendingWorkingFile 判断数据库是否有上次未正常关闭遗留的工作文件
+func HasPendingWorkingFile(dbPath string) bool {
+	absPath, err := filepath.Abs(dbPath)
+	if err != nil {
+		return false
+	}
+	workingFilesMutex.Lock()
+	_, opened := workingFiles[absPath]
+	workingFilesMutex.Unlock()
+	if opened {
+		return false
+	}
+	workPath, err := getWorkPath(absPath)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(workPath)
+	return err == nil
+}
+
+// encryptPlainFile 将早期版本未加密的数据库文件原地转换为加密文件，转换前先把WAL中的数据写回数据库文件
+func encryptPlainFile(path string, password string) error {
+	plainDb, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	_, err = plainDb.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	plainDb.Close()
+	if err != nil {
+		return fmt.Errorf("写回WAL数据失败: %v", err)
+	}
+	if _, err := EncryptFile(path, path, password); err != nil {
+		return err
+	}
+	os.Remove(path + "-wal")
+	os.Remove(path + "-shm")
+	log.Printf("数据库文件已转换为加密存储: %s", path)
+	return nil
+}
+
+// copyPlainFile 只读打开未加密的数据库文件时复制到工作目录，不修改原文件
+func copyPlainFile(path string, workPath string) error {
+	for _, suffix := range []string{"", "-wal"} {
+		data, err := os.ReadFile(path + suffix)
+		if os.IsNotExist(err) && suffix != "" {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(workPath+suffix, data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acquireWorkingFile 获取数据库文件的工作文件，首次打开时校验并解密，上次异常退出遗留的工作文件比加密文件新时继续使用
+func acquireWorkingFile(dbPath string, password string, writable bool) (*workingFile, error) {
+	absPath, err := filepath.Abs(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	workingFilesMutex.Lock()
+	defer workingFilesMutex.Unlock()
+
+	if file, exists := workingFiles[absPath]; exists {
+		if file.password != password {
+			return nil, ErrWrongKey
+		}
+		if writable && file.plain {
+			return nil, fmt.Errorf("数据库已以只读方式打开")
+		}
+		file.refs++
+		file.writable = file.writable || writable
+		return file, nil
+	}
+
+	workPath, err := getWorkPath(absPath)
+	if err != nil {
+		return nil, err
+	}
+	file := &workingFile{path: absPath, workPath: workPath, password: password, refs: 1, writable: writable}
+
+	kind, err := detectFileKind(absPath)
+	if err != nil {
+		return nil, err
+	}
+	if kind == fileKindPlain {
+		if !writable {
+			removeWorkFiles(workPath)
+			if err := copyPlainFile(absPath, workPath); err != nil {
+				return nil, fmt.Errorf("复制数据库文件失败: %v", err)
+			}
+			file.plain = true
+			workingFiles[absPath] = file
+			return file, nil
+		}
+		if err := encryptPlainFile(absPath, password); err != nil {
+			return nil, fmt.Errorf("数据库文件加密失败: %v", err)
+		}
+		kind = fileKindEncrypted
+	}
+
+	switch kind {
+	case fileKindMissing:
+		// 新建的数据库，关闭时加密写入
+		removeWorkFiles(workPath)
+		if err := createWorkFile(workPath); err != nil {
+			return nil, err
+		}
+	case fileKindEncrypted:
+		tag, err := readEncryptedFile(absPath, password, nil)
+		if err != nil {
+			return nil, err
+		}
+		pendingTag, _ := os.ReadFile(workPath + workTagExt)
+		if _, statErr := os.Stat(workPath); statErr == nil && hex.EncodeToString(tag) == string(pendingTag) {
+			log.Printf("发现上次未正常关闭的数据库工作文件，继续使用其中的数据: %s", absPath)
+			// 早期版本创建的工作文件可能允许其他用户读取
+			for _, suffix := range []string{"", "-wal", "-shm", workTagExt} {
+				if err := os.Chmod(workPath+suffix, 0600); err != nil && !os.IsNotExist(err) {
+					return nil, err
+				}
+			}
+		} else {
+			removeWorkFiles(workPath)
+			if _, err := DecryptFile(absPath, workPath, password); err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(workPath+workTagExt, []byte(hex.EncodeToString(tag)), 0600); err != nil {
+				removeWorkFiles(workPath)
+				return nil, err
+			}
+			file.digest, _ = fileDigest(workPath)
+		}
+	default:
+		return nil, fmt.Errorf("不是有效的数据库文件: %s", absPath)
+	}
+
+	workingFiles[absPath] = file
+	return file, nil
+}
+
+// acquireWriter 获取工作文件共用的写连接，第一个可写打开的数据库创建写连接
+func acquireWriter(f *workingFile) (*sql.DB, error) {
+	workingFilesMutex.Lock()
+	defer workingFilesMutex.Unlock()
+
+	if f.writer == nil {
+		writer, err := openConnection(f.workPath, false, 1)
+		if err != nil {
+			return nil, err
+		}
+		f.writer = writer
+	}
+	f.writerRefs++
+	return f.writer, nil
+}
+
+// releaseWriter 释放共用的写连接，最后一个可写打开的数据库关闭时写回WAL并关闭写连接
+func releaseWriter(f *workingFile) error {
+	workingFilesMutex.Lock()
+	defer workingFilesMutex.Unlock()
+
+	f.writerRefs--
+	if f.writerRefs > 0 || f.writer == nil {
+		return nil
+	}
+	f.writer.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	err := f.writer.Close()
+	f.writer = nil
+	return err
+}
+
+// CheckFileKey 校验加密数据库文件的密钥，文件不存在或未加密时不需要密钥，返回nil，密钥错误或文件被篡改时返回ErrWrongKey
+func CheckFileKey(path string, password string) error {
+	kind, err := detectFileKind(path)
+	if err != nil {
+		return err
+	}
+	if kind != fileKindEncrypted {
+		return nil
+	}
+	_, err = readEncryptedFile(path, password, nil)
+	return err
+}
+
+// RekeyFile 将加密数据库文件改用新密码加密，旧密码错误时返回ErrWrongKey且文件不变，文件打开期间不能更换密码
+func RekeyFile(path string, oldPassword string, newPassword string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	workingFilesMutex.Lock()
+	_, opened := workingFiles[absPath]
+	workingFilesMutex.Unlock()
+	if opened {
+		return fmt.Errorf("数据库正在使用，不能更换密钥: %s", absPath)
+	}
+
+	workDir, err := getWorkDir()
+	if err != nil {
+		return err
+	}
+	tempPath := filepath.Join(workDir, fmt.Sprintf("rekey_%d.db", time.Now().UnixNano()))
+	defer os.Remove(tempPath)
+	if _, err := DecryptFile(absPath, tempPath, oldPassword); err != nil {
+		return err
+	}
+	_, err = EncryptFile(tempPath, absPath, newPassword)
+	return err
+}
+
+// flush 将工作文件的一致副本加密写回，database为工作文件上打开的连接
+func (f *workingFile) flush(database *sql.DB) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	tempPath := f.workPath + ".flush"
+	defer os.Remove(tempPath)
+	if err := createWorkFile(tempPath); err != nil {
+		return err
+	}
+	if _, err := database.Exec("VACUUM INTO ?", tempPath); err != nil {
+		return err
+	}
+	tag, err := EncryptFile(tempPath, f.path, f.password)
+	if err != nil {
+		return err
+	}
+	// 写回的是一致副本而不是工作文件本身，关闭时无法再按摘要判断是否有修改
+	f.digest = ""
+	return os.WriteFile(f.workPath+workTagExt, []byte(hex.EncodeToString(tag)), 0600)
+}
+
+// fileDigest 计算文件内容的SM3摘要
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sm3.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// unchanged 判断工作文件内容是否与解密时相同，未修改的数据库关闭时不重新加密写回
+func (f *workingFile) unchanged() bool {
+	if f.digest == "" {
+		return false
+	}
+	digest, err := fileDigest(f.workPath)
+	return err == nil && digest == f.digest
+}
+
+// releaseWorkingFile 释放工作文件，最后一个连接关闭后内容有修改时加密写回，再删除工作文件，写回失败时保留工作文件供下次打开时继续使用
+func releaseWorkingFile(f *workingFile) error {
+	workingFilesMutex.Lock()
+	defer workingFilesMutex.Unlock()
+
+	f.refs--
+	if f.refs > 0 {
+		return nil
+	}
+	delete(workingFiles, f.path)
+
+	if f.writable && !f.plain && !f.unchanged() {
+		if _, err := os.Stat(f.workPath); err == nil {
+			f.mutex.Lock()
+			_, err := EncryptFile(f.workPath, f.path, f.password)
+			f.mutex.Unlock()
+			if err != nil {
+				return fmt.Errorf("加密写回数据库文件失败: %v", err)
+			}
+		}
+	}
+	removeWorkFiles(f.workPath)
+	return nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"modernc.org/sqlite"
+)
+
+// SQL中可用的解密函数名
+const (
+	FuncDecrypt    = "sm4_dec"     // sm4_dec(col) 解密为文本，空值或解密失败返回NULL
+	FuncDecryptNum = "sm4_dec_num" // sm4_dec_num(col) 解密为数值，空值、解密失败或非数值返回NULL
+)
+
+var (
+	registerFunctionsOnce sync.Once
+	registerFunctionsErr  error
+)
+
+// Decrypter SQL解密函数使用的解密方法，Cipher的子集
+type Decrypter interface {
+	SM4Decrypt(ciphertext string) (string, error)
+}
+
+// CipherFunc 将普通解密函数适配为Decrypter，注册SQL函数时不需要构造应用对象
+type CipherFunc func(ciphertext string) (string, error)
+
+// SM4Decrypt 调用解密函数
+func (f CipherFunc) SM4Decrypt(ciphertext string) (string, error) {
+	return f(ciphertext)
+}
+
+// RegisterCipherFunctions 注册SQL解密函数，使汇总查询可以在SQL中直接对加密字段求和。
+// 函数注册在驱动上，只对注册之后打开的连接生效，需在打开数据库之前调用，重复调用只注册一次
+func RegisterCipherFunctions(cipher Decrypter) error {
+	registerFunctionsOnce.Do(func() {
+		decrypt := func(args []driver.Value) (string, bool) {
+			text := strings.TrimSpace(formatModelValue(args[0]))
+			if args[0] == nil || text == "" {
+				return "", false
+			}
+			plaintext, err := cipher.SM4Decrypt(text)
+			if err != nil {
+				return "", false
+			}
+			return strings.TrimSpace(plaintext), true
+		}
+
+		registerFunctionsErr = sqlite.RegisterDeterministicScalarFunction(FuncDecrypt, 1,
+			func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+				plaintext, ok := decrypt(args)
+				if !ok {
+					return nil, nil
+				}
+				return plaintext, nil
+			})
+		if registerFunctionsErr != nil {
+			return
+		}
+
+		registerFunctionsErr = sqlite.RegisterDeterministicScalarFunction(FuncDecryptNum, 1,
+			func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+				plaintext, ok := decrypt(args)
+				if !ok || plaintext == "" {
+					return nil, nil
+				}
+				number, err := strconv.ParseFloat(plaintext, 64)
+				if err != nil {
+					return nil, nil
+				}
+				return number, nil
+			})
+	})
+	return registerFunctionsErr
+}
+
+// DecryptedSum 生成对加密数值字段求和的SQL表达式，结果列名为alias。
+// 与应用中的addFloat64一致，每个值先按千分之一截断为整数再累加，避免浮点累加误差，无数据时为0
+func DecryptedSum(column string, alias string) string {
+	return fmt.Sprintf("COALESCE(SUM(CAST(%s(%s) * 1000 AS INTEGER)), 0) / 1000.0 AS %s", FuncDecryptNum, column, alias)
+}
+
+// FloatValue 将查询结果中的汇总值转换为浮点数，空值或无法转换时返回0
+func FloatValue(value interface{}) float64 {
+	if value == nil {
+		return 0
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(formatModelValue(value)), 64)
+	if err != nil {
+		return 0
+	}
+	return number
+}
@@ -0,0 +1,254 @@
+package db
+
+// Model 数据表模型，字段通过db标签对应表字段，标签带encrypted选项的字段在库中SM4加密存储
+type Model interface {
+	TableName() string
+}
+
+// EnterpriseCoalConsumptionMain 附表1规上企业基本信息及综合能源消费情况
+type EnterpriseCoalConsumptionMain struct {
+	ObjID                       string `json:"obj_id" db:"obj_id"`                                                           // 主键
+	UnitName                    string `json:"unit_name" db:"unit_name"`                                                     // 单位名称
+	StatDate                    string `json:"stat_date" db:"stat_date"`                                                     // 数据年份
+	SgCode                      string `json:"sg_code" db:"sg_code"`                                                         // 国网代码
+	Tel                         string `json:"tel" db:"tel"`                                                                 // 联系电话
+	CreditCode                  string `json:"credit_code" db:"credit_code"`                                                 // 统一社会信用代码
+	CreateTime                  int64  `json:"create_time" db:"create_time"`                                                 // 创建时间
+	TradeA                      string `json:"trade_a" db:"trade_a"`                                                         // 行业门类
+	TradeB                      string `json:"trade_b" db:"trade_b"`                                                         // 行业大类
+	TradeC                      string `json:"trade_c" db:"trade_c"`                                                         // 行业中类
+	ProvinceCode                string `json:"province_code" db:"province_code"`                                             // 省级代码
+	ProvinceName                string `json:"province_name" db:"province_name"`                                             // 省级名称
+	CityCode                    string `json:"city_code" db:"city_code"`                                                     // 市级代码
+	CityName                    string `json:"city_name" db:"city_name"`                                                     // 市级名称
+	CountryCode                 string `json:"country_code" db:"country_code"`                                               // 县级代码
+	CountryName                 string `json:"country_name" db:"country_name"`                                               // 县级名称
+	AnnualEnergyEquivalentValue string `json:"annual_energy_equivalent_value" db:"annual_energy_equivalent_value,encrypted"` // 年综合能耗当量值，加密
+	AnnualEnergyEquivalentCost  string `json:"annual_energy_equivalent_cost" db:"annual_energy_equivalent_cost,encrypted"`   // 年综合能耗等价值，加密
+	AnnualRawMaterialEnergy     string `json:"annual_raw_material_energy" db:"annual_raw_material_energy,encrypted"`         // 年原料用能消费量，加密
+	AnnualTotalCoalConsumption  string `json:"annual_total_coal_consumption" db:"annual_total_coal_consumption,encrypted"`   // 耗煤总量（实物量），加密
+	AnnualTotalCoalProducts     string `json:"annual_total_coal_products" db:"annual_total_coal_products,encrypted"`         // 耗煤总量（标准量），加密
+	AnnualRawCoal               string `json:"annual_raw_coal" db:"annual_raw_coal,encrypted"`                               // 原料用煤，加密
+	AnnualRawCoalConsumption    string `json:"annual_raw_coal_consumption" db:"annual_raw_coal_consumption,encrypted"`       // 原煤消费，加密
+	AnnualCleanCoalConsumption  string `json:"annual_clean_coal_consumption" db:"annual_clean_coal_consumption,encrypted"`   // 洗精煤消费，加密
+	AnnualOtherCoalConsumption  string `json:"annual_other_coal_consumption" db:"annual_other_coal_consumption,encrypted"`   // 其他煤炭消费，加密
+	AnnualCokeConsumption       string `json:"annual_coke_consumption" db:"annual_coke_consumption,encrypted"`               // 焦炭消费，加密
+	CreateUser                  string `json:"create_user" db:"create_user"`                                                 // 创建用户
+	IsConfirm                   string `json:"is_confirm" db:"is_confirm,encrypted"`                                         // 是否确认，加密
+	IsCheck                     string `json:"is_check" db:"is_check,encrypted"`                                             // 是否校验，加密
+	FileHash                    string `json:"file_hash" db:"file_hash"`                                                     // 源文件内容哈希
+}
+
+// TableName 表名
+func (EnterpriseCoalConsumptionMain) TableName() string { return "enterprise_coal_consumption_main" }
+
+// EnterpriseCoalConsumptionUsage 附表1煤炭消费主要用途情况
+type EnterpriseCoalConsumptionUsage struct {
+	ObjID             string `json:"obj_id" db:"obj_id"`                             // 主键
+	FkID              string `json:"fk_id" db:"fk_id"`                               // 主表obj_id
+	StatDate          string `json:"stat_date" db:"stat_date"`                       // 数据年份
+	CreateTime        int64  `json:"create_time" db:"create_time"`                   // 创建时间
+	MainUsage         string `json:"main_usage" db:"main_usage"`                     // 主要用途
+	SpecificUsage     string `json:"specific_usage" db:"specific_usage"`             // 具体用途
+	InputVariety      string `json:"input_variety" db:"input_variety"`               // 投入品种
+	InputUnit         string `json:"input_unit" db:"input_unit"`                     // 投入计量单位
+	InputQuantity     string `json:"input_quantity" db:"input_quantity,encrypted"`   // 投入量，加密
+	OutputEnergyTypes string `json:"output_energy_types" db:"output_energy_types"`   // 产出品种品类
+	OutputQuantity    string `json:"output_quantity" db:"output_quantity,encrypted"` // 产出量，加密
+	MeasurementUnit   string `json:"measurement_unit" db:"measurement_unit"`         // 产出计量单位
+	Remarks           string `json:"remarks" db:"remarks"`                           // 备注
+	RowNo             string `json:"row_no" db:"row_no"`                             // 序号
+	IsConfirm         string `json:"is_confirm" db:"is_confirm,encrypted"`           // 是否确认，加密
+	IsCheck           string `json:"is_check" db:"is_check,encrypted"`               // 是否校验，加密
+}
+
+// TableName 表名
+func (EnterpriseCoalConsumptionUsage) TableName() string { return "enterprise_coal_consumption_usage" }
+
+// EnterpriseCoalConsumptionEquip 附表1重点耗煤装置情况
+type EnterpriseCoalConsumptionEquip struct {
+	ObjID                 string `json:"obj_id" db:"obj_id"`                                             // 主键
+	FkID                  string `json:"fk_id" db:"fk_id"`                                               // 主表obj_id
+	StatDate              string `json:"stat_date" db:"stat_date"`                                       // 数据年份
+	CreateTime            int64  `json:"create_time" db:"create_time"`                                   // 创建时间
+	EquipType             string `json:"equip_type" db:"equip_type"`                                     // 类型
+	EquipNo               string `json:"equip_no" db:"equip_no"`                                         // 编号
+	TotalRuntime          string `json:"total_runtime" db:"total_runtime,encrypted"`                     // 累计使用时间，加密
+	DesignLife            string `json:"design_life" db:"design_life,encrypted"`                         // 设计年限，加密
+	EnergyEfficiency      string `json:"energy_efficiency" db:"energy_efficiency,encrypted"`             // 能效水平，加密
+	CapacityUnit          string `json:"capacity_unit" db:"capacity_unit"`                               // 容量单位
+	Capacity              string `json:"capacity" db:"capacity,encrypted"`                               // 容量，加密
+	CoalType              string `json:"coal_type" db:"coal_type"`                                       // 耗煤品种
+	AnnualCoalConsumption string `json:"annual_coal_consumption" db:"annual_coal_consumption,encrypted"` // 年耗煤量，加密
+	RowNo                 string `json:"row_no" db:"row_no"`                                             // 序号
+	IsConfirm             string `json:"is_confirm" db:"is_confirm,encrypted"`                           // 是否确认，加密
+	IsCheck               string `json:"is_check" db:"is_check,encrypted"`                               // 是否校验，加密
+}
+
+// TableName 表名
+func (EnterpriseCoalConsumptionEquip) TableName() string { return "enterprise_coal_consumption_equip" }
+
+// CriticalCoalEquipmentConsumption 附表2其他单位重点耗煤装置
+type CriticalCoalEquipmentConsumption struct {
+	ObjID                 string `json:"obj_id" db:"obj_id"`                                             // 主键
+	StatDate              string `json:"stat_date" db:"stat_date"`                                       // 数据年份
+	CreateTime            int64  `json:"create_time" db:"create_time"`                                   // 创建时间
+	SgCode                string `json:"sg_code" db:"sg_code"`                                           // 国网代码
+	UnitName              string `json:"unit_name" db:"unit_name"`                                       // 单位名称
+	CreditCode            string `json:"credit_code" db:"credit_code"`                                   // 统一社会信用代码
+	TradeA                string `json:"trade_a" db:"trade_a"`                                           // 行业门类
+	TradeB                string `json:"trade_b" db:"trade_b"`                                           // 行业大类
+	TradeC                string `json:"trade_c" db:"trade_c"`                                           // 行业中类
+	TradeD                string `json:"trade_d" db:"trade_d"`                                           // 行业小类
+	ProvinceCode          string `json:"province_code" db:"province_code"`                               // 省级代码
+	ProvinceName          string `json:"province_name" db:"province_name"`                               // 省级名称
+	CityCode              string `json:"city_code" db:"city_code"`                                       // 市级代码
+	CityName              string `json:"city_name" db:"city_name"`                                       // 市级名称
+	CountryCode           string `json:"country_code" db:"country_code"`                                 // 县级代码
+	CountryName           string `json:"country_name" db:"country_name"`                                 // 县级名称
+	UnitAddr              string `json:"unit_addr" db:"unit_addr"`                                       // 单位地址
+	CoalType              string `json:"coal_type" db:"coal_type"`                                       // 类型
+	CoalNo                string `json:"coal_no" db:"coal_no"`                                           // 编号
+	UsageTime             string `json:"usage_time" db:"usage_time"`                                     // 累计使用时间
+	DesignLife            string `json:"design_life" db:"design_life,encrypted"`                         // 设计年限，加密
+	EnecrgyEfficienctBmk  string `json:"enecrgy_efficienct_bmk" db:"enecrgy_efficienct_bmk"`             // 能效水平
+	CapacityUnit          string `json:"capacity_unit" db:"capacity_unit"`                               // 容量单位
+	Capacity              string `json:"capacity" db:"capacity,encrypted"`                               // 容量，加密
+	UseInfo               string `json:"use_info" db:"use_info"`                                         // 用途
+	Status                string `json:"status" db:"status"`                                             // 状态
+	AnnualCoalConsumption string `json:"annual_coal_consumption" db:"annual_coal_consumption,encrypted"` // 年耗煤量，加密
+	RowNo                 string `json:"row_no" db:"row_no"`                                             // 序号
+	CreateUser            string `json:"create_user" db:"create_user"`                                   // 创建用户
+	IsConfirm             string `json:"is_confirm" db:"is_confirm,encrypted"`                           // 是否确认，加密
+	IsCheck               string `json:"is_check" db:"is_check,encrypted"`                               // 是否校验，加密
+	FileHash              string `json:"file_hash" db:"file_hash"`                                       // 源文件内容哈希
+}
+
+// TableName 表名
+func (CriticalCoalEquipmentConsumption) TableName() string {
+	return "critical_coal_equipment_consumption"
+}
+
+// FixedAssetsInvestmentProject 附表3新上固定资产投资项目
+type FixedAssetsInvestmentProject struct {
+	ObjID                   string `json:"obj_id" db:"obj_id"`                                                   // 主键
+	StatDate                string `json:"stat_date" db:"stat_date"`                                             // 数据年份
+	SgCode                  string `json:"sg_code" db:"sg_code"`                                                 // 国网代码
+	ProjectName             string `json:"project_name" db:"project_name"`                                       // 项目名称
+	ProjectCode             string `json:"project_code" db:"project_code"`                                       // 项目代码
+	ConstructionUnit        string `json:"construction_unit" db:"construction_unit"`                             // 建设单位
+	MainConstructionContent string `json:"main_construction_content" db:"main_construction_content"`             // 主要建设内容
+	UnitID                  string `json:"unit_id" db:"unit_id"`                                                 // 单位代码
+	ProvinceName            string `json:"province_name" db:"province_name"`                                     // 省级名称
+	CityName                string `json:"city_name" db:"city_name"`                                             // 市级名称
+	CountryName             string `json:"country_name" db:"country_name"`                                       // 县级名称
+	TradeA                  string `json:"trade_a" db:"trade_a"`                                                 // 行业门类
+	TradeC                  string `json:"trade_c" db:"trade_c"`                                                 // 行业中类
+	ExaminationApprovalTime string `json:"examination_approval_time" db:"examination_approval_time"`             // 节能审查批复时间
+	ScheduledTime           string `json:"scheduled_time" db:"scheduled_time"`                                   // 拟投产时间
+	ActualTime              string `json:"actual_time" db:"actual_time"`                                         // 实际投产时间
+	ExaminationAuthority    string `json:"examination_authority" db:"examination_authority"`                     // 节能审查机关
+	DocumentNumber          string `json:"document_number" db:"document_number"`                                 // 审查意见文号
+	EquivalentValue         string `json:"equivalent_value" db:"equivalent_value,encrypted"`                     // 当量值，加密
+	EquivalentCost          string `json:"equivalent_cost" db:"equivalent_cost,encrypted"`                       // 等价值，加密
+	PqTotalCoalConsumption  string `json:"pq_total_coal_consumption" db:"pq_total_coal_consumption,encrypted"`   // 煤品消费总量（实物量），加密
+	PqCoalConsumption       string `json:"pq_coal_consumption" db:"pq_coal_consumption,encrypted"`               // 煤炭消费量（实物量），加密
+	PqCokeConsumption       string `json:"pq_coke_consumption" db:"pq_coke_consumption,encrypted"`               // 焦炭消费量（实物量），加密
+	PqBlueCokeConsumption   string `json:"pq_blue_coke_consumption" db:"pq_blue_coke_consumption,encrypted"`     // 兰炭消费量（实物量），加密
+	SceTotalCoalConsumption string `json:"sce_total_coal_consumption" db:"sce_total_coal_consumption,encrypted"` // 煤品消费总量（折标量），加密
+	SceCoalConsumption      string `json:"sce_coal_consumption" db:"sce_coal_consumption,encrypted"`             // 煤炭消费量（折标量），加密
+	SceCokeConsumption      string `json:"sce_coke_consumption" db:"sce_coke_consumption,encrypted"`             // 焦炭消费量（折标量），加密
+	SceBlueCokeConsumption  string `json:"sce_blue_coke_consumption" db:"sce_blue_coke_consumption,encrypted"`   // 兰炭消费量（折标量），加密
+	IsSubstitution          string `json:"is_substitution" db:"is_substitution"`                                 // 是否煤炭消费替代
+	SubstitutionSource      string `json:"substitution_source" db:"substitution_source"`                         // 煤炭消费替代来源
+	SubstitutionQuantity    string `json:"substitution_quantity" db:"substitution_quantity,encrypted"`           // 煤炭消费替代量，加密
+	PqAnnualCoalQuantity    string `json:"pq_annual_coal_quantity" db:"pq_annual_coal_quantity,encrypted"`       // 年原料用煤量（实物量），加密
+	SceAnnualCoalQuantity   string `json:"sce_annual_coal_quantity" db:"sce_annual_coal_quantity,encrypted"`     // 年原料用煤量（折标量），加密
+	CreateUser              string `json:"create_user" db:"create_user"`                                         // 创建用户
+	CreateTime              int64  `json:"create_time" db:"create_time"`                                         // 创建时间
+	IsConfirm               string `json:"is_confirm" db:"is_confirm,encrypted"`                                 // 是否确认，加密
+	IsCheck                 string `json:"is_check" db:"is_check,encrypted"`                                     // 是否校验，加密
+	FileHash                string `json:"file_hash" db:"file_hash"`                                             // 源文件内容哈希
+}
+
+// TableName 表名
+func (FixedAssetsInvestmentProject) TableName() string { return "fixed_assets_investment_project" }
+
+// CoalConsumptionReport 附件2区域煤炭消费情况
+type CoalConsumptionReport struct {
+	ObjID           string `json:"obj_id" db:"obj_id"`                               // 主键
+	StatDate        string `json:"stat_date" db:"stat_date"`                         // 数据年份
+	SgCode          string `json:"sg_code" db:"sg_code"`                             // 国网代码
+	UnitID          string `json:"unit_id" db:"unit_id"`                             // 单位代码
+	UnitName        string `json:"unit_name" db:"unit_name"`                         // 单位名称
+	UnitLevel       string `json:"unit_level" db:"unit_level"`                       // 单位等级：01-国家，02-省，03-市，04-县
+	ProvinceName    string `json:"province_name" db:"province_name"`                 // 省级名称
+	CityName        string `json:"city_name" db:"city_name"`                         // 市级名称
+	CountryName     string `json:"country_name" db:"country_name"`                   // 县级名称
+	TotalCoal       string `json:"total_coal" db:"total_coal,encrypted"`             // 煤炭消费总量，加密
+	RawCoal         string `json:"raw_coal" db:"raw_coal,encrypted"`                 // 原煤，加密
+	WashedCoal      string `json:"washed_coal" db:"washed_coal,encrypted"`           // 洗精煤，加密
+	OtherCoal       string `json:"other_coal" db:"other_coal,encrypted"`             // 其他煤炭，加密
+	PowerGeneration string `json:"power_generation" db:"power_generation,encrypted"` // 火力发电，加密
+	Heating         string `json:"heating" db:"heating,encrypted"`                   // 供热，加密
+	CoalWashing     string `json:"coal_washing" db:"coal_washing,encrypted"`         // 煤炭洗选，加密
+	Coking          string `json:"coking" db:"coking,encrypted"`                     // 炼焦，加密
+	OilRefining     string `json:"oil_refining" db:"oil_refining,encrypted"`         // 炼油及煤制油，加密
+	GasProduction   string `json:"gas_production" db:"gas_production,encrypted"`     // 制气，加密
+	Industry        string `json:"industry" db:"industry,encrypted"`                 // 工业，加密
+	RawMaterials    string `json:"raw_materials" db:"raw_materials,encrypted"`       // 用作原材料，加密
+	OtherUses       string `json:"other_uses" db:"other_uses,encrypted"`             // 其他用途，加密
+	Coke            string `json:"coke" db:"coke,encrypted"`                         // 焦炭，加密
+	CreateUser      string `json:"create_user" db:"create_user"`                     // 创建用户
+	CreateTime      int64  `json:"create_time" db:"create_time"`                     // 创建时间
+	IsConfirm       string `json:"is_confirm" db:"is_confirm,encrypted"`             // 是否确认，加密
+	IsCheck         string `json:"is_check" db:"is_check,encrypted"`                 // 是否校验，加密
+	FileHash        string `json:"file_hash" db:"file_hash"`                         // 源文件内容哈希
+}
+
+// TableName 表名
+func (CoalConsumptionReport) TableName() string { return "coal_consumption_report" }
+
+// DataImportRecord 导入记录
+type DataImportRecord struct {
+	ObjID       string `json:"obj_id" db:"obj_id"`             // 主键
+	FileName    string `json:"file_name" db:"file_name"`       // 导入文件名
+	FileType    string `json:"file_type" db:"file_type"`       // 文件类型
+	ImportTime  int64  `json:"import_time" db:"import_time"`   // 导入时间
+	ImportState string `json:"import_state" db:"import_state"` // 导入状态，导入成功，导入失败
+	Describe    string `json:"describe" db:"describe"`         // 说明
+	CreateUser  string `json:"create_user" db:"create_user"`   // 导入用户
+	FileHash    string `json:"file_hash" db:"file_hash"`       // 源文件内容哈希
+}
+
+// TableName 表名
+func (DataImportRecord) TableName() string { return "data_import_record" }
+
+// EnterpriseList 企业清单
+type EnterpriseList struct {
+	ObjID        string `json:"obj_id" db:"obj_id"`               // 主键
+	ProvinceName string `json:"province_name" db:"province_name"` // 单位省级名称
+	CityName     string `json:"city_name" db:"city_name"`         // 单位市级名称
+	CountryName  string `json:"country_name" db:"country_name"`   // 单位县级名称
+	UnitName     string `json:"unit_name" db:"unit_name"`         // 单位详细名称
+	CreditCode   string `json:"credit_code" db:"credit_code"`     // 统一社会信用代码
+}
+
+// TableName 表名
+func (EnterpriseList) TableName() string { return "enterprise_list" }
+
+// KeyEquipmentList 装置清单
+type KeyEquipmentList struct {
+	ObjID            string `json:"obj_id" db:"obj_id"`                         // 主键
+	ProvinceName     string `json:"province_name" db:"province_name"`           // 单位省级名称
+	CityName         string `json:"city_name" db:"city_name"`                   // 单位市级名称
+	CountryName      string `json:"country_name" db:"country_name"`             // 单位县级名称
+	UnitName         string `json:"unit_name" db:"unit_name"`                   // 单位详细名称
+	CreditCode       string `json:"credit_code" db:"credit_code"`               // 统一社会信用代码
+	EquipType        string `json:"equip_type" db:"equip_type"`                 // 设备类型
+	EquipModelNumber string `json:"equip_model_number" db:"equip_model_number"` // 设备型号
+	EquipNo          string `json:"equip_no" db:"equip_no"`                     // 设备编号
+}
+
+// TableName 表名
+func (KeyEquipmentList) TableName() string { return "key_equipment_list" }
@@ -0,0 +1,313 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cipher 加密字段的加解密方法，由应用提供SM4实现
+type Cipher interface {
+	SM4Encrypt(plaintext string) (string, error)
+	SM4Decrypt(ciphertext string) (string, error)
+}
+
+// modelField 模型字段与表字段的对应关系
+type modelField struct {
+	column    string
+	index     int
+	encrypted bool
+}
+
+// modelMeta 模型的表名和字段信息
+type modelMeta struct {
+	tableName string
+	fields    []modelField
+	columns   []string
+}
+
+// modelMetaCache 按模型类型缓存的字段信息
+var modelMetaCache sync.Map
+
+// getModelMeta 解析模型的db标签，db标签为"-"或为空的字段不对应表字段
+func getModelMeta(model Model) *modelMeta {
+	modelType := reflect.TypeOf(model)
+	if cached, ok := modelMetaCache.Load(modelType); ok {
+		return cached.(*modelMeta)
+	}
+
+	meta := &modelMeta{tableName: model.TableName()}
+	for i := 0; i < modelType.NumField(); i++ {
+		tag := modelType.Field(i).Tag.Get("db")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		column, option, _ := strings.Cut(tag, ",")
+		meta.fields = append(meta.fields, modelField{column: column, index: i, encrypted: option == "encrypted"})
+		meta.columns = append(meta.columns, column)
+	}
+	modelMetaCache.Store(modelType, meta)
+	return meta
+}
+
+// ModelColumns 获取模型对应的全部表字段
+func ModelColumns(model Model) []string {
+	return append([]string{}, getModelMeta(model).columns...)
+}
+
+// EncryptedColumns 获取模型中加密存储的表字段
+func EncryptedColumns(model Model) []string {
+	var columns []string
+	for _, field := range getModelMeta(model).fields {
+		if field.encrypted {
+			columns = append(columns, field.column)
+		}
+	}
+	return columns
+}
+
+// DecodeModel 将查询结果或解析结果的一行数据转换为模型，cipher不为空时解密加密字段。
+// 行中不存在的字段保持零值，类型不符的值按字段类型转换，无法转换时返回错误
+func DecodeModel[T Model](row map[string]interface{}, cipher Cipher) (T, error) {
+	var model T
+	meta := getModelMeta(model)
+	value := reflect.ValueOf(&model).Elem()
+
+	for _, field := range meta.fields {
+		raw, exists := row[field.column]
+		if !exists || raw == nil {
+			continue
+		}
+		target := value.Field(field.index)
+		switch target.Kind() {
+		case reflect.String:
+			text := formatModelValue(raw)
+			if field.encrypted && cipher != nil && text != "" {
+				decrypted, err := cipher.SM4Decrypt(text)
+				if err != nil {
+					return model, fmt.Errorf("表 %s 字段 %s 解密失败: %v", meta.tableName, field.column, err)
+				}
+				text = decrypted
+			}
+			target.SetString(text)
+		case reflect.Int, reflect.Int64:
+			number, err := parseModelInt(raw)
+			if err != nil {
+				return model, fmt.Errorf("表 %s 字段 %s 的值 %v 不是整数", meta.tableName, field.column, raw)
+			}
+			target.SetInt(number)
+		case reflect.Float64:
+			number, err := strconv.ParseFloat(formatModelValue(raw), 64)
+			if err != nil {
+				return model, fmt.Errorf("表 %s 字段 %s 的值 %v 不是数值", meta.tableName, field.column, raw)
+			}
+			target.SetFloat(number)
+		}
+	}
+	return model, nil
+}
+
+// EncodeModel 将模型转换为表字段和值，cipher不为空时加密加密字段，空值不加密
+func EncodeModel(model Model, cipher Cipher) (map[string]interface{}, error) {
+	meta := getModelMeta(model)
+	value := reflect.ValueOf(model)
+
+	row := make(map[string]interface{}, len(meta.fields))
+	for _, field := range meta.fields {
+		fieldValue := value.Field(field.index)
+		if fieldValue.Kind() != reflect.String {
+			row[field.column] = fieldValue.Interface()
+			continue
+		}
+
+		text := fieldValue.String()
+		if field.encrypted && cipher != nil && text != "" {
+			encrypted, err := cipher.SM4Encrypt(text)
+			if err != nil {
+				return nil, fmt.Errorf("表 %s 字段 %s 加密失败: %v", meta.tableName, field.column, err)
+			}
+			text = encrypted
+		}
+		row[field.column] = text
+	}
+	return row, nil
+}
+
+// formatModelValue 将数据库或Excel中的值转换为字符串
+func formatModelValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// parseModelInt 将数据库或Excel中的值转换为整数，时间按毫秒时间戳转换
+func parseModelInt(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	case time.Time:
+		return v.UnixMilli(), nil
+	}
+
+	text := strings.TrimSpace(formatModelValue(value))
+	if text == "" {
+		return 0, nil
+	}
+	if number, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return number, nil
+	}
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(number), nil
+}
+
+// IntValue 将查询结果中的计数、汇总等值转换为整数，空值或无法转换时返回0
+func IntValue(value interface{}) int64 {
+	if value == nil {
+		return 0
+	}
+	number, err := parseModelInt(value)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// Repository 数据表的类型化访问，读取时解密、写入时加密模型中标记为encrypted的字段
+type Repository[T Model] struct {
+	db     *Database
+	cipher Cipher
+	meta   *modelMeta
+}
+
+// NewRepository 创建数据表的类型化访问，cipher为空时不加解密
+func NewRepository[T Model](database *Database, cipher Cipher) *Repository[T] {
+	var model T
+	return &Repository[T]{db: database, cipher: cipher, meta: getModelMeta(model)}
+}
+
+// TableName 表名
+func (r *Repository[T]) TableName() string {
+	return r.meta.tableName
+}
+
+// buildWhere 拼接查询条件
+func buildWhere(where string) string {
+	if where == "" {
+		return ""
+	}
+	return " WHERE " + where
+}
+
+// Find 按条件查询记录，where为空时查询全部记录，可在条件后追加ORDER BY
+func (r *Repository[T]) Find(where string, args ...interface{}) ([]T, error) {
+	var records []T
+	query := fmt.Sprintf("SELECT * FROM %s%s", r.meta.tableName, buildWhere(where))
+	err := r.db.QueryEach(query, func(row map[string]interface{}) error {
+		record, err := DecodeModel[T](row, r.cipher)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+		return nil
+	}, args...)
+	return records, err
+}
+
+// FindOne 按条件查询一条记录，不存在时返回false
+func (r *Repository[T]) FindOne(where string, args ...interface{}) (T, bool, error) {
+	var record T
+	records, err := r.Find(where+" LIMIT 1", args...)
+	if err != nil || len(records) == 0 {
+		return record, false, err
+	}
+	return records[0], true, nil
+}
+
+// Count 按条件统计记录数，where为空时统计全部记录
+func (r *Repository[T]) Count(where string, args ...interface{}) (int64, error) {
+	query := fmt.Sprintf("SELECT COUNT(1) AS count FROM %s%s", r.meta.tableName, buildWhere(where))
+	result, err := r.db.QueryRow(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	row, _ := result.Data.(map[string]interface{})
+	return parseModelInt(row["count"])
+}
+
+// encodeRecords 将记录转换为表字段和值，加密字段在此加密
+func (r *Repository[T]) encodeRecords(records []T) ([]map[string]interface{}, error) {
+	rows := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		row, err := EncodeModel(record, r.cipher)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Insert 插入单条记录
+func (r *Repository[T]) Insert(record T) error {
+	row, err := EncodeModel(record, r.cipher)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Insert(r.meta.tableName, row)
+	return err
+}
+
+// InsertTx 在调用方的事务中批量插入记录，任一行失败即返回错误，由调用方回滚整个事务
+func (r *Repository[T]) InsertTx(tx *sql.Tx, records []T, batchSize int) error {
+	rows, err := r.encodeRecords(records)
+	if err != nil {
+		return err
+	}
+	result, err := BatchInsertTx(tx, r.meta.tableName, rows, batchSize)
+	return batchResultError(result, err)
+}
+
+// UpsertTx 在调用方的事务中批量插入或更新记录，任一行失败即返回错误，由调用方回滚整个事务
+func (r *Repository[T]) UpsertTx(tx *sql.Tx, records []T, options UpsertOptions, batchSize int) error {
+	rows, err := r.encodeRecords(records)
+	if err != nil {
+		return err
+	}
+	result, err := BatchUpsertTx(tx, r.meta.tableName, rows, options, batchSize)
+	return batchResultError(result, err)
+}
+
+// batchResultError 将批量写入的失败行转换为错误
+func batchResultError(result BatchInsertResult, err error) error {
+	if err != nil {
+		return err
+	}
+	if result.FailedRows > 0 {
+		return fmt.Errorf("%s", strings.Join(result.Errors, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"shuji/data_import"
+	"shuji/db"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// 比对的两个数据库在字段差异中的来源标识，取值顺序为[数据库A, 数据库B]
+var compareSources = []string{"A", "B"}
+
+// CompareRecord 数据库比对中的一条记录
+type CompareRecord struct {
+	Key    string                       `json:"key"`     // 匹配键，与合并冲突检查的冲突键一致
+	Name   string                       `json:"name"`    // 单位名称或项目名称
+	ObjIds []string                     `json:"obj_ids"` // 记录的obj_id，变更的记录为数据库B中的obj_id
+	Fields []data_import.MergeFieldDiff `json:"fields"`  // 取值不同的字段（已解密），取值顺序为[数据库A, 数据库B]
+}
+
+// TableCompareResult 单个数据表的比对结果
+type TableCompareResult struct {
+	TableType      string          `json:"tableType"`      // 表类型
+	Added          []CompareRecord `json:"added"`          // 只在数据库B中存在的记录
+	Removed        []CompareRecord `json:"removed"`        // 只在数据库A中存在的记录
+	Changed        []CompareRecord `json:"changed"`        // 两个数据库中都存在但内容不同的记录
+	UnchangedCount int             `json:"unchangedCount"` // 内容相同的记录数
+}
+
+// compareKeyInfo 比对键在单个数据库中的记录
+type compareKeyInfo struct {
+	Name   string
+	ObjIds []string
+}
+
+// CompareDatabases 比较两个数据库，按合并冲突检查使用的匹配键列出数据库B相对数据库A新增、删除和变更的记录
+func (a *App) CompareDatabases(pathA string, pathB string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.compareDatabasesWithRecover(pathA, pathB)
+}
+
+// compareDatabasesWithRecover 带异常处理的数据库比对函数
+func (a *App) compareDatabasesWithRecover(pathA string, pathB string) db.QueryResult {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("CompareDatabases 发生异常: %v", r)
+		}
+	}()
+
+	tables, err := a.compareDatabases(pathA, pathB)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+
+	addedCount, removedCount, changedCount := 0, 0, 0
+	for _, table := range tables {
+		addedCount += len(table.Added)
+		removedCount += len(table.Removed)
+		changedCount += len(table.Changed)
+	}
+
+	return db.QueryResult{
+		Ok:      true,
+		Message: fmt.Sprintf("比对完成。新增: %d 条，删除: %d 条，变更: %d 条", addedCount, removedCount, changedCount),
+		Data: map[string]interface{}{
+			"pathA":        pathA,
+			"pathB":        pathB,
+			"tables":       tables,
+			"addedCount":   addedCount,
+			"removedCount": removedCount,
+			"changedCount": changedCount,
+		},
+	}
+}
+
+// ExportDatabaseComparison 比较两个数据库并将比对结果导出为Excel文件
+func (a *App) ExportDatabaseComparison(pathA string, pathB string, filePath string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.exportDatabaseComparisonWithRecover(pathA, pathB, filePath)
+}
+
+// exportDatabaseComparisonWithRecover 带异常处理的比对结果导出函数
+func (a *App) exportDatabaseComparisonWithRecover(pathA string, pathB string, filePath string) db.QueryResult {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ExportDatabaseComparison 发生异常: %v", r)
+		}
+	}()
+
+	result := db.QueryResult{}
+
+	tables, err := a.compareDatabases(pathA, pathB)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	f := excelize.NewFile()
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Printf("关闭Excel文件失败: %v", err)
+		}
+	}()
+
+	if err := a.createCompareSheet(f, pathA, pathB, tables); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	if err := f.SaveAs(filePath); err != nil {
+		if strings.Contains(err.Error(), "used by another process") {
+			result.Message = "保存Excel文件失败: 文件已被其他程序占用，请关闭文件后重试"
+			return result
+		}
+		result.Message = "保存Excel文件失败: " + err.Error()
+		return result
+	}
+
+	result.Ok = true
+	result.Message = "导出成功"
+	result.Data = map[string]interface{}{
+		"outputPath": filePath,
+		"fileName":   filepath.Base(filePath),
+	}
+	return result
+}
+
+// compareDatabases 复制两个数据库到临时文件后逐表比对，报送数据包先校验签名
+func (a *App) compareDatabases(pathA string, pathB string) ([]TableCompareResult, error) {
+	var databases []*db.Database
+	var tempPaths []string
+	defer func() {
+		for _, database := range databases {
+			database.Close()
+		}
+		for _, path := range tempPaths {
+			a.Removefile(path)
+		}
+	}()
+
+	now := time.Now().Unix()
+	for i, path := range []string{pathA, pathB} {
+		dstPath := GetPath(filepath.Join(DATA_DIR_NAME, "compare_"+strconv.FormatInt(now+int64(i), 16)))
+		if _, err := a.prepareMergeSource(path, dstPath); err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Base(path), err)
+		}
+		tempPaths = append(tempPaths, dstPath)
+
+		database, err := db.NewReadOnlyDatabase(dstPath, EXCHANGE_DB_PASSWORD)
+		if err != nil {
+			return nil, fmt.Errorf("打开数据库失败: %s, %v", filepath.Base(path), err)
+		}
+		databases = append(databases, database)
+	}
+
+	tables := make([]TableCompareResult, 0, len(mergeTableSpecs))
+	for _, spec := range mergeTableSpecs {
+		table, err := a.compareTable(spec, databases)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// indexCompareKeys 读取数据表的匹配键，不加载整行数据
+func indexCompareKeys(spec mergeTableSpec, database *db.Database) (map[string]*compareKeyInfo, error) {
+	index := make(map[string]*compareKeyInfo)
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(spec.indexColumns(), ", "), spec.TableName)
+	err := database.QueryEach(query, func(row map[string]interface{}) error {
+		key := spec.keyOf(row)
+		if index[key] == nil {
+			index[key] = &compareKeyInfo{}
+			if spec.NameField != "" {
+				index[key].Name = getStringValue(row[spec.NameField])
+			}
+		}
+		index[key].ObjIds = append(index[key].ObjIds, getStringValue(row["obj_id"]))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取%s失败: %v", spec.TableName, err)
+	}
+	return index, nil
+}
+
+// queryCompareRows 按obj_id读取记录的完整数据
+func queryCompareRows(spec mergeTableSpec, database *db.Database, objIds []string) ([]map[string]interface{}, error) {
+	args := make([]interface{}, 0, len(objIds))
+	for _, objID := range objIds {
+		args = append(args, objID)
+	}
+	query := fmt.Sprintf("SELECT * FROM %s WHERE obj_id IN (%s)", spec.TableName, strings.TrimSuffix(strings.Repeat("?,", len(args)), ","))
+	result, err := database.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("读取%s失败: %v", spec.TableName, err)
+	}
+	if result.Data == nil {
+		return nil, nil
+	}
+	return result.Data.([]map[string]interface{}), nil
+}
+
+// compareTable 比对单个数据表，两个数据库都存在的记录比较主表和扩展表的解密字段
+func (a *App) compareTable(spec mergeTableSpec, databases []*db.Database) (TableCompareResult, error) {
+	table := TableCompareResult{
+		TableType: spec.TableType,
+		Added:     []CompareRecord{},
+		Removed:   []CompareRecord{},
+		Changed:   []CompareRecord{},
+	}
+
+	indexA, err := indexCompareKeys(spec, databases[0])
+	if err != nil {
+		return table, err
+	}
+	indexB, err := indexCompareKeys(spec, databases[1])
+	if err != nil {
+		return table, err
+	}
+
+	keys := make([]string, 0, len(indexA)+len(indexB))
+	for key := range indexA {
+		keys = append(keys, key)
+	}
+	for key := range indexB {
+		if indexA[key] == nil {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		infoA, infoB := indexA[key], indexB[key]
+		switch {
+		case infoA == nil:
+			table.Added = append(table.Added, CompareRecord{Key: key, Name: infoB.Name, ObjIds: infoB.ObjIds})
+		case infoB == nil:
+			table.Removed = append(table.Removed, CompareRecord{Key: key, Name: infoA.Name, ObjIds: infoA.ObjIds})
+		default:
+			rowsA, err := queryCompareRows(spec, databases[0], infoA.ObjIds)
+			if err != nil {
+				return table, err
+			}
+			rowsB, err := queryCompareRows(spec, databases[1], infoB.ObjIds)
+			if err != nil {
+				return table, err
+			}
+
+			childRowsA, err := queryMergeChildRows(spec.TableType, databases[0], infoA.ObjIds)
+			if err != nil {
+				return table, err
+			}
+			childRowsB, err := queryMergeChildRows(spec.TableType, databases[1], infoB.ObjIds)
+			if err != nil {
+				return table, err
+			}
+
+			fileRows := map[string][]map[string]interface{}{compareSources[0]: rowsA, compareSources[1]: rowsB}
+			childRows := map[string]mergeChildRows{compareSources[0]: childRowsA, compareSources[1]: childRowsB}
+			candidates := a.buildMergeCandidates(spec.TableType, fileRows, childRows, compareSources)
+			diffs := a.diffMergeCandidates(spec.TableType, candidates)
+			if len(diffs) == 0 {
+				table.UnchangedCount++
+				continue
+			}
+			table.Changed = append(table.Changed, CompareRecord{Key: key, Name: infoB.Name, ObjIds: infoB.ObjIds, Fields: diffs})
+		}
+	}
+
+	return table, nil
+}
+
+// createCompareSheet 创建比对结果sheet，新增和删除的记录每条一行，变更的记录每个差异字段一行
+func (a *App) createCompareSheet(f *excelize.File, pathA string, pathB string, tables []TableCompareResult) error {
+	sheetName := "数据比对结果"
+	f.SetSheetName("Sheet1", sheetName)
+
+	f.SetCellValue(sheetName, "A1", fmt.Sprintf("数据库A: %s", filepath.Base(pathA)))
+	f.SetCellValue(sheetName, "A2", fmt.Sprintf("数据库B: %s", filepath.Base(pathB)))
+	f.MergeCell(sheetName, "A1", "I1")
+	f.MergeCell(sheetName, "A2", "I2")
+
+	headers := []string{"数据表", "变化类型", "匹配键", "名称", "所属表格", "行标识", "字段", "数据库A取值", "数据库B取值"}
+	headerStyle, err := createHeaderStyle(f)
+	if err != nil {
+		return fmt.Errorf("创建样式失败: %v", err)
+	}
+	dataStyle, err := createDataStyle(f)
+	if err != nil {
+		return fmt.Errorf("创建样式失败: %v", err)
+	}
+	for i, header := range headers {
+		cellName, _ := excelize.CoordinatesToCellName(i+1, 3)
+		f.SetCellValue(sheetName, cellName, header)
+		f.SetCellStyle(sheetName, cellName, cellName, headerStyle)
+	}
+
+	rowIndex := 4
+	writeRow := func(values ...interface{}) {
+		for col, value := range values {
+			cellName, _ := excelize.CoordinatesToCellName(col+1, rowIndex)
+			f.SetCellValue(sheetName, cellName, value)
+		}
+		startCell, _ := excelize.CoordinatesToCellName(1, rowIndex)
+		endCell, _ := excelize.CoordinatesToCellName(len(headers), rowIndex)
+		f.SetCellStyle(sheetName, startCell, endCell, dataStyle)
+		rowIndex++
+	}
+
+	for _, table := range tables {
+		tableName := getTableTypeName(table.TableType)
+		for _, record := range table.Added {
+			writeRow(tableName, "新增", record.Key, record.Name)
+		}
+		for _, record := range table.Removed {
+			writeRow(tableName, "删除", record.Key, record.Name)
+		}
+		for _, record := range table.Changed {
+			for _, field := range record.Fields {
+				valueA, valueB := "", ""
+				if len(field.Values) == 2 {
+					valueA, valueB = field.Values[0], field.Values[1]
+				}
+				writeRow(tableName, "变更", record.Key, record.Name, field.Section, field.RowKey, field.Label, valueA, valueB)
+			}
+		}
+	}
+
+	// 设置列宽
+	f.SetColWidth(sheetName, "A", "B", 12) // 数据表、变化类型
+	f.SetColWidth(sheetName, "C", "D", 30) // 匹配键、名称
+	f.SetColWidth(sheetName, "E", "G", 20) // 所属表格、行标识、字段
+	f.SetColWidth(sheetName, "H", "I", 30) // 取值
+
+	return nil
+}
+
+// getTableTypeName 获取表类型的显示名称
+func getTableTypeName(tableType string) string {
+	switch tableType {
+	case TableType1:
+		return TableName1
+	case TableType2:
+		return TableName2
+	case TableType3:
+		return TableName3
+	case TableTypeAttachment2:
+		return TableAttachment2
+	}
+	return tableType
+}
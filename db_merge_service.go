@@ -2,10 +2,13 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"path/filepath"
+	"shuji/data_import"
 	"shuji/db"
+	"slices"
 	"strings"
 	"strconv"
 	"time"
@@ -22,6 +25,66 @@ type MergeResult struct {
 	ErrorCount    int    `json:"errorCount"`
 }
 
+// addRows 累计逐行写入的成功、失败行数，记录最后一条错误信息
+func (r *MergeResult) addRows(rowsResult db.BatchInsertResult, message string) {
+	r.SuccessCount += int(rowsResult.SuccessRows)
+	r.ErrorCount += int(rowsResult.FailedRows)
+	if len(rowsResult.Errors) > 0 {
+		r.Message = message + rowsResult.Errors[len(rowsResult.Errors)-1]
+	}
+}
+
+// mergeTableModels 合并写入的数据表及其模型
+var mergeTableModels = map[string]db.Model{
+	"enterprise_coal_consumption_main":    db.EnterpriseCoalConsumptionMain{},
+	"enterprise_coal_consumption_usage":   db.EnterpriseCoalConsumptionUsage{},
+	"enterprise_coal_consumption_equip":   db.EnterpriseCoalConsumptionEquip{},
+	"critical_coal_equipment_consumption": db.CriticalCoalEquipmentConsumption{},
+	"fixed_assets_investment_project":     db.FixedAssetsInvestmentProject{},
+	"coal_consumption_report":             db.CoalConsumptionReport{},
+}
+
+// getMergeTableColumns 合并时写入目标数据库的字段，源文件归档只存在于源库所在机器，不合并file_hash。
+// 加密字段按源库密文原样写入
+func getMergeTableColumns(tableName string) []string {
+	model, exists := mergeTableModels[tableName]
+	if !exists {
+		return nil
+	}
+	return slices.DeleteFunc(db.ModelColumns(model), func(column string) bool {
+		return column == "file_hash"
+	})
+}
+
+// mergeRowsTx 在合并事务中逐行写入源数据，逐行写入用于统计失败的行数和原因，有失败的行时调用方回滚整个合并。
+// 有自然键的表按自然键插入或更新，冲突时以源数据为准，包括obj_id、create_time、create_user
+func mergeRowsTx(tx *sql.Tx, tableName string, rows []map[string]interface{}) db.BatchInsertResult {
+	columns := getMergeTableColumns(tableName)
+	dataList := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		data := make(map[string]interface{}, len(columns))
+		for _, column := range columns {
+			data[column] = row[column]
+		}
+		dataList = append(dataList, data)
+	}
+
+	var result db.BatchInsertResult
+	var err error
+	if key, exists := data_import.GetNaturalKey(tableName); exists {
+		if err = key.CheckIndexTx(tx); err == nil {
+			result, err = db.BatchUpsertTx(tx, tableName, dataList, key.UpsertOptions(), 1)
+		}
+	} else {
+		result, err = db.BatchInsertTx(tx, tableName, dataList, 1)
+	}
+	if err != nil {
+		result.FailedRows = int64(len(dataList))
+		result.Errors = append(result.Errors, err.Error())
+	}
+	return result
+}
+
 // ConflictInfo 冲突信息结构
 type ConflictInfo struct {
 	HasConflict          bool              `json:"hasConflict"`
@@ -38,6 +101,7 @@ type TableConflictInfo struct {
 	FileNames     []string         `json:"fileNames"`
 	ConflictCount int              `json:"conflictCount"`
 	Conflicts     []ConflictDetail `json:"conflicts"`
+	Resolutions   []MergeResolution `json:"resolutions"` // 按合并策略自动处理的冲突
 }
 
 // ConflictDetail 冲突详情
@@ -53,6 +117,7 @@ type ConflictDetail struct {
 	CityName       string               `json:"city_name,omitempty"`
 	CountryName    string               `json:"country_name,omitempty"`
 	Conflict       []ConflictSourceInfo `json:"conflict"`
+	Fields         []data_import.MergeFieldDiff `json:"fields"` // 各来源取值不同的字段（已解密），取值顺序与Conflict一致
 }
 
 // ConflictSourceInfo 冲突源信息
@@ -84,15 +149,22 @@ type Condition struct {
 // MergeDatabase 合并数据库
 func (a *App) MergeDatabase(province string, city string, country string, sourceDbPath []string) db.QueryResult {
 	// 使用包装函数来处理异常
-	return a.mergeDatabaseWithRecover(province, city, country, sourceDbPath)
+	return a.mergeDatabaseWithRecover(province, city, country, sourceDbPath, MergePolicy{Strategy: MergeStrategyManual})
+}
+
+// MergeDatabaseWithPolicy 按冲突处理策略合并数据库，无法自动处理的冲突仍由用户选择
+func (a *App) MergeDatabaseWithPolicy(province string, city string, country string, sourceDbPath []string, policy MergePolicy) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.mergeDatabaseWithRecover(province, city, country, sourceDbPath, policy)
 }
 
 // mergeDatabaseWithRecover 带异常处理的合并数据库函数
-func (a *App) mergeDatabaseWithRecover(province string, city string, country string, sourceDbPath []string) db.QueryResult {
+func (a *App) mergeDatabaseWithRecover(province string, city string, country string, sourceDbPath []string, policy MergePolicy) (result db.QueryResult) {
 	// 添加异常处理，防止函数崩溃
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("MergeDatabase 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("合并数据库发生异常: %v", r)}
 		}
 	}()
 
@@ -102,37 +174,87 @@ func (a *App) mergeDatabaseWithRecover(province string, city string, country str
 		CountryName: country,
 	}
 
-	result := db.QueryResult{
+	result = db.QueryResult{
 		Ok: false,
 	}
 
+	// 1. 同一时间只允许一个合并任务，合并过程中可以取消
+	ctx, finish, err := a.startMergeTask()
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	defer finish()
+	defer a.emitMergeProgress(MergeProgress{Stage: MERGE_STAGE_DONE, Total: len(sourceDbPath)})
+
 	// 2. 创建新的空数据库并初始化表结构
 	newDb, dbTempPath, err := a.CreateNewDatabase("merge_")
 	if err != nil {
 		result.Message = "创建新数据库失败: " + err.Error()
 		return result
 	}
-	defer newDb.Close()
 
-	// 3. 复制源数据库到临时文件并打开数据库连接
 	var sourceDbs []*db.Database
 	var sourceDbPaths []string
+
+	// 无论合并成功、失败还是取消，都关闭连接并删除源临时文件，合并失败时同时删除目标数据库临时文件
+	defer func() {
+		for i, sourceDb := range sourceDbs {
+			sourceDb.Close()
+			fmt.Printf("关闭源数据库连接: %s\n", sourceDbPaths[i])
+		}
+		for _, path := range sourceDbPaths {
+			a.Removefile(path)
+		}
+		newDb.Close()
+		if !result.Ok {
+			a.Removefile(dbTempPath)
+		}
+	}()
+
+	// 3. 复制源数据库到临时文件并打开数据库连接
 	var originalSourcePaths []string
 	var failedFiles []string
+	failedMessages := make(map[string]string) // key: 文件路径, value: 失败原因
+	signers := make(map[string]SubmissionSigner) // key: 报送数据包路径, value: 签名者
+	untrustedSigners := make(map[string]*UntrustedSignerError) // key: 报送数据包路径, value: 未登记的签名者
 
 	now := time.Now().Unix()
 	for i, sourceDbPath := range sourceDbPath {
+		if err := checkMergeCanceled(ctx); err != nil {
+			result.Message = err.Error()
+			return result
+		}
+		a.emitMergeProgress(MergeProgress{Stage: MERGE_STAGE_COPY, FileName: filepath.Base(sourceDbPath), Current: i + 1, Total: len(sourceDbPath)})
+
 		dbDstPath := GetPath(filepath.Join(DATA_DIR_NAME,  strconv.FormatInt(now + int64(i), 16)))
-		copyResult := a.Copyfile(sourceDbPath, dbDstPath)
-		if !copyResult.Ok {
+		// 报送数据包先校验签名和完整性，校验通过后才读取数据
+		signer, err := a.prepareMergeSource(sourceDbPath, dbDstPath)
+		if err != nil {
 			failedFiles = append(failedFiles, sourceDbPath)
+			failedMessages[sourceDbPath] = err.Error()
+			var untrusted *UntrustedSignerError
+			if errors.As(err, &untrusted) {
+				untrustedSigners[sourceDbPath] = untrusted
+			}
 			continue
 		}
+		if signer != nil {
+			signers[sourceDbPath] = *signer
+		}
 
 		// 创建数据库连接
-		sourceDb, err := db.NewDatabase(dbDstPath, DB_PASSWORD)
+		sourceDb, err := db.NewReadOnlyDatabase(dbDstPath, EXCHANGE_DB_PASSWORD)
 		if err != nil {
+			a.Removefile(dbDstPath)
+			failedFiles = append(failedFiles, sourceDbPath)
+			continue
+		}
+		if getExportMode(sourceDb) == EXPORT_MODE_DELTA {
+			sourceDb.Close()
+			a.Removefile(dbDstPath)
 			failedFiles = append(failedFiles, sourceDbPath)
+			failedMessages[sourceDbPath] = "增量导出的数据文件请使用增量合并"
 			continue
 		}
 
@@ -144,213 +266,128 @@ func (a *App) mergeDatabaseWithRecover(province string, city string, country str
 	// 如果没有成功打开任何数据库文件，则返回错误
 	if len(sourceDbs) == 0 {
 		result.Message = fmt.Sprintf("所有数据库文件打开失败: %v", failedFiles)
-		// 删除所有数据库文件
-		a.Removefile(dbTempPath)
-		for i := range sourceDbPaths {
-			a.Removefile(sourceDbPaths[i])
-		}
+		result.Data = map[string]interface{}{"failedMessages": failedMessages, "untrustedSigners": untrustedSigners}
 		return result
 	}
 
-	// 4. 检查数据冲突（只在上传文件之间检查冲突）
-	// 检查表1冲突（规上企业煤炭消费信息主表）
-	table1Conflicts, table1NonConflictData, err := a.checkTable1Conflicts(sourceDbs, originalSourcePaths, areaConfig)
-	if err != nil {
-		result.Message = err.Error()
-		return result
-	}
-	table1ConflictCount := len(table1Conflicts.Conflicts)
-
-	// 检查表2冲突（重点耗煤装置煤炭消耗信息表）
-	table2Conflicts, table2NonConflictData, err := a.checkTable2Conflicts(sourceDbs, originalSourcePaths, areaConfig)
-	if err != nil {
-		result.Message = err.Error()
-		return result
-	}
-	table2ConflictCount := len(table2Conflicts.Conflicts)
-
-	// 检查表3冲突（固定资产投资项目节能审查煤炭消费情况汇总表）
-	table3Conflicts, table3NonConflictData := a.checkTable3Conflicts(sourceDbs, originalSourcePaths)
-	table3ConflictCount := len(table3Conflicts.Conflicts)
-
-	// 检查附件2冲突（煤炭消费状况表）
-	attachment2Conflicts, attachment2NonConflictData, err := a.checkAttachment2Conflicts(sourceDbs, originalSourcePaths, areaConfig)
-	if err != nil {
-		result.Message = err.Error()
-		return result
+	// 4. 检查数据冲突（只在上传文件之间检查冲突），只读取冲突键，不加载整表数据
+	plans := make(map[string]mergeTablePlan)
+	totalConflictCount := 0
+	for _, spec := range mergeTableSpecs {
+		plan, err := a.planMergeTable(ctx, spec, sourceDbs, originalSourcePaths, areaConfig, policy)
+		if err != nil {
+			result.Message = err.Error()
+			return result
+		}
+		plans[spec.TableType] = plan
+		totalConflictCount += plan.Conflicts.ConflictCount
 	}
-	attachment2ConflictCount := len(attachment2Conflicts.Conflicts)
-
-	totalConflictCount := table1ConflictCount + table2ConflictCount + table3ConflictCount + attachment2ConflictCount
 
-	// 5. 记录冲突信息（如果有冲突）
-	var conflictInfo map[string]interface{}
-	if totalConflictCount > 0 {
-		conflictInfo = map[string]interface{}{
-			"hasConflict": true,
-			"table1Conflicts": map[string]interface{}{
-				"conflicts":     table1Conflicts.Conflicts,
-				"conflictCount": table1ConflictCount,
-				"fileNames":     table1Conflicts.FileNames,
-			},
-			"table2Conflicts": map[string]interface{}{
-				"conflicts":     table2Conflicts.Conflicts,
-				"conflictCount": table2ConflictCount,
-				"fileNames":     table2Conflicts.FileNames,
-			},
-			"table3Conflicts": map[string]interface{}{
-				"conflicts":     table3Conflicts.Conflicts,
-				"conflictCount": table3ConflictCount,
-				"fileNames":     table3Conflicts.FileNames,
-			},
-			"attachment2Conflicts": map[string]interface{}{
-				"conflicts":     attachment2Conflicts.Conflicts,
-				"conflictCount": attachment2ConflictCount,
-				"fileNames":     attachment2Conflicts.FileNames,
-			},
-			"totalConflictCount": totalConflictCount,
-		}
-	}
-
-	// 6. 如果没有冲突，执行数据合并（使用事务）
-	successCount := 0
-	errorCount := 0
-
-	// 开始事务
+	// 5. 在事务中流式写入非冲突数据和按策略保留的冲突数据
 	tx, err := newDb.Begin()
 	if err != nil {
 		result.Message = "开始事务失败: " + err.Error()
-		// 先关闭所有源数据库连接
-		for i, sourceDb := range sourceDbs {
-			if sourceDb != nil {
-				sourceDb.Close()
-				fmt.Printf("事务失败关闭源数据库连接: %s\n", sourceDbPaths[i])
-			}
-		}
-		// 删除所有数据库文件
-		a.Removefile(dbTempPath)
-		for i := range sourceDbPaths {
-			a.Removefile(sourceDbPaths[i])
-		}
 		return result
 	}
-
-	// 确保事务回滚（如果出错）
-	var txErr error
+	committed := false
 	defer func() {
-		if txErr != nil {
+		if !committed {
 			tx.Rollback()
-			// 先关闭所有源数据库连接
-			for i, sourceDb := range sourceDbs {
-				if sourceDb != nil {
-					sourceDb.Close()
-					fmt.Printf("事务回滚关闭源数据库连接: %s\n", sourceDbPaths[i])
-				}
-			}
-			// 事务回滚时删除所有临时文件（因为事务失败，没有成功导入数据）
-			a.Removefile(dbTempPath)
-			for i := range sourceDbPaths {
-				a.Removefile(sourceDbPaths[i])
-			}
 		}
 	}()
 
-	// 统计实际冲突数量
-	actualConflictCount := 0
-
-	// 合并所有表的数据（现在只在上传文件之间检查冲突，所有数据都可以合并）
-	// 对于有文件间冲突的数据，我们需要处理冲突，这里先合并非冲突数据
-	table1Result := a.mergeTable1DataWithTx(tx, table1NonConflictData, sourceDbs, originalSourcePaths)
-	if table1Result.Ok {
-		successCount += table1Result.SuccessCount
-		actualConflictCount += table1Result.ConflictCount
-	} else {
-		errorCount += table1Result.ErrorCount
-	}
-
-	table2Result := a.mergeTable2DataWithTx(tx, table2NonConflictData)
-	if table2Result.Ok {
-		successCount += table2Result.SuccessCount
-		actualConflictCount += table2Result.ConflictCount
-	} else {
-		errorCount += table2Result.ErrorCount
+	// 记录每条合并数据的来源数据库
+	sourceInfos := make(map[string]mergeSourceInfo)
+	for i, sourceDb := range sourceDbs {
+		sourceInfos[originalSourcePaths[i]] = a.getMergeSourceInfo(sourceDb, originalSourcePaths[i])
 	}
 
-	table3Result := a.mergeTable3DataWithTx(tx, table3NonConflictData)
-	if table3Result.Ok {
-		successCount += table3Result.SuccessCount
-		actualConflictCount += table3Result.ConflictCount
-	} else {
-		errorCount += table3Result.ErrorCount
+	successCount := 0
+	errorCount := 0
+	var errorMessages []string
+	var resolutions []MergeResolution
+	for _, spec := range mergeTableSpecs {
+		plan := plans[spec.TableType]
+		tableResult, err := a.streamMergeTable(ctx, tx, spec, plan, sourceDbs, originalSourcePaths, sourceInfos)
+		if err != nil {
+			result.Message = err.Error()
+			return result
+		}
+		successCount += tableResult.SuccessCount
+		errorCount += tableResult.ErrorCount
+		if tableResult.Message != "" {
+			errorMessages = append(errorMessages, tableResult.Message)
+		}
+		resolutions = append(resolutions, plan.Conflicts.Resolutions...)
 	}
 
-	attachment2Result := a.mergeAttachment2DataWithTx(tx, attachment2NonConflictData)
-	if attachment2Result.Ok {
-		successCount += attachment2Result.SuccessCount
-		actualConflictCount += attachment2Result.ConflictCount
-	} else {
-		errorCount += attachment2Result.ErrorCount
+	// 有数据写入失败时不提交，避免合并结果缺少部分数据
+	if errorCount > 0 {
+		result.Message = fmt.Sprintf("合并失败，%d 条数据写入失败，未合并任何数据: %s", errorCount, strings.Join(errorMessages, "；"))
+		result.Data = map[string]interface{}{
+			"errorCount":     errorCount,
+			"errorMessages":  errorMessages,
+			"failedFiles":    failedFiles,
+			"failedMessages": failedMessages,
+		}
+		return result
 	}
 
-	// 提交事务
-	txErr = tx.Commit()
-	if txErr != nil {
-		result.Message = "提交事务失败: " + txErr.Error()
-		// 先关闭所有源数据库连接
-		for i, sourceDb := range sourceDbs {
-			if sourceDb != nil {
-				sourceDb.Close()
-				fmt.Printf("事务提交失败关闭源数据库连接: %s\n", sourceDbPaths[i])
-			}
-		}
-		// 事务提交失败时删除所有临时文件
-		a.Removefile(dbTempPath)
-		for i := range sourceDbPaths {
-			a.Removefile(sourceDbPaths[i])
-		}
+	// 在合并后的数据库中记录按策略自动处理的冲突
+	if err := a.insertMergeLogs(tx, resolutions); err != nil {
+		result.Message = err.Error()
 		return result
 	}
 
-	// 先关闭所有源数据库连接，然后删除源临时数据库文件
-	for i, sourceDb := range sourceDbs {
-		if sourceDb != nil {
-			sourceDb.Close()
-			fmt.Printf("关闭源数据库连接: %s\n", sourceDbPaths[i])
-		}
+	// 提交前再次检查，取消后不提交已写入的数据
+	if err := checkMergeCanceled(ctx); err != nil {
+		result.Message = err.Error()
+		return result
 	}
 
-	// 删除源临时数据库文件
-	for i := range sourceDbPaths {
-		a.Removefile(sourceDbPaths[i])
+	// 提交事务
+	if err := tx.Commit(); err != nil {
+		result.Message = "提交事务失败: " + err.Error()
+		return result
 	}
+	committed = true
 
 	// 只有在完全没有成功导入数据时才删除目标数据库临时文件
 	// 即使存在冲突也不删除，因为用户可能需要通过冲突解决界面确认是否覆盖
 	if successCount == 0 && totalConflictCount == 0 {
+		newDb.Close()
 		a.Removefile(dbTempPath)
 	}
 
-	// 8. 返回合并结果
+	// 6. 返回合并结果
 	result.Ok = true
 	result.Message = fmt.Sprintf("数据库合并完成。成功合并: %d 条数据，错误: %d 条，冲突: %d 条", successCount, errorCount, totalConflictCount)
-	result.Data = map[string]interface{}{
+	resultData := map[string]interface{}{
 		"successCount":       successCount,
 		"errorCount":         errorCount,
 		"totalConflictCount": totalConflictCount,
 		"failedFiles":        failedFiles,
+		"failedMessages":     failedMessages,
+		"signers":            signers,
+		"untrustedSigners":   untrustedSigners,
 		"targetDbPath":       dbTempPath,
+		"mergePolicy":        policy,
+		"resolutions":        resolutions,
 	}
 
 	// 如果有冲突信息，添加到返回结果中
-	if conflictInfo != nil {
-		// 合并冲突信息到现有结果中，而不是替换
-		if resultData, ok := result.Data.(map[string]interface{}); ok {
-			for key, value := range conflictInfo {
-				resultData[key] = value
+	if totalConflictCount > 0 {
+		resultData["hasConflict"] = true
+		for _, spec := range mergeTableSpecs {
+			conflicts := plans[spec.TableType].Conflicts
+			resultData[spec.TableType+"Conflicts"] = map[string]interface{}{
+				"conflicts":     conflicts.Conflicts,
+				"conflictCount": conflicts.ConflictCount,
+				"fileNames":     conflicts.FileNames,
 			}
-			result.Data = resultData
 		}
 	}
+	result.Data = resultData
 
 	return result
 }
@@ -396,680 +433,63 @@ func (a *App) CreateNewDatabase(prefix string) (*db.Database, string, error) {
 	a.extractEmbeddedFile(FRONTEND_FILE_DIR_NAME + DB_FILE_NAME, dbTempPath)
 
 	// 创建新的数据库连接
-	newDb, err := db.NewDatabase(dbTempPath, DB_PASSWORD)
+	newDb, err := db.NewDatabase(dbTempPath, EXCHANGE_DB_PASSWORD)
 	if err != nil {
 		return nil, "", fmt.Errorf("创建数据库连接失败: %v", err)
 	}
 
-	return newDb, dbTempPath, nil
-}
-
-// checkTable1Conflicts 检查表1冲突（统一信用代码+年份）- 只在上传文件之间检查冲突
-func (a *App) checkTable1Conflicts(sourceDbs []*db.Database, originalSourcePaths []string, areaConfig AreaConfig) (TableConflictInfo, []map[string]interface{}, error) {
-	conflictInfo := TableConflictInfo{}
-	var nonConflictData []map[string]interface{}
-
-	// 存储所有源数据，用于文件间冲突检查
-	allSourceData := make(map[string][]map[string]interface{}) // key: filePath, value: source data
-	fileNamesSet := make(map[string]bool)
-	
-	// 1. 收集所有源数据
-	for i, sourceDb := range sourceDbs {
-		sourceQuery := `SELECT * FROM enterprise_coal_consumption_main`
-		sourceResult, err := sourceDb.Query(sourceQuery)
-		if err != nil {
-			continue
-		}
-
-		if sourceResult.Ok && sourceResult.Data != nil {
-			if data, ok := sourceResult.Data.([]map[string]interface{}); ok {
-				filePath := originalSourcePaths[i]
-				sourceFileName := filepath.Base(filePath)
-				fileNamesSet[sourceFileName] = true
-				allSourceData[filePath] = data
-			}
-		}
-	}
-
-	// 2. 检查文件间冲突
-	conflictKeyMap := make(map[string]map[string]ConflictSourceInfo) // key: conflictKey, value: map[filePath]ConflictSourceInfo
-	
-	// 首先收集所有可能的冲突键
-	allKeys := make(map[string][]string) // key: conflictKey, value: []filePath
-	for filePath, data := range allSourceData {
-		for _, row := range data {
-			key := fmt.Sprintf("%v_%v", row["credit_code"], row["stat_date"])
-			if allKeys[key] == nil {
-				allKeys[key] = []string{}
-			}
-			allKeys[key] = append(allKeys[key], filePath)
-
-			areaValidation := a.validateAreaConsistency(getStringValue(row["province_name"]), getStringValue(row["city_name"]), getStringValue(row["country_name"]), areaConfig)
-			if areaValidation != nil {
-				return conflictInfo, nonConflictData, areaValidation
-			}
-		}
-	}
-	
-	// 然后处理真正的冲突（同一个键出现在多个文件中）
-	for conflictKey, filePaths := range allKeys {
-		// 去重文件路径
-		uniqueFilePaths := make(map[string]bool)
-		for _, filePath := range filePaths {
-			uniqueFilePaths[filePath] = true
-		}
-		
-		// 只有当同一个键出现在多个文件中时才算冲突
-		if len(uniqueFilePaths) > 1 {
-			// 创建冲突映射
-			conflictKeyMap[conflictKey] = make(map[string]ConflictSourceInfo)
-			
-			// 为每个包含此冲突键的文件创建冲突记录
-			for filePath := range uniqueFilePaths {
-				fileName := filepath.Base(filePath)
-				var objIds []string
-				
-				// 收集该文件中所有匹配此冲突键的obj_id
-				if data, exists := allSourceData[filePath]; exists {
-					for _, row := range data {
-						key := fmt.Sprintf("%v_%v", row["credit_code"], row["stat_date"])
-						if key == conflictKey {
-							objIds = append(objIds, fmt.Sprintf("%v", row["obj_id"]))
-						}
-					}
-				}
-				
-				conflictKeyMap[conflictKey][filePath] = ConflictSourceInfo{
-					FilePath:  filePath,
-					FileName:  fileName,
-					TableType: "table1",
-					ObjIds:    objIds,
-				}
-			}
-		} else {
-			// 没有冲突，添加到非冲突数据
-			filePath := filePaths[0] // 只有一个文件包含此键
-			if data, exists := allSourceData[filePath]; exists {
-				for _, row := range data {
-					key := fmt.Sprintf("%v_%v", row["credit_code"], row["stat_date"])
-					if key == conflictKey {
-						nonConflictData = append(nonConflictData, row)
-					}
-				}
-			}
-		}
-	}
-
-	// 3. 构建冲突详情，按冲突键分组
-	for conflictKey, fileConflicts := range conflictKeyMap {
-		// 解析冲突键
-		parts := strings.Split(conflictKey, "_")
-		if len(parts) != 2 {
-			continue
-		}
-
-		// 创建冲突详情（不再依赖目标数据库）
-		conflictDetail := ConflictDetail{
-			ObjId:      "", // 不再使用目标数据库的obj_id
-			CreditCode: parts[0],
-			StatDate:   parts[1],
-			UnitName:   "", // 从冲突的文件中获取
-			Conflict:   make([]ConflictSourceInfo, 0, len(fileConflicts)),
-		}
-
-		// 从冲突的文件中获取unit_name
-		for _, fileConflict := range fileConflicts {
-			if data, exists := allSourceData[fileConflict.FilePath]; exists {
-				for _, row := range data {
-					key := fmt.Sprintf("%v_%v", row["credit_code"], row["stat_date"])
-					if key == conflictKey {
-						conflictDetail.UnitName = fmt.Sprintf("%v", row["unit_name"])
-						break
-					}
-				}
-			}
-			conflictDetail.Conflict = append(conflictDetail.Conflict, fileConflict)
-		}
-
-		conflictInfo.Conflicts = append(conflictInfo.Conflicts, conflictDetail)
-	}
-
-	// 设置文件名列表
-	conflictInfo.FileNames = make([]string, 0, len(fileNamesSet))
-	for fileName := range fileNamesSet {
-		conflictInfo.FileNames = append(conflictInfo.FileNames, fileName)
-	}
-
-	conflictInfo.ConflictCount = len(conflictInfo.Conflicts)
-	conflictInfo.HasConflict = conflictInfo.ConflictCount > 0
-
-	return conflictInfo, nonConflictData, nil
-}
-
-// checkTable2Conflicts 检查表2冲突（统一信用代码+年份）- 只在上传文件之间检查冲突
-func (a *App) checkTable2Conflicts(sourceDbs []*db.Database, originalSourcePaths []string, areaConfig AreaConfig) (TableConflictInfo, []map[string]interface{}, error) {
-	conflictInfo := TableConflictInfo{}
-	var nonConflictData []map[string]interface{}
-
-	// 存储所有源数据，用于文件间冲突检查
-	allSourceData := make(map[string][]map[string]interface{}) // key: filePath, value: source data
-	fileNamesSet := make(map[string]bool)
-	
-	// 1. 收集所有源数据
-	for i, sourceDb := range sourceDbs {
-		sourceQuery := `SELECT * FROM critical_coal_equipment_consumption`
-		sourceResult, err := sourceDb.Query(sourceQuery)
-		if err != nil {
-			continue
-		}
-
-		if sourceResult.Ok && sourceResult.Data != nil {
-			if data, ok := sourceResult.Data.([]map[string]interface{}); ok {
-				filePath := originalSourcePaths[i]
-				sourceFileName := filepath.Base(filePath)
-				fileNamesSet[sourceFileName] = true
-				allSourceData[filePath] = data
-			}
-		}
-	}
-
-	// 2. 检查文件间冲突
-	conflictKeyMap := make(map[string]map[string]ConflictSourceInfo) // key: conflictKey, value: map[filePath]ConflictSourceInfo
-	
-	// 首先收集所有可能的冲突键
-	allKeys := make(map[string][]string) // key: conflictKey, value: []filePath
-	for filePath, data := range allSourceData {
-		for _, row := range data {
-			key := fmt.Sprintf("%v_%v", row["credit_code"], row["stat_date"])
-			if allKeys[key] == nil {
-				allKeys[key] = []string{}
-			}
-			allKeys[key] = append(allKeys[key], filePath)
-
-			areaValidation := a.validateAreaConsistency(getStringValue(row["province_name"]), getStringValue(row["city_name"]), getStringValue(row["country_name"]), areaConfig)
-			if areaValidation != nil {
-				return conflictInfo, nonConflictData, areaValidation
-			}
-		}
-	}
-	
-	// 然后处理真正的冲突（同一个键出现在多个文件中）
-	for conflictKey, filePaths := range allKeys {
-		// 去重文件路径
-		uniqueFilePaths := make(map[string]bool)
-		for _, filePath := range filePaths {
-			uniqueFilePaths[filePath] = true
-		}
-		
-		// 只有当同一个键出现在多个文件中时才算冲突
-		if len(uniqueFilePaths) > 1 {
-			// 创建冲突映射
-			conflictKeyMap[conflictKey] = make(map[string]ConflictSourceInfo)
-			
-			// 为每个包含此冲突键的文件创建冲突记录
-			for filePath := range uniqueFilePaths {
-				fileName := filepath.Base(filePath)
-				var objIds []string
-				
-				// 收集该文件中所有匹配此冲突键的obj_id
-				if data, exists := allSourceData[filePath]; exists {
-					for _, row := range data {
-						key := fmt.Sprintf("%v_%v", row["credit_code"], row["stat_date"])
-						if key == conflictKey {
-							objIds = append(objIds, fmt.Sprintf("%v", row["obj_id"]))
-						}
-					}
-				}
-				
-				conflictKeyMap[conflictKey][filePath] = ConflictSourceInfo{
-					FilePath:  filePath,
-					FileName:  fileName,
-					TableType: "table2",
-					ObjIds:    objIds,
-				}
-			}
-		} else {
-			// 没有冲突，添加到非冲突数据
-			filePath := filePaths[0] // 只有一个文件包含此键
-			if data, exists := allSourceData[filePath]; exists {
-				for _, row := range data {
-					key := fmt.Sprintf("%v_%v", row["credit_code"], row["stat_date"])
-					if key == conflictKey {
-						nonConflictData = append(nonConflictData, row)
-					}
-				}
-			}
-		}
-	}
-
-	// 3. 构建冲突详情，按冲突键分组
-	for conflictKey, fileConflicts := range conflictKeyMap {
-		// 解析冲突键
-		parts := strings.Split(conflictKey, "_")
-		if len(parts) != 2 {
-			continue
-		}
-
-		// 创建冲突详情（不再依赖目标数据库）
-		conflictDetail := ConflictDetail{
-			ObjId:      "", // 不再使用目标数据库的obj_id
-			CreditCode: parts[0],
-			StatDate:   parts[1],
-			UnitName:   "", // 从冲突的文件中获取
-			Conflict:   make([]ConflictSourceInfo, 0, len(fileConflicts)),
-		}
-
-		// 从冲突的文件中获取unit_name
-		for _, fileConflict := range fileConflicts {
-			if data, exists := allSourceData[fileConflict.FilePath]; exists {
-				for _, row := range data {
-					key := fmt.Sprintf("%v_%v", row["credit_code"], row["stat_date"])
-					if key == conflictKey {
-						conflictDetail.UnitName = fmt.Sprintf("%v", row["unit_name"])
-						break
-					}
-				}
-			}
-			conflictDetail.Conflict = append(conflictDetail.Conflict, fileConflict)
-		}
-
-		conflictInfo.Conflicts = append(conflictInfo.Conflicts, conflictDetail)
-	}
-
-	// 设置文件名列表
-	conflictInfo.FileNames = make([]string, 0, len(fileNamesSet))
-	for fileName := range fileNamesSet {
-		conflictInfo.FileNames = append(conflictInfo.FileNames, fileName)
+	// 升级表结构
+	if err := migrateDatabase(newDb); err != nil {
+		newDb.Close()
+		return nil, "", fmt.Errorf("升级数据库表结构失败: %v", err)
 	}
 
-	conflictInfo.ConflictCount = len(conflictInfo.Conflicts)
-	conflictInfo.HasConflict = conflictInfo.ConflictCount > 0
-
-	return conflictInfo, nonConflictData, nil
+	return newDb, dbTempPath, nil
 }
 
-// checkTable3Conflicts 检查表3冲突（项目代码+审查意见文号）- 只在上传文件之间检查冲突
-func (a *App) checkTable3Conflicts(sourceDbs []*db.Database, originalSourcePaths []string) (TableConflictInfo, []map[string]interface{}) {
-	conflictInfo := TableConflictInfo{}
-	var nonConflictData []map[string]interface{}
-
-	// 存储所有源数据，用于文件间冲突检查
-	allSourceData := make(map[string][]map[string]interface{}) // key: filePath, value: source data
-	fileNamesSet := make(map[string]bool)
-	
-	// 1. 收集所有源数据
-	for i, sourceDb := range sourceDbs {
-		sourceQuery := `SELECT * FROM fixed_assets_investment_project`
-		sourceResult, err := sourceDb.Query(sourceQuery)
-		if err != nil {
-			continue
-		}
-
-		if sourceResult.Ok && sourceResult.Data != nil {
-			if data, ok := sourceResult.Data.([]map[string]interface{}); ok {
-				filePath := originalSourcePaths[i]
-				sourceFileName := filepath.Base(filePath)
-				fileNamesSet[sourceFileName] = true
-				allSourceData[filePath] = data
-			}
-		}
-	}
-
-	// 2. 检查文件间冲突
-	conflictKeyMap := make(map[string]map[string]ConflictSourceInfo) // key: conflictKey, value: map[filePath]ConflictSourceInfo
-	
-	// 首先收集所有可能的冲突键
-	allKeys := make(map[string][]string) // key: conflictKey, value: []filePath
-	for filePath, data := range allSourceData {
-		for _, row := range data {
-			key := fmt.Sprintf("%v_%v", row["project_code"], row["document_number"])
-			if allKeys[key] == nil {
-				allKeys[key] = []string{}
-			}
-			allKeys[key] = append(allKeys[key], filePath)
-		}
-	}
-	
-	// 然后处理真正的冲突（同一个键出现在多个文件中）
-	for conflictKey, filePaths := range allKeys {
-		// 去重文件路径
-		uniqueFilePaths := make(map[string]bool)
-		for _, filePath := range filePaths {
-			uniqueFilePaths[filePath] = true
-		}
-		
-		// 只有当同一个键出现在多个文件中时才算冲突
-		if len(uniqueFilePaths) > 1 {
-			// 创建冲突映射
-			conflictKeyMap[conflictKey] = make(map[string]ConflictSourceInfo)
-			
-			// 为每个包含此冲突键的文件创建冲突记录
-			for filePath := range uniqueFilePaths {
-				fileName := filepath.Base(filePath)
-				var objIds []string
-				
-				// 收集该文件中所有匹配此冲突键的obj_id
-				if data, exists := allSourceData[filePath]; exists {
-					for _, row := range data {
-						key := fmt.Sprintf("%v_%v", row["project_code"], row["document_number"])
-						if key == conflictKey {
-							objIds = append(objIds, fmt.Sprintf("%v", row["obj_id"]))
-						}
-					}
-				}
-				
-				conflictKeyMap[conflictKey][filePath] = ConflictSourceInfo{
-					FilePath:  filePath,
-					FileName:  fileName,
-					TableType: "table3",
-					ObjIds:    objIds,
-				}
-			}
-		} else {
-			// 没有冲突，添加到非冲突数据
-			filePath := filePaths[0] // 只有一个文件包含此键
-			if data, exists := allSourceData[filePath]; exists {
-				for _, row := range data {
-					key := fmt.Sprintf("%v_%v", row["project_code"], row["document_number"])
-					if key == conflictKey {
-						nonConflictData = append(nonConflictData, row)
-					}
-				}
-			}
-		}
-	}
-
-	// 3. 构建冲突详情，按冲突键分组
-	for conflictKey, fileConflicts := range conflictKeyMap {
-		// 解析冲突键
-		parts := strings.Split(conflictKey, "_")
-		if len(parts) != 2 {
-			continue
-		}
-
-		// 创建冲突详情（不再依赖目标数据库）
-		conflictDetail := ConflictDetail{
-			ObjId:          "", // 不再使用目标数据库的obj_id
-			ProjectCode:    parts[0],
-			DocumentNumber: parts[1],
-			ProjectName:    "", // 从冲突的文件中获取
-			Conflict:       make([]ConflictSourceInfo, 0, len(fileConflicts)),
-		}
-
-		// 从冲突的文件中获取project_name
-		for _, fileConflict := range fileConflicts {
-			if data, exists := allSourceData[fileConflict.FilePath]; exists {
-				for _, row := range data {
-					key := fmt.Sprintf("%v_%v", row["project_code"], row["document_number"])
-					if key == conflictKey {
-						conflictDetail.ProjectName = fmt.Sprintf("%v", row["project_name"])
-						break
-					}
-				}
-			}
-			conflictDetail.Conflict = append(conflictDetail.Conflict, fileConflict)
-		}
-
-		conflictInfo.Conflicts = append(conflictInfo.Conflicts, conflictDetail)
-	}
+// mergeTable1DataWithTx 使用事务合并表1数据
+func (a *App) mergeTable1DataWithTx(tx *sql.Tx, nonConflictData []map[string]interface{}, sourceDbs []*db.Database, originalSourcePaths []string) MergeResult {
+	result := MergeResult{}
 
-	// 设置文件名列表
-	conflictInfo.FileNames = make([]string, 0, len(fileNamesSet))
-	for fileName := range fileNamesSet {
-		conflictInfo.FileNames = append(conflictInfo.FileNames, fileName)
+	if len(nonConflictData) == 0 {
+		fmt.Printf("表1没有数据需要插入\n")
+		return result
 	}
 
-	conflictInfo.ConflictCount = len(conflictInfo.Conflicts)
-	conflictInfo.HasConflict = conflictInfo.ConflictCount > 0
+	// 1. 写入主表数据，使用源数据的obj_id、create_time、create_user，不生成新的
+	result.addRows(mergeRowsTx(tx, "enterprise_coal_consumption_main", nonConflictData), "插入主表数据失败: ")
 
-	fmt.Printf("表3冲突检查完成 - 冲突数: %d, 非冲突数据数: %d\n", len(conflictInfo.Conflicts), len(nonConflictData))
-	if len(nonConflictData) > 0 {
-		fmt.Printf("表3非冲突数据示例: obj_id=%v, project_name=%v, project_code=%v\n",
-			nonConflictData[0]["obj_id"], nonConflictData[0]["project_name"], nonConflictData[0]["project_code"])
+	// 2. 写入扩展表数据，按主表数据的来源数据库分组，每个来源的每张扩展表按批查询一次
+	childMessages := map[string]string{
+		"enterprise_coal_consumption_usage": "插入主要用途情况表数据失败: ",
+		"enterprise_coal_consumption_equip": "插入重点耗煤装置情况表数据失败: ",
 	}
-
-	return conflictInfo, nonConflictData
-}
-
-// checkAttachment2Conflicts 检查附件2冲突（省+市+县+年份）- 只在上传文件之间检查冲突
-func (a *App) checkAttachment2Conflicts(sourceDbs []*db.Database, originalSourcePaths []string, areaConfig AreaConfig) (TableConflictInfo, []map[string]interface{}, error) {
-	conflictInfo := TableConflictInfo{}
-	var nonConflictData []map[string]interface{}
-
-	// 存储所有源数据，用于文件间冲突检查
-	allSourceData := make(map[string][]map[string]interface{}) // key: filePath, value: source data
-	fileNamesSet := make(map[string]bool)
-	
-	// 1. 收集所有源数据
 	for i, sourceDb := range sourceDbs {
-		sourceQuery := `SELECT * FROM coal_consumption_report`
-		sourceResult, err := sourceDb.Query(sourceQuery)
-		if err != nil {
-			continue
-		}
-
-		if sourceResult.Ok && sourceResult.Data != nil {
-			if data, ok := sourceResult.Data.([]map[string]interface{}); ok {
-				filePath := originalSourcePaths[i]
-				sourceFileName := filepath.Base(filePath)
-				fileNamesSet[sourceFileName] = true
-				allSourceData[filePath] = data
-			}
-		}
-	}
-
-	// 2. 检查文件间冲突
-	conflictKeyMap := make(map[string]map[string]ConflictSourceInfo) // key: conflictKey, value: map[filePath]ConflictSourceInfo
-	
-	// 首先收集所有可能的冲突键
-	allKeys := make(map[string][]string) // key: conflictKey, value: []filePath
-	for filePath, data := range allSourceData {
-		for _, row := range data {
-			key := fmt.Sprintf("%v_%v_%v_%v", row["province_name"], row["city_name"], row["country_name"], row["stat_date"])
-			if allKeys[key] == nil {
-				allKeys[key] = []string{}
-			}
-			allKeys[key] = append(allKeys[key], filePath)
-
-			areaValidation := a.validateAreaConsistency(getStringValue(row["province_name"]), getStringValue(row["city_name"]), getStringValue(row["country_name"]), areaConfig)
-			if areaValidation != nil {
-				return conflictInfo, nonConflictData, areaValidation
-			}
-		}
-	}
-	
-	// 然后处理真正的冲突（同一个键出现在多个文件中）
-	for conflictKey, filePaths := range allKeys {
-		// 去重文件路径
-		uniqueFilePaths := make(map[string]bool)
-		for _, filePath := range filePaths {
-			uniqueFilePaths[filePath] = true
-		}
-		
-		// 只有当同一个键出现在多个文件中时才算冲突
-		if len(uniqueFilePaths) > 1 {
-			// 创建冲突映射
-			conflictKeyMap[conflictKey] = make(map[string]ConflictSourceInfo)
-			
-			// 为每个包含此冲突键的文件创建冲突记录
-			for filePath := range uniqueFilePaths {
-				fileName := filepath.Base(filePath)
-				var objIds []string
-				
-				// 收集该文件中所有匹配此冲突键的obj_id
-				if data, exists := allSourceData[filePath]; exists {
-					for _, row := range data {
-						key := fmt.Sprintf("%v_%v_%v_%v", row["province_name"], row["city_name"], row["country_name"], row["stat_date"])
-						if key == conflictKey {
-							objIds = append(objIds, fmt.Sprintf("%v", row["obj_id"]))
-						}
-					}
-				}
-				
-				conflictKeyMap[conflictKey][filePath] = ConflictSourceInfo{
-					FilePath:  filePath,
-					FileName:  fileName,
-					TableType: "attachment2",
-					ObjIds:    objIds,
-				}
-			}
-		} else {
-			// 没有冲突，添加到非冲突数据
-			filePath := filePaths[0] // 只有一个文件包含此键
-			if data, exists := allSourceData[filePath]; exists {
-				for _, row := range data {
-					key := fmt.Sprintf("%v_%v_%v_%v", row["province_name"], row["city_name"], row["country_name"], row["stat_date"])
-					if key == conflictKey {
-						nonConflictData = append(nonConflictData, row)
-					}
-				}
+		// 扩展表数据只从主表数据的来源数据库中读取
+		objIds := []string{}
+		for _, mainRow := range nonConflictData {
+			if source, ok := mainRow[mergeSourceField].(string); ok && source != originalSourcePaths[i] {
+				continue
 			}
+			objIds = append(objIds, getStringValue(mainRow["obj_id"]))
 		}
-	}
-
-	// 3. 构建冲突详情，按冲突键分组
-	for conflictKey, fileConflicts := range conflictKeyMap {
-		// 解析冲突键
-		parts := strings.Split(conflictKey, "_")
-		if len(parts) != 4 {
+		if len(objIds) == 0 {
 			continue
 		}
 
-		// 创建冲突详情（不再依赖目标数据库）
-		conflictDetail := ConflictDetail{
-			ObjId:        "", // 不再使用目标数据库的obj_id
-			ProvinceName: parts[0],
-			CityName:     parts[1],
-			CountryName:  parts[2],
-			StatDate:     parts[3],
-			Conflict:     make([]ConflictSourceInfo, 0, len(fileConflicts)),
-		}
-
-		// 将文件冲突信息添加到冲突详情中
-		for _, fileConflict := range fileConflicts {
-			conflictDetail.Conflict = append(conflictDetail.Conflict, fileConflict)
-		}
-
-		conflictInfo.Conflicts = append(conflictInfo.Conflicts, conflictDetail)
-	}
-
-	// 设置文件名列表
-	conflictInfo.FileNames = make([]string, 0, len(fileNamesSet))
-	for fileName := range fileNamesSet {
-		conflictInfo.FileNames = append(conflictInfo.FileNames, fileName)
-	}
-
-	conflictInfo.ConflictCount = len(conflictInfo.Conflicts)
-	conflictInfo.HasConflict = conflictInfo.ConflictCount > 0
-
-	return conflictInfo, nonConflictData, nil
-}
-
-// mergeTable1DataWithTx 使用事务合并表1数据
-func (a *App) mergeTable1DataWithTx(tx *sql.Tx, nonConflictData []map[string]interface{}, sourceDbs []*db.Database, originalSourcePaths []string) MergeResult {
-	result := MergeResult{}
-
-	if len(nonConflictData) == 0 {
-		fmt.Printf("表1没有数据需要插入\n")
-		return result
-	}
-
-	// 1. 插入主表数据
-	insertQuery := `INSERT INTO enterprise_coal_consumption_main (
-		obj_id, unit_name, stat_date, sg_code, tel, credit_code,
-		trade_a, trade_b, trade_c, province_code, province_name, city_code, city_name,
-		country_code, country_name, annual_energy_equivalent_value, annual_energy_equivalent_cost,
-		annual_raw_material_energy, annual_total_coal_consumption, annual_total_coal_products,
-		annual_raw_coal, annual_raw_coal_consumption, annual_clean_coal_consumption,
-		annual_other_coal_consumption, annual_coke_consumption, is_confirm, is_check, create_time, create_user
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	for _, row := range nonConflictData {
-		// 使用源数据的obj_id、create_time、create_user，不生成新的
-
-		// 插入数据
-		_, err := tx.Exec(insertQuery,
-			row["obj_id"], row["unit_name"], row["stat_date"], row["sg_code"], row["tel"], row["credit_code"],
-			row["trade_a"], row["trade_b"], row["trade_c"], row["province_code"], row["province_name"], row["city_code"], row["city_name"],
-			row["country_code"], row["country_name"], row["annual_energy_equivalent_value"], row["annual_energy_equivalent_cost"],
-			row["annual_raw_material_energy"], row["annual_total_coal_consumption"], row["annual_total_coal_products"],
-			row["annual_raw_coal"], row["annual_raw_coal_consumption"], row["annual_clean_coal_consumption"],
-			row["annual_other_coal_consumption"], row["annual_coke_consumption"], row["is_confirm"], row["is_check"], row["create_time"], row["create_user"])
-
+		childRows, err := queryMergeChildRows("table1", sourceDb, objIds)
 		if err != nil {
 			result.ErrorCount++
-			result.Message = "插入主表数据失败: " + err.Error()
-			fmt.Printf("表1主表插入失败: %v\n", err)
-		} else {
-			result.SuccessCount++
+			result.Message = fmt.Sprintf("读取扩展表数据失败: %v", err)
+			continue
 		}
-	}
-
-	// 2. 插入扩展表数据
-	// 2.1 插入主要用途情况表
-	usageInsertQuery := `INSERT INTO enterprise_coal_consumption_usage (
-		obj_id, fk_id, stat_date, create_time, main_usage, specific_usage, input_variety, input_unit,
-		input_quantity, output_energy_types, output_quantity, measurement_unit, remarks, row_no, is_confirm, is_check
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	// 2.2 插入重点耗煤装置情况表
-	equipInsertQuery := `INSERT INTO enterprise_coal_consumption_equip (
-		obj_id, fk_id, stat_date, create_time, equip_type, equip_no, total_runtime, design_life,
-		energy_efficiency, capacity_unit, capacity, coal_type, annual_coal_consumption, row_no, is_confirm, is_check
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	// 遍历每个源数据库，查询并插入扩展表数据
-	for _, sourceDb := range sourceDbs {
-		// 根据主表的credit_code查询对应的扩展表数据
-		for _, mainRow := range nonConflictData {
-
-			// 查询主要用途情况表
-			usageQuery := `SELECT * FROM enterprise_coal_consumption_usage WHERE fk_id = ?`
-			usageResult, err := sourceDb.Query(usageQuery, mainRow["obj_id"])
-			if err == nil && usageResult.Ok && usageResult.Data != nil {
-				if data, ok := usageResult.Data.([]map[string]interface{}); ok {
-					if len(data) > 0 {
-
-						for _, row := range data {
-							_, err := tx.Exec(usageInsertQuery,
-								row["obj_id"], row["fk_id"], row["stat_date"], row["create_time"], row["main_usage"], row["specific_usage"],
-								row["input_variety"], row["input_unit"], row["input_quantity"], row["output_energy_types"],
-								row["output_quantity"], row["measurement_unit"], row["remarks"], row["row_no"], row["is_confirm"], row["is_check"])
-
-							if err != nil {
-								result.ErrorCount++
-								result.Message = "插入主要用途情况表数据失败: " + err.Error()
-								fmt.Printf("主要用途情况表插入失败: %v\n", err)
-							} else {
-								result.SuccessCount++
-							}
-						}
-					}
-				}
+		for _, childTable := range getMergeTableNames("table1")[1:] {
+			data := []map[string]interface{}{}
+			for _, objID := range objIds {
+				data = append(data, childRows[childTable][objID]...)
 			}
-
-			// 查询重点耗煤装置情况表
-			equipQuery := `SELECT * FROM enterprise_coal_consumption_equip WHERE fk_id = ?`
-			equipResult, err := sourceDb.Query(equipQuery, mainRow["obj_id"])
-			if err == nil && equipResult.Ok && equipResult.Data != nil {
-				if data, ok := equipResult.Data.([]map[string]interface{}); ok {
-					if len(data) > 0 {
-						for _, row := range data {
-							_, err := tx.Exec(equipInsertQuery,
-								row["obj_id"], row["fk_id"], row["stat_date"], row["create_time"], row["equip_type"], row["equip_no"],
-								row["total_runtime"], row["design_life"], row["energy_efficiency"], row["capacity_unit"],
-								row["capacity"], row["coal_type"], row["annual_coal_consumption"], row["row_no"], row["is_confirm"], row["is_check"])
-
-							if err != nil {
-								result.ErrorCount++
-								result.Message = "插入重点耗煤装置情况表数据失败: " + err.Error()
-								fmt.Printf("重点耗煤装置情况表插入失败: %v\n", err)
-							} else {
-								result.SuccessCount++
-							}
-						}
-					}
-				}
+			if len(data) > 0 {
+				result.addRows(mergeRowsTx(tx, childTable, data), childMessages[childTable])
 			}
 		}
 	}
@@ -1087,33 +507,8 @@ func (a *App) mergeTable2DataWithTx(tx *sql.Tx, nonConflictData []map[string]int
 		return result
 	}
 
-	// 直接插入没有冲突的数据
-	insertQuery := `INSERT INTO critical_coal_equipment_consumption (
-		obj_id, stat_date, create_time, sg_code, unit_name, credit_code, trade_a, trade_b, trade_c, trade_d,
-		province_code, province_name, city_code, city_name, country_code, country_name, unit_addr,
-		coal_type, coal_no, usage_time, design_life, enecrgy_efficienct_bmk, capacity_unit, capacity,
-		use_info, status, annual_coal_consumption, row_no, create_user, is_confirm, is_check
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	for _, row := range nonConflictData {
-		// 使用源数据的obj_id、create_time、create_user，不生成新的
-
-		// 插入数据
-		_, err := tx.Exec(insertQuery,
-			row["obj_id"], row["stat_date"], row["create_time"], row["sg_code"], row["unit_name"], row["credit_code"],
-			row["trade_a"], row["trade_b"], row["trade_c"], row["trade_d"], row["province_code"], row["province_name"],
-			row["city_code"], row["city_name"], row["country_code"], row["country_name"], row["unit_addr"],
-			row["coal_type"], row["coal_no"], row["usage_time"], row["design_life"], row["enecrgy_efficienct_bmk"],
-			row["capacity_unit"], row["capacity"], row["use_info"], row["status"], row["annual_coal_consumption"],
-			row["row_no"], row["create_user"], row["is_confirm"], row["is_check"])
-
-		if err != nil {
-			result.ErrorCount++
-			result.Message = "插入数据失败: " + err.Error()
-		} else {
-			result.SuccessCount++
-		}
-	}
+	// 直接写入没有冲突的数据，使用源数据的obj_id、create_time、create_user，不生成新的
+	result.addRows(mergeRowsTx(tx, "critical_coal_equipment_consumption", nonConflictData), "插入数据失败: ")
 
 	result.Ok = true
 	return result
@@ -1127,37 +522,8 @@ func (a *App) mergeTable3DataWithTx(tx *sql.Tx, nonConflictData []map[string]int
 		return result
 	}
 
-	// 直接插入没有冲突的数据
-	insertQuery := `INSERT INTO fixed_assets_investment_project (
-		obj_id, stat_date, sg_code, project_name, project_code, construction_unit, main_construction_content,
-		unit_id, province_name, city_name, country_name, trade_a, trade_c, examination_approval_time,
-		scheduled_time, actual_time, examination_authority, document_number, equivalent_value, equivalent_cost,
-		pq_total_coal_consumption, pq_coal_consumption, pq_coke_consumption, pq_blue_coke_consumption,
-		sce_total_coal_consumption, sce_coal_consumption, sce_coke_consumption, sce_blue_coke_consumption,
-		is_substitution, substitution_source, substitution_quantity, pq_annual_coal_quantity, sce_annual_coal_quantity,
-		create_time, create_user, is_confirm, is_check
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	for _, row := range nonConflictData {
-		// 使用源数据的obj_id、create_time、create_user，不生成新的
-
-		// 插入数据
-		_, err := tx.Exec(insertQuery,
-			row["obj_id"], row["stat_date"], row["sg_code"], row["project_name"], row["project_code"], row["construction_unit"], row["main_construction_content"],
-			row["unit_id"], row["province_name"], row["city_name"], row["country_name"], row["trade_a"], row["trade_c"], row["examination_approval_time"],
-			row["scheduled_time"], row["actual_time"], row["examination_authority"], row["document_number"], row["equivalent_value"], row["equivalent_cost"],
-			row["pq_total_coal_consumption"], row["pq_coal_consumption"], row["pq_coke_consumption"], row["pq_blue_coke_consumption"],
-			row["sce_total_coal_consumption"], row["sce_coal_consumption"], row["sce_coke_consumption"], row["sce_blue_coke_consumption"],
-			row["is_substitution"], row["substitution_source"], row["substitution_quantity"], row["pq_annual_coal_quantity"], row["sce_annual_coal_quantity"],
-			row["create_time"], row["create_user"], row["is_confirm"], row["is_check"])
-
-		if err != nil {
-			result.ErrorCount++
-			result.Message = "插入数据失败: " + err.Error()
-		} else {
-			result.SuccessCount++
-		}
-	}
+	// 直接写入没有冲突的数据，使用源数据的obj_id、create_time、create_user，不生成新的
+	result.addRows(mergeRowsTx(tx, "fixed_assets_investment_project", nonConflictData), "插入数据失败: ")
 
 	result.Ok = true
 	return result
@@ -1171,31 +537,8 @@ func (a *App) mergeAttachment2DataWithTx(tx *sql.Tx, nonConflictData []map[strin
 		return result
 	}
 
-	// 直接插入没有冲突的数据
-	insertQuery := `INSERT INTO coal_consumption_report (
-		obj_id, stat_date, sg_code, unit_id, unit_name, unit_level, province_name, city_name, country_name,
-		total_coal, raw_coal, washed_coal, other_coal, power_generation, heating, coal_washing, coking,
-		oil_refining, gas_production, industry, raw_materials, other_uses, coke, create_user, create_time, is_confirm, is_check
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	for _, row := range nonConflictData {
-		// 使用源数据的obj_id、create_time、create_user，不生成新的
-		// 插入数据
-		_, err := tx.Exec(insertQuery,
-			row["obj_id"], row["stat_date"], row["sg_code"], row["unit_id"], row["unit_name"], row["unit_level"],
-			row["province_name"], row["city_name"], row["country_name"], row["total_coal"], row["raw_coal"],
-			row["washed_coal"], row["other_coal"], row["power_generation"], row["heating"], row["coal_washing"],
-			row["coking"], row["oil_refining"], row["gas_production"], row["industry"], row["raw_materials"],
-			row["other_uses"], row["coke"], row["create_user"], row["create_time"], row["is_confirm"], row["is_check"])
-
-		if err != nil {
-			result.ErrorCount++
-			result.Message = "插入数据失败: " + err.Error()
-			fmt.Printf("附件2插入失败: %v\n", err)
-		} else {
-			result.SuccessCount++
-		}
-	}
+	// 直接写入没有冲突的数据，使用源数据的obj_id、create_time、create_user，不生成新的
+	result.addRows(mergeRowsTx(tx, "coal_consumption_report", nonConflictData), "插入数据失败: ")
 
 	result.Ok = true
 	return result
@@ -1208,16 +551,15 @@ func (a *App) MergeConflictData(dbFilePath string, conflictData []ConflictData)
 }
 
 // mergeConflictDataWithRecover 带异常处理的合并冲突数据函数
-func (a *App) mergeConflictDataWithRecover(dbFilePath string, conflictData []ConflictData) db.QueryResult {
+func (a *App) mergeConflictDataWithRecover(dbFilePath string, conflictData []ConflictData) (result db.QueryResult) {
 	// 添加异常处理，防止函数崩溃
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("MergeConflictData 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("合并冲突数据发生异常: %v", r)}
 		}
 	}()
 
-	result := db.QueryResult{}
-
 	if len(conflictData) == 0 {
 		result.Ok = false
 		result.Message = "没有冲突数据需要合并"
@@ -1225,7 +567,7 @@ func (a *App) mergeConflictDataWithRecover(dbFilePath string, conflictData []Con
 	}
 
 	// 打开目标数据库
-	targetDb, err := db.NewDatabase(dbFilePath, DB_PASSWORD)
+	targetDb, err := db.NewDatabase(dbFilePath, EXCHANGE_DB_PASSWORD)
 	if err != nil {
 		result.Ok = false
 		result.Message = "打开目标数据库失败: " + err.Error()
@@ -1233,6 +575,13 @@ func (a *App) mergeConflictDataWithRecover(dbFilePath string, conflictData []Con
 	}
 	defer targetDb.Close()
 
+	// 合并前为目标数据库创建快照
+	if _, err := a.createSnapshot(targetDb, dbFilePath, SNAPSHOT_REASON_MERGE); err != nil {
+		result.Ok = false
+		result.Message = err.Error()
+		return result
+	}
+
 	// 开始事务
 	tx, err := targetDb.Begin()
 	if err != nil {
@@ -1241,36 +590,63 @@ func (a *App) mergeConflictDataWithRecover(dbFilePath string, conflictData []Con
 		return result
 	}
 
-	// 确保事务回滚（如果出错）
+	// 未提交时回滚，任一冲突处理失败都不保留部分修改
+	committed := false
 	defer func() {
-		if err != nil {
+		if !committed {
 			tx.Rollback()
 		}
 	}()
 
 	totalSuccessCount := 0
 	totalErrorCount := 0
+	var errorMessages []string
 	tableResults := make(map[string]map[string]interface{})
 
+	// 报送数据包校验签名和完整性后解压到临时文件，冲突数据从解压的数据库中读取
+	sourceDbPaths := make(map[string]string) // key: 冲突来源文件路径, value: 数据库文件路径
+	defer func() {
+		for filePath, sourceDbPath := range sourceDbPaths {
+			if sourceDbPath != filePath {
+				a.Removefile(sourceDbPath)
+			}
+		}
+	}()
+
 	// 处理所有冲突数据
-	for _, conflict := range conflictData {
+	for i, conflict := range conflictData {
 		if len(conflict.Conditions) == 0 {
 			continue
 		}
 
+		if _, exists := sourceDbPaths[conflict.FilePath]; !exists {
+			sourceDbPaths[conflict.FilePath] = conflict.FilePath
+			if isSubmissionPackage(conflict.FilePath) {
+				dbDstPath := GetPath(filepath.Join(DATA_DIR_NAME, fmt.Sprintf("conflict_%d_%d", time.Now().UnixNano(), i)))
+				if _, prepareErr := a.prepareMergeSource(conflict.FilePath, dbDstPath); prepareErr != nil {
+					delete(sourceDbPaths, conflict.FilePath)
+					errorMessages = append(errorMessages, fmt.Sprintf("数据包 %s 校验失败: %v", filepath.Base(conflict.FilePath), prepareErr))
+					continue
+				}
+				sourceDbPaths[conflict.FilePath] = dbDstPath
+			}
+		}
+		sourceConflict := conflict
+		sourceConflict.FilePath = sourceDbPaths[conflict.FilePath]
+
 		var successCount, errorCount int
 		var tableErr error
 
 		// 根据表类型处理冲突数据
 		switch conflict.TableType {
 		case "table1":
-			successCount, errorCount, tableErr = a.mergeTable1ConflictDataNew(tx, conflict)
+			successCount, errorCount, tableErr = a.mergeTable1ConflictDataNew(tx, sourceConflict)
 		case "table2":
-			successCount, errorCount, tableErr = a.mergeTable2ConflictDataNew(tx, conflict)
+			successCount, errorCount, tableErr = a.mergeTable2ConflictDataNew(tx, sourceConflict)
 		case "table3":
-			successCount, errorCount, tableErr = a.mergeTable3ConflictDataNew(tx, conflict)
+			successCount, errorCount, tableErr = a.mergeTable3ConflictDataNew(tx, sourceConflict)
 		case "attachment2":
-			successCount, errorCount, tableErr = a.mergeAttachment2ConflictDataNew(tx, conflict)
+			successCount, errorCount, tableErr = a.mergeAttachment2ConflictDataNew(tx, sourceConflict)
 		default:
 			// 跳过不支持的表类型
 			continue
@@ -1286,19 +662,62 @@ func (a *App) mergeConflictDataWithRecover(dbFilePath string, conflictData []Con
 		totalSuccessCount += successCount
 		totalErrorCount += errorCount
 
-		// 如果某个表处理出错，记录错误但不中断整个事务
+		// 如果某个表处理出错，记录错误后继续检查其他冲突，最后统一回滚
 		if tableErr != nil {
-			err = fmt.Errorf("表 %s 处理失败: %v", conflict.TableType, tableErr)
+			errorMessages = append(errorMessages, fmt.Sprintf("表 %s 处理失败: %v", conflict.TableType, tableErr))
+			continue
+		}
+
+		// 记录用户选择的冲突处理结果
+		var resolutions []MergeResolution
+		for _, condition := range conflict.Conditions {
+			resolutions = append(resolutions, MergeResolution{
+				TableType:   conflict.TableType,
+				ConflictKey: getConditionConflictKey(conflict.TableType, condition),
+				Strategy:    MergeStrategyManual,
+				FilePath:    conflict.FilePath,
+				FileName:    filepath.Base(conflict.FilePath),
+			})
 		}
+		if logErr := a.insertMergeLogs(tx, resolutions); logErr != nil {
+			errorMessages = append(errorMessages, logErr.Error())
+		}
+
+		// 记录冲突数据的来源数据库
+		sourceDb, openErr := db.NewReadOnlyDatabase(sourceConflict.FilePath, EXCHANGE_DB_PASSWORD)
+		if openErr != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("打开源数据库失败: %v", openErr))
+			continue
+		}
+		if provenanceErr := a.recordConflictProvenance(tx, conflict, sourceDb); provenanceErr != nil {
+			errorMessages = append(errorMessages, provenanceErr.Error())
+		}
+		sourceDb.Close()
+	}
+
+	// 有冲突处理失败或数据写入失败时回滚，不提交部分合并的数据
+	if len(errorMessages) > 0 || totalErrorCount > 0 {
+		if totalErrorCount > 0 {
+			errorMessages = append(errorMessages, fmt.Sprintf("%d 条数据写入失败", totalErrorCount))
+		}
+		result.Ok = false
+		result.Message = "合并冲突数据失败，未合并任何数据: " + strings.Join(errorMessages, "；")
+		result.Data = map[string]interface{}{
+			"totalSuccessCount": 0,
+			"totalErrorCount":   totalErrorCount,
+			"errorMessages":     errorMessages,
+			"tableResults":      tableResults,
+		}
+		return result
 	}
 
 	// 提交事务
-	commitErr := tx.Commit()
-	if commitErr != nil {
+	if err := tx.Commit(); err != nil {
 		result.Ok = false
-		result.Message = "提交事务失败: " + commitErr.Error()
+		result.Message = "提交事务失败: " + err.Error()
 		return result
 	}
+	committed = true
 
 	result.Ok = true
 	result.Message = fmt.Sprintf("成功合并 %d 条冲突数据，错误: %d 条", totalSuccessCount, totalErrorCount)
@@ -1317,7 +736,7 @@ func (a *App) mergeTable1ConflictDataNew(tx *sql.Tx, conflict ConflictData) (int
 	errorCount := 0
 
 	// 打开源数据库
-	sourceDb, err := db.NewDatabase(conflict.FilePath, DB_PASSWORD)
+	sourceDb, err := db.NewReadOnlyDatabase(conflict.FilePath, EXCHANGE_DB_PASSWORD)
 	if err != nil {
 		return 0, 0, fmt.Errorf("打开源数据库失败: %v", err)
 	}
@@ -1372,16 +791,7 @@ func (a *App) mergeTable1ConflictDataNew(tx *sql.Tx, conflict ConflictData) (int
 			}
 		}
 
-		// 删除主表数据
-		deleteMainQuery := `DELETE FROM enterprise_coal_consumption_main WHERE credit_code = ? AND stat_date = ?`
-		_, err = tx.Exec(deleteMainQuery, condition.CreditCode, condition.StatDate)
-		if err != nil {
-			fmt.Printf("删除主表记录失败: credit_code=%s, stat_date=%s, error=%v\n", condition.CreditCode, condition.StatDate, err)
-			errorCount++
-			continue
-		}
-
-		// 查询源数据并插入
+		// 查询源数据
 		query := `SELECT * FROM enterprise_coal_consumption_main WHERE credit_code = ? AND stat_date = ?`
 		result, err := sourceDb.Query(query, condition.CreditCode, condition.StatDate)
 		if err != nil {
@@ -1400,89 +810,34 @@ func (a *App) mergeTable1ConflictDataNew(tx *sql.Tx, conflict ConflictData) (int
 			continue
 		}
 
-		// 插入源数据到目标表
-		for _, row := range data {
-			// 完全按照源表数据插入，包括obj_id
-			insertQuery := `INSERT INTO enterprise_coal_consumption_main (
-				obj_id, unit_name, stat_date, sg_code, tel, credit_code,
-				trade_a, trade_b, trade_c, province_code, province_name, city_code, city_name,
-				country_code, country_name, annual_energy_equivalent_value, annual_energy_equivalent_cost,
-				annual_raw_material_energy, annual_total_coal_consumption, annual_total_coal_products,
-				annual_raw_coal, annual_raw_coal_consumption, annual_clean_coal_consumption,
-				annual_other_coal_consumption, annual_coke_consumption, is_confirm, is_check, create_time, create_user
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-			_, execErr := tx.Exec(insertQuery,
-				row["obj_id"], row["unit_name"], row["stat_date"], row["sg_code"], row["tel"], row["credit_code"],
-				row["trade_a"], row["trade_b"], row["trade_c"], row["province_code"], row["province_name"], row["city_code"], row["city_name"],
-				row["country_code"], row["country_name"], row["annual_energy_equivalent_value"], row["annual_energy_equivalent_cost"],
-				row["annual_raw_material_energy"], row["annual_total_coal_consumption"], row["annual_total_coal_products"],
-				row["annual_raw_coal"], row["annual_raw_coal_consumption"], row["annual_clean_coal_consumption"],
-				row["annual_other_coal_consumption"], row["annual_coke_consumption"], row["is_confirm"], row["is_check"], row["create_time"], row["create_user"])
-
-			if execErr != nil {
-				fmt.Printf("插入主表数据失败: obj_id=%s, stat_date=%s, error=%v\n", row["obj_id"], row["stat_date"], execErr)
-				errorCount++
-			} else {
-				successCount++
-			}
+		// 按自然键覆盖目标表主表数据，完全按照源表数据写入，包括obj_id
+		mainResult := mergeRowsTx(tx, "enterprise_coal_consumption_main", data)
+		successCount += int(mainResult.SuccessRows)
+		errorCount += int(mainResult.FailedRows)
+		for _, message := range mainResult.Errors {
+			fmt.Printf("写入主表数据失败: credit_code=%s, stat_date=%s, error=%s\n", condition.CreditCode, condition.StatDate, message)
+		}
 
-			// 插入扩展表数据
-			// 插入主要用途情况表数据
-			usageQuery := `SELECT * FROM enterprise_coal_consumption_usage WHERE fk_id = ?`
-			usageResult, err := sourceDb.Query(usageQuery, row["obj_id"])
-			if err == nil && usageResult.Ok && usageResult.Data != nil {
-				if usageData, ok := usageResult.Data.([]map[string]interface{}); ok {
-					if len(usageData) > 0 {
-
-						usageInsertQuery := `INSERT INTO enterprise_coal_consumption_usage (
-							obj_id, fk_id, stat_date, create_time, main_usage, specific_usage, input_variety, input_unit,
-							input_quantity, output_energy_types, output_quantity, measurement_unit, remarks, row_no, is_confirm, is_check
-						) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-						for _, usageRow := range usageData {
-							_, err := tx.Exec(usageInsertQuery,
-								usageRow["obj_id"], row["obj_id"], usageRow["stat_date"], usageRow["create_time"], usageRow["main_usage"], usageRow["specific_usage"],
-								usageRow["input_variety"], usageRow["input_unit"], usageRow["input_quantity"], usageRow["output_energy_types"],
-								usageRow["output_quantity"], usageRow["measurement_unit"], usageRow["remarks"], usageRow["row_no"], usageRow["is_confirm"], usageRow["is_check"])
-
-							if err != nil {
-								fmt.Printf("插入主要用途情况表数据失败: %v\n", err)
-								errorCount++
-							} else {
-								successCount++
-							}
-						}
-					}
+		// 写入扩展表数据，扩展表的fk_id为源表主表的obj_id
+		for _, row := range data {
+			for _, childTable := range []string{"enterprise_coal_consumption_usage", "enterprise_coal_consumption_equip"} {
+				childResult, err := sourceDb.Query(fmt.Sprintf(`SELECT * FROM %s WHERE fk_id = ?`, childTable), row["obj_id"])
+				if err != nil || !childResult.Ok || childResult.Data == nil {
+					continue
+				}
+				childData, ok := childResult.Data.([]map[string]interface{})
+				if !ok {
+					continue
+				}
+				for _, childRow := range childData {
+					childRow["fk_id"] = row["obj_id"]
 				}
-			}
 
-			// 插入重点耗煤装置情况表数据
-			equipQuery := `SELECT * FROM enterprise_coal_consumption_equip WHERE fk_id = ?`
-			equipResult, err := sourceDb.Query(equipQuery, row["obj_id"])
-			if err == nil && equipResult.Ok && equipResult.Data != nil {
-				if equipData, ok := equipResult.Data.([]map[string]interface{}); ok {
-					if len(equipData) > 0 {
-
-						equipInsertQuery := `INSERT INTO enterprise_coal_consumption_equip (
-							obj_id, fk_id, stat_date, create_time, equip_type, equip_no, total_runtime, design_life,
-							energy_efficiency, capacity_unit, capacity, coal_type, annual_coal_consumption, row_no, is_confirm, is_check
-						) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-						for _, equipRow := range equipData {
-							_, err := tx.Exec(equipInsertQuery,
-								equipRow["obj_id"], row["obj_id"], equipRow["stat_date"], equipRow["create_time"], equipRow["equip_type"], equipRow["equip_no"],
-								equipRow["total_runtime"], equipRow["design_life"], equipRow["energy_efficiency"], equipRow["capacity_unit"],
-								equipRow["capacity"], equipRow["coal_type"], equipRow["annual_coal_consumption"], equipRow["row_no"], equipRow["is_confirm"], equipRow["is_check"])
-
-							if err != nil {
-								fmt.Printf("插入重点耗煤装置情况表数据失败: %v\n", err)
-								errorCount++
-							} else {
-								successCount++
-							}
-						}
-					}
+				rowsResult := mergeRowsTx(tx, childTable, childData)
+				successCount += int(rowsResult.SuccessRows)
+				errorCount += int(rowsResult.FailedRows)
+				for _, message := range rowsResult.Errors {
+					fmt.Printf("写入表 %s 数据失败: %s\n", childTable, message)
 				}
 			}
 		}
@@ -1497,7 +852,7 @@ func (a *App) mergeTable2ConflictDataNew(tx *sql.Tx, conflict ConflictData) (int
 	errorCount := 0
 
 	// 打开源数据库
-	sourceDb, err := db.NewDatabase(conflict.FilePath, DB_PASSWORD)
+	sourceDb, err := db.NewReadOnlyDatabase(conflict.FilePath, EXCHANGE_DB_PASSWORD)
 	if err != nil {
 		return 0, 0, fmt.Errorf("打开源数据库失败: %v", err)
 	}
@@ -1505,7 +860,7 @@ func (a *App) mergeTable2ConflictDataNew(tx *sql.Tx, conflict ConflictData) (int
 
 	// 处理每个冲突条件
 	for _, condition := range conflict.Conditions {
-		// 删除目标表中符合条件的所有记录
+		// 装置清单整体替换，先删除目标表中该单位该年份的所有装置
 		deleteQuery := `DELETE FROM critical_coal_equipment_consumption WHERE credit_code = ? AND stat_date = ?`
 		_, err := tx.Exec(deleteQuery, condition.CreditCode, condition.StatDate)
 		if err != nil {
@@ -1514,7 +869,7 @@ func (a *App) mergeTable2ConflictDataNew(tx *sql.Tx, conflict ConflictData) (int
 			continue
 		}
 
-		// 查询源数据并插入
+		// 查询源数据
 		query := `SELECT * FROM critical_coal_equipment_consumption WHERE credit_code = ? AND stat_date = ?`
 		result, err := sourceDb.Query(query, condition.CreditCode, condition.StatDate)
 		if err != nil {
@@ -1533,30 +888,12 @@ func (a *App) mergeTable2ConflictDataNew(tx *sql.Tx, conflict ConflictData) (int
 			continue
 		}
 
-		// 插入源数据到目标表
-		for _, row := range data {
-			// 完全按照源表数据插入，包括obj_id
-			insertQuery := `INSERT INTO critical_coal_equipment_consumption (
-				obj_id, stat_date, create_time, sg_code, unit_name, credit_code, trade_a, trade_b, trade_c, trade_d,
-				province_code, province_name, city_code, city_name, country_code, country_name, unit_addr,
-				coal_type, coal_no, usage_time, design_life, enecrgy_efficienct_bmk, capacity_unit, capacity,
-				use_info, status, annual_coal_consumption, row_no, create_user, is_confirm, is_check
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-			_, execErr := tx.Exec(insertQuery,
-				row["obj_id"], row["stat_date"], row["create_time"], row["sg_code"], row["unit_name"], row["credit_code"],
-				row["trade_a"], row["trade_b"], row["trade_c"], row["trade_d"], row["province_code"], row["province_name"],
-				row["city_code"], row["city_name"], row["country_code"], row["country_name"], row["unit_addr"],
-				row["coal_type"], row["coal_no"], row["usage_time"], row["design_life"], row["enecrgy_efficienct_bmk"],
-				row["capacity_unit"], row["capacity"], row["use_info"], row["status"], row["annual_coal_consumption"],
-				row["row_no"], row["create_user"], row["is_confirm"], row["is_check"])
-
-			if execErr != nil {
-				fmt.Printf("插入目标表记录失败 mergeTable2ConflictDataNew4: obj_id=%s, stat_date=%s, error=%v\n", row["obj_id"], row["stat_date"], execErr)
-				errorCount++
-			} else {
-				successCount++
-			}
+		// 按自然键覆盖目标表数据，完全按照源表数据写入，包括obj_id
+		rowsResult := mergeRowsTx(tx, "critical_coal_equipment_consumption", data)
+		successCount += int(rowsResult.SuccessRows)
+		errorCount += int(rowsResult.FailedRows)
+		for _, message := range rowsResult.Errors {
+			fmt.Printf("写入目标表记录失败 mergeTable2ConflictDataNew: %s\n", message)
 		}
 	}
 
@@ -1569,7 +906,7 @@ func (a *App) mergeTable3ConflictDataNew(tx *sql.Tx, conflict ConflictData) (int
 	errorCount := 0
 
 	// 打开源数据库
-	sourceDb, err := db.NewDatabase(conflict.FilePath, DB_PASSWORD)
+	sourceDb, err := db.NewReadOnlyDatabase(conflict.FilePath, EXCHANGE_DB_PASSWORD)
 	if err != nil {
 		return 0, 0, fmt.Errorf("打开源数据库失败: %v", err)
 	}
@@ -1577,16 +914,7 @@ func (a *App) mergeTable3ConflictDataNew(tx *sql.Tx, conflict ConflictData) (int
 
 	// 处理每个冲突条件
 	for _, condition := range conflict.Conditions {
-		// 删除目标表中符合条件的所有记录
-		deleteQuery := `DELETE FROM fixed_assets_investment_project WHERE project_code = ? AND document_number = ?`
-		_, err := tx.Exec(deleteQuery, condition.ProjectCode, condition.DocumentNumber)
-		if err != nil {
-			fmt.Printf("删除目标表记录失败 mergeTable3ConflictDataNew1: project_code=%s, document_number=%s, error=%v\n", condition.ProjectCode, condition.DocumentNumber, err)
-			errorCount++
-			continue
-		}
-
-		// 查询源数据并插入
+		// 查询源数据
 		query := `SELECT * FROM fixed_assets_investment_project WHERE project_code = ? AND document_number = ?`
 		result, err := sourceDb.Query(query, condition.ProjectCode, condition.DocumentNumber)
 		if err != nil {
@@ -1603,34 +931,12 @@ func (a *App) mergeTable3ConflictDataNew(tx *sql.Tx, conflict ConflictData) (int
 			continue
 		}
 
-		// 插入源数据到目标表
-		for _, row := range data {
-			// 完全按照源表数据插入，包括obj_id
-			insertQuery := `INSERT INTO fixed_assets_investment_project (
-				obj_id, stat_date, sg_code, project_name, project_code, construction_unit, main_construction_content,
-				unit_id, province_name, city_name, country_name, trade_a, trade_c, examination_approval_time,
-				scheduled_time, actual_time, examination_authority, document_number, equivalent_value, equivalent_cost,
-				pq_total_coal_consumption, pq_coal_consumption, pq_coke_consumption, pq_blue_coke_consumption,
-				sce_total_coal_consumption, sce_coal_consumption, sce_coke_consumption, sce_blue_coke_consumption,
-				is_substitution, substitution_source, substitution_quantity, pq_annual_coal_quantity, sce_annual_coal_quantity,
-				create_time, create_user, is_confirm, is_check
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-			_, execErr := tx.Exec(insertQuery,
-				row["obj_id"], row["stat_date"], row["sg_code"], row["project_name"], row["project_code"], row["construction_unit"], row["main_construction_content"],
-				row["unit_id"], row["province_name"], row["city_name"], row["country_name"], row["trade_a"], row["trade_c"], row["examination_approval_time"],
-				row["scheduled_time"], row["actual_time"], row["examination_authority"], row["document_number"], row["equivalent_value"], row["equivalent_cost"],
-				row["pq_total_coal_consumption"], row["pq_coal_consumption"], row["pq_coke_consumption"], row["pq_blue_coke_consumption"],
-				row["sce_total_coal_consumption"], row["sce_coal_consumption"], row["sce_coke_consumption"], row["sce_blue_coke_consumption"],
-				row["is_substitution"], row["substitution_source"], row["substitution_quantity"], row["pq_annual_coal_quantity"], row["sce_annual_coal_quantity"],
-				row["create_time"], row["create_user"], row["is_confirm"], row["is_check"])
-
-			if execErr != nil {
-				fmt.Printf("插入目标表记录失败 mergeTable3ConflictDataNew3: obj_id=%s, stat_date=%s, error=%v\n", row["obj_id"], row["stat_date"], execErr)
-				errorCount++
-			} else {
-				successCount++
-			}
+		// 按自然键覆盖目标表数据，完全按照源表数据写入，包括obj_id
+		rowsResult := mergeRowsTx(tx, "fixed_assets_investment_project", data)
+		successCount += int(rowsResult.SuccessRows)
+		errorCount += int(rowsResult.FailedRows)
+		for _, message := range rowsResult.Errors {
+			fmt.Printf("写入目标表记录失败 mergeTable3ConflictDataNew: %s\n", message)
 		}
 	}
 
@@ -1643,7 +949,7 @@ func (a *App) mergeAttachment2ConflictDataNew(tx *sql.Tx, conflict ConflictData)
 	errorCount := 0
 
 	// 打开源数据库
-	sourceDb, err := db.NewDatabase(conflict.FilePath, DB_PASSWORD)
+	sourceDb, err := db.NewReadOnlyDatabase(conflict.FilePath, EXCHANGE_DB_PASSWORD)
 	if err != nil {
 		return 0, 0, fmt.Errorf("打开源数据库失败: %v", err)
 	}
@@ -1651,17 +957,7 @@ func (a *App) mergeAttachment2ConflictDataNew(tx *sql.Tx, conflict ConflictData)
 
 	// 处理每个冲突条件
 	for _, condition := range conflict.Conditions {
-		// 删除目标表中符合条件的所有记录
-		deleteQuery := `DELETE FROM coal_consumption_report WHERE province_name = ? AND city_name = ? AND country_name = ? AND stat_date = ?`
-		_, err := tx.Exec(deleteQuery, condition.ProvinceName, condition.CityName, condition.CountryName, condition.StatDate)
-		if err != nil {
-			fmt.Printf("删除目标表记录失败 mergeAttachment2ConflictDataNew1: province_name=%s, city_name=%s, country_name=%s, stat_date=%s, error=%v\n",
-				condition.ProvinceName, condition.CityName, condition.CountryName, condition.StatDate, err)
-			errorCount++
-			continue
-		}
-
-		// 查询源数据并插入
+		// 查询源数据
 		query := `SELECT * FROM coal_consumption_report WHERE province_name = ? AND city_name = ? AND country_name = ? AND stat_date = ?`
 		result, err := sourceDb.Query(query, condition.ProvinceName, condition.CityName, condition.CountryName, condition.StatDate)
 		if err != nil {
@@ -1680,28 +976,12 @@ func (a *App) mergeAttachment2ConflictDataNew(tx *sql.Tx, conflict ConflictData)
 			continue
 		}
 
-		// 插入源数据到目标表
-		for _, row := range data {
-			// 完全按照源表数据插入，包括obj_id
-			insertQuery := `INSERT INTO coal_consumption_report (
-				obj_id, stat_date, sg_code, unit_id, unit_name, unit_level, province_name, city_name, country_name,
-				total_coal, raw_coal, washed_coal, other_coal, power_generation, heating, coal_washing, coking,
-				oil_refining, gas_production, industry, raw_materials, other_uses, coke, create_user, create_time, is_confirm, is_check
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-			_, execErr := tx.Exec(insertQuery,
-				row["obj_id"], row["stat_date"], row["sg_code"], row["unit_id"], row["unit_name"], row["unit_level"],
-				row["province_name"], row["city_name"], row["country_name"], row["total_coal"], row["raw_coal"],
-				row["washed_coal"], row["other_coal"], row["power_generation"], row["heating"], row["coal_washing"],
-				row["coking"], row["oil_refining"], row["gas_production"], row["industry"], row["raw_materials"],
-				row["other_uses"], row["coke"], row["create_user"], row["create_time"], row["is_confirm"], row["is_check"])
-
-			if execErr != nil {
-				fmt.Printf("插入目标表记录失败 mergeAttachment2ConflictDataNew3: obj_id=%s, stat_date=%s, error=%v\n", row["obj_id"], row["stat_date"], execErr)
-				errorCount++
-			} else {
-				successCount++
-			}
+		// 按自然键覆盖目标表数据，完全按照源表数据写入，包括obj_id
+		rowsResult := mergeRowsTx(tx, "coal_consumption_report", data)
+		successCount += int(rowsResult.SuccessRows)
+		errorCount += int(rowsResult.FailedRows)
+		for _, message := range rowsResult.Errors {
+			fmt.Printf("写入目标表记录失败 mergeAttachment2ConflictDataNew: %s\n", message)
 		}
 	}
 
@@ -1713,7 +993,7 @@ func (a *App) DBTranformExcel(dbPath string) db.QueryResult {
 	result := db.QueryResult{}
 
 	// 打开源数据库
-	sourceDb, err := db.NewDatabase(dbPath, DB_PASSWORD)
+	sourceDb, err := db.NewReadOnlyDatabase(dbPath, EXCHANGE_DB_PASSWORD)
 	if err != nil {
 		result.Message = "打开源数据库失败: " + err.Error()
 		return result
@@ -1923,7 +1203,7 @@ func (a *App) DBTranformExcel(dbPath string) db.QueryResult {
 	return excelResult
 }
 
-// ExportDataToExcel 导出数据到单个Excel文件，包含两个sheet页
+// ExportDataToExcel 导出数据到单个Excel文件，包含耗煤单位和耗煤装置两个sheet页，合并数据库另含数据来源汇总表
 func (a *App) ExportDataToExcel(dataMap map[string][]map[string]interface{}, equipList []map[string]interface{}, dbPath string) db.QueryResult {
 	result := db.QueryResult{}
 
@@ -1947,6 +1227,18 @@ func (a *App) ExportDataToExcel(dataMap map[string][]map[string]interface{}, equ
 		return equipSheetResult
 	}
 
+	// 合并数据库增加数据来源汇总表sheet
+	if sourceDb, err := db.NewReadOnlyDatabase(dbPath, EXCHANGE_DB_PASSWORD); err == nil {
+		sourceSummary := queryMergeSourceSummary(sourceDb)
+		sourceDb.Close()
+		if len(sourceSummary) > 0 {
+			sourceSheetResult := a.createMergeSourceSheet(f, sourceSummary)
+			if !sourceSheetResult.Ok {
+				return sourceSheetResult
+			}
+		}
+	}
+
 	// 3. 根据dbPath生成Excel文件名
 	dbDir := filepath.Dir(dbPath)
 	dbBaseName := filepath.Base(dbPath)
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"shuji/data_import"
+	"shuji/db"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// columnMigration 字段迁移定义
+type columnMigration struct {
+	TableName  string
+	ColumnName string
+	Definition string
+}
+
+// columnMigrations 内置数据库之后新增的字段，启动时按顺序补齐
+var columnMigrations = []columnMigration{
+	{"data_import_record", "file_hash", "varchar(64)"},
+	{"enterprise_coal_consumption_main", "file_hash", "varchar(64)"},
+	{"critical_coal_equipment_consumption", "file_hash", "varchar(64)"},
+	{"fixed_assets_investment_project", "file_hash", "varchar(64)"},
+	{"coal_consumption_report", "file_hash", "varchar(64)"},
+	{"enterprise_coal_consumption_main", "change_seq", "integer"},
+	{"enterprise_coal_consumption_usage", "change_seq", "integer"},
+	{"enterprise_coal_consumption_equip", "change_seq", "integer"},
+	{"critical_coal_equipment_consumption", "change_seq", "integer"},
+	{"fixed_assets_investment_project", "change_seq", "integer"},
+	{"coal_consumption_report", "change_seq", "integer"},
+	{"data_export_info", "export_mode", "varchar(10)"},
+	{"data_export_info", "from_seq", "integer"},
+	{"data_export_info", "to_seq", "integer"},
+	{"submission_watermark", "file_hash", "varchar(64)"},
+}
+
+// tableMigrations 内置数据库之后新增的表，启动时按顺序创建
+var tableMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS "data_change_log" (
+		"obj_id" varchar(36) NOT NULL,
+		"table_name" varchar(100) NOT NULL,
+		"record_id" varchar(36) NOT NULL,
+		"field_name" varchar(100) NOT NULL,
+		"old_value" varchar(500),
+		"new_value" varchar(500),
+		"reason" varchar(500) NOT NULL,
+		"change_time" datetime NOT NULL,
+		"change_user" varchar(100),
+		PRIMARY KEY ("obj_id")
+	)`,
+	`CREATE INDEX IF NOT EXISTS "idx_data_change_log_record" ON "data_change_log" ("table_name", "record_id")`,
+	`CREATE TABLE IF NOT EXISTS "data_merge_log" (
+		"obj_id" varchar(36) NOT NULL,
+		"table_type" varchar(20) NOT NULL,
+		"conflict_key" varchar(500) NOT NULL,
+		"strategy" varchar(20) NOT NULL,
+		"source_file" varchar(500),
+		"merge_time" datetime NOT NULL,
+		"create_user" varchar(100),
+		PRIMARY KEY ("obj_id")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "data_merge_source" (
+		"obj_id" varchar(36) NOT NULL,
+		"table_name" varchar(100) NOT NULL,
+		"record_id" varchar(36) NOT NULL,
+		"original_obj_id" varchar(36),
+		"source_file" varchar(500),
+		"source_hash" varchar(64),
+		"source_province" varchar(50),
+		"source_city" varchar(50),
+		"source_country" varchar(50),
+		"export_time" datetime,
+		"merge_time" datetime NOT NULL,
+		PRIMARY KEY ("obj_id")
+	)`,
+	`CREATE INDEX IF NOT EXISTS "idx_data_merge_source_record" ON "data_merge_source" ("record_id")`,
+	`CREATE TABLE IF NOT EXISTS "data_export_info" (
+		"obj_id" varchar(36) NOT NULL,
+		"export_time" datetime NOT NULL,
+		"province_name" varchar(50),
+		"city_name" varchar(50),
+		"country_name" varchar(50),
+		"create_user" varchar(100),
+		PRIMARY KEY ("obj_id")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "workstation_key" (
+		"obj_id" varchar(36) NOT NULL,
+		"private_key" varchar(500) NOT NULL,
+		"public_key" varchar(1000) NOT NULL,
+		"fingerprint" varchar(64) NOT NULL,
+		"create_time" datetime NOT NULL,
+		"create_user" varchar(100),
+		PRIMARY KEY ("obj_id")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "data_change_counter" (
+		"name" varchar(36) NOT NULL,
+		"value" integer NOT NULL DEFAULT 0,
+		PRIMARY KEY ("name")
+	)`,
+	`INSERT OR IGNORE INTO "data_change_counter" ("name", "value") VALUES ('change_seq', 0)`,
+	`CREATE TABLE IF NOT EXISTS "data_tombstone" (
+		"obj_id" varchar(36) NOT NULL,
+		"table_name" varchar(100) NOT NULL,
+		"record_id" varchar(36) NOT NULL,
+		"change_seq" integer NOT NULL,
+		"delete_time" datetime NOT NULL,
+		PRIMARY KEY ("obj_id")
+	)`,
+	`CREATE INDEX IF NOT EXISTS "idx_data_tombstone_seq" ON "data_tombstone" ("change_seq")`,
+	`CREATE TABLE IF NOT EXISTS "submission_watermark" (
+		"obj_id" varchar(36) NOT NULL,
+		"export_mode" varchar(10) NOT NULL,
+		"from_seq" integer NOT NULL,
+		"to_seq" integer NOT NULL,
+		"file_name" varchar(500),
+		"export_time" datetime NOT NULL,
+		"create_user" varchar(100),
+		"is_ack" integer NOT NULL DEFAULT 0,
+		"ack_time" datetime,
+		PRIMARY KEY ("obj_id")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "submission_status" (
+		"obj_id" varchar(36) NOT NULL,
+		"province_name" varchar(50) NOT NULL DEFAULT '',
+		"city_name" varchar(50) NOT NULL DEFAULT '',
+		"country_name" varchar(50) NOT NULL DEFAULT '',
+		"stat_date" varchar(10) NOT NULL,
+		"status" varchar(20) NOT NULL,
+		"update_time" datetime NOT NULL,
+		"update_user" varchar(100),
+		"remark" varchar(500),
+		PRIMARY KEY ("obj_id")
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS "idx_submission_status_region_year" ON "submission_status" ("province_name", "city_name", "country_name", "stat_date")`,
+	`CREATE TABLE IF NOT EXISTS "submission_status_log" (
+		"obj_id" varchar(36) NOT NULL,
+		"province_name" varchar(50) NOT NULL DEFAULT '',
+		"city_name" varchar(50) NOT NULL DEFAULT '',
+		"country_name" varchar(50) NOT NULL DEFAULT '',
+		"stat_date" varchar(10) NOT NULL,
+		"event" varchar(20) NOT NULL,
+		"from_status" varchar(20),
+		"to_status" varchar(20) NOT NULL,
+		"remark" varchar(500),
+		"create_time" datetime NOT NULL,
+		"create_user" varchar(100),
+		PRIMARY KEY ("obj_id")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "submission_receipt_record" (
+		"obj_id" varchar(36) NOT NULL,
+		"table_name" varchar(100) NOT NULL,
+		"record_id" varchar(36) NOT NULL,
+		"stat_date" varchar(10),
+		"record_key" varchar(200),
+		"record_name" varchar(200),
+		"is_accepted" integer NOT NULL DEFAULT 0,
+		"reason" varchar(500),
+		"issuer" varchar(100),
+		"receipt_time" datetime,
+		"create_time" datetime NOT NULL,
+		PRIMARY KEY ("obj_id")
+	)`,
+	`CREATE INDEX IF NOT EXISTS "idx_submission_receipt_record" ON "submission_receipt_record" ("table_name", "record_id")`,
+	`CREATE TABLE IF NOT EXISTS "natural_key_duplicate" (
+		"obj_id" varchar(36) NOT NULL,
+		"index_name" varchar(100) NOT NULL,
+		"table_name" varchar(100) NOT NULL,
+		"record_id" varchar(36) NOT NULL,
+		"key_value" varchar(500),
+		"is_newest" integer NOT NULL DEFAULT 0,
+		"row_data" text,
+		"child_data" text,
+		"detect_time" integer NOT NULL,
+		"resolve_time" integer,
+		PRIMARY KEY ("obj_id")
+	)`,
+	`CREATE INDEX IF NOT EXISTS "idx_natural_key_duplicate_index" ON "natural_key_duplicate" ("index_name", "resolve_time")`,
+	`CREATE TABLE IF NOT EXISTS "trusted_signer" (
+		"obj_id" varchar(36) NOT NULL,
+		"role" varchar(20) NOT NULL,
+		"province_name" varchar(50) NOT NULL DEFAULT '',
+		"city_name" varchar(50) NOT NULL DEFAULT '',
+		"country_name" varchar(50) NOT NULL DEFAULT '',
+		"fingerprint" varchar(64) NOT NULL,
+		"public_key" varchar(1000) NOT NULL,
+		"signer_user" varchar(100),
+		"signer_host" varchar(100),
+		"create_time" datetime NOT NULL,
+		"create_user" varchar(100),
+		PRIMARY KEY ("obj_id")
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS "uk_trusted_signer" ON "trusted_signer" ("role", "fingerprint")`,
+}
+
+// changeTrackedTables 记录变更序号的数据表，增量导出只包含这些表的变更
+var changeTrackedTables = []string{
+	"enterprise_coal_consumption_main",
+	"enterprise_coal_consumption_usage",
+	"enterprise_coal_consumption_equip",
+	"critical_coal_equipment_consumption",
+	"fixed_assets_investment_project",
+	"coal_consumption_report",
+}
+
+// changeTrackingStatusColumns 只修改这些字段时不更新变更序号，如回执更新的检查状态不属于数据变更
+var changeTrackingStatusColumns = []string{"change_seq", "is_check"}
+
+// getChangeTrackingTriggers 生成数据表的变更跟踪触发器，新增、修改数据字段时更新变更序号，删除时写入删除记录。
+// 修改触发器只监听columns中的数据字段，字段迁移后先删除再重新创建，使新增的字段也参与变更跟踪
+func getChangeTrackingTriggers(tableName string, columns []string) []string {
+	nextSeq := `UPDATE data_change_counter SET value = value + 1 WHERE name = 'change_seq';`
+	currentSeq := `(SELECT value FROM data_change_counter WHERE name = 'change_seq')`
+
+	var dataColumns []string
+	for _, column := range columns {
+		if !slices.Contains(changeTrackingStatusColumns, column) {
+			dataColumns = append(dataColumns, fmt.Sprintf(`"%s"`, column))
+		}
+	}
+
+	return []string{
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS "trg_%[1]s_insert_seq" AFTER INSERT ON "%[1]s"
+		BEGIN
+			%[2]s
+			UPDATE "%[1]s" SET change_seq = %[3]s WHERE rowid = NEW.rowid;
+		END`, tableName, nextSeq, currentSeq),
+		// 触发器自身更新变更序号时不再递增
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS "trg_%s_update_seq"`, tableName),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS "trg_%[1]s_update_seq" AFTER UPDATE OF %[4]s ON "%[1]s"
+		WHEN NEW.change_seq IS OLD.change_seq
+		BEGIN
+			%[2]s
+			UPDATE "%[1]s" SET change_seq = %[3]s WHERE rowid = NEW.rowid;
+		END`, tableName, nextSeq, currentSeq, strings.Join(dataColumns, ", ")),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS "trg_%[1]s_delete_seq" AFTER DELETE ON "%[1]s"
+		BEGIN
+			%[2]s
+			INSERT INTO data_tombstone (obj_id, table_name, record_id, change_seq, delete_time)
+			VALUES (lower(hex(randomblob(16))), '%[1]s', OLD.obj_id, %[3]s, CAST(strftime('%%s', 'now') AS INTEGER) * 1000);
+		END`, tableName, nextSeq, currentSeq),
+	}
+}
+
+// dropChangeTrackingTriggers 删除数据表的变更跟踪触发器，用于裁剪导出的数据库
+func dropChangeTrackingTriggers(database *db.Database) error {
+	for _, tableName := range changeTrackedTables {
+		for _, action := range []string{"insert", "update", "delete"} {
+			if _, err := database.Exec(fmt.Sprintf(`DROP TRIGGER IF EXISTS "trg_%s_%s_seq"`, tableName, action)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// naturalKeyChildTables 删除重复主表数据时一并删除的扩展表，扩展表通过fk_id关联主表obj_id
+var naturalKeyChildTables = map[string][]string{
+	"enterprise_coal_consumption_main": {"enterprise_coal_consumption_usage", "enterprise_coal_consumption_equip"},
+}
+
+// naturalKeyDuplicate 自然键重复的一条记录
+type naturalKeyDuplicate struct {
+	RecordID string
+	KeyValue string
+	IsNewest bool
+	Row      map[string]interface{}
+}
+
+// naturalKeyIndexExists 检查自然键唯一索引是否已创建
+func naturalKeyIndexExists(database *db.Database, key data_import.NaturalKey) (bool, error) {
+	result, err := database.QueryRow("SELECT name FROM sqlite_master WHERE type = 'index' AND name = ?", key.IndexName)
+	if err != nil {
+		return false, err
+	}
+	return result.Data != nil, nil
+}
+
+// findNaturalKeyDuplicates 查询自然键重复的全部记录，每组中最新创建的一条标记为IsNewest，自然键字段为空的记录不参与唯一约束
+func findNaturalKeyDuplicates(database *db.Database, key data_import.NaturalKey) ([]naturalKeyDuplicate, error) {
+	var conditions []string
+	for _, column := range key.Columns {
+		conditions = append(conditions, column+" IS NOT NULL")
+	}
+	if key.Where != "" {
+		conditions = append(conditions, key.Where)
+	}
+	partition := strings.Join(key.Columns, ", ")
+	query := fmt.Sprintf(`SELECT * FROM (
+		SELECT t.*,
+			ROW_NUMBER() OVER (PARTITION BY %[1]s ORDER BY create_time DESC, rowid DESC) AS dup_rn,
+			COUNT(1) OVER (PARTITION BY %[1]s) AS dup_count
+		FROM %[2]s t WHERE %[3]s
+	) WHERE dup_count > 1 ORDER BY %[1]s, dup_rn`, partition, key.TableName, strings.Join(conditions, " AND "))
+
+	var duplicates []naturalKeyDuplicate
+	err := database.QueryEach(query, func(row map[string]interface{}) error {
+		isNewest := db.IntValue(row["dup_rn"]) == 1
+		delete(row, "dup_rn")
+		delete(row, "dup_count")
+
+		values := make([]string, 0, len(key.Columns))
+		for _, column := range key.Columns {
+			values = append(values, getStringValue(row[column]))
+		}
+		duplicates = append(duplicates, naturalKeyDuplicate{
+			RecordID: getStringValue(row["obj_id"]),
+			KeyValue: strings.Join(values, " / "),
+			IsNewest: isNewest,
+			Row:      row,
+		})
+		return nil
+	})
+	return duplicates, err
+}
+
+// saveNaturalKeyDuplicates 将重复记录及其扩展表数据保存到natural_key_duplicate，替换该索引之前未处理的记录
+func saveNaturalKeyDuplicates(database *db.Database, key data_import.NaturalKey, duplicates []naturalKeyDuplicate) error {
+	detectTime := time.Now().UnixMilli()
+	return database.WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM natural_key_duplicate WHERE index_name = ? AND resolve_time IS NULL", key.IndexName); err != nil {
+			return err
+		}
+		for _, duplicate := range duplicates {
+			rowData, err := json.Marshal(duplicate.Row)
+			if err != nil {
+				return err
+			}
+
+			children := make(map[string][]map[string]interface{})
+			for _, childTable := range naturalKeyChildTables[key.TableName] {
+				childResult, err := database.Query(fmt.Sprintf("SELECT * FROM %s WHERE fk_id = ?", childTable), duplicate.RecordID)
+				if err != nil {
+					return err
+				}
+				if rows, ok := childResult.Data.([]map[string]interface{}); ok && len(rows) > 0 {
+					children[childTable] = rows
+				}
+			}
+			childData, err := json.Marshal(children)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`INSERT INTO natural_key_duplicate (obj_id, index_name, table_name, record_id, key_value, is_newest, row_data, child_data, detect_time)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				uuid.New().String(), key.IndexName, key.TableName, duplicate.RecordID, duplicate.KeyValue,
+				duplicate.IsNewest, string(rowData), string(childData), detectTime)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// createNaturalKeyIndex 创建自然键唯一索引。已有数据中自然键重复时不删除任何数据，也不创建索引，
+// 重复记录及其扩展表数据保存到natural_key_duplicate，由用户确认处理后再创建索引
+func createNaturalKeyIndex(database *db.Database, key data_import.NaturalKey) error {
+	exists, err := naturalKeyIndexExists(database, key)
+	if err != nil || exists {
+		return err
+	}
+
+	duplicates, err := findNaturalKeyDuplicates(database, key)
+	if err != nil {
+		return err
+	}
+	if len(duplicates) == 0 {
+		_, err = database.Exec(key.CreateIndexSQL())
+		return err
+	}
+
+	if err := saveNaturalKeyDuplicates(database, key, duplicates); err != nil {
+		return fmt.Errorf("保存自然键重复的数据失败: %v", err)
+	}
+	log.Printf("表 %s 存在自然键重复的数据 %d 条，暂不创建唯一索引，等待用户处理", key.TableName, len(duplicates))
+	return nil
+}
+
+// getSchemaVersion 获取数据库结构版本，迁移只追加不修改，迁移数量即为结构版本
+func getSchemaVersion() int {
+	return len(tableMigrations) + len(columnMigrations) + len(changeTrackedTables) + len(data_import.NaturalKeys)
+}
+
+// migrateDatabase 将数据库表结构升级到当前版本
+func migrateDatabase(database *db.Database) error {
+	if database == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+
+	for _, migration := range tableMigrations {
+		if _, err := database.Exec(migration); err != nil {
+			return fmt.Errorf("创建数据表失败: %v", err)
+		}
+	}
+
+	for _, migration := range columnMigrations {
+		if err := database.AddColumnIfNotExists(migration.TableName, migration.ColumnName, migration.Definition); err != nil {
+			return fmt.Errorf("表 %s 添加字段 %s 失败: %v", migration.TableName, migration.ColumnName, err)
+		}
+	}
+
+	// 变更跟踪触发器依赖change_seq字段，在字段迁移之后创建
+	for _, tableName := range changeTrackedTables {
+		columns, err := getTableColumns(database, tableName)
+		if err != nil {
+			return fmt.Errorf("读取表 %s 的字段失败: %v", tableName, err)
+		}
+		// 删除和重新创建触发器在同一事务中，避免期间的修改漏记变更序号
+		err = database.WithTx(func(tx *sql.Tx) error {
+			for _, trigger := range getChangeTrackingTriggers(tableName, columns) {
+				if _, err := tx.Exec(trigger); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("创建表 %s 的变更跟踪触发器失败: %v", tableName, err)
+		}
+	}
+
+	// 自然键唯一索引，存在重复数据时等待用户处理，处理时删除的数据由触发器写入删除记录
+	for _, key := range data_import.NaturalKeys {
+		if err := createNaturalKeyIndex(database, key); err != nil {
+			return fmt.Errorf("创建表 %s 的唯一索引失败: %v", key.TableName, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"path/filepath"
+	"shuji/data_import"
+	"shuji/db"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 导出方式
+const (
+	EXPORT_MODE_FULL  = "full"  // 全量导出
+	EXPORT_MODE_DELTA = "delta" // 增量导出，只包含上次已确认报送之后的变更和删除记录
+)
+
+// DeltaConflict 增量合并时与其他来源数据冲突而未应用的记录
+type DeltaConflict struct {
+	FilePath    string `json:"filePath"`    // 增量数据文件路径
+	TableName   string `json:"tableName"`   // 数据表名
+	ObjId       string `json:"obj_id"`      // 增量数据中记录的obj_id
+	ConflictKey string `json:"conflictKey"` // 冲突键
+	ExistingId  string `json:"existingId"`  // 合并数据库中已有记录的obj_id
+	SourceFile  string `json:"sourceFile"`  // 已有记录的来源数据库文件名
+}
+
+// deltaKeyFields 增量合并时检查冲突的主表及其冲突键字段，与全量合并的冲突键一致
+var deltaKeyFields = map[string][]string{
+	"enterprise_coal_consumption_main":    {"credit_code", "stat_date"},
+	"critical_coal_equipment_consumption": {"credit_code", "stat_date"},
+	"fixed_assets_investment_project":     {"project_code", "document_number"},
+	"coal_consumption_report":             {"province_name", "city_name", "country_name", "stat_date"},
+}
+
+// getCurrentChangeSeq 获取数据库当前的变更序号
+func getCurrentChangeSeq(database *db.Database) (int64, error) {
+	seqResult, err := database.QueryRow("SELECT value FROM data_change_counter WHERE name = 'change_seq'")
+	if err != nil {
+		return 0, fmt.Errorf("查询变更序号失败: %v", err)
+	}
+	if seqResult.Data == nil {
+		return 0, nil
+	}
+	seq, _ := seqResult.Data.(map[string]interface{})["value"].(int64)
+	return seq, nil
+}
+
+// getLastAckedSeq 获取最近一次已确认报送的变更序号
+func (a *App) getLastAckedSeq() (int64, bool, error) {
+	ackResult, err := a.GetDB().QueryRow("SELECT MAX(to_seq) AS to_seq FROM submission_watermark WHERE is_ack = 1")
+	if err != nil {
+		return 0, false, fmt.Errorf("查询报送记录失败: %v", err)
+	}
+	if ackResult.Data == nil {
+		return 0, false, nil
+	}
+	seq, ok := ackResult.Data.(map[string]interface{})["to_seq"].(int64)
+	return seq, ok, nil
+}
+
+// recordSubmissionWatermark 在系统数据库中记录本次导出的变更序号范围和导出文件哈希，上级回执按文件哈希确认接收
+func (a *App) recordSubmissionWatermark(exportMode string, fromSeq int64, toSeq int64, filePath string) error {
+	fileHash, err := data_import.GetFileHash(filePath)
+	if err != nil {
+		return fmt.Errorf("计算导出文件哈希失败: %v", err)
+	}
+	_, err = a.GetDB().Exec(`INSERT INTO submission_watermark (
+		obj_id, export_mode, from_seq, to_seq, file_name, file_hash, export_time, create_user, is_ack
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0)`, uuid.New().String(), exportMode, fromSeq, toSeq, filepath.Base(filePath),
+		fileHash, time.Now().UnixMilli(), a.GetCurrentOSUser())
+	if err != nil {
+		return fmt.Errorf("记录报送水位失败: %v", err)
+	}
+	return nil
+}
+
+// acknowledgeWatermarkByHash 上级接收报送文件后确认对应的报送记录，返回确认的记录数
+func (a *App) acknowledgeWatermarkByHash(fileHash string) (int64, error) {
+	if fileHash == "" {
+		return 0, nil
+	}
+	result, err := a.GetDB().Exec("UPDATE submission_watermark SET is_ack = 1, ack_time = ? WHERE file_hash = ? AND is_ack = 0",
+		time.Now().UnixMilli(), fileHash)
+	if err != nil {
+		return 0, fmt.Errorf("确认报送接收失败: %v", err)
+	}
+	data, _ := result.Data.(map[string]interface{})
+	affected, _ := data["rowsAffected"].(int64)
+	return affected, nil
+}
+
+// QuerySubmissionWatermarks 查询报送记录
+func (a *App) QuerySubmissionWatermarks() db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.querySubmissionWatermarksWithRecover()
+}
+
+// querySubmissionWatermarksWithRecover 带异常处理的查询报送记录函数
+func (a *App) querySubmissionWatermarksWithRecover() db.QueryResult {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("QuerySubmissionWatermarks 发生异常: %v", r)
+		}
+	}()
+
+	result, err := a.GetDB().Query(`SELECT obj_id, export_mode, from_seq, to_seq, file_name, file_hash, export_time, create_user, is_ack, ack_time
+		FROM submission_watermark ORDER BY export_time DESC`)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: "查询报送记录失败: " + err.Error()}
+	}
+	if result.Data == nil {
+		result.Data = []map[string]interface{}{}
+	}
+	return result
+}
+
+// AcknowledgeSubmission 确认上级已接收报送数据，之后的增量导出从该次报送的变更序号开始
+func (a *App) AcknowledgeSubmission(objID string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.acknowledgeSubmissionWithRecover(objID)
+}
+
+// acknowledgeSubmissionWithRecover 带异常处理的确认报送接收函数
+func (a *App) acknowledgeSubmissionWithRecover(objID string) db.QueryResult {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("AcknowledgeSubmission 发生异常: %v", r)
+		}
+	}()
+
+	result, err := a.GetDB().Exec("UPDATE submission_watermark SET is_ack = 1, ack_time = ? WHERE obj_id = ? AND is_ack = 0",
+		time.Now().UnixMilli(), objID)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: "确认报送接收失败: " + err.Error()}
+	}
+	result.Message = "确认报送接收成功"
+	return result
+}
+
+// ExportDeltaData 增量导出上次已确认报送之后新增、修改和删除的数据，文件扩展名为.zip时导出签名的报送数据包
+func (a *App) ExportDeltaData(filePath string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.exportDeltaDataWithRecover(filePath)
+}
+
+// exportDeltaDataWithRecover 带异常处理的增量导出函数
+func (a *App) exportDeltaDataWithRecover(filePath string) db.QueryResult {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ExportDeltaData 发生异常: %v", r)
+		}
+	}()
+
+	result := db.QueryResult{}
+
+	fromSeq, acked, err := a.getLastAckedSeq()
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	if !acked {
+		result.Message = "没有已确认接收的报送记录，请先全量导出并在上级确认接收后再增量导出"
+		return result
+	}
+
+	// 1. 复制系统数据库
+	newDb, dbTempPath, err := a.CopySystemDb("delta_")
+	if err != nil {
+		result.Message = "复制数据库文件失败: " + err.Error()
+		return result
+	}
+	defer a.Removefile(dbTempPath)
+
+	toSeq, err := getCurrentChangeSeq(newDb)
+	if err != nil {
+		newDb.Close()
+		result.Message = err.Error()
+		return result
+	}
+
+	// 2. 裁剪为增量数据，裁剪前删除触发器，避免删除操作产生新的删除记录
+	var years []string
+	counts, err := pruneToDelta(newDb, fromSeq)
+	if err == nil {
+		years, err = a.checkSubmissionYears(newDb)
+	}
+	if err == nil {
+		err = a.insertExportInfo(newDb, EXPORT_MODE_DELTA, fromSeq, toSeq)
+	}
+	if err != nil {
+		newDb.Close()
+		result.Message = err.Error()
+		return result
+	}
+
+	// 3. 写入导出文件
+	if isSubmissionPackage(filePath) {
+		if _, err := a.packSubmission(newDb, dbTempPath, filePath); err != nil {
+			result.Message = err.Error()
+			return result
+		}
+	} else {
+		newDb.Close()
+		moveResult := a.Movefile(dbTempPath, filePath)
+		if !moveResult.Ok {
+			result.Message = "创建数据库文件失败:" + moveResult.Data
+			return result
+		}
+	}
+
+	if err := a.recordSubmissionWatermark(EXPORT_MODE_DELTA, fromSeq, toSeq, filePath); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	if err := a.markYearsSubmitted(years, filePath); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	result.Ok = true
+	result.Message = "增量数据导出成功"
+	result.Data = map[string]interface{}{
+		"fromSeq": fromSeq,
+		"toSeq":   toSeq,
+		"counts":  counts,
+	}
+	return result
+}
+
+// pruneToDelta 删除变更序号不大于fromSeq的数据和删除记录，返回各表保留的记录数
+func pruneToDelta(database *db.Database, fromSeq int64) (map[string]int64, error) {
+	if err := dropChangeTrackingTriggers(database); err != nil {
+		return nil, fmt.Errorf("删除变更跟踪触发器失败: %v", err)
+	}
+
+	counts := make(map[string]int64)
+	for _, tableName := range changeTrackedTables {
+		if _, err := database.Exec(fmt.Sprintf("DELETE FROM %s WHERE IFNULL(change_seq, 0) <= ?", tableName), fromSeq); err != nil {
+			return nil, fmt.Errorf("裁剪表 %s 失败: %v", tableName, err)
+		}
+		countResult, err := database.QueryRow(fmt.Sprintf("SELECT COUNT(1) AS count FROM %s", tableName))
+		if err != nil {
+			return nil, fmt.Errorf("统计表 %s 失败: %v", tableName, err)
+		}
+		counts[tableName], _ = countResult.Data.(map[string]interface{})["count"].(int64)
+	}
+
+	if _, err := database.Exec("DELETE FROM data_tombstone WHERE change_seq <= ?", fromSeq); err != nil {
+		return nil, fmt.Errorf("裁剪删除记录失败: %v", err)
+	}
+	countResult, err := database.QueryRow("SELECT COUNT(1) AS count FROM data_tombstone")
+	if err != nil {
+		return nil, fmt.Errorf("统计删除记录失败: %v", err)
+	}
+	counts["data_tombstone"], _ = countResult.Data.(map[string]interface{})["count"].(int64)
+
+	// 增量数据不需要合并来源和修改记录
+	for _, tableName := range []string{"data_merge_source", "data_change_log"} {
+		if _, err := database.Exec(fmt.Sprintf("DELETE FROM %s", tableName)); err != nil {
+			return nil, fmt.Errorf("清理表 %s 失败: %v", tableName, err)
+		}
+	}
+
+	return counts, nil
+}
+
+// getExportMode 获取导出数据库的导出方式，早期版本导出的数据库视为全量导出
+func getExportMode(database *db.Database) string {
+	exportResult, err := database.QueryRow("SELECT export_mode FROM data_export_info ORDER BY export_time DESC LIMIT 1")
+	if err != nil || exportResult.Data == nil {
+		return EXPORT_MODE_FULL
+	}
+	if mode := getStringValue(exportResult.Data.(map[string]interface{})["export_mode"]); mode != "" {
+		return mode
+	}
+	return EXPORT_MODE_FULL
+}
+
+// MergeDeltaDatabase 将增量数据应用到已合并的数据库，按上传顺序依次应用
+func (a *App) MergeDeltaDatabase(targetDbPath string, deltaDbPaths []string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.mergeDeltaDatabaseWithRecover(targetDbPath, deltaDbPaths)
+}
+
+// mergeDeltaDatabaseWithRecover 带异常处理的增量合并函数
+func (a *App) mergeDeltaDatabaseWithRecover(targetDbPath string, deltaDbPaths []string) db.QueryResult {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("MergeDeltaDatabase 发生异常: %v", r)
+		}
+	}()
+
+	result := db.QueryResult{}
+
+	if len(deltaDbPaths) == 0 {
+		result.Message = "没有增量数据文件需要合并"
+		return result
+	}
+
+	targetDb, err := db.NewDatabase(targetDbPath, EXCHANGE_DB_PASSWORD)
+	if err != nil {
+		result.Message = "打开目标数据库失败: " + err.Error()
+		return result
+	}
+	defer targetDb.Close()
+
+	// 合并前为目标数据库创建快照
+	if _, err := a.createSnapshot(targetDb, targetDbPath, SNAPSHOT_REASON_MERGE); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	// 早期合并的数据库可能没有变更跟踪表
+	if err := migrateDatabase(targetDb); err != nil {
+		result.Message = "升级目标数据库表结构失败: " + err.Error()
+		return result
+	}
+
+	// 1. 校验并打开增量数据文件，报送数据包先校验签名和完整性
+	var deltaDbs []*db.Database
+	var deltaPaths []string
+	failedMessages := make(map[string]string)
+	signers := make(map[string]SubmissionSigner)
+	now := time.Now().Unix()
+	defer func() {
+		for i, deltaDb := range deltaDbs {
+			deltaDb.Close()
+			a.Removefile(deltaPaths[i])
+		}
+	}()
+
+	var originalPaths []string
+	for i, deltaDbPath := range deltaDbPaths {
+		dbDstPath := GetPath(filepath.Join(DATA_DIR_NAME, "delta_"+strconv.FormatInt(now+int64(i), 16)))
+		signer, err := a.prepareMergeSource(deltaDbPath, dbDstPath)
+		if err != nil {
+			failedMessages[deltaDbPath] = err.Error()
+			continue
+		}
+		deltaDb, err := db.NewReadOnlyDatabase(dbDstPath, EXCHANGE_DB_PASSWORD)
+		if err != nil {
+			a.Removefile(dbDstPath)
+			failedMessages[deltaDbPath] = "打开数据库失败: " + err.Error()
+			continue
+		}
+		if getExportMode(deltaDb) != EXPORT_MODE_DELTA {
+			deltaDb.Close()
+			a.Removefile(dbDstPath)
+			failedMessages[deltaDbPath] = "不是增量导出的数据文件，请使用数据文件合并"
+			continue
+		}
+		if signer != nil {
+			signers[deltaDbPath] = *signer
+		}
+		deltaDbs = append(deltaDbs, deltaDb)
+		deltaPaths = append(deltaPaths, dbDstPath)
+		originalPaths = append(originalPaths, deltaDbPath)
+	}
+
+	if len(deltaDbs) == 0 {
+		result.Message = "没有可合并的增量数据文件"
+		result.Data = map[string]interface{}{"failedMessages": failedMessages}
+		return result
+	}
+
+	// 2. 在一个事务中依次应用增量数据
+	tx, err := targetDb.Begin()
+	if err != nil {
+		result.Message = "开始事务失败: " + err.Error()
+		return result
+	}
+
+	var conflicts []DeltaConflict
+	fileResults := make(map[string]map[string]int)
+	for i, deltaDb := range deltaDbs {
+		fileResult, fileConflicts, err := a.applyDelta(tx, targetDb, deltaDb, originalPaths[i])
+		if err != nil {
+			tx.Rollback()
+			result.Message = fmt.Sprintf("应用增量数据 %s 失败: %v", filepath.Base(originalPaths[i]), err)
+			return result
+		}
+		fileResults[originalPaths[i]] = fileResult
+		conflicts = append(conflicts, fileConflicts...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		result.Message = "提交事务失败: " + err.Error()
+		return result
+	}
+
+	result.Ok = true
+	result.Message = fmt.Sprintf("增量数据合并完成，未应用的冲突数据 %d 条", len(conflicts))
+	result.Data = map[string]interface{}{
+		"fileResults":    fileResults,
+		"conflicts":      conflicts,
+		"failedMessages": failedMessages,
+		"signers":        signers,
+		"targetDbPath":   targetDbPath,
+	}
+	return result
+}
+
+// getTableColumns 获取数据表的字段
+func getTableColumns(database *db.Database, tableName string) ([]string, error) {
+	columnResult, err := database.Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	if columnResult.Data != nil {
+		for _, column := range columnResult.Data.([]map[string]interface{}) {
+			columns = append(columns, getStringValue(column["name"]))
+		}
+	}
+	return columns, nil
+}
+
+// applyDelta 将单个增量数据文件应用到目标数据库：先删除删除记录对应的数据，再按自然键或obj_id新增或覆盖变更的数据，
+// 冲突键与其他来源已有数据相同的记录不应用
+func (a *App) applyDelta(tx *sql.Tx, targetDb *db.Database, deltaDb *db.Database, filePath string) (map[string]int, []DeltaConflict, error) {
+	fileResult := map[string]int{"deleted": 0, "upserted": 0, "conflicts": 0}
+	var conflicts []DeltaConflict
+	info := a.getMergeSourceInfo(deltaDb, filePath)
+	mergeTime := time.Now().UnixMilli()
+
+	// 1. 删除记录
+	tombstoneResult, err := deltaDb.Query("SELECT table_name, record_id FROM data_tombstone ORDER BY change_seq")
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取删除记录失败: %v", err)
+	}
+	if tombstoneResult.Data != nil {
+		for _, tombstone := range tombstoneResult.Data.([]map[string]interface{}) {
+			tableName := getStringValue(tombstone["table_name"])
+			if !slices.Contains(changeTrackedTables, tableName) {
+				continue
+			}
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE obj_id = ?", tableName), tombstone["record_id"]); err != nil {
+				return nil, nil, fmt.Errorf("删除表 %s 数据失败: %v", tableName, err)
+			}
+			if _, err := tx.Exec("DELETE FROM data_merge_source WHERE record_id = ?", tombstone["record_id"]); err != nil {
+				return nil, nil, fmt.Errorf("删除数据来源失败: %v", err)
+			}
+			fileResult["deleted"]++
+		}
+	}
+
+	// 2. 新增或覆盖变更的数据，表1主表在扩展表之前处理
+	skippedIds := make(map[string]bool)
+	for _, tableName := range changeTrackedTables {
+		targetColumns, err := getTableColumns(targetDb, tableName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取表 %s 结构失败: %v", tableName, err)
+		}
+
+		rowsResult, err := deltaDb.Query(fmt.Sprintf("SELECT * FROM %s ORDER BY change_seq", tableName))
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取表 %s 增量数据失败: %v", tableName, err)
+		}
+		if rowsResult.Data == nil {
+			continue
+		}
+
+		for _, row := range rowsResult.Data.([]map[string]interface{}) {
+			objID := getStringValue(row["obj_id"])
+
+			// 主表数据冲突时扩展表数据一并跳过
+			if fkID, ok := row["fk_id"]; ok && skippedIds[getStringValue(fkID)] {
+				continue
+			}
+			if conflict, err := findDeltaConflict(tx, tableName, row, info); err != nil {
+				return nil, nil, err
+			} else if conflict != nil {
+				conflict.FilePath = filePath
+				conflicts = append(conflicts, *conflict)
+				skippedIds[objID] = true
+				fileResult["conflicts"]++
+				continue
+			}
+
+			// 变更序号由目标数据库的触发器重新生成
+			data := make(map[string]interface{})
+			for _, column := range targetColumns {
+				if value, exists := row[column]; exists && column != "change_seq" {
+					data[column] = value
+				}
+			}
+			upsertResult, err := db.BatchUpsertTx(tx, tableName, []map[string]interface{}{data}, getDeltaUpsertOptions(tableName), 1)
+			if err == nil && upsertResult.FailedRows > 0 {
+				err = fmt.Errorf("%s", strings.Join(upsertResult.Errors, "; "))
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("写入表 %s 数据失败: %v", tableName, err)
+			}
+
+			if _, err := tx.Exec("DELETE FROM data_merge_source WHERE record_id = ?", objID); err != nil {
+				return nil, nil, fmt.Errorf("更新数据来源失败: %v", err)
+			}
+			if err := a.insertMergeProvenance(tx, tableName, objID, info, mergeTime); err != nil {
+				return nil, nil, err
+			}
+			fileResult["upserted"]++
+		}
+	}
+
+	return fileResult, conflicts, nil
+}
+
+// getDeltaUpsertOptions 增量数据的写入方式，自然键或obj_id与已有数据相同时以增量数据为准原地更新
+func getDeltaUpsertOptions(tableName string) db.UpsertOptions {
+	options := db.UpsertOptions{}
+	if key, exists := data_import.GetNaturalKey(tableName); exists {
+		options.Targets = append(options.Targets, key.Target())
+	}
+	options.Targets = append(options.Targets, db.ConflictTarget{Columns: []string{"obj_id"}})
+	return options
+}
+
+// findDeltaConflict 检查增量数据是否与其他区域来源的已有数据冲突键相同，同一区域的数据视为该区域的更新
+func findDeltaConflict(tx *sql.Tx, tableName string, row map[string]interface{}, info mergeSourceInfo) (*DeltaConflict, error) {
+	keyFields, exists := deltaKeyFields[tableName]
+	if !exists {
+		return nil, nil
+	}
+
+	var conditions []string
+	var args []interface{}
+	var keyValues []string
+	for _, field := range keyFields {
+		conditions = append(conditions, fmt.Sprintf("t.%s = ?", field))
+		args = append(args, row[field])
+		keyValues = append(keyValues, getStringValue(row[field]))
+	}
+	args = append(args, row["obj_id"], info.ProvinceName, info.CityName, info.CountryName)
+
+	query := fmt.Sprintf(`SELECT t.obj_id, s.source_file FROM %s t
+		LEFT JOIN data_merge_source s ON s.record_id = t.obj_id
+		WHERE %s AND t.obj_id <> ?
+		AND NOT (IFNULL(s.source_province, '') = ? AND IFNULL(s.source_city, '') = ? AND IFNULL(s.source_country, '') = ?)
+		LIMIT 1`, tableName, strings.Join(conditions, " AND "))
+
+	var existingID string
+	var sourceFile *string
+	err := tx.QueryRow(query, args...).Scan(&existingID, &sourceFile)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("检查表 %s 冲突失败: %v", tableName, err)
+	}
+
+	conflict := &DeltaConflict{
+		TableName:   tableName,
+		ObjId:       getStringValue(row["obj_id"]),
+		ConflictKey: strings.Join(keyValues, "_"),
+		ExistingId:  existingID,
+	}
+	if sourceFile != nil {
+		conflict.SourceFile = *sourceFile
+	}
+	return conflict, nil
+}
@@ -36,6 +36,8 @@ CREATE TABLE "coal_consumption_report" (
 	"create_time" datetime NOT NULL,                     -- 创建时间
 	"is_confirm" varchar(100),                           -- 是否已确认，0未确认，1已确认，加密
 	"is_check" varchar(100),                             -- 是否已校核，0未校核，1已校核，2校核未通过，加密
+	"file_hash" varchar(64),                             -- 源文件内容哈希（SM3），用于重复文件识别及原始文件追溯
+	"change_seq" integer,                                -- 变更序号，新增、修改时由触发器更新，用于增量导出
   PRIMARY KEY ("obj_id")
 );
 
@@ -73,6 +75,8 @@ CREATE TABLE "critical_coal_equipment_consumption" (
   "create_user" varchar(100),                          -- 导入用户
 	"is_confirm" varchar(100),                           -- 是否已确认，0未确认，1已确认，加密
 	"is_check" varchar(100),                             -- 是否已校核，0未校核，1已校核，2校核未通过，加密
+	"file_hash" varchar(64),                             -- 源文件内容哈希（SM3），用于重复文件识别及原始文件追溯
+	"change_seq" integer,                                -- 变更序号，新增、修改时由触发器更新，用于增量导出
   PRIMARY KEY ("obj_id")
 );
 
@@ -86,6 +90,7 @@ CREATE TABLE "data_import_record" (
   "import_state" varchar(20) NOT NULL,                 -- 导入状态，导入成功，导入失败
   "describe" varchar(500),                             -- 说明
   "create_user" varchar(100),                          -- 导入用户
+  "file_hash" varchar(64),                             -- 源文件内容哈希（SM3），用于重复文件识别及原始文件追溯
   PRIMARY KEY ("obj_id")
 );
 
@@ -107,6 +112,7 @@ CREATE TABLE "enterprise_coal_consumption_equip" (
   "row_no" varchar(36),                                -- 行数
 	"is_confirm" varchar(100),                           -- 是否已确认，0未确认，1已确认，加密
 	"is_check" varchar(100),                             -- 是否已校核，0未校核，1已校核，2校核未通过，加密
+	"change_seq" integer,                                -- 变更序号，新增、修改时由触发器更新，用于增量导出
   PRIMARY KEY ("obj_id")
 );
 
@@ -142,6 +148,8 @@ CREATE TABLE "enterprise_coal_consumption_main" (
   "create_user" varchar(100),                          -- 导入用户
 	"is_confirm" varchar(100),                           -- 是否已确认，0未确认，1已确认，加密
 	"is_check" varchar(100),                             -- 是否已校核，0未校核，1已校核，2校核未通过，加密
+	"file_hash" varchar(64),                             -- 源文件内容哈希（SM3），用于重复文件识别及原始文件追溯
+	"change_seq" integer,                                -- 变更序号，新增、修改时由触发器更新，用于增量导出
   PRIMARY KEY ("obj_id")
 );
 
@@ -163,6 +171,7 @@ CREATE TABLE "enterprise_coal_consumption_usage" (
   "row_no" varchar(36),                                -- 行数
 	"is_confirm" varchar(100),                           -- 是否已确认，0未确认，1已确认，加密
 	"is_check" varchar(100),                             -- 是否已校核，0未校核，1已校核，2校核未通过，加密
+	"change_seq" integer,                                -- 变更序号，新增、修改时由触发器更新，用于增量导出
   PRIMARY KEY ("obj_id")
 );
 
@@ -216,6 +225,8 @@ CREATE TABLE "fixed_assets_investment_project" (
 	"create_time" datetime NOT NULL,                     -- 创建时间
 	"is_confirm" varchar(100),                           -- 是否已确认，0未确认，1已确认，加密
 	"is_check" varchar(100),                             -- 是否已校核，0未校核，1已校核，2校核未通过，加密
+	"file_hash" varchar(64),                             -- 源文件内容哈希（SM3），用于重复文件识别及原始文件追溯
+	"change_seq" integer,                                -- 变更序号，新增、修改时由触发器更新，用于增量导出
   PRIMARY KEY ("obj_id")
 );
 
@@ -234,6 +245,162 @@ CREATE TABLE "key_equipment_list" (
 );
 
 
+-- 数据修改记录表, 记录单条数据修改的字段、修改前后的值和修改原因
+CREATE TABLE "data_change_log" (
+  "obj_id" varchar(36) NOT NULL,                       -- 主键，表：数据修改记录表
+  "table_name" varchar(100) NOT NULL,                  -- 修改的数据表名
+  "record_id" varchar(36) NOT NULL,                    -- 修改的数据记录obj_id
+  "field_name" varchar(100) NOT NULL,                  -- 修改的字段名
+  "old_value" varchar(500),                            -- 修改前的值，数值字段加密
+  "new_value" varchar(500),                            -- 修改后的值，数值字段加密
+  "reason" varchar(500) NOT NULL,                      -- 修改原因
+  "change_time" datetime NOT NULL,                     -- 修改时间
+  "change_user" varchar(100),                          -- 修改用户
+  PRIMARY KEY ("obj_id")
+);
+CREATE INDEX "idx_data_change_log_record" ON "data_change_log" ("table_name", "record_id");
+
+
+-- 数据合并记录表, 记录合并数据库时冲突数据的处理策略和保留的来源文件
+CREATE TABLE "data_merge_log" (
+  "obj_id" varchar(36) NOT NULL,                       -- 主键，表：数据合并记录表
+  "table_type" varchar(20) NOT NULL,                   -- 表类型，table1/table2/table3/attachment2
+  "conflict_key" varchar(500) NOT NULL,                -- 冲突键
+  "strategy" varchar(20) NOT NULL,                     -- 处理策略，manual用户选择，newest最新优先，confirmed已确认优先，preferred_source指定来源优先，identical内容相同
+  "source_file" varchar(500),                          -- 保留的来源数据库文件名
+  "merge_time" datetime NOT NULL,                      -- 合并时间
+  "create_user" varchar(100),                          -- 合并用户
+  PRIMARY KEY ("obj_id")
+);
+
+
+-- 数据来源表, 记录合并数据库中每条数据的来源数据库
+CREATE TABLE "data_merge_source" (
+  "obj_id" varchar(36) NOT NULL,                       -- 主键，表：数据来源表
+  "table_name" varchar(100) NOT NULL,                  -- 数据所在表名
+  "record_id" varchar(36) NOT NULL,                    -- 合并后数据的obj_id
+  "original_obj_id" varchar(36),                       -- 来源数据库中数据的obj_id
+  "source_file" varchar(500),                          -- 来源数据库文件名
+  "source_hash" varchar(64),                           -- 来源数据库文件哈希（SM3）
+  "source_province" varchar(50),                       -- 来源数据库区域配置-省
+  "source_city" varchar(50),                           -- 来源数据库区域配置-市
+  "source_country" varchar(50),                        -- 来源数据库区域配置-县
+  "export_time" datetime,                              -- 来源数据库导出时间
+  "merge_time" datetime NOT NULL,                      -- 合并时间
+  PRIMARY KEY ("obj_id")
+);
+CREATE INDEX "idx_data_merge_source_record" ON "data_merge_source" ("record_id");
+
+-- 数据导出记录表, 记录导出数据库的导出时间和区域
+CREATE TABLE "data_export_info" (
+  "obj_id" varchar(36) NOT NULL,                       -- 主键，表：数据导出记录表
+  "export_time" datetime NOT NULL,                     -- 导出时间
+  "province_name" varchar(50),                         -- 省
+  "city_name" varchar(50),                             -- 市
+  "country_name" varchar(50),                          -- 县
+  "create_user" varchar(100),                          -- 导出用户
+  "export_mode" varchar(10),                           -- 导出方式，full全量，delta增量
+  "from_seq" integer,                                  -- 增量导出的起始变更序号（不含）
+  "to_seq" integer,                                    -- 导出时的变更序号
+  PRIMARY KEY ("obj_id")
+);
+
+
+-- 本机签名密钥表, 只有一条数据, 首次导出报送数据包时生成, 导出的数据库中不包含
+CREATE TABLE "workstation_key" (
+  "obj_id" varchar(36) NOT NULL,                       -- 主键，表：本机签名密钥表
+  "private_key" varchar(500) NOT NULL,                 -- SM2私钥，加密
+  "public_key" varchar(1000) NOT NULL,                 -- SM2公钥（PEM）
+  "fingerprint" varchar(64) NOT NULL,                  -- 公钥指纹（SM3）
+  "create_time" datetime NOT NULL,                     -- 创建时间
+  "create_user" varchar(100),                          -- 创建用户
+  PRIMARY KEY ("obj_id")
+);
+
+
+-- 变更序号计数表, 只有一条数据, 数据表新增、修改、删除时由触发器递增
+CREATE TABLE "data_change_counter" (
+  "name" varchar(36) NOT NULL,                         -- 计数器名称，change_seq
+  "value" integer NOT NULL DEFAULT 0,                  -- 当前变更序号
+  PRIMARY KEY ("name")
+);
+
+-- 删除记录表, 数据表删除数据时由触发器写入, 增量导出时作为删除标记
+CREATE TABLE "data_tombstone" (
+  "obj_id" varchar(36) NOT NULL,                       -- 主键，表：删除记录表
+  "table_name" varchar(100) NOT NULL,                  -- 数据所在表名
+  "record_id" varchar(36) NOT NULL,                    -- 被删除数据的obj_id
+  "change_seq" integer NOT NULL,                       -- 变更序号
+  "delete_time" datetime NOT NULL,                     -- 删除时间
+  PRIMARY KEY ("obj_id")
+);
+CREATE INDEX "idx_data_tombstone_seq" ON "data_tombstone" ("change_seq");
+
+-- 报送记录表, 记录每次导出的变更序号水位, 增量导出从最近一次已确认报送的水位开始
+CREATE TABLE "submission_watermark" (
+  "obj_id" varchar(36) NOT NULL,                       -- 主键，表：报送记录表
+  "export_mode" varchar(10) NOT NULL,                  -- 导出方式，full全量，delta增量
+  "from_seq" integer NOT NULL,                         -- 起始变更序号（不含）
+  "to_seq" integer NOT NULL,                           -- 导出时的变更序号
+  "file_name" varchar(500),                            -- 导出文件名
+  "export_time" datetime NOT NULL,                     -- 导出时间
+  "create_user" varchar(100),                          -- 导出用户
+  "is_ack" integer NOT NULL DEFAULT 0,                 -- 上级是否已确认接收，0未确认，1已确认
+  "ack_time" datetime,                                 -- 确认接收时间
+  PRIMARY KEY ("obj_id")
+);
+
+-- 报送状态表, 按区域和年份记录报送流程状态, 已报送和已接收的年份不允许修改数据
+CREATE TABLE "submission_status" (
+  "obj_id" varchar(36) NOT NULL,                       -- 主键，表：报送状态表，按区域和年份记录
+  "province_name" varchar(50) NOT NULL DEFAULT '',     -- 省
+  "city_name" varchar(50) NOT NULL DEFAULT '',         -- 市
+  "country_name" varchar(50) NOT NULL DEFAULT '',      -- 县
+  "stat_date" varchar(10) NOT NULL,                    -- 年份
+  "status" varchar(20) NOT NULL,                       -- 报送状态，draft草稿，validated已校验，confirmed已确认，submitted已报送，accepted已接收，returned已退回
+  "update_time" datetime NOT NULL,                     -- 更新时间
+  "update_user" varchar(100),                          -- 更新用户
+  "remark" varchar(500),                               -- 备注（导出文件名、回执意见或重新开放原因）
+  PRIMARY KEY ("obj_id")
+);
+CREATE UNIQUE INDEX "idx_submission_status_region_year" ON "submission_status" ("province_name", "city_name", "country_name", "stat_date");
+
+-- 报送状态变更记录表
+CREATE TABLE "submission_status_log" (
+  "obj_id" varchar(36) NOT NULL,                       -- 主键，表：报送状态变更记录表
+  "province_name" varchar(50) NOT NULL DEFAULT '',     -- 省
+  "city_name" varchar(50) NOT NULL DEFAULT '',         -- 市
+  "country_name" varchar(50) NOT NULL DEFAULT '',      -- 县
+  "stat_date" varchar(10) NOT NULL,                    -- 年份
+  "event" varchar(20) NOT NULL,                        -- 变更事件，import导入，edit修改，confirm确认，export导出，accept接收，return退回，reopen重新开放
+  "from_status" varchar(20),                           -- 变更前状态
+  "to_status" varchar(20) NOT NULL,                    -- 变更后状态
+  "remark" varchar(500),                               -- 备注
+  "create_time" datetime NOT NULL,                     -- 变更时间
+  "create_user" varchar(100),                          -- 变更用户
+  PRIMARY KEY ("obj_id")
+);
+
+-- 上级回执中各条数据的处理结果表, 同一条数据只保留最近一次回执的结果
+CREATE TABLE "submission_receipt_record" (
+  "obj_id" varchar(36) NOT NULL,                       -- 主键，表：回执记录表
+  "table_name" varchar(100) NOT NULL,                  -- 数据表名
+  "record_id" varchar(36) NOT NULL,                    -- 数据的obj_id
+  "stat_date" varchar(10),                             -- 数据年份
+  "record_key" varchar(200),                           -- 数据唯一键
+  "record_name" varchar(200),                          -- 单位名称或项目名称
+  "is_accepted" integer NOT NULL DEFAULT 0,            -- 是否接收，1接收，0未接收
+  "reason" varchar(500),                               -- 未接收原因
+  "issuer" varchar(100),                               -- 出具回执的单位
+  "receipt_time" datetime,                             -- 回执时间
+  "create_time" datetime NOT NULL,                     -- 导入时间
+  PRIMARY KEY ("obj_id")
+);
+CREATE INDEX "idx_submission_receipt_record" ON "submission_receipt_record" ("table_name", "record_id");
+
+-- 各数据表的变更跟踪触发器由程序启动时创建, 见 db_migration.go
+
+
 -- 用户和管理员密码表, 只有一条数据, 为空时说明用户未使用该软件, 管理员密码为初始化数据
 CREATE TABLE "pws_info" (
   "obj_id" varchar(36) NOT NULL,                       -- 主键，表：密码表
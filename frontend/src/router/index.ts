@@ -1,5 +1,6 @@
 import { createRouter, createWebHashHistory, RouteRecordRaw } from 'vue-router';
 import main from '../views/main.vue';
+import { GetDatabaseStatus } from '@wailsjs/go';
 const modules = import.meta.glob('../views/main/*.vue');
 
 const mainRoutes: RouteRecordRaw[] = [];
@@ -18,6 +19,7 @@ const routes: RouteRecordRaw[] = [
   { path: '/', name: 'index', redirect: '/login', meta: { title: '首页' } },
   { path: '/select-address', name: 'select-address', component: () => import('../views/select-address.vue'), meta: { title: '选择区域' } },
   { path: '/login', name: 'login', component: () => import('../views/login.vue'), meta: { title: '登录' } },
+  { path: '/recovery', name: 'recovery', component: () => import('../views/recovery.vue'), meta: { title: '数据库恢复' } },
   {
     path: '/main',
     name: 'main',
@@ -33,4 +35,16 @@ const router = createRouter({
   routes
 });
 
+// 数据库不可用时只能进入恢复页面，选择处理方式后再登录
+router.beforeEach(async to => {
+  if (to.path === '/recovery') {
+    return true;
+  }
+  const ret = await GetDatabaseStatus();
+  if (ret.ok && !ret.data?.ready) {
+    return '/recovery';
+  }
+  return true;
+});
+
 export default router;
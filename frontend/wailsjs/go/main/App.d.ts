@@ -6,8 +6,18 @@ import {context} from '../models';
 
 export function AbsolutePath(arg1:string):Promise<main.FlagResult>;
 
+export function AcknowledgeSubmission(arg1:string):Promise<db.QueryResult>;
+
+export function AcknowledgeValidationWarnings(arg1:string,arg2:Array<string>):Promise<db.QueryResult>;
+
+export function AddTrustedSigner(arg1:main.TrustedSigner):Promise<db.QueryResult>;
+
 export function CacheFileExists(arg1:string,arg2:string):Promise<db.QueryResult>;
 
+export function CancelMerge():Promise<db.QueryResult>;
+
+export function CompareDatabases(arg1:string,arg2:string):Promise<db.QueryResult>;
+
 export function ConfirmDataAttachment2(arg1:Array<string>):Promise<db.QueryResult>;
 
 export function ConfirmDataTable1(arg1:Array<string>):Promise<db.QueryResult>;
@@ -24,6 +34,10 @@ export function Copyfile(arg1:string,arg2:string):Promise<main.FlagResult>;
 
 export function CreateNewDatabase(arg1:string):Promise<db.Database>;
 
+export function CreateSnapshot(arg1:string):Promise<db.QueryResult>;
+
+export function CreateSubmissionReceipt(arg1:string,arg2:string,arg3:string,arg4:Array<string>,arg5:boolean,arg6:string,arg7:string):Promise<db.QueryResult>;
+
 export function DBTranformExcel(arg1:string):Promise<db.QueryResult>;
 
 export function ExitApp():Promise<void>;
@@ -34,6 +48,20 @@ export function ExportDBData(arg1:string):Promise<db.QueryResult>;
 
 export function ExportDataToExcel(arg1:Record<string, Array<Record<string, any>>>,arg2:Array<Record<string, any>>,arg3:string):Promise<db.QueryResult>;
 
+export function ExportDatabaseComparison(arg1:string,arg2:string,arg3:string):Promise<db.QueryResult>;
+
+export function ExportDeltaData(arg1:string):Promise<db.QueryResult>;
+
+export function ExportDiagnosticBundle():Promise<db.QueryResult>;
+
+export function ExportMergeReceipts(arg1:string,arg2:string,arg3:string,arg4:string,arg5:Array<string>,arg6:string):Promise<db.QueryResult>;
+
+export function ExportOriginalFile(arg1:string):Promise<db.QueryResult>;
+
+export function ExportOriginalFileByRecord(arg1:string,arg2:string):Promise<db.QueryResult>;
+
+export function ExportSubmissionPackage(arg1:string):Promise<db.QueryResult>;
+
 export function ExportTable1ProgressToExcel(arg1:string):Promise<db.QueryResult>;
 
 export function ExportTable2ProgressToExcel(arg1:string):Promise<db.QueryResult>;
@@ -42,10 +70,16 @@ export function ExportTable3ProgressToExcel(arg1:string):Promise<db.QueryResult>
 
 export function FileExists(arg1:string):Promise<main.FlagResult>;
 
+export function GenerateTemplates(arg1:string,arg2:string,arg3:string,arg4:string,arg5:Array<string>,arg6:boolean):Promise<db.QueryResult>;
+
+export function GetArchivePath():Promise<string>;
+
 export function GetAreaConfig():Promise<db.QueryResult>;
 
 export function GetAreaStr():Promise<string>;
 
+export function GetBatchDuplicates(arg1:string):Promise<db.QueryResult>;
+
 export function GetCachePath(arg1:string):Promise<string>;
 
 export function GetChinaAreaMap():Promise<Array<any>>;
@@ -60,6 +94,8 @@ export function GetDB():Promise<db.Database>;
 
 export function GetDBPassword():Promise<string>;
 
+export function GetDatabaseStatus():Promise<db.QueryResult>;
+
 export function GetEnhancedAreaConfig():Promise<db.QueryResult>;
 
 export function GetEnterpriseInfoByCreditCode(arg1:string):Promise<db.QueryResult>;
@@ -74,18 +110,28 @@ export function GetImportRecordsByFileType(arg1:string):Promise<db.QueryResult>;
 
 export function GetPasswordInfo():Promise<db.QueryResult>;
 
+export function GetStartupDiagnosis():Promise<db.QueryResult>;
+
 export function GetStateManifest():Promise<db.QueryResult>;
 
+export function GetWorkstationKey():Promise<db.QueryResult>;
+
 export function ImportEnterpriseList(arg1:string):Promise<db.QueryResult>;
 
 export function ImportKeyEquipmentList(arg1:string):Promise<db.QueryResult>;
 
+export function ImportSubmissionReceipt(arg1:string):Promise<db.QueryResult>;
+
 export function InsertImportRecord(arg1:string,arg2:string,arg3:string,arg4:string):Promise<void>;
 
+export function InsertImportRecordWithHash(arg1:string,arg2:string,arg3:string,arg4:string,arg5:string):Promise<void>;
+
 export function IsEnterpriseListExist():Promise<boolean>;
 
 export function IsEquipmentListExist():Promise<boolean>;
 
+export function ListSnapshots():Promise<db.QueryResult>;
+
 export function Login(arg1:string):Promise<db.QueryResult>;
 
 export function Makedir(arg1:string):Promise<main.FlagResult>;
@@ -94,6 +140,10 @@ export function MergeConflictData(arg1:string,arg2:Array<main.ConflictData>):Pro
 
 export function MergeDatabase(arg1:string,arg2:string,arg3:string,arg4:Array<string>):Promise<db.QueryResult>;
 
+export function MergeDatabaseWithPolicy(arg1:string,arg2:string,arg3:string,arg4:Array<string>,arg5:main.MergePolicy):Promise<db.QueryResult>;
+
+export function MergeDeltaDatabase(arg1:string,arg2:Array<string>):Promise<db.QueryResult>;
+
 export function ModelDataCheckAttachment2():Promise<db.QueryResult>;
 
 export function ModelDataCheckReportDownload(arg1:string):Promise<db.QueryResult>;
@@ -106,6 +156,8 @@ export function ModelDataCheckTable3():Promise<db.QueryResult>;
 
 export function ModelDataCoverAttachment2(arg1:Array<string>):Promise<db.QueryResult>;
 
+export function ModelDataCoverRecords(arg1:string,arg2:Array<string>,arg3:Array<string>):Promise<db.QueryResult>;
+
 export function ModelDataCoverTable1(arg1:Array<string>):Promise<db.QueryResult>;
 
 export function ModelDataCoverTable2(arg1:Array<string>):Promise<db.QueryResult>;
@@ -122,8 +174,12 @@ export function OpenFileInExplorer(arg1:string):Promise<db.QueryResult>;
 
 export function OpenSaveDialog(arg1:main.FileDialogOptions):Promise<main.FileDialogResult>;
 
+export function PreviewModelDataCover(arg1:string,arg2:Array<string>):Promise<db.QueryResult>;
+
 export function QueryDataAttachment2():Promise<db.QueryResult>;
 
+export function QueryDataChangeLog(arg1:string):Promise<db.QueryResult>;
+
 export function QueryDataDetailAttachment2(arg1:string):Promise<db.QueryResult>;
 
 export function QueryDataDetailAttachment2ByDBFile(arg1:Array<string>,arg2:string):Promise<db.QueryResult>;
@@ -148,6 +204,14 @@ export function QueryDataTable3():Promise<db.QueryResult>;
 
 export function QueryExportData():Promise<db.QueryResult>;
 
+export function QueryNaturalKeyDuplicates():Promise<db.QueryResult>;
+
+export function QueryReceiptRejections():Promise<db.QueryResult>;
+
+export function QuerySubmissionStatus():Promise<db.QueryResult>;
+
+export function QuerySubmissionWatermarks():Promise<db.QueryResult>;
+
 export function QueryTable1Process():Promise<db.QueryResult>;
 
 export function QueryTable2Process():Promise<db.QueryResult>;
@@ -156,24 +220,54 @@ export function QueryTable3Process():Promise<db.QueryResult>;
 
 export function QueryTableAttachment2Process():Promise<db.QueryResult>;
 
+export function QueryTrustedSigners():Promise<db.QueryResult>;
+
 export function ReadFile(arg1:string,arg2:boolean):Promise<Array<number>>;
 
 export function Readdir(arg1:string):Promise<db.QueryResult>;
 
+export function RecoverFromLatestSnapshot():Promise<db.QueryResult>;
+
+export function RemoveTrustedSigner(arg1:string):Promise<db.QueryResult>;
+
 export function Removefile(arg1:string):Promise<main.FlagResult>;
 
+export function ReopenSubmissionYear(arg1:string,arg2:string):Promise<db.QueryResult>;
+
+export function ResolveBatchDuplicates(arg1:string,arg2:Record<string, string>):Promise<db.QueryResult>;
+
+export function ResolveNaturalKeyDuplicates():Promise<db.QueryResult>;
+
+export function RestoreSnapshot(arg1:string):Promise<db.QueryResult>;
+
 export function SM4Decrypt(arg1:string):Promise<string>;
 
 export function SM4Encrypt(arg1:string):Promise<string>;
 
+export function SalvageDatabase():Promise<db.QueryResult>;
+
 export function SaveAreaConfig(arg1:main.AreaConfig):Promise<db.QueryResult>;
 
 export function SetUserPassword(arg1:string):Promise<db.QueryResult>;
 
 export function ShowMessageBox(arg1:main.MessageBoxOptions):Promise<main.MessageBoxResult>;
 
+export function StartReadOnly():Promise<db.QueryResult>;
+
+export function UpdateAttachment2Record(arg1:string,arg2:Record<string, string>,arg3:string):Promise<db.QueryResult>;
+
 export function UpdateStateManifest(arg1:any):Promise<db.QueryResult>;
 
+export function UpdateTable1EquipRecord(arg1:string,arg2:Record<string, string>,arg3:string):Promise<db.QueryResult>;
+
+export function UpdateTable1MainRecord(arg1:string,arg2:Record<string, string>,arg3:string):Promise<db.QueryResult>;
+
+export function UpdateTable1UsageRecord(arg1:string,arg2:Record<string, string>,arg3:string):Promise<db.QueryResult>;
+
+export function UpdateTable2Record(arg1:string,arg2:Record<string, string>,arg3:string):Promise<db.QueryResult>;
+
+export function UpdateTable3Record(arg1:string,arg2:Record<string, string>,arg3:string):Promise<db.QueryResult>;
+
 export function ValidateAttachment2File(arg1:string,arg2:boolean):Promise<db.QueryResult>;
 
 export function ValidateEnterpriseListFile(arg1:string):Promise<db.QueryResult>;
@@ -185,3 +279,5 @@ export function ValidateTable1File(arg1:string,arg2:boolean):Promise<db.QueryRes
 export function ValidateTable2File(arg1:string,arg2:boolean):Promise<db.QueryResult>;
 
 export function ValidateTable3File(arg1:string,arg2:boolean):Promise<db.QueryResult>;
+export function VerifySubmissionPackage(arg1:string):Promise<db.QueryResult>;
+
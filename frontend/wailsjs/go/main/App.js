@@ -6,10 +6,30 @@ export function AbsolutePath(arg1) {
   return window['go']['main']['App']['AbsolutePath'](arg1);
 }
 
+export function AcknowledgeSubmission(arg1) {
+  return window['go']['main']['App']['AcknowledgeSubmission'](arg1);
+}
+
+export function AcknowledgeValidationWarnings(arg1, arg2) {
+  return window['go']['main']['App']['AcknowledgeValidationWarnings'](arg1, arg2);
+}
+
+export function AddTrustedSigner(arg1) {
+  return window['go']['main']['App']['AddTrustedSigner'](arg1);
+}
+
 export function CacheFileExists(arg1, arg2) {
   return window['go']['main']['App']['CacheFileExists'](arg1, arg2);
 }
 
+export function CancelMerge() {
+  return window['go']['main']['App']['CancelMerge']();
+}
+
+export function CompareDatabases(arg1, arg2) {
+  return window['go']['main']['App']['CompareDatabases'](arg1, arg2);
+}
+
 export function ConfirmDataAttachment2(arg1) {
   return window['go']['main']['App']['ConfirmDataAttachment2'](arg1);
 }
@@ -42,6 +62,14 @@ export function CreateNewDatabase(arg1) {
   return window['go']['main']['App']['CreateNewDatabase'](arg1);
 }
 
+export function CreateSnapshot(arg1) {
+  return window['go']['main']['App']['CreateSnapshot'](arg1);
+}
+
+export function CreateSubmissionReceipt(arg1, arg2, arg3, arg4, arg5, arg6, arg7) {
+  return window['go']['main']['App']['CreateSubmissionReceipt'](arg1, arg2, arg3, arg4, arg5, arg6, arg7);
+}
+
 export function DBTranformExcel(arg1) {
   return window['go']['main']['App']['DBTranformExcel'](arg1);
 }
@@ -62,6 +90,34 @@ export function ExportDataToExcel(arg1, arg2, arg3) {
   return window['go']['main']['App']['ExportDataToExcel'](arg1, arg2, arg3);
 }
 
+export function ExportDatabaseComparison(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ExportDatabaseComparison'](arg1, arg2, arg3);
+}
+
+export function ExportDeltaData(arg1) {
+  return window['go']['main']['App']['ExportDeltaData'](arg1);
+}
+
+export function ExportDiagnosticBundle() {
+  return window['go']['main']['App']['ExportDiagnosticBundle']();
+}
+
+export function ExportMergeReceipts(arg1, arg2, arg3, arg4, arg5, arg6) {
+  return window['go']['main']['App']['ExportMergeReceipts'](arg1, arg2, arg3, arg4, arg5, arg6);
+}
+
+export function ExportOriginalFile(arg1) {
+  return window['go']['main']['App']['ExportOriginalFile'](arg1);
+}
+
+export function ExportOriginalFileByRecord(arg1, arg2) {
+  return window['go']['main']['App']['ExportOriginalFileByRecord'](arg1, arg2);
+}
+
+export function ExportSubmissionPackage(arg1) {
+  return window['go']['main']['App']['ExportSubmissionPackage'](arg1);
+}
+
 export function ExportTable1ProgressToExcel(arg1) {
   return window['go']['main']['App']['ExportTable1ProgressToExcel'](arg1);
 }
@@ -78,6 +134,14 @@ export function FileExists(arg1) {
   return window['go']['main']['App']['FileExists'](arg1);
 }
 
+export function GenerateTemplates(arg1, arg2, arg3, arg4, arg5, arg6) {
+  return window['go']['main']['App']['GenerateTemplates'](arg1, arg2, arg3, arg4, arg5, arg6);
+}
+
+export function GetArchivePath() {
+  return window['go']['main']['App']['GetArchivePath']();
+}
+
 export function GetAreaConfig() {
   return window['go']['main']['App']['GetAreaConfig']();
 }
@@ -86,6 +150,10 @@ export function GetAreaStr() {
   return window['go']['main']['App']['GetAreaStr']();
 }
 
+export function GetBatchDuplicates(arg1) {
+  return window['go']['main']['App']['GetBatchDuplicates'](arg1);
+}
+
 export function GetCachePath(arg1) {
   return window['go']['main']['App']['GetCachePath'](arg1);
 }
@@ -114,6 +182,10 @@ export function GetDBPassword() {
   return window['go']['main']['App']['GetDBPassword']();
 }
 
+export function GetDatabaseStatus() {
+  return window['go']['main']['App']['GetDatabaseStatus']();
+}
+
 export function GetEnhancedAreaConfig() {
   return window['go']['main']['App']['GetEnhancedAreaConfig']();
 }
@@ -142,10 +214,18 @@ export function GetPasswordInfo() {
   return window['go']['main']['App']['GetPasswordInfo']();
 }
 
+export function GetStartupDiagnosis() {
+  return window['go']['main']['App']['GetStartupDiagnosis']();
+}
+
 export function GetStateManifest() {
   return window['go']['main']['App']['GetStateManifest']();
 }
 
+export function GetWorkstationKey() {
+  return window['go']['main']['App']['GetWorkstationKey']();
+}
+
 export function ImportEnterpriseList(arg1) {
   return window['go']['main']['App']['ImportEnterpriseList'](arg1);
 }
@@ -154,10 +234,18 @@ export function ImportKeyEquipmentList(arg1) {
   return window['go']['main']['App']['ImportKeyEquipmentList'](arg1);
 }
 
+export function ImportSubmissionReceipt(arg1) {
+  return window['go']['main']['App']['ImportSubmissionReceipt'](arg1);
+}
+
 export function InsertImportRecord(arg1, arg2, arg3, arg4) {
   return window['go']['main']['App']['InsertImportRecord'](arg1, arg2, arg3, arg4);
 }
 
+export function InsertImportRecordWithHash(arg1, arg2, arg3, arg4, arg5) {
+  return window['go']['main']['App']['InsertImportRecordWithHash'](arg1, arg2, arg3, arg4, arg5);
+}
+
 export function IsEnterpriseListExist() {
   return window['go']['main']['App']['IsEnterpriseListExist']();
 }
@@ -166,6 +254,10 @@ export function IsEquipmentListExist() {
   return window['go']['main']['App']['IsEquipmentListExist']();
 }
 
+export function ListSnapshots() {
+  return window['go']['main']['App']['ListSnapshots']();
+}
+
 export function Login(arg1) {
   return window['go']['main']['App']['Login'](arg1);
 }
@@ -182,6 +274,14 @@ export function MergeDatabase(arg1, arg2, arg3, arg4) {
   return window['go']['main']['App']['MergeDatabase'](arg1, arg2, arg3, arg4);
 }
 
+export function MergeDatabaseWithPolicy(arg1, arg2, arg3, arg4, arg5) {
+  return window['go']['main']['App']['MergeDatabaseWithPolicy'](arg1, arg2, arg3, arg4, arg5);
+}
+
+export function MergeDeltaDatabase(arg1, arg2) {
+  return window['go']['main']['App']['MergeDeltaDatabase'](arg1, arg2);
+}
+
 export function ModelDataCheckAttachment2() {
   return window['go']['main']['App']['ModelDataCheckAttachment2']();
 }
@@ -206,6 +306,10 @@ export function ModelDataCoverAttachment2(arg1) {
   return window['go']['main']['App']['ModelDataCoverAttachment2'](arg1);
 }
 
+export function ModelDataCoverRecords(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ModelDataCoverRecords'](arg1, arg2, arg3);
+}
+
 export function ModelDataCoverTable1(arg1) {
   return window['go']['main']['App']['ModelDataCoverTable1'](arg1);
 }
@@ -238,10 +342,18 @@ export function OpenSaveDialog(arg1) {
   return window['go']['main']['App']['OpenSaveDialog'](arg1);
 }
 
+export function PreviewModelDataCover(arg1, arg2) {
+  return window['go']['main']['App']['PreviewModelDataCover'](arg1, arg2);
+}
+
 export function QueryDataAttachment2() {
   return window['go']['main']['App']['QueryDataAttachment2']();
 }
 
+export function QueryDataChangeLog(arg1) {
+  return window['go']['main']['App']['QueryDataChangeLog'](arg1);
+}
+
 export function QueryDataDetailAttachment2(arg1) {
   return window['go']['main']['App']['QueryDataDetailAttachment2'](arg1);
 }
@@ -290,6 +402,22 @@ export function QueryExportData() {
   return window['go']['main']['App']['QueryExportData']();
 }
 
+export function QueryNaturalKeyDuplicates() {
+  return window['go']['main']['App']['QueryNaturalKeyDuplicates']();
+}
+
+export function QueryReceiptRejections() {
+  return window['go']['main']['App']['QueryReceiptRejections']();
+}
+
+export function QuerySubmissionStatus() {
+  return window['go']['main']['App']['QuerySubmissionStatus']();
+}
+
+export function QuerySubmissionWatermarks() {
+  return window['go']['main']['App']['QuerySubmissionWatermarks']();
+}
+
 export function QueryTable1Process() {
   return window['go']['main']['App']['QueryTable1Process']();
 }
@@ -306,6 +434,10 @@ export function QueryTableAttachment2Process() {
   return window['go']['main']['App']['QueryTableAttachment2Process']();
 }
 
+export function QueryTrustedSigners() {
+  return window['go']['main']['App']['QueryTrustedSigners']();
+}
+
 export function ReadFile(arg1, arg2) {
   return window['go']['main']['App']['ReadFile'](arg1, arg2);
 }
@@ -314,10 +446,34 @@ export function Readdir(arg1) {
   return window['go']['main']['App']['Readdir'](arg1);
 }
 
+export function RecoverFromLatestSnapshot() {
+  return window['go']['main']['App']['RecoverFromLatestSnapshot']();
+}
+
+export function RemoveTrustedSigner(arg1) {
+  return window['go']['main']['App']['RemoveTrustedSigner'](arg1);
+}
+
 export function Removefile(arg1) {
   return window['go']['main']['App']['Removefile'](arg1);
 }
 
+export function ReopenSubmissionYear(arg1, arg2) {
+  return window['go']['main']['App']['ReopenSubmissionYear'](arg1, arg2);
+}
+
+export function ResolveBatchDuplicates(arg1, arg2) {
+  return window['go']['main']['App']['ResolveBatchDuplicates'](arg1, arg2);
+}
+
+export function ResolveNaturalKeyDuplicates() {
+  return window['go']['main']['App']['ResolveNaturalKeyDuplicates']();
+}
+
+export function RestoreSnapshot(arg1) {
+  return window['go']['main']['App']['RestoreSnapshot'](arg1);
+}
+
 export function SM4Decrypt(arg1) {
   return window['go']['main']['App']['SM4Decrypt'](arg1);
 }
@@ -326,6 +482,10 @@ export function SM4Encrypt(arg1) {
   return window['go']['main']['App']['SM4Encrypt'](arg1);
 }
 
+export function SalvageDatabase() {
+  return window['go']['main']['App']['SalvageDatabase']();
+}
+
 export function SaveAreaConfig(arg1) {
   return window['go']['main']['App']['SaveAreaConfig'](arg1);
 }
@@ -338,10 +498,38 @@ export function ShowMessageBox(arg1) {
   return window['go']['main']['App']['ShowMessageBox'](arg1);
 }
 
+export function StartReadOnly() {
+  return window['go']['main']['App']['StartReadOnly']();
+}
+
+export function UpdateAttachment2Record(arg1, arg2, arg3) {
+  return window['go']['main']['App']['UpdateAttachment2Record'](arg1, arg2, arg3);
+}
+
 export function UpdateStateManifest(arg1) {
   return window['go']['main']['App']['UpdateStateManifest'](arg1);
 }
 
+export function UpdateTable1EquipRecord(arg1, arg2, arg3) {
+  return window['go']['main']['App']['UpdateTable1EquipRecord'](arg1, arg2, arg3);
+}
+
+export function UpdateTable1MainRecord(arg1, arg2, arg3) {
+  return window['go']['main']['App']['UpdateTable1MainRecord'](arg1, arg2, arg3);
+}
+
+export function UpdateTable1UsageRecord(arg1, arg2, arg3) {
+  return window['go']['main']['App']['UpdateTable1UsageRecord'](arg1, arg2, arg3);
+}
+
+export function UpdateTable2Record(arg1, arg2, arg3) {
+  return window['go']['main']['App']['UpdateTable2Record'](arg1, arg2, arg3);
+}
+
+export function UpdateTable3Record(arg1, arg2, arg3) {
+  return window['go']['main']['App']['UpdateTable3Record'](arg1, arg2, arg3);
+}
+
 export function ValidateAttachment2File(arg1, arg2) {
   return window['go']['main']['App']['ValidateAttachment2File'](arg1, arg2);
 }
@@ -365,3 +553,7 @@ export function ValidateTable2File(arg1, arg2) {
 export function ValidateTable3File(arg1, arg2) {
   return window['go']['main']['App']['ValidateTable3File'](arg1, arg2);
 }
+export function VerifySubmissionPackage(arg1) {
+  return window['go']['main']['App']['VerifySubmissionPackage'](arg1);
+}
+
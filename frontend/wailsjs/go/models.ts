@@ -244,6 +244,22 @@ export namespace main {
 	        this.data = source["data"];
 	    }
 	}
+	export class MergePolicy {
+	    strategy: string;
+	    preferredSource: string;
+	    ignoreIdentical: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new MergePolicy(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.strategy = source["strategy"];
+	        this.preferredSource = source["preferredSource"];
+	        this.ignoreIdentical = source["ignoreIdentical"];
+	    }
+	}
 	export class MessageBoxOptions {
 	    title?: string;
 	    message: string;
@@ -282,6 +298,34 @@ export namespace main {
 	        this.checkboxChecked = source["checkboxChecked"];
 	    }
 	}
+	export class TrustedSigner {
+	    obj_id: string;
+	    role: string;
+	    province_name: string;
+	    city_name: string;
+	    country_name: string;
+	    fingerprint: string;
+	    public_key: string;
+	    signer_user: string;
+	    signer_host: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TrustedSigner(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.obj_id = source["obj_id"];
+	        this.role = source["role"];
+	        this.province_name = source["province_name"];
+	        this.city_name = source["city_name"];
+	        this.country_name = source["country_name"];
+	        this.fingerprint = source["fingerprint"];
+	        this.public_key = source["public_key"];
+	        this.signer_user = source["signer_user"];
+	        this.signer_host = source["signer_host"];
+	    }
+	}
 
 }
 
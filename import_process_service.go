@@ -178,7 +178,7 @@ func (a *App) queryTable1ProcessWithRecover() db.QueryResult {
 		FROM enterprise_list 
 		ORDER BY unit_name
 	`
-	enterpriseResult, err := a.db.Query(enterpriseQuery)
+	enterpriseResult, err := a.GetDB().Query(enterpriseQuery)
 	if err != nil {
 		result.Message = "查询企业清单失败: " + err.Error()
 		return result
@@ -199,7 +199,7 @@ func (a *App) queryTable1ProcessWithRecover() db.QueryResult {
 		GROUP BY credit_code, stat_date
 		ORDER BY credit_code, stat_date
 	`
-	table1Result, err := a.db.Query(table1Query)
+	table1Result, err := a.GetDB().Query(table1Query)
 	if err != nil {
 		result.Ok = false
 		result.Message = "查询附表1数据失败: " + err.Error()
@@ -313,7 +313,7 @@ func (a *App) queryTable2ProcessWithRecover() db.QueryResult {
 		SELECT unit_name, credit_code FROM key_equipment_list
 		GROUP BY unit_name, credit_code
 	`
-	equipmentResult, err := a.db.Query(equipmentQuery)
+	equipmentResult, err := a.GetDB().Query(equipmentQuery)
 	if err != nil {
 		result.Message = "查询重点耗煤装置清单失败: " + err.Error()
 		return result
@@ -334,7 +334,7 @@ func (a *App) queryTable2ProcessWithRecover() db.QueryResult {
 		GROUP BY credit_code, stat_date
 		ORDER BY credit_code, stat_date
 	`
-	table2Result, err := a.db.Query(table2Query)
+	table2Result, err := a.GetDB().Query(table2Query)
 	if err != nil {
 		result.Ok = false
 		result.Message = "查询附表2数据失败: " + err.Error()
@@ -428,7 +428,7 @@ func (a *App) QueryTable3Process() db.QueryResult {
 	result := db.QueryResult{}
 
 	// 检查数据库连接
-	if a.db == nil {
+	if a.GetDB() == nil {
 		result.Ok = false
 		result.Message = "数据库未初始化"
 		return result
@@ -610,7 +610,7 @@ func (a *App) queryAndParseTable3Data() (map[string]bool, error) {
 		FROM fixed_assets_investment_project
 		GROUP BY examination_authority
 	`
-	table3Result, err := a.db.Query(table3Query)
+	table3Result, err := a.GetDB().Query(table3Query)
 	if err != nil {
 		return nil, err
 	}
@@ -733,7 +733,7 @@ func (a *App) queryAttachment2CityLevel(targetLocation interface{}) db.QueryResu
 		GROUP BY country_name, stat_date
 		ORDER BY country_name, stat_date`
 
-	attachment2Result, err := a.db.Query(attachment2Query)
+	attachment2Result, err := a.GetDB().Query(attachment2Query)
 	if err != nil {
 		result.Ok = false
 		result.Message = "查询附件2数据失败: " + err.Error()
@@ -865,7 +865,7 @@ func (a *App) queryAttachment2ProvinceLevel(targetLocation interface{}) db.Query
 		GROUP BY city_name, stat_date
 		ORDER BY city_name, stat_date`
 
-	attachment2Result, err := a.db.Query(attachment2Query)
+	attachment2Result, err := a.GetDB().Query(attachment2Query)
 	if err != nil {
 		result.Ok = false
 		result.Message = "查询附件2数据失败: " + err.Error()
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"shuji/db"
+	"sync"
+)
+
+// 系统数据库密钥
+// 系统数据库使用首次运行时生成的随机密钥加密，Windows上密钥经DPAPI保护后保存在密钥目录，
+// 数据目录被复制到其他计算机或被其他用户读取时无法解密；其他系统不支持密钥保护，见install_key_others.go。早期版本的系统数据库使用交换文件密码加密，打开前改用本机密钥
+
+var (
+	systemDbPassword      string
+	systemDbPasswordMutex sync.Mutex
+)
+
+// getSystemDbKeyPath 获取系统数据库密钥文件路径
+func getSystemDbKeyPath() string {
+	return GetPath(filepath.Join(KEY_DIR_NAME, SYSTEM_DB_KEY_FILE_NAME))
+}
+
+// getSystemDbPassword 获取系统数据库密钥，密钥文件不存在时生成
+func getSystemDbPassword() (string, error) {
+	systemDbPasswordMutex.Lock()
+	defer systemDbPasswordMutex.Unlock()
+
+	if systemDbPassword != "" {
+		return systemDbPassword, nil
+	}
+
+	keyPath := getSystemDbKeyPath()
+	data, err := os.ReadFile(keyPath)
+	if err == nil {
+		if err := checkKeyFileProtection(keyPath); err != nil {
+			return "", fmt.Errorf("系统数据库密钥不安全: %v", err)
+		}
+		secret, err := unprotectSecret(data)
+		if err != nil {
+			return "", fmt.Errorf("读取系统数据库密钥失败: %v", err)
+		}
+		systemDbPassword = hex.EncodeToString(secret)
+		return systemDbPassword, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("读取系统数据库密钥失败: %v", err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("生成系统数据库密钥失败: %v", err)
+	}
+	protected, err := protectSecret(secret)
+	if err != nil {
+		return "", fmt.Errorf("保护系统数据库密钥失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return "", fmt.Errorf("创建密钥目录失败: %v", err)
+	}
+	tempPath := keyPath + ".tmp"
+	if err := os.WriteFile(tempPath, protected, 0600); err != nil {
+		return "", fmt.Errorf("保存系统数据库密钥失败: %v", err)
+	}
+	if err := os.Rename(tempPath, keyPath); err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("保存系统数据库密钥失败: %v", err)
+	}
+	log.Printf("已生成系统数据库密钥: %s", keyPath)
+
+	systemDbPassword = hex.EncodeToString(secret)
+	return systemDbPassword, nil
+}
+
+// migrateLegacyDbKey 早期版本的系统数据库和快照使用交换文件密码加密，改用password重新加密，
+// 已使用password加密或未加密的文件保持不变，两个密码都不正确时返回ErrWrongKey
+func migrateLegacyDbKey(dbPath string, password string) error {
+	if err := db.CheckFileKey(dbPath, password); err == nil || !errors.Is(err, db.ErrWrongKey) {
+		return err
+	}
+	if err := db.CheckFileKey(dbPath, EXCHANGE_DB_PASSWORD); err != nil {
+		return err
+	}
+
+	// 上次异常退出遗留的工作文件按原密码对应的文件版本记录，先以原密码打开并关闭，把其中的数据写回后再更换密钥
+	if db.HasPendingWorkingFile(dbPath) {
+		legacyDb, err := db.NewDatabase(dbPath, EXCHANGE_DB_PASSWORD)
+		if err != nil {
+			return err
+		}
+		if err := legacyDb.Close(); err != nil {
+			return err
+		}
+	}
+	if err := db.RekeyFile(dbPath, EXCHANGE_DB_PASSWORD, password); err != nil {
+		return fmt.Errorf("更换数据库密钥失败: %v", err)
+	}
+	log.Printf("数据库已改用本机密钥加密: %s", dbPath)
+	return nil
+}
+
+// openSystemDb 使用本机密钥打开系统数据库，readOnly为true时以只读方式打开
+func openSystemDb(dbPath string, readOnly bool) (*db.Database, error) {
+	password, err := getSystemDbPassword()
+	if err != nil {
+		return nil, err
+	}
+	if readOnly {
+		database, err := db.NewReadOnlyDatabase(dbPath, password)
+		if errors.Is(err, db.ErrWrongKey) {
+			// 只读打开不修改文件，尚未更换密钥的早期版本数据库使用原密码打开
+			return db.NewReadOnlyDatabase(dbPath, EXCHANGE_DB_PASSWORD)
+		}
+		return database, err
+	}
+	if err := migrateLegacyDbKey(dbPath, password); err != nil {
+		return nil, err
+	}
+	return db.NewDatabase(dbPath, password)
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// 非Windows系统（麒麟、UOS等）没有DPAPI，不支持密钥保护：密钥以十六进制保存在密钥文件中，
+// 只依靠文件权限防止其他用户读取，数据目录连同密钥目录被复制到其他计算机后仍可解密。
+// 密钥文件权限被放宽或属于其他用户时拒绝使用，不会在不安全的密钥上继续打开数据库
+
+// protectSecret 非Windows系统不支持密钥保护，密钥以十六进制保存，只依靠文件权限保护
+func protectSecret(secret []byte) ([]byte, error) {
+	log.Printf("警告: 当前系统不支持密钥保护，系统数据库密钥只依靠文件权限保护，复制数据目录和密钥目录后可以解密")
+	return []byte(hex.EncodeToString(secret)), nil
+}
+
+// unprotectSecret 读取密钥文件中的密钥
+func unprotectSecret(data []byte) ([]byte, error) {
+	return hex.DecodeString(strings.TrimSpace(string(data)))
+}
+
+// checkKeyFileProtection 检查密钥文件只有当前用户可以读写，权限被放宽或属于其他用户时返回错误
+func checkKeyFileProtection(keyPath string) error {
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		return err
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("密钥文件权限不安全（%04o），应只允许当前用户读写（0600）: %s", perm, keyPath)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("密钥文件不属于当前用户: %s", keyPath)
+	}
+	log.Printf("警告: 当前系统不支持密钥保护，系统数据库密钥只依靠文件权限保护: %s", keyPath)
+	return nil
+}
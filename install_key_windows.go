@@ -0,0 +1,67 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	crypt32                = syscall.NewLazyDLL("crypt32.dll")
+	kernel32               = syscall.NewLazyDLL("kernel32.dll")
+	procCryptProtectData   = crypt32.NewProc("CryptProtectData")
+	procCryptUnprotectData = crypt32.NewProc("CryptUnprotectData")
+	procLocalFree          = kernel32.NewProc("LocalFree")
+)
+
+// cryptProtectUIForbidden 加解密时不弹出提示
+const cryptProtectUIForbidden = 0x1
+
+// dataBlob DPAPI的DATA_BLOB结构
+type dataBlob struct {
+	size uint32
+	data *byte
+}
+
+// newDataBlob 创建指向data的DATA_BLOB
+func newDataBlob(data []byte) *dataBlob {
+	if len(data) == 0 {
+		return &dataBlob{}
+	}
+	return &dataBlob{size: uint32(len(data)), data: &data[0]}
+}
+
+// bytes 复制DPAPI返回的数据并释放系统分配的内存
+func (b *dataBlob) bytes() []byte {
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(b.data)))
+	return append([]byte(nil), unsafe.Slice(b.data, b.size)...)
+}
+
+// protectSecret 使用DPAPI以当前用户身份加密密钥，只有本机的同一用户可以解密
+func protectSecret(secret []byte) ([]byte, error) {
+	var out dataBlob
+	r, _, err := procCryptProtectData.Call(uintptr(unsafe.Pointer(newDataBlob(secret))), 0, 0, 0, 0,
+		cryptProtectUIForbidden, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return nil, fmt.Errorf("DPAPI加密失败: %v", err)
+	}
+	return out.bytes(), nil
+}
+
+// checkKeyFileProtection 密钥经DPAPI加密，复制或被其他用户读取的密钥文件无法解密，不需要检查文件权限
+func checkKeyFileProtection(keyPath string) error {
+	return nil
+}
+
+// unprotectSecret 使用DPAPI解密密钥，其他计算机或其他用户复制的密钥文件无法解密
+func unprotectSecret(data []byte) ([]byte, error) {
+	var out dataBlob
+	r, _, err := procCryptUnprotectData.Call(uintptr(unsafe.Pointer(newDataBlob(data))), 0, 0, 0, 0,
+		cryptProtectUIForbidden, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return nil, fmt.Errorf("DPAPI解密失败: %v", err)
+	}
+	return out.bytes(), nil
+}
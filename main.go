@@ -56,7 +56,8 @@ func main() {
 				return Env.ExePath
 			}(),
 		},
-		OnStartup: app.startup,
+		OnStartup:  app.startup,
+		OnShutdown: app.shutdown,
 		Bind: []interface{}{
 			app,
 		},
@@ -65,6 +66,4 @@ func main() {
 	if err != nil {
 		println("Error:", err.Error())
 	}
-
-	// app.db.Close()
 }
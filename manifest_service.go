@@ -171,7 +171,7 @@ func (a *App) validateKeyEquipmentListFileWithRecover(filePath string) db.QueryR
 
 	for i := 1; i < len(rows); i++ {
 		row := rows[i]
-		if len(row) < 5 {
+		if len(row) < 8 {
 			result.Message = fileName + "第" + strconv.Itoa(i+1) + "行数据不完整"
 			return result
 		}
@@ -258,8 +258,14 @@ func (a *App) importEnterpriseListWithRecover(filePath string) db.QueryResult {
 		return result
 	}
 
+	// 导入清单会清空原有数据，导入前为系统数据库创建快照
+	if _, err := a.snapshotSystemDb(SNAPSHOT_REASON_LIST_IMPORT); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
 	// 开始事务
-	tx, err := a.db.Begin()
+	tx, err := a.GetDB().Begin()
 	if err != nil {
 		result.Message = "开始数据库事务失败: " + err.Error()
 		return result
@@ -328,18 +334,19 @@ func (a *App) importEnterpriseListWithRecover(filePath string) db.QueryResult {
 	}
 
 
-	count := 0
+	records := make([]db.EnterpriseList, 0, len(rows)-1)
 
 	// 处理数据行
 	for i := 1; i < len(rows); i++ {
 		row := rows[i]
 
-		data := EnterpriseListData{
-			ProvinceName: strings.TrimSpace(row[0]),
-			CityName:     strings.TrimSpace(row[1]),
-			CountryName:  strings.TrimSpace(row[2]),
-			UnitName:     strings.TrimSpace(row[3]),
-			CreditCode:   strings.TrimSpace(row[4]),
+		data := db.EnterpriseList{
+			ObjID:        uuid.New().String(),
+			ProvinceName: getRowCell(row, 0),
+			CityName:     getRowCell(row, 1),
+			CountryName:  getRowCell(row, 2),
+			UnitName:     getRowCell(row, 3),
+			CreditCode:   getRowCell(row, 4),
 		}
 
 		if data.ProvinceName != provinceName {
@@ -355,19 +362,15 @@ func (a *App) importEnterpriseListWithRecover(filePath string) db.QueryResult {
 			return result
 		}
 
-		// 全量数据导入：直接插入数据
-		objID := uuid.New().String()
-		_, err = tx.Exec(`
-			INSERT INTO enterprise_list (obj_id, province_name, city_name, country_name, unit_name, credit_code)
-			VALUES (?, ?, ?, ?, ?, ?)
-		`, objID, data.ProvinceName, data.CityName, data.CountryName, data.UnitName, data.CreditCode)
+		records = append(records, data)
+	}
 
-		if err != nil {
-			result.Message = "插入数据失败: " + err.Error()
-			return result
-		}
-		count++
+	// 全量数据导入：直接插入数据
+	if err := db.NewRepository[db.EnterpriseList](a.GetDB(), a).InsertTx(tx, records, listImportBatchSize); err != nil {
+		result.Message = "插入数据失败: " + err.Error()
+		return result
 	}
+	count := len(records)
 
 	// 记录导入历史
 	a.InsertImportRecord(fileName, "企业清单", "导入成功", fmt.Sprintf("成功导入%d条记录", count))
@@ -412,8 +415,14 @@ func (a *App) importKeyEquipmentListWithRecover(filePath string) db.QueryResult
 		return result
 	}
 
+	// 导入清单会清空原有数据，导入前为系统数据库创建快照
+	if _, err := a.snapshotSystemDb(SNAPSHOT_REASON_LIST_IMPORT); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
 	// 开始事务
-	tx, err := a.db.Begin()
+	tx, err := a.GetDB().Begin()
 	if err != nil {
 		result.Message = "开始数据库事务失败: " + err.Error()
 		return result
@@ -483,20 +492,21 @@ func (a *App) importKeyEquipmentListWithRecover(filePath string) db.QueryResult
 	}
 
 
-	count := 0
+	records := make([]db.KeyEquipmentList, 0, len(rows)-1)
 
 	// 处理数据行
 	for i := 1; i < len(rows); i++ {
 		row := rows[i]
-		data := KeyEquipmentListData{
-			ProvinceName:     strings.TrimSpace(row[0]),
-			CityName:         strings.TrimSpace(row[1]),
-			CountryName:      strings.TrimSpace(row[2]),
-			UnitName:         strings.TrimSpace(row[3]),
-			CreditCode:       strings.TrimSpace(row[4]),
-			EquipType:        strings.TrimSpace(row[5]),
-			EquipModelNumber: strings.TrimSpace(row[6]),
-			EquipNo:          strings.TrimSpace(row[7]),
+		data := db.KeyEquipmentList{
+			ObjID:            uuid.New().String(),
+			ProvinceName:     getRowCell(row, 0),
+			CityName:         getRowCell(row, 1),
+			CountryName:      getRowCell(row, 2),
+			UnitName:         getRowCell(row, 3),
+			CreditCode:       getRowCell(row, 4),
+			EquipType:        getRowCell(row, 5),
+			EquipModelNumber: getRowCell(row, 6),
+			EquipNo:          getRowCell(row, 7),
 		}
 
 		if data.ProvinceName != provinceName {
@@ -511,21 +521,16 @@ func (a *App) importKeyEquipmentListWithRecover(filePath string) db.QueryResult
 			result.Message = fmt.Sprintf("第%d行：装置清单区域和当前区域不一致", i+2)
 			return result
 		}
-		
 
-		// 全量数据导入：直接插入数据
-		objID := uuid.New().String()
-		_, err = tx.Exec(`
-			INSERT INTO key_equipment_list (obj_id, province_name, city_name, country_name, unit_name, credit_code, equip_type, equip_model_number, equip_no)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`, objID, data.ProvinceName, data.CityName, data.CountryName, data.UnitName, data.CreditCode, data.EquipType, data.EquipModelNumber, data.EquipNo)
+		records = append(records, data)
+	}
 
-		if err != nil {
-			result.Message = "插入数据失败: " + err.Error()
-			return result
-		}
-		count++
+	// 全量数据导入：直接插入数据
+	if err := db.NewRepository[db.KeyEquipmentList](a.GetDB(), a).InsertTx(tx, records, listImportBatchSize); err != nil {
+		result.Message = "插入数据失败: " + err.Error()
+		return result
 	}
+	count := len(records)
 
 	// 记录导入历史
 	a.InsertImportRecord(fileName, "装置清单", "导入成功", fmt.Sprintf("成功导入%d条记录", count))
@@ -535,6 +540,17 @@ func (a *App) importKeyEquipmentListWithRecover(filePath string) db.QueryResult
 	return result
 }
 
+// listImportBatchSize 清单导入每批写入的记录数
+const listImportBatchSize = 200
+
+// getRowCell 获取Excel行中指定列的值，列不存在时返回空字符串
+func getRowCell(row []string, index int) string {
+	if index >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[index])
+}
+
 // validateHeaders 验证表头
 func validateHeaders(headers []string, expectedHeaders []string) bool {
 	if len(headers) < len(expectedHeaders) {
@@ -558,18 +574,18 @@ func (a *App) IsEnterpriseListExist() (bool, error) {
 		return isEnterpriseListExist, nil
 	}
 
-	rows, err := a.db.QueryRow("SELECT COUNT(1) as count FROM enterprise_list")
+	count, err := db.NewRepository[db.EnterpriseList](a.GetDB(), a).Count("")
 	if err != nil {
 		return false, fmt.Errorf("查询企业清单失败: %v", err)
 	}
 
-	isEnterpriseListExist = rows.Data.(map[string]interface{})["count"].(int64) > 0
+	isEnterpriseListExist = count > 0
 	return isEnterpriseListExist, nil
 }
 
 // GetEnterpriseInfoByCreditCode 获取企业信息
 func (a *App) GetEnterpriseInfoByCreditCode(creditCode string) db.QueryResult {
-	rows, err := a.db.QueryRow("SELECT province_name, city_name, country_name, unit_name FROM enterprise_list WHERE credit_code = ?", creditCode)
+	rows, err := a.GetDB().QueryRow("SELECT province_name, city_name, country_name, unit_name FROM enterprise_list WHERE credit_code = ?", creditCode)
 	if err != nil {
 		return db.QueryResult{
 			Ok:      false,
@@ -593,18 +609,18 @@ func (a *App) IsEquipmentListExist() (bool, error) {
 	if isEquipmentListExist {
 		return isEquipmentListExist, nil
 	}
-	rows, err := a.db.QueryRow("SELECT COUNT(1) as count FROM key_equipment_list")
+	count, err := db.NewRepository[db.KeyEquipmentList](a.GetDB(), a).Count("")
 	if err != nil {
 		return false, fmt.Errorf("查询装置清单失败: %v", err)
 	}
 
-	isEquipmentListExist = rows.Data.(map[string]interface{})["count"].(int64) > 0
+	isEquipmentListExist = count > 0
 	return isEquipmentListExist, nil
 }
 
 // 获取装置清单信息By信用代码
 func (a *App) GetEquipmentByCreditCode(creditCode string) db.QueryResult {
-	rows, err := a.db.QueryRow("SELECT province_name, city_name, country_name, unit_name FROM key_equipment_list WHERE credit_code = ?", creditCode)
+	rows, err := a.GetDB().QueryRow("SELECT province_name, city_name, country_name, unit_name FROM key_equipment_list WHERE credit_code = ?", creditCode)
 	if err != nil {
 		return db.QueryResult{
 			Ok:      false,
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"shuji/data_import"
+	"shuji/db"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 合并冲突处理策略
+const (
+	MergeStrategyManual    = "manual"           // 由用户逐条选择保留的文件（默认）
+	MergeStrategyNewest    = "newest"           // 创建时间最新的记录优先
+	MergeStrategyConfirmed = "confirmed"        // 已确认的记录优先
+	MergeStrategyPreferred = "preferred_source" // 指定的数据库文件优先
+	MergeStrategyIdentical = "identical"        // 各来源内容相同，不视为冲突
+)
+
+// MergePolicy 合并冲突处理策略
+type MergePolicy struct {
+	Strategy        string `json:"strategy"`        // 冲突处理策略
+	PreferredSource string `json:"preferredSource"` // 优先的数据库文件路径，策略为preferred_source时使用
+	IgnoreIdentical bool   `json:"ignoreIdentical"` // 内容相同的记录不视为冲突
+}
+
+// MergeResolution 自动处理的冲突记录
+type MergeResolution struct {
+	TableType   string `json:"tableType"`   // 表类型
+	ConflictKey string `json:"conflictKey"` // 冲突键
+	Strategy    string `json:"strategy"`    // 实际使用的处理策略
+	FilePath    string `json:"filePath"`    // 保留的数据库文件路径
+	FileName    string `json:"fileName"`    // 保留的数据库文件名
+}
+
+// mergeCandidate 冲突记录在单个来源数据库中的数据
+type mergeCandidate struct {
+	FilePath string
+	Rows     map[string][]map[string]interface{} // key: 表名, value: 记录
+}
+
+// getMergeTableNames 获取表类型参与冲突比较的数据表，第一个为主表
+func getMergeTableNames(tableType string) []string {
+	switch tableType {
+	case "table1":
+		return []string{data_import.TableEnterpriseCoalConsumptionMain, data_import.TableEnterpriseCoalConsumptionUsage, data_import.TableEnterpriseCoalConsumptionEquip}
+	case "table2":
+		return []string{data_import.TableCriticalCoalEquipmentConsumption}
+	case "table3":
+		return []string{data_import.TableFixedAssetsInvestmentProject}
+	case "attachment2":
+		return []string{data_import.TableCoalConsumptionReport}
+	}
+	return nil
+}
+
+// mergeChildRows 冲突记录的扩展表数据，key: 扩展表名, value: map[fk_id]扩展表记录
+type mergeChildRows map[string]map[string][]map[string]interface{}
+
+// queryMergeChildRows 按批读取冲突记录的扩展表数据并按fk_id分组，避免逐条记录查询
+func queryMergeChildRows(tableType string, sourceDb *db.Database, objIds []string) (mergeChildRows, error) {
+	childRows := make(mergeChildRows)
+	for _, childTable := range getMergeTableNames(tableType)[1:] {
+		childRows[childTable] = make(map[string][]map[string]interface{})
+		for start := 0; start < len(objIds); start += mergeBatchSize {
+			end := min(start+mergeBatchSize, len(objIds))
+			args := make([]interface{}, 0, end-start)
+			for _, objID := range objIds[start:end] {
+				args = append(args, objID)
+			}
+			query := fmt.Sprintf("SELECT * FROM %s WHERE fk_id IN (%s) ORDER BY row_no", childTable, strings.TrimSuffix(strings.Repeat("?,", len(args)), ","))
+			err := sourceDb.QueryEach(query, func(row map[string]interface{}) error {
+				fkID := getStringValue(row["fk_id"])
+				childRows[childTable][fkID] = append(childRows[childTable][fkID], row)
+				return nil
+			}, args...)
+			if err != nil {
+				return nil, fmt.Errorf("读取%s失败: %v", childTable, err)
+			}
+		}
+	}
+	return childRows, nil
+}
+
+// buildMergeCandidates 按来源顺序收集冲突键在各数据库中的记录，表1同时收集扩展表数据
+func (a *App) buildMergeCandidates(tableType string, fileRows map[string][]map[string]interface{}, childRows map[string]mergeChildRows, originalSourcePaths []string) []mergeCandidate {
+	tableNames := getMergeTableNames(tableType)
+	candidates := []mergeCandidate{}
+
+	for _, filePath := range originalSourcePaths {
+		rows, exists := fileRows[filePath]
+		if !exists {
+			continue
+		}
+
+		candidate := mergeCandidate{
+			FilePath: filePath,
+			Rows:     map[string][]map[string]interface{}{tableNames[0]: rows},
+		}
+		for _, childTable := range tableNames[1:] {
+			for _, row := range rows {
+				candidate.Rows[childTable] = append(candidate.Rows[childTable], childRows[filePath][childTable][getStringValue(row["obj_id"])]...)
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates
+}
+
+// diffMergeCandidates 比较各来源记录的字段差异（已解密）
+func (a *App) diffMergeCandidates(tableType string, candidates []mergeCandidate) []data_import.MergeFieldDiff {
+	rows := make([]map[string][]map[string]interface{}, 0, len(candidates))
+	for _, candidate := range candidates {
+		rows = append(rows, candidate.Rows)
+	}
+	return data_import.NewDataImportService(a).DiffMergeCandidates(getMergeTableNames(tableType), rows)
+}
+
+// resolveMergeConflict 按策略选择保留的来源，无法自动确定时返回空字符串由用户选择
+func (a *App) resolveMergeConflict(policy MergePolicy, tableType string, candidates []mergeCandidate, diffs []data_import.MergeFieldDiff) (string, string) {
+	if len(candidates) == 0 {
+		return "", ""
+	}
+
+	// 内容相同的记录任取一个来源
+	if policy.IgnoreIdentical && len(diffs) == 0 {
+		return candidates[0].FilePath, MergeStrategyIdentical
+	}
+
+	mainTable := getMergeTableNames(tableType)[0]
+	var winners []string
+	switch policy.Strategy {
+	case MergeStrategyNewest:
+		// 创建时间最新的来源唯一时才自动选择
+		var newest int64 = -1
+		for _, candidate := range candidates {
+			for _, row := range candidate.Rows[mainTable] {
+				createTime, err := strconv.ParseInt(getStringValue(row["create_time"]), 10, 64)
+				if err != nil {
+					continue
+				}
+				if createTime > newest {
+					newest = createTime
+					winners = []string{candidate.FilePath}
+				} else if createTime == newest && !slices.Contains(winners, candidate.FilePath) {
+					winners = append(winners, candidate.FilePath)
+				}
+			}
+		}
+	case MergeStrategyConfirmed:
+		// 只有一个来源的记录全部已确认时才自动选择
+		for _, candidate := range candidates {
+			confirmed := len(candidate.Rows[mainTable]) > 0
+			for _, row := range candidate.Rows[mainTable] {
+				if status, err := SM4Decrypt(getStringValue(row["is_confirm"])); err != nil || status != "1" {
+					confirmed = false
+				}
+			}
+			if confirmed {
+				winners = append(winners, candidate.FilePath)
+			}
+		}
+	case MergeStrategyPreferred:
+		for _, candidate := range candidates {
+			if candidate.FilePath == policy.PreferredSource {
+				winners = append(winners, candidate.FilePath)
+			}
+		}
+	}
+
+	if len(winners) != 1 {
+		return "", ""
+	}
+	return winners[0], policy.Strategy
+}
+
+// applyMergePolicy 计算冲突字段差异并按策略自动处理冲突，已处理的冲突从conflictKeyMap中移除，
+// conflictRows按冲突键和文件路径分组，返回保留来源的数据、处理记录和未处理冲突的字段差异
+func (a *App) applyMergePolicy(policy MergePolicy, tableType string, conflictKeyMap map[string]map[string]ConflictSourceInfo,
+	conflictRows map[string]map[string][]map[string]interface{}, childRows map[string]mergeChildRows,
+	originalSourcePaths []string) ([]map[string]interface{}, []MergeResolution, map[string][]data_import.MergeFieldDiff) {
+	var resolvedData []map[string]interface{}
+	resolutions := []MergeResolution{}
+	conflictDiffs := make(map[string][]data_import.MergeFieldDiff)
+
+	for conflictKey := range conflictKeyMap {
+		fileRows := conflictRows[conflictKey]
+		candidates := a.buildMergeCandidates(tableType, fileRows, childRows, originalSourcePaths)
+		diffs := a.diffMergeCandidates(tableType, candidates)
+
+		winner, strategy := a.resolveMergeConflict(policy, tableType, candidates, diffs)
+		if winner == "" {
+			conflictDiffs[conflictKey] = diffs
+			continue
+		}
+
+		// 标记数据来源，合并扩展表时只从保留的数据库中读取
+		for _, row := range fileRows[winner] {
+			row[mergeSourceField] = winner
+			resolvedData = append(resolvedData, row)
+		}
+		resolutions = append(resolutions, MergeResolution{
+			TableType:   tableType,
+			ConflictKey: conflictKey,
+			Strategy:    strategy,
+			FilePath:    winner,
+			FileName:    filepath.Base(winner),
+		})
+		delete(conflictKeyMap, conflictKey)
+	}
+
+	return resolvedData, resolutions, conflictDiffs
+}
+
+// getConditionConflictKey 根据冲突条件生成与冲突检查一致的冲突键
+func getConditionConflictKey(tableType string, condition Condition) string {
+	switch tableType {
+	case "table1", "table2":
+		return fmt.Sprintf("%v_%v", condition.CreditCode, condition.StatDate)
+	case "table3":
+		return fmt.Sprintf("%v_%v", condition.ProjectCode, condition.DocumentNumber)
+	case "attachment2":
+		return fmt.Sprintf("%v_%v_%v_%v", condition.ProvinceName, condition.CityName, condition.CountryName, condition.StatDate)
+	}
+	return ""
+}
+
+// mergeSourceField 自动处理冲突时记录数据来源的临时字段，不写入数据库
+const mergeSourceField = "_merge_source"
+
+// sortConflictSources 按上传顺序排列冲突来源，与字段差异中的取值顺序一致
+func sortConflictSources(sources []ConflictSourceInfo, originalSourcePaths []string) {
+	slices.SortStableFunc(sources, func(x, y ConflictSourceInfo) int {
+		return slices.Index(originalSourcePaths, x.FilePath) - slices.Index(originalSourcePaths, y.FilePath)
+	})
+}
+
+// insertMergeLogs 在合并后的数据库中记录冲突处理结果
+func (a *App) insertMergeLogs(tx *sql.Tx, resolutions []MergeResolution) error {
+	insertQuery := `INSERT INTO data_merge_log (
+		obj_id, table_type, conflict_key, strategy, source_file, merge_time, create_user
+	) VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	mergeTime := time.Now().UnixMilli()
+	for _, resolution := range resolutions {
+		if _, err := tx.Exec(insertQuery, uuid.New().String(), resolution.TableType, resolution.ConflictKey,
+			resolution.Strategy, resolution.FileName, mergeTime, a.GetCurrentOSUser()); err != nil {
+			return fmt.Errorf("记录冲突处理结果失败: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"shuji/data_import"
+	"shuji/db"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+)
+
+// mergeSourceInfo 合并来源数据库信息
+type mergeSourceInfo struct {
+	FileName     string // 来源数据库文件名
+	FileHash     string // 来源数据库文件哈希（SM3）
+	ProvinceName string // 来源数据库区域配置-省
+	CityName     string // 来源数据库区域配置-市
+	CountryName  string // 来源数据库区域配置-县
+	ExportTime   int64  // 来源数据库导出时间，未记录时使用文件修改时间
+}
+
+// getMergeSourceInfo 读取来源数据库的文件哈希、区域配置和导出时间
+func (a *App) getMergeSourceInfo(sourceDb *db.Database, filePath string) mergeSourceInfo {
+	info := mergeSourceInfo{FileName: filepath.Base(filePath)}
+
+	if fileHash, err := data_import.GetFileHash(filePath); err == nil {
+		info.FileHash = fileHash
+	}
+
+	areaResult, err := sourceDb.QueryRow("SELECT province_name, city_name, country_name FROM area_config LIMIT 1")
+	if err == nil && areaResult.Data != nil {
+		area := areaResult.Data.(map[string]interface{})
+		info.ProvinceName = getStringValue(area["province_name"])
+		info.CityName = getStringValue(area["city_name"])
+		info.CountryName = getStringValue(area["country_name"])
+	}
+
+	// 早期版本导出的数据库没有导出记录
+	exportResult, err := sourceDb.QueryRow("SELECT export_time FROM data_export_info ORDER BY export_time DESC LIMIT 1")
+	if err == nil && exportResult.Data != nil {
+		info.ExportTime, _ = strconv.ParseInt(getStringValue(exportResult.Data.(map[string]interface{})["export_time"]), 10, 64)
+	}
+	if info.ExportTime == 0 {
+		if stat, err := os.Stat(filePath); err == nil {
+			info.ExportTime = stat.ModTime().UnixMilli()
+		}
+	}
+
+	return info
+}
+
+// insertMergeProvenance 记录合并后数据行的来源，数据行未成功写入时不记录
+func (a *App) insertMergeProvenance(tx *sql.Tx, tableName string, objID interface{}, info mergeSourceInfo, mergeTime int64) error {
+	query := fmt.Sprintf(`INSERT INTO data_merge_source (
+		obj_id, table_name, record_id, original_obj_id, source_file, source_hash,
+		source_province, source_city, source_country, export_time, merge_time
+	) SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? WHERE EXISTS (SELECT 1 FROM %s WHERE obj_id = ?)`, tableName)
+
+	_, err := tx.Exec(query, uuid.New().String(), tableName, objID, objID, info.FileName, info.FileHash,
+		info.ProvinceName, info.CityName, info.CountryName, info.ExportTime, mergeTime, objID)
+	if err != nil {
+		return fmt.Errorf("记录数据来源失败: %v", err)
+	}
+	return nil
+}
+
+// recordMergeProvenance 记录合并数据的来源，表1同时记录扩展表数据的来源
+func (a *App) recordMergeProvenance(tx *sql.Tx, tableType string, rows []map[string]interface{}, sourceDbs []*db.Database,
+	originalSourcePaths []string, sourceInfos map[string]mergeSourceInfo) error {
+	tableNames := getMergeTableNames(tableType)
+	mergeTime := time.Now().UnixMilli()
+
+	for _, row := range rows {
+		sourcePath, _ := row[mergeSourceField].(string)
+		index := slices.Index(originalSourcePaths, sourcePath)
+		if index < 0 {
+			continue
+		}
+		info := sourceInfos[sourcePath]
+
+		if err := a.insertMergeProvenance(tx, tableNames[0], row["obj_id"], info, mergeTime); err != nil {
+			return err
+		}
+
+		for _, childTable := range tableNames[1:] {
+			childResult, err := sourceDbs[index].Query(fmt.Sprintf("SELECT obj_id FROM %s WHERE fk_id = ?", childTable), row["obj_id"])
+			if err != nil || childResult.Data == nil {
+				continue
+			}
+			for _, child := range childResult.Data.([]map[string]interface{}) {
+				if err := a.insertMergeProvenance(tx, childTable, child["obj_id"], info, mergeTime); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// recordConflictProvenance 记录用户选择的冲突数据的来源
+func (a *App) recordConflictProvenance(tx *sql.Tx, conflict ConflictData, sourceDb *db.Database) error {
+	tableNames := getMergeTableNames(conflict.TableType)
+	if len(tableNames) == 0 {
+		return nil
+	}
+	info := a.getMergeSourceInfo(sourceDb, conflict.FilePath)
+	mergeTime := time.Now().UnixMilli()
+
+	// 冲突处理会替换目标数据库中的数据，先清理已被删除数据的来源记录
+	for _, tableName := range tableNames {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM data_merge_source WHERE table_name = ? AND record_id NOT IN (SELECT obj_id FROM %s)", tableName), tableName); err != nil {
+			return fmt.Errorf("清理数据来源失败: %v", err)
+		}
+	}
+
+	var keyWhere string
+	switch conflict.TableType {
+	case "table1", "table2":
+		keyWhere = "credit_code = ? AND stat_date = ?"
+	case "table3":
+		keyWhere = "project_code = ? AND document_number = ?"
+	case "attachment2":
+		keyWhere = "province_name = ? AND city_name = ? AND country_name = ? AND stat_date = ?"
+	}
+
+	for _, condition := range conflict.Conditions {
+		var args []interface{}
+		switch conflict.TableType {
+		case "table1", "table2":
+			args = []interface{}{condition.CreditCode, condition.StatDate}
+		case "table3":
+			args = []interface{}{condition.ProjectCode, condition.DocumentNumber}
+		case "attachment2":
+			args = []interface{}{condition.ProvinceName, condition.CityName, condition.CountryName, condition.StatDate}
+		}
+
+		// 冲突数据完全按照源表数据插入，按源数据库的obj_id记录来源
+		sourceResult, err := sourceDb.Query(fmt.Sprintf("SELECT obj_id FROM %s WHERE %s", tableNames[0], keyWhere), args...)
+		if err != nil || sourceResult.Data == nil {
+			continue
+		}
+		for _, row := range sourceResult.Data.([]map[string]interface{}) {
+			if err := a.insertMergeProvenance(tx, tableNames[0], row["obj_id"], info, mergeTime); err != nil {
+				return err
+			}
+			for _, childTable := range tableNames[1:] {
+				childResult, err := sourceDb.Query(fmt.Sprintf("SELECT obj_id FROM %s WHERE fk_id = ?", childTable), row["obj_id"])
+				if err != nil || childResult.Data == nil {
+					continue
+				}
+				for _, child := range childResult.Data.([]map[string]interface{}) {
+					if err := a.insertMergeProvenance(tx, childTable, child["obj_id"], info, mergeTime); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// queryMergeSourceSummary 按来源数据库汇总合并数据的来源信息，数据库没有来源记录时返回空
+func queryMergeSourceSummary(database *db.Database) []map[string]interface{} {
+	exists, err := database.ColumnExists("data_merge_source", "record_id")
+	if err != nil || !exists {
+		return nil
+	}
+
+	query := `SELECT source_file, source_hash, source_province, source_city, source_country, export_time,
+		MAX(merge_time) AS merge_time, COUNT(1) AS row_count
+		FROM data_merge_source
+		GROUP BY source_file, source_hash, source_province, source_city, source_country, export_time
+		ORDER BY source_province, source_city, source_country, source_file`
+	result, err := database.Query(query)
+	if err != nil || result.Data == nil {
+		return nil
+	}
+	return result.Data.([]map[string]interface{})
+}
+
+// formatMergeTime 格式化来源记录中的毫秒时间戳
+func formatMergeTime(value interface{}) string {
+	millis, err := strconv.ParseInt(getStringValue(value), 10, 64)
+	if err != nil || millis <= 0 {
+		return ""
+	}
+	return time.UnixMilli(millis).Format("2006-01-02 15:04:05")
+}
+
+// createMergeSourceSheet 在Excel文件中创建数据来源汇总表sheet
+func (a *App) createMergeSourceSheet(f *excelize.File, sourceSummary []map[string]interface{}) db.QueryResult {
+	result := db.QueryResult{}
+
+	sheetName := "数据来源汇总表"
+	f.NewSheet(sheetName)
+
+	// 设置大标题
+	f.SetCellValue(sheetName, "A1", "数据来源汇总表")
+	f.MergeCell(sheetName, "A1", "H1")
+
+	headers := []string{"来源文件", "文件哈希（SM3）", "省", "市", "县", "导出时间", "合并时间", "数据条数"}
+
+	headerStyle, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+			Size: 12,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#E6E6FA"},
+			Pattern: 1,
+		},
+		Alignment: &excelize.Alignment{
+			Horizontal: "center",
+			Vertical:   "center",
+		},
+		Border: []excelize.Border{
+			{Type: "left", Color: "000000", Style: 1},
+			{Type: "top", Color: "000000", Style: 1},
+			{Type: "bottom", Color: "000000", Style: 1},
+			{Type: "right", Color: "000000", Style: 1},
+		},
+	})
+	if err != nil {
+		result.Message = "创建样式失败: " + err.Error()
+		return result
+	}
+
+	titleStyle, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+			Size: 16,
+		},
+		Alignment: &excelize.Alignment{
+			Horizontal: "center",
+			Vertical:   "center",
+		},
+	})
+	if err != nil {
+		result.Message = "创建标题样式失败: " + err.Error()
+		return result
+	}
+	f.SetCellStyle(sheetName, "A1", "A1", titleStyle)
+
+	for i, header := range headers {
+		cellName, _ := excelize.CoordinatesToCellName(i+1, 2)
+		f.SetCellValue(sheetName, cellName, header)
+		f.SetCellStyle(sheetName, cellName, cellName, headerStyle)
+	}
+
+	dataStyle, err := f.NewStyle(&excelize.Style{
+		Border: []excelize.Border{
+			{Type: "left", Color: "000000", Style: 1},
+			{Type: "top", Color: "000000", Style: 1},
+			{Type: "bottom", Color: "000000", Style: 1},
+			{Type: "right", Color: "000000", Style: 1},
+		},
+		Alignment: &excelize.Alignment{
+			Horizontal: "center",
+			Vertical:   "center",
+		},
+	})
+	if err != nil {
+		log.Printf("创建数据行样式失败: %v", err)
+	}
+
+	rowIndex := 3
+	for _, row := range sourceSummary {
+		values := []interface{}{
+			row["source_file"], row["source_hash"], row["source_province"], row["source_city"], row["source_country"],
+			formatMergeTime(row["export_time"]), formatMergeTime(row["merge_time"]), row["row_count"],
+		}
+		for col, value := range values {
+			cellName, _ := excelize.CoordinatesToCellName(col+1, rowIndex)
+			f.SetCellValue(sheetName, cellName, value)
+			if dataStyle != 0 {
+				f.SetCellStyle(sheetName, cellName, cellName, dataStyle)
+			}
+		}
+		rowIndex++
+	}
+
+	// 设置列宽
+	f.SetColWidth(sheetName, "A", "A", 30) // 来源文件
+	f.SetColWidth(sheetName, "B", "B", 70) // 文件哈希
+	f.SetColWidth(sheetName, "C", "E", 15) // 省市县
+	f.SetColWidth(sheetName, "F", "G", 22) // 导出时间、合并时间
+	f.SetColWidth(sheetName, "H", "H", 12) // 数据条数
+
+	result.Ok = true
+	result.Message = "数据来源汇总表sheet创建成功"
+	return result
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"path/filepath"
+	"shuji/data_import"
+	"shuji/db"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// 合并进度事件
+const (
+	MERGE_PROGRESS_EVENT = "merge_progress" // 前端监听的合并进度事件名
+
+	MERGE_STAGE_COPY   = "copy"   // 复制并校验数据文件
+	MERGE_STAGE_INDEX  = "index"  // 建立冲突键索引
+	MERGE_STAGE_INSERT = "insert" // 写入合并数据
+	MERGE_STAGE_DONE   = "done"   // 合并结束
+
+	mergeBatchSize     = 500  // 每批写入的记录数
+	mergeProgressEvery = 1000 // 每处理多少条记录发送一次进度
+)
+
+// errMergeCanceled 用户取消合并
+var errMergeCanceled = fmt.Errorf("合并已取消")
+
+// MergeProgress 合并进度
+type MergeProgress struct {
+	Stage     string `json:"stage"`     // 当前阶段
+	FileName  string `json:"fileName"`  // 正在处理的数据文件名
+	TableType string `json:"tableType"` // 正在处理的表类型
+	Current   int    `json:"current"`   // 正在处理第几个数据文件（从1开始）
+	Total     int    `json:"total"`     // 数据文件总数
+	Rows      int    `json:"rows"`      // 当前数据文件当前表已处理的记录数
+}
+
+// mergeTableSpec 数据表的合并规则
+type mergeTableSpec struct {
+	TableType    string   // 表类型
+	TableName    string   // 主表名
+	KeyFields    []string // 冲突键字段，与原冲突键拼接规则一致
+	NameField    string   // 冲突详情中显示的名称字段
+	ValidateArea bool     // 是否校验数据区域与所选区域一致
+}
+
+// mergeTableSpecs 参与合并的数据表，按合并顺序排列
+var mergeTableSpecs = []mergeTableSpec{
+	{TableType: "table1", TableName: data_import.TableEnterpriseCoalConsumptionMain, KeyFields: []string{"credit_code", "stat_date"}, NameField: "unit_name", ValidateArea: true},
+	{TableType: "table2", TableName: data_import.TableCriticalCoalEquipmentConsumption, KeyFields: []string{"credit_code", "stat_date"}, NameField: "unit_name", ValidateArea: true},
+	{TableType: "table3", TableName: data_import.TableFixedAssetsInvestmentProject, KeyFields: []string{"project_code", "document_number"}, NameField: "project_name"},
+	{TableType: "attachment2", TableName: data_import.TableCoalConsumptionReport, KeyFields: []string{"province_name", "city_name", "country_name", "stat_date"}, ValidateArea: true},
+}
+
+// keyOf 生成记录的冲突键
+func (spec mergeTableSpec) keyOf(row map[string]interface{}) string {
+	parts := make([]string, 0, len(spec.KeyFields))
+	for _, field := range spec.KeyFields {
+		parts = append(parts, fmt.Sprintf("%v", row[field]))
+	}
+	return strings.Join(parts, "_")
+}
+
+// indexColumns 建立冲突键索引时读取的字段，不读取整行数据
+func (spec mergeTableSpec) indexColumns() []string {
+	columns := append([]string{"obj_id"}, spec.KeyFields...)
+	if spec.NameField != "" {
+		columns = append(columns, spec.NameField)
+	}
+	if spec.ValidateArea {
+		for _, field := range []string{"province_name", "city_name", "country_name"} {
+			if !slices.Contains(columns, field) {
+				columns = append(columns, field)
+			}
+		}
+	}
+	return columns
+}
+
+// mergeTablePlan 单个数据表的合并计划
+type mergeTablePlan struct {
+	Conflicts TableConflictInfo        // 需要用户处理的冲突
+	SkipKeys  map[string]bool          // 多个文件中都存在的冲突键，流式写入时跳过
+	Resolved  []map[string]interface{} // 按合并策略保留的冲突数据
+}
+
+// mergeTask 正在进行的合并任务，同一时间只允许一个合并任务
+var mergeTask struct {
+	sync.Mutex
+	cancel context.CancelFunc
+}
+
+// startMergeTask 开始合并任务，返回任务上下文和结束任务的函数
+func (a *App) startMergeTask() (context.Context, func(), error) {
+	mergeTask.Lock()
+	defer mergeTask.Unlock()
+
+	if mergeTask.cancel != nil {
+		return nil, nil, fmt.Errorf("已有合并任务正在进行，请等待完成或取消后再试")
+	}
+
+	parent := a.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	mergeTask.cancel = cancel
+
+	finish := func() {
+		mergeTask.Lock()
+		defer mergeTask.Unlock()
+		cancel()
+		mergeTask.cancel = nil
+	}
+	return ctx, finish, nil
+}
+
+// CancelMerge 取消正在进行的合并，已写入的数据会回滚并删除临时文件
+func (a *App) CancelMerge() db.QueryResult {
+	mergeTask.Lock()
+	defer mergeTask.Unlock()
+
+	if mergeTask.cancel == nil {
+		return db.QueryResult{Ok: false, Message: "没有正在进行的合并任务"}
+	}
+	mergeTask.cancel()
+	return db.QueryResult{Ok: true, Message: "已取消合并"}
+}
+
+// checkMergeCanceled 检查合并是否已被取消
+func checkMergeCanceled(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return errMergeCanceled
+	}
+	return nil
+}
+
+// emitMergeProgress 向前端发送合并进度
+func (a *App) emitMergeProgress(progress MergeProgress) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, MERGE_PROGRESS_EVENT, progress)
+}
+
+// planMergeTable 只读取冲突键建立索引，检查文件间冲突并按策略处理，只有冲突记录才读取整行数据
+func (a *App) planMergeTable(ctx context.Context, spec mergeTableSpec, sourceDbs []*db.Database, originalSourcePaths []string,
+	areaConfig AreaConfig, policy MergePolicy) (mergeTablePlan, error) {
+	plan := mergeTablePlan{SkipKeys: make(map[string]bool)}
+	fileNames := []string{}
+
+	keyIndex := make(map[string]map[int][]string) // key: 冲突键, value: map[来源序号]obj_id列表
+	keyNames := make(map[string]string)           // key: 冲突键, value: 名称字段取值
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(spec.indexColumns(), ", "), spec.TableName)
+
+	for i, sourceDb := range sourceDbs {
+		progress := MergeProgress{Stage: MERGE_STAGE_INDEX, FileName: filepath.Base(originalSourcePaths[i]),
+			TableType: spec.TableType, Current: i + 1, Total: len(sourceDbs)}
+		a.emitMergeProgress(progress)
+
+		var stopErr error
+		err := sourceDb.QueryEach(query, func(row map[string]interface{}) error {
+			if stopErr = checkMergeCanceled(ctx); stopErr != nil {
+				return stopErr
+			}
+			if spec.ValidateArea {
+				stopErr = a.validateAreaConsistency(getStringValue(row["province_name"]), getStringValue(row["city_name"]), getStringValue(row["country_name"]), areaConfig)
+				if stopErr != nil {
+					return stopErr
+				}
+			}
+
+			key := spec.keyOf(row)
+			if keyIndex[key] == nil {
+				keyIndex[key] = make(map[int][]string)
+			}
+			keyIndex[key][i] = append(keyIndex[key][i], fmt.Sprintf("%v", row["obj_id"]))
+			if _, exists := keyNames[key]; !exists && spec.NameField != "" {
+				keyNames[key] = fmt.Sprintf("%v", row[spec.NameField])
+			}
+
+			progress.Rows++
+			if progress.Rows%mergeProgressEvery == 0 {
+				a.emitMergeProgress(progress)
+			}
+			return nil
+		})
+		if stopErr != nil {
+			return plan, stopErr
+		}
+		if err != nil {
+			log.Printf("读取%s冲突键失败: %s, %v", spec.TableName, originalSourcePaths[i], err)
+			continue
+		}
+		fileNames = append(fileNames, filepath.Base(originalSourcePaths[i]))
+	}
+
+	// 同一个键出现在多个文件中才算冲突
+	conflictKeyMap := make(map[string]map[string]ConflictSourceInfo) // key: 冲突键, value: map[文件路径]ConflictSourceInfo
+	conflictObjIds := make(map[int][]string)                         // key: 来源序号, value: 冲突记录的obj_id
+	for key, sources := range keyIndex {
+		if len(sources) < 2 {
+			continue
+		}
+		plan.SkipKeys[key] = true
+		conflictKeyMap[key] = make(map[string]ConflictSourceInfo)
+		for i, objIds := range sources {
+			filePath := originalSourcePaths[i]
+			conflictKeyMap[key][filePath] = ConflictSourceInfo{
+				FilePath:  filePath,
+				FileName:  filepath.Base(filePath),
+				TableType: spec.TableType,
+				ObjIds:    objIds,
+			}
+			conflictObjIds[i] = append(conflictObjIds[i], objIds...)
+		}
+	}
+	// 冲突键索引不再需要，尽早释放
+	keyIndex = nil
+
+	// 只读取冲突记录的完整数据，用于比较字段差异和按策略处理
+	conflictRows := make(map[string]map[string][]map[string]interface{}) // key: 冲突键, value: map[文件路径]冲突记录
+	childRows := make(map[string]mergeChildRows)                         // key: 文件路径, value: 冲突记录的扩展表数据
+	for i, objIds := range conflictObjIds {
+		filePath := originalSourcePaths[i]
+		for start := 0; start < len(objIds); start += mergeBatchSize {
+			if err := checkMergeCanceled(ctx); err != nil {
+				return plan, err
+			}
+			end := min(start+mergeBatchSize, len(objIds))
+			args := make([]interface{}, 0, end-start)
+			for _, objID := range objIds[start:end] {
+				args = append(args, objID)
+			}
+			rowQuery := fmt.Sprintf("SELECT * FROM %s WHERE obj_id IN (%s)", spec.TableName, strings.TrimSuffix(strings.Repeat("?,", len(args)), ","))
+			err := sourceDbs[i].QueryEach(rowQuery, func(row map[string]interface{}) error {
+				row[mergeSourceField] = filePath
+				key := spec.keyOf(row)
+				if conflictRows[key] == nil {
+					conflictRows[key] = make(map[string][]map[string]interface{})
+				}
+				conflictRows[key][filePath] = append(conflictRows[key][filePath], row)
+				return nil
+			}, args...)
+			if err != nil {
+				return plan, fmt.Errorf("读取冲突数据失败: %v", err)
+			}
+		}
+		fileChildRows, err := queryMergeChildRows(spec.TableType, sourceDbs[i], objIds)
+		if err != nil {
+			return plan, fmt.Errorf("读取冲突数据失败: %v", err)
+		}
+		childRows[filePath] = fileChildRows
+	}
+
+	// 按合并策略自动处理冲突，已处理的冲突从conflictKeyMap中移除
+	resolvedData, resolutions, conflictDiffs := a.applyMergePolicy(policy, spec.TableType, conflictKeyMap, conflictRows, childRows, originalSourcePaths)
+	plan.Resolved = resolvedData
+	plan.Conflicts.Resolutions = resolutions
+
+	// 构建冲突详情，按冲突键排序保证每次合并结果顺序一致
+	conflictKeys := make([]string, 0, len(conflictKeyMap))
+	for key := range conflictKeyMap {
+		conflictKeys = append(conflictKeys, key)
+	}
+	slices.Sort(conflictKeys)
+
+	for _, key := range conflictKeys {
+		detail := ConflictDetail{Conflict: make([]ConflictSourceInfo, 0, len(conflictKeyMap[key]))}
+		for _, filePath := range originalSourcePaths {
+			if rows := conflictRows[key][filePath]; len(rows) > 0 {
+				setConflictDetailKey(&detail, spec.TableType, rows[0])
+				break
+			}
+		}
+		switch spec.TableType {
+		case "table1", "table2":
+			detail.UnitName = keyNames[key]
+		case "table3":
+			detail.ProjectName = keyNames[key]
+		}
+
+		for _, fileConflict := range conflictKeyMap[key] {
+			detail.Conflict = append(detail.Conflict, fileConflict)
+		}
+		sortConflictSources(detail.Conflict, originalSourcePaths)
+		detail.Fields = conflictDiffs[key]
+
+		plan.Conflicts.Conflicts = append(plan.Conflicts.Conflicts, detail)
+	}
+
+	plan.Conflicts.FileNames = fileNames
+	plan.Conflicts.ConflictCount = len(plan.Conflicts.Conflicts)
+	plan.Conflicts.HasConflict = plan.Conflicts.ConflictCount > 0
+
+	return plan, nil
+}
+
+// setConflictDetailKey 按表类型设置冲突详情的冲突键字段
+func setConflictDetailKey(detail *ConflictDetail, tableType string, row map[string]interface{}) {
+	switch tableType {
+	case "table1", "table2":
+		detail.CreditCode = fmt.Sprintf("%v", row["credit_code"])
+		detail.StatDate = fmt.Sprintf("%v", row["stat_date"])
+	case "table3":
+		detail.ProjectCode = fmt.Sprintf("%v", row["project_code"])
+		detail.DocumentNumber = fmt.Sprintf("%v", row["document_number"])
+	case "attachment2":
+		detail.ProvinceName = fmt.Sprintf("%v", row["province_name"])
+		detail.CityName = fmt.Sprintf("%v", row["city_name"])
+		detail.CountryName = fmt.Sprintf("%v", row["country_name"])
+		detail.StatDate = fmt.Sprintf("%v", row["stat_date"])
+	}
+}
+
+// mergeTableRowsWithTx 按表类型写入一批合并数据
+func (a *App) mergeTableRowsWithTx(tx *sql.Tx, tableType string, rows []map[string]interface{}, sourceDbs []*db.Database, originalSourcePaths []string) MergeResult {
+	switch tableType {
+	case "table1":
+		return a.mergeTable1DataWithTx(tx, rows, sourceDbs, originalSourcePaths)
+	case "table2":
+		return a.mergeTable2DataWithTx(tx, rows)
+	case "table3":
+		return a.mergeTable3DataWithTx(tx, rows)
+	case "attachment2":
+		return a.mergeAttachment2DataWithTx(tx, rows)
+	}
+	return MergeResult{}
+}
+
+// streamMergeTable 逐个来源流式读取数据表，跳过冲突键后分批写入合并数据库并记录数据来源
+func (a *App) streamMergeTable(ctx context.Context, tx *sql.Tx, spec mergeTableSpec, plan mergeTablePlan, sourceDbs []*db.Database,
+	originalSourcePaths []string, sourceInfos map[string]mergeSourceInfo) (MergeResult, error) {
+	result := MergeResult{Ok: true}
+
+	insertBatch := func(rows []map[string]interface{}) error {
+		if len(rows) == 0 {
+			return nil
+		}
+		batchResult := a.mergeTableRowsWithTx(tx, spec.TableType, rows, sourceDbs, originalSourcePaths)
+		result.SuccessCount += batchResult.SuccessCount
+		result.ErrorCount += batchResult.ErrorCount
+		if batchResult.Message != "" {
+			result.Message = batchResult.Message
+		}
+		return a.recordMergeProvenance(tx, spec.TableType, rows, sourceDbs, originalSourcePaths, sourceInfos)
+	}
+
+	// 按策略保留的冲突数据已在冲突检查时读取
+	for start := 0; start < len(plan.Resolved); start += mergeBatchSize {
+		if err := checkMergeCanceled(ctx); err != nil {
+			return result, err
+		}
+		if err := insertBatch(plan.Resolved[start:min(start+mergeBatchSize, len(plan.Resolved))]); err != nil {
+			return result, err
+		}
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s", spec.TableName)
+	for i, sourceDb := range sourceDbs {
+		filePath := originalSourcePaths[i]
+		progress := MergeProgress{Stage: MERGE_STAGE_INSERT, FileName: filepath.Base(filePath),
+			TableType: spec.TableType, Current: i + 1, Total: len(sourceDbs)}
+		a.emitMergeProgress(progress)
+
+		batch := make([]map[string]interface{}, 0, mergeBatchSize)
+		var stopErr error
+		err := sourceDb.QueryEach(query, func(row map[string]interface{}) error {
+			if stopErr = checkMergeCanceled(ctx); stopErr != nil {
+				return stopErr
+			}
+			progress.Rows++
+			if progress.Rows%mergeProgressEvery == 0 {
+				a.emitMergeProgress(progress)
+			}
+			if plan.SkipKeys[spec.keyOf(row)] {
+				return nil
+			}
+
+			// 标记数据来源，用于合并扩展表数据和记录数据来源
+			row[mergeSourceField] = filePath
+			batch = append(batch, row)
+			if len(batch) >= mergeBatchSize {
+				stopErr = insertBatch(batch)
+				batch = batch[:0]
+			}
+			return stopErr
+		})
+		if stopErr != nil {
+			return result, stopErr
+		}
+		if err != nil {
+			return result, fmt.Errorf("读取%s数据失败: %s, %v", spec.TableName, filepath.Base(filePath), err)
+		}
+		if err := insertBatch(batch); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
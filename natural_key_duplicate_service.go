@@ -0,0 +1,125 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"shuji/data_import"
+	"shuji/db"
+	"time"
+)
+
+// naturalKeyTableNames 自然键重复提示中显示的数据表名称
+var naturalKeyTableNames = map[string]string{
+	data_import.TableEnterpriseCoalConsumptionMain:    "附表1 企业煤炭消费信息",
+	data_import.TableEnterpriseCoalConsumptionEquip:   "附表1 重点耗煤装置",
+	data_import.TableCriticalCoalEquipmentConsumption: "附表2 重点耗煤装置煤炭消耗信息",
+	data_import.TableFixedAssetsInvestmentProject:     "附表3 固定资产投资项目",
+	data_import.TableCoalConsumptionReport:            "附件2 煤炭消费状况",
+}
+
+// QueryNaturalKeyDuplicates 查询升级时发现的、尚未处理的自然键重复数据
+func (a *App) QueryNaturalKeyDuplicates() db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.queryNaturalKeyDuplicatesWithRecover()
+}
+
+// queryNaturalKeyDuplicatesWithRecover 带异常处理的查询自然键重复数据函数
+func (a *App) queryNaturalKeyDuplicatesWithRecover() (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("QueryNaturalKeyDuplicates 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("查询重复数据发生异常: %v", r)}
+		}
+	}()
+
+	queryResult, err := a.GetDB().Query(`SELECT obj_id, index_name, table_name, record_id, key_value, is_newest, detect_time
+		FROM natural_key_duplicate WHERE resolve_time IS NULL ORDER BY table_name, key_value, is_newest DESC`)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("查询重复数据失败: %v", err)}
+	}
+	rows, _ := queryResult.Data.([]map[string]interface{})
+	for _, row := range rows {
+		tableName := getStringValue(row["table_name"])
+		row["table_label"] = naturalKeyTableNames[tableName]
+	}
+	return db.QueryResult{Ok: true, Message: "查询成功", Data: rows}
+}
+
+// ResolveNaturalKeyDuplicates 处理自然键重复数据：先创建快照，每组保留最新创建的一条，
+// 删除其余记录及其扩展表数据后创建唯一索引。被删除的数据仍保存在natural_key_duplicate中
+func (a *App) ResolveNaturalKeyDuplicates() db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.resolveNaturalKeyDuplicatesWithRecover()
+}
+
+// resolveNaturalKeyDuplicatesWithRecover 带异常处理的处理自然键重复数据函数
+func (a *App) resolveNaturalKeyDuplicatesWithRecover() (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ResolveNaturalKeyDuplicates 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("处理重复数据发生异常: %v", r)}
+		}
+	}()
+
+	database := a.GetDB()
+	snapshotCreated := false
+	deletedCount := 0
+	for _, key := range data_import.NaturalKeys {
+		exists, err := naturalKeyIndexExists(database, key)
+		if err != nil {
+			return db.QueryResult{Ok: false, Message: fmt.Sprintf("检查唯一索引失败: %v", err)}
+		}
+		if exists {
+			continue
+		}
+
+		// 重新检测并保存重复数据，保证删除的记录都有留档
+		duplicates, err := findNaturalKeyDuplicates(database, key)
+		if err != nil {
+			return db.QueryResult{Ok: false, Message: fmt.Sprintf("查询重复数据失败: %v", err)}
+		}
+		if len(duplicates) > 0 {
+			if err := saveNaturalKeyDuplicates(database, key, duplicates); err != nil {
+				return db.QueryResult{Ok: false, Message: fmt.Sprintf("保存重复数据失败: %v", err)}
+			}
+			if !snapshotCreated {
+				if _, err := a.snapshotSystemDb(SNAPSHOT_REASON_DEDUPE); err != nil {
+					return db.QueryResult{Ok: false, Message: fmt.Sprintf("创建快照失败，未删除任何数据: %v", err)}
+				}
+				snapshotCreated = true
+			}
+		}
+
+		err = database.WithTx(func(tx *sql.Tx) error {
+			for _, duplicate := range duplicates {
+				if duplicate.IsNewest {
+					continue
+				}
+				for _, childTable := range naturalKeyChildTables[key.TableName] {
+					if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE fk_id = ?", childTable), duplicate.RecordID); err != nil {
+						return err
+					}
+				}
+				if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE obj_id = ?", key.TableName), duplicate.RecordID); err != nil {
+					return err
+				}
+				deletedCount++
+			}
+			if _, err := tx.Exec(key.CreateIndexSQL()); err != nil {
+				return err
+			}
+			_, err := tx.Exec("UPDATE natural_key_duplicate SET resolve_time = ? WHERE index_name = ? AND resolve_time IS NULL",
+				time.Now().UnixMilli(), key.IndexName)
+			return err
+		})
+		if err != nil {
+			return db.QueryResult{Ok: false, Message: fmt.Sprintf("处理表 %s 的重复数据失败: %v", naturalKeyTableNames[key.TableName], err)}
+		}
+	}
+
+	log.Printf("自然键重复数据处理完成，删除 %d 条", deletedCount)
+	return db.QueryResult{Ok: true, Message: fmt.Sprintf("处理完成，删除重复数据 %d 条", deletedCount), Data: deletedCount}
+}
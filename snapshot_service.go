@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"shuji/db"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 数据库快照相关常量
+const (
+	SNAPSHOT_REASON_MANUAL      = "manual"      // 手动创建
+	SNAPSHOT_REASON_COVER       = "cover"       // 覆盖数据前
+	SNAPSHOT_REASON_MERGE       = "merge"       // 处理合并冲突或增量合并前
+	SNAPSHOT_REASON_LIST_IMPORT = "list_import" // 导入企业清单或装置清单前
+	SNAPSHOT_REASON_DAILY       = "daily"       // 每日定时快照
+	SNAPSHOT_REASON_RESTORE     = "restore"     // 恢复快照前
+	SNAPSHOT_REASON_DEDUPE      = "dedupe"      // 处理自然键重复数据前
+
+	SNAPSHOT_DAILY_KEEP = 7  // 每日快照保留数量
+	SNAPSHOT_AUTO_KEEP  = 20 // 每种自动快照保留数量
+
+	snapshotMetaExt       = ".json"   // 快照信息文件扩展名
+	snapshotCheckInterval = time.Hour // 检查是否需要创建每日快照的间隔
+)
+
+// snapshotReasonNames 快照原因显示名称
+var snapshotReasonNames = map[string]string{
+	SNAPSHOT_REASON_MANUAL:      "手动快照",
+	SNAPSHOT_REASON_COVER:       "覆盖数据前",
+	SNAPSHOT_REASON_MERGE:       "合并数据前",
+	SNAPSHOT_REASON_LIST_IMPORT: "导入清单前",
+	SNAPSHOT_REASON_DAILY:       "每日快照",
+	SNAPSHOT_REASON_RESTORE:     "恢复快照前",
+	SNAPSHOT_REASON_DEDUPE:      "处理重复数据前",
+}
+
+// snapshotRequiredTables 有效的数据库必须包含的数据表
+var snapshotRequiredTables = append([]string{"area_config"}, submissionTables...)
+
+// SnapshotInfo 快照信息，与快照文件同名保存为json文件
+type SnapshotInfo struct {
+	FileName      string         `json:"fileName"`      // 快照文件名
+	Reason        string         `json:"reason"`        // 创建原因
+	ReasonName    string         `json:"reasonName"`    // 创建原因显示名称
+	DbPath        string         `json:"dbPath"`        // 快照对应的数据库文件，恢复时替换该文件
+	IsSystemDb    bool           `json:"isSystemDb"`    // 是否为系统数据库的快照
+	CreateTime    int64          `json:"createTime"`    // 创建时间
+	CreateUser    string         `json:"createUser"`    // 创建用户
+	SchemaVersion int            `json:"schemaVersion"` // 数据库结构版本
+	Size          int64          `json:"size"`          // 快照文件大小
+	TableCounts   map[string]int `json:"tableCounts"`   // 各数据表记录数
+}
+
+// snapshotMutex 快照的创建、清理和恢复依次进行
+var snapshotMutex sync.Mutex
+
+// getSystemDbPath 获取系统数据库文件路径
+func getSystemDbPath() string {
+	return GetPath(filepath.Join(DATA_DIR_NAME, DB_FILE_NAME))
+}
+
+// getSnapshotDir 获取快照目录，不存在时创建
+func getSnapshotDir() (string, error) {
+	dir := GetPath(SNAPSHOT_DIR_NAME)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("创建快照目录失败: %v", err)
+	}
+	return dir, nil
+}
+
+// countSnapshotTables 统计数据库中各数据表的记录数
+func countSnapshotTables(database *db.Database) map[string]int {
+	counts := make(map[string]int)
+	for _, tableName := range submissionTables {
+		countResult, err := database.QueryRow(fmt.Sprintf("SELECT COUNT(1) AS count FROM %s", tableName))
+		if err != nil || countResult.Data == nil {
+			continue
+		}
+		count, _ := countResult.Data.(map[string]interface{})["count"].(int64)
+		counts[tableName] = int(count)
+	}
+	return counts
+}
+
+// findMissingTables 查找数据库中缺少的必需数据表
+func findMissingTables(database *db.Database) ([]string, error) {
+	result, err := database.GetTables()
+	if err != nil {
+		return nil, fmt.Errorf("读取数据表失败: %v", err)
+	}
+	var tables []string
+	if result.Data != nil {
+		for _, row := range result.Data.([]map[string]interface{}) {
+			tables = append(tables, getStringValue(row["name"]))
+		}
+	}
+
+	var missing []string
+	for _, tableName := range snapshotRequiredTables {
+		if !slices.Contains(tables, tableName) {
+			missing = append(missing, tableName)
+		}
+	}
+	return missing, nil
+}
+
+// checkDatabaseSchema 检查数据库是否包含必需的数据表
+func checkDatabaseSchema(database *db.Database) error {
+	missing, err := findMissingTables(database)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("缺少数据表: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// createSnapshot 使用VACUUM INTO为数据库创建一致的快照，并按原因清理超出保留数量的旧快照
+func (a *App) createSnapshot(database *db.Database, dbPath string, reason string) (SnapshotInfo, error) {
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+
+	if absPath, err := filepath.Abs(dbPath); err == nil {
+		dbPath = absPath
+	}
+	info := SnapshotInfo{
+		Reason:        reason,
+		ReasonName:    snapshotReasonNames[reason],
+		DbPath:        dbPath,
+		IsSystemDb:    dbPath == getSystemDbPath(),
+		CreateUser:    a.GetCurrentOSUser(),
+		SchemaVersion: getSchemaVersion(),
+	}
+	if database == nil {
+		return info, fmt.Errorf("数据库未初始化")
+	}
+	if _, readOnly, _ := a.getDbState(); info.IsSystemDb && readOnly {
+		return info, fmt.Errorf("当前为只读模式，不能修改数据")
+	}
+	dir, err := getSnapshotDir()
+	if err != nil {
+		return info, err
+	}
+
+	now := time.Now()
+	info.CreateTime = now.UnixMilli()
+	info.FileName = fmt.Sprintf("snapshot_%s_%s_%s.db", now.Format("20060102150405"), reason, uuid.New().String()[:8])
+	snapshotPath := filepath.Join(dir, info.FileName)
+
+	info.TableCounts = countSnapshotTables(database)
+	if err := database.BackupTo(snapshotPath); err != nil {
+		os.Remove(snapshotPath)
+		return info, fmt.Errorf("创建快照失败: %v", err)
+	}
+	if stat, err := os.Stat(snapshotPath); err == nil {
+		info.Size = stat.Size()
+	}
+
+	metaBytes, err := json.MarshalIndent(info, "", "  ")
+	if err == nil {
+		err = os.WriteFile(strings.TrimSuffix(snapshotPath, filepath.Ext(snapshotPath))+snapshotMetaExt, metaBytes, 0644)
+	}
+	if err != nil {
+		os.Remove(snapshotPath)
+		return info, fmt.Errorf("保存快照信息失败: %v", err)
+	}
+
+	pruneSnapshots(dir, info)
+	log.Printf("创建快照成功: %s (%s)", info.FileName, info.ReasonName)
+	return info, nil
+}
+
+// snapshotSystemDb 为系统数据库创建快照
+func (a *App) snapshotSystemDb(reason string) (SnapshotInfo, error) {
+	return a.createSnapshot(a.GetDB(), getSystemDbPath(), reason)
+}
+
+// readSnapshots 读取快照目录中的快照信息，按创建时间倒序排列，快照文件不存在的忽略
+func readSnapshots(dir string) []SnapshotInfo {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	snapshots := []SnapshotInfo{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != snapshotMetaExt {
+			continue
+		}
+		metaBytes, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var info SnapshotInfo
+		if err := json.Unmarshal(metaBytes, &info); err != nil || info.FileName == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, info.FileName)); err != nil {
+			continue
+		}
+		snapshots = append(snapshots, info)
+	}
+
+	slices.SortFunc(snapshots, func(x, y SnapshotInfo) int {
+		return int(y.CreateTime - x.CreateTime)
+	})
+	return snapshots
+}
+
+// removeSnapshot 删除快照文件和快照信息文件
+func removeSnapshot(dir string, fileName string) {
+	snapshotPath := filepath.Join(dir, fileName)
+	os.Remove(snapshotPath)
+	os.Remove(strings.TrimSuffix(snapshotPath, filepath.Ext(snapshotPath)) + snapshotMetaExt)
+}
+
+// pruneSnapshots 同一数据库同一原因的自动快照超出保留数量时删除最旧的快照，手动快照不自动删除
+func pruneSnapshots(dir string, latest SnapshotInfo) {
+	keep := SNAPSHOT_AUTO_KEEP
+	switch latest.Reason {
+	case SNAPSHOT_REASON_MANUAL:
+		return
+	case SNAPSHOT_REASON_DAILY:
+		keep = SNAPSHOT_DAILY_KEEP
+	}
+
+	count := 0
+	for _, info := range readSnapshots(dir) {
+		if info.Reason != latest.Reason || info.DbPath != latest.DbPath {
+			continue
+		}
+		count++
+		if count > keep {
+			removeSnapshot(dir, info.FileName)
+			log.Printf("清理过期快照: %s", info.FileName)
+		}
+	}
+}
+
+// CreateSnapshot 为系统数据库创建快照，reason为创建原因
+func (a *App) CreateSnapshot(reason string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.createSnapshotWithRecover(reason)
+}
+
+// createSnapshotWithRecover 带异常处理的创建快照函数
+func (a *App) createSnapshotWithRecover(reason string) (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("CreateSnapshot 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("创建快照发生异常: %v", r)}
+		}
+	}()
+
+	if _, exists := snapshotReasonNames[reason]; !exists {
+		reason = SNAPSHOT_REASON_MANUAL
+	}
+	info, err := a.snapshotSystemDb(reason)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+	return db.QueryResult{Ok: true, Message: "创建快照成功", Data: info}
+}
+
+// ListSnapshots 查询可用的快照及各数据表记录数
+func (a *App) ListSnapshots() db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.listSnapshotsWithRecover()
+}
+
+// listSnapshotsWithRecover 带异常处理的查询快照函数
+func (a *App) listSnapshotsWithRecover() (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ListSnapshots 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("查询快照发生异常: %v", r)}
+		}
+	}()
+
+	dir, err := getSnapshotDir()
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+	return db.QueryResult{Ok: true, Message: "查询成功", Data: readSnapshots(dir)}
+}
+
+// validateDatabaseFile 校验数据库文件完整性和表结构，校验通过后升级表结构，系统数据库的快照使用本机密钥打开
+func validateDatabaseFile(dbPath string, isSystemDb bool) error {
+	var database *db.Database
+	var err error
+	if isSystemDb {
+		database, err = openSystemDb(dbPath, false)
+	} else {
+		database, err = db.NewDatabase(dbPath, EXCHANGE_DB_PASSWORD)
+	}
+	if err != nil {
+		return fmt.Errorf("打开数据库失败: %v", err)
+	}
+	defer database.Close()
+
+	problems, err := database.IntegrityCheck(false)
+	if err != nil {
+		return fmt.Errorf("完整性检查失败: %v", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("完整性检查未通过: %s", strings.Join(problems, "; "))
+	}
+	if err := checkDatabaseSchema(database); err != nil {
+		return err
+	}
+	return migrateDatabase(database)
+}
+
+// replaceDatabaseFile 用新文件替换数据库文件，同时删除原数据库遗留的WAL文件
+func replaceDatabaseFile(srcPath string, dbPath string) error {
+	os.Remove(dbPath + "-wal")
+	os.Remove(dbPath + "-shm")
+	if err := os.Remove(dbPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除原数据库失败: %v", err)
+	}
+	if err := os.Rename(srcPath, dbPath); err != nil {
+		return fmt.Errorf("替换数据库失败: %v", err)
+	}
+	return nil
+}
+
+// reopenSystemDb 重新打开系统数据库并清除依赖数据库内容的缓存
+func (a *App) reopenSystemDb() error {
+	newDb, err := openSystemDb(getSystemDbPath(), false)
+	if err == nil {
+		err = migrateDatabase(newDb)
+		if err != nil {
+			newDb.Close()
+		}
+	}
+	if err != nil {
+		a.detachSystemDb(err)
+		return err
+	}
+
+	a.replaceSystemDb(newDb, false, nil)
+	areaConfigData = nil
+	enhancedAreaConfigData = nil
+	return nil
+}
+
+// RestoreSnapshot 校验快照后替换对应的数据库，恢复系统数据库前会先为当前数据创建快照
+func (a *App) RestoreSnapshot(fileName string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.restoreSnapshotWithRecover(fileName)
+}
+
+// restoreSnapshotWithRecover 带异常处理的恢复快照函数
+func (a *App) restoreSnapshotWithRecover(fileName string) (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("RestoreSnapshot 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("恢复快照发生异常: %v", r)}
+		}
+	}()
+
+	dir, err := getSnapshotDir()
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+	index := slices.IndexFunc(readSnapshots(dir), func(info SnapshotInfo) bool { return info.FileName == fileName })
+	if index < 0 {
+		return db.QueryResult{Ok: false, Message: "快照不存在"}
+	}
+	info := readSnapshots(dir)[index]
+
+	// 1. 复制快照到临时文件并校验，快照文件本身保持不变
+	tempPath := info.DbPath + ".restore"
+	os.Remove(tempPath)
+	if err := copyFile(filepath.Join(dir, info.FileName), tempPath); err != nil {
+		return db.QueryResult{Ok: false, Message: "复制快照失败: " + err.Error()}
+	}
+	if err := validateDatabaseFile(tempPath, info.IsSystemDb); err != nil {
+		os.Remove(tempPath)
+		return db.QueryResult{Ok: false, Message: "快照校验失败: " + err.Error()}
+	}
+
+	// 2. 恢复系统数据库前为当前数据创建快照，便于撤销恢复
+	currentDb, readOnly, _ := a.getDbState()
+	if info.IsSystemDb && currentDb != nil && !readOnly {
+		if _, err := a.snapshotSystemDb(SNAPSHOT_REASON_RESTORE); err != nil {
+			os.Remove(tempPath)
+			return db.QueryResult{Ok: false, Message: "为当前数据创建快照失败: " + err.Error()}
+		}
+	}
+
+	// 3. 替换数据库文件，系统数据库需关闭连接后替换再重新打开，原数据库异常时先移出保留供排查
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+
+	currentDb, readOnly, _ = a.getDbState()
+	damaged := info.IsSystemDb && (currentDb == nil || readOnly)
+	if info.IsSystemDb {
+		a.detachSystemDb(fmt.Errorf("正在恢复快照"))
+	}
+	if damaged {
+		if _, err := preserveDamagedDatabase(info.DbPath); err != nil {
+			os.Remove(tempPath)
+			a.detachSystemDb(err)
+			return db.QueryResult{Ok: false, Message: err.Error()}
+		}
+	}
+	if err := replaceDatabaseFile(tempPath, info.DbPath); err != nil {
+		os.Remove(tempPath)
+		if damaged {
+			a.detachSystemDb(err)
+		} else if info.IsSystemDb {
+			a.reopenSystemDb()
+		}
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+	if info.IsSystemDb {
+		if err := a.reopenSystemDb(); err != nil {
+			return db.QueryResult{Ok: false, Message: "重新打开数据库失败: " + err.Error()}
+		}
+	}
+
+	return db.QueryResult{
+		Ok:      true,
+		Message: fmt.Sprintf("已恢复到%s的快照", time.UnixMilli(info.CreateTime).Format("2006-01-02 15:04:05")),
+		Data:    info,
+	}
+}
+
+// ensureDailySnapshot 当天还没有每日快照时为系统数据库创建快照
+func (a *App) ensureDailySnapshot() {
+	if database, readOnly, _ := a.getDbState(); database == nil || readOnly {
+		return
+	}
+	dir, err := getSnapshotDir()
+	if err != nil {
+		log.Printf("创建每日快照失败: %v", err)
+		return
+	}
+
+	today := time.Now().Format("2006-01-02")
+	for _, info := range readSnapshots(dir) {
+		if info.Reason == SNAPSHOT_REASON_DAILY && info.IsSystemDb && time.UnixMilli(info.CreateTime).Format("2006-01-02") == today {
+			return
+		}
+	}
+	if _, err := a.snapshotSystemDb(SNAPSHOT_REASON_DAILY); err != nil {
+		log.Printf("创建每日快照失败: %v", err)
+	}
+}
+
+// flushSystemDb 将系统数据库的当前数据加密写回数据库文件，减少异常退出时依赖工作文件恢复的数据
+func (a *App) flushSystemDb() {
+	database, readOnly, _ := a.getDbState()
+	if database == nil || readOnly {
+		return
+	}
+	if err := database.Flush(); err != nil {
+		log.Printf("写回数据库文件失败: %v", err)
+	}
+}
+
+// startSnapshotScheduler 启动每日快照和定期写回数据库文件的定时任务，程序退出时停止
+func (a *App) startSnapshotScheduler(ctx context.Context) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("每日快照任务发生异常: %v", r)
+			}
+		}()
+
+		a.ensureDailySnapshot()
+		ticker := time.NewTicker(snapshotCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.ensureDailySnapshot()
+				a.flushSystemDb()
+			}
+		}
+	}()
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"shuji/db"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 数据库异常时的处理方式
+const (
+	RECOVERY_SNAPSHOT  = "snapshot"  // 恢复最近的快照
+	RECOVERY_SALVAGE   = "salvage"   // 抢救可读取的数据到新数据库
+	RECOVERY_READ_ONLY = "read_only" // 以只读模式打开
+
+	diagnosisEntryName = "diagnosis.json" // 诊断包中的诊断信息文件
+)
+
+// StartupDiagnosis 启动时的数据库检查结果
+type StartupDiagnosis struct {
+	DbPath            string   `json:"dbPath"`            // 数据库文件路径
+	DbExists          bool     `json:"dbExists"`          // 数据库文件是否存在
+	DbSize            int64    `json:"dbSize"`            // 数据库文件大小
+	WalExists         bool     `json:"walExists"`         // 是否存在上次遗留的WAL文件
+	WalSize           int64    `json:"walSize"`           // WAL文件大小
+	OpenError         string   `json:"openError"`         // 打开数据库的错误
+	IntegrityProblems []string `json:"integrityProblems"` // 完整性检查发现的问题
+	MissingTables     []string `json:"missingTables"`     // 缺少的数据表
+	MigrateError      string   `json:"migrateError"`      // 升级表结构的错误
+	Warnings          []string `json:"warnings"`          // 不影响使用的提示
+	Healthy           bool     `json:"healthy"`           // 数据库是否可以正常使用
+	LatestSnapshot    string   `json:"latestSnapshot"`    // 最近一次系统数据库快照
+	Recovery          string   `json:"recovery"`          // 已采用的处理方式
+	BundlePath        string   `json:"bundlePath"`        // 诊断包路径
+	CheckTime         int64    `json:"checkTime"`         // 检查时间
+}
+
+// Summary 汇总检查发现的问题
+func (d *StartupDiagnosis) Summary() string {
+	var problems []string
+	if !d.DbExists {
+		problems = append(problems, "数据库文件不存在")
+	}
+	if d.OpenError != "" {
+		problems = append(problems, "打开数据库失败: "+d.OpenError)
+	}
+	if len(d.IntegrityProblems) > 0 {
+		problems = append(problems, fmt.Sprintf("完整性检查发现%d个问题: %s", len(d.IntegrityProblems), d.IntegrityProblems[0]))
+	}
+	if len(d.MissingTables) > 0 {
+		problems = append(problems, "缺少数据表: "+strings.Join(d.MissingTables, ", "))
+	}
+	if d.MigrateError != "" {
+		problems = append(problems, "升级表结构失败: "+d.MigrateError)
+	}
+	return strings.Join(problems, "；")
+}
+
+// SalvageTableResult 抢救单个数据表的结果
+type SalvageTableResult struct {
+	TableName string `json:"tableName"` // 数据表
+	Rows      int    `json:"rows"`      // 抢救的记录数
+	Partial   bool   `json:"partial"`   // 是否只读取到部分记录
+	Error     string `json:"error"`     // 读取失败的原因，失败时保留模板中的数据
+}
+
+// diagnoseDatabase 检查数据库文件、WAL遗留、完整性和表结构，数据库正常时返回已打开并升级表结构的连接
+func diagnoseDatabase(dbPath string) (StartupDiagnosis, *db.Database) {
+	diagnosis := StartupDiagnosis{DbPath: dbPath, CheckTime: time.Now().UnixMilli()}
+
+	// 1. 文件检查，WAL文件需在打开数据库前检查，打开时会自动恢复并清理
+	if stat, err := os.Stat(dbPath); err == nil {
+		diagnosis.DbExists = true
+		diagnosis.DbSize = stat.Size()
+	}
+	if stat, err := os.Stat(dbPath + "-wal"); err == nil && stat.Size() > 0 {
+		diagnosis.WalExists = true
+		diagnosis.WalSize = stat.Size()
+		diagnosis.Warnings = append(diagnosis.Warnings, fmt.Sprintf("发现上次未正常关闭遗留的WAL文件（%d字节），打开数据库时将自动恢复", stat.Size()))
+	}
+	if db.HasPendingWorkingFile(dbPath) {
+		diagnosis.Warnings = append(diagnosis.Warnings, "发现上次未正常关闭遗留的数据库工作文件，打开数据库时将继续使用其中的数据")
+	}
+	if dir, err := getSnapshotDir(); err == nil {
+		for _, info := range readSnapshots(dir) {
+			if info.IsSystemDb {
+				diagnosis.LatestSnapshot = info.FileName
+				break
+			}
+		}
+	}
+	if !diagnosis.DbExists {
+		return diagnosis, nil
+	}
+
+	// 2. 打开数据库
+	database, err := openSystemDb(dbPath, false)
+	if err != nil {
+		diagnosis.OpenError = err.Error()
+		return diagnosis, nil
+	}
+
+	// 3. 快速检查发现问题时再做完整检查，获取详细的问题列表
+	problems, err := database.IntegrityCheck(true)
+	if err == nil && len(problems) > 0 {
+		problems, err = database.IntegrityCheck(false)
+	}
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	diagnosis.IntegrityProblems = problems
+
+	// 4. 表结构检查
+	missing, err := findMissingTables(database)
+	if err != nil {
+		diagnosis.IntegrityProblems = append(diagnosis.IntegrityProblems, err.Error())
+	}
+	diagnosis.MissingTables = missing
+
+	if len(diagnosis.IntegrityProblems) == 0 && len(diagnosis.MissingTables) == 0 {
+		if err := migrateDatabase(database); err != nil {
+			diagnosis.MigrateError = err.Error()
+		}
+	}
+
+	diagnosis.Healthy = diagnosis.Summary() == ""
+	if !diagnosis.Healthy {
+		database.Close()
+		return diagnosis, nil
+	}
+	return diagnosis, database
+}
+
+// diagnosticReport 诊断包中的诊断信息
+type diagnosticReport struct {
+	Diagnosis     *StartupDiagnosis `json:"diagnosis"`
+	AppName       string            `json:"appName"`
+	AppVersion    string            `json:"appVersion"`
+	OS            string            `json:"os"`
+	Arch          string            `json:"arch"`
+	SchemaVersion int               `json:"schemaVersion"`
+	DataFiles     map[string]int64  `json:"dataFiles"` // 数据目录中的文件及大小
+	Snapshots     []SnapshotInfo    `json:"snapshots"`
+	CreateTime    string            `json:"createTime"`
+}
+
+// writeDiagnosticBundle 将诊断信息写入诊断包，供技术支持排查，不包含数据库内容
+func writeDiagnosticBundle(diagnosis *StartupDiagnosis) (string, error) {
+	dir := GetPath(DIAGNOSTIC_DIR_NAME)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("创建诊断目录失败: %v", err)
+	}
+
+	report := diagnosticReport{
+		Diagnosis:     diagnosis,
+		AppName:       APP_NAME,
+		AppVersion:    APP_VERSION,
+		OS:            Env.OS,
+		Arch:          Env.ARCH,
+		SchemaVersion: getSchemaVersion(),
+		DataFiles:     make(map[string]int64),
+		CreateTime:    time.Now().Format("2006-01-02 15:04:05"),
+	}
+	if entries, err := os.ReadDir(GetPath(DATA_DIR_NAME)); err == nil {
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil && !entry.IsDir() {
+				report.DataFiles[entry.Name()] = info.Size()
+			}
+		}
+	}
+	if snapshotDir, err := getSnapshotDir(); err == nil {
+		report.Snapshots = readSnapshots(snapshotDir)
+	}
+	reportBytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	bundlePath := filepath.Join(dir, fmt.Sprintf("diagnostic_%s.zip", time.Now().Format("20060102150405")))
+	bundleFile, err := os.Create(bundlePath)
+	if err != nil {
+		return "", fmt.Errorf("创建诊断包失败: %v", err)
+	}
+	defer bundleFile.Close()
+
+	zipWriter := zip.NewWriter(bundleFile)
+	writer, err := zipWriter.Create(diagnosisEntryName)
+	if err == nil {
+		_, err = writer.Write(reportBytes)
+	}
+	if closeErr := zipWriter.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("写入诊断包失败: %v", err)
+	}
+	return bundlePath, nil
+}
+
+// preserveDamagedDatabase 将异常的数据库文件及其WAL文件移到诊断目录，返回保存的目录
+func preserveDamagedDatabase(dbPath string) (string, error) {
+	dirName := fmt.Sprintf("damaged_%s_%s", time.Now().Format("20060102150405"), uuid.New().String()[:8])
+	dir := GetPath(filepath.Join(DIAGNOSTIC_DIR_NAME, dirName))
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("创建诊断目录失败: %v", err)
+	}
+	for _, path := range []string{dbPath, dbPath + "-wal", dbPath + "-shm"} {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := os.Rename(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+			return "", fmt.Errorf("保留原数据库文件失败: %v", err)
+		}
+	}
+	log.Printf("原数据库文件已保存到: %s", dir)
+	return dir, nil
+}
+
+// detachSystemDb 关闭并清空系统数据库，等待用户选择处理方式
+func (a *App) detachSystemDb(err error) {
+	a.replaceSystemDb(nil, false, err)
+}
+
+// salvageTable 将原数据库中可读取的记录复制到新数据库，只复制两边都有的字段，读取中途出错时保留已读取的记录
+func salvageTable(source *db.Database, target *db.Database, tableName string) SalvageTableResult {
+	result := SalvageTableResult{TableName: tableName}
+
+	targetColumns, err := getTableColumns(target, tableName)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	tx, err := target.Begin()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s", tableName)); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	readErr := source.QueryEach(fmt.Sprintf("SELECT * FROM %s", tableName), func(row map[string]interface{}) error {
+		var columns, placeholders []string
+		var values []interface{}
+		for _, column := range targetColumns {
+			if value, exists := row[column]; exists {
+				columns = append(columns, column)
+				placeholders = append(placeholders, "?")
+				values = append(values, value)
+			}
+		}
+		if _, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, strings.Join(columns, ", "), strings.Join(placeholders, ", ")), values...); err != nil {
+			return err
+		}
+		result.Rows++
+		return nil
+	})
+	if readErr != nil {
+		result.Error = readErr.Error()
+		// 一条记录也没有读取到时保留模板中的数据
+		if result.Rows == 0 {
+			return result
+		}
+		result.Partial = true
+	}
+
+	if err := tx.Commit(); err != nil {
+		result.Rows = 0
+		result.Partial = false
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// salvageDatabase 以内置的空数据库为模板创建新数据库，将原数据库中可读取的数据表逐表复制过去，返回新数据库路径
+func (a *App) salvageDatabase(dbPath string) (string, []SalvageTableResult, error) {
+	salvagePath := dbPath + ".salvage"
+	os.Remove(salvagePath)
+
+	templateData, err := a.fs.ReadFile(FRONTEND_FILE_DIR_NAME + DB_FILE_NAME)
+	if err != nil {
+		return "", nil, fmt.Errorf("读取内置数据库模板失败: %v", err)
+	}
+	if err := os.WriteFile(salvagePath, templateData, 0644); err != nil {
+		return "", nil, fmt.Errorf("创建新数据库失败: %v", err)
+	}
+
+	source, err := openSystemDb(dbPath, true)
+	if err != nil {
+		os.Remove(salvagePath)
+		return "", nil, fmt.Errorf("无法打开原数据库，没有可抢救的数据: %v", err)
+	}
+	defer source.Close()
+
+	target, err := openSystemDb(salvagePath, false)
+	if err != nil {
+		os.Remove(salvagePath)
+		return "", nil, fmt.Errorf("打开新数据库失败: %v", err)
+	}
+
+	// 复制期间去掉变更跟踪触发器，保留原数据的变更序号
+	err = migrateDatabase(target)
+	if err == nil {
+		err = dropChangeTrackingTriggers(target)
+	}
+	if err != nil {
+		target.Close()
+		os.Remove(salvagePath)
+		return "", nil, fmt.Errorf("初始化新数据库失败: %v", err)
+	}
+
+	tablesResult, err := target.GetTables()
+	if err != nil {
+		target.Close()
+		os.Remove(salvagePath)
+		return "", nil, fmt.Errorf("读取数据表失败: %v", err)
+	}
+	var results []SalvageTableResult
+	for _, row := range tablesResult.Data.([]map[string]interface{}) {
+		tableResult := salvageTable(source, target, getStringValue(row["name"]))
+		if tableResult.Error != "" {
+			log.Printf("抢救数据表 %s: %d条记录, %s", tableResult.TableName, tableResult.Rows, tableResult.Error)
+		}
+		results = append(results, tableResult)
+	}
+
+	err = migrateDatabase(target)
+	if err == nil {
+		err = validateSalvagedDatabase(target)
+	}
+	target.Close()
+	if err != nil {
+		os.Remove(salvagePath)
+		return "", nil, err
+	}
+	return salvagePath, results, nil
+}
+
+// validateSalvagedDatabase 检查抢救后的新数据库是否完好
+func validateSalvagedDatabase(database *db.Database) error {
+	problems, err := database.IntegrityCheck(false)
+	if err != nil {
+		return fmt.Errorf("新数据库完整性检查失败: %v", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("新数据库完整性检查未通过: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkRecoveryNeeded 只有数据库异常或处于只读模式时才需要处理
+func (a *App) checkRecoveryNeeded() error {
+	if database, readOnly, _ := a.getDbState(); database != nil && !readOnly {
+		return fmt.Errorf("数据库正常，无需处理")
+	}
+	return nil
+}
+
+// GetStartupDiagnosis 获取启动时的数据库检查结果，数据库异常时前端据此提示用户选择处理方式
+func (a *App) GetStartupDiagnosis() db.QueryResult {
+	if a.diagnosis == nil {
+		return db.QueryResult{Ok: false, Message: "没有启动检查结果"}
+	}
+	return db.QueryResult{Ok: true, Message: "查询成功", Data: a.diagnosis}
+}
+
+// DatabaseStatus 系统数据库的当前状态，Ready为false时前端进入数据库恢复页面
+type DatabaseStatus struct {
+	Ready    bool   `json:"ready"`    // 数据库是否可用
+	ReadOnly bool   `json:"readOnly"` // 是否以只读模式打开
+	Error    string `json:"error"`    // 数据库不可用的原因
+}
+
+// GetDatabaseStatus 获取系统数据库的当前状态，启动检查未通过或恢复失败时Ready为false
+func (a *App) GetDatabaseStatus() db.QueryResult {
+	database, readOnly, dbError := a.getDbState()
+	status := DatabaseStatus{Ready: database != nil && dbError == nil, ReadOnly: readOnly}
+	if dbError != nil {
+		status.Error = dbError.Error()
+	} else if database == nil {
+		status.Error = "数据库未初始化"
+	}
+	return db.QueryResult{Ok: true, Message: "查询成功", Data: status}
+}
+
+// RecoverFromLatestSnapshot 将系统数据库恢复到最近一次快照，原数据库文件移到诊断目录保留
+func (a *App) RecoverFromLatestSnapshot() db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.recoverFromLatestSnapshotWithRecover()
+}
+
+// recoverFromLatestSnapshotWithRecover 带异常处理的恢复最近快照函数
+func (a *App) recoverFromLatestSnapshotWithRecover() (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("RecoverFromLatestSnapshot 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("恢复快照发生异常: %v", r)}
+		}
+	}()
+
+	if err := a.checkRecoveryNeeded(); err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+	dir, err := getSnapshotDir()
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+
+	// 最近的快照校验不通过时依次尝试更早的快照
+	var failedMessages []string
+	for _, info := range readSnapshots(dir) {
+		if !info.IsSystemDb {
+			continue
+		}
+		result = a.RestoreSnapshot(info.FileName)
+		if result.Ok {
+			if a.diagnosis != nil {
+				a.diagnosis.Recovery = RECOVERY_SNAPSHOT
+			}
+			return result
+		}
+		failedMessages = append(failedMessages, info.FileName+": "+result.Message)
+		if !strings.HasPrefix(result.Message, "快照校验失败") {
+			// 替换文件时出错，不再继续尝试
+			break
+		}
+	}
+	if len(failedMessages) == 0 {
+		return db.QueryResult{Ok: false, Message: "没有可用的快照"}
+	}
+	return db.QueryResult{Ok: false, Message: "恢复快照失败: " + strings.Join(failedMessages, "；")}
+}
+
+// SalvageDatabase 从异常的数据库中抢救可读取的数据到新数据库，原数据库文件移到诊断目录保留
+func (a *App) SalvageDatabase() db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.salvageDatabaseWithRecover()
+}
+
+// salvageDatabaseWithRecover 带异常处理的抢救数据函数
+func (a *App) salvageDatabaseWithRecover() (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("SalvageDatabase 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("抢救数据发生异常: %v", r)}
+		}
+	}()
+
+	if err := a.checkRecoveryNeeded(); err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+
+	dbPath := getSystemDbPath()
+	a.detachSystemDb(fmt.Errorf("正在抢救数据"))
+	salvagePath, tableResults, err := a.salvageDatabase(dbPath)
+	if err != nil {
+		a.detachSystemDb(err)
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+
+	damagedDir, err := preserveDamagedDatabase(dbPath)
+	if err == nil {
+		err = replaceDatabaseFile(salvagePath, dbPath)
+	}
+	if err != nil {
+		os.Remove(salvagePath)
+		a.detachSystemDb(err)
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+	if err := a.reopenSystemDb(); err != nil {
+		return db.QueryResult{Ok: false, Message: "重新打开数据库失败: " + err.Error()}
+	}
+	if a.diagnosis != nil {
+		a.diagnosis.Recovery = RECOVERY_SALVAGE
+	}
+
+	return db.QueryResult{
+		Ok:      true,
+		Message: "数据抢救完成，原数据库文件已保存到: " + damagedDir,
+		Data:    tableResults,
+	}
+}
+
+// StartReadOnly 以只读模式打开异常的数据库，可以查看和导出数据，不能修改
+func (a *App) StartReadOnly() db.QueryResult {
+	if err := a.checkRecoveryNeeded(); err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+	if _, readOnly, _ := a.getDbState(); readOnly {
+		return db.QueryResult{Ok: true, Message: "已处于只读模式"}
+	}
+
+	dbPath := getSystemDbPath()
+	if _, err := os.Stat(dbPath); err != nil {
+		return db.QueryResult{Ok: false, Message: "数据库文件不存在"}
+	}
+	database, err := openSystemDb(dbPath, true)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: "以只读模式打开数据库失败: " + err.Error()}
+	}
+	a.replaceSystemDb(database, true, nil)
+	if a.diagnosis != nil {
+		a.diagnosis.Recovery = RECOVERY_READ_ONLY
+	}
+	return db.QueryResult{Ok: true, Message: "已以只读模式打开数据库，数据不能修改"}
+}
+
+// ExportDiagnosticBundle 生成诊断包，供技术支持排查数据库问题
+func (a *App) ExportDiagnosticBundle() db.QueryResult {
+	diagnosis := a.diagnosis
+	if diagnosis == nil {
+		diagnosis = &StartupDiagnosis{DbPath: getSystemDbPath(), Healthy: a.GetDB() != nil}
+	}
+	bundlePath, err := writeDiagnosticBundle(diagnosis)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+	return db.QueryResult{Ok: true, Message: "诊断包已生成", Data: bundlePath}
+}
@@ -0,0 +1,696 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"shuji/data_import"
+	"shuji/db"
+	"strings"
+	"time"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+	"github.com/tjfoc/gmsm/x509"
+)
+
+// 报送数据包相关常量
+const (
+	SUBMISSION_PACKAGE_EXT       = ".zip"          // 报送数据包扩展名
+	SUBMISSION_FORMAT_VERSION    = "1"             // 报送数据包格式版本
+	SUBMISSION_DB_ENTRY          = "data.db"       // 数据库文件
+	SUBMISSION_MANIFEST_ENTRY    = "manifest.json" // 清单文件
+	SUBMISSION_SIGNATURE_ENTRY   = "manifest.sig"  // 清单的SM2签名
+	SUBMISSION_MAX_MANIFEST_SIZE = 1 << 20         // 清单文件大小上限
+)
+
+// SubmissionSigner 报送数据包签名者信息
+type SubmissionSigner struct {
+	User        string `json:"user"`        // 签名用户
+	Host        string `json:"host"`        // 签名计算机名
+	PublicKey   string `json:"publicKey"`   // SM2公钥（PEM）
+	Fingerprint string `json:"fingerprint"` // 公钥指纹（SM3）
+}
+
+// SubmissionManifest 报送数据包清单
+type SubmissionManifest struct {
+	FormatVersion string            `json:"formatVersion"` // 数据包格式版本
+	AppVersion    string            `json:"appVersion"`    // 软件版本
+	SchemaVersion int               `json:"schemaVersion"` // 数据库结构版本
+	ProvinceName  string            `json:"provinceName"`  // 省
+	CityName      string            `json:"cityName"`      // 市
+	CountryName   string            `json:"countryName"`   // 县
+	Years         []string          `json:"years"`         // 包含的年份
+	TableCounts   map[string]int    `json:"tableCounts"`   // 各数据表记录数
+	ExportTime    int64             `json:"exportTime"`    // 导出时间
+	ExportMode    string            `json:"exportMode"`    // 导出方式，full全量，delta增量
+	FromSeq       int64             `json:"fromSeq"`       // 增量导出的起始变更序号（不含）
+	ToSeq         int64             `json:"toSeq"`         // 导出时的变更序号
+	Digests       map[string]string `json:"digests"`       // 数据包内文件的SM3摘要
+	Signer        SubmissionSigner  `json:"signer"`        // 签名者
+}
+
+// submissionTables 报送数据包统计记录数的数据表
+var submissionTables = []string{
+	data_import.TableEnterpriseCoalConsumptionMain,
+	data_import.TableEnterpriseCoalConsumptionUsage,
+	data_import.TableEnterpriseCoalConsumptionEquip,
+	data_import.TableCriticalCoalEquipmentConsumption,
+	data_import.TableFixedAssetsInvestmentProject,
+	data_import.TableCoalConsumptionReport,
+}
+
+// isSubmissionPackage 判断文件是否为报送数据包
+func isSubmissionPackage(filePath string) bool {
+	return strings.EqualFold(filepath.Ext(filePath), SUBMISSION_PACKAGE_EXT)
+}
+
+// getKeyFingerprint 计算公钥指纹
+func getKeyFingerprint(publicKeyPem []byte) string {
+	hash := sm3.Sm3Sum(publicKeyPem)
+	return hex.EncodeToString(hash)
+}
+
+// workstationKeyFile 本机签名密钥文件，私钥以SM4加密保存。
+// 密钥不保存在数据库中，导出、快照和备份的数据库都不包含私钥
+type workstationKeyFile struct {
+	PrivateKey  string `json:"privateKey"`  // SM4加密的私钥
+	PublicKey   string `json:"publicKey"`   // SM2公钥（PEM）
+	Fingerprint string `json:"fingerprint"` // 公钥指纹（SM3）
+	CreateTime  int64  `json:"createTime"`  // 生成时间
+	CreateUser  string `json:"createUser"`  // 生成用户
+}
+
+// getWorkstationKeyPath 获取本机签名密钥文件路径
+func getWorkstationKeyPath() string {
+	return GetPath(filepath.Join(KEY_DIR_NAME, WORKSTATION_KEY_FILE_NAME))
+}
+
+// readWorkstationKeyFile 读取本机签名密钥文件，文件不存在时返回nil
+func readWorkstationKeyFile() (*workstationKeyFile, error) {
+	data, err := os.ReadFile(getWorkstationKeyPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var key workstationKeyFile
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("解析签名密钥文件失败: %v", err)
+	}
+	return &key, nil
+}
+
+// writeWorkstationKeyFile 保存本机签名密钥文件，只有当前用户可以读取，先写临时文件再替换
+func writeWorkstationKeyFile(key workstationKeyFile) error {
+	keyPath := getWorkstationKeyPath()
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return fmt.Errorf("创建密钥目录失败: %v", err)
+	}
+	data, err := json.MarshalIndent(key, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempPath := keyPath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, keyPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// migrateWorkstationKey 早期版本把签名密钥保存在系统数据库的workstation_key表中，
+// 移到密钥文件后删除数据库中的记录，删除时覆盖原数据所在的页，私钥不会残留在数据库文件中
+func (a *App) migrateWorkstationKey() error {
+	if a.GetDB() == nil {
+		return nil
+	}
+	keyResult, err := a.GetDB().QueryRow("SELECT private_key, public_key, fingerprint, create_time, create_user FROM workstation_key LIMIT 1")
+	if err != nil {
+		return fmt.Errorf("查询签名密钥失败: %v", err)
+	}
+	if keyResult.Data == nil {
+		return nil
+	}
+
+	existing, err := readWorkstationKeyFile()
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		keyData := keyResult.Data.(map[string]interface{})
+		err = writeWorkstationKeyFile(workstationKeyFile{
+			PrivateKey:  getStringValue(keyData["private_key"]),
+			PublicKey:   getStringValue(keyData["public_key"]),
+			Fingerprint: getStringValue(keyData["fingerprint"]),
+			CreateTime:  db.IntValue(keyData["create_time"]),
+			CreateUser:  getStringValue(keyData["create_user"]),
+		})
+		if err != nil {
+			return fmt.Errorf("保存签名密钥文件失败: %v", err)
+		}
+	} else {
+		// 恢复的快照中可能带有旧密钥，以密钥文件为准
+		log.Printf("签名密钥文件已存在，删除数据库中遗留的签名密钥")
+	}
+
+	return a.GetDB().WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("PRAGMA secure_delete = ON"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM workstation_key"); err != nil {
+			return err
+		}
+		_, err := tx.Exec("PRAGMA secure_delete = OFF")
+		return err
+	})
+}
+
+// getWorkstationKey 获取本机签名密钥对，首次使用时生成并保存到密钥文件
+func (a *App) getWorkstationKey() (*sm2.PrivateKey, []byte, error) {
+	if err := a.migrateWorkstationKey(); err != nil {
+		return nil, nil, err
+	}
+	key, err := readWorkstationKeyFile()
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取签名密钥失败: %v", err)
+	}
+
+	if key != nil {
+		privateKeyHex, err := SM4Decrypt(key.PrivateKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("解密签名密钥失败: %v", err)
+		}
+		privateKey, err := x509.ReadPrivateKeyFromHex(privateKeyHex)
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取签名密钥失败: %v", err)
+		}
+		return privateKey, []byte(key.PublicKey), nil
+	}
+
+	privateKey, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成签名密钥失败: %v", err)
+	}
+	publicKeyPem, err := x509.WritePublicKeyToPem(&privateKey.PublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("导出签名公钥失败: %v", err)
+	}
+	// 私钥按固定长度编码，避免高位为0时产生奇数长度的十六进制串
+	encryptedPrivateKey, err := SM4Encrypt(fmt.Sprintf("%064x", privateKey.D))
+	if err != nil {
+		return nil, nil, fmt.Errorf("加密签名密钥失败: %v", err)
+	}
+
+	err = writeWorkstationKeyFile(workstationKeyFile{
+		PrivateKey:  encryptedPrivateKey,
+		PublicKey:   string(publicKeyPem),
+		Fingerprint: getKeyFingerprint(publicKeyPem),
+		CreateTime:  time.Now().UnixMilli(),
+		CreateUser:  a.GetCurrentOSUser(),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("保存签名密钥失败: %v", err)
+	}
+
+	return privateKey, publicKeyPem, nil
+}
+
+// GetWorkstationKey 获取本机签名公钥和指纹，用于上级核对报送数据包的签名者
+func (a *App) GetWorkstationKey() db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.getWorkstationKeyWithRecover()
+}
+
+// getWorkstationKeyWithRecover 带异常处理的获取本机签名公钥函数
+func (a *App) getWorkstationKeyWithRecover() db.QueryResult {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("GetWorkstationKey 发生异常: %v", r)
+		}
+	}()
+
+	_, publicKeyPem, err := a.getWorkstationKey()
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+
+	hostName, _ := os.Hostname()
+	return db.QueryResult{
+		Ok: true,
+		Data: SubmissionSigner{
+			User:        a.GetCurrentOSUser(),
+			Host:        hostName,
+			PublicKey:   string(publicKeyPem),
+			Fingerprint: getKeyFingerprint(publicKeyPem),
+		},
+	}
+}
+
+// buildSubmissionManifest 统计导出数据库的区域、年份和记录数
+func (a *App) buildSubmissionManifest(exportDb *db.Database) (SubmissionManifest, error) {
+	manifest := SubmissionManifest{
+		FormatVersion: SUBMISSION_FORMAT_VERSION,
+		AppVersion:    APP_VERSION,
+		SchemaVersion: getSchemaVersion(),
+		Years:         []string{},
+		TableCounts:   make(map[string]int),
+		ExportTime:    time.Now().UnixMilli(),
+		Digests:       make(map[string]string),
+	}
+
+	areaResult, err := exportDb.QueryRow("SELECT province_name, city_name, country_name FROM area_config LIMIT 1")
+	if err != nil {
+		return manifest, fmt.Errorf("查询区域配置失败: %v", err)
+	}
+	if areaResult.Data != nil {
+		area := areaResult.Data.(map[string]interface{})
+		manifest.ProvinceName = getStringValue(area["province_name"])
+		manifest.CityName = getStringValue(area["city_name"])
+		manifest.CountryName = getStringValue(area["country_name"])
+	}
+
+	exportResult, err := exportDb.QueryRow("SELECT export_mode, from_seq, to_seq FROM data_export_info ORDER BY export_time DESC LIMIT 1")
+	if err != nil {
+		return manifest, fmt.Errorf("查询导出信息失败: %v", err)
+	}
+	if exportResult.Data != nil {
+		exportInfo := exportResult.Data.(map[string]interface{})
+		manifest.ExportMode = getStringValue(exportInfo["export_mode"])
+		manifest.FromSeq, _ = exportInfo["from_seq"].(int64)
+		manifest.ToSeq, _ = exportInfo["to_seq"].(int64)
+	}
+
+	years, err := querySubmissionYears(exportDb)
+	if err != nil {
+		return manifest, err
+	}
+	manifest.Years = years
+
+	for _, tableName := range submissionTables {
+		countResult, err := exportDb.QueryRow(fmt.Sprintf("SELECT COUNT(1) AS count FROM %s", tableName))
+		if err != nil {
+			return manifest, fmt.Errorf("统计表 %s 记录数失败: %v", tableName, err)
+		}
+		count, _ := countResult.Data.(map[string]interface{})["count"].(int64)
+		manifest.TableCounts[tableName] = int(count)
+	}
+
+	return manifest, nil
+}
+
+// querySubmissionYears 查询数据库中各数据表包含的数据年份
+func querySubmissionYears(database *db.Database) ([]string, error) {
+	yearsQuery := `SELECT stat_date FROM enterprise_coal_consumption_main
+		UNION SELECT stat_date FROM critical_coal_equipment_consumption
+		UNION SELECT stat_date FROM fixed_assets_investment_project
+		UNION SELECT stat_date FROM coal_consumption_report
+		ORDER BY stat_date`
+	yearsResult, err := database.Query(yearsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("查询数据年份失败: %v", err)
+	}
+	var years []string
+	if yearsResult.Data != nil {
+		for _, row := range yearsResult.Data.([]map[string]interface{}) {
+			if year := getStringValue(row["stat_date"]); year != "" {
+				years = append(years, year)
+			}
+		}
+	}
+	return years, nil
+}
+
+// checkSubmissionYears 查询导出数据包含的年份并检查是否都可以报送
+func (a *App) checkSubmissionYears(exportDb *db.Database) ([]string, error) {
+	years, err := querySubmissionYears(exportDb)
+	if err != nil {
+		return nil, err
+	}
+	if err := data_import.NewDataImportService(a).CheckYearsSubmittable(years); err != nil {
+		return nil, err
+	}
+	return years, nil
+}
+
+// markYearsSubmitted 导出报送后将年份标记为已报送，锁定后不能再修改
+func (a *App) markYearsSubmitted(years []string, filePath string) error {
+	if err := data_import.NewDataImportService(a).SubmitYears(years, filepath.Base(filePath)); err != nil {
+		return fmt.Errorf("更新报送状态失败: %v", err)
+	}
+	return nil
+}
+
+// ExportSubmissionPackage 导出签名的报送数据包
+func (a *App) ExportSubmissionPackage(filePath string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.exportSubmissionPackageWithRecover(filePath)
+}
+
+// exportSubmissionPackageWithRecover 带异常处理的导出报送数据包函数
+func (a *App) exportSubmissionPackageWithRecover(filePath string) db.QueryResult {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ExportSubmissionPackage 发生异常: %v", r)
+		}
+	}()
+
+	result := db.QueryResult{}
+
+	// 1. 复制系统数据库并记录导出信息
+	newDb, dbTempPath, err := a.CopySystemDb("export_")
+	if err != nil {
+		result.Message = "复制数据库文件失败: " + err.Error()
+		return result
+	}
+	defer a.Removefile(dbTempPath)
+
+	toSeq, err := getCurrentChangeSeq(newDb)
+	if err != nil {
+		newDb.Close()
+		result.Message = err.Error()
+		return result
+	}
+	years, err := a.checkSubmissionYears(newDb)
+	if err == nil {
+		err = a.insertExportInfo(newDb, EXPORT_MODE_FULL, 0, toSeq)
+	}
+	if err != nil {
+		newDb.Close()
+		result.Message = err.Error()
+		return result
+	}
+
+	// 2. 生成清单、签名并写入数据包
+	manifest, err := a.packSubmission(newDb, dbTempPath, filePath)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	if err := a.recordSubmissionWatermark(EXPORT_MODE_FULL, 0, toSeq, filePath); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	if err := a.markYearsSubmitted(years, filePath); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	result.Ok = true
+	result.Message = "报送数据包导出成功"
+	result.Data = manifest
+	return result
+}
+
+// packSubmission 为导出的数据库生成清单并签名，写入报送数据包，exportDb在生成清单后关闭
+func (a *App) packSubmission(exportDb *db.Database, dbTempPath string, filePath string) (SubmissionManifest, error) {
+	manifest, err := a.buildSubmissionManifest(exportDb)
+	exportDb.Close()
+	if err != nil {
+		return manifest, err
+	}
+
+	privateKey, publicKeyPem, err := a.getWorkstationKey()
+	if err != nil {
+		return manifest, err
+	}
+
+	dbDigest, err := data_import.GetFileHash(dbTempPath)
+	if err != nil {
+		return manifest, fmt.Errorf("计算数据库摘要失败: %v", err)
+	}
+	manifest.Digests[SUBMISSION_DB_ENTRY] = dbDigest
+
+	hostName, _ := os.Hostname()
+	manifest.Signer = SubmissionSigner{
+		User:        a.GetCurrentOSUser(),
+		Host:        hostName,
+		PublicKey:   string(publicKeyPem),
+		Fingerprint: getKeyFingerprint(publicKeyPem),
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, fmt.Errorf("生成清单失败: %v", err)
+	}
+
+	// 使用本机密钥对清单签名
+	signature, err := privateKey.Sign(rand.Reader, manifestBytes, nil)
+	if err != nil {
+		return manifest, fmt.Errorf("签名失败: %v", err)
+	}
+
+	if err := writeSubmissionPackage(filePath, dbTempPath, manifestBytes, signature); err != nil {
+		os.Remove(filePath)
+		return manifest, fmt.Errorf("创建报送数据包失败: %v", err)
+	}
+
+	return manifest, nil
+}
+
+// writeSubmissionPackage 将数据库、清单和签名写入ZIP数据包
+func writeSubmissionPackage(filePath string, dbPath string, manifestBytes []byte, signature []byte) error {
+	packageFile, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer packageFile.Close()
+
+	zipWriter := zip.NewWriter(packageFile)
+
+	dbFile, err := os.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer dbFile.Close()
+
+	dbWriter, err := zipWriter.Create(SUBMISSION_DB_ENTRY)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dbWriter, dbFile); err != nil {
+		return err
+	}
+
+	entries := []struct {
+		name string
+		data []byte
+	}{
+		{SUBMISSION_MANIFEST_ENTRY, manifestBytes},
+		{SUBMISSION_SIGNATURE_ENTRY, []byte(hex.EncodeToString(signature))},
+	}
+	for _, entry := range entries {
+		writer, err := zipWriter.Create(entry.name)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(entry.data); err != nil {
+			return err
+		}
+	}
+
+	return zipWriter.Close()
+}
+
+// readZipEntry 读取ZIP中的小文件
+func readZipEntry(file *zip.File, maxSize int64) ([]byte, error) {
+	if file.UncompressedSize64 > uint64(maxSize) {
+		return nil, fmt.Errorf("文件 %s 过大", file.Name)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(io.LimitReader(reader, maxSize))
+}
+
+// verifySubmissionPackage 校验报送数据包的签名和完整性，dbDstPath不为空时将数据库解压到该路径
+func verifySubmissionPackage(filePath string, dbDstPath string) (SubmissionManifest, error) {
+	var manifest SubmissionManifest
+
+	zipReader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return manifest, fmt.Errorf("打开数据包失败: %v", err)
+	}
+	defer zipReader.Close()
+
+	entries := make(map[string]*zip.File)
+	for _, file := range zipReader.File {
+		if _, exists := entries[file.Name]; exists {
+			return manifest, fmt.Errorf("数据包中存在重复文件: %s", file.Name)
+		}
+		entries[file.Name] = file
+	}
+
+	manifestFile, signatureFile := entries[SUBMISSION_MANIFEST_ENTRY], entries[SUBMISSION_SIGNATURE_ENTRY]
+	if manifestFile == nil || signatureFile == nil {
+		return manifest, fmt.Errorf("数据包缺少清单或签名")
+	}
+
+	// 1. 先校验清单签名，签名通过后才信任清单内容
+	manifestBytes, err := readZipEntry(manifestFile, SUBMISSION_MAX_MANIFEST_SIZE)
+	if err != nil {
+		return manifest, fmt.Errorf("读取清单失败: %v", err)
+	}
+	signatureHex, err := readZipEntry(signatureFile, SUBMISSION_MAX_MANIFEST_SIZE)
+	if err != nil {
+		return manifest, fmt.Errorf("读取签名失败: %v", err)
+	}
+	signature, err := hex.DecodeString(strings.TrimSpace(string(signatureHex)))
+	if err != nil {
+		return manifest, fmt.Errorf("签名格式错误: %v", err)
+	}
+
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return manifest, fmt.Errorf("清单格式错误: %v", err)
+	}
+	if manifest.FormatVersion != SUBMISSION_FORMAT_VERSION {
+		return manifest, fmt.Errorf("不支持的数据包格式版本: %s", manifest.FormatVersion)
+	}
+
+	publicKey, err := x509.ReadPublicKeyFromPem([]byte(manifest.Signer.PublicKey))
+	if err != nil {
+		return manifest, fmt.Errorf("签名公钥格式错误: %v", err)
+	}
+	if !publicKey.Verify(manifestBytes, signature) {
+		return manifest, fmt.Errorf("数据包签名校验失败，数据包可能被篡改")
+	}
+	if manifest.Signer.Fingerprint != getKeyFingerprint([]byte(manifest.Signer.PublicKey)) {
+		return manifest, fmt.Errorf("签名公钥指纹不一致")
+	}
+	if manifest.SchemaVersion > getSchemaVersion() {
+		return manifest, fmt.Errorf("数据包由更高版本软件导出（数据库结构版本%d），请升级软件后再合并", manifest.SchemaVersion)
+	}
+
+	// 2. 数据包中只能包含清单列出的文件
+	for name := range entries {
+		if name == SUBMISSION_MANIFEST_ENTRY || name == SUBMISSION_SIGNATURE_ENTRY {
+			continue
+		}
+		if _, exists := manifest.Digests[name]; !exists {
+			return manifest, fmt.Errorf("数据包中存在未签名的文件: %s", name)
+		}
+	}
+
+	// 3. 校验文件摘要，数据库边解压边计算摘要
+	for name, digest := range manifest.Digests {
+		file := entries[name]
+		if file == nil {
+			return manifest, fmt.Errorf("数据包缺少文件: %s", name)
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return manifest, fmt.Errorf("读取文件 %s 失败: %v", name, err)
+		}
+
+		hash := sm3.New()
+		var writer io.Writer = hash
+		var dstFile *os.File
+		if name == SUBMISSION_DB_ENTRY && dbDstPath != "" {
+			dstFile, err = os.Create(dbDstPath)
+			if err != nil {
+				reader.Close()
+				return manifest, fmt.Errorf("解压数据库失败: %v", err)
+			}
+			writer = io.MultiWriter(hash, dstFile)
+		}
+
+		_, err = io.Copy(writer, reader)
+		reader.Close()
+		if dstFile != nil {
+			dstFile.Close()
+		}
+		if err != nil {
+			return manifest, fmt.Errorf("读取文件 %s 失败: %v", name, err)
+		}
+
+		if hex.EncodeToString(hash.Sum(nil)) != digest {
+			if dstFile != nil {
+				os.Remove(dbDstPath)
+			}
+			return manifest, fmt.Errorf("文件 %s 摘要校验失败，数据包可能被篡改", name)
+		}
+	}
+
+	if entries[SUBMISSION_DB_ENTRY] == nil {
+		return manifest, fmt.Errorf("数据包缺少数据库文件")
+	}
+
+	return manifest, nil
+}
+
+// VerifySubmissionPackage 校验报送数据包，返回清单和签名者信息
+func (a *App) VerifySubmissionPackage(filePath string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.verifySubmissionPackageWithRecover(filePath)
+}
+
+// verifySubmissionPackageWithRecover 带异常处理的校验报送数据包函数
+func (a *App) verifySubmissionPackageWithRecover(filePath string) db.QueryResult {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("VerifySubmissionPackage 发生异常: %v", r)
+		}
+	}()
+
+	manifest, err := verifySubmissionPackage(filePath, "")
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+
+	return db.QueryResult{
+		Ok:      true,
+		Message: fmt.Sprintf("数据包校验通过，签名者: %s@%s", manifest.Signer.User, manifest.Signer.Host),
+		Data:    manifest,
+	}
+}
+
+// prepareMergeSource 将合并来源复制到临时路径，报送数据包先校验签名和完整性再解压数据库，
+// 返回数据包的签名者，普通数据库文件返回nil
+func (a *App) prepareMergeSource(sourcePath string, dstPath string) (*SubmissionSigner, error) {
+	if !isSubmissionPackage(sourcePath) {
+		copyResult := a.Copyfile(sourcePath, dstPath)
+		if !copyResult.Ok {
+			return nil, fmt.Errorf("%s", copyResult.Data)
+		}
+		return nil, nil
+	}
+
+	manifest, err := verifySubmissionPackage(sourcePath, dstPath)
+	if err == nil {
+		// 签名有效只说明数据包未被篡改，签名者还须是该区域登记的可信签名者
+		err = a.checkTrustedSubmitter(manifest)
+	}
+	if err != nil {
+		a.Removefile(dstPath)
+		return nil, err
+	}
+	return &manifest.Signer, nil
+}
+
+// queryMergeSource 在合并来源的临时副本上查询数据，报送数据包校验签名和完整性后解压，查询结束后删除临时副本
+func (a *App) queryMergeSource(sourcePath string, query func(dbPath string) db.QueryResult) db.QueryResult {
+	dstPath := GetPath(filepath.Join(DATA_DIR_NAME, fmt.Sprintf("detail_%d", time.Now().UnixNano())))
+	if _, err := a.prepareMergeSource(sourcePath, dstPath); err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("数据文件 %s 校验失败: %v", filepath.Base(sourcePath), err)}
+	}
+	defer a.Removefile(dstPath)
+	return query(dstPath)
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"shuji/data_import"
+	"shuji/db"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tjfoc/gmsm/x509"
+)
+
+// 报送回执相关常量
+const (
+	RECEIPT_FORMAT_VERSION = "1"             // 回执格式版本
+	RECEIPT_STATUS_ACCEPT  = "accepted"      // 上级已接收
+	RECEIPT_STATUS_RETURN  = "returned"      // 上级退回
+	RECEIPT_MAX_SIZE       = 64 << 20        // 回执文件大小上限
+	RECEIPT_FILE_SUFFIX    = "_receipt.json" // 合并后生成的回执文件名后缀
+)
+
+// SubmissionReceipt 上级对报送数据的回执
+type SubmissionReceipt struct {
+	FormatVersion string                                `json:"formatVersion"`        // 回执格式版本
+	ProvinceName  string                                `json:"provinceName"`         // 报送单位所在省
+	CityName      string                                `json:"cityName"`             // 报送单位所在市
+	CountryName   string                                `json:"countryName"`          // 报送单位所在县
+	Years         []string                              `json:"years"`                // 回执涉及的年份
+	Status        string                                `json:"status"`               // 回执结果，accepted接收，returned退回
+	Reason        string                                `json:"reason"`               // 退回原因或接收说明
+	SourceFile    string                                `json:"sourceFile,omitempty"` // 回执对应的报送文件名
+	SourceHash    string                                `json:"sourceHash,omitempty"` // 回执对应的报送文件哈希（SM3）
+	Records       []data_import.SubmissionReceiptRecord `json:"records,omitempty"`    // 各条数据的处理结果
+	ReceiptTime   int64                                 `json:"receiptTime"`          // 回执时间
+	Issuer        string                                `json:"issuer"`               // 出具回执的单位
+	IssueUser     string                                `json:"issueUser"`            // 出具回执的用户
+	Signer        SubmissionSigner                      `json:"signer"`               // 签名者
+}
+
+// signedSubmissionReceipt 回执文件内容，签名针对receipt的原始字节
+type signedSubmissionReceipt struct {
+	Receipt   json.RawMessage `json:"receipt"`   // 回执
+	Signature string          `json:"signature"` // 回执的SM2签名（十六进制）
+}
+
+// writeSubmissionReceipt 使用本机密钥对回执签名并写入文件
+func (a *App) writeSubmissionReceipt(receipt *SubmissionReceipt, filePath string) error {
+	privateKey, publicKeyPem, err := a.getWorkstationKey()
+	if err != nil {
+		return err
+	}
+
+	hostName, _ := os.Hostname()
+	receipt.FormatVersion = RECEIPT_FORMAT_VERSION
+	receipt.ReceiptTime = time.Now().UnixMilli()
+	receipt.Issuer = a.GetAreaStr()
+	receipt.IssueUser = a.GetCurrentOSUser()
+	receipt.Signer = SubmissionSigner{
+		User:        receipt.IssueUser,
+		Host:        hostName,
+		PublicKey:   string(publicKeyPem),
+		Fingerprint: getKeyFingerprint(publicKeyPem),
+	}
+
+	receiptBytes, err := json.Marshal(receipt)
+	if err != nil {
+		return fmt.Errorf("生成回执失败: %v", err)
+	}
+	signature, err := privateKey.Sign(rand.Reader, receiptBytes, nil)
+	if err != nil {
+		return fmt.Errorf("签名失败: %v", err)
+	}
+
+	fileBytes, err := json.MarshalIndent(signedSubmissionReceipt{Receipt: receiptBytes, Signature: hex.EncodeToString(signature)}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("生成回执失败: %v", err)
+	}
+	if err := os.WriteFile(filePath, fileBytes, 0644); err != nil {
+		return fmt.Errorf("写入回执文件失败: %v", err)
+	}
+	return nil
+}
+
+// readSubmissionReceipt 读取回执文件并校验签名，签名通过后才信任回执内容，签发者是否可信由调用方检查
+func readSubmissionReceipt(filePath string) (SubmissionReceipt, error) {
+	var receipt SubmissionReceipt
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return receipt, fmt.Errorf("读取回执文件失败: %v", err)
+	}
+	if info.Size() > RECEIPT_MAX_SIZE {
+		return receipt, fmt.Errorf("回执文件过大")
+	}
+	fileBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return receipt, fmt.Errorf("读取回执文件失败: %v", err)
+	}
+
+	var signed signedSubmissionReceipt
+	if err := json.Unmarshal(fileBytes, &signed); err != nil || len(signed.Receipt) == 0 {
+		return receipt, fmt.Errorf("回执文件格式错误")
+	}
+	// 回执文件缩进排版，签名针对紧凑格式的回执
+	var receiptBytes bytes.Buffer
+	if err := json.Compact(&receiptBytes, signed.Receipt); err != nil {
+		return receipt, fmt.Errorf("回执文件格式错误: %v", err)
+	}
+	signature, err := hex.DecodeString(signed.Signature)
+	if err != nil {
+		return receipt, fmt.Errorf("签名格式错误: %v", err)
+	}
+	if err := json.Unmarshal(receiptBytes.Bytes(), &receipt); err != nil {
+		return receipt, fmt.Errorf("回执文件格式错误: %v", err)
+	}
+	if receipt.FormatVersion != RECEIPT_FORMAT_VERSION {
+		return receipt, fmt.Errorf("不支持的回执格式版本: %s", receipt.FormatVersion)
+	}
+
+	publicKey, err := x509.ReadPublicKeyFromPem([]byte(receipt.Signer.PublicKey))
+	if err != nil {
+		return receipt, fmt.Errorf("签名公钥格式错误: %v", err)
+	}
+	if !publicKey.Verify(receiptBytes.Bytes(), signature) {
+		return receipt, fmt.Errorf("回执签名校验失败，回执可能被篡改")
+	}
+	if receipt.Signer.Fingerprint != getKeyFingerprint([]byte(receipt.Signer.PublicKey)) {
+		return receipt, fmt.Errorf("签名公钥指纹不一致")
+	}
+
+	if receipt.Status != RECEIPT_STATUS_ACCEPT && receipt.Status != RECEIPT_STATUS_RETURN {
+		return receipt, fmt.Errorf("回执结果无效: %s", receipt.Status)
+	}
+	if len(receipt.Years) == 0 {
+		return receipt, fmt.Errorf("回执未包含年份")
+	}
+	return receipt, nil
+}
+
+// CreateSubmissionReceipt 上级为下级报送的数据生成回执文件，accepted为false时表示退回，必须填写原因
+func (a *App) CreateSubmissionReceipt(provinceName, cityName, countryName string, years []string, accepted bool, reason string, filePath string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.createSubmissionReceiptWithRecover(provinceName, cityName, countryName, years, accepted, reason, filePath)
+}
+
+// createSubmissionReceiptWithRecover 带异常处理的生成报送回执函数
+func (a *App) createSubmissionReceiptWithRecover(provinceName, cityName, countryName string, years []string, accepted bool, reason string, filePath string) db.QueryResult {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("CreateSubmissionReceipt 发生异常: %v", r)
+		}
+	}()
+
+	if provinceName == "" || len(years) == 0 {
+		return db.QueryResult{Ok: false, Message: "请选择报送单位和年份"}
+	}
+	reason = strings.TrimSpace(reason)
+	status := RECEIPT_STATUS_ACCEPT
+	if !accepted {
+		if reason == "" {
+			return db.QueryResult{Ok: false, Message: "退回时必须填写退回原因"}
+		}
+		status = RECEIPT_STATUS_RETURN
+	}
+
+	receipt := SubmissionReceipt{
+		ProvinceName: provinceName,
+		CityName:     cityName,
+		CountryName:  countryName,
+		Years:        years,
+		Status:       status,
+		Reason:       reason,
+	}
+	if err := a.writeSubmissionReceipt(&receipt, filePath); err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+
+	return db.QueryResult{Ok: true, Message: "回执生成成功", Data: receipt}
+}
+
+// receiptTargetIndex 汇总数据库中单个数据表的数据索引
+type receiptTargetIndex struct {
+	ObjIDs map[string]bool   // 汇总数据库中的obj_id
+	Keys   map[string]string // key: 数据唯一键, value: 该键数据的来源文件名
+}
+
+// indexReceiptTarget 读取汇总数据库中数据表的obj_id、唯一键和数据来源
+func indexReceiptTarget(spec mergeTableSpec, targetDb *db.Database) (receiptTargetIndex, error) {
+	index := receiptTargetIndex{ObjIDs: make(map[string]bool), Keys: make(map[string]string)}
+
+	columns := make([]string, 0, len(spec.KeyFields)+1)
+	for _, field := range append([]string{"obj_id"}, spec.KeyFields...) {
+		columns = append(columns, "t."+field)
+	}
+	query := fmt.Sprintf("SELECT %s, '' AS source_file FROM %s t", strings.Join(columns, ", "), spec.TableName)
+	// 早期合并的数据库没有数据来源记录
+	if exists, err := targetDb.ColumnExists("data_merge_source", "record_id"); err == nil && exists {
+		query = fmt.Sprintf(`SELECT %s, MAX(s.source_file) AS source_file FROM %s t
+			LEFT JOIN data_merge_source s ON s.table_name = '%s' AND s.record_id = t.obj_id
+			GROUP BY t.obj_id`, strings.Join(columns, ", "), spec.TableName, spec.TableName)
+	}
+
+	err := targetDb.QueryEach(query, func(row map[string]interface{}) error {
+		index.ObjIDs[getStringValue(row["obj_id"])] = true
+		index.Keys[spec.keyOf(row)] = getStringValue(row["source_file"])
+		return nil
+	})
+	if err != nil {
+		return index, fmt.Errorf("读取汇总数据库%s失败: %v", spec.TableName, err)
+	}
+	return index, nil
+}
+
+// buildMergeReceipt 对比报送数据库和汇总数据库，生成每条报送数据的处理结果
+// 汇总数据库中存在相同obj_id的数据视为接收；区域不一致、冲突时采用了其他文件的数据或未合并的视为未接收
+func (a *App) buildMergeReceipt(sourceDb *db.Database, targets map[string]receiptTargetIndex, areaConfig AreaConfig) ([]data_import.SubmissionReceiptRecord, error) {
+	records := []data_import.SubmissionReceiptRecord{}
+
+	for _, spec := range mergeTableSpecs {
+		target := targets[spec.TableType]
+		columns := spec.indexColumns()
+		if !slices.Contains(columns, "stat_date") {
+			columns = append(columns, "stat_date")
+		}
+		query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), spec.TableName)
+
+		err := sourceDb.QueryEach(query, func(row map[string]interface{}) error {
+			record := data_import.SubmissionReceiptRecord{
+				TableType: spec.TableType,
+				ObjID:     getStringValue(row["obj_id"]),
+				StatDate:  getStringValue(row["stat_date"]),
+				Key:       spec.keyOf(row),
+			}
+			if spec.NameField != "" {
+				record.Name = getStringValue(row[spec.NameField])
+			}
+
+			provinceName, cityName, countryName := getStringValue(row["province_name"]), getStringValue(row["city_name"]), getStringValue(row["country_name"])
+			sourceFile, keyExists := target.Keys[record.Key]
+			switch {
+			case spec.ValidateArea && a.validateAreaConsistency(provinceName, cityName, countryName, areaConfig) != nil:
+				record.Reason = fmt.Sprintf("数据区域（%s%s%s）与汇总区域不一致", provinceName, cityName, countryName)
+			case target.ObjIDs[record.ObjID]:
+				record.Accepted = true
+			case keyExists && sourceFile != "":
+				record.Reason = fmt.Sprintf("与%s中的数据冲突，已采用%s的数据", sourceFile, sourceFile)
+			case keyExists:
+				record.Reason = "与其他单位报送的数据冲突，未采用本单位的数据"
+			default:
+				record.Reason = "未合并到汇总数据库"
+			}
+			records = append(records, record)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("读取%s失败: %v", spec.TableName, err)
+		}
+	}
+
+	return records, nil
+}
+
+// ExportMergeReceipts 合并完成后为每个报送文件生成签名回执，列出接收和未接收的数据及原因
+func (a *App) ExportMergeReceipts(targetDbPath string, province string, city string, country string, sourceDbPaths []string, outputDir string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.exportMergeReceiptsWithRecover(targetDbPath, province, city, country, sourceDbPaths, outputDir)
+}
+
+// exportMergeReceiptsWithRecover 带异常处理的生成合并回执函数
+func (a *App) exportMergeReceiptsWithRecover(targetDbPath string, province string, city string, country string, sourceDbPaths []string, outputDir string) (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ExportMergeReceipts 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("生成回执发生异常: %v", r)}
+		}
+	}()
+
+	if len(sourceDbPaths) == 0 {
+		return db.QueryResult{Ok: false, Message: "请选择需要生成回执的报送文件"}
+	}
+	areaConfig := AreaConfig{ProvinceName: province, CityName: city, CountryName: country}
+
+	// 1. 建立汇总数据库的数据索引
+	targetDb, err := db.NewDatabase(targetDbPath, EXCHANGE_DB_PASSWORD)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: "打开汇总数据库失败: " + err.Error()}
+	}
+	targets := make(map[string]receiptTargetIndex)
+	for _, spec := range mergeTableSpecs {
+		index, err := indexReceiptTarget(spec, targetDb)
+		if err != nil {
+			targetDb.Close()
+			return db.QueryResult{Ok: false, Message: err.Error()}
+		}
+		targets[spec.TableType] = index
+	}
+	targetDb.Close()
+
+	// 2. 逐个报送文件生成回执，报送数据包先校验签名
+	receiptFiles := []string{}
+	failedMessages := make(map[string]string) // key: 文件路径, value: 失败原因
+	now := time.Now().Unix()
+	for i, sourcePath := range sourceDbPaths {
+		receiptPath := filepath.Join(outputDir, strings.TrimSuffix(filepath.Base(sourcePath), filepath.Ext(sourcePath))+RECEIPT_FILE_SUFFIX)
+		if err := a.exportMergeReceipt(sourcePath, receiptPath, targets, areaConfig, now+int64(i)); err != nil {
+			failedMessages[sourcePath] = err.Error()
+			continue
+		}
+		receiptFiles = append(receiptFiles, receiptPath)
+	}
+
+	if len(receiptFiles) == 0 {
+		return db.QueryResult{Ok: false, Message: "生成回执失败", Data: map[string]interface{}{"failedMessages": failedMessages}}
+	}
+	return db.QueryResult{
+		Ok:      true,
+		Message: fmt.Sprintf("成功生成%d个回执文件", len(receiptFiles)),
+		Data: map[string]interface{}{
+			"receiptFiles":   receiptFiles,
+			"failedMessages": failedMessages,
+		},
+	}
+}
+
+// exportMergeReceipt 为单个报送文件生成回执
+func (a *App) exportMergeReceipt(sourcePath string, receiptPath string, targets map[string]receiptTargetIndex, areaConfig AreaConfig, tempID int64) error {
+	dstPath := GetPath(filepath.Join(DATA_DIR_NAME, "receipt_"+strconv.FormatInt(tempID, 16)))
+	if _, err := a.prepareMergeSource(sourcePath, dstPath); err != nil {
+		return err
+	}
+	defer a.Removefile(dstPath)
+
+	sourceDb, err := db.NewReadOnlyDatabase(dstPath, EXCHANGE_DB_PASSWORD)
+	if err != nil {
+		return fmt.Errorf("打开数据库失败: %v", err)
+	}
+	info := a.getMergeSourceInfo(sourceDb, sourcePath)
+	records, err := a.buildMergeReceipt(sourceDb, targets, areaConfig)
+	sourceDb.Close()
+	if err != nil {
+		return err
+	}
+
+	receipt := SubmissionReceipt{
+		ProvinceName: info.ProvinceName,
+		CityName:     info.CityName,
+		CountryName:  info.CountryName,
+		Status:       RECEIPT_STATUS_ACCEPT,
+		SourceFile:   info.FileName,
+		SourceHash:   info.FileHash,
+		Records:      records,
+	}
+	rejectedCount := 0
+	for _, record := range records {
+		if record.StatDate != "" && !slices.Contains(receipt.Years, record.StatDate) {
+			receipt.Years = append(receipt.Years, record.StatDate)
+		}
+		if !record.Accepted {
+			rejectedCount++
+		}
+	}
+	if len(receipt.Years) == 0 {
+		return fmt.Errorf("报送文件中没有数据")
+	}
+	slices.Sort(receipt.Years)
+	if rejectedCount > 0 {
+		receipt.Status = RECEIPT_STATUS_RETURN
+	}
+	receipt.Reason = fmt.Sprintf("共%d条数据，接收%d条，未接收%d条", len(records), len(records)-rejectedCount, rejectedCount)
+
+	return a.writeSubmissionReceipt(&receipt, receiptPath)
+}
+
+// ImportSubmissionReceipt 导入上级回执，接收的年份保持锁定，退回的年份开放修改，回执包含数据处理结果时同时更新数据的检查状态
+func (a *App) ImportSubmissionReceipt(filePath string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.importSubmissionReceiptWithRecover(filePath)
+}
+
+// importSubmissionReceiptWithRecover 带异常处理的导入报送回执函数
+func (a *App) importSubmissionReceiptWithRecover(filePath string) db.QueryResult {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ImportSubmissionReceipt 发生异常: %v", r)
+		}
+	}()
+
+	receipt, err := readSubmissionReceipt(filePath)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error()}
+	}
+	// 回执签名只能说明回执未被篡改，签名者还须是登记的上级签发者
+	if err := a.checkTrustedIssuer(receipt.Signer.Fingerprint); err != nil {
+		return db.QueryResult{Ok: false, Message: err.Error(), Data: receipt.Signer}
+	}
+
+	// 回执必须是发给本单位的
+	areaResult := a.GetAreaConfig()
+	area, ok := areaResult.Data.(map[string]interface{})
+	if !ok {
+		return db.QueryResult{Ok: false, Message: "未找到区域信息，请先设置区域信息"}
+	}
+	if receipt.ProvinceName != getStringValue(area["province_name"]) ||
+		receipt.CityName != getStringValue(area["city_name"]) ||
+		receipt.CountryName != getStringValue(area["country_name"]) {
+		return db.QueryResult{Ok: false, Message: "回执不是发给本单位的，请检查回执文件"}
+	}
+
+	remark := receipt.Reason
+	if receipt.Issuer != "" {
+		remark = fmt.Sprintf("%s：%s", receipt.Issuer, receipt.Reason)
+	}
+	service := data_import.NewDataImportService(a)
+	accepted := receipt.Status == RECEIPT_STATUS_ACCEPT
+	if len(receipt.Records) > 0 {
+		err = service.ApplyReceiptRecords(receipt.Records, remark, receipt.ReceiptTime, receipt.Issuer)
+	} else {
+		err = service.ApplySubmissionReceipt(receipt.Years, accepted, remark)
+	}
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: "更新报送状态失败: " + err.Error()}
+	}
+
+	message := "导入回执成功，上级已接收报送数据"
+	if !accepted {
+		message = "导入回执成功，上级已退回报送数据，原因：" + receipt.Reason
+	} else {
+		// 上级接收后确认对应的报送记录，之后的增量导出从该次报送开始
+		acked, err := a.acknowledgeWatermarkByHash(receipt.SourceHash)
+		if err != nil {
+			return db.QueryResult{Ok: false, Message: err.Error()}
+		}
+		if acked > 0 {
+			message += "，已确认对应的报送记录，可以增量导出"
+		}
+	}
+	return db.QueryResult{Ok: true, Message: message, Data: receipt}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"shuji/db"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tjfoc/gmsm/x509"
+)
+
+// 可信签名者角色
+const (
+	SIGNER_ROLE_SUBMITTER = "submitter" // 下级报送数据包的签名者
+	SIGNER_ROLE_ISSUER    = "issuer"    // 上级报送回执的签发者
+)
+
+// TrustedSigner 登记的可信签名者，报送数据包按区域登记，回执签发者不区分区域
+type TrustedSigner struct {
+	ObjID        string `json:"obj_id"`
+	Role         string `json:"role"`
+	ProvinceName string `json:"province_name"`
+	CityName     string `json:"city_name"`
+	CountryName  string `json:"country_name"`
+	Fingerprint  string `json:"fingerprint"`
+	PublicKey    string `json:"public_key"`
+	SignerUser   string `json:"signer_user"`
+	SignerHost   string `json:"signer_host"`
+}
+
+// UntrustedSignerError 签名者未登记为该区域的可信签名者，签名本身有效但不能确认签名者身份
+type UntrustedSignerError struct {
+	Signer       SubmissionSigner `json:"signer"`
+	ProvinceName string           `json:"province_name"`
+	CityName     string           `json:"city_name"`
+	CountryName  string           `json:"country_name"`
+}
+
+func (e *UntrustedSignerError) Error() string {
+	return fmt.Sprintf("签名者 %s@%s（指纹 %s）未登记为 %s 的可信签名者，请核对指纹后登记",
+		e.Signer.User, e.Signer.Host, shortFingerprint(e.Signer.Fingerprint), formatArea(e.ProvinceName, e.CityName, e.CountryName))
+}
+
+// shortFingerprint 截取指纹前16位用于提示
+func shortFingerprint(fingerprint string) string {
+	if len(fingerprint) > 16 {
+		return fingerprint[:16]
+	}
+	return fingerprint
+}
+
+// formatArea 拼接省市县名称
+func formatArea(province string, city string, country string) string {
+	var names []string
+	for _, name := range []string{province, city, country} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "未知区域"
+	}
+	return strings.Join(names, "")
+}
+
+// checkTrustedSubmitter 检查报送数据包的签名者是否登记为清单所属区域的可信签名者
+func (a *App) checkTrustedSubmitter(manifest SubmissionManifest) error {
+	if a.GetDB() == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+	countResult, err := a.GetDB().QueryRow(`SELECT COUNT(1) AS count FROM trusted_signer
+		WHERE role = ? AND fingerprint = ? AND province_name = ? AND city_name = ? AND country_name = ?`,
+		SIGNER_ROLE_SUBMITTER, manifest.Signer.Fingerprint, manifest.ProvinceName, manifest.CityName, manifest.CountryName)
+	if err != nil {
+		return fmt.Errorf("查询可信签名者失败: %v", err)
+	}
+	if row, ok := countResult.Data.(map[string]interface{}); ok && db.IntValue(row["count"]) > 0 {
+		return nil
+	}
+	return &UntrustedSignerError{
+		Signer:       manifest.Signer,
+		ProvinceName: manifest.ProvinceName,
+		CityName:     manifest.CityName,
+		CountryName:  manifest.CountryName,
+	}
+}
+
+// checkTrustedIssuer 检查回执签发者是否为登记的上级签发者
+func (a *App) checkTrustedIssuer(fingerprint string) error {
+	if a.GetDB() == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+	countResult, err := a.GetDB().QueryRow("SELECT COUNT(1) AS count FROM trusted_signer WHERE role = ? AND fingerprint = ?",
+		SIGNER_ROLE_ISSUER, fingerprint)
+	if err != nil {
+		return fmt.Errorf("查询回执签发者失败: %v", err)
+	}
+	if row, ok := countResult.Data.(map[string]interface{}); ok && db.IntValue(row["count"]) > 0 {
+		return nil
+	}
+	return fmt.Errorf("回执签发者（指纹 %s）不是登记的上级签发者，请核对指纹后登记", shortFingerprint(fingerprint))
+}
+
+// QueryTrustedSigners 查询登记的可信签名者
+func (a *App) QueryTrustedSigners() db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.queryTrustedSignersWithRecover()
+}
+
+// queryTrustedSignersWithRecover 带异常处理的查询可信签名者函数
+func (a *App) queryTrustedSignersWithRecover() (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("QueryTrustedSigners 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("查询可信签名者发生异常: %v", r)}
+		}
+	}()
+
+	queryResult, err := a.GetDB().Query(`SELECT obj_id, role, province_name, city_name, country_name, fingerprint, public_key,
+		signer_user, signer_host, create_time, create_user FROM trusted_signer ORDER BY role, province_name, city_name, country_name, create_time`)
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("查询可信签名者失败: %v", err)}
+	}
+	return db.QueryResult{Ok: true, Message: "查询成功", Data: queryResult.Data}
+}
+
+// AddTrustedSigner 登记可信签名者，指纹由公钥计算，登记前应与签名者线下核对指纹
+func (a *App) AddTrustedSigner(signer TrustedSigner) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.addTrustedSignerWithRecover(signer)
+}
+
+// addTrustedSignerWithRecover 带异常处理的登记可信签名者函数
+func (a *App) addTrustedSignerWithRecover(signer TrustedSigner) (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("AddTrustedSigner 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("登记可信签名者发生异常: %v", r)}
+		}
+	}()
+
+	if signer.Role != SIGNER_ROLE_SUBMITTER && signer.Role != SIGNER_ROLE_ISSUER {
+		return db.QueryResult{Ok: false, Message: "签名者角色无效"}
+	}
+	if _, err := x509.ReadPublicKeyFromPem([]byte(signer.PublicKey)); err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("签名公钥格式错误: %v", err)}
+	}
+	fingerprint := getKeyFingerprint([]byte(signer.PublicKey))
+	if signer.Fingerprint != "" && signer.Fingerprint != fingerprint {
+		return db.QueryResult{Ok: false, Message: "签名公钥与指纹不一致"}
+	}
+	// 回执签发者不区分区域
+	if signer.Role == SIGNER_ROLE_ISSUER {
+		signer.ProvinceName, signer.CityName, signer.CountryName = "", "", ""
+	}
+
+	_, err := a.GetDB().Exec(`INSERT INTO trusted_signer (
+		obj_id, role, province_name, city_name, country_name, fingerprint, public_key, signer_user, signer_host, create_time, create_user
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (role, fingerprint) DO UPDATE SET
+		province_name = excluded.province_name, city_name = excluded.city_name, country_name = excluded.country_name,
+		signer_user = excluded.signer_user, signer_host = excluded.signer_host`,
+		uuid.New().String(), signer.Role, signer.ProvinceName, signer.CityName, signer.CountryName, fingerprint, signer.PublicKey,
+		signer.SignerUser, signer.SignerHost, time.Now().UnixMilli(), a.GetCurrentOSUser())
+	if err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("登记可信签名者失败: %v", err)}
+	}
+	log.Printf("登记可信签名者: %s %s %s", signer.Role, formatArea(signer.ProvinceName, signer.CityName, signer.CountryName), fingerprint)
+	return db.QueryResult{Ok: true, Message: "登记成功"}
+}
+
+// RemoveTrustedSigner 删除登记的可信签名者
+func (a *App) RemoveTrustedSigner(objID string) db.QueryResult {
+	// 使用包装函数来处理异常
+	return a.removeTrustedSignerWithRecover(objID)
+}
+
+// removeTrustedSignerWithRecover 带异常处理的删除可信签名者函数
+func (a *App) removeTrustedSignerWithRecover(objID string) (result db.QueryResult) {
+	// 添加异常处理，防止函数崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("RemoveTrustedSigner 发生异常: %v", r)
+			result = db.QueryResult{Ok: false, Message: fmt.Sprintf("删除可信签名者发生异常: %v", r)}
+		}
+	}()
+
+	if _, err := a.GetDB().Exec("DELETE FROM trusted_signer WHERE obj_id = ?", objID); err != nil {
+		return db.QueryResult{Ok: false, Message: fmt.Sprintf("删除可信签名者失败: %v", err)}
+	}
+	return db.QueryResult{Ok: true, Message: "删除成功"}
+}